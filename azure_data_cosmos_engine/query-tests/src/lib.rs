@@ -13,8 +13,15 @@ baseline_tests! {
     vector {
         quantized_cosine,
         flat_euclidean,
+        flat_euclidean_all,
         diskann_dotproduct,
     },
+    small_vector {
+        small_vector_cosine_top5,
+        small_vector_cosine_all,
+        small_vector_euclidean_top5,
+        small_vector_euclidean_partition,
+    },
     aggregates {
         average_no_items,
         average_price,
@@ -32,6 +39,12 @@ baseline_tests! {
         sum_price,
         sum_where,
     },
+    dcount {
+        dcount_tag_names,
+        dcount_tag_names_alias,
+        dcount_where,
+        dcount_no_items,
+    },
     hybrid {
         top_10_by_fulltext_rank,
         offset_limit,
@@ -42,4 +55,11 @@ baseline_tests! {
         offset_limit_rrf_unfiltered,
         offset_limit_rrf_ft_with_vector,
     },
+    per_container {
+        per_container_count_orders,
+        per_container_count_customers,
+        per_container_order_totals,
+        per_container_customer_ids,
+        per_container_no_customers_in_orders,
+    },
 }
@@ -39,11 +39,50 @@ struct TestFile {
 #[serde(rename_all = "camelCase")]
 struct TestDataFile {
     pub containers: Vec<ContainerProperties>,
-    pub data: Vec<HashMap<String, serde_json::Value>>,
+    pub data: TestDataItems,
     #[serde(default)]
     pub parameters: HashMap<String, serde_json::Value>,
 }
 
+type TestDataItem = HashMap<String, serde_json::Value>;
+
+/// The items of a test data file, either shared by every container or listed per container.
+#[derive(Deserialize)]
+#[serde(untagged)]
+enum TestDataItems {
+    /// A flat array of items, inserted into every container.
+    AllContainers(Vec<TestDataItem>),
+    /// Items keyed by the ID of the container they are inserted into.
+    PerContainer(HashMap<String, Vec<TestDataItem>>),
+}
+
+impl TestDataItems {
+    /// Returns the items to insert into the container with the given ID.
+    fn for_container(&self, container_id: &str) -> &[TestDataItem] {
+        match self {
+            TestDataItems::AllContainers(items) => items,
+            TestDataItems::PerContainer(items) => items
+                .get(container_id)
+                .map(|items| items.as_slice())
+                .unwrap_or_default(),
+        }
+    }
+
+    /// Checks that every container the items are listed for is defined in the test data file.
+    fn validate(&self, containers: &[ContainerProperties]) -> Result<(), String> {
+        if let TestDataItems::PerContainer(items) = self {
+            for container_id in items.keys() {
+                if !containers.iter().any(|c| c.id == *container_id) {
+                    return Err(format!(
+                        "test data lists items for container '{container_id}', but that container is not defined in the test data file"
+                    ));
+                }
+            }
+        }
+        Ok(())
+    }
+}
+
 struct ValidationError {
     item: usize,
     property_name: String,
@@ -292,6 +331,7 @@ pub async fn run_baseline_test(
     let test_data_file = test_file_dir.join(test_file.test_data);
     let test_data: TestDataFile = serde_json::from_str(&std::fs::read_to_string(&test_data_file)?)?;
     tracing::debug!(?test_data_file, "loaded test data");
+    test_data.data.validate(&test_data.containers)?;
 
     // Identify which container to use for the test
     let test_container_properties = test_data
@@ -321,9 +361,9 @@ pub async fn run_baseline_test(
     {
         let _insert_test_data = tracing::info_span!("insert_test_data");
         tracing::info!("inserting test data");
-        for item in test_data.data {
-            let key = extract_partition_key(&item, &test_container_properties.partition_key)?;
-            container_client.create_item(key, &item, None).await?;
+        for item in test_data.data.for_container(&test_container_properties.id) {
+            let key = extract_partition_key(item, &test_container_properties.partition_key)?;
+            container_client.create_item(key, item, None).await?;
         }
         tracing::info!("inserted test data");
     }
@@ -52,6 +52,17 @@ pub enum ErrorKind {
     /// Indicates that the query cannot be executed by this pipeline.
     InvalidQuery,
 
+    /// Indicates that a continuation token provided to [`QueryPipeline::provide_data`](crate::query::QueryPipeline::provide_data) doesn't belong to the partition key range it was provided for.
+    ///
+    /// This error is not recoverable by retrying with the same token, and indicates either a bug in the language binding (such as swapping tokens between partitions)
+    /// or a stale token that was issued before the partition key ranges changed.
+    InvalidContinuation,
+
+    /// Indicates that the pipeline would have to buffer more items than the limit set with [`QueryPipeline::set_max_buffered_items`](crate::query::QueryPipeline::set_max_buffered_items).
+    ///
+    /// This error is not recoverable by retrying the same query with the same limit. The query must be narrowed (for example, with `TOP` or a filter), or the limit raised.
+    BufferLimitExceeded,
+
     /// Indicates that a Python error occurred. The source of the error will be the original Python error.
     PythonError,
 }
@@ -69,6 +80,8 @@ impl Display for ErrorKind {
             ErrorKind::ArithmeticOverflow => write!(f, "arithmetic overflow occurred"),
             ErrorKind::InvalidRequestId => write!(f, "invalid request ID provided"),
             ErrorKind::InvalidQuery => write!(f, "invalid query"),
+            ErrorKind::InvalidContinuation => write!(f, "invalid continuation token"),
+            ErrorKind::BufferLimitExceeded => write!(f, "buffer limit exceeded"),
             ErrorKind::PythonError => write!(f, "python error"),
         }
     }
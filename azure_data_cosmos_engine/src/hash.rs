@@ -30,7 +30,7 @@ pub enum PartitionKeyValue {
     Undefined,
 }
 
-#[derive(PartialEq, Eq)]
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
 pub enum PartitionKeyKind {
     Hash,
     MultiHash,
@@ -1,10 +1,12 @@
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 
-use std::borrow::Cow;
+use std::{borrow::Cow, collections::HashSet};
 
 use serde::Deserialize;
 
+use crate::ErrorKind;
+
 mod aggregators;
 pub mod node;
 mod pipeline;
@@ -18,8 +20,8 @@ mod engine;
 #[cfg(feature = "query_engine")]
 pub use engine::*;
 
-pub use pipeline::{QueryPipeline, SupportedFeatures, SUPPORTED_FEATURES};
-pub use plan::{DistinctType, QueryInfo, QueryPlan, QueryRange, SortOrder};
+pub use pipeline::{PlanSupport, QueryPipeline, SupportedFeatures, SUPPORTED_FEATURES};
+pub use plan::{DCountInfo, DistinctType, QueryInfo, QueryPlan, QueryRange, SortOrder};
 pub use query_result::{QueryClauseItem, QueryResult, QueryResultShape};
 
 /// Features that may be required by the Query Engine.
@@ -48,6 +50,32 @@ pub enum QueryFeature {
     HybridSearchSkipOrderByRewrite,
 }
 
+impl QueryFeature {
+    /// Gets the camelCase name of the feature, suitable for displaying to users or logging.
+    pub const fn name(&self) -> &'static str {
+        match self {
+            QueryFeature::None => "none",
+            QueryFeature::Aggregate => "aggregate",
+            QueryFeature::CompositeAggregate => "compositeAggregate",
+            QueryFeature::Distinct => "distinct",
+            QueryFeature::GroupBy => "groupBy",
+            QueryFeature::MultipleAggregates => "multipleAggregates",
+            QueryFeature::MultipleOrderBy => "multipleOrderBy",
+            QueryFeature::OffsetAndLimit => "offsetAndLimit",
+            QueryFeature::OrderBy => "orderBy",
+            QueryFeature::Top => "top",
+            QueryFeature::NonValueAggregate => "nonValueAggregate",
+            QueryFeature::DCount => "dCount",
+            QueryFeature::NonStreamingOrderBy => "nonStreamingOrderBy",
+            QueryFeature::ListAndSetAggregate => "listAndSetAggregate",
+            QueryFeature::CountIf => "countIf",
+            QueryFeature::HybridSearch => "hybridSearch",
+            QueryFeature::WeightedRankFusion => "weightedRankFusion",
+            QueryFeature::HybridSearchSkipOrderByRewrite => "hybridSearchSkipOrderByRewrite",
+        }
+    }
+}
+
 #[derive(Debug, Clone)]
 pub struct Query {
     /// The text of the query.
@@ -74,6 +102,12 @@ pub struct PartitionKeyRange {
 }
 
 impl PartitionKeyRange {
+    /// The minimum effective partition key (EPK), which must be the `minInclusive` of the first partition key range.
+    pub const MIN_EPK: &'static str = "";
+
+    /// The maximum effective partition key (EPK), which must be the `maxExclusive` of the last partition key range.
+    pub const MAX_EPK: &'static str = "FF";
+
     pub fn new(
         id: impl Into<String>,
         min_inclusive: impl Into<String>,
@@ -85,6 +119,148 @@ impl PartitionKeyRange {
             max_exclusive: max_exclusive.into(),
         }
     }
+
+    /// Gets the ID of the partition key range.
+    pub fn id(&self) -> &str {
+        &self.id
+    }
+
+    /// Gets the minimum effective partition key (EPK) in the range, inclusive.
+    pub fn min_inclusive(&self) -> &str {
+        &self.min_inclusive
+    }
+
+    /// Gets the maximum effective partition key (EPK) in the range, exclusive.
+    pub fn max_exclusive(&self) -> &str {
+        &self.max_exclusive
+    }
+
+    /// Parses the partition key ranges returned by the gateway, in the form `{"PartitionKeyRanges": [...]}`, and validates them.
+    ///
+    /// If a range can't be parsed, the error identifies it by its index (and ID, if it has one).
+    /// See [`PartitionKeyRange::validate_all`] for the validation rules.
+    pub fn parse_list(json: &str) -> crate::Result<Vec<Self>> {
+        #[derive(Deserialize)]
+        struct PartitionKeyRangeResult {
+            #[serde(rename = "PartitionKeyRanges")]
+            ranges: Vec<serde_json::Value>,
+        }
+
+        let result: PartitionKeyRangeResult = serde_json::from_str(json).map_err(|e| {
+            ErrorKind::InvalidGatewayResponse
+                .with_message(format!("invalid partition key ranges: {}", e))
+        })?;
+        let mut ranges = Vec::with_capacity(result.ranges.len());
+        for (index, value) in result.ranges.into_iter().enumerate() {
+            let id = value
+                .get("id")
+                .and_then(|id| id.as_str())
+                .map(str::to_string);
+            let range = PartitionKeyRange::deserialize(value).map_err(|e| {
+                let message = match id {
+                    Some(id) => format!(
+                        "partition key range '{}' (at index {}) is invalid: {}",
+                        id, index, e
+                    ),
+                    None => format!("partition key range at index {} is invalid: {}", index, e),
+                };
+                ErrorKind::InvalidGatewayResponse.with_message(message)
+            })?;
+            ranges.push(range);
+        }
+        Self::validate_all(&ranges)?;
+        Ok(ranges)
+    }
+
+    /// Validates that the provided partition key ranges describe a complete and consistent partitioning of the container.
+    ///
+    /// The ranges may be provided in any order, but they must:
+    ///
+    /// * Have bounds that are hexadecimal strings (the minimum bound of the first range is the empty string).
+    /// * Have a `minInclusive` that is less than their `maxExclusive`.
+    /// * Have unique IDs.
+    /// * Not overlap.
+    /// * Cover the entire EPK space, from [`PartitionKeyRange::MIN_EPK`] to [`PartitionKeyRange::MAX_EPK`], without gaps.
+    ///
+    /// The error returned names the offending range and the rule that was violated.
+    pub fn validate_all(pkranges: &[PartitionKeyRange]) -> crate::Result<()> {
+        fn invalid(message: String) -> crate::Error {
+            ErrorKind::InvalidGatewayResponse.with_message(message)
+        }
+
+        // EPKs are compared as strings, and the gateway formats them in uppercase, so a lowercase bound would sort after every uppercase one.
+        fn is_hex(s: &str) -> bool {
+            s.bytes()
+                .all(|b| b.is_ascii_digit() || (b'A'..=b'F').contains(&b))
+        }
+
+        if pkranges.is_empty() {
+            return Err(invalid("no partition key ranges were provided".to_string()));
+        }
+
+        let mut ids = HashSet::new();
+        for pkrange in pkranges {
+            if !ids.insert(pkrange.id.as_str()) {
+                return Err(invalid(format!(
+                    "partition key range ID '{}' is not unique",
+                    pkrange.id
+                )));
+            }
+            if !is_hex(&pkrange.min_inclusive) || !is_hex(&pkrange.max_exclusive) {
+                return Err(invalid(format!(
+                    "partition key range '{}' has a bound that is not an uppercase hexadecimal string (minInclusive: '{}', maxExclusive: '{}')",
+                    pkrange.id, pkrange.min_inclusive, pkrange.max_exclusive
+                )));
+            }
+            if pkrange.min_inclusive >= pkrange.max_exclusive {
+                return Err(invalid(format!(
+                    "partition key range '{}' has a minInclusive ('{}') that is not less than its maxExclusive ('{}')",
+                    pkrange.id, pkrange.min_inclusive, pkrange.max_exclusive
+                )));
+            }
+        }
+
+        let mut sorted: Vec<&PartitionKeyRange> = pkranges.iter().collect();
+        sorted.sort_by(|a, b| a.min_inclusive.cmp(&b.min_inclusive));
+
+        let first = sorted[0];
+        if first.min_inclusive != Self::MIN_EPK {
+            return Err(invalid(format!(
+                "partition key range '{}' is the first range, but its minInclusive is '{}' instead of '{}', leaving a gap",
+                first.id,
+                first.min_inclusive,
+                Self::MIN_EPK
+            )));
+        }
+
+        for pair in sorted.windows(2) {
+            let (previous, current) = (pair[0], pair[1]);
+            if previous.max_exclusive > current.min_inclusive {
+                return Err(invalid(format!(
+                    "partition key range '{}' overlaps partition key range '{}' ('{}' is greater than '{}')",
+                    previous.id, current.id, previous.max_exclusive, current.min_inclusive
+                )));
+            }
+            if previous.max_exclusive < current.min_inclusive {
+                return Err(invalid(format!(
+                    "there is a gap between partition key range '{}' (maxExclusive '{}') and partition key range '{}' (minInclusive '{}')",
+                    previous.id, previous.max_exclusive, current.id, current.min_inclusive
+                )));
+            }
+        }
+
+        let last = sorted[sorted.len() - 1];
+        if last.max_exclusive != Self::MAX_EPK {
+            return Err(invalid(format!(
+                "partition key range '{}' is the last range, but its maxExclusive is '{}' instead of '{}'",
+                last.id,
+                last.max_exclusive,
+                Self::MAX_EPK
+            )));
+        }
+
+        Ok(())
+    }
 }
 
 /// Describes a request for additional data from the pipeline.
@@ -100,6 +276,11 @@ pub struct DataRequest {
     pub continuation: Option<String>,
     pub query: Option<String>,
     pub include_parameters: bool,
+
+    /// The portion of the partition key range that this request is scoped to, if the query only covers part of it.
+    ///
+    /// If this is `None`, the request covers the entire partition key range.
+    pub epk_range: Option<EpkRange>,
 }
 
 impl DataRequest {
@@ -114,6 +295,7 @@ impl DataRequest {
             continuation,
             query: None,
             include_parameters: true,
+            epk_range: None,
         }
     }
 
@@ -130,10 +312,53 @@ impl DataRequest {
             continuation,
             query: Some(query.into()),
             include_parameters,
+            epk_range: None,
         }
     }
 }
 
+/// Describes a range of effective partition key (EPK) values within a single partition key range.
+#[derive(Clone, Debug, PartialEq, Eq)]
+#[cfg_attr(feature = "python_conversions", derive(pyo3::IntoPyObject))]
+pub struct EpkRange {
+    /// The minimum EPK value in the range.
+    pub min: String,
+
+    /// The maximum EPK value in the range.
+    pub max: String,
+
+    /// A boolean indicating if the minimum value is inclusive. If false, it's exclusive.
+    pub is_min_inclusive: bool,
+
+    /// A boolean indicating if the maximum value is inclusive. If false, it's exclusive.
+    pub is_max_inclusive: bool,
+}
+
+/// Identifies the kind of problem described by a [`PipelineWarning`].
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum WarningCode {
+    /// An `ORDER BY` item had a type that can't be ordered (an object or array), so it was treated as undefined, which sorts before every other value.
+    UndefinedOrderByItem,
+
+    /// An item in the results of an `ORDER BY` query wasn't an object with `orderByItems` and `payload` properties, so it was skipped.
+    SkippedItem,
+}
+
+/// Describes a problem with the data provided to the pipeline that the pipeline worked around, rather than failing the query.
+///
+/// Warnings are reported by the next call to [`QueryPipeline::run`] after the data is provided, in [`PipelineResponse::warnings`].
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub struct PipelineWarning {
+    /// The kind of problem.
+    pub code: WarningCode,
+
+    /// A description of the problem.
+    pub message: String,
+
+    /// The ID of the partition key range whose data had the problem.
+    pub pkrange_id: String,
+}
+
 #[derive(Clone, Debug)]
 pub struct PipelineResponse {
     /// The items returned by the pipeline.
@@ -148,6 +373,9 @@ pub struct PipelineResponse {
     ///
     /// If this is true, no further items will be produced, even if more data is provided.
     pub terminated: bool,
+
+    /// Problems with the data provided since the previous turn, which the pipeline worked around.
+    pub warnings: Vec<PipelineWarning>,
 }
 
 impl PipelineResponse {
@@ -155,5 +383,122 @@ impl PipelineResponse {
         items: Vec::new(),
         requests: Vec::new(),
         terminated: true,
+        warnings: Vec::new(),
     };
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn validation_error(pkranges: &[(&str, &str, &str)]) -> String {
+        let pkranges: Vec<_> = pkranges
+            .iter()
+            .map(|(id, min, max)| PartitionKeyRange::new(*id, *min, *max))
+            .collect();
+        let err = PartitionKeyRange::validate_all(&pkranges).unwrap_err();
+        assert_eq!(ErrorKind::InvalidGatewayResponse, err.kind());
+        err.to_string()
+    }
+
+    #[test]
+    fn validate_accepts_complete_ranges_in_any_order() {
+        let pkranges = vec![
+            PartitionKeyRange::new("1", "80", "FF"),
+            PartitionKeyRange::new("0", "", "80"),
+        ];
+        PartitionKeyRange::validate_all(&pkranges).unwrap();
+    }
+
+    #[test]
+    fn validate_rejects_empty_list() {
+        assert_eq!(
+            "no partition key ranges were provided",
+            validation_error(&[])
+        );
+    }
+
+    #[test]
+    fn validate_rejects_non_hex_bounds() {
+        assert!(
+            validation_error(&[("0", "", "8G"), ("1", "8G", "FF")]).starts_with(
+                "partition key range '0' has a bound that is not an uppercase hexadecimal string"
+            )
+        );
+    }
+
+    #[test]
+    fn validate_rejects_lowercase_hex_bounds() {
+        assert!(
+            validation_error(&[("0", "", "8a"), ("1", "8a", "FF")]).starts_with(
+                "partition key range '0' has a bound that is not an uppercase hexadecimal string"
+            )
+        );
+    }
+
+    #[test]
+    fn validate_rejects_min_not_less_than_max() {
+        assert!(
+            validation_error(&[("0", "", "80"), ("1", "80", "80"), ("2", "80", "FF")])
+                .starts_with("partition key range '1' has a minInclusive ('80') that is not less than its maxExclusive ('80')")
+        );
+    }
+
+    #[test]
+    fn validate_rejects_duplicate_ids() {
+        assert_eq!(
+            "partition key range ID '0' is not unique",
+            validation_error(&[("0", "", "80"), ("0", "80", "FF")])
+        );
+    }
+
+    #[test]
+    fn validate_rejects_overlaps() {
+        assert!(validation_error(&[("0", "", "90"), ("1", "80", "FF")])
+            .starts_with("partition key range '0' overlaps partition key range '1'"));
+    }
+
+    #[test]
+    fn validate_rejects_gaps() {
+        assert!(validation_error(&[("0", "", "70"), ("1", "80", "FF")])
+            .starts_with("there is a gap between partition key range '0'"));
+    }
+
+    #[test]
+    fn validate_rejects_incomplete_coverage() {
+        assert!(validation_error(&[("0", "00", "80"), ("1", "80", "FF")])
+            .starts_with("partition key range '0' is the first range"));
+        assert!(validation_error(&[("0", "", "80"), ("1", "80", "F0")])
+            .starts_with("partition key range '1' is the last range"));
+    }
+
+    #[test]
+    fn parse_list_names_range_with_missing_field() {
+        let err = PartitionKeyRange::parse_list(
+            r#"{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"80"},{"id":"1","maxExclusive":"FF"}]}"#,
+        )
+        .unwrap_err();
+        assert_eq!(ErrorKind::InvalidGatewayResponse, err.kind());
+        assert_eq!(
+            "partition key range '1' (at index 1) is invalid: missing field `minInclusive`",
+            err.to_string()
+        );
+    }
+
+    #[test]
+    fn parse_list_validates_ranges() {
+        let pkranges = PartitionKeyRange::parse_list(
+            r#"{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"80"},{"id":"1","minInclusive":"80","maxExclusive":"FF"}]}"#,
+        )
+        .unwrap();
+        assert_eq!(2, pkranges.len());
+
+        let err = PartitionKeyRange::parse_list(
+            r#"{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"80"}]}"#,
+        )
+        .unwrap_err();
+        assert!(err
+            .to_string()
+            .starts_with("partition key range '0' is the last range"));
+    }
+}
@@ -1,7 +1,11 @@
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 
-use std::{collections::VecDeque, fmt::Debug, str::FromStr};
+use std::{
+    collections::{HashSet, VecDeque},
+    fmt::Debug,
+    str::FromStr,
+};
 
 use crate::{query::aggregators::Aggregator, ErrorKind};
 
@@ -246,3 +250,113 @@ impl PipelineNode for AggregatePipelineNode {
         }
     }
 }
+
+/// A pipeline node that counts the distinct results produced by the rest of the pipeline.
+///
+/// This implements `DCOUNT` queries, for which the gateway rewrites the query into a `SELECT DISTINCT` to be run against each partition.
+/// Each partition only returns distinct values, but the same value may be returned by more than one partition, so results are deduplicated here before they are counted.
+#[derive(Debug)]
+pub struct DCountPipelineNode {
+    /// The alias to use for the count, or `None` if the count should be returned as a bare value.
+    alias: Option<String>,
+
+    /// The canonical JSON representation of each distinct value seen so far, with its numbers normalized by [`normalize_numbers`].
+    seen: HashSet<String>,
+
+    /// Indicates if the final count has already been produced.
+    completed: bool,
+}
+
+impl DCountPipelineNode {
+    pub fn new(alias: impl Into<String>) -> Self {
+        let alias = alias.into();
+        Self {
+            alias: (!alias.is_empty()).then_some(alias),
+            seen: HashSet::new(),
+            completed: false,
+        }
+    }
+}
+
+/// Converts every number in the value, including those nested in arrays and objects, to an `f64`.
+///
+/// Cosmos DB numbers are doubles, so numbers that are written differently but are equal (e.g. `1`, `1.0`, and `-0`) must count as the same value.
+fn normalize_numbers(value: serde_json::Value) -> serde_json::Value {
+    match value {
+        serde_json::Value::Number(n) => match n.as_f64() {
+            // Adding 0.0 turns -0.0 into 0.0, and leaves every other number unchanged.
+            Some(f) => serde_json::Number::from_f64(f + 0.0)
+                .map(serde_json::Value::Number)
+                .unwrap_or(serde_json::Value::Number(n)),
+            None => serde_json::Value::Number(n),
+        },
+        serde_json::Value::Array(items) => {
+            serde_json::Value::Array(items.into_iter().map(normalize_numbers).collect())
+        }
+        serde_json::Value::Object(properties) => serde_json::Value::Object(
+            properties
+                .into_iter()
+                .map(|(name, value)| (name, normalize_numbers(value)))
+                .collect(),
+        ),
+        other => other,
+    }
+}
+
+impl PipelineNode for DCountPipelineNode {
+    fn next_item(&mut self, mut rest: PipelineSlice) -> crate::Result<PipelineNodeResult> {
+        if self.completed {
+            return Ok(PipelineNodeResult {
+                value: None,
+                terminated: true,
+            });
+        }
+
+        // Consume everything that's currently available, since a single item is only produced once all the data is in.
+        loop {
+            let result = rest.run()?;
+            let Some(item) = result.value else {
+                if result.terminated {
+                    break;
+                }
+                return Ok(PipelineNodeResult::NO_RESULT);
+            };
+
+            let payload = item.into_payload().ok_or_else(|| {
+                ErrorKind::InvalidGatewayResponse
+                    .with_message("expected distinct results for DCOUNT query")
+            })?;
+
+            // Round-trip through a `Value` so that equivalent values (e.g. objects with properties in a different order, or `1` and `1.0`) produce the same key.
+            let value: serde_json::Value = serde_json::from_str(payload.get()).map_err(|e| {
+                ErrorKind::InvalidGatewayResponse
+                    .with_message(format!("failed to parse DCOUNT result: {}", e))
+            })?;
+            self.seen.insert(normalize_numbers(value).to_string());
+
+            if result.terminated {
+                break;
+            }
+        }
+
+        tracing::debug!(
+            count = self.seen.len(),
+            "distinct count complete, producing final result"
+        );
+        self.completed = true;
+        let count = serde_json::Value::from(self.seen.len());
+        let value = match self.alias.take() {
+            Some(alias) => serde_json::json!({ alias: count }),
+            None => count,
+        };
+        let raw_value = serde_json::value::to_raw_value(&value).map_err(|e| {
+            ErrorKind::InternalError
+                .with_message(format!("failed to serialize DCOUNT result: {}", e))
+        })?;
+        self.seen = HashSet::new();
+        Ok(PipelineNodeResult::result(
+            QueryResult::RawPayload(raw_value),
+            true,
+        ))
+    }
+}
@@ -1,26 +1,28 @@
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 
-use std::ffi::CStr;
+use std::{collections::HashMap, ffi::CStr};
 
 use crate::{
+    get_hashed_partition_key_string,
     query::{
-        node::AggregatePipelineNode, plan::HybridSearchQueryInfo, query_result::QueryResultShape,
+        node::{AggregatePipelineNode, DCountPipelineNode},
+        plan::HybridSearchQueryInfo,
+        query_result::QueryResultShape,
         QueryInfo,
     },
-    ErrorKind,
+    ErrorKind, PartitionKeyKind, PartitionKeyValue,
 };
 
 use super::{
     node::{LimitPipelineNode, OffsetPipelineNode, PipelineNode, PipelineSlice},
     plan::{DistinctType, QueryRange},
     producer::ItemProducer,
-    PartitionKeyRange, PipelineResponse, QueryFeature, QueryPlan,
+    EpkRange, PartitionKeyRange, PipelineResponse, PipelineWarning, QueryFeature, QueryPlan,
 };
 
 /// Holds a list of [`QueryFeature`]s and a string representation suitable for being passed to the gateway when requesting a query plan.
 pub struct SupportedFeatures {
-    #[allow(dead_code)]
     supported_features: &'static [QueryFeature],
     supported_features_cstr: &'static CStr,
 }
@@ -43,6 +45,46 @@ impl SupportedFeatures {
     pub const fn as_cstr(&self) -> &'static CStr {
         self.supported_features_cstr
     }
+
+    /// Returns a boolean indicating if the provided [`QueryFeature`] is supported by this engine.
+    pub fn supports(&self, feature: QueryFeature) -> bool {
+        self.supported_features.contains(&feature)
+    }
+
+    /// Checks which of the features required by the provided [`QueryPlan`] are supported by this engine.
+    ///
+    /// This does not create a pipeline, so it can be used to decide whether to use the engine before doing any other work.
+    pub fn check(&self, plan: &QueryPlan) -> PlanSupport {
+        let required = plan.required_features();
+        let (supported, missing) = required.iter().partition(|f| self.supports(**f));
+        PlanSupport {
+            required,
+            supported,
+            missing,
+        }
+    }
+}
+
+/// Describes the features required by a [`QueryPlan`], and which of them are supported by the engine.
+///
+/// Created by [`SupportedFeatures::check`].
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub struct PlanSupport {
+    /// The features required by the query plan.
+    pub required: Vec<QueryFeature>,
+
+    /// The required features that are supported by the engine.
+    pub supported: Vec<QueryFeature>,
+
+    /// The required features that are NOT supported by the engine.
+    pub missing: Vec<QueryFeature>,
+}
+
+impl PlanSupport {
+    /// Returns a boolean indicating if the engine supports all the features required by the query plan.
+    pub fn is_supported(&self) -> bool {
+        self.missing.is_empty()
+    }
 }
 
 macro_rules! supported_features {
@@ -64,6 +106,7 @@ supported_features!(
     Top,
     NonStreamingOrderBy,
     Aggregate,
+    DCount,
     HybridSearch,
 );
 
@@ -114,8 +157,41 @@ pub struct QueryPipeline {
     pipeline: Vec<Box<dyn PipelineNode>>,
     producer: ItemProducer,
 
+    /// The EPK ranges that requests to each partition key range should be scoped to, for partition key ranges that the query only partially covers.
+    epk_ranges: HashMap<String, EpkRange>,
+
     // Indicates if the pipeline has been terminated early.
     terminated: bool,
+
+    /// Indicates if the pipeline has stopped fetching data, and is only producing items that have already been buffered.
+    draining: bool,
+
+    /// The number of items the consumer wants in each turn, if it has set one.
+    target_batch_size: Option<usize>,
+
+    /// Describes how the pipeline was constructed from the query plan, see [`QueryPipeline::explain`].
+    description: PipelineDescription,
+
+    /// Problems with the data provided since the last turn, which are reported by the next turn.
+    warnings: Vec<PipelineWarning>,
+}
+
+/// Describes how a [`QueryPipeline`] was constructed from its query plan.
+///
+/// This is captured when the pipeline is created, because the nodes and producer don't retain their original configuration as they run.
+#[derive(Debug, Default)]
+struct PipelineDescription {
+    /// The strategy used to merge the results from each partition.
+    producer: &'static str,
+
+    /// The number of `ORDER BY` items used to merge the results from each partition.
+    sort_key_count: usize,
+
+    /// The stages applied to the merged results, in the order they're executed (outermost first).
+    stages: Vec<String>,
+
+    /// The partition key ranges the query targets.
+    pkranges: Vec<PartitionKeyRange>,
 }
 
 impl std::fmt::Debug for QueryPipeline {
@@ -124,7 +200,10 @@ impl std::fmt::Debug for QueryPipeline {
             .field("query", &self.query)
             .field("pipeline", &self.pipeline)
             .field("producer", &self.producer)
+            .field("epk_ranges", &self.epk_ranges)
             .field("terminated", &self.terminated)
+            .field("draining", &self.draining)
+            .field("target_batch_size", &self.target_batch_size)
             .finish()
     }
 }
@@ -135,7 +214,7 @@ impl QueryPipeline {
     /// # Parameters
     /// * `query` - The ORIGINAL query specified by the user. If the [`QueryPlan`] has a `rewritten_query`, the pipeline will handle rewriting it.
     /// * `plan` - The query plan that describes how to execute the query.
-    /// * `pkranges` - An iterator that produces the [`PartitionKeyRange`]s that the query will be executed against.
+    /// * `pkranges` - An iterator that produces ALL the [`PartitionKeyRange`]s for the container. These are validated using [`PartitionKeyRange::validate_all`].
     #[tracing::instrument(level = "debug", skip_all, err)]
     pub fn new(
         query: &str,
@@ -143,11 +222,16 @@ impl QueryPipeline {
         pkranges: impl IntoIterator<Item = PartitionKeyRange>,
     ) -> crate::Result<Self> {
         let mut pkranges: Vec<PartitionKeyRange> = pkranges.into_iter().collect();
+        PartitionKeyRange::validate_all(&pkranges)?;
+        // The ranges can be provided in any order, but finding the ranges the query overlaps requires them to be sorted.
+        pkranges.sort_by(|a, b| a.min_inclusive.cmp(&b.min_inclusive));
         get_overlapping_pk_ranges(&mut pkranges, &plan.query_ranges);
+        let epk_ranges = get_epk_ranges(&pkranges, &plan.query_ranges);
+        let target_pkranges = pkranges.clone();
 
         tracing::trace!(?query, ?plan, "creating query pipeline");
 
-        let pipeline = if let Some(hybrid_search_query_info) = plan.hybrid_search_query_info {
+        let mut pipeline = if let Some(hybrid_search_query_info) = plan.hybrid_search_query_info {
             // This is a hybrid search query, which requires special handling.
             Self::from_hybrid_search_query_info(hybrid_search_query_info, pkranges)?
         } else if let Some(query_info) = plan.query_info {
@@ -157,12 +241,80 @@ impl QueryPipeline {
                 "query plan is missing both hybrid_search_query_info and query_info sections",
             ));
         };
+        pipeline.epk_ranges = epk_ranges;
+        pipeline.description.pkranges = target_pkranges;
 
         tracing::debug!(pipeline = ?pipeline, "created query pipeline");
 
         Ok(pipeline)
     }
 
+    /// Creates a new query pipeline scoped to the single partition key range that owns the provided partition key.
+    ///
+    /// This is useful when the caller already knows the partition key the query targets, since it computes the effective partition key (EPK)
+    /// for the partition key, selects the partition key range that owns it, and scopes all requests to it.
+    /// Any `queryRanges` in the query plan are replaced by the partition key.
+    ///
+    /// # Parameters
+    /// * `query` - The ORIGINAL query specified by the user. If the [`QueryPlan`] has a `rewritten_query`, the pipeline will handle rewriting it.
+    /// * `plan` - The query plan that describes how to execute the query.
+    /// * `pkranges` - An iterator that produces the [`PartitionKeyRange`]s for the container.
+    /// * `partition_key` - The components of the partition key.
+    /// * `kind` - The kind of partition key used by the container.
+    /// * `version` - The version of the hash partitioning used by the container.
+    pub fn for_partition_key(
+        query: &str,
+        plan: QueryPlan,
+        pkranges: impl IntoIterator<Item = PartitionKeyRange>,
+        partition_key: &[PartitionKeyValue],
+        kind: PartitionKeyKind,
+        version: u8,
+    ) -> crate::Result<Self> {
+        if kind != PartitionKeyKind::Hash || !(1..=2).contains(&version) {
+            return Err(ErrorKind::InvalidQuery.with_message(
+                "only 'Hash' partition keys, using version 1 or 2, can be used to scope a query pipeline",
+            ));
+        }
+        let effective_partition_key = get_hashed_partition_key_string(partition_key, kind, version);
+        Self::for_effective_partition_key(query, plan, pkranges, effective_partition_key)
+    }
+
+    /// Creates a new query pipeline scoped to the single partition key range that owns the provided effective partition key (EPK).
+    ///
+    /// See [`QueryPipeline::for_partition_key`] for more information.
+    #[tracing::instrument(level = "debug", skip_all, err, fields(effective_partition_key))]
+    pub fn for_effective_partition_key(
+        query: &str,
+        mut plan: QueryPlan,
+        pkranges: impl IntoIterator<Item = PartitionKeyRange>,
+        effective_partition_key: impl Into<String>,
+    ) -> crate::Result<Self> {
+        let effective_partition_key = effective_partition_key.into();
+        tracing::Span::current()
+            .record("effective_partition_key", effective_partition_key.as_str());
+
+        let mut pkranges: Vec<PartitionKeyRange> = pkranges.into_iter().collect();
+        PartitionKeyRange::validate_all(&pkranges)?;
+        if !pkranges.iter().any(|pkrange| {
+            pkrange.min_inclusive <= effective_partition_key
+                && effective_partition_key < pkrange.max_exclusive
+        }) {
+            return Err(ErrorKind::UnknownPartitionKeyRange.with_message(format!(
+                "no partition key range owns the effective partition key '{}'",
+                effective_partition_key
+            )));
+        }
+
+        plan.query_ranges = vec![QueryRange {
+            min: effective_partition_key.clone(),
+            max: effective_partition_key,
+            is_min_inclusive: true,
+            is_max_inclusive: true,
+        }];
+        pkranges.sort_by(|a, b| a.min_inclusive.cmp(&b.min_inclusive));
+        Self::new(query, plan, pkranges)
+    }
+
     fn from_hybrid_search_query_info(
         hybrid_search_query_info: HybridSearchQueryInfo,
         pkranges: impl IntoIterator<Item = PartitionKeyRange>,
@@ -174,7 +326,15 @@ impl QueryPipeline {
             query: None, // The original query isn't relevant.
             pipeline: Vec::new(),
             producer,
+            epk_ranges: HashMap::new(),
             terminated: false,
+            draining: false,
+            target_batch_size: None,
+            warnings: Vec::new(),
+            description: PipelineDescription {
+                producer: "HybridSearch",
+                ..Default::default()
+            },
         })
     }
 
@@ -194,6 +354,10 @@ impl QueryPipeline {
                 .with_message("queries with both ORDER BY and aggregates are not supported"));
         }
 
+        let mut description = PipelineDescription {
+            sort_key_count: query_info.order_by.len(),
+            ..Default::default()
+        };
         let producer = if query_info.order_by.is_empty() {
             tracing::debug!("using unordered pipeline");
             // Determine the shape for unordered queries
@@ -202,14 +366,28 @@ impl QueryPipeline {
             } else {
                 QueryResultShape::RawPayload
             };
+            description.producer = "Unordered";
             ItemProducer::unordered(pkranges, result_shape)
         } else {
             if query_info.has_non_streaming_order_by {
-                tracing::debug!(?query_info.order_by, "using non-streaming ORDER BY pipeline");
-                ItemProducer::non_streaming(pkranges, query_info.order_by)
+                // The pipeline can never emit more than TOP or OFFSET + LIMIT items, so there's no need to buffer any more than that.
+                let max_buffered_items = [
+                    query_info.top,
+                    query_info
+                        .limit
+                        .map(|limit| limit.saturating_add(query_info.offset.unwrap_or(0))),
+                ]
+                .into_iter()
+                .flatten()
+                .min()
+                .map(|max| usize::try_from(max).unwrap_or(usize::MAX));
+                tracing::debug!(?query_info.order_by, ?max_buffered_items, "using non-streaming ORDER BY pipeline");
+                description.producer = "NonStreamingOrderBy";
+                ItemProducer::non_streaming(pkranges, query_info.order_by, max_buffered_items)
             } else {
                 // We can stream results, there's no vector or full-text search in the query.
                 tracing::debug!(?query_info.order_by, "using streaming ORDER BY pipeline");
+                description.producer = "StreamingOrderBy";
                 ItemProducer::streaming(pkranges, query_info.order_by)
             }
         };
@@ -223,22 +401,28 @@ impl QueryPipeline {
         if let Some(limit) = query_info.limit {
             tracing::debug!(limit, "adding LIMIT node to pipeline");
             pipeline.push(Box::new(LimitPipelineNode::new(limit)));
+            description.stages.push(format!("Limit({limit})"));
         }
 
         if let Some(top) = query_info.top {
             tracing::debug!(top, "adding TOP node to pipeline");
             pipeline.push(Box::new(LimitPipelineNode::new(top)));
+            description.stages.push(format!("Top({top})"));
         }
 
         if let Some(offset) = query_info.offset {
             tracing::debug!(offset, "adding OFFSET node to pipeline");
             pipeline.push(Box::new(OffsetPipelineNode::new(offset)));
+            description.stages.push(format!("Offset({offset})"));
         }
 
         if !query_info.aggregates.is_empty() {
             pipeline.push(Box::new(AggregatePipelineNode::from_names(
                 query_info.aggregates.clone(),
             )?));
+            description
+                .stages
+                .push(format!("Aggregate({})", query_info.aggregates.join(", ")));
         }
 
         if !query_info.group_by_expressions.is_empty()
@@ -250,7 +434,16 @@ impl QueryPipeline {
             );
         }
 
-        if query_info.distinct_type != DistinctType::None {
+        if let Some(d_count_info) = &query_info.d_count_info {
+            // A DCOUNT is executed as a DISTINCT query against each partition, so the DISTINCT is handled by the DCOUNT node.
+            tracing::debug!(alias = ?d_count_info.d_count_alias, "adding DCOUNT node to pipeline");
+            pipeline.push(Box::new(DCountPipelineNode::new(
+                d_count_info.d_count_alias.clone(),
+            )));
+            description
+                .stages
+                .push(format!("DCount({})", d_count_info.d_count_alias));
+        } else if query_info.distinct_type != DistinctType::None {
             return Err(
                 ErrorKind::UnsupportedQueryPlan.with_message("DISTINCT queries are not supported")
             );
@@ -272,7 +465,12 @@ impl QueryPipeline {
             query,
             pipeline,
             producer,
+            epk_ranges: HashMap::new(),
             terminated: false,
+            draining: false,
+            target_batch_size: None,
+            warnings: Vec::new(),
+            description,
         })
     }
 
@@ -284,11 +482,112 @@ impl QueryPipeline {
         self.query.as_deref()
     }
 
+    /// Describes how the pipeline was constructed from the query plan, for debugging.
+    ///
+    /// The description is human-readable text listing the (possibly rewritten) query, the strategy used to merge the results from each partition,
+    /// the number of `ORDER BY` items, the stages applied to the merged results (outermost first), and the partition key ranges the query targets,
+    /// including the EPK range requests to each are scoped to, if the query only partially covers it.
+    /// The format is intended for people, and may change between versions, so it shouldn't be parsed.
+    pub fn explain(&self) -> String {
+        let description = &self.description;
+        let mut lines = vec![
+            format!("Query: {}", self.query.as_deref().unwrap_or("(none)")),
+            format!("Producer: {}", description.producer),
+            format!("Sort keys: {}", description.sort_key_count),
+        ];
+
+        if description.stages.is_empty() {
+            lines.push("Stages: (none)".to_string());
+        } else {
+            lines.push("Stages:".to_string());
+            lines.extend(
+                description
+                    .stages
+                    .iter()
+                    .map(|stage| format!("  - {stage}")),
+            );
+        }
+
+        lines.push("Partition key ranges:".to_string());
+        for pkrange in &description.pkranges {
+            let mut line = format!(
+                "  - {} ['{}', '{}')",
+                pkrange.id, pkrange.min_inclusive, pkrange.max_exclusive
+            );
+            if let Some(epk_range) = self.epk_ranges.get(&pkrange.id) {
+                line.push_str(&format!(
+                    " scoped to {}'{}', '{}'{}",
+                    if epk_range.is_min_inclusive { '[' } else { '(' },
+                    epk_range.min,
+                    epk_range.max,
+                    if epk_range.is_max_inclusive { ']' } else { ')' },
+                ));
+            }
+            lines.push(line);
+        }
+
+        lines.join("\n")
+    }
+
     /// Indicates if the pipeline has been completed.
     pub fn complete(&self) -> bool {
         self.terminated
     }
 
+    /// Sets the maximum number of partitions that the pipeline requests data for in a single turn, or `0` for no limit.
+    ///
+    /// Queries without an `ORDER BY` produce items from one partition at a time, in partition key range order, and by default only request data for that partition.
+    /// Raising this limit lets the pipeline request data for the partitions that follow while the current one is drained, so that the language binding can fetch them in parallel.
+    /// Items are still produced in the same order, but the items for the partitions that follow are buffered until the current one is exhausted.
+    ///
+    /// Other queries already request data for every partition in each turn, so this has no effect on them.
+    pub fn set_max_concurrent_partitions(&mut self, max: usize) {
+        self.producer.set_max_concurrent_partitions(max);
+    }
+
+    /// Sets the number of items the consumer wants from each turn, or `0` if it has no preference.
+    ///
+    /// This is a hint, used to keep the data the pipeline fetches and buffers proportional to the consumer's demand.
+    /// Each turn produces at most this many items, leaving the rest buffered for the next turn.
+    /// Queries that can stream results only request data that's needed to produce the next item,
+    /// and only prefetch more data while the items buffered (and expected from the requests being made) fall short of the target.
+    /// Queries that have to fetch all the data before producing any items still request data for every partition.
+    pub fn set_target_batch_size(&mut self, target: usize) {
+        self.target_batch_size = (target > 0).then_some(target);
+        self.producer.set_fetch_target(self.target_batch_size);
+    }
+
+    /// Sets the maximum number of items the pipeline may buffer while it waits for every partition to be drained, or `0` for no limit.
+    ///
+    /// Queries that have to fetch all the data before producing any items, such as ORDER BY queries on a vector distance, buffer every item from every partition
+    /// (or, if the query uses `TOP` or `OFFSET`/`LIMIT`, only as many as it can return). If more items than this would be buffered,
+    /// [`QueryPipeline::provide_data`] fails with [`ErrorKind::BufferLimitExceeded`] rather than exhausting memory.
+    /// Queries that stream their results don't buffer the whole result set, so this has no effect on them.
+    pub fn set_max_buffered_items(&mut self, max: usize) {
+        self.producer
+            .set_max_buffered_items((max > 0).then_some(max));
+    }
+
+    /// Indicates if the pipeline is draining, see [`QueryPipeline::drain`].
+    pub fn draining(&self) -> bool {
+        self.draining
+    }
+
+    /// Stops the pipeline from fetching any more data, so that it only produces the items it has already buffered.
+    ///
+    /// This is useful when the caller no longer needs any more results (for example, because it applies its own limit), but wants to consume what's already been fetched.
+    /// After this is called, [`QueryPipeline::run`] never returns requests, and the pipeline completes once the buffered items have been produced.
+    /// Data may still be provided for requests that were already in flight, and will be produced as well.
+    ///
+    /// Items are produced in the same order they would otherwise have been, but only from the data that has been buffered.
+    /// Ordered queries produce every buffered item, treating each partition as if it had no more data,
+    /// and queries that aggregate over all results (such as `COUNT`) produce a result computed from the buffered data only.
+    pub fn drain(&mut self) {
+        tracing::debug!("draining pipeline, no more data will be fetched");
+        self.draining = true;
+        self.producer.stop_fetching();
+    }
+
     /// Provides more data for the specified partition key range.
     #[tracing::instrument(level = "debug", skip_all, err, fields(request_id, pkrange_id, data_len = data.len(), continuation = continuation.as_deref()))]
     pub fn provide_data(
@@ -298,8 +597,15 @@ impl QueryPipeline {
         data: &[u8],
         continuation: Option<String>,
     ) -> crate::Result<()> {
-        self.producer
-            .provide_data(pkrange_id, request_id, data, continuation)
+        let warnings = self
+            .producer
+            .provide_data(pkrange_id, request_id, data, continuation)?;
+        self.warnings.extend(warnings);
+        if self.draining {
+            // The continuation may have restarted the partition, so stop it again.
+            self.producer.stop_fetching();
+        }
+        Ok(())
     }
 
     /// Advances the pipeline to the next batch of results.
@@ -318,6 +624,10 @@ impl QueryPipeline {
     /// to return any requests that still need to be made.
     ///
     /// If the pipeline returns no items and no requests, then the query has completed and there are no further results to return.
+    ///
+    /// If a target batch size has been set (see [`QueryPipeline::set_target_batch_size`]), the turn produces at most that many items.
+    ///
+    /// If the pipeline is draining (see [`QueryPipeline::drain`]), no requests are returned, and each turn produces the remaining buffered items (up to the target batch size, if any) until the pipeline completes.
     #[tracing::instrument(level = "debug", skip(self), err)]
     pub fn run(&mut self) -> crate::Result<PipelineResponse> {
         if self.terminated {
@@ -342,18 +652,39 @@ impl QueryPipeline {
                         .with_message("items yielded by the pipeline must have a payload")
                 })?;
                 items.push(payload);
-            } else {
+                if self
+                    .target_batch_size
+                    .is_some_and(|target| items.len() >= target)
+                {
+                    // The consumer has what it asked for, leave anything else buffered for the next turn.
+                    break;
+                }
+            } else if !self.draining {
                 // The pipeline has finished for now, but we're not terminated yet.
                 break;
             }
+            // When draining, no more data is coming, so nodes that consume items without producing any (like aggregates) just need more turns.
         }
 
-        let requests = self.producer.data_requests()?;
+        if self.draining {
+            return Ok(PipelineResponse {
+                items,
+                requests: Vec::new(),
+                terminated: self.terminated,
+                warnings: std::mem::take(&mut self.warnings),
+            });
+        }
+
+        let mut requests = self.producer.data_requests()?;
+        for request in &mut requests {
+            request.epk_range = self.epk_ranges.get(request.pkrange_id.as_ref()).cloned();
+        }
 
         Ok(PipelineResponse {
             items,
             requests,
             terminated: self.terminated,
+            warnings: std::mem::take(&mut self.warnings),
         })
     }
 }
@@ -425,16 +756,76 @@ fn get_overlapping_pk_ranges(pkranges: &mut Vec<PartitionKeyRange>, query_ranges
     pkranges.truncate(write_idx);
 }
 
+/// Computes the EPK range that requests to each partition key range should be scoped to.
+///
+/// The returned map only contains entries for partition key ranges that are partially covered by the query ranges.
+/// Partition key ranges that are fully covered (or not covered at all) should be queried without an EPK range.
+/// If more than one query range overlaps a partition key range, the scope covers all of them.
+fn get_epk_ranges(
+    pkranges: &[PartitionKeyRange],
+    query_ranges: &[QueryRange],
+) -> HashMap<String, EpkRange> {
+    let mut epk_ranges = HashMap::new();
+    for pkrange in pkranges {
+        let mut overlapping = query_ranges
+            .iter()
+            .filter(|query_range| pkrange_overlaps_query_range(pkrange, query_range));
+        let Some(first) = overlapping.next() else {
+            continue;
+        };
+
+        // Query ranges are sorted by min, so the first overlapping range has the lowest min, but any of them could have the highest max.
+        let mut max = (first.max.as_str(), first.is_max_inclusive);
+        for query_range in overlapping {
+            if query_range.max.as_str() > max.0
+                || (query_range.max == max.0 && query_range.is_max_inclusive)
+            {
+                max = (query_range.max.as_str(), query_range.is_max_inclusive);
+            }
+        }
+
+        // Clamp the scope to the bounds of the partition key range.
+        // A query range that starts exactly at the partition key range's min keeps its own inclusivity, since an exclusive min still excludes that key.
+        let (min, is_min_inclusive) = if first.min < pkrange.min_inclusive {
+            (pkrange.min_inclusive.as_str(), true)
+        } else {
+            (first.min.as_str(), first.is_min_inclusive)
+        };
+        let (max, is_max_inclusive) = if max.0 >= pkrange.max_exclusive.as_str() {
+            (pkrange.max_exclusive.as_str(), false)
+        } else {
+            max
+        };
+
+        if min == pkrange.min_inclusive
+            && is_min_inclusive
+            && max == pkrange.max_exclusive
+            && !is_max_inclusive
+        {
+            // The query covers the entire partition key range, so there's no need to scope the request.
+            continue;
+        }
+
+        epk_ranges.insert(
+            pkrange.id.clone(),
+            EpkRange {
+                min: min.to_string(),
+                max: max.to_string(),
+                is_min_inclusive,
+                is_max_inclusive,
+            },
+        );
+    }
+    epk_ranges
+}
+
 /// Determines if a partition key range overlaps with a query range.
 /// PartitionKeyRange is always [min_inclusive, max_exclusive).
 fn pkrange_overlaps_query_range(pkrange: &PartitionKeyRange, query_range: &QueryRange) -> bool {
     // Check for non-overlap cases (easier to reason about)
 
-    // PKRange ends before query starts
-    if pkrange.max_exclusive < query_range.min {
-        return false;
-    }
-    if pkrange.max_exclusive == query_range.min && !query_range.is_min_inclusive {
+    // PKRange ends before query starts. The max is exclusive, so a query range starting exactly at the max doesn't overlap.
+    if pkrange.max_exclusive <= query_range.min {
         return false;
     }
 
@@ -454,6 +845,8 @@ fn pkrange_overlaps_query_range(pkrange: &PartitionKeyRange, query_range: &Query
 
 #[cfg(test)]
 mod tests {
+    use crate::query::{DCountInfo, DataRequest, SortOrder, WarningCode};
+
     use super::*;
 
     fn create_pkrange(id: &str, min: &str, max: &str) -> PartitionKeyRange {
@@ -729,4 +1122,770 @@ mod tests {
 
         assert_eq!(pkranges.len(), 0);
     }
+
+    #[test]
+    fn test_epk_ranges_point_range() {
+        let pkranges = vec![
+            create_pkrange("pk1", "00000000", "40000000"),
+            create_pkrange("pk2", "40000000", "80000000"),
+        ];
+        let query_ranges = vec![create_query_range("5A5A5A5A", "5A5A5A5A", true, true)];
+
+        let epk_ranges = get_epk_ranges(&pkranges, &query_ranges);
+
+        assert_eq!(
+            epk_ranges,
+            HashMap::from([(
+                "pk2".to_string(),
+                EpkRange {
+                    min: "5A5A5A5A".to_string(),
+                    max: "5A5A5A5A".to_string(),
+                    is_min_inclusive: true,
+                    is_max_inclusive: true,
+                }
+            )])
+        );
+    }
+
+    #[test]
+    fn test_epk_ranges_clamped_to_pkrange() {
+        let pkranges = vec![
+            create_pkrange("pk1", "00000000", "40000000"),
+            create_pkrange("pk2", "40000000", "80000000"),
+        ];
+        let query_ranges = vec![create_query_range("30000000", "60000000", true, false)];
+
+        let epk_ranges = get_epk_ranges(&pkranges, &query_ranges);
+
+        assert_eq!(
+            epk_ranges,
+            HashMap::from([
+                (
+                    "pk1".to_string(),
+                    EpkRange {
+                        min: "30000000".to_string(),
+                        max: "40000000".to_string(),
+                        is_min_inclusive: true,
+                        is_max_inclusive: false,
+                    }
+                ),
+                (
+                    "pk2".to_string(),
+                    EpkRange {
+                        min: "40000000".to_string(),
+                        max: "60000000".to_string(),
+                        is_min_inclusive: true,
+                        is_max_inclusive: false,
+                    }
+                ),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_epk_ranges_multiple_query_ranges_in_one_pkrange() {
+        let pkranges = vec![create_pkrange("pk1", "00000000", "40000000")];
+        let query_ranges = vec![
+            create_query_range("10000000", "10000000", true, true),
+            create_query_range("20000000", "20000000", true, true),
+        ];
+
+        let epk_ranges = get_epk_ranges(&pkranges, &query_ranges);
+
+        assert_eq!(
+            epk_ranges,
+            HashMap::from([(
+                "pk1".to_string(),
+                EpkRange {
+                    min: "10000000".to_string(),
+                    max: "20000000".to_string(),
+                    is_min_inclusive: true,
+                    is_max_inclusive: true,
+                }
+            )])
+        );
+    }
+
+    #[test]
+    fn test_epk_ranges_fully_covered() {
+        let pkranges = vec![
+            create_pkrange("pk1", "", "80000000"),
+            create_pkrange("pk2", "80000000", "FF"),
+        ];
+        let query_ranges = vec![create_query_range("", "FF", true, false)];
+
+        let epk_ranges = get_epk_ranges(&pkranges, &query_ranges);
+
+        assert!(epk_ranges.is_empty());
+    }
+
+    #[test]
+    fn test_epk_ranges_exclusive_min_at_pkrange_min() {
+        let pkranges = vec![
+            create_pkrange("pk1", "00000000", "40000000"),
+            create_pkrange("pk2", "40000000", "80000000"),
+        ];
+        let query_ranges = vec![create_query_range("40000000", "80000000", false, false)];
+
+        let epk_ranges = get_epk_ranges(&pkranges, &query_ranges);
+
+        // The query range starts at pk2's min but excludes it, so pk2's request is scoped to exclude it too, rather than covering the whole range.
+        assert_eq!(
+            epk_ranges,
+            HashMap::from([(
+                "pk2".to_string(),
+                EpkRange {
+                    min: "40000000".to_string(),
+                    max: "80000000".to_string(),
+                    is_min_inclusive: false,
+                    is_max_inclusive: false,
+                }
+            )])
+        );
+    }
+
+    fn scoped_requests(
+        pkranges: Vec<PartitionKeyRange>,
+        partition_key: &[PartitionKeyValue],
+        version: u8,
+    ) -> crate::Result<Vec<DataRequest>> {
+        let plan = QueryPlan {
+            partitioned_query_execution_info_version: 1,
+            query_info: Some(QueryInfo::default()),
+            ..Default::default()
+        };
+        let mut pipeline = QueryPipeline::for_partition_key(
+            "SELECT * FROM c",
+            plan,
+            pkranges,
+            partition_key,
+            PartitionKeyKind::Hash,
+            version,
+        )?;
+        Ok(pipeline.run()?.requests)
+    }
+
+    fn point_request(pkrange_id: &'static str, epk: &str) -> DataRequest {
+        DataRequest {
+            epk_range: Some(EpkRange {
+                min: epk.to_string(),
+                max: epk.to_string(),
+                is_min_inclusive: true,
+                is_max_inclusive: true,
+            }),
+            ..DataRequest::new(0, pkrange_id, None)
+        }
+    }
+
+    #[test]
+    fn test_for_partition_key_hash_v2() -> crate::Result<()> {
+        // "redmond" hashes to 22E342F38A486A088463DFF7838A5963 using hash V2.
+        let requests = scoped_requests(
+            vec![
+                create_pkrange("pk1", "", "10"),
+                create_pkrange("pk2", "10", "20"),
+                create_pkrange("pk3", "20", "30"),
+                create_pkrange("pk4", "30", "FF"),
+            ],
+            &[PartitionKeyValue::String("redmond".to_string())],
+            2,
+        )?;
+
+        assert_eq!(
+            requests,
+            vec![point_request("pk3", "22E342F38A486A088463DFF7838A5963")]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn test_for_partition_key_hash_v1() -> crate::Result<()> {
+        // "partitionKey" hashes to 05C1E1B3D9CD2608716273756A756A706F4C667A00 using hash V1.
+        let requests = scoped_requests(
+            vec![
+                create_pkrange("pk1", "", "05C1D"),
+                create_pkrange("pk2", "05C1D", "05C1E2"),
+                create_pkrange("pk3", "05C1E2", "FF"),
+            ],
+            &[PartitionKeyValue::String("partitionKey".to_string())],
+            1,
+        )?;
+
+        assert_eq!(
+            requests,
+            vec![point_request(
+                "pk2",
+                "05C1E1B3D9CD2608716273756A756A706F4C667A00"
+            )]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn test_for_partition_key_on_range_boundary() -> crate::Result<()> {
+        // The partition key hashes to exactly the minimum of pk2, which means pk2 owns it, NOT pk1.
+        let requests = scoped_requests(
+            vec![
+                create_pkrange("pk1", "", "22E342F38A486A088463DFF7838A5963"),
+                create_pkrange("pk2", "22E342F38A486A088463DFF7838A5963", "FF"),
+            ],
+            &[PartitionKeyValue::String("redmond".to_string())],
+            2,
+        )?;
+
+        assert_eq!(
+            requests,
+            vec![point_request("pk2", "22E342F38A486A088463DFF7838A5963")]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn test_for_effective_partition_key_without_owning_range() {
+        // EPKs at or beyond the maximum EPK aren't owned by any range.
+        let err = QueryPipeline::for_effective_partition_key(
+            "SELECT * FROM c",
+            QueryPlan::default(),
+            vec![
+                create_pkrange("pk1", "", "10"),
+                create_pkrange("pk2", "10", "FF"),
+            ],
+            "FF00",
+        )
+        .unwrap_err();
+
+        assert_eq!(err.kind(), ErrorKind::UnknownPartitionKeyRange);
+    }
+
+    #[test]
+    fn test_for_partition_key_unsupported_kind() {
+        let err = QueryPipeline::for_partition_key(
+            "SELECT * FROM c",
+            QueryPlan::default(),
+            vec![create_pkrange("pk1", "", "FF")],
+            &[PartitionKeyValue::String("redmond".to_string())],
+            PartitionKeyKind::MultiHash,
+            2,
+        )
+        .unwrap_err();
+
+        assert_eq!(err.kind(), ErrorKind::InvalidQuery);
+    }
+
+    #[test]
+    fn test_new_sorts_pkranges() -> crate::Result<()> {
+        // The ranges are out of order, and the query only overlaps pk1.
+        let plan = QueryPlan {
+            partitioned_query_execution_info_version: 1,
+            query_info: Some(QueryInfo::default()),
+            query_ranges: vec![create_query_range("10", "20", true, false)],
+            ..Default::default()
+        };
+        let mut pipeline = QueryPipeline::new(
+            "SELECT * FROM c",
+            plan,
+            vec![
+                create_pkrange("pk2", "80", "FF"),
+                create_pkrange("pk1", "", "80"),
+            ],
+        )?;
+
+        let requests = pipeline.run()?.requests;
+        assert_eq!(
+            requests,
+            vec![DataRequest {
+                epk_range: Some(EpkRange {
+                    min: "10".to_string(),
+                    max: "20".to_string(),
+                    is_min_inclusive: true,
+                    is_max_inclusive: false,
+                }),
+                ..DataRequest::new(0, "pk1", None)
+            }]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn test_new_rejects_duplicate_pkrange_ids() {
+        // Concatenating two copies of the same ranges duplicates every ID, as well as overlapping every range.
+        // The duplicate is reported first, because it's the more specific problem.
+        let pkranges = vec![
+            create_pkrange("pk1", "", "80"),
+            create_pkrange("pk2", "80", "FF"),
+            create_pkrange("pk1", "", "80"),
+            create_pkrange("pk2", "80", "FF"),
+        ];
+        let err =
+            QueryPipeline::new("SELECT * FROM c", QueryPlan::default(), pkranges).unwrap_err();
+
+        assert_eq!(err.kind(), ErrorKind::InvalidGatewayResponse);
+        assert_eq!(
+            err.to_string(),
+            "partition key range ID 'pk1' is not unique"
+        );
+    }
+
+    #[test]
+    fn test_explain_ordered_pipeline() -> crate::Result<()> {
+        let pipeline = two_partition_pipeline(QueryInfo {
+            order_by: vec![SortOrder::Ascending, SortOrder::Descending],
+            top: Some(10),
+            ..Default::default()
+        })?;
+
+        assert_eq!(
+            pipeline.explain(),
+            [
+                "Query: SELECT * FROM c",
+                "Producer: StreamingOrderBy",
+                "Sort keys: 2",
+                "Stages:",
+                "  - Top(10)",
+                "Partition key ranges:",
+                "  - pk1 ['', '80')",
+                "  - pk2 ['80', 'FF')",
+            ]
+            .join("\n")
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn test_explain_unordered_pipeline() -> crate::Result<()> {
+        let plan = QueryPlan {
+            partitioned_query_execution_info_version: 1,
+            query_info: Some(QueryInfo {
+                offset: Some(5),
+                limit: Some(20),
+                ..Default::default()
+            }),
+            query_ranges: vec![create_query_range("10", "20", true, false)],
+            ..Default::default()
+        };
+        let pipeline = QueryPipeline::new(
+            "SELECT * FROM c",
+            plan,
+            vec![
+                create_pkrange("pk1", "", "80"),
+                create_pkrange("pk2", "80", "FF"),
+            ],
+        )?;
+
+        assert_eq!(
+            pipeline.explain(),
+            [
+                "Query: SELECT * FROM c",
+                "Producer: Unordered",
+                "Sort keys: 0",
+                "Stages:",
+                "  - Limit(20)",
+                "  - Offset(5)",
+                "Partition key ranges:",
+                "  - pk1 ['', '80') scoped to ['10', '20')",
+            ]
+            .join("\n")
+        );
+        Ok(())
+    }
+
+    fn two_partition_pipeline(query_info: QueryInfo) -> crate::Result<QueryPipeline> {
+        let plan = QueryPlan {
+            partitioned_query_execution_info_version: 1,
+            query_info: Some(query_info),
+            ..Default::default()
+        };
+        QueryPipeline::new(
+            "SELECT * FROM c",
+            plan,
+            vec![
+                create_pkrange("pk1", "", "80"),
+                create_pkrange("pk2", "80", "FF"),
+            ],
+        )
+    }
+
+    fn item_values(response: &PipelineResponse) -> Vec<&str> {
+        response.items.iter().map(|i| i.get()).collect()
+    }
+
+    #[test]
+    fn test_drain_unordered_emits_buffered_items_without_requests() -> crate::Result<()> {
+        let mut pipeline = two_partition_pipeline(QueryInfo::default())?;
+
+        let response = pipeline.run()?;
+        assert_eq!(vec![DataRequest::new(0, "pk1", None)], response.requests);
+        pipeline.provide_data("pk1", 0, br#"{"Documents":[1,2,3]}"#, Some("c1".into()))?;
+
+        pipeline.drain();
+        assert!(pipeline.draining());
+
+        let response = pipeline.run()?;
+        assert_eq!(vec!["1", "2", "3"], item_values(&response));
+        assert!(response.requests.is_empty());
+        assert!(response.terminated);
+        assert!(pipeline.complete());
+
+        let response = pipeline.run()?;
+        assert!(response.items.is_empty());
+        assert!(response.requests.is_empty());
+        assert!(response.terminated);
+        Ok(())
+    }
+
+    #[test]
+    fn test_drain_before_any_data_completes_immediately() -> crate::Result<()> {
+        let mut pipeline = two_partition_pipeline(QueryInfo::default())?;
+
+        pipeline.drain();
+
+        let response = pipeline.run()?;
+        assert!(response.items.is_empty());
+        assert!(response.requests.is_empty());
+        assert!(response.terminated);
+        Ok(())
+    }
+
+    #[test]
+    fn test_drain_accepts_in_flight_data() -> crate::Result<()> {
+        let mut pipeline = two_partition_pipeline(QueryInfo::default())?;
+
+        pipeline.run()?;
+        pipeline.drain();
+
+        // A response for a request made before draining can still be provided, but its continuation isn't followed.
+        pipeline.provide_data("pk1", 0, br#"{"Documents":[1,2]}"#, Some("c1".into()))?;
+
+        let response = pipeline.run()?;
+        assert_eq!(vec!["1", "2"], item_values(&response));
+        assert!(response.requests.is_empty());
+        assert!(response.terminated);
+        Ok(())
+    }
+
+    #[test]
+    fn test_drain_streaming_order_by_emits_buffered_items_in_order() -> crate::Result<()> {
+        let mut pipeline = two_partition_pipeline(QueryInfo {
+            order_by: vec![SortOrder::Ascending],
+            ..Default::default()
+        })?;
+
+        // Only pk1 has data, so nothing can be emitted until pk2 responds.
+        pipeline.provide_data(
+            "pk1",
+            0,
+            br#"{"Documents":[{"orderByItems":[{"item":1}],"payload":"a"},{"orderByItems":[{"item":3}],"payload":"b"}]}"#,
+            Some("c1".into()),
+        )?;
+        let response = pipeline.run()?;
+        assert!(response.items.is_empty());
+        assert_eq!(
+            vec![
+                DataRequest::new(1, "pk1", Some("c1".into())),
+                DataRequest::new(0, "pk2", None)
+            ],
+            response.requests
+        );
+
+        pipeline.provide_data(
+            "pk2",
+            0,
+            br#"{"Documents":[{"orderByItems":[{"item":2}],"payload":"c"}]}"#,
+            Some("c2".into()),
+        )?;
+        pipeline.drain();
+
+        let response = pipeline.run()?;
+        assert_eq!(vec![r#""a""#, r#""c""#, r#""b""#], item_values(&response));
+        assert!(response.requests.is_empty());
+        assert!(response.terminated);
+        Ok(())
+    }
+
+    #[test]
+    fn test_drain_aggregate_uses_buffered_data() -> crate::Result<()> {
+        let mut pipeline = two_partition_pipeline(QueryInfo {
+            aggregates: vec!["Count".into()],
+            has_select_value: true,
+            ..Default::default()
+        })?;
+
+        pipeline.run()?;
+        pipeline.provide_data(
+            "pk1",
+            0,
+            br#"{"Documents":[[{"item":2}],[{"item":3}]]}"#,
+            Some("c1".into()),
+        )?;
+        pipeline.drain();
+
+        let response = pipeline.run()?;
+        assert_eq!(vec!["5"], item_values(&response));
+        assert!(response.requests.is_empty());
+        assert!(response.terminated);
+        Ok(())
+    }
+
+    #[test]
+    fn test_warnings_are_reported_by_next_turn() -> crate::Result<()> {
+        let mut pipeline = two_partition_pipeline(QueryInfo {
+            order_by: vec![SortOrder::Ascending],
+            ..Default::default()
+        })?;
+
+        pipeline.provide_data(
+            "pk1",
+            0,
+            br#"{"Documents":[{"orderByItems":[{"item":{"a":1}}],"payload":"a"},"oops"]}"#,
+            None,
+        )?;
+        let response = pipeline.run()?;
+        assert!(response.items.is_empty());
+        assert_eq!(
+            vec![
+                (WarningCode::UndefinedOrderByItem, "pk1"),
+                (WarningCode::SkippedItem, "pk1"),
+            ],
+            response
+                .warnings
+                .iter()
+                .map(|w| (w.code, w.pkrange_id.as_str()))
+                .collect::<Vec<_>>()
+        );
+
+        // Warnings are only reported once, and the query completes despite them, with the undefined ORDER BY item sorting first.
+        pipeline.provide_data(
+            "pk2",
+            0,
+            br#"{"Documents":[{"orderByItems":[{"item":2}],"payload":"b"}]}"#,
+            None,
+        )?;
+        let response = pipeline.run()?;
+        assert_eq!(vec![r#""a""#, r#""b""#], item_values(&response));
+        assert!(response.terminated);
+        assert!(response.warnings.is_empty());
+        Ok(())
+    }
+
+    /// Runs a query over four partitions of 1000 items each, served in pages of 100, until at least `consume` items have been produced.
+    ///
+    /// Returns the number of items produced and the number of items fetched from the partitions.
+    fn run_with_target_batch_size(
+        query_info: QueryInfo,
+        max_concurrent_partitions: usize,
+        target: usize,
+        consume: usize,
+    ) -> crate::Result<(usize, usize)> {
+        const PARTITIONS: usize = 4;
+        const PAGE_SIZE: usize = 100;
+        const PAGES: usize = 10;
+
+        let ordered = !query_info.order_by.is_empty();
+        let plan = QueryPlan {
+            partitioned_query_execution_info_version: 1,
+            query_info: Some(query_info),
+            ..Default::default()
+        };
+        let mut pipeline = QueryPipeline::new(
+            "SELECT * FROM c",
+            plan,
+            vec![
+                create_pkrange("pk0", "", "40"),
+                create_pkrange("pk1", "40", "80"),
+                create_pkrange("pk2", "80", "C0"),
+                create_pkrange("pk3", "C0", "FF"),
+            ],
+        )?;
+        pipeline.set_max_concurrent_partitions(max_concurrent_partitions);
+        pipeline.set_target_batch_size(target);
+
+        let (mut consumed, mut fetched) = (0, 0);
+        while consumed < consume {
+            let response = pipeline.run()?;
+            if target > 0 {
+                assert!(response.items.len() <= target);
+            }
+            consumed += response.items.len();
+
+            for request in response.requests {
+                let partition: usize = request.pkrange_id[2..].parse().unwrap();
+                let page: usize = request
+                    .continuation
+                    .as_deref()
+                    .map_or(0, |c| c.parse().unwrap());
+                let documents: Vec<String> = (page * PAGE_SIZE..(page + 1) * PAGE_SIZE)
+                    .map(|i| {
+                        let value = i * PARTITIONS + partition;
+                        if ordered {
+                            format!(r#"{{"orderByItems":[{{"item":{value}}}],"payload":{value}}}"#)
+                        } else {
+                            value.to_string()
+                        }
+                    })
+                    .collect();
+                fetched += documents.len();
+                let continuation = (page + 1 < PAGES).then(|| (page + 1).to_string());
+                pipeline.provide_data(
+                    &request.pkrange_id,
+                    request.id,
+                    format!(r#"{{"Documents":[{}]}}"#, documents.join(",")).as_bytes(),
+                    continuation,
+                )?;
+            }
+        }
+        Ok((consumed, fetched))
+    }
+
+    #[test]
+    fn test_target_batch_size_limits_unordered_fetching() -> crate::Result<()> {
+        let (consumed, fetched) = run_with_target_batch_size(QueryInfo::default(), 0, 25, 200)?;
+        assert_eq!(200, consumed);
+        assert!(
+            fetched <= 2 * consumed,
+            "fetched {fetched} items to consume {consumed}"
+        );
+
+        // Without a target, every partition keeps being prefetched.
+        let (consumed, fetched) = run_with_target_batch_size(QueryInfo::default(), 0, 0, 200)?;
+        assert!(
+            fetched > 4 * consumed,
+            "fetched {fetched} items to consume {consumed}"
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn test_target_batch_size_limits_streaming_order_by_fetching() -> crate::Result<()> {
+        let query_info = QueryInfo {
+            order_by: vec![SortOrder::Ascending],
+            ..Default::default()
+        };
+        let (consumed, fetched) = run_with_target_batch_size(query_info, 0, 25, 200)?;
+        assert_eq!(200, consumed);
+        assert!(
+            fetched <= 2 * consumed,
+            "fetched {fetched} items to consume {consumed}"
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn test_target_batch_size_preserves_order() -> crate::Result<()> {
+        let mut pipeline = two_partition_pipeline(QueryInfo {
+            order_by: vec![SortOrder::Ascending],
+            ..Default::default()
+        })?;
+        pipeline.set_target_batch_size(2);
+
+        pipeline.provide_data(
+            "pk1",
+            0,
+            br#"{"Documents":[{"orderByItems":[{"item":1}],"payload":1},{"orderByItems":[{"item":3}],"payload":3},{"orderByItems":[{"item":5}],"payload":5}]}"#,
+            None,
+        )?;
+        pipeline.provide_data(
+            "pk2",
+            0,
+            br#"{"Documents":[{"orderByItems":[{"item":2}],"payload":2},{"orderByItems":[{"item":4}],"payload":4}]}"#,
+            None,
+        )?;
+
+        let mut batches = Vec::new();
+        loop {
+            let response = pipeline.run()?;
+            assert!(response.requests.is_empty());
+            batches.push(item_values(&response).join(","));
+            if response.terminated {
+                break;
+            }
+        }
+        assert_eq!(vec!["1,2", "3,4", "5"], batches);
+        Ok(())
+    }
+
+    #[test]
+    fn check_supported_plan() {
+        let plan = QueryPlan {
+            partitioned_query_execution_info_version: 1,
+            query_info: Some(QueryInfo {
+                order_by: vec![SortOrder::Ascending, SortOrder::Descending],
+                top: Some(10),
+                ..Default::default()
+            }),
+            ..Default::default()
+        };
+
+        let support = SUPPORTED_FEATURES.check(&plan);
+
+        assert!(support.is_supported());
+        assert_eq!(
+            vec![
+                QueryFeature::OrderBy,
+                QueryFeature::MultipleOrderBy,
+                QueryFeature::Top
+            ],
+            support.required
+        );
+        assert_eq!(support.required, support.supported);
+        assert!(support.missing.is_empty());
+    }
+
+    #[test]
+    fn check_partially_supported_plan() {
+        let plan = QueryPlan {
+            partitioned_query_execution_info_version: 1,
+            query_info: Some(QueryInfo {
+                distinct_type: DistinctType::Unordered,
+                group_by_expressions: vec!["c.category".to_string()],
+                offset: Some(5),
+                limit: Some(5),
+                ..Default::default()
+            }),
+            ..Default::default()
+        };
+
+        let support = SUPPORTED_FEATURES.check(&plan);
+
+        assert!(!support.is_supported());
+        assert_eq!(vec![QueryFeature::OffsetAndLimit], support.supported);
+        assert_eq!(
+            vec![QueryFeature::GroupBy, QueryFeature::Distinct],
+            support.missing
+        );
+        assert_eq!(
+            vec!["groupBy", "distinct"],
+            support
+                .missing
+                .iter()
+                .map(QueryFeature::name)
+                .collect::<Vec<_>>()
+        );
+
+        // The pipeline should agree with the check.
+        let err = QueryPipeline::new(
+            "SELECT * FROM c",
+            plan,
+            vec![create_pkrange("pk1", "", "FF")],
+        )
+        .unwrap_err();
+        assert_eq!(ErrorKind::UnsupportedQueryPlan, err.kind());
+    }
+
+    #[test]
+    fn check_dcount_does_not_require_distinct() {
+        let plan = QueryPlan {
+            partitioned_query_execution_info_version: 1,
+            query_info: Some(QueryInfo {
+                distinct_type: DistinctType::Unordered,
+                d_count_info: Some(DCountInfo::default()),
+                ..Default::default()
+            }),
+            ..Default::default()
+        };
+
+        let support = SUPPORTED_FEATURES.check(&plan);
+
+        assert!(support.is_supported());
+        assert_eq!(vec![QueryFeature::DCount], support.required);
+    }
 }
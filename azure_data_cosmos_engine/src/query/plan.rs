@@ -5,6 +5,8 @@ use std::collections::HashMap;
 
 use serde::Deserialize;
 
+use super::QueryFeature;
+
 /// Models the response returned by the Gateway when making a query plan request.
 #[derive(Debug, Default, Deserialize)]
 #[cfg_attr(
@@ -36,6 +38,73 @@ pub struct QueryPlan {
     pub hybrid_search_query_info: Option<HybridSearchQueryInfo>,
 }
 
+impl QueryPlan {
+    /// Gets the [`QueryFeature`]s that the engine must support in order to execute this plan.
+    ///
+    /// Features are listed once each, in a stable order.
+    pub fn required_features(&self) -> Vec<QueryFeature> {
+        let mut features = Vec::new();
+        if self.hybrid_search_query_info.is_some() {
+            features.push(QueryFeature::HybridSearch);
+        }
+
+        if let Some(query_info) = &self.query_info {
+            if !query_info.order_by.is_empty() {
+                features.push(QueryFeature::OrderBy);
+            }
+            if query_info.order_by.len() > 1 {
+                features.push(QueryFeature::MultipleOrderBy);
+            }
+            if query_info.has_non_streaming_order_by {
+                features.push(QueryFeature::NonStreamingOrderBy);
+            }
+            if query_info.top.is_some() {
+                features.push(QueryFeature::Top);
+            }
+            if query_info.offset.is_some() || query_info.limit.is_some() {
+                features.push(QueryFeature::OffsetAndLimit);
+            }
+            if !query_info.aggregates.is_empty() {
+                features.push(QueryFeature::Aggregate);
+            }
+            if query_info.aggregates.len() > 1 {
+                features.push(QueryFeature::MultipleAggregates);
+            }
+            if !query_info.aggregates.is_empty() && !query_info.has_select_value {
+                features.push(QueryFeature::NonValueAggregate);
+            }
+            if query_info
+                .aggregates
+                .iter()
+                .any(|a| a.eq_ignore_ascii_case("makelist") || a.eq_ignore_ascii_case("makeset"))
+            {
+                features.push(QueryFeature::ListAndSetAggregate);
+            }
+            if query_info
+                .aggregates
+                .iter()
+                .any(|a| a.eq_ignore_ascii_case("countif"))
+            {
+                features.push(QueryFeature::CountIf);
+            }
+            if !query_info.group_by_expressions.is_empty()
+                || !query_info.group_by_alias_to_aggregate_type.is_empty()
+                || !query_info.group_by_aliases.is_empty()
+            {
+                features.push(QueryFeature::GroupBy);
+            }
+
+            // A DCOUNT is executed as a DISTINCT query, but the DISTINCT is handled as part of the DCOUNT.
+            if query_info.d_count_info.is_some() {
+                features.push(QueryFeature::DCount);
+            } else if query_info.distinct_type != DistinctType::None {
+                features.push(QueryFeature::Distinct);
+            }
+        }
+        features
+    }
+}
+
 #[derive(Debug, Deserialize)]
 #[cfg_attr(
     feature = "python_conversions",
@@ -98,6 +167,25 @@ impl<'a> pyo3::FromPyObject<'a> for DistinctType {
     }
 }
 
+/// Describes a distinct count (`DCOUNT`) in the query.
+///
+/// The gateway produces this for queries like `SELECT VALUE COUNT(1) FROM (SELECT DISTINCT VALUE c.userId FROM c)`.
+#[derive(Debug, Deserialize, Default, Clone, PartialEq, Eq)]
+#[cfg_attr(
+    feature = "python_conversions",
+    derive(pyo3::FromPyObject),
+    pyo3(from_item_all)
+)]
+#[serde(default)]
+#[serde(rename_all = "camelCase")]
+pub struct DCountInfo {
+    /// The alias of the count in the final result.
+    ///
+    /// If this is empty, the count is a `SELECT VALUE` and should be returned as a bare number.
+    #[cfg_attr(feature = "python_conversions", pyo3(item("dCountAlias"), default))]
+    pub d_count_alias: String,
+}
+
 /// Models the query plan for a query.
 #[derive(Debug, Deserialize, Default)]
 #[cfg_attr(
@@ -112,6 +200,10 @@ pub struct QueryInfo {
     #[cfg_attr(feature = "python_conversions", pyo3(item("distinctType")))]
     pub distinct_type: DistinctType,
 
+    /// If this value is `Some`, the query is a distinct count (`DCOUNT`), which counts the distinct results returned by the rewritten query.
+    #[cfg_attr(feature = "python_conversions", pyo3(item("dCountInfo"), default))]
+    pub d_count_info: Option<DCountInfo>,
+
     /// If this value is `Some`, the value provided represents a limit to the number of results that should be returned.
     ///
     /// This represents the `TOP` clause.
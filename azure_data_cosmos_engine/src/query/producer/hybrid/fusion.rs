@@ -42,13 +42,7 @@ impl QueryResultCollector {
     }
 
     pub fn provide_data(&mut self, data: &[u8]) -> crate::Result<()> {
-        let result: FeedResponse<ComponentQueryResult> =
-            serde_json::from_slice(data).map_err(|e| {
-                ErrorKind::DeserializationError.with_message(format!(
-                    "failed to deserialize component query result: {}",
-                    e
-                ))
-            })?;
+        let result: FeedResponse<ComponentQueryResult> = FeedResponse::from_slice(data)?;
 
         match self {
             QueryResultCollector::Singleton(v) => v.extend(result.documents),
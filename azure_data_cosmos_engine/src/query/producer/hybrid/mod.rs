@@ -3,16 +3,14 @@
 
 use std::collections::VecDeque;
 
-use serde::Deserialize;
-
 mod component_state;
 mod fusion;
 mod models;
 
 use crate::{
     query::{
-        node::PipelineNodeResult, plan::HybridSearchQueryInfo, DataRequest, PartitionKeyRange,
-        QueryResult,
+        node::PipelineNodeResult, plan::HybridSearchQueryInfo, query_result::FeedResponse,
+        DataRequest, PartitionKeyRange, QueryResult,
     },
     ErrorKind,
 };
@@ -186,6 +184,14 @@ impl HybridSearchStrategy {
         }
     }
 
+    pub fn stop_fetching(&mut self) {
+        // Results can only be produced once every component query has completed, so if we're not there yet, there's nothing to produce.
+        if !matches!(self.phase, HybridSearchPhase::ResultProduction(_)) {
+            tracing::debug!(phase = ?self.phase, "stopping hybrid search before results were produced");
+            self.phase = HybridSearchPhase::ResultProduction(VecDeque::new());
+        }
+    }
+
     pub fn provide_data(
         &mut self,
         pkrange_id: &str,
@@ -208,18 +214,7 @@ impl HybridSearchStrategy {
                         .with_message("expected global statistics query response"));
                 }
 
-                #[derive(Deserialize)]
-                struct GlobalStatisticsResult {
-                    #[serde(rename = "Documents")]
-                    documents: Vec<GlobalStatistics>,
-                }
-                let results =
-                    serde_json::from_slice::<GlobalStatisticsResult>(data).map_err(|e| {
-                        ErrorKind::DeserializationError.with_message(format!(
-                            "failed to deserialize global statistics result: {}",
-                            e
-                        ))
-                    })?;
+                let results: FeedResponse<GlobalStatistics> = FeedResponse::from_slice(data)?;
 
                 if results.documents.len() != 1 {
                     return Err(ErrorKind::InvalidGatewayResponse
@@ -3,7 +3,7 @@
 
 use crate::query::{
     node::PipelineNodeResult, plan::HybridSearchQueryInfo, query_result::QueryResultShape,
-    DataRequest, PartitionKeyRange, SortOrder,
+    DataRequest, PartitionKeyRange, PipelineWarning, SortOrder,
 };
 
 mod hybrid;
@@ -61,6 +61,7 @@ impl ItemProducer {
     ///
     /// This strategy processes partitions sequentially in partition key range order,
     /// exhausting one partition completely before moving to the next.
+    /// By default, data is only fetched for the current partition, see [`ItemProducer::set_max_concurrent_partitions`] to fetch data for more partitions at once.
     ///
     /// Use this for queries that don't require global ordering across partitions.
     pub fn unordered(
@@ -98,11 +99,19 @@ impl ItemProducer {
     /// - Each partition's results are only sorted locally (not in global order)
     /// - You can afford to buffer the entire result set in memory
     /// - Correctness is more important than streaming performance
+    ///
+    /// If `max_buffered_items` is provided, only that many of the best items are retained while buffering.
+    /// This bounds memory usage for queries that use `TOP` or `OFFSET`/`LIMIT`, such as vector searches.
     pub fn non_streaming(
         pkranges: impl IntoIterator<Item = PartitionKeyRange>,
         sorting: Vec<SortOrder>,
+        max_buffered_items: Option<usize>,
     ) -> Self {
-        Self::NonStreaming(NonStreamingStrategy::new(pkranges, sorting))
+        Self::NonStreaming(NonStreamingStrategy::new(
+            pkranges,
+            sorting,
+            max_buffered_items,
+        ))
     }
 
     /// Creates a producer for Hybrid search queries (which include Full-Text searches, and Rank Fusion operations)
@@ -128,18 +137,65 @@ impl ItemProducer {
     }
 
     /// Provides additional data for the given partition.
+    ///
+    /// Returns a [`PipelineWarning`] for each problem with the data that was worked around, rather than failing.
     pub fn provide_data(
         &mut self,
         pkrange_id: &str,
         request_id: u64,
         data: &[u8],
         continuation: Option<String>,
-    ) -> crate::Result<()> {
+    ) -> crate::Result<Vec<PipelineWarning>> {
         match self {
             ItemProducer::Unordered(s) => s.provide_data(pkrange_id, data, continuation),
             ItemProducer::Streaming(s) => s.provide_data(pkrange_id, data, continuation),
             ItemProducer::NonStreaming(s) => s.provide_data(pkrange_id, data, continuation),
-            ItemProducer::Hybrid(s) => s.provide_data(pkrange_id, request_id, data, continuation),
+            ItemProducer::Hybrid(s) => s
+                .provide_data(pkrange_id, request_id, data, continuation)
+                .map(|()| Vec::new()),
+        }
+    }
+
+    /// Sets the maximum number of partitions that data can be fetched for at once, or `0` for no limit.
+    ///
+    /// This only affects the unordered strategy, which otherwise fetches data for one partition at a time.
+    /// The other strategies always fetch data for every partition at once, because they have to merge results from all of them.
+    pub fn set_max_concurrent_partitions(&mut self, max: usize) {
+        if let ItemProducer::Unordered(s) = self {
+            s.max_concurrent_partitions = max;
+        }
+    }
+
+    /// Sets the maximum number of items that can be buffered until every partition has been drained, or `None` for no limit.
+    ///
+    /// Only the non-streaming strategy buffers the whole result set, so the other strategies ignore it.
+    pub fn set_max_buffered_items(&mut self, max: Option<usize>) {
+        if let ItemProducer::NonStreaming(s) = self {
+            s.buffer_limit = max;
+        }
+    }
+
+    /// Sets the number of items the consumer wants in each batch, or `None` if it has no preference.
+    ///
+    /// The unordered and streaming strategies use this to limit how much data they prefetch, so that the data buffered stays proportional to the consumer's demand.
+    /// The other strategies have to fetch all the data before producing any items, so they ignore it.
+    pub fn set_fetch_target(&mut self, target: Option<usize>) {
+        match self {
+            ItemProducer::Unordered(s) => s.fetch_target.set_target(target),
+            ItemProducer::Streaming(s) => s.fetch_target.set_target(target),
+            ItemProducer::NonStreaming(_) | ItemProducer::Hybrid(_) => {}
+        }
+    }
+
+    /// Stops fetching data from any partition.
+    ///
+    /// After this, the producer only produces items that have already been buffered, and [`ItemProducer::data_requests`] returns no requests.
+    pub fn stop_fetching(&mut self) {
+        match self {
+            ItemProducer::Unordered(s) => s.stop_fetching(),
+            ItemProducer::Streaming(s) => s.stop_fetching(),
+            ItemProducer::NonStreaming(s) => s.stop_fetching(),
+            ItemProducer::Hybrid(s) => s.stop_fetching(),
         }
     }
 
@@ -369,6 +425,103 @@ mod tests {
         Ok(())
     }
 
+    #[test]
+    pub fn unordered_strategy_requests_concurrent_partitions() -> crate::Result<()> {
+        let pkranges = vec![
+            PartitionKeyRange::new("partition0", "", "40"),
+            PartitionKeyRange::new("partition1", "40", "80"),
+            PartitionKeyRange::new("partition2", "80", "FF"),
+        ];
+        let request_ids = |producer: &mut ItemProducer| -> crate::Result<Vec<String>> {
+            Ok(producer
+                .data_requests()?
+                .into_iter()
+                .map(|r| r.pkrange_id.to_string())
+                .collect())
+        };
+
+        let mut producer = ItemProducer::unordered(pkranges.clone(), QueryResultShape::RawPayload);
+        assert_eq!(vec!["partition0"], request_ids(&mut producer)?);
+
+        producer.set_max_concurrent_partitions(0);
+        assert_eq!(
+            vec!["partition0", "partition1", "partition2"],
+            request_ids(&mut producer)?
+        );
+
+        let mut producer = ItemProducer::unordered(pkranges, QueryResultShape::RawPayload);
+        producer.set_max_concurrent_partitions(2);
+        assert_eq!(
+            vec!["partition0", "partition1"],
+            request_ids(&mut producer)?
+        );
+
+        // partition1 responds first, but its items have to wait for partition0. It's exhausted, so the window moves on to partition2.
+        producer.provide_data("partition1", 0, br#"{"Documents":[10,11]}"#, None)?;
+        assert!(producer.produce_item()?.value.is_none());
+        assert_eq!(
+            vec!["partition0", "partition2"],
+            request_ids(&mut producer)?
+        );
+
+        // Once partition0 is exhausted, partition1's buffered items are produced.
+        producer.provide_data("partition0", 0, br#"{"Documents":[1]}"#, None)?;
+        let mut items = Vec::new();
+        while let Some(item) = producer.produce_item()?.value {
+            items.push(item.into_payload().unwrap().get().to_string());
+        }
+        assert_eq!(vec!["1", "10", "11"], items);
+        assert_eq!(vec!["partition2"], request_ids(&mut producer)?);
+
+        producer.provide_data("partition2", 0, br#"{"Documents":[20]}"#, None)?;
+        let result = producer.produce_item()?;
+        assert_eq!("20", result.value.unwrap().into_payload().unwrap().get());
+        assert!(result.terminated);
+        Ok(())
+    }
+
+    #[test]
+    pub fn unordered_strategy_with_concurrent_partitions_preserves_order(
+    ) -> Result<(), Box<dyn std::error::Error>> {
+        let mut partitions = HashMap::new();
+        for pkrange_id in ["partition0", "partition1", "partition2"] {
+            let mut pages: VecDeque<TestPage> = VecDeque::new();
+            pages.push_back((
+                None,
+                vec![
+                    create_item(pkrange_id, "item0", Vec::new()),
+                    create_item(pkrange_id, "item1", Vec::new()),
+                ],
+            ));
+            pages.push_back((
+                Some(format!("{pkrange_id}c0")),
+                vec![create_item(pkrange_id, "item2", Vec::new())],
+            ));
+            partitions.insert(pkrange_id.to_string(), pages);
+        }
+
+        let mut producer = ItemProducer::unordered(
+            vec![
+                PartitionKeyRange::new("partition0", "", "40"),
+                PartitionKeyRange::new("partition1", "40", "80"),
+                PartitionKeyRange::new("partition2", "80", "FF"),
+            ],
+            QueryResultShape::RawPayload,
+        );
+        producer.set_max_concurrent_partitions(0);
+
+        let items = run_producer(&mut producer, partitions)?;
+
+        let mut expected = Vec::new();
+        for pkrange_id in ["partition0", "partition1", "partition2"] {
+            for id in ["item0", "item1", "item2"] {
+                expected.push(Item::new(id, pkrange_id, format!("{pkrange_id} / {id}")));
+            }
+        }
+        assert_eq!(expected, items);
+        Ok(())
+    }
+
     #[test]
     pub fn streaming_strategy_merges_ordered_streams_of_data(
     ) -> Result<(), Box<dyn std::error::Error>> {
@@ -544,6 +697,7 @@ mod tests {
                 PartitionKeyRange::new("partition1", "99", "FF"),
             ],
             vec![SortOrder::Ascending, SortOrder::Descending],
+            None,
         );
 
         // We should stop once any partition's queue is empty.
@@ -572,4 +726,208 @@ mod tests {
 
         Ok(())
     }
+
+    #[test]
+    pub fn nonstreaming_strategy_merges_vector_distances() -> Result<(), Box<dyn std::error::Error>>
+    {
+        // Vector searches produce a single floating-point distance as the ORDER BY item.
+        // Each partition returns its own top results, which are not in the global order.
+        let mut partition0: VecDeque<TestPage> = VecDeque::new();
+        let mut partition1: VecDeque<TestPage> = VecDeque::new();
+
+        partition0.push_back((
+            None,
+            vec![
+                create_item("partition0", "item0", vec![json!({"item": 0.8123})]),
+                create_item("partition0", "item1", vec![json!({"item": 0.2511})]),
+            ],
+        ));
+        partition0.push_back((
+            Some("p0c0".to_string()),
+            vec![create_item(
+                "partition0",
+                "item2",
+                vec![json!({"item": 0.5})],
+            )],
+        ));
+        partition1.push_back((
+            None,
+            vec![
+                create_item("partition1", "item0", vec![json!({"item": 0.5})]),
+                create_item("partition1", "item1", vec![json!({"item": 0.9999})]),
+                create_item("partition1", "item2", vec![json!({"item": 0.0551})]),
+            ],
+        ));
+
+        let partitions = HashMap::from([
+            ("partition0".to_string(), partition0),
+            ("partition1".to_string(), partition1),
+        ]);
+
+        // Similarity functions like cosine and dot product sort descending, so the closest match comes first.
+        // Ties are broken by the partition order, so partition0 wins the tie at 0.5.
+        let mut producer = ItemProducer::non_streaming(
+            vec![
+                PartitionKeyRange::new("partition0", "00", "99"),
+                PartitionKeyRange::new("partition1", "99", "FF"),
+            ],
+            vec![SortOrder::Descending],
+            None,
+        );
+        let items = run_producer(&mut producer, partitions.clone())?;
+        assert_eq!(
+            vec![
+                Item::new("item1", "partition1", "partition1 / item1"),
+                Item::new("item0", "partition0", "partition0 / item0"),
+                Item::new("item2", "partition0", "partition0 / item2"),
+                Item::new("item0", "partition1", "partition1 / item0"),
+                Item::new("item1", "partition0", "partition0 / item1"),
+                Item::new("item2", "partition1", "partition1 / item2"),
+            ],
+            items
+        );
+
+        // Euclidean distance sorts ascending, so the smallest distance comes first.
+        let mut producer = ItemProducer::non_streaming(
+            vec![
+                PartitionKeyRange::new("partition0", "00", "99"),
+                PartitionKeyRange::new("partition1", "99", "FF"),
+            ],
+            vec![SortOrder::Ascending],
+            None,
+        );
+        let items = run_producer(&mut producer, partitions)?;
+        assert_eq!(
+            vec![
+                Item::new("item2", "partition1", "partition1 / item2"),
+                Item::new("item1", "partition0", "partition0 / item1"),
+                Item::new("item2", "partition0", "partition0 / item2"),
+                Item::new("item0", "partition1", "partition1 / item0"),
+                Item::new("item0", "partition0", "partition0 / item0"),
+                Item::new("item1", "partition1", "partition1 / item1"),
+            ],
+            items
+        );
+
+        Ok(())
+    }
+
+    #[test]
+    pub fn nonstreaming_strategy_only_buffers_max_items() -> Result<(), Box<dyn std::error::Error>>
+    {
+        let mut producer = ItemProducer::non_streaming(
+            vec![
+                PartitionKeyRange::new("partition0", "00", "99"),
+                PartitionKeyRange::new("partition1", "99", "FF"),
+            ],
+            vec![SortOrder::Ascending],
+            Some(2),
+        );
+
+        let page = |pkrange_id: &str, values: &[u32]| {
+            serialize_query_results(
+                &values
+                    .iter()
+                    .map(|v| create_item(pkrange_id, format!("item{v}"), vec![json!({"item": v})]))
+                    .collect::<Vec<_>>(),
+            )
+        };
+
+        producer.provide_data("partition0", 0, &page("partition0", &[5, 3, 8])?, None)?;
+        producer.provide_data(
+            "partition1",
+            0,
+            &page("partition1", &[9, 1])?,
+            Some("p1c0".to_string()),
+        )?;
+
+        let ItemProducer::NonStreaming(strategy) = &producer else {
+            panic!("expected a non-streaming producer");
+        };
+        assert_eq!(2, strategy.buffer.len());
+
+        // Partition 1 still has a continuation, so nothing can be produced yet.
+        assert!(producer.produce_item()?.value.is_none());
+
+        producer.provide_data("partition1", 1, &page("partition1", &[2])?, None)?;
+
+        let first = producer.produce_item()?;
+        assert!(!first.terminated);
+        let second = producer.produce_item()?;
+        assert!(second.terminated);
+
+        let items = [first, second]
+            .into_iter()
+            .map(|r| serde_json::from_str(r.value.unwrap().into_payload().unwrap().get()))
+            .collect::<Result<Vec<Item>, _>>()?;
+        assert_eq!(
+            vec![
+                Item::new("item1", "partition1", "partition1 / item1"),
+                Item::new("item2", "partition1", "partition1 / item2"),
+            ],
+            items
+        );
+
+        Ok(())
+    }
+
+    #[test]
+    pub fn nonstreaming_strategy_fails_past_buffer_limit() -> Result<(), Box<dyn std::error::Error>>
+    {
+        let page = |pkrange_id: &str, values: &[u32]| {
+            serialize_query_results(
+                &values
+                    .iter()
+                    .map(|v| create_item(pkrange_id, format!("item{v}"), vec![json!({"item": v})]))
+                    .collect::<Vec<_>>(),
+            )
+        };
+        let pkranges = || {
+            vec![
+                PartitionKeyRange::new("partition0", "00", "99"),
+                PartitionKeyRange::new("partition1", "99", "FF"),
+            ]
+        };
+
+        let mut producer =
+            ItemProducer::non_streaming(pkranges(), vec![SortOrder::Ascending], None);
+        producer.set_max_buffered_items(Some(4));
+        producer.provide_data(
+            "partition0",
+            0,
+            &page("partition0", &[5, 3, 8])?,
+            Some("p0c0".to_string()),
+        )?;
+        let err = producer
+            .provide_data("partition1", 0, &page("partition1", &[9, 1])?, None)
+            .unwrap_err();
+        assert_eq!(ErrorKind::BufferLimitExceeded, err.kind());
+        assert!(err.to_string().contains("limit of 4 items"), "{err}");
+
+        // Items beyond TOP or OFFSET/LIMIT are discarded before the limit is checked.
+        let mut producer =
+            ItemProducer::non_streaming(pkranges(), vec![SortOrder::Ascending], Some(2));
+        producer.set_max_buffered_items(Some(2));
+        producer.provide_data("partition0", 0, &page("partition0", &[5, 3, 8])?, None)?;
+        producer.provide_data("partition1", 0, &page("partition1", &[9, 1])?, None)?;
+        assert!(producer.produce_item()?.value.is_some());
+
+        Ok(())
+    }
+
+    #[test]
+    pub fn nonstreaming_strategy_terminates_with_no_results() -> crate::Result<()> {
+        let mut producer = ItemProducer::non_streaming(
+            vec![PartitionKeyRange::new("partition0", "00", "FF")],
+            vec![SortOrder::Ascending],
+            None,
+        );
+
+        producer.provide_data("partition0", 0, &serialize_query_results(&[])?, None)?;
+
+        let result = producer.produce_item()?;
+        assert!(result.value.is_none());
+        assert!(result.terminated);
+        Ok(())
+    }
 }
@@ -1,12 +1,15 @@
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 
-use std::collections::BinaryHeap;
+use std::{
+    cmp::Reverse,
+    collections::{BinaryHeap, VecDeque},
+};
 
 use crate::{
     query::{
         node::PipelineNodeResult, query_result::QueryResultShape, DataRequest, PartitionKeyRange,
-        SortOrder,
+        PipelineWarning, SortOrder,
     },
     ErrorKind,
 };
@@ -20,7 +23,25 @@ use super::{
 pub struct NonStreamingStrategy {
     pub partitions: Vec<PartitionState>,
     pub sorting: Sorting,
-    pub items: BinaryHeap<SortableResult>,
+
+    /// Buffers the results while partitions are being drained.
+    ///
+    /// This is a min-heap (by way of [`Reverse`]), so that the WORST item is at the top.
+    /// That lets us cheaply evict items that can never be emitted when `max_buffered_items` is set.
+    pub buffer: BinaryHeap<Reverse<SortableResult>>,
+
+    /// The globally sorted results, populated once all partitions have been drained.
+    pub items: VecDeque<SortableResult>,
+
+    /// The maximum number of items that need to be kept in the buffer, if the query limits the number of results (using `TOP` or `OFFSET`/`LIMIT`).
+    pub max_buffered_items: Option<usize>,
+
+    /// The maximum number of items the buffer may hold after discarding those beyond `max_buffered_items`, set by the caller to bound memory usage.
+    /// Exceeding it fails the query with [`ErrorKind::BufferLimitExceeded`].
+    pub buffer_limit: Option<usize>,
+
+    /// The number of items inserted into the heap so far, used to break ties between items with equal sort keys.
+    pub sequence: u64,
 }
 
 impl std::fmt::Debug for NonStreamingStrategy {
@@ -28,7 +49,10 @@ impl std::fmt::Debug for NonStreamingStrategy {
         f.debug_struct("NonStreamingStrategy")
             .field("partitions", &self.partitions)
             .field("sorting", &self.sorting)
+            .field("buffer_len", &self.buffer.len())
             .field("items_len", &self.items.len())
+            .field("max_buffered_items", &self.max_buffered_items)
+            .field("buffer_limit", &self.buffer_limit)
             .finish()
     }
 }
@@ -37,12 +61,17 @@ impl NonStreamingStrategy {
     pub fn new(
         pkranges: impl IntoIterator<Item = PartitionKeyRange>,
         sorting: Vec<SortOrder>,
+        max_buffered_items: Option<usize>,
     ) -> Self {
         let partitions = create_partition_state(pkranges);
         Self {
             partitions,
             sorting: Sorting::new(sorting),
-            items: BinaryHeap::new(),
+            buffer: BinaryHeap::new(),
+            items: VecDeque::new(),
+            max_buffered_items,
+            buffer_limit: None,
+            sequence: 0,
         }
     }
 
@@ -53,33 +82,63 @@ impl NonStreamingStrategy {
             .collect()
     }
 
+    pub fn stop_fetching(&mut self) {
+        for partition in &mut self.partitions {
+            partition.stop();
+        }
+    }
+
     pub fn provide_data(
         &mut self,
         pkrange_id: &str,
         data: &[u8],
         continuation: Option<String>,
-    ) -> crate::Result<()> {
-        let parsed_data = QueryResultShape::OrderBy.results_from_slice(data)?;
+    ) -> crate::Result<Vec<PipelineWarning>> {
+        let partition_index = self
+            .partitions
+            .iter()
+            .position(|p| p.pkrange.id == pkrange_id)
+            .ok_or_else(|| {
+                ErrorKind::UnknownPartitionKeyRange
+                    .with_message(format!("unknown partition key range ID: {pkrange_id}"))
+            })?;
+
+        self.partitions[partition_index].check_continuation(continuation.as_deref())?;
+
+        let (parsed_data, warnings) =
+            QueryResultShape::OrderBy.results_from_page(pkrange_id, data)?;
 
         // Insert the items into the heap as we go, which will keep them sorted
         for item in parsed_data {
             // We need to sort the items by the order by items, so we create a SortableResult.
-            self.items
-                .push(SortableResult::new(self.sorting.clone(), item));
+            self.buffer.push(Reverse(SortableResult::new(
+                self.sorting.clone(),
+                partition_index,
+                self.sequence,
+                item,
+            )));
+            self.sequence += 1;
+
+            // If the query can only return a limited number of items, anything beyond that limit can be discarded now.
+            if let Some(max) = self.max_buffered_items {
+                if self.buffer.len() > max {
+                    self.buffer.pop();
+                }
+            }
+        }
+
+        if let Some(limit) = self.buffer_limit {
+            if self.buffer.len() > limit {
+                return Err(ErrorKind::BufferLimitExceeded.with_message(format!(
+                    "the query must buffer every item before returning any, and partition key range {pkrange_id} took the buffer past its limit of {limit} items; narrow the query, such as with TOP, or raise the limit"
+                )));
+            }
         }
 
         // Update the partition state with the continuation token
-        let partition = self
-            .partitions
-            .iter_mut()
-            .find(|p| p.pkrange.id == pkrange_id)
-            .ok_or_else(|| {
-                ErrorKind::UnknownPartitionKeyRange
-                    .with_message(format!("unknown partition key range ID: {pkrange_id}"))
-            })?;
-        partition.update_state(continuation);
+        self.partitions[partition_index].update_state(continuation);
 
-        Ok(())
+        Ok(warnings)
     }
 
     pub fn produce_item(&mut self) -> crate::Result<PipelineNodeResult> {
@@ -90,8 +149,18 @@ impl NonStreamingStrategy {
             return Ok(PipelineNodeResult::NO_RESULT);
         }
 
-        // We can just pop the next item from the heap, since it's already sorted.
-        let value = self.items.pop().map(|r| r.into());
+        if !self.buffer.is_empty() {
+            // All the data is in, so we can sort the buffer once and emit from the sorted list.
+            // Sorting the reversed heap in ascending order puts the best item first.
+            let buffer = std::mem::take(&mut self.buffer);
+            self.items = buffer
+                .into_sorted_vec()
+                .into_iter()
+                .map(|Reverse(r)| r)
+                .collect();
+        }
+
+        let value = self.items.pop_front().map(|r| r.into());
         Ok(PipelineNodeResult {
             value,
             terminated: self.items.is_empty(),
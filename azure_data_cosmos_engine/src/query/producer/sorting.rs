@@ -8,7 +8,16 @@ use crate::{
     ErrorKind,
 };
 
-pub struct SortableResult(Sorting, QueryResult);
+/// A [`QueryResult`] that can be placed in a [`BinaryHeap`](std::collections::BinaryHeap) and sorted by its `ORDER BY` items.
+///
+/// Results with equal `ORDER BY` items are ordered by the index of the partition they came from, and then by the order in which they arrived.
+/// This keeps the output stable when many items share the same sort key, which is common for vector distances.
+pub struct SortableResult {
+    sorting: Sorting,
+    partition_index: usize,
+    sequence: u64,
+    result: QueryResult,
+}
 
 impl PartialEq for SortableResult {
     fn eq(&self, other: &Self) -> bool {
@@ -26,25 +35,44 @@ impl PartialOrd for SortableResult {
 
 impl Ord for SortableResult {
     fn cmp(&self, other: &Self) -> Ordering {
-        let (left_order_by_items, _) = self.1.as_order_by().expect("should have order by items");
-        let (right_order_by_items, _) = other.1.as_order_by().expect("should have order by items");
+        let (left_order_by_items, _) = self
+            .result
+            .as_order_by()
+            .expect("should have order by items");
+        let (right_order_by_items, _) = other
+            .result
+            .as_order_by()
+            .expect("should have order by items");
 
         // Unless the gateway provides invalid data, this shouldn't fail.
-        self.0
-            .compare(Some(&left_order_by_items), Some(&right_order_by_items))
+        self.sorting
+            .compare(Some(left_order_by_items), Some(right_order_by_items))
             .expect("Sorting should not fail")
+            // The heap is a max-heap, so the item from the earlier partition (or that arrived first) must compare as greater.
+            .then_with(|| other.partition_index.cmp(&self.partition_index))
+            .then_with(|| other.sequence.cmp(&self.sequence))
     }
 }
 
 impl SortableResult {
-    pub fn new(sorting: Sorting, result: QueryResult) -> Self {
-        Self(sorting, result)
+    pub fn new(
+        sorting: Sorting,
+        partition_index: usize,
+        sequence: u64,
+        result: QueryResult,
+    ) -> Self {
+        Self {
+            sorting,
+            partition_index,
+            sequence,
+            result,
+        }
     }
 }
 
 impl From<SortableResult> for QueryResult {
     fn from(value: SortableResult) -> Self {
-        value.1
+        value.result
     }
 }
 
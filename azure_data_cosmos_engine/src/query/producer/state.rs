@@ -3,7 +3,12 @@
 
 use std::cmp::Ordering;
 
-use crate::query::{DataRequest, PartitionKeyRange};
+use serde::Deserialize;
+
+use crate::{
+    query::{DataRequest, PartitionKeyRange},
+    ErrorKind,
+};
 
 /// Represents the current stage of pagination for a partition.
 #[derive(Debug, Clone)]
@@ -97,10 +102,72 @@ impl PartitionState {
         }
     }
 
+    /// Checks that a continuation token received for this partition belongs to it.
+    ///
+    /// Most tokens are opaque, but composite tokens (`{"token": "...", "range": {"min": "...", "max": "..."}}`, or a list of them) name the EPK range they continue.
+    /// If that range isn't within this partition key range, the token was issued for another partition (or before a split or merge), and following it would return the wrong data.
+    pub fn check_continuation(&self, continuation: Option<&str>) -> crate::Result<()> {
+        #[derive(Deserialize)]
+        struct CompositeToken {
+            range: TokenRange,
+        }
+
+        #[derive(Deserialize)]
+        struct TokenRange {
+            min: String,
+            max: String,
+        }
+
+        #[derive(Deserialize)]
+        #[serde(untagged)]
+        enum CompositeTokens {
+            Single(CompositeToken),
+            List(Vec<CompositeToken>),
+        }
+
+        let Some(continuation) = continuation else {
+            return Ok(());
+        };
+        let tokens = match serde_json::from_str(continuation) {
+            Ok(CompositeTokens::Single(token)) => vec![token],
+            Ok(CompositeTokens::List(tokens)) => tokens,
+            Err(_) => return Ok(()), // An opaque token, which we can't check.
+        };
+
+        let pkrange = &self.pkrange;
+        for token in tokens {
+            let range = token.range;
+            if range.min < pkrange.min_inclusive || range.max > pkrange.max_exclusive {
+                let current = match &self.stage {
+                    PaginationState::Continuing { token, .. } => format!("'{token}'"),
+                    _ => "none".to_string(),
+                };
+                return Err(ErrorKind::InvalidContinuation.with_message(format!(
+                    "continuation token does not match partition key range '{}': expected a token within ['{}', '{}') (current token: {}), but received '{}', which covers ['{}', '{}')",
+                    pkrange.id,
+                    pkrange.min_inclusive,
+                    pkrange.max_exclusive,
+                    current,
+                    continuation,
+                    range.min,
+                    range.max
+                )));
+            }
+        }
+        Ok(())
+    }
+
     pub fn update_state(&mut self, continuation: Option<String>) {
         self.stage.update(continuation);
     }
 
+    /// Stops fetching data for this partition, as if it had been exhausted.
+    ///
+    /// Any data already buffered for the partition is unaffected.
+    pub fn stop(&mut self) {
+        self.stage = PaginationState::Done;
+    }
+
     pub fn started(&self) -> bool {
         !matches!(self.stage, PaginationState::Initial)
     }
@@ -109,3 +176,99 @@ impl PartitionState {
         matches!(self.stage, PaginationState::Done)
     }
 }
+
+/// Decides how much data to prefetch when the consumer has set a target batch size.
+///
+/// Requests that are required to produce the next item are always made.
+/// Additional requests, which only prefetch data, are only made while the items already buffered, plus the items expected from the requests being made, fall short of the target.
+/// The number of items expected from each request is estimated from the average size of the pages received so far.
+#[derive(Debug, Default)]
+pub struct FetchTarget {
+    target: Option<usize>,
+    pages_received: u64,
+    items_received: u64,
+}
+
+impl FetchTarget {
+    /// Sets the target number of items, or `None` to prefetch without limit.
+    pub fn set_target(&mut self, target: Option<usize>) {
+        self.target = target;
+    }
+
+    /// Records that a page containing the given number of items was received.
+    pub fn record_page(&mut self, item_count: usize) {
+        self.pages_received += 1;
+        self.items_received += item_count as u64;
+    }
+
+    /// Gets the number of prefetch requests that can be made, given the number of items buffered and the number of required requests being made.
+    pub fn prefetch_allowance(&self, buffered_items: usize, required_requests: usize) -> usize {
+        let Some(target) = self.target else {
+            return usize::MAX;
+        };
+        if self.pages_received == 0 {
+            // Without any pages to go by, we can't estimate how much a prefetch would return, so we only make the required requests.
+            return 0;
+        }
+
+        let page_size = (self.items_received / self.pages_received).max(1) as usize;
+        let expected = buffered_items.saturating_add(required_requests.saturating_mul(page_size));
+        target.saturating_sub(expected).div_ceil(page_size)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn partition(min: &str, max: &str) -> PartitionState {
+        PartitionState::new(1, PartitionKeyRange::new("partition1", min, max))
+    }
+
+    #[test]
+    fn check_continuation_accepts_opaque_tokens() {
+        let partition = partition("99", "FF");
+        partition.check_continuation(None).unwrap();
+        partition.check_continuation(Some("3")).unwrap();
+        partition
+            .check_continuation(Some("+RID:~Ut9xAOe2n2gBAAAAAAAAAA==#RT:1#TRC:1"))
+            .unwrap();
+        partition
+            .check_continuation(Some(r#"{"compositeToken":"abc"}"#))
+            .unwrap();
+    }
+
+    #[test]
+    fn check_continuation_accepts_tokens_within_range() {
+        let partition = partition("99", "FF");
+        partition
+            .check_continuation(Some(r#"{"token":"abc","range":{"min":"99","max":"FF"}}"#))
+            .unwrap();
+        partition
+            .check_continuation(Some(
+                r#"[{"token":"abc","range":{"min":"99","max":"AA"}},{"token":"def","range":{"min":"AA","max":"FF"}}]"#,
+            ))
+            .unwrap();
+    }
+
+    #[test]
+    fn check_continuation_rejects_tokens_for_other_ranges() {
+        let mut partition = partition("99", "FF");
+        partition.update_state(Some("current".to_string()));
+
+        let err = partition
+            .check_continuation(Some(r#"{"token":"abc","range":{"min":"","max":"99"}}"#))
+            .unwrap_err();
+        assert_eq!(ErrorKind::InvalidContinuation, err.kind());
+        assert_eq!(
+            r#"continuation token does not match partition key range 'partition1': expected a token within ['99', 'FF') (current token: 'current'), but received '{"token":"abc","range":{"min":"","max":"99"}}', which covers ['', '99')"#,
+            err.to_string()
+        );
+
+        // A token from before a split covers more than the partition.
+        let err = partition
+            .check_continuation(Some(r#"[{"token":"abc","range":{"min":"","max":"FF"}}]"#))
+            .unwrap_err();
+        assert_eq!(ErrorKind::InvalidContinuation, err.kind());
+    }
+}
@@ -6,17 +6,22 @@ use std::{cmp::Ordering, collections::VecDeque};
 use crate::{
     query::{
         node::PipelineNodeResult, query_result::QueryResultShape, DataRequest, PartitionKeyRange,
-        QueryResult, SortOrder,
+        PipelineWarning, QueryResult, SortOrder,
     },
     ErrorKind,
 };
 
-use super::{create_partition_state, sorting::Sorting, state::PartitionState};
+use super::{
+    create_partition_state,
+    sorting::Sorting,
+    state::{FetchTarget, PartitionState},
+};
 
 pub struct StreamingStrategy {
     pub partitions: Vec<PartitionState>,
     pub sorting: Sorting,
     pub buffers: Vec<(String, VecDeque<QueryResult>)>,
+    pub fetch_target: FetchTarget,
 }
 
 impl std::fmt::Debug for StreamingStrategy {
@@ -32,6 +37,7 @@ impl std::fmt::Debug for StreamingStrategy {
                     .map(|(_, b)| b.len())
                     .collect::<Vec<_>>(),
             )
+            .field("fetch_target", &self.fetch_target)
             .finish()
     }
 }
@@ -50,14 +56,41 @@ impl StreamingStrategy {
             partitions,
             sorting: Sorting::new(sorting),
             buffers,
+            fetch_target: FetchTarget::default(),
         }
     }
 
     pub fn requests(&mut self) -> Vec<DataRequest> {
-        self.partitions
+        // To merge the partitions, every partition that isn't done needs at least one buffered item, so those with empty buffers are required.
+        // Partitions that still have buffered items are only prefetched.
+        let required = self
+            .partitions
             .iter()
-            .filter_map(|partition| partition.request())
-            .collect()
+            .zip(&self.buffers)
+            .filter(|(p, (_, b))| !p.done() && b.is_empty())
+            .count();
+        let buffered = self.buffers.iter().map(|(_, b)| b.len()).sum();
+        let mut prefetches = self.fetch_target.prefetch_allowance(buffered, required);
+
+        let mut requests = Vec::new();
+        for (partition, (_, buffer)) in self.partitions.iter().zip(&self.buffers) {
+            if !buffer.is_empty() {
+                if prefetches == 0 {
+                    continue;
+                }
+                if partition.request().is_some() {
+                    prefetches -= 1;
+                }
+            }
+            requests.extend(partition.request());
+        }
+        requests
+    }
+
+    pub fn stop_fetching(&mut self) {
+        for partition in &mut self.partitions {
+            partition.stop();
+        }
     }
 
     pub fn provide_data(
@@ -65,7 +98,7 @@ impl StreamingStrategy {
         pkrange_id: &str,
         data: &[u8],
         continuation: Option<String>,
-    ) -> crate::Result<()> {
+    ) -> crate::Result<Vec<PipelineWarning>> {
         let partition_index = self
             .partitions
             .iter()
@@ -85,15 +118,19 @@ impl StreamingStrategy {
             "buffer ID should match partition key range ID",
         );
 
+        self.partitions[partition_index].check_continuation(continuation.as_deref())?;
+
         // Parse the raw bytes using the result shape
-        let parsed_data = QueryResultShape::OrderBy.results_from_slice(data)?;
+        let (parsed_data, warnings) =
+            QueryResultShape::OrderBy.results_from_page(pkrange_id, data)?;
 
         // We assume the data is coming from the server pre-sorted, so we can just extend the buffer with the data.
+        self.fetch_target.record_page(parsed_data.len());
         buffer.extend(parsed_data);
 
         self.partitions[partition_index].update_state(continuation);
 
-        Ok(())
+        Ok(warnings)
     }
 
     pub fn produce_item(&mut self) -> crate::Result<PipelineNodeResult> {
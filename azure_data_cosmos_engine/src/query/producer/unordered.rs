@@ -6,18 +6,32 @@ use std::collections::VecDeque;
 use crate::{
     query::{
         node::PipelineNodeResult, query_result::QueryResultShape, DataRequest, PartitionKeyRange,
-        QueryResult,
+        PipelineWarning, QueryResult,
     },
     ErrorKind,
 };
 
-use super::{create_partition_state, state::PartitionState};
+use super::{
+    create_partition_state,
+    state::{FetchTarget, PartitionState},
+};
 
 pub struct UnorderedStrategy {
     pub partitions: Vec<PartitionState>,
+
+    /// The buffered items for each partition, in the same order as `partitions`.
+    pub buffers: Vec<VecDeque<QueryResult>>,
+
+    /// The index of the partition items are currently being produced from.
+    ///
+    /// All partitions before this one have been exhausted.
     pub current_partition_index: usize,
-    pub current_pkrange_id: Option<String>,
-    pub items: VecDeque<QueryResult>,
+
+    /// The maximum number of partitions, starting from the current one, that data can be fetched for at once, or `0` if there is no limit.
+    pub max_concurrent_partitions: usize,
+
+    pub fetch_target: FetchTarget,
+
     pub result_shape: QueryResultShape,
 }
 
@@ -25,9 +39,13 @@ impl std::fmt::Debug for UnorderedStrategy {
     fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
         f.debug_struct("UnorderedStrategy")
             .field("partitions", &self.partitions)
+            .field(
+                "buffer_lens",
+                &self.buffers.iter().map(|b| b.len()).collect::<Vec<_>>(),
+            )
             .field("current_partition_index", &self.current_partition_index)
-            .field("current_pkrange_id", &self.current_pkrange_id)
-            .field("items_len", &self.items.len())
+            .field("max_concurrent_partitions", &self.max_concurrent_partitions)
+            .field("fetch_target", &self.fetch_target)
             .finish()
     }
 }
@@ -39,90 +57,122 @@ impl UnorderedStrategy {
     ) -> Self {
         let partitions = create_partition_state(pkranges);
         Self {
+            buffers: partitions.iter().map(|_| VecDeque::new()).collect(),
             current_partition_index: 0,
-            current_pkrange_id: partitions.first().map(|p| p.pkrange.id.clone()),
-            items: VecDeque::new(),
+            max_concurrent_partitions: 1,
+            fetch_target: FetchTarget::default(),
             partitions,
             result_shape,
         }
     }
 
+    /// Indicates if the partition at the given index has no more items to produce.
+    fn exhausted(&self, index: usize) -> bool {
+        self.partitions[index].done() && self.buffers[index].is_empty()
+    }
+
     pub fn requests(&mut self) -> Vec<DataRequest> {
-        // In the unordered strategy, we simply return the first partition key range's request.
-        // Once that partition is exhausted, we remove it from the list and return the next one.
+        // Items are produced from one partition at a time, in partition key range order.
+        // To avoid waiting on each partition in turn, we can keep fetching data for the partitions after the current one while it's being drained.
+        // Their items are buffered until they become the current partition.
+        let window = match self.max_concurrent_partitions {
+            0 => usize::MAX,
+            n => n,
+        };
+        let start = self.current_partition_index.min(self.partitions.len());
+
+        // Only the current partition is needed to produce the next item, and only if its buffer is empty. Everything else is a prefetch.
+        let required =
+            self.partitions.get(start).is_some_and(|p| !p.done()) && self.buffers[start].is_empty();
+        let buffered = self.buffers.iter().map(|b| b.len()).sum();
+        let mut prefetches = self
+            .fetch_target
+            .prefetch_allowance(buffered, usize::from(required));
+
         let mut requests = Vec::new();
-        while requests.is_empty() {
-            // If there are no more partitions, we are done, return empty list.
-            let Some(partition) = self.partitions.get(self.current_partition_index) else {
+        for (index, partition) in self.partitions.iter().enumerate().skip(start) {
+            if partition.done() {
+                continue;
+            }
+            if requests.len() == window {
                 break;
-            };
-            match partition.request() {
-                Some(request) => {
-                    tracing::trace!(pkrange_id = ?partition.pkrange.id, "requesting data for partition");
-                    requests.push(request);
-                }
-                None => {
-                    tracing::trace!(pkrange_id = ?partition.pkrange.id, "partition exhausted, removing from list");
-                    self.current_partition_index += 1;
-                    self.current_pkrange_id = self
-                        .partitions
-                        .get(self.current_partition_index)
-                        .map(|p| p.pkrange.id.clone());
+            }
+            if !(required && index == start) {
+                if prefetches == 0 {
+                    break;
                 }
+                prefetches -= 1;
+            }
+            if let Some(request) = partition.request() {
+                tracing::trace!(pkrange_id = ?partition.pkrange.id, "requesting data for partition");
+                requests.push(request);
             }
         }
         requests
     }
 
+    pub fn stop_fetching(&mut self) {
+        for partition in &mut self.partitions {
+            partition.stop();
+        }
+    }
+
     pub fn provide_data(
         &mut self,
         pkrange_id: &str,
         data: &[u8],
         continuation: Option<String>,
-    ) -> crate::Result<()> {
-        match &self.current_pkrange_id {
-            Some(id) => {
-                if *id != pkrange_id {
-                    // The caller provided data for a different partition key range ID before draining the current items queue.
-                    return Err(ErrorKind::InternalError.with_message(format!(
-                        "provided data for partition key range ID: {}, but current partition is: {}",
-                        pkrange_id, id
-                    )));
-                }
-            }
-            None => {
-                return Err(ErrorKind::InternalError.with_message(format!(
-                    "provided data for partition key range ID: {}, but all partitions are exhausted",
-                    pkrange_id
-                )));
-            }
+    ) -> crate::Result<Vec<PipelineWarning>> {
+        let index = self
+            .partitions
+            .iter()
+            .position(|p| p.pkrange.id == pkrange_id)
+            .ok_or_else(|| {
+                ErrorKind::UnknownPartitionKeyRange
+                    .with_message(format!("unknown partition key range ID: {pkrange_id}"))
+            })?;
+        if index < self.current_partition_index {
+            return Err(ErrorKind::InternalError.with_message(format!(
+                "provided data for partition key range ID: {}, but that partition is exhausted",
+                pkrange_id
+            )));
         }
 
+        self.partitions[index].check_continuation(continuation.as_deref())?;
+
         // Parse the raw bytes using the result shape
-        let parsed_data = self.result_shape.results_from_slice(data)?;
+        let (parsed_data, warnings) = self.result_shape.results_from_page(pkrange_id, data)?;
 
-        // Add the data to the items queue. There's no ordering to worry about, so we just append the items.
-        self.items.extend(parsed_data);
+        // Add the data to the partition's buffer. There's no ordering to worry about within the partition, so we just append the items.
+        self.fetch_target.record_page(parsed_data.len());
+        self.buffers[index].extend(parsed_data);
 
         // Update the partition state with the continuation token
-        let partition = self
-            .partitions
-            .iter_mut()
-            .find(|p| p.pkrange.id == pkrange_id)
-            .ok_or_else(|| {
-                ErrorKind::UnknownPartitionKeyRange
-                    .with_message(format!("unknown partition key range ID: {pkrange_id}"))
-            })?;
-        partition.update_state(continuation);
+        self.partitions[index].update_state(continuation);
 
-        Ok(())
+        Ok(warnings)
     }
 
     pub fn produce_item(&mut self) -> crate::Result<PipelineNodeResult> {
-        let value = self.items.pop_front();
-        let terminated = self.items.is_empty()
-            && (self.current_partition_index == self.partitions.len() - 1)
-            && self.partitions[self.current_partition_index].done();
-        Ok(PipelineNodeResult { value, terminated })
+        while self.current_partition_index < self.partitions.len() {
+            let index = self.current_partition_index;
+            if let Some(value) = self.buffers[index].pop_front() {
+                let terminated = (index..self.partitions.len()).all(|i| self.exhausted(i));
+                return Ok(PipelineNodeResult::result(value, terminated));
+            }
+
+            if !self.partitions[index].done() {
+                // The current partition has more data to fetch, so we have to wait for it before producing items from the next one.
+                return Ok(PipelineNodeResult::NO_RESULT);
+            }
+
+            tracing::trace!(pkrange_id = ?self.partitions[index].pkrange.id, "partition exhausted, moving to next partition");
+            self.current_partition_index += 1;
+        }
+
+        Ok(PipelineNodeResult {
+            value: None,
+            terminated: true,
+        })
     }
 }
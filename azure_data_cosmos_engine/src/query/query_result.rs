@@ -1,18 +1,67 @@
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 
-use serde::{ser::SerializeStruct, Deserialize, Deserializer, Serialize};
+use serde::{de::DeserializeOwned, ser::SerializeStruct, Deserialize, Deserializer, Serialize};
+use serde_json::error::Category;
 use std::fmt::Debug;
 
-use crate::ErrorKind;
+use crate::{
+    query::{PipelineWarning, WarningCode},
+    ErrorKind,
+};
 
 /// Holds an owned list of items retrieved from the backend
 #[derive(Serialize, Deserialize)]
 pub(crate) struct FeedResponse<T> {
-    #[serde(rename = "Documents")]
+    /// The items in the page.
+    ///
+    /// Some responses (for example, certain aggregate-only queries and emulator versions) set `Documents` to `null`, which is treated as an empty page.
+    /// A response without `Documents`, such as the body of a gateway error, is rejected rather than taken for an empty page.
+    #[serde(
+        rename = "Documents",
+        deserialize_with = "deserialize_null_as_empty",
+        bound(deserialize = "T: Deserialize<'de>")
+    )]
     pub documents: Vec<T>,
 }
 
+fn deserialize_null_as_empty<'de, D: Deserializer<'de>, T: Deserialize<'de>>(
+    deserializer: D,
+) -> Result<Vec<T>, D::Error> {
+    Ok(Option::<Vec<T>>::deserialize(deserializer)?.unwrap_or_default())
+}
+
+impl<T: DeserializeOwned> FeedResponse<T> {
+    /// Parses a page of results returned by the backend.
+    ///
+    /// A leading UTF-8 byte order mark and any leading whitespace are ignored.
+    /// If the page can't be parsed, the error describes what was wrong with it (empty, truncated, not JSON, or the wrong shape).
+    pub fn from_slice(buffer: &[u8]) -> crate::Result<Self> {
+        const UTF8_BOM: &[u8] = b"\xEF\xBB\xBF";
+        let buffer = buffer.strip_prefix(UTF8_BOM).unwrap_or(buffer);
+        let buffer = buffer.trim_ascii_start();
+        if buffer.is_empty() {
+            return Err(
+                ErrorKind::InvalidGatewayResponse.with_message("query response body was empty")
+            );
+        }
+
+        serde_json::from_slice(buffer).map_err(|e| {
+            let message = match e.classify() {
+                Category::Eof => format!("query response body was truncated: {}", e),
+                Category::Syntax | Category::Io => {
+                    format!("query response body is not valid JSON: {}", e)
+                }
+                Category::Data => format!(
+                    "query response body does not have the expected shape: {}",
+                    e
+                ),
+            };
+            ErrorKind::InvalidGatewayResponse.with_message(message)
+        })
+    }
+}
+
 /// Helper struct for ORDER BY query results
 #[derive(Deserialize, Serialize)]
 #[serde(rename_all = "camelCase")]
@@ -42,44 +91,107 @@ pub enum QueryResultShape {
 }
 
 impl QueryResultShape {
+    /// Parses a page of results, discarding any warnings.
+    ///
+    /// See [`QueryResultShape::results_from_page`] for more information.
     pub fn results_from_slice(self, buffer: &[u8]) -> crate::Result<Vec<QueryResult>> {
+        self.results_from_page("", buffer)
+            .map(|(results, _warnings)| results)
+    }
+
+    /// Parses a page of results from the partition key range with the provided ID.
+    ///
+    /// Some problems with individual items are worked around rather than failing the whole page, and are described by the returned [`PipelineWarning`]s:
+    /// * An `ORDER BY` item that is an object or array can't be ordered, so it's treated as undefined ([`WarningCode::UndefinedOrderByItem`]).
+    /// * An item in the results of an `ORDER BY` query that isn't an object can't hold the `ORDER BY` items, so it's skipped ([`WarningCode::SkippedItem`]).
+    pub fn results_from_page(
+        self,
+        pkrange_id: &str,
+        buffer: &[u8],
+    ) -> crate::Result<(Vec<QueryResult>, Vec<PipelineWarning>)> {
         match self {
             QueryResultShape::RawPayload => {
                 let results: FeedResponse<Box<serde_json::value::RawValue>> =
-                    serde_json::from_slice(buffer)
-                        .map_err(|e| ErrorKind::InvalidGatewayResponse.with_source(e))?;
-                Ok(results
-                    .documents
-                    .into_iter()
-                    .map(QueryResult::RawPayload)
-                    .collect())
-            }
-            QueryResultShape::OrderBy => {
-                let results: FeedResponse<OrderByResult> = serde_json::from_slice(buffer)
-                    .map_err(|e| ErrorKind::InvalidGatewayResponse.with_source(e))?;
-                Ok(results
-                    .documents
-                    .into_iter()
-                    .map(|item| QueryResult::OrderBy {
-                        order_by_items: item.order_by_items,
-                        payload: item.payload,
-                    })
-                    .collect())
+                    FeedResponse::from_slice(buffer)?;
+                Ok((
+                    results
+                        .documents
+                        .into_iter()
+                        .map(QueryResult::RawPayload)
+                        .collect(),
+                    Vec::new(),
+                ))
             }
+            QueryResultShape::OrderBy => order_by_results_from_page(pkrange_id, buffer),
             QueryResultShape::ValueAggregate => {
-                let results: FeedResponse<Vec<QueryClauseItem>> = serde_json::from_slice(buffer)
-                    .map_err(|e| ErrorKind::InvalidGatewayResponse.with_source(e))?;
-                Ok(results
-                    .documents
-                    .into_iter()
-                    .map(QueryResult::ValueAggregates)
-                    .collect())
+                let results: FeedResponse<Vec<QueryClauseItem>> = FeedResponse::from_slice(buffer)?;
+                Ok((
+                    results
+                        .documents
+                        .into_iter()
+                        .map(QueryResult::ValueAggregates)
+                        .collect(),
+                    Vec::new(),
+                ))
             }
             QueryResultShape::HybridComponent => todo!(),
         }
     }
 }
 
+fn order_by_results_from_page(
+    pkrange_id: &str,
+    buffer: &[u8],
+) -> crate::Result<(Vec<QueryResult>, Vec<PipelineWarning>)> {
+    let response: FeedResponse<Box<serde_json::value::RawValue>> =
+        FeedResponse::from_slice(buffer)?;
+
+    let mut results = Vec::with_capacity(response.documents.len());
+    let mut warnings = Vec::new();
+    let mut warn = |code: WarningCode, message: String| {
+        tracing::warn!(?code, pkrange_id, detail = %message, "worked around invalid query result");
+        warnings.push(PipelineWarning {
+            code,
+            message,
+            pkrange_id: pkrange_id.to_string(),
+        });
+    };
+
+    for (index, document) in response.documents.into_iter().enumerate() {
+        if !document.get().starts_with('{') {
+            warn(
+                WarningCode::SkippedItem,
+                format!("skipped item {index}, because it is not an object with 'orderByItems' and 'payload' properties"),
+            );
+            continue;
+        }
+
+        let mut item: OrderByResult = serde_json::from_str(document.get()).map_err(|e| {
+            ErrorKind::InvalidGatewayResponse.with_message(format!(
+                "query response body does not have the expected shape: item {index}: {e}"
+            ))
+        })?;
+        for (position, order_by_item) in item.order_by_items.iter_mut().enumerate() {
+            let type_name = match &order_by_item.item {
+                Some(serde_json::Value::Object(_)) => "an object",
+                Some(serde_json::Value::Array(_)) => "an array",
+                _ => continue,
+            };
+            warn(
+                WarningCode::UndefinedOrderByItem,
+                format!("ORDER BY item {position} of item {index} is {type_name}, which can't be ordered, so it was treated as undefined"),
+            );
+            order_by_item.item = None;
+        }
+
+        results.push(QueryResult::OrderBy {
+            order_by_items: item.order_by_items,
+            payload: item.payload,
+        });
+    }
+    Ok((results, warnings))
+}
+
 /// Represents the result of a rewritten query.
 ///
 /// When we generate a query plan, the gateway rewrites the query so that it can be properly executed against each partition.
@@ -281,6 +393,108 @@ mod tests {
         result.into_iter().next().unwrap()
     }
 
+    fn parse_error_message(json: &[u8]) -> String {
+        let err = QueryResultShape::RawPayload
+            .results_from_slice(json)
+            .unwrap_err();
+        assert_eq!(ErrorKind::InvalidGatewayResponse, err.kind());
+        err.to_string()
+    }
+
+    #[test]
+    pub fn feed_response_ignores_bom_and_leading_whitespace() {
+        let result = QueryResultShape::RawPayload
+            .results_from_slice(b"\xEF\xBB\xBF \r\n\t{\"Documents\":[1,2]}")
+            .unwrap();
+        assert_eq!(2, result.len());
+    }
+
+    #[test]
+    pub fn feed_response_treats_null_documents_as_empty() {
+        for json in [
+            r#"{"_count": 0, "Documents": []}"#,
+            r#"{"Documents": null}"#,
+        ] {
+            let response: FeedResponse<Box<serde_json::value::RawValue>> =
+                FeedResponse::from_slice(json.as_bytes()).unwrap();
+            assert!(response.documents.is_empty(), "{json}");
+        }
+    }
+
+    #[test]
+    pub fn feed_response_rejects_missing_documents() {
+        for json in [
+            r#"{"_rid": "Ut9xAOe2n2g="}"#,
+            r#"{"_count": 0}"#,
+            r#"{"code": "BadRequest", "message": "Request is malformed"}"#,
+        ] {
+            assert!(
+                parse_error_message(json.as_bytes())
+                    .starts_with("query response body does not have the expected shape"),
+                "{json}"
+            );
+        }
+    }
+
+    #[test]
+    pub fn feed_response_reports_malformed_payloads() {
+        assert_eq!("query response body was empty", parse_error_message(b""));
+        assert_eq!(
+            "query response body was empty",
+            parse_error_message(b"\xEF\xBB\xBF  ")
+        );
+        assert!(parse_error_message(br#"{"Documents":[1,"#)
+            .starts_with("query response body was truncated"));
+        assert!(parse_error_message(b"<html></html>")
+            .starts_with("query response body is not valid JSON"));
+        assert!(parse_error_message(br#"{"Documents":"nope"}"#)
+            .starts_with("query response body does not have the expected shape"));
+    }
+
+    #[test]
+    pub fn order_by_results_work_around_invalid_items() {
+        const JSON: &str = r#"{"Documents":[
+            {"orderByItems":[{"item":1}],"payload":{"id":"1"}},
+            42,
+            {"orderByItems":[{"item":{"nested":true}},{"item":[1,2]}],"payload":{"id":"2"}}
+        ]}"#;
+        let (results, warnings) = QueryResultShape::OrderBy
+            .results_from_page("pk1", JSON.as_bytes())
+            .unwrap();
+
+        assert_eq!(2, results.len());
+        let (order_by_items, payload) = results[1].as_order_by().unwrap();
+        assert_eq!(r#"{"id":"2"}"#, payload.get());
+        assert_eq!(
+            vec![QueryClauseItem::default(), QueryClauseItem::default()],
+            order_by_items
+        );
+
+        assert_eq!(
+            vec![
+                (WarningCode::SkippedItem, "skipped item 1, because it is not an object with 'orderByItems' and 'payload' properties"),
+                (WarningCode::UndefinedOrderByItem, "ORDER BY item 0 of item 2 is an object, which can't be ordered, so it was treated as undefined"),
+                (WarningCode::UndefinedOrderByItem, "ORDER BY item 1 of item 2 is an array, which can't be ordered, so it was treated as undefined"),
+            ],
+            warnings
+                .iter()
+                .map(|w| (w.code, w.message.as_str()))
+                .collect::<Vec<_>>()
+        );
+        assert!(warnings.iter().all(|w| w.pkrange_id == "pk1"));
+    }
+
+    #[test]
+    pub fn order_by_results_reject_objects_with_the_wrong_shape() {
+        let err = QueryResultShape::OrderBy
+            .results_from_slice(br#"{"Documents":[{"id":"1"}]}"#)
+            .unwrap_err();
+        assert_eq!(ErrorKind::InvalidGatewayResponse, err.kind());
+        assert!(err
+            .to_string()
+            .starts_with("query response body does not have the expected shape: item 0:"));
+    }
+
     #[test]
     pub fn query_result_deserializes_raw_payload_shape() {
         const JSON: &str = r#"{"Documents":[{"a":1}]}"#;
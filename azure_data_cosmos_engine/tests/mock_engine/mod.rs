@@ -58,14 +58,19 @@ impl Engine {
             .map(|(index, pkrange_id)| {
                 PartitionKeyRange::new(
                     pkrange_id.clone(),
-                    format!("{:08X}", MIN_EPK + (index as u32) * epks_per_partition),
+                    if index == 0 {
+                        // The first partition starts at the minimum EPK
+                        PartitionKeyRange::MIN_EPK.to_string()
+                    } else {
+                        format!("{:08X}", MIN_EPK + (index as u32) * epks_per_partition)
+                    },
                     if index == container.partitions.len() - 1 {
                         // Last partition gets the rest of the range
-                        format!("{:08X}", MAX_EPK)
+                        PartitionKeyRange::MAX_EPK.to_string()
                     } else {
                         format!(
                             "{:08X}",
-                            MIN_EPK + ((index as u32) + 1) * epks_per_partition - 1
+                            MIN_EPK + ((index as u32) + 1) * epks_per_partition
                         )
                     },
                 )
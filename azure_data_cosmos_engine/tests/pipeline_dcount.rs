@@ -0,0 +1,181 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+use azure_data_cosmos_engine::query::{
+    DCountInfo, DataRequest, DistinctType, QueryInfo, QueryPlan, QueryResult,
+};
+use pretty_assertions::assert_eq;
+
+use mock_engine::{Container, Engine};
+use serde_json::json;
+
+use crate::mock_engine::EngineResult;
+
+mod mock_engine;
+
+fn user_id(id: &str) -> QueryResult {
+    QueryResult::RawPayload(serde_json::value::to_raw_value(id).unwrap())
+}
+
+/// Creates a container where each partition returns its own distinct user IDs, but some user IDs appear in both partitions.
+fn create_container() -> Container {
+    let mut container = Container::new();
+    container.insert(
+        "partition0",
+        vec![user_id("alice"), user_id("bob"), user_id("carol")],
+    );
+    container.insert(
+        "partition1",
+        vec![user_id("bob"), user_id("dave"), user_id("alice")],
+    );
+    container
+}
+
+fn dcount_plan(alias: &str) -> QueryPlan {
+    QueryPlan {
+        partitioned_query_execution_info_version: 1,
+        query_info: Some(QueryInfo {
+            distinct_type: DistinctType::Unordered,
+            d_count_info: Some(DCountInfo {
+                d_count_alias: alias.to_string(),
+            }),
+            has_select_value: alias.is_empty(),
+            rewritten_query: "SELECT DISTINCT VALUE c.userId FROM c".to_string(),
+            ..Default::default()
+        }),
+        ..Default::default()
+    }
+}
+
+#[test]
+pub fn dcount_value() -> Result<(), Box<dyn std::error::Error>> {
+    let engine = Engine::new(
+        create_container(),
+        "SELECT VALUE COUNT(1) FROM (SELECT DISTINCT VALUE c.userId FROM c)",
+        dcount_plan(""),
+        2,
+    )?;
+
+    let results = engine.execute()?;
+    assert_eq!(
+        vec![
+            EngineResult {
+                items: vec![],
+                requests: vec![DataRequest::new(0, "partition0", None)],
+                terminated: false
+            },
+            EngineResult {
+                items: vec![],
+                requests: vec![DataRequest::new(1, "partition0", Some("2".into()))],
+                terminated: false
+            },
+            // Nothing is emitted until every partition has been drained, even though the partitions are queried one at a time.
+            EngineResult {
+                items: vec![],
+                requests: vec![DataRequest::new(0, "partition1", None)],
+                terminated: false
+            },
+            EngineResult {
+                items: vec![],
+                requests: vec![DataRequest::new(1, "partition1", Some("2".into()))],
+                terminated: false
+            },
+            EngineResult {
+                items: vec![json!(4)],
+                requests: vec![],
+                terminated: true
+            },
+        ],
+        results
+    );
+
+    Ok(())
+}
+
+#[test]
+pub fn dcount_with_alias() -> Result<(), Box<dyn std::error::Error>> {
+    let engine = Engine::new(
+        create_container(),
+        "SELECT COUNT(1) AS userCount FROM (SELECT DISTINCT VALUE c.userId FROM c)",
+        dcount_plan("userCount"),
+        10,
+    )?;
+
+    let results = engine.execute()?;
+    assert_eq!(
+        vec![json!({"userCount": 4})],
+        results
+            .into_iter()
+            .flat_map(|r| r.items)
+            .collect::<Vec<_>>()
+    );
+
+    Ok(())
+}
+
+#[test]
+pub fn dcount_no_items() -> Result<(), Box<dyn std::error::Error>> {
+    let mut container = Container::new();
+    container.insert("partition0", vec![]);
+    container.insert("partition1", vec![]);
+
+    let engine = Engine::new(
+        container,
+        "SELECT VALUE COUNT(1) FROM (SELECT DISTINCT VALUE c.userId FROM c)",
+        dcount_plan(""),
+        10,
+    )?;
+
+    let results = engine.execute()?;
+    assert_eq!(
+        vec![json!(0)],
+        results
+            .into_iter()
+            .flat_map(|r| r.items)
+            .collect::<Vec<_>>()
+    );
+
+    Ok(())
+}
+
+fn raw(json: &str) -> QueryResult {
+    QueryResult::RawPayload(serde_json::value::RawValue::from_string(json.to_string()).unwrap())
+}
+
+#[test]
+pub fn dcount_equal_numbers() -> Result<(), Box<dyn std::error::Error>> {
+    // Numbers are doubles in Cosmos DB, so 1 and 1.0 are the same value, even in different partitions or nested in objects.
+    let mut container = Container::new();
+    container.insert(
+        "partition0",
+        vec![raw("1"), raw("2.5"), raw(r#"{"n":0}"#), raw("[3]")],
+    );
+    container.insert(
+        "partition1",
+        vec![
+            raw("1.0"),
+            raw("2.50"),
+            raw(r#"{"n":-0.0}"#),
+            raw("[3.0]"),
+            raw("4"),
+        ],
+    );
+
+    let engine = Engine::new(
+        container,
+        "SELECT VALUE COUNT(1) FROM (SELECT DISTINCT VALUE c.userId FROM c)",
+        dcount_plan(""),
+        10,
+    )?;
+
+    let results = engine.execute()?;
+    assert_eq!(
+        vec![json!(5)],
+        results
+            .into_iter()
+            .flat_map(|r| r.items)
+            .collect::<Vec<_>>()
+    );
+
+    Ok(())
+}
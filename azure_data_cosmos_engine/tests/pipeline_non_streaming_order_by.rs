@@ -0,0 +1,165 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+use std::vec;
+
+use azure_data_cosmos_engine::query::{
+    DataRequest, QueryClauseItem, QueryInfo, QueryPlan, QueryResult, SortOrder,
+};
+use pretty_assertions::assert_eq;
+
+use mock_engine::{Container, Engine};
+use serde_json::json;
+
+use crate::mock_engine::EngineResult;
+
+mod mock_engine;
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct Item {
+    id: String,
+    partition_key: String,
+    title: String,
+    sort0: u32,
+}
+
+impl Item {
+    pub fn new(id: impl Into<String>, partition_key: impl Into<String>, sort0: u32) -> Self {
+        let id = id.into();
+        let partition_key = partition_key.into();
+        let title = format!("{}/{}", partition_key.clone(), id.clone());
+        Self {
+            id,
+            partition_key,
+            title,
+            sort0,
+        }
+    }
+}
+
+impl From<Item> for QueryResult {
+    fn from(item: Item) -> Self {
+        let raw = serde_json::value::to_raw_value(&item.title).unwrap();
+        let sort0 = QueryClauseItem::from_value(json!(item.sort0));
+        QueryResult::OrderBy {
+            order_by_items: vec![sort0],
+            payload: raw,
+        }
+    }
+}
+
+/// Creates a container where later pages contain items that sort BEFORE items in earlier pages.
+fn create_container() -> Container {
+    let mut container = Container::new();
+    container.insert(
+        "partition0",
+        vec![
+            Item::new("item0", "partition0", 5).into(),
+            Item::new("item1", "partition0", 9).into(),
+            Item::new("item2", "partition0", 1).into(),
+            Item::new("item3", "partition0", 7).into(),
+        ],
+    );
+    container.insert(
+        "partition1",
+        vec![
+            Item::new("item0", "partition1", 8).into(),
+            Item::new("item1", "partition1", 6).into(),
+            Item::new("item2", "partition1", 2).into(),
+            Item::new("item3", "partition1", 0).into(),
+        ],
+    );
+    container
+}
+
+fn non_streaming_plan(query_info: QueryInfo) -> QueryPlan {
+    QueryPlan {
+        partitioned_query_execution_info_version: 1,
+        query_info: Some(QueryInfo {
+            order_by: vec![SortOrder::Ascending],
+            has_non_streaming_order_by: true,
+            ..query_info
+        }),
+        ..Default::default()
+    }
+}
+
+#[test]
+pub fn non_streaming_order_by_waits_for_all_partitions() -> Result<(), Box<dyn std::error::Error>> {
+    let engine = Engine::new(
+        create_container(),
+        "SELECT * FROM c ORDER BY c.sort0",
+        non_streaming_plan(QueryInfo::default()),
+        2,
+    )?;
+
+    let results = engine.execute()?;
+    assert_eq!(
+        vec![
+            EngineResult {
+                items: vec![],
+                requests: vec![
+                    DataRequest::new(0, "partition0", None),
+                    DataRequest::new(0, "partition1", None),
+                ],
+                terminated: false
+            },
+            // Each partition still has a continuation, so nothing can be emitted yet.
+            EngineResult {
+                items: vec![],
+                requests: vec![
+                    DataRequest::new(1, "partition0", Some("2".into())),
+                    DataRequest::new(1, "partition1", Some("2".into())),
+                ],
+                terminated: false
+            },
+            EngineResult {
+                items: vec![
+                    json!("partition1/item3"),
+                    json!("partition0/item2"),
+                    json!("partition1/item2"),
+                    json!("partition0/item0"),
+                    json!("partition1/item1"),
+                    json!("partition0/item3"),
+                    json!("partition1/item0"),
+                    json!("partition0/item1"),
+                ],
+                requests: vec![],
+                terminated: true
+            },
+        ],
+        results
+    );
+
+    Ok(())
+}
+
+#[test]
+pub fn non_streaming_order_by_with_offset_limit() -> Result<(), Box<dyn std::error::Error>> {
+    // The buffer only needs to retain OFFSET + LIMIT items, but the results must be the same as if everything was buffered.
+    let engine = Engine::new(
+        create_container(),
+        "SELECT * FROM c ORDER BY c.sort0 OFFSET 1 LIMIT 3",
+        non_streaming_plan(QueryInfo {
+            offset: Some(1),
+            limit: Some(3),
+            ..Default::default()
+        }),
+        2,
+    )?;
+
+    let results = engine.execute()?;
+    assert_eq!(
+        vec![
+            json!("partition0/item2"),
+            json!("partition1/item2"),
+            json!("partition0/item0"),
+        ],
+        results
+            .into_iter()
+            .flat_map(|r| r.items)
+            .collect::<Vec<_>>()
+    );
+
+    Ok(())
+}
@@ -3,7 +3,9 @@
 
 use std::vec;
 
-use azure_data_cosmos_engine::query::{DataRequest, QueryInfo, QueryPlan, QueryRange, QueryResult};
+use azure_data_cosmos_engine::query::{
+    DataRequest, EpkRange, QueryInfo, QueryPlan, QueryRange, QueryResult,
+};
 use pretty_assertions::assert_eq;
 
 use mock_engine::{Container, Engine};
@@ -427,3 +429,61 @@ pub fn pkranges_no_query_ranges_queries_all_partitions() -> Result<(), Box<dyn s
 
     Ok(())
 }
+
+#[test]
+pub fn pinned_partition_key_emits_single_scoped_request() -> Result<(), Box<dyn std::error::Error>>
+{
+    let mut container = Container::new();
+    for i in 0..10 {
+        let pkrange_id = format!("partition{i}");
+        container.insert(
+            &pkrange_id,
+            vec![
+                Item::new("item0", &pkrange_id).into(),
+                Item::new("item1", &pkrange_id).into(),
+            ],
+        );
+    }
+
+    // A query that pins the partition key produces a single point range, which falls inside partition3.
+    let query_plan = QueryPlan {
+        partitioned_query_execution_info_version: 1,
+        query_info: Some(QueryInfo::default()),
+        query_ranges: vec![QueryRange {
+            min: "5A5A5A5A".to_string(),
+            max: "5A5A5A5A".to_string(),
+            is_min_inclusive: true,
+            is_max_inclusive: true,
+        }],
+        ..Default::default()
+    };
+
+    let engine = Engine::new(
+        container,
+        "SELECT * FROM c WHERE c.partitionKey = 'specific_value'",
+        query_plan,
+        10,
+    )?;
+
+    let results = engine.execute()?;
+
+    let all_requests: Vec<DataRequest> = results
+        .iter()
+        .flat_map(|response| response.requests.clone())
+        .collect();
+
+    assert_eq!(
+        vec![DataRequest {
+            epk_range: Some(EpkRange {
+                min: "5A5A5A5A".to_string(),
+                max: "5A5A5A5A".to_string(),
+                is_min_inclusive: true,
+                is_max_inclusive: true,
+            }),
+            ..DataRequest::new(0, "partition3", None)
+        }],
+        all_requests
+    );
+
+    Ok(())
+}
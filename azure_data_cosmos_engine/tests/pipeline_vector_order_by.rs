@@ -0,0 +1,170 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+use std::vec;
+
+use azure_data_cosmos_engine::query::{
+    DataRequest, QueryClauseItem, QueryInfo, QueryPlan, QueryResult, SortOrder,
+};
+use pretty_assertions::assert_eq;
+
+use mock_engine::{Container, Engine};
+use serde_json::json;
+
+use crate::mock_engine::EngineResult;
+
+mod mock_engine;
+
+#[derive(Debug, Clone, PartialEq)]
+struct Item {
+    id: String,
+    partition_key: String,
+    title: String,
+    distance: f64,
+}
+
+impl Item {
+    pub fn new(id: impl Into<String>, partition_key: impl Into<String>, distance: f64) -> Self {
+        let id = id.into();
+        let partition_key = partition_key.into();
+        let title = format!("{}/{}", partition_key.clone(), id.clone());
+        Self {
+            id,
+            partition_key,
+            title,
+            distance,
+        }
+    }
+}
+
+impl From<Item> for QueryResult {
+    fn from(item: Item) -> Self {
+        let raw = serde_json::value::to_raw_value(&item.title).unwrap();
+        let distance = QueryClauseItem::from_value(json!(item.distance));
+        QueryResult::OrderBy {
+            order_by_items: vec![distance],
+            payload: raw,
+        }
+    }
+}
+
+fn create_container() -> Container {
+    // Each partition returns its own top results for the vector search, which are NOT globally ordered.
+    let mut container = Container::new();
+    container.insert(
+        "partition0",
+        vec![
+            Item::new("item0", "partition0", 0.4749).into(),
+            Item::new("item1", "partition0", 0.5208).into(),
+            Item::new("item2", "partition0", 0.2855).into(),
+        ],
+    );
+    container.insert(
+        "partition1",
+        vec![
+            Item::new("item0", "partition1", 0.4931).into(),
+            Item::new("item1", "partition1", 0.0551).into(),
+            Item::new("item2", "partition1", 0.3779).into(),
+        ],
+    );
+    container
+}
+
+fn vector_plan(order: SortOrder, top: u64) -> QueryPlan {
+    QueryPlan {
+        partitioned_query_execution_info_version: 1,
+        query_info: Some(QueryInfo {
+            top: Some(top),
+            order_by: vec![order],
+            order_by_expressions: vec!["VectorDistance(c.embedding, @vector)".to_string()],
+            has_non_streaming_order_by: true,
+            ..Default::default()
+        }),
+        ..Default::default()
+    }
+}
+
+#[test]
+pub fn vector_distance_descending() -> Result<(), Box<dyn std::error::Error>> {
+    let engine = Engine::new(
+        create_container(),
+        "SELECT TOP 4 c.title FROM c ORDER BY VectorDistance(c.embedding, @vector)",
+        vector_plan(SortOrder::Descending, 4),
+        2,
+    )?;
+
+    let results = engine.execute()?;
+    assert_eq!(
+        vec![
+            EngineResult {
+                items: vec![],
+                requests: vec![
+                    DataRequest::new(0, "partition0", None),
+                    DataRequest::new(0, "partition1", None),
+                ],
+                terminated: false
+            },
+            // Nothing can be emitted until every partition has been drained.
+            EngineResult {
+                items: vec![],
+                requests: vec![
+                    DataRequest::new(1, "partition0", Some("2".into())),
+                    DataRequest::new(1, "partition1", Some("2".into())),
+                ],
+                terminated: false
+            },
+            EngineResult {
+                items: vec![
+                    json!("partition0/item1"),
+                    json!("partition1/item0"),
+                    json!("partition0/item0"),
+                    json!("partition1/item2"),
+                ],
+                requests: vec![],
+                terminated: true
+            },
+        ],
+        results
+    );
+
+    Ok(())
+}
+
+#[test]
+pub fn vector_distance_ascending() -> Result<(), Box<dyn std::error::Error>> {
+    let engine = Engine::new(
+        create_container(),
+        "SELECT TOP 10 c.title FROM c ORDER BY VectorDistance(c.embedding, @vector)",
+        vector_plan(SortOrder::Ascending, 10),
+        10,
+    )?;
+
+    let results = engine.execute()?;
+    assert_eq!(
+        vec![
+            EngineResult {
+                items: vec![],
+                requests: vec![
+                    DataRequest::new(0, "partition0", None),
+                    DataRequest::new(0, "partition1", None),
+                ],
+                terminated: false
+            },
+            EngineResult {
+                items: vec![
+                    json!("partition1/item1"),
+                    json!("partition0/item2"),
+                    json!("partition1/item2"),
+                    json!("partition0/item0"),
+                    json!("partition1/item0"),
+                    json!("partition0/item1"),
+                ],
+                requests: vec![],
+                terminated: true
+            },
+        ],
+        results
+    );
+
+    Ok(())
+}
@@ -46,14 +46,30 @@ public class QuerySpec
     /// Parameters that can be used in the query, prefixed with '@'.
     /// </summary>
     public Dictionary<string, JToken> Parameters { get; set; } = new Dictionary<string, JToken>();
+
+    /// <summary>
+    /// The error the query is expected to fail with, if any. Queries that are expected to fail have no baseline.
+    /// </summary>
+    public JObject? ExpectError { get; set; }
+
+    /// <summary>
+    /// Whether the query has no baseline, and is only validated by comparing its results with the gateway's.
+    /// </summary>
+    public bool CompareOnly { get; set; }
+
+    /// <summary>
+    /// The name of another query in the set whose baseline this query is validated against, such as the query it runs in a different mode.
+    /// </summary>
+    public string? ResultsFrom { get; set; }
 }
 
 public class TestData
 {
     /// <summary>
-    /// The data to be inserted into the container for testing.
+    /// The data to be inserted into the containers for testing.
+    /// Either an array of items, which are inserted into every container, or an object mapping container IDs to the array of items to insert into that container.
     /// </summary>
-    public required JArray Data { get; set; }
+    public required JToken Data { get; set; }
 
     /// <summary>
     /// Parameters that can be used in queries, prefixed with '@testData_'.
@@ -63,9 +79,52 @@ public class TestData
     /// <summary>
     /// Containers that will be created for the test data.
     /// Each container should have a unique name across all files.
-    /// Each container will be created with the properties listed here and the same set of data, specified in <see cref="Data" /> will be inserted into each container.
+    /// Each container will be created with the properties listed here, and the data specified for it in <see cref="Data" /> will be inserted into it.
     /// </summary>
     public required List<ContainerProperties> Containers { get; set; }
+
+    /// <summary>
+    /// A description of more items to generate, which only the Go integration tests support.
+    /// </summary>
+    public JObject? Generate { get; set; }
+
+    /// <summary>
+    /// Gets the items to insert into the container with the given ID.
+    /// </summary>
+    public IEnumerable<JToken> ItemsFor(string containerId)
+    {
+        if (Data is JArray items)
+        {
+            return items;
+        }
+        return Data[containerId] as JArray ?? new JArray();
+    }
+
+    /// <summary>
+    /// Checks that <see cref="Data" /> is an array or an object, and that every container it lists items for is defined in <see cref="Containers" />.
+    /// </summary>
+    public void Validate()
+    {
+        if (Data is JArray)
+        {
+            return;
+        }
+        if (Data is not JObject perContainer)
+        {
+            throw new InvalidDataException("Test data must be an array of items, or an object mapping container IDs to arrays of items.");
+        }
+        foreach (var property in perContainer.Properties())
+        {
+            if (!Containers.Any(c => c.Id == property.Name))
+            {
+                throw new InvalidDataException($"Test data lists items for container '{property.Name}', but that container is not defined in the test data file.");
+            }
+            if (property.Value is not JArray)
+            {
+                throw new InvalidDataException($"Test data for container '{property.Name}' must be an array of items.");
+            }
+        }
+    }
 }
 
 public class BaselineGenerator
@@ -97,6 +156,12 @@ public class BaselineGenerator
             Console.WriteLine("Error: Unable to parse the test data file.");
             return;
         }
+        testData.Validate();
+        if (testData.Generate != null)
+        {
+            Console.WriteLine($"Error: The test data file {testDataPath} generates items, which is only supported by the Go integration tests.");
+            return;
+        }
 
         bool weCreatedDatabase = false;
         if (string.IsNullOrEmpty(databaseName))
@@ -134,6 +199,21 @@ public class BaselineGenerator
                 {
                     continue;
                 }
+                if (querySpec.ExpectError != null)
+                {
+                    Console.WriteLine($"- Skipping query {querySpec.Name}, which is expected to fail.");
+                    continue;
+                }
+                if (querySpec.CompareOnly)
+                {
+                    Console.WriteLine($"- Skipping query {querySpec.Name}, which has no baseline.");
+                    continue;
+                }
+                if (querySpec.ResultsFrom != null)
+                {
+                    Console.WriteLine($"- Skipping query {querySpec.Name}, which is validated against the baseline of {querySpec.ResultsFrom}.");
+                    continue;
+                }
                 Console.WriteLine("- Running query: " + querySpec.Name);
                 if (!containers.TryGetValue(querySpec.Container, out var container))
                 {
@@ -163,7 +243,7 @@ public class BaselineGenerator
 
             // Insert test data
             Console.WriteLine($"-- Inserting test data into container: {containerProperties.Id}");
-            foreach (var item in testData.Data)
+            foreach (var item in testData.ItemsFor(containerProperties.Id))
             {
                 await container.CreateItemAsync(item);
             }
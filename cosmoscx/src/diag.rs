@@ -3,18 +3,65 @@
 
 //! Diagnostics-related functions, such as enabling and configuring tracing.
 
-use tracing_subscriber::EnvFilter;
+use std::sync::OnceLock;
+
+use azure_data_cosmos_engine::ErrorKind;
+use tracing_subscriber::{fmt, prelude::*, reload, EnvFilter, Registry};
+
+use crate::{
+    result::{ResultCode, ResultExt},
+    slice::Str,
+};
+
+/// The handle used to replace the filter of the subscriber installed by [`cosmoscx_v0_tracing_enable`], once it's installed.
+static TRACING_FILTER: OnceLock<reload::Handle<EnvFilter, Registry>> = OnceLock::new();
+
+/// Installs the engine's subscriber, the first time it's called, and returns the handle to its filter.
+fn tracing_filter() -> &'static reload::Handle<EnvFilter, Registry> {
+    TRACING_FILTER.get_or_init(|| {
+        let (filter, handle) = reload::Layer::new(EnvFilter::from_env("COSMOSCX_LOG"));
+
+        // Ignore the error if the host has already installed a global subscriber, in which case the engine's traces go to that one and its filter has no effect.
+        let _ = tracing_subscriber::registry()
+            .with(filter)
+            .with(fmt::layer())
+            .try_init();
+        handle
+    })
+}
 
 /// Enables built-in tracing for the Cosmos Client Engine.
 ///
 /// This is an early version of the tracing API and is subject to change.
 /// For now, it activates the default console tracing in [`tracing_subscriber::fmt`](fn@tracing_subscriber::fmt) and enables the [`EnvFilter`](`tracing_subscriber::EnvFilter`) using the `COSMOSCX_LOG` environment variable.
 ///
-/// Once enabled in this way, tracing cannot be disabled.
+/// Once enabled in this way, tracing cannot be disabled, but its filter can be replaced with [`cosmoscx_v0_tracing_set_filter`].
+/// Only the first call installs the subscriber, later calls (including concurrent ones) have no effect.
 #[no_mangle]
 pub extern "C" fn cosmoscx_v0_tracing_enable() {
-    // Ignore errors from multiple initializations.
-    let _ = tracing_subscriber::fmt()
-        .with_env_filter(EnvFilter::from_env("COSMOSCX_LOG"))
-        .try_init();
+    tracing_filter();
+}
+
+/// Replaces the filter that selects which traces are written, enabling tracing first if it isn't already (see [`cosmoscx_v0_tracing_enable`]).
+///
+/// This can be called any number of times, from any thread, to adjust the verbosity of tracing while pipelines are running.
+///
+/// # Parameters
+/// - `filter`: A [`Str`] containing the filter's directives, using the same syntax as the `COSMOSCX_LOG` environment variable, such as `debug` or `azure_data_cosmos_engine=trace`.
+///
+/// # Returns
+///
+/// [`ResultCode::DeserializationError`] if the directives can't be parsed, in which case the filter isn't changed.
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_tracing_set_filter(filter: Str<'_>) -> ResultCode {
+    fn inner(filter: Str<'_>) -> Result<(), azure_data_cosmos_engine::Error> {
+        let directives = unsafe { filter.as_str().not_null() }?;
+        let filter = EnvFilter::try_new(directives)
+            .map_err(|e| ErrorKind::DeserializationError.with_source(e))?;
+        tracing_filter()
+            .reload(filter)
+            .map_err(|e| ErrorKind::InternalError.with_source(e))
+    }
+
+    inner(filter).into()
 }
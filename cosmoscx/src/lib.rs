@@ -12,6 +12,7 @@ use azure_data_cosmos_engine::query::SUPPORTED_FEATURES;
 
 pub mod diag;
 pub mod pipeline;
+pub mod plan;
 pub mod result;
 pub mod slice;
 
@@ -5,9 +5,11 @@
 
 use azure_data_cosmos_engine::{
     query::{PartitionKeyRange, QueryPipeline, QueryPlan},
-    ErrorKind,
+    ErrorKind, PartitionKeyKind, PartitionKeyValue,
 };
+use flate2::read::{DeflateDecoder, GzDecoder, ZlibDecoder};
 use serde::Deserialize;
+use std::{borrow::Cow, io::Read};
 
 use crate::{
     result::ResultExt,
@@ -41,6 +43,88 @@ impl Pipeline {
     }
 }
 
+/// Models the partition key definition of a container, as returned by the gateway.
+#[derive(Deserialize)]
+struct PartitionKeyDefinition {
+    kind: String,
+
+    // Containers created before hash V2 was introduced don't specify a version.
+    #[serde(default = "default_partition_key_version")]
+    version: u8,
+}
+
+fn default_partition_key_version() -> u8 {
+    1
+}
+
+/// Parses the common parameters to all the pipeline creation functions.
+fn parse_pipeline_args<'a>(
+    query: Str<'a>,
+    query_plan_json: Str<'a>,
+    pkranges: Str<'a>,
+) -> Result<(&'a str, QueryPlan, Vec<PartitionKeyRange>), azure_data_cosmos_engine::Error> {
+    let query = unsafe { query.as_str().not_null() }?;
+    let query_plan_json = unsafe { query_plan_json.as_str().not_null() }?;
+    let pkranges_json = unsafe { pkranges.as_str().not_null() }?;
+
+    let query_plan: QueryPlan = serde_json::from_str(query_plan_json)
+        .map_err(|e| ErrorKind::InvalidGatewayResponse.with_source(e))?;
+    let pkranges = PartitionKeyRange::parse_list(pkranges_json)?;
+    Ok((query, query_plan, pkranges))
+}
+
+/// Parses and validates a JSON list of partition key ranges, without creating a pipeline.
+///
+/// See [`PartitionKeyRange::validate_all`] for the rules the ranges must satisfy.
+///
+/// # Parameters
+/// - `pkranges`: A [`Str`] containing the serialized partition key ranges list, as recieved from the gateway, in JSON.
+///
+/// # Returns
+///
+/// An empty [`OwnedString`] if the ranges are valid, otherwise a description of the problem, naming the offending range.
+/// The returned string MUST be freed using [`cosmoscx_v0_string_free`](crate::slice::cosmoscx_v0_string_free).
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_query_pkranges_validate(pkranges: Str<'_>) -> OwnedString {
+    fn inner(pkranges: Str<'_>) -> Result<(), azure_data_cosmos_engine::Error> {
+        let pkranges_json = unsafe { pkranges.as_str().not_null() }?;
+        PartitionKeyRange::parse_list(pkranges_json)?;
+        Ok(())
+    }
+
+    match inner(pkranges) {
+        Ok(()) => OwnedString::EMPTY,
+        Err(e) => e.to_string().into(),
+    }
+}
+
+/// Parses a partition key, serialized as a JSON array of the values of each path in the partition key definition.
+///
+/// An empty JSON object (`{}`) represents a path that is undefined in the item.
+fn parse_partition_key(
+    partition_key_json: &str,
+) -> Result<Vec<PartitionKeyValue>, azure_data_cosmos_engine::Error> {
+    let values: Vec<serde_json::Value> = serde_json::from_str(partition_key_json)
+        .map_err(|e| ErrorKind::InvalidQuery.with_source(e))?;
+    values
+        .into_iter()
+        .map(|value| match value {
+            serde_json::Value::Null => Ok(PartitionKeyValue::Null),
+            serde_json::Value::Bool(b) => Ok(PartitionKeyValue::Bool(b)),
+            serde_json::Value::Number(n) => {
+                n.as_f64().map(PartitionKeyValue::Number).ok_or_else(|| {
+                    ErrorKind::InvalidQuery.with_message("partition key number is out of range")
+                })
+            }
+            serde_json::Value::String(s) => Ok(PartitionKeyValue::String(s)),
+            serde_json::Value::Object(o) if o.is_empty() => Ok(PartitionKeyValue::Undefined),
+            _ => Err(ErrorKind::InvalidQuery.with_message(
+                "partition key values must be strings, numbers, booleans, null, or {}",
+            )),
+        })
+        .collect()
+}
+
 /// Creates a new query pipeline from a JSON query plan and list of partitions.
 ///
 /// # Parameters
@@ -52,34 +136,117 @@ pub extern "C" fn cosmoscx_v0_query_pipeline_create<'a>(
     query_plan_json: Str<'a>,
     pkranges: Str<'a>,
 ) -> FfiResult<Pipeline> {
-    #[derive(Deserialize)]
-    struct PartitionKeyRangeResult {
-        #[serde(rename = "PartitionKeyRanges")]
-        pub ranges: Vec<PartitionKeyRange>,
+    fn inner<'a>(
+        query: Str<'a>,
+        query_plan_json: Str<'a>,
+        pkranges: Str<'a>,
+    ) -> Result<Box<QueryPipeline>, azure_data_cosmos_engine::Error> {
+        let (query, query_plan, pkranges) = parse_pipeline_args(query, query_plan_json, pkranges)?;
+
+        // SAFETY: We should no longer need either of the parameter slices, we copied them into owned data.
+
+        tracing::debug!(query = ?query, query_plan = ?query_plan, pkranges = ?pkranges, "creating query pipeline");
+        let pipeline = QueryPipeline::new(query, query_plan, pkranges)?;
+        Ok(Box::new(pipeline))
     }
 
+    inner(query, query_plan_json, pkranges).into()
+}
+
+/// Creates a new query pipeline that is scoped to a single partition key value.
+///
+/// The engine computes the effective partition key (EPK) of the provided partition key, and all requests issued by the pipeline target the partition key range that owns it.
+///
+/// # Parameters
+/// - `query_plan_json`: A [`Str`] containing the serialized query plan, as recieved from the gateway, in JSON.
+/// - `pkranges`: A [`Str`] containing the serialized partition key ranges list, as recieved from the gateway, in JSON.
+/// - `partition_key`: A [`Str`] containing the partition key, as a JSON array with one value per partition key path.
+/// - `partition_key_definition`: A [`Str`] containing the container's partition key definition (`kind`, `paths`, `version`), in JSON.
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_query_pipeline_create_for_partition_key<'a>(
+    query: Str<'a>,
+    query_plan_json: Str<'a>,
+    pkranges: Str<'a>,
+    partition_key: Str<'a>,
+    partition_key_definition: Str<'a>,
+) -> FfiResult<Pipeline> {
     fn inner<'a>(
         query: Str<'a>,
         query_plan_json: Str<'a>,
         pkranges: Str<'a>,
+        partition_key: Str<'a>,
+        partition_key_definition: Str<'a>,
     ) -> Result<Box<QueryPipeline>, azure_data_cosmos_engine::Error> {
-        let query = unsafe { query.as_str().not_null() }?;
-        let query_plan_json = unsafe { query_plan_json.as_str().not_null() }?;
-        let pkranges_json = unsafe { pkranges.as_str().not_null() }?;
+        let (query, query_plan, pkranges) = parse_pipeline_args(query, query_plan_json, pkranges)?;
+        let partition_key = unsafe { partition_key.as_str().not_null() }?;
+        let partition_key_definition = unsafe { partition_key_definition.as_str().not_null() }?;
+
+        let partition_key = parse_partition_key(partition_key)?;
+        let definition: PartitionKeyDefinition = serde_json::from_str(partition_key_definition)
+            .map_err(|e| ErrorKind::InvalidQuery.with_source(e))?;
+        let kind = match definition.kind.as_str() {
+            "Hash" => PartitionKeyKind::Hash,
+            "MultiHash" => PartitionKeyKind::MultiHash,
+            _ => PartitionKeyKind::Other,
+        };
 
-        let query_plan: QueryPlan = serde_json::from_str(query_plan_json)
-            .map_err(|e| ErrorKind::InvalidGatewayResponse.with_source(e))?;
-        let pkranges: PartitionKeyRangeResult = serde_json::from_str(pkranges_json)
-            .map_err(|e| ErrorKind::InvalidGatewayResponse.with_source(e))?;
+        tracing::debug!(query = ?query, query_plan = ?query_plan, pkranges = ?pkranges, ?partition_key, ?kind, version = definition.version, "creating partition-scoped query pipeline");
+        let pipeline = QueryPipeline::for_partition_key(
+            query,
+            query_plan,
+            pkranges,
+            &partition_key,
+            kind,
+            definition.version,
+        )?;
+        Ok(Box::new(pipeline))
+    }
 
-        // SAFETY: We should no longer need either of the parameter slices, we copied them into owned data.
+    inner(
+        query,
+        query_plan_json,
+        pkranges,
+        partition_key,
+        partition_key_definition,
+    )
+    .into()
+}
 
-        tracing::debug!(query = ?query, query_plan = ?query_plan, pkranges = ?pkranges.ranges, "creating query pipeline");
-        let pipeline = QueryPipeline::new(query, query_plan, pkranges.ranges)?;
+/// Creates a new query pipeline that is scoped to a single effective partition key (EPK).
+///
+/// All requests issued by the pipeline target the partition key range that owns the provided EPK.
+///
+/// # Parameters
+/// - `query_plan_json`: A [`Str`] containing the serialized query plan, as recieved from the gateway, in JSON.
+/// - `pkranges`: A [`Str`] containing the serialized partition key ranges list, as recieved from the gateway, in JSON.
+/// - `effective_partition_key`: A [`Str`] containing the hex-encoded EPK.
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_query_pipeline_create_for_epk<'a>(
+    query: Str<'a>,
+    query_plan_json: Str<'a>,
+    pkranges: Str<'a>,
+    effective_partition_key: Str<'a>,
+) -> FfiResult<Pipeline> {
+    fn inner<'a>(
+        query: Str<'a>,
+        query_plan_json: Str<'a>,
+        pkranges: Str<'a>,
+        effective_partition_key: Str<'a>,
+    ) -> Result<Box<QueryPipeline>, azure_data_cosmos_engine::Error> {
+        let (query, query_plan, pkranges) = parse_pipeline_args(query, query_plan_json, pkranges)?;
+        let effective_partition_key = unsafe { effective_partition_key.as_str().not_null() }?;
+
+        tracing::debug!(query = ?query, query_plan = ?query_plan, pkranges = ?pkranges, effective_partition_key, "creating EPK-scoped query pipeline");
+        let pipeline = QueryPipeline::for_effective_partition_key(
+            query,
+            query_plan,
+            pkranges,
+            effective_partition_key,
+        )?;
         Ok(Box::new(pipeline))
     }
 
-    inner(query, query_plan_json, pkranges).into()
+    inner(query, query_plan_json, pkranges, effective_partition_key).into()
 }
 
 /// Frees the memory associated with a pipeline.
@@ -88,10 +255,11 @@ pub extern "C" fn cosmoscx_v0_query_pipeline_create<'a>(
 ///
 /// # Safety
 ///
-/// The caller must ensure that the pointer passed to this function is a valid pointer to a [`PipelineResult`] returned by [`cosmoscx_v0_query_pipeline_run`].
+/// The caller must ensure that the pointer passed to this function is a valid pointer to a [`Pipeline`] returned by one of the pipeline creation functions, such as [`cosmoscx_v0_query_pipeline_create`].
 #[no_mangle]
 pub unsafe extern "C" fn cosmoscx_v0_query_pipeline_free(pipeline: *mut Pipeline) {
-    unsafe { crate::free(pipeline) }
+    // `Pipeline` is an opaque, zero-sized type, so the pointer must be cast back to the `QueryPipeline` it was created from for the pipeline to be dropped.
+    unsafe { crate::free(pipeline as *mut QueryPipeline) }
 }
 
 /// Gets the, possibly rewritten, query that this pipeline is executing.
@@ -117,6 +285,100 @@ pub extern "C" fn cosmoscx_v0_query_pipeline_query(
     inner(pipeline).into()
 }
 
+/// Describes how the pipeline was constructed from the query plan, for debugging.
+///
+/// See [`QueryPipeline::explain`](azure_data_cosmos_engine::query::QueryPipeline::explain) for more information.
+/// The returned [`OwnedString`] MUST be freed by calling [`cosmoscx_v0_query_pipeline_free_explanation`].
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_query_pipeline_explain(
+    pipeline: *mut Pipeline,
+) -> FfiResult<OwnedString> {
+    fn inner(pipeline: *mut Pipeline) -> Result<Box<OwnedString>, azure_data_cosmos_engine::Error> {
+        let pipeline = unsafe { Pipeline::unwrap_ptr(pipeline) }?;
+        Ok(Box::new(pipeline.explain().into()))
+    }
+
+    inner(pipeline).into()
+}
+
+/// Frees an [`OwnedString`] returned by [`cosmoscx_v0_query_pipeline_explain`].
+///
+/// # Safety
+///
+/// The caller must ensure that the pointer passed to this function is a valid pointer to an [`OwnedString`] returned by [`cosmoscx_v0_query_pipeline_explain`].
+#[no_mangle]
+pub unsafe extern "C" fn cosmoscx_v0_query_pipeline_free_explanation(
+    explanation: *mut OwnedString,
+) {
+    unsafe { crate::free(explanation) }
+}
+
+/// Stops the pipeline from fetching any more data, so that it only produces the items it has already buffered.
+///
+/// After this is called, [`cosmoscx_v0_query_pipeline_run`] never returns requests, and the pipeline completes once the buffered items have been produced.
+/// See [`QueryPipeline::drain`](azure_data_cosmos_engine::query::QueryPipeline::drain) for more information.
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_query_pipeline_drain(pipeline: *mut Pipeline) -> ResultCode {
+    fn inner(pipeline: *mut Pipeline) -> Result<(), azure_data_cosmos_engine::Error> {
+        let pipeline = unsafe { Pipeline::unwrap_ptr(pipeline) }?;
+        pipeline.drain();
+        Ok(())
+    }
+
+    inner(pipeline).into()
+}
+
+/// Sets the maximum number of partitions that the pipeline requests data for in a single turn, or `0` for no limit.
+///
+/// See [`QueryPipeline::set_max_concurrent_partitions`](azure_data_cosmos_engine::query::QueryPipeline::set_max_concurrent_partitions) for more information.
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_query_pipeline_set_max_concurrent_partitions(
+    pipeline: *mut Pipeline,
+    max: u32,
+) -> ResultCode {
+    fn inner(pipeline: *mut Pipeline, max: u32) -> Result<(), azure_data_cosmos_engine::Error> {
+        let pipeline = unsafe { Pipeline::unwrap_ptr(pipeline) }?;
+        pipeline.set_max_concurrent_partitions(max as usize);
+        Ok(())
+    }
+
+    inner(pipeline, max).into()
+}
+
+/// Sets the number of items the consumer wants from each turn, or `0` if it has no preference.
+///
+/// See [`QueryPipeline::set_target_batch_size`](azure_data_cosmos_engine::query::QueryPipeline::set_target_batch_size) for more information.
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_query_pipeline_set_target_batch_size(
+    pipeline: *mut Pipeline,
+    target: u32,
+) -> ResultCode {
+    fn inner(pipeline: *mut Pipeline, target: u32) -> Result<(), azure_data_cosmos_engine::Error> {
+        let pipeline = unsafe { Pipeline::unwrap_ptr(pipeline) }?;
+        pipeline.set_target_batch_size(target as usize);
+        Ok(())
+    }
+
+    inner(pipeline, target).into()
+}
+
+/// Sets the maximum number of items the pipeline may buffer while it waits for every partition to be drained, or `0` for no limit.
+///
+/// See [`QueryPipeline::set_max_buffered_items`](azure_data_cosmos_engine::query::QueryPipeline::set_max_buffered_items) for more information.
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_query_pipeline_set_max_buffered_items(
+    pipeline: *mut Pipeline,
+    max: u32,
+) -> ResultCode {
+    fn inner(pipeline: *mut Pipeline, max: u32) -> Result<(), azure_data_cosmos_engine::Error> {
+        let pipeline = unsafe { Pipeline::unwrap_ptr(pipeline) }?;
+        pipeline.set_max_buffered_items(max as usize);
+        Ok(())
+    }
+
+    inner(pipeline, max).into()
+}
+
 /// Represents a request for more data from the pipeline.
 ///
 /// Each `DataRequest` represents a request FROM the query pipeline to the calling SDK to perform a query against a single Cosmos partition.
@@ -138,6 +400,57 @@ pub struct DataRequest {
     /// A boolean indicating if parameters should be included in the query request.
     /// If this value is false, the query should be executed without parameters.
     include_parameters: bool,
+
+    /// An [`OwnedString`] containing the minimum effective partition key (EPK) this request is scoped to.
+    /// If [`DataRequest::epk_max`] is an empty slice (len == 0), the request covers the entire partition key range and this value should be ignored.
+    epk_min: OwnedString,
+
+    /// An [`OwnedString`] containing the maximum effective partition key (EPK) this request is scoped to, or an empty slice (len == 0) if the request covers the entire partition key range.
+    epk_max: OwnedString,
+
+    /// A boolean indicating if [`DataRequest::epk_min`] is inclusive. If false, it's exclusive.
+    epk_min_inclusive: bool,
+
+    /// A boolean indicating if [`DataRequest::epk_max`] is inclusive. If false, it's exclusive.
+    epk_max_inclusive: bool,
+}
+
+/// Identifies the kind of problem described by a [`Warning`].
+///
+/// Values of `WarningCode` have the same representation as the C type `intptr_t`
+/// cbindgen:prefix-with-name
+/// cbindgen:rename-all=SCREAMING_SNAKE_CASE
+#[repr(isize)]
+pub enum WarningCode {
+    /// See [`WarningCode::UndefinedOrderByItem`](azure_data_cosmos_engine::query::WarningCode::UndefinedOrderByItem).
+    UndefinedOrderByItem = 1,
+
+    /// See [`WarningCode::SkippedItem`](azure_data_cosmos_engine::query::WarningCode::SkippedItem).
+    SkippedItem = 2,
+}
+
+impl From<azure_data_cosmos_engine::query::WarningCode> for WarningCode {
+    fn from(value: azure_data_cosmos_engine::query::WarningCode) -> Self {
+        match value {
+            azure_data_cosmos_engine::query::WarningCode::UndefinedOrderByItem => {
+                WarningCode::UndefinedOrderByItem
+            }
+            azure_data_cosmos_engine::query::WarningCode::SkippedItem => WarningCode::SkippedItem,
+        }
+    }
+}
+
+/// Describes a problem with the data provided to the pipeline that the pipeline worked around, rather than failing the query.
+#[repr(C)]
+pub struct Warning {
+    /// The kind of problem.
+    code: WarningCode,
+
+    /// An [`OwnedString`] describing the problem.
+    message: OwnedString,
+
+    /// An [`OwnedString`] containing the ID of the partition key range whose data had the problem.
+    pkrange_id: OwnedString,
 }
 
 /// Represents the result of a single execution of the query pipeline.
@@ -151,6 +464,9 @@ pub struct PipelineResult {
 
     /// An [`OwnedSlice`] of [`DataRequest`]s describing additional requests that must be made and provided to [`cosmoscx_v0_query_pipeline_provide_data`] before retrieving the next batch.
     requests: OwnedSlice<DataRequest>,
+
+    /// An [`OwnedSlice`] of [`Warning`]s describing problems with the data provided since the previous turn, which the pipeline worked around.
+    warnings: OwnedSlice<Warning>,
 }
 
 /// Represents a response to a single data request from the pipeline.
@@ -163,10 +479,53 @@ pub struct QueryResponse<'a> {
     request_id: u64,
 
     /// The raw data being provided to the pipeline in response to the request.
+    ///
+    /// If [`QueryResponse::content_encoding`] is set, this contains the encoded body, which need not be valid UTF-8.
     data: Str<'a>,
 
     /// The continuation token to provide, or an empty slice (len == 0) if no continuation should be provided.
     continuation: Str<'a>,
+
+    /// The encoding of [`QueryResponse::data`], as reported by the `Content-Encoding` header of the response.
+    ///
+    /// An empty slice (len == 0) or `identity` indicates that the data is not encoded. The engine decodes `gzip` and `deflate` bodies itself.
+    content_encoding: Str<'a>,
+}
+
+/// Decodes a response body according to its content encoding, borrowing the original data if it isn't encoded.
+fn decode_body<'a>(
+    data: &'a [u8],
+    content_encoding: &str,
+) -> Result<Cow<'a, [u8]>, azure_data_cosmos_engine::Error> {
+    let mut decoded = Vec::new();
+    let result = match content_encoding.to_ascii_lowercase().as_str() {
+        "" | "identity" => return Ok(Cow::Borrowed(data)),
+        "gzip" => GzDecoder::new(data).read_to_end(&mut decoded),
+
+        // HTTP 'deflate' is zlib-wrapped, but some servers send a raw deflate stream, so accept both.
+        "deflate" if is_zlib_header(data) => ZlibDecoder::new(data).read_to_end(&mut decoded),
+        "deflate" => DeflateDecoder::new(data).read_to_end(&mut decoded),
+        _ => {
+            return Err(ErrorKind::InvalidGatewayResponse.with_message(format!(
+                "unsupported content encoding '{content_encoding}', expected 'gzip', 'deflate', or 'identity'"
+            )))
+        }
+    };
+
+    result.map_err(|e| {
+        ErrorKind::InvalidGatewayResponse.with_message(format!(
+            "failed to decode {content_encoding} response body: {e}"
+        ))
+    })?;
+    Ok(Cow::Owned(decoded))
+}
+
+/// Checks if the data starts with a valid zlib header (RFC 1950), using the deflate compression method.
+fn is_zlib_header(data: &[u8]) -> bool {
+    match data {
+        [cmf, flg, ..] => cmf & 0x0F == 8 && (u16::from(*cmf) << 8 | u16::from(*flg)) % 31 == 0,
+        _ => false,
+    }
 }
 
 /// Executes a single turn of the query pipeline.
@@ -198,18 +557,44 @@ pub extern "C" fn cosmoscx_v0_query_pipeline_run(
         let requests = result
             .requests
             .into_iter()
-            .map(|r| DataRequest {
-                id: r.id,
-                pkrangeid: r.pkrange_id.into_owned().into(),
-                continuation: match r.continuation {
-                    None => OwnedSlice::EMPTY,
-                    Some(s) => s.into(),
-                },
-                query: match r.query {
-                    None => OwnedSlice::EMPTY,
-                    Some(s) => s.into(),
-                },
-                include_parameters: r.include_parameters,
+            .map(|r| {
+                let (epk_min, epk_max, epk_min_inclusive, epk_max_inclusive) = match r.epk_range {
+                    None => (OwnedSlice::EMPTY, OwnedSlice::EMPTY, false, false),
+                    Some(range) => (
+                        range.min.into(),
+                        range.max.into(),
+                        range.is_min_inclusive,
+                        range.is_max_inclusive,
+                    ),
+                };
+                DataRequest {
+                    id: r.id,
+                    pkrangeid: r.pkrange_id.into_owned().into(),
+                    continuation: match r.continuation {
+                        None => OwnedSlice::EMPTY,
+                        Some(s) => s.into(),
+                    },
+                    query: match r.query {
+                        None => OwnedSlice::EMPTY,
+                        Some(s) => s.into(),
+                    },
+                    include_parameters: r.include_parameters,
+                    epk_min,
+                    epk_max,
+                    epk_min_inclusive,
+                    epk_max_inclusive,
+                }
+            })
+            .collect::<Vec<_>>()
+            .into();
+
+        let warnings = result
+            .warnings
+            .into_iter()
+            .map(|w| Warning {
+                code: w.code.into(),
+                message: w.message.into(),
+                pkrange_id: w.pkrange_id.into(),
             })
             .collect::<Vec<_>>()
             .into();
@@ -218,6 +603,7 @@ pub extern "C" fn cosmoscx_v0_query_pipeline_run(
             completed: result.terminated,
             items,
             requests,
+            warnings,
         }))
     }
 
@@ -237,6 +623,12 @@ pub unsafe extern "C" fn cosmoscx_v0_query_pipeline_free_result(result: *mut Pip
 }
 
 /// Inserts additional raw data, in response to a [`DataRequest`] from the pipeline.
+///
+/// Bodies encoded with `gzip` or `deflate` (see [`QueryResponse::content_encoding`]) are decoded before they're applied.
+/// An unsupported encoding, or a corrupt or truncated stream, is reported as [`ResultCode::InvalidGatewayResponse`].
+///
+/// Responses are applied in order. If a response can't be applied (for example, because the body is malformed), an error is returned and that response,
+/// and any that follow it, are NOT applied. The pipeline remains usable, and the next call to [`cosmoscx_v0_query_pipeline_run`] will request the same data again.
 #[no_mangle]
 pub extern "C" fn cosmoscx_v0_query_pipeline_provide_data<'a>(
     pipeline: *mut Pipeline,
@@ -254,7 +646,15 @@ pub extern "C" fn cosmoscx_v0_query_pipeline_provide_data<'a>(
 
         for response in responses {
             let pkrange_id = unsafe { response.pkrange_id.as_str().not_null()? };
-            let data = unsafe { response.data.as_str().not_null()? };
+            let content_encoding = unsafe { response.content_encoding.as_str()? }
+                .unwrap_or_default()
+                .trim();
+            // Some bindings represent an empty body with a null pointer, let the pipeline report it as an empty response.
+            let data = decode_body(
+                unsafe { response.data.as_slice() }.unwrap_or_default(),
+                content_encoding,
+            )?;
+            std::str::from_utf8(&data).map_err(|_| ErrorKind::InvalidUtf8String)?;
             let continuation = unsafe {
                 match response.continuation.into_string()? {
                     // Normalize empty strings to 'None'
@@ -264,12 +664,7 @@ pub extern "C" fn cosmoscx_v0_query_pipeline_provide_data<'a>(
             };
 
             // Pass the raw bytes directly to the pipeline
-            pipeline.provide_data(
-                pkrange_id,
-                response.request_id,
-                data.as_bytes(),
-                continuation,
-            )?;
+            pipeline.provide_data(pkrange_id, response.request_id, &data, continuation)?;
         }
         Ok(())
     }
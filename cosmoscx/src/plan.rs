@@ -0,0 +1,73 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+//! Functions related to inspecting query plans, without creating a query pipeline.
+
+use azure_data_cosmos_engine::{
+    query::{QueryFeature, QueryPlan, SUPPORTED_FEATURES},
+    ErrorKind,
+};
+
+use crate::result::ResultExt;
+
+use super::{
+    result::FfiResult,
+    slice::{OwnedString, Str},
+};
+
+/// Describes the features required by a query plan, and which of them are NOT supported by the engine.
+#[repr(C)]
+pub struct PlanCheckResult {
+    /// A comma-separated list of the camelCase names of the features required by the query plan.
+    required_features: OwnedString,
+
+    /// A comma-separated list of the camelCase names of the required features that are NOT supported by the engine.
+    ///
+    /// If this is empty ([`OwnedString::len`] == 0), the engine supports the query plan.
+    missing_features: OwnedString,
+}
+
+fn join_names(features: &[QueryFeature]) -> OwnedString {
+    features
+        .iter()
+        .map(QueryFeature::name)
+        .collect::<Vec<_>>()
+        .join(",")
+        .into()
+}
+
+/// Checks if the engine supports the provided JSON query plan, without creating a pipeline.
+///
+/// # Parameters
+/// - `query_plan_json`: A [`Str`] containing the serialized query plan, as recieved from the gateway, in JSON.
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_query_plan_check(
+    query_plan_json: Str<'_>,
+) -> FfiResult<PlanCheckResult> {
+    fn inner(
+        query_plan_json: Str<'_>,
+    ) -> Result<Box<PlanCheckResult>, azure_data_cosmos_engine::Error> {
+        let query_plan_json = unsafe { query_plan_json.as_str().not_null() }?;
+        let query_plan: QueryPlan = serde_json::from_str(query_plan_json)
+            .map_err(|e| ErrorKind::InvalidGatewayResponse.with_source(e))?;
+
+        let support = SUPPORTED_FEATURES.check(&query_plan);
+        tracing::debug!(?support, "checked query plan");
+        Ok(Box::new(PlanCheckResult {
+            required_features: join_names(&support.required),
+            missing_features: join_names(&support.missing),
+        }))
+    }
+
+    inner(query_plan_json).into()
+}
+
+/// Frees all the memory associated with a [`PlanCheckResult`].
+///
+/// # Safety
+///
+/// The caller must ensure that the pointer passed to this function is a valid pointer to a [`PlanCheckResult`] returned by [`cosmoscx_v0_query_plan_check`].
+#[no_mangle]
+pub unsafe extern "C" fn cosmoscx_v0_query_plan_free_check_result(result: *mut PlanCheckResult) {
+    unsafe { crate::free(result) }
+}
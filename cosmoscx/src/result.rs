@@ -3,8 +3,37 @@
 
 //! FFI-safe types for communicating errors and the result of fallible functions.
 
+use std::cell::RefCell;
+
 use azure_data_cosmos_engine::ErrorKind;
 
+use crate::slice::OwnedString;
+
+thread_local! {
+    /// The message of the last error reported by an engine function on this thread.
+    static LAST_ERROR_MESSAGE: RefCell<Option<String>> = const { RefCell::new(None) };
+}
+
+/// Records an error returned by an engine function, so that the language binding can retrieve its details with [`cosmoscx_v0_last_error_message`].
+fn record_error(error: &azure_data_cosmos_engine::Error) {
+    tracing::error!(?error, "an error occurred");
+    LAST_ERROR_MESSAGE.with(|m| *m.borrow_mut() = Some(error.to_string()));
+}
+
+/// Takes the message of the last error reported by an engine function called on the current thread.
+///
+/// Result codes only identify the kind of error, this message describes it (for example, naming the partition key range and continuation tokens involved).
+/// The message is cleared once it's taken, and is replaced by each error that follows, so it must be taken immediately after the failing call, on the same thread.
+///
+/// # Returns
+///
+/// The message, or an empty [`OwnedString`] if no error has been reported since it was last taken.
+/// The returned string MUST be freed using [`cosmoscx_v0_string_free`](crate::slice::cosmoscx_v0_string_free).
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_last_error_message() -> OwnedString {
+    LAST_ERROR_MESSAGE.with(|m| m.borrow_mut().take()).into()
+}
+
 /// A result code for FFI functions, which indicates the success or failure of the operation.
 ///
 /// Values of `ResultCode` have the same representation as the C type `intptr_t`
@@ -44,6 +73,12 @@ pub enum ResultCode {
 
     /// See [`ErrorKind::InvalidQuery`].
     InvalidQuery = -11,
+
+    /// See [`ErrorKind::InvalidContinuation`].
+    InvalidContinuation = -12,
+
+    /// See [`ErrorKind::BufferLimitExceeded`].
+    BufferLimitExceeded = -13,
 }
 
 impl From<azure_data_cosmos_engine::Error> for ResultCode {
@@ -67,6 +102,8 @@ impl From<ErrorKind> for ResultCode {
             ErrorKind::ArithmeticOverflow => ResultCode::ArithmeticOverflow,
             ErrorKind::InvalidRequestId => ResultCode::InvalidRequestId,
             ErrorKind::InvalidQuery => ResultCode::InvalidQuery,
+            ErrorKind::InvalidContinuation => ResultCode::InvalidContinuation,
+            ErrorKind::BufferLimitExceeded => ResultCode::BufferLimitExceeded,
             ErrorKind::PythonError => ResultCode::InternalError,
         }
     }
@@ -81,9 +118,7 @@ impl From<Result<(), azure_data_cosmos_engine::Error>> for ResultCode {
         match value {
             Ok(_) => ResultCode::Success,
             Err(e) => {
-                tracing::error!(error = ?e, "an error occurred");
-                // TODO: Store the error details in a thread local to be retrieved by a "get last error" function.
-
+                record_error(&e);
                 e.into()
             }
         }
@@ -126,9 +161,7 @@ impl<T, U> From<Result<Box<T>, azure_data_cosmos_engine::Error>> for FfiResult<U
                 }
             }
             Err(e) => {
-                tracing::error!(error = ?e, "an error occurred");
-                // TODO: Store the error details in a thread local to be retrieved by a "get last error" function.
-
+                record_error(&e);
                 Self {
                     code: e.into(),
                     value: std::ptr::null(),
@@ -253,3 +253,9 @@ where
         value.map(|v| v.into()).unwrap_or(OwnedString::EMPTY)
     }
 }
+
+/// Frees an [`OwnedString`] that was returned directly (rather than as part of another structure) by an engine function.
+#[no_mangle]
+pub extern "C" fn cosmoscx_v0_string_free(s: OwnedString) {
+    drop(s)
+}
@@ -0,0 +1,147 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// documentShape describes the documents a benchmark generates.
+type documentShape struct {
+	// Size is the serialized size of each document, reached by padding its payload string.
+	// A document is never smaller than its other properties, so a Size of 0 leaves the payload empty.
+	Size int
+	// Depth is the number of objects the properties are nested in, 0 putting them alongside the id.
+	Depth int
+	// Properties is the number of properties besides the id and payload.
+	Properties int
+}
+
+func (s documentShape) String() string {
+	size := fmt.Sprintf("%dB", s.Size)
+	if s.Size == 0 {
+		size = "unpadded"
+	} else if s.Size >= 1024 && s.Size%1024 == 0 {
+		size = fmt.Sprintf("%dKB", s.Size/1024)
+	}
+	return fmt.Sprintf("Size=%s,Depth=%d,Properties=%d", size, s.Depth, s.Properties)
+}
+
+// smallDocuments are documents of a few properties, of a few dozen bytes each.
+var smallDocuments = documentShape{Properties: 1}
+
+// sizedDocuments are the shapes the benchmarks compare the throughput of, in bytes as well as items, of:
+// realistic documents of 1KB to 16KB, and 4KB documents whose properties are deeply nested, or numerous.
+var sizedDocuments = []documentShape{
+	{Size: 1024, Depth: 1, Properties: 8},
+	{Size: 4 * 1024, Depth: 1, Properties: 8},
+	{Size: 16 * 1024, Depth: 1, Properties: 8},
+	{Size: 4 * 1024, Depth: 8, Properties: 8},
+	{Size: 4 * 1024, Depth: 1, Properties: 64},
+}
+
+// document returns the i-th document of the shape, whose "value" property is i.
+func (s documentShape) document(i int) string {
+	var properties strings.Builder
+	for p := 0; p < s.Properties; p++ {
+		if p > 0 {
+			properties.WriteByte(',')
+		}
+		if p == 0 {
+			fmt.Fprintf(&properties, `"value":%d`, i)
+		} else {
+			fmt.Fprintf(&properties, `"property%d":"value%d"`, p, i)
+		}
+	}
+	nested := properties.String()
+	for d := 0; d < s.Depth; d++ {
+		nested = `"nested":{` + nested + `}`
+	}
+	if nested != "" {
+		nested += ","
+	}
+
+	document := fmt.Sprintf(`{"id":"item%d",%s"payload":""}`, i, nested)
+	if padding := s.Size - len(document); padding > 0 {
+		document = document[:len(document)-2] + strings.Repeat("x", padding) + `"}`
+	}
+	return document
+}
+
+// page returns a page of count documents of the shape, and the serialized size of those documents, which is what the pipeline returns as items.
+func (s documentShape) page(count int) (string, int) {
+	documents := make([]string, count)
+	size := 0
+	for i := range documents {
+		documents[i] = s.document(i)
+		size += len(documents[i])
+	}
+	return `{"Documents":[` + strings.Join(documents, ",") + `]}`, size
+}
+
+func TestDocumentShape(t *testing.T) {
+	for _, shape := range sizedDocuments {
+		page, size := shape.page(3)
+		var documents struct{ Documents []map[string]any }
+		require.NoError(t, json.Unmarshal([]byte(page), &documents), shape.String())
+		assert.Equal(t, 3*shape.Size, size, shape.String())
+
+		// The properties are found at the shape's depth.
+		properties := documents.Documents[2]
+		for d := 0; d < shape.Depth; d++ {
+			properties = properties["nested"].(map[string]any)
+		}
+		assert.Len(t, properties, shape.Properties, shape.String())
+		assert.Equal(t, float64(2), properties["value"], shape.String())
+	}
+
+	assert.Equal(t, `{"id":"item1","value":1,"payload":""}`, smallDocuments.document(1))
+}
+
+// scenarioProfilingContext is the profiling context of the benchmarks' pipelines, without which their calls into the native engine aren't labeled.
+var scenarioProfilingContext = azcosmoscx.WithProfilingContext(context.Background())
+
+var scenarioProfiles = flag.String("scenario-profiles", "", "write a CPU and a heap profile of each benchmark scenario to this directory")
+
+// profileScenario writes a CPU profile of the benchmark, and a heap profile at its end, to the -scenario-profiles directory, if it's set,
+// named after the benchmark, such as BenchmarkRun_Size=4KB,Depth=1,Properties=8.cpu.pprof. The profiles are of the last run of the benchmark, which has the most iterations.
+// It enables profiling labels, so the samples of the native engine's calls, by pipelines created with scenarioProfilingContext, are labeled with their pipeline and operation.
+// It's called by the benchmarks that don't have sub-benchmarks, since the CPU profile of one can't be started while that of another is.
+func profileScenario(b *testing.B) {
+	if *scenarioProfiles == "" {
+		return
+	}
+	azcosmoscx.EnableProfilingLabels()
+	require.NoError(b, os.MkdirAll(*scenarioProfiles, 0o755))
+	path := filepath.Join(*scenarioProfiles, strings.ReplaceAll(b.Name(), "/", "_"))
+
+	cpu, err := os.Create(path + ".cpu.pprof")
+	require.NoError(b, err)
+	require.NoError(b, pprof.StartCPUProfile(cpu), "-scenario-profiles can't be used with -cpuprofile")
+	b.Cleanup(func() {
+		pprof.StopCPUProfile()
+		assert.NoError(b, cpu.Close())
+
+		heap, err := os.Create(path + ".heap.pprof")
+		if !assert.NoError(b, err) {
+			return
+		}
+		defer heap.Close()
+		runtime.GC()
+		assert.NoError(b, pprof.WriteHeapProfile(heap))
+	})
+}
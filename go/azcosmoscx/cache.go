@@ -0,0 +1,339 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// DefaultCacheMaxEntries is the number of entries a cache holds if [CacheOptions.MaxEntries] isn't set.
+const DefaultCacheMaxEntries = 1024
+
+// CacheOptions configures the caches of an engine created by [NewQueryEngineWithCache].
+type CacheOptions struct {
+	// MaxEntries is the maximum number of entries each cache holds.
+	// When a cache is full, the least recently used entry is evicted to make room for a new one.
+	// If zero or negative, [DefaultCacheMaxEntries] is used.
+	MaxEntries int
+
+	// TTL is how long an entry remains valid after it's added. If zero or negative, entries don't expire.
+	TTL time.Duration
+}
+
+// CacheStats describes the use of a cache.
+type CacheStats struct {
+	// Hits is the number of lookups that found a valid entry.
+	Hits uint64
+
+	// Misses is the number of lookups that didn't find a valid entry.
+	Misses uint64
+
+	// Evictions is the number of entries removed to make room for new entries.
+	Evictions uint64
+
+	// Expirations is the number of entries removed because their TTL elapsed.
+	Expirations uint64
+
+	// Invalidations is the number of entries removed explicitly, such as by [PartitionKeyRangeCache.Invalidate].
+	Invalidations uint64
+
+	// Entries is the number of entries currently in the cache, including any that have expired but haven't been removed yet.
+	Entries int
+}
+
+// ErrNoCache is returned by [CachingQueryEngine.CreateCachedQueryPipeline] if the engine was created without caches.
+var ErrNoCache = errors.New("azcosmoscx: engine was created without caches, use NewQueryEngineWithCache or NewQueryEngineWithOptions with EngineOptions.Cache set")
+
+// CachingQueryEngine is a [queryengine.QueryEngine] that caches the data needed to create query pipelines.
+//
+// Engines returned by [NewQueryEngineWithCache] implement this interface.
+type CachingQueryEngine interface {
+	queryengine.QueryEngine
+
+	// QueryPlanCache returns the engine's cache of query plans.
+	QueryPlanCache() *QueryPlanCache
+
+	// PartitionKeyRangeCache returns the engine's cache of partition key ranges.
+	PartitionKeyRangeCache() *PartitionKeyRangeCache
+
+	// CreateCachedQueryPipeline creates a new query pipeline for the query in the container, using the engine's caches for the query plan and partition key ranges,
+	// and calling fetchPlan or fetchRanges to get them from the gateway if they aren't cached.
+	//
+	// If creating the pipeline, or any call to Run or ProvideData on it, fails with [ErrUnknownPartitionKeyRange], the container's partition key ranges are invalidated,
+	// so that the next pipeline created for the container fetches them again.
+	// If the engine was created without caches, it returns [ErrNoCache].
+	CreateCachedQueryPipeline(container string, query string, fetchPlan func() (string, error), fetchRanges func() (string, error), opts ...PipelineOption) (queryengine.QueryPipeline, error)
+}
+
+// NewQueryEngineWithCache creates a new azcosmoscx query engine with caches configured by the provided options.
+//
+// The engine creates pipelines in the same way as the engine returned by [NewQueryEngine].
+// The caches are opt-in: the SDK, or a wrapper around it, uses them to avoid fetching the same data from the gateway for every query.
+func NewQueryEngineWithCache(options CacheOptions) CachingQueryEngine {
+	return NewQueryEngineWithOptions(EngineOptions{Cache: &options})
+}
+
+// QueryPlanCache caches query plans, keyed by the query text and the container they were generated for.
+//
+// It's safe for concurrent use.
+type QueryPlanCache struct {
+	cache *lruCache[queryPlanKey, string]
+}
+
+type queryPlanKey struct {
+	container string
+	query     string
+}
+
+// NewQueryPlanCache creates an empty query plan cache, configured by the provided options.
+func NewQueryPlanCache(options CacheOptions) *QueryPlanCache {
+	return &QueryPlanCache{newLRUCache[queryPlanKey, string](options)}
+}
+
+// Get returns the cached query plan for the query text in the container, if there is a valid one.
+//
+// The container can be any string that identifies the container, such as its resource ID or link.
+// Query parameters don't affect the plan, so parameterized queries share an entry.
+func (c *QueryPlanCache) Get(container string, query string) (string, bool) {
+	return c.cache.get(queryPlanKey{container, query})
+}
+
+// Put adds the query plan for the query text in the container to the cache, replacing any existing entry.
+func (c *QueryPlanCache) Put(container string, query string, plan string) {
+	c.cache.put(queryPlanKey{container, query}, plan)
+}
+
+// GetOrFetch returns the cached query plan for the query text in the container, calling fetch to get the plan, and caching it, if there isn't a valid one.
+//
+// Concurrent calls for the same query and container share a single call to fetch, and all receive its result.
+// If fetch returns an error, nothing is cached and the error is returned to every caller that was waiting for it.
+// If fetch panics, nothing is cached, the panic continues in the caller that called fetch, and the others receive an error.
+func (c *QueryPlanCache) GetOrFetch(container string, query string, fetch func() (string, error)) (string, error) {
+	return c.cache.getOrFetch(queryPlanKey{container, query}, fetch)
+}
+
+// Remove removes the cached query plan for the query text in the container, if there is one.
+func (c *QueryPlanCache) Remove(container string, query string) {
+	c.cache.remove(queryPlanKey{container, query})
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (c *QueryPlanCache) Stats() CacheStats {
+	return c.cache.stats()
+}
+
+// PartitionKeyRangeCache caches the partition key ranges of containers, as the JSON returned by the gateway, keyed by container.
+//
+// The ranges change when a partition splits or merges, so they should be invalidated when the engine reports [ErrUnknownPartitionKeyRange].
+// It's safe for concurrent use.
+type PartitionKeyRangeCache struct {
+	cache *lruCache[string, string]
+}
+
+// NewPartitionKeyRangeCache creates an empty partition key range cache, configured by the provided options.
+func NewPartitionKeyRangeCache(options CacheOptions) *PartitionKeyRangeCache {
+	return &PartitionKeyRangeCache{newLRUCache[string, string](options)}
+}
+
+// Get returns the cached partition key ranges of the container, if there are valid ones.
+//
+// The container can be any string that identifies the container, such as its resource ID or link.
+func (c *PartitionKeyRangeCache) Get(container string) (string, bool) {
+	return c.cache.get(container)
+}
+
+// Put adds the partition key ranges of the container to the cache, replacing any existing entry.
+func (c *PartitionKeyRangeCache) Put(container string, pkranges string) {
+	c.cache.put(container, pkranges)
+}
+
+// GetOrFetch returns the cached partition key ranges of the container, calling fetch to get the ranges, and caching them, if there aren't valid ones.
+//
+// Concurrent calls for the same container share a single call to fetch, and all receive its result.
+// If fetch returns an error, nothing is cached and the error is returned to every caller that was waiting for it.
+// If fetch panics, nothing is cached, the panic continues in the caller that called fetch, and the others receive an error.
+func (c *PartitionKeyRangeCache) GetOrFetch(container string, fetch func() (string, error)) (string, error) {
+	return c.cache.getOrFetch(container, fetch)
+}
+
+// Invalidate removes the cached partition key ranges of the container, so that the next lookup fetches them again.
+//
+// If the ranges are being fetched when Invalidate is called, the result is returned to the callers waiting for it, but it isn't cached.
+func (c *PartitionKeyRangeCache) Invalidate(container string) {
+	c.cache.remove(container)
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (c *PartitionKeyRangeCache) Stats() CacheStats {
+	return c.cache.stats()
+}
+
+// lruCache is a concurrency-safe map with a maximum size, evicting the least recently used entry when it's full, and an optional TTL for entries.
+type lruCache[K comparable, V any] struct {
+	maxEntries int
+	ttl        time.Duration
+
+	mu       sync.Mutex
+	entries  map[K]*list.Element
+	order    *list.List // Of *lruEntry, the most recently used first.
+	inflight map[K]*lruFetch[V]
+	counters CacheStats
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// lruFetch tracks a call to fetch a value that other callers can wait for.
+type lruFetch[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+
+	// removed is set if the key is removed while the fetch is in progress, so that the (possibly stale) result isn't cached.
+	removed bool
+}
+
+func newLRUCache[K comparable, V any](options CacheOptions) *lruCache[K, V] {
+	maxEntries := options.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	return &lruCache[K, V]{
+		maxEntries: maxEntries,
+		ttl:        max(options.TTL, 0),
+		entries:    make(map[K]*list.Element),
+		order:      list.New(),
+		inflight:   make(map[K]*lruFetch[V]),
+	}
+}
+
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lookupLocked(key)
+}
+
+func (c *lruCache[K, V]) put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.putLocked(key, value)
+}
+
+func (c *lruCache[K, V]) remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := false
+	if element, ok := c.entries[key]; ok {
+		c.removeLocked(element)
+		removed = true
+	}
+	if fetch, ok := c.inflight[key]; ok {
+		fetch.removed = true
+		removed = true
+	}
+	if removed {
+		c.counters.Invalidations++
+	}
+}
+
+func (c *lruCache[K, V]) getOrFetch(key K, fetch func() (V, error)) (V, error) {
+	c.mu.Lock()
+	if value, ok := c.lookupLocked(key); ok {
+		c.mu.Unlock()
+		return value, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &lruFetch[V]{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	defer func() {
+		// If fetch panicked, the callers waiting for it get an error rather than the zero value, nothing is cached, and the panic continues in this caller.
+		r := recover()
+		if r != nil {
+			call.err = fmt.Errorf("azcosmoscx: fetch panicked: %v", r)
+		}
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if call.err == nil && !call.removed {
+			c.putLocked(key, call.value)
+		}
+		c.mu.Unlock()
+		close(call.done)
+		if r != nil {
+			panic(r)
+		}
+	}()
+	call.value, call.err = fetch()
+	return call.value, call.err
+}
+
+func (c *lruCache[K, V]) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.counters
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+func (c *lruCache[K, V]) lookupLocked(key K) (V, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		c.counters.Misses++
+		var zero V
+		return zero, false
+	}
+
+	entry := element.Value.(*lruEntry[K, V])
+	if c.ttl > 0 && !time.Now().Before(entry.expires) {
+		c.removeLocked(element)
+		c.counters.Expirations++
+		c.counters.Misses++
+		var zero V
+		return zero, false
+	}
+
+	c.counters.Hits++
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *lruCache[K, V]) putLocked(key K, value V) {
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry[K, V])
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key, value, expires})
+	for c.order.Len() > c.maxEntries {
+		c.removeLocked(c.order.Back())
+		c.counters.Evictions++
+	}
+}
+
+func (c *lruCache[K, V]) removeLocked(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry[K, V]).key)
+}
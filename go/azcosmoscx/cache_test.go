@@ -0,0 +1,278 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const cachedQuery = "SELECT * FROM c WHERE c.tenant = @tenant"
+
+func TestQueryPlanCacheKeysByContainerAndQuery(t *testing.T) {
+	cache := azcosmoscx.NewQueryPlanCache(azcosmoscx.CacheOptions{})
+	cache.Put("dbs/db/colls/a", cachedQuery, "planA")
+
+	plan, ok := cache.Get("dbs/db/colls/a", cachedQuery)
+	require.True(t, ok)
+	assert.Equal(t, "planA", plan)
+
+	_, ok = cache.Get("dbs/db/colls/b", cachedQuery)
+	assert.False(t, ok)
+	_, ok = cache.Get("dbs/db/colls/a", "SELECT * FROM c")
+	assert.False(t, ok)
+
+	assert.Equal(t, azcosmoscx.CacheStats{Hits: 1, Misses: 2, Entries: 1}, cache.Stats())
+}
+
+func TestQueryPlanCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := azcosmoscx.NewQueryPlanCache(azcosmoscx.CacheOptions{MaxEntries: 2})
+	cache.Put("container", "query1", "plan1")
+	cache.Put("container", "query2", "plan2")
+
+	// Using query1 makes query2 the least recently used entry.
+	_, ok := cache.Get("container", "query1")
+	require.True(t, ok)
+	cache.Put("container", "query3", "plan3")
+
+	_, ok = cache.Get("container", "query2")
+	assert.False(t, ok)
+	plan, ok := cache.Get("container", "query1")
+	assert.True(t, ok)
+	assert.Equal(t, "plan1", plan)
+	plan, ok = cache.Get("container", "query3")
+	assert.True(t, ok)
+	assert.Equal(t, "plan3", plan)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Entries)
+}
+
+func TestQueryPlanCacheExpiresEntries(t *testing.T) {
+	cache := azcosmoscx.NewQueryPlanCache(azcosmoscx.CacheOptions{TTL: 20 * time.Millisecond})
+	cache.Put("container", cachedQuery, "plan")
+
+	_, ok := cache.Get("container", cachedQuery)
+	require.True(t, ok)
+
+	time.Sleep(40 * time.Millisecond)
+	_, ok = cache.Get("container", cachedQuery)
+	assert.False(t, ok)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1), stats.Expirations)
+	assert.Equal(t, 0, stats.Entries)
+
+	// An expired entry is fetched again.
+	fetches := 0
+	plan, err := cache.GetOrFetch("container", cachedQuery, func() (string, error) {
+		fetches++
+		return "refreshed", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "refreshed", plan)
+	assert.Equal(t, 1, fetches)
+}
+
+func TestQueryPlanCacheConcurrentGetOrFetchFetchesOnce(t *testing.T) {
+	cache := azcosmoscx.NewQueryPlanCache(azcosmoscx.CacheOptions{})
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (string, error) {
+		fetches.Add(1)
+		<-release
+		return "plan", nil
+	}
+
+	const callers = 32
+	var started, done sync.WaitGroup
+	plans := make([]string, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			started.Done()
+			plans[i], errs[i] = cache.GetOrFetch("container", cachedQuery, fetch)
+		}()
+	}
+	started.Wait()
+	// Give the callers a chance to find the fetch in progress before it completes.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	done.Wait()
+
+	assert.Equal(t, int32(1), fetches.Load())
+	for i := range callers {
+		require.NoError(t, errs[i])
+		assert.Equal(t, "plan", plans[i])
+	}
+	assert.Equal(t, 1, cache.Stats().Entries)
+}
+
+func TestQueryPlanCacheDoesNotCacheFetchErrors(t *testing.T) {
+	cache := azcosmoscx.NewQueryPlanCache(azcosmoscx.CacheOptions{})
+	fetchErr := errors.New("gateway unavailable")
+
+	_, err := cache.GetOrFetch("container", cachedQuery, func() (string, error) {
+		return "", fetchErr
+	})
+	require.ErrorIs(t, err, fetchErr)
+	assert.Equal(t, 0, cache.Stats().Entries)
+
+	plan, err := cache.GetOrFetch("container", cachedQuery, func() (string, error) {
+		return "plan", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "plan", plan)
+}
+
+func TestQueryPlanCacheDoesNotCachePanickingFetch(t *testing.T) {
+	cache := azcosmoscx.NewQueryPlanCache(azcosmoscx.CacheOptions{})
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+
+	// The caller whose fetch panics sees the panic.
+	panicked := make(chan any)
+	go func() {
+		defer func() { panicked <- recover() }()
+		_, _ = cache.GetOrFetch("container", cachedQuery, func() (string, error) {
+			close(fetching)
+			<-release
+			panic("gateway client crashed")
+		})
+	}()
+
+	// A caller waiting for the same fetch gets an error, rather than an empty plan.
+	<-fetching
+	waited := make(chan error)
+	go func() {
+		plan, err := cache.GetOrFetch("container", cachedQuery, func() (string, error) {
+			return "unexpected", nil
+		})
+		assert.Empty(t, plan)
+		waited <- err
+	}()
+	// Give the waiter a chance to find the fetch in progress before it panics.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, "gateway client crashed", <-panicked)
+	assert.ErrorContains(t, <-waited, "fetch panicked: gateway client crashed")
+	assert.Equal(t, 0, cache.Stats().Entries)
+
+	plan, err := cache.GetOrFetch("container", cachedQuery, func() (string, error) {
+		return "plan", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "plan", plan)
+}
+
+func TestNewQueryEngineWithCache(t *testing.T) {
+	engine := azcosmoscx.NewQueryEngineWithCache(azcosmoscx.CacheOptions{MaxEntries: 8})
+	require.NotNil(t, engine.QueryPlanCache())
+
+	plan, err := engine.QueryPlanCache().GetOrFetch("container", "SELECT * FROM c", func() (string, error) {
+		return `{"partitionedQueryExecutionInfoVersion":1,"queryInfo":{},"queryRanges":[{"min":"","max":"FF","isMinInclusive":true,"isMaxInclusive":false}]}`, nil
+	})
+	require.NoError(t, err)
+
+	pipeline, err := engine.CreateQueryPipeline("SELECT * FROM c", plan, `{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"FF"}]}`)
+	require.NoError(t, err)
+	defer pipeline.Close()
+	assert.Equal(t, "SELECT * FROM c", pipeline.Query())
+}
+
+func TestPartitionKeyRangeCacheInvalidate(t *testing.T) {
+	cache := azcosmoscx.NewPartitionKeyRangeCache(azcosmoscx.CacheOptions{})
+	cache.Put("container", "ranges")
+	cache.Invalidate("container")
+	cache.Invalidate("other") // Invalidating a container that isn't cached does nothing.
+
+	_, ok := cache.Get("container")
+	assert.False(t, ok)
+	assert.Equal(t, azcosmoscx.CacheStats{Misses: 1, Invalidations: 1}, cache.Stats())
+}
+
+func TestPartitionKeyRangeCacheInvalidateDuringFetch(t *testing.T) {
+	cache := azcosmoscx.NewPartitionKeyRangeCache(azcosmoscx.CacheOptions{})
+
+	// Ranges fetched before an invalidation may already be stale, so they're returned to the caller but not cached.
+	ranges, err := cache.GetOrFetch("container", func() (string, error) {
+		cache.Invalidate("container")
+		return "stale", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "stale", ranges)
+
+	_, ok := cache.Get("container")
+	assert.False(t, ok)
+}
+
+func TestCachedQueryPipelineRefreshesRangesAfterSplit(t *testing.T) {
+	const container = "dbs/db/colls/c"
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	staleRanges := `{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"FF"}]}`
+	freshRanges := `{"PartitionKeyRanges":[{"id":"1","minInclusive":"","maxExclusive":"80"},{"id":"2","minInclusive":"80","maxExclusive":"FF"}]}`
+
+	// The gateway has the ranges after partition 0 split, but the cache still has the ranges from before.
+	engine := azcosmoscx.NewQueryEngineWithCache(azcosmoscx.CacheOptions{})
+	engine.PartitionKeyRangeCache().Put(container, staleRanges)
+	planFetches, rangeFetches := 0, 0
+	fetchPlan := func() (string, error) {
+		planFetches++
+		return plan, nil
+	}
+	fetchRanges := func() (string, error) {
+		rangeFetches++
+		return freshRanges, nil
+	}
+
+	pipeline, err := engine.CreateCachedQueryPipeline(container, "SELECT * FROM c", fetchPlan, fetchRanges)
+	require.NoError(t, err)
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Requests, 1)
+	assert.Equal(t, "0", result.Requests[0].PartitionKeyRangeID)
+
+	// The response comes from one of the child ranges, which the pipeline doesn't know about.
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResult("1", []byte(`{"Documents":[]}`), "")})
+	require.ErrorIs(t, err, azcosmoscx.ErrUnknownPartitionKeyRange)
+	pipeline.Close()
+
+	_, ok := engine.PartitionKeyRangeCache().Get(container)
+	assert.False(t, ok, "stale ranges should have been invalidated")
+
+	pipeline, err = engine.CreateCachedQueryPipeline(container, "SELECT * FROM c", fetchPlan, fetchRanges)
+	require.NoError(t, err)
+	defer pipeline.Close()
+	result, err = pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Requests, 1)
+	assert.Equal(t, "1", result.Requests[0].PartitionKeyRangeID)
+	require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResult("1", []byte(`{"Documents":[]}`), "")}))
+
+	assert.Equal(t, 1, planFetches, "the plan should only have been fetched once")
+	assert.Equal(t, 1, rangeFetches, "the ranges should only have been fetched after they were invalidated")
+	stats := engine.PartitionKeyRangeCache().Stats()
+	assert.Equal(t, uint64(1), stats.Invalidations)
+	assert.Equal(t, 1, stats.Entries)
+}
+
+func TestCreateCachedQueryPipelineRequiresCaches(t *testing.T) {
+	engine := azcosmoscx.NewQueryEngine().(azcosmoscx.CachingQueryEngine)
+	_, err := engine.CreateCachedQueryPipeline("container", "SELECT * FROM c", nil, nil)
+	require.ErrorIs(t, err, azcosmoscx.ErrNoCache)
+}
@@ -0,0 +1,217 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// CaptureDirEnvVar is the environment variable that enables capture, for pipelines that aren't created with [WithCaptureDir] or an engine whose [EngineOptions] set CaptureDir.
+// It's read each time a pipeline is created.
+const CaptureDirEnvVar = "AZCOSMOSCX_CAPTURE_DIR"
+
+// WithCaptureDir captures everything the pipeline is given and produces into a new subdirectory of dir, for diagnosing incorrect results.
+//
+// Capture is disabled by default, and by an empty dir. Each pipeline writes to its own subdirectory, named "pipeline-<time>-<random>", containing:
+//
+//   - pipeline.json, holding the query and the options the pipeline was created with.
+//   - plan.json and pkranges.json, holding the query plan and partition key ranges exactly as they were provided.
+//   - A numbered file for each call to ProvideData or ProvideEncodedData ("0001-provide.json"), holding each page's partition key range ID, continuation, and body.
+//   - A numbered file for each call to Run or RunInto ("0002-run.json"), holding the items and requests it returned.
+//
+// The files are numbered in the order of the calls. Errors are recorded along with the call that returned them.
+// The captured data includes the query results, so it may be sensitive.
+//
+// If the subdirectory can't be created, creating the pipeline fails. If a file can't be written later, capture stops, but the pipeline continues to work.
+func WithCaptureDir(dir string) PipelineOption {
+	return func(o *pipelineOptions) error {
+		o.captureDir = &dir
+		return nil
+	}
+}
+
+// capturedPipeline is the contents of pipeline.json.
+type capturedPipeline struct {
+	Query                   string          `json:"query"`
+	PartitionKey            *string         `json:"partitionKey,omitempty"`
+	PartitionKeyDefinition  json.RawMessage `json:"partitionKeyDefinition,omitempty"`
+	EffectivePartitionKey   *string         `json:"effectivePartitionKey,omitempty"`
+	MaxConcurrentPartitions *uint32         `json:"maxConcurrentPartitions,omitempty"`
+	TargetBatchSize         *uint32         `json:"targetBatchSize,omitempty"`
+	MaxBufferedItems        *uint32         `json:"maxBufferedItems,omitempty"`
+}
+
+// capturedProvide is the contents of a "provide" file.
+type capturedProvide struct {
+	Pages []capturedPage `json:"pages"`
+	Error string         `json:"error,omitempty"`
+}
+
+// capturedPage is a query result provided to the pipeline.
+// Bodies without an encoding are stored as a string, in Data, and others are stored as bytes, in EncodedData.
+type capturedPage struct {
+	RequestID           uint64          `json:"requestId,omitempty"`
+	PartitionKeyRangeID string          `json:"pkrangeId"`
+	Continuation        string          `json:"continuation,omitempty"`
+	ContentEncoding     ContentEncoding `json:"contentEncoding,omitempty"`
+	Data                string          `json:"data,omitempty"`
+	EncodedData         []byte          `json:"encodedData,omitempty"`
+}
+
+// capturedRun is the contents of a "run" file.
+type capturedRun struct {
+	Items     []string          `json:"items"`
+	Completed bool              `json:"completed,omitempty"`
+	Requests  []capturedRequest `json:"requests"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type capturedRequest struct {
+	ID                  uint64 `json:"id"`
+	PartitionKeyRangeID string `json:"pkrangeId"`
+	Continuation        string `json:"continuation,omitempty"`
+	Query               string `json:"query,omitempty"`
+	IncludeParameters   bool   `json:"includeParameters,omitempty"`
+}
+
+// capture writes a pipeline's inputs and outputs to its capture directory.
+type capture struct {
+	dir      string
+	sequence int
+
+	// failed is set once a file can't be written, after which nothing more is captured.
+	failed bool
+}
+
+// newCapture creates a capture subdirectory for a pipeline in dir, and writes the files describing how the pipeline was created.
+func newCapture(dir string, query string, plan string, pkranges string, options *pipelineOptions) (*capture, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	subdir, err := os.MkdirTemp(dir, "pipeline-"+time.Now().UTC().Format("20060102T150405")+"-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+
+	pipeline := capturedPipeline{
+		Query:                   query,
+		PartitionKey:            options.partitionKey,
+		EffectivePartitionKey:   options.effectivePartitionKey,
+		MaxConcurrentPartitions: options.maxConcurrentPartitions,
+		TargetBatchSize:         options.targetBatchSize,
+		MaxBufferedItems:        options.maxBufferedItems,
+	}
+	if options.partitionKey != nil {
+		pipeline.PartitionKeyDefinition = json.RawMessage(options.partitionKeyDefinition)
+	}
+
+	c := &capture{dir: subdir}
+	for name, write := range map[string]func() ([]byte, error){
+		"pipeline.json": func() ([]byte, error) { return json.MarshalIndent(pipeline, "", "  ") },
+		"plan.json":     func() ([]byte, error) { return []byte(plan), nil },
+		"pkranges.json": func() ([]byte, error) { return []byte(pkranges), nil },
+	} {
+		data, err := write()
+		if err == nil {
+			err = os.WriteFile(filepath.Join(subdir, name), data, 0o644)
+		}
+		if err != nil {
+			os.RemoveAll(subdir)
+			return nil, fmt.Errorf("failed to write capture file %s: %w", name, err)
+		}
+	}
+	return c, nil
+}
+
+// resolveCaptureDir returns the directory to capture the pipeline into, from the options or the environment, or "" if capture is disabled.
+func (o *pipelineOptions) resolveCaptureDir() string {
+	if o.captureDir != nil {
+		return *o.captureDir
+	}
+	return os.Getenv(CaptureDirEnvVar)
+}
+
+// provide records a call to ProvideData or ProvideEncodedData.
+func (c *capture) provide(count int, result func(i int) (queryengine.QueryResult, ContentEncoding), err error) {
+	provided := capturedProvide{Pages: make([]capturedPage, 0, count), Error: errorString(err)}
+	for i := 0; i < count; i++ {
+		result, encoding := result(i)
+		page := capturedPage{
+			RequestID:           result.RequestId,
+			PartitionKeyRangeID: result.PartitionKeyRangeID,
+			Continuation:        result.NextContinuation,
+		}
+		switch strings.ToLower(strings.TrimSpace(string(encoding))) {
+		case "", "identity":
+			page.Data = string(result.Data)
+		default:
+			page.ContentEncoding = encoding
+			page.EncodedData = result.Data
+		}
+		provided.Pages = append(provided.Pages, page)
+	}
+	c.write("provide", provided)
+}
+
+// run records a call to Run or RunInto, of a pipeline whose rewritten query is query.
+func (c *capture) run(result *queryengine.PipelineResult, query string, err error) {
+	run := capturedRun{Items: []string{}, Requests: []capturedRequest{}, Error: errorString(err)}
+	if result != nil {
+		run.Completed = result.IsCompleted
+		for _, item := range result.Items {
+			run.Items = append(run.Items, string(item))
+		}
+		run.Requests = newCapturedRequests(result.Requests, query)
+	}
+	c.write("run", run)
+}
+
+// newCapturedRequests converts a turn's requests for a capture.
+// Only the queries the engine rewrote for a request are captured, leaving out those that are the pipeline's rewritten query.
+func newCapturedRequests(requests []queryengine.QueryRequest, query string) []capturedRequest {
+	captured := make([]capturedRequest, 0, len(requests))
+	for _, request := range requests {
+		requestQuery := request.Query
+		if requestQuery == query {
+			requestQuery = ""
+		}
+		captured = append(captured, capturedRequest{
+			ID:                  request.Id,
+			PartitionKeyRangeID: request.PartitionKeyRangeID,
+			Continuation:        request.Continuation,
+			Query:               requestQuery,
+			IncludeParameters:   request.IncludeParameters,
+		})
+	}
+	return captured
+}
+
+// write writes the next numbered file, or stops capturing if it can't.
+func (c *capture) write(kind string, value any) {
+	if c.failed {
+		return
+	}
+	c.sequence++
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(c.dir, fmt.Sprintf("%04d-%s.json", c.sequence, kind)), data, 0o644)
+	}
+	if err != nil {
+		c.failed = true
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,155 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureSubdir returns the only pipeline subdirectory of a capture directory.
+func captureSubdir(t *testing.T, dir string) string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.True(t, entries[0].IsDir())
+	assert.Regexp(t, `^pipeline-\d{8}T\d{6}-\d+$`, entries[0].Name())
+	return filepath.Join(dir, entries[0].Name())
+}
+
+func readCaptureFile(t *testing.T, dir string, name string, value any) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, value))
+}
+
+func TestCaptureRecordsScriptedRun(t *testing.T) {
+	t.Setenv(azcosmoscx.CaptureDirEnvVar, "")
+	dir := t.TempDir()
+	partitions := mockPartitions{
+		"partition0": {`[1,2]`, `[3]`},
+		"partition1": {`[4]`},
+	}
+	ranges := newMockPartitionRanges(2)
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, ranges, azcosmoscx.WithCaptureDir(dir), azcosmoscx.WithTargetBatchSize(10))
+	require.NoError(t, err)
+	defer pipeline.Close()
+	results := runScripted(t, pipeline, partitions)
+
+	// Each turn is followed by a call to ProvideData for each of its requests.
+	expected := []string{"pipeline.json", "pkranges.json", "plan.json"}
+	sequence := 0
+	for _, result := range results {
+		sequence++
+		expected = append(expected, fmt.Sprintf("%04d-run.json", sequence))
+		for range result.Requests {
+			sequence++
+			expected = append(expected, fmt.Sprintf("%04d-provide.json", sequence))
+		}
+	}
+	subdir := captureSubdir(t, dir)
+	entries, err := os.ReadDir(subdir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, expected, names)
+
+	var created map[string]any
+	readCaptureFile(t, subdir, "pipeline.json", &created)
+	assert.Equal(t, map[string]any{"query": "SELECT * FROM c", "targetBatchSize": float64(10)}, created)
+	plan, err := os.ReadFile(filepath.Join(subdir, "plan.json"))
+	require.NoError(t, err)
+	assert.Equal(t, unorderedPlan, string(plan))
+	var pkranges struct {
+		PartitionKeyRanges []azcosmoscx.PartitionKeyRange
+	}
+	readCaptureFile(t, subdir, "pkranges.json", &pkranges)
+	assert.Equal(t, ranges, pkranges.PartitionKeyRanges)
+
+	// The first turn requests the first page of partition0, which is provided next.
+	var run map[string]any
+	readCaptureFile(t, subdir, "0001-run.json", &run)
+	assert.Equal(t, []any{}, run["items"])
+	assert.Equal(t, []any{map[string]any{"id": float64(results[0].Requests[0].Id), "pkrangeId": "partition0", "includeParameters": results[0].Requests[0].IncludeParameters}}, run["requests"])
+	var provided map[string]any
+	readCaptureFile(t, subdir, "0002-provide.json", &provided)
+	assert.Equal(t, []any{map[string]any{"pkrangeId": "partition0", "continuation": "1", "data": `{"Documents":[1,2]}`}}, provided["pages"])
+
+	// Every item returned is recorded, in order, and the last turn completes the pipeline.
+	var items []string
+	var last map[string]any
+	for _, name := range expected[3:] {
+		if strings.HasSuffix(name, "-run.json") {
+			readCaptureFile(t, subdir, name, &last)
+			for _, item := range last["items"].([]any) {
+				items = append(items, item.(string))
+			}
+		}
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4"}, items)
+	assert.Equal(t, true, last["completed"])
+}
+
+func TestCaptureRecordsErrors(t *testing.T) {
+	dir := t.TempDir()
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(1), azcosmoscx.WithCaptureDir(dir))
+	require.NoError(t, err)
+	defer pipeline.Close()
+	_, err = pipeline.Run()
+	require.NoError(t, err)
+	require.Error(t, pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,`, "")}))
+
+	var provided map[string]any
+	readCaptureFile(t, captureSubdir(t, dir), "0002-provide.json", &provided)
+	assert.NotEmpty(t, provided["error"])
+	assert.Equal(t, `{"Documents":[1,`, provided["pages"].([]any)[0].(map[string]any)["data"])
+}
+
+func TestCaptureFromEnvironmentAndEngine(t *testing.T) {
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"FF"}]}`
+
+	envDir := t.TempDir()
+	t.Setenv(azcosmoscx.CaptureDirEnvVar, envDir)
+	pipeline, err := azcosmoscx.NewQueryEngine().CreateQueryPipeline("SELECT * FROM c", unorderedPlan, pkranges)
+	require.NoError(t, err)
+	pipeline.Close()
+	captureSubdir(t, envDir)
+
+	// Capture can be disabled for a pipeline even when the environment variable is set.
+	pipeline, err = azcosmoscx.CreateQueryPipeline("SELECT * FROM c", unorderedPlan, pkranges, azcosmoscx.WithCaptureDir(""))
+	require.NoError(t, err)
+	pipeline.Close()
+	captureSubdir(t, envDir)
+
+	// The engine's option takes precedence over the environment variable, and each pipeline has its own subdirectory.
+	engineDir := t.TempDir()
+	engine := azcosmoscx.NewQueryEngineWithOptions(azcosmoscx.EngineOptions{CaptureDir: engineDir})
+	for i := 0; i < 2; i++ {
+		pipeline, err = engine.CreateQueryPipeline("SELECT * FROM c", unorderedPlan, pkranges)
+		require.NoError(t, err)
+		pipeline.Close()
+	}
+	entries, err := os.ReadDir(engineDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	captureSubdir(t, envDir)
+}
+
+func TestCaptureFailsPipelineCreationIfDirectoryCantBeCreated(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	_, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(1), azcosmoscx.WithCaptureDir(file))
+	assert.ErrorContains(t, err, "failed to create capture directory")
+}
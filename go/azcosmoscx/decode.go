@@ -0,0 +1,49 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// maxDecodeSnippetLength is the number of bytes of an item included in the error reported when it can't be decoded.
+const maxDecodeSnippetLength = 64
+
+// DecodeItems decodes each item, such as those returned by a pipeline's Run, from JSON into a T.
+//
+// If an item can't be decoded, the items before it are returned along with an error naming the index of the item and including the start of its JSON.
+// The error wraps the error returned by [json.Unmarshal].
+func DecodeItems[T any](items [][]byte) ([]T, error) {
+	decoded := make([]T, 0, len(items))
+	err := DecodeEach(items, func(item T) error {
+		decoded = append(decoded, item)
+		return nil
+	})
+	return decoded, err
+}
+
+// DecodeEach decodes each item from JSON into a T, and calls fn with it, without collecting the decoded items.
+//
+// It stops at the first item that can't be decoded, returning an error as described in [DecodeItems], or at the first error returned by fn, which is returned as is.
+func DecodeEach[T any](items [][]byte, fn func(T) error) error {
+	for i, item := range items {
+		var value T
+		if err := json.Unmarshal(item, &value); err != nil {
+			return fmt.Errorf("failed to decode item %d (%s): %w", i, decodeSnippet(item), err)
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeSnippet quotes the start of an item, for use in an error message.
+func decodeSnippet(item []byte) string {
+	if len(item) <= maxDecodeSnippetLength {
+		return fmt.Sprintf("%q", item)
+	}
+	return fmt.Sprintf("%q...", item[:maxDecodeSnippetLength])
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type decodedItem struct {
+	ID    string `json:"id"`
+	Value int    `json:"value"`
+}
+
+func TestDecodeItems(t *testing.T) {
+	items := [][]byte{[]byte(`{"id":"1","value":10}`), []byte(`{"id":"2","value":20}`)}
+	decoded, err := azcosmoscx.DecodeItems[decodedItem](items)
+	require.NoError(t, err)
+	assert.Equal(t, []decodedItem{{"1", 10}, {"2", 20}}, decoded)
+
+	decoded, err = azcosmoscx.DecodeItems[decodedItem](nil)
+	require.NoError(t, err)
+	assert.Empty(t, decoded)
+}
+
+func TestDecodeItemsReportsPartialFailure(t *testing.T) {
+	items := [][]byte{
+		[]byte(`{"id":"1","value":10}`),
+		[]byte(`{"id":"2","value":"twenty"}`),
+		[]byte(`{"id":"3","value":30}`),
+	}
+	decoded, err := azcosmoscx.DecodeItems[decodedItem](items)
+	assert.Equal(t, []decodedItem{{"1", 10}}, decoded)
+
+	var typeErr *json.UnmarshalTypeError
+	require.ErrorAs(t, err, &typeErr)
+	assert.Contains(t, err.Error(), "item 1")
+	assert.Contains(t, err.Error(), `"{\"id\":\"2\",\"value\":\"twenty\"}"`)
+}
+
+func TestDecodeItemsTruncatesSnippet(t *testing.T) {
+	long := `{"id":"` + strings.Repeat("x", 100) + `",`
+	_, err := azcosmoscx.DecodeItems[decodedItem]([][]byte{[]byte(long)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "item 0")
+	assert.Contains(t, err.Error(), `"{\"id\":\"`+strings.Repeat("x", 57)+`"...`)
+	assert.NotContains(t, err.Error(), strings.Repeat("x", 58))
+}
+
+func TestDecodeItemsRawMessagePassthrough(t *testing.T) {
+	items := [][]byte{[]byte(`{"id":"1","nested":{"a":[1,2]}}`), []byte(`42`), []byte(`"text"`)}
+	decoded, err := azcosmoscx.DecodeItems[json.RawMessage](items)
+	require.NoError(t, err)
+	require.Len(t, decoded, len(items))
+	for i, item := range items {
+		assert.Equal(t, json.RawMessage(item), decoded[i])
+	}
+}
+
+func TestDecodeEach(t *testing.T) {
+	items := [][]byte{[]byte(`{"id":"1"}`), []byte(`{"id":"2"}`), []byte(`{"id":"3"}`)}
+
+	var ids []string
+	err := azcosmoscx.DecodeEach(items, func(item decodedItem) error {
+		ids = append(ids, item.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+
+	// An error from the callback stops decoding, and is returned as is.
+	stop := errors.New("stop")
+	ids = nil
+	err = azcosmoscx.DecodeEach(items, func(item decodedItem) error {
+		ids = append(ids, item.ID)
+		if item.ID == "2" {
+			return stop
+		}
+		return nil
+	})
+	assert.Same(t, stop, err)
+	assert.Equal(t, []string{"1", "2"}, ids)
+}
+
+func TestDecodeEachStopsAtInvalidItem(t *testing.T) {
+	items := [][]byte{[]byte(`{"id":"1"}`), []byte(`{"id":`), []byte(`{"id":"3"}`)}
+
+	var ids []string
+	err := azcosmoscx.DecodeEach(items, func(item decodedItem) error {
+		ids = append(ids, item.ID)
+		return nil
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "item 1")
+	assert.Equal(t, []string{"1"}, ids)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+// #cgo CFLAGS: -I${SRCDIR}/include
+// #include <cosmoscx.h>
+import "C"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// ContentEncoding identifies how the body of a query response is encoded, using the values of the `Content-Encoding` HTTP header.
+type ContentEncoding string
+
+const (
+	// ContentEncodingIdentity indicates that the body is not encoded.
+	ContentEncodingIdentity ContentEncoding = ""
+
+	// ContentEncodingGzip indicates that the body is compressed with gzip.
+	ContentEncodingGzip ContentEncoding = "gzip"
+
+	// ContentEncodingDeflate indicates that the body is compressed with deflate (either zlib-wrapped, as HTTP specifies, or raw).
+	ContentEncodingDeflate ContentEncoding = "deflate"
+)
+
+// validate returns an error if the engine can't decode bodies with this encoding.
+func (e ContentEncoding) validate() error {
+	switch strings.ToLower(strings.TrimSpace(string(e))) {
+	case "", "identity", string(ContentEncodingGzip), string(ContentEncodingDeflate):
+		return nil
+	default:
+		return &Error{
+			code:    C.COSMOS_CX_RESULT_CODE_INVALID_GATEWAY_RESPONSE,
+			message: fmt.Sprintf("unsupported content encoding %q, expected %q, %q, or no encoding", string(e), ContentEncodingGzip, ContentEncodingDeflate),
+		}
+	}
+}
+
+// EncodedQueryResult is a [queryengine.QueryResult] whose Data is encoded, usually compressed, as it was received from the gateway.
+type EncodedQueryResult struct {
+	queryengine.QueryResult
+
+	// ContentEncoding is the encoding of Data, as reported by the `Content-Encoding` header of the response.
+	ContentEncoding ContentEncoding
+}
+
+// EncodedDataProvider is implemented by query pipelines that can decode compressed query responses themselves.
+//
+// Pipelines returned by this package implement this interface.
+type EncodedDataProvider interface {
+	// ProvideEncodedData is equivalent to ProvideData, but the engine decodes the Data of each result according to its ContentEncoding before applying it.
+	//
+	// This avoids decompressing the body in Go and then copying the decompressed body into the engine.
+	// If any result has an unsupported encoding, an error is returned and none of the results are applied.
+	// If a body is corrupt or truncated, an error is returned and that result, and any after it, are not applied.
+	ProvideEncodedData(results []EncodedQueryResult) error
+}
+
+var _ EncodedDataProvider = (*clientEngineQueryPipeline)(nil)
+
+// ProvideEncodedData provides more data, with bodies that may be compressed, in response to DataRequests.
+func (p *clientEngineQueryPipeline) ProvideEncodedData(results []EncodedQueryResult) error {
+	bytes := 0
+	for _, result := range results {
+		if err := result.ContentEncoding.validate(); err != nil {
+			return err
+		}
+		bytes += len(result.Data)
+	}
+
+	start := time.Now()
+	var err error
+	p.labels.do("provideData", func() { err = p.pipeline.ProvideEncodedData(results) })
+	p.counters.recordProvideData(len(results), bytes, time.Since(start))
+	if p.capture != nil {
+		p.capture.provide(len(results), func(i int) (queryengine.QueryResult, ContentEncoding) {
+			return results[i].QueryResult, results[i].ContentEncoding
+		}, err)
+	}
+	return p.checkErr(err)
+}
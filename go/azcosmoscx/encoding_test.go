@@ -0,0 +1,156 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t testing.TB, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zlibBytes(t testing.TB, data string) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func encodedResult(data []byte, encoding azcosmoscx.ContentEncoding) azcosmoscx.EncodedQueryResult {
+	return azcosmoscx.EncodedQueryResult{
+		QueryResult:     queryengine.NewQueryResult("partition0", data, ""),
+		ContentEncoding: encoding,
+	}
+}
+
+func TestProvideEncodedData(t *testing.T) {
+	payload := `{"Documents":[{"id":"1"},{"id":"2"}]}`
+	cases := []struct {
+		name     string
+		data     []byte
+		encoding azcosmoscx.ContentEncoding
+	}{
+		{"Identity", []byte(payload), azcosmoscx.ContentEncodingIdentity},
+		{"Gzip", gzipBytes(t, payload), azcosmoscx.ContentEncodingGzip},
+		{"GzipUpperCase", gzipBytes(t, payload), "GZIP"},
+		{"Deflate", zlibBytes(t, payload), azcosmoscx.ContentEncodingDeflate},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pipeline := newSinglePartitionPipeline(t)
+			defer pipeline.Close()
+			requireInitialRequest(t, pipeline)
+
+			err := pipeline.(azcosmoscx.EncodedDataProvider).ProvideEncodedData([]azcosmoscx.EncodedQueryResult{encodedResult(c.data, c.encoding)})
+			require.NoError(t, err)
+
+			result, err := pipeline.Run()
+			require.NoError(t, err)
+			assert.Equal(t, [][]byte{[]byte(`{"id":"1"}`), []byte(`{"id":"2"}`)}, result.Items)
+			assert.True(t, result.IsCompleted)
+		})
+	}
+}
+
+func TestProvideEncodedDataRejectsTruncatedStream(t *testing.T) {
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+	requireInitialRequest(t, pipeline)
+
+	compressed := gzipBytes(t, `{"Documents":[{"id":"1"},{"id":"2"}]}`)
+	err := pipeline.(azcosmoscx.EncodedDataProvider).ProvideEncodedData([]azcosmoscx.EncodedQueryResult{encodedResult(compressed[:len(compressed)/2], azcosmoscx.ContentEncodingGzip)})
+	var engineErr *azcosmoscx.Error
+	require.ErrorAs(t, err, &engineErr)
+	assert.Equal(t, "invalid response from gateway", engineErr.Error())
+
+	// The pipeline should be unchanged, so the request can be retried.
+	requireInitialRequest(t, pipeline)
+}
+
+func TestProvideEncodedDataRejectsUnsupportedEncoding(t *testing.T) {
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+	requireInitialRequest(t, pipeline)
+
+	err := pipeline.(azcosmoscx.EncodedDataProvider).ProvideEncodedData([]azcosmoscx.EncodedQueryResult{encodedResult([]byte(`{"Documents":[]}`), "br")})
+	var engineErr *azcosmoscx.Error
+	require.ErrorAs(t, err, &engineErr)
+	assert.Contains(t, engineErr.Error(), `unsupported content encoding "br"`)
+	requireInitialRequest(t, pipeline)
+}
+
+// benchmarkPage returns a page of items totalling roughly 1MB.
+func benchmarkPage() string {
+	documents := make([]string, 0, 4096)
+	size := 0
+	for i := 0; size < 1024*1024; i++ {
+		document := fmt.Sprintf(`{"id":"item%d","value":%d,"description":"%s"}`, i, i, strings.Repeat("lorem ipsum ", 16))
+		documents = append(documents, document)
+		size += len(document)
+	}
+	return `{"Documents":[` + strings.Join(documents, ",") + `]}`
+}
+
+// benchmarkCompressedPages provides a gzipped page of roughly 1MB to a single-partition pipeline and runs a turn, once per iteration, using the provided function to provide the page.
+func benchmarkCompressedPages(b *testing.B, provide func(pipeline queryengine.QueryPipeline, compressed []byte) error) {
+	profileScenario(b)
+	page := benchmarkPage()
+	compressed := gzipBytes(b, page)
+
+	pipeline := newSinglePartitionPipeline(b)
+	defer pipeline.Close()
+
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		require.NoError(b, provide(pipeline, compressed))
+		result, err := pipeline.Run()
+		require.NoError(b, err)
+		require.NotEmpty(b, result.Items)
+	}
+}
+
+func BenchmarkProvideGzipDecodedInGo(b *testing.B) {
+	benchmarkCompressedPages(b, func(pipeline queryengine.QueryPipeline, compressed []byte) error {
+		r, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResult("partition0", data, "next")})
+	})
+}
+
+func BenchmarkProvideGzipDecodedNatively(b *testing.B) {
+	benchmarkCompressedPages(b, func(pipeline queryengine.QueryPipeline, compressed []byte) error {
+		return pipeline.(azcosmoscx.EncodedDataProvider).ProvideEncodedData([]azcosmoscx.EncodedQueryResult{{
+			QueryResult:     queryengine.NewQueryResult("partition0", compressed, "next"),
+			ContentEncoding: azcosmoscx.ContentEncodingGzip,
+		}})
+	})
+}
@@ -10,6 +10,16 @@ package azcosmoscx
 import "C"
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
 )
 
@@ -17,13 +27,40 @@ func Version() string {
 	return C.GoString(C.cosmoscx_version())
 }
 
+var enableTracingOnce sync.Once
+
 // EnableTracing enables Cosmos Client Engine tracing.
-// Once enabled, tracing cannot be disabled (for now). Tracing is controlled by setting the COSMOSCX_LOG environment variable, using the syntax of the `RUST_LOG` (https://docs.rs/env_logger/latest/env_logger/#enabling-logging) env var.
+// Once enabled, tracing cannot be disabled (for now). Tracing is controlled by setting the COSMOSCX_LOG environment variable, using the syntax of the `RUST_LOG` (https://docs.rs/env_logger/latest/env_logger/#enabling-logging) env var,
+// or by calling [SetTraceFilter].
+// It's safe to call this more than once, and from several goroutines at once; tracing is only initialized by the first call, and later calls don't change its filter.
 func EnableTracing() {
-	C.cosmoscx_v0_tracing_enable()
+	enableTracingOnce.Do(func() {
+		C.cosmoscx_v0_tracing_enable()
+	})
+}
+
+// SetTraceFilter replaces the filter that selects which of the engine's traces are written, enabling tracing first if it isn't already.
+// The filter uses the syntax of the COSMOSCX_LOG environment variable, such as "debug" or "azure_data_cosmos_engine=trace", and replaces the one read from it.
+// It can be called any number of times, from any goroutine, to adjust the verbosity of tracing while pipelines are running.
+// If the filter can't be parsed, the error matches [ErrDeserialization] and the filter isn't changed.
+func SetTraceFilter(filter string) error {
+	// The engine's description of an error is stored per-thread, so stay on this thread until we've retrieved it.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if code := C.cosmoscx_v0_tracing_set_filter(makeStr(filter)); code != C.COSMOS_CX_RESULT_CODE_SUCCESS {
+		return &Error{code: code, message: lastErrorMessage()}
+	}
+	return nil
 }
 
 type nativeQueryEngine struct {
+	planCache        *QueryPlanCache
+	pkrangeCache     *PartitionKeyRangeCache
+	onTurn           func(TurnInfo)
+	captureDir       string
+	targetBatchSize  int
+	maxBufferedItems int
+	profilingContext context.Context
 }
 
 // NewQueryEngine creates a new azcosmoscx query engine.
@@ -31,38 +68,349 @@ func NewQueryEngine() queryengine.QueryEngine {
 	return &nativeQueryEngine{}
 }
 
+// EngineOptions configures an engine created by [NewQueryEngineWithOptions].
+type EngineOptions struct {
+	// Cache, if set, enables the engine's caches, as in [NewQueryEngineWithCache].
+	Cache *CacheOptions
+
+	// OnTurn, if set, is called after every turn of every pipeline the engine creates, as if each pipeline was created with [WithOnTurn].
+	// It's useful when the pipelines are created by the SDK, which doesn't accept pipeline options.
+	// It may be called from several goroutines at once, if the engine's pipelines are used concurrently.
+	OnTurn func(TurnInfo)
+
+	// CaptureDir, if set, captures the inputs and outputs of every pipeline the engine creates into subdirectories of it, as if each pipeline was created with [WithCaptureDir].
+	CaptureDir string
+
+	// TargetBatchSize, if not zero, is the target batch size of every pipeline the engine creates, as if each pipeline was created with [WithTargetBatchSize].
+	// When the SDK runs the query, each page it returns holds the items of one call to Run, so this limits the items in each page.
+	TargetBatchSize int
+
+	// MaxBufferedItems, if not zero, is the most items every pipeline the engine creates may buffer, as if each pipeline was created with [WithMaxBufferedItems].
+	MaxBufferedItems int
+
+	// ProfilingContext, if set, is the context whose pprof labels are kept on the native calls of every pipeline the engine creates, as if each pipeline was created with [WithProfilingContext].
+	ProfilingContext context.Context
+}
+
+// NewQueryEngineWithOptions creates a new azcosmoscx query engine configured by the provided options.
+//
+// With the zero value of [EngineOptions], the engine behaves like the engine returned by [NewQueryEngine].
+func NewQueryEngineWithOptions(options EngineOptions) CachingQueryEngine {
+	engine := &nativeQueryEngine{onTurn: options.OnTurn, captureDir: options.CaptureDir, targetBatchSize: options.TargetBatchSize, maxBufferedItems: options.MaxBufferedItems, profilingContext: options.ProfilingContext}
+	if options.Cache != nil {
+		engine.planCache = NewQueryPlanCache(*options.Cache)
+		engine.pkrangeCache = NewPartitionKeyRangeCache(*options.Cache)
+	}
+	return engine
+}
+
 // CreateQueryPipeline creates a new query pipeline from the provided plan and partition key ranges.
 func (e *nativeQueryEngine) CreateQueryPipeline(query string, plan string, pkranges string) (queryengine.QueryPipeline, error) {
-	pipeline, err := newPipeline(query, plan, pkranges)
+	return CreateQueryPipeline(query, plan, pkranges, e.pipelineOptions()...)
+}
+
+// pipelineOptions returns the options the engine applies to every pipeline it creates, before any options passed by the caller.
+func (e *nativeQueryEngine) pipelineOptions(opts ...PipelineOption) []PipelineOption {
+	var engineOpts []PipelineOption
+	if e.onTurn != nil {
+		engineOpts = append(engineOpts, WithOnTurn(e.onTurn))
+	}
+	if e.captureDir != "" {
+		engineOpts = append(engineOpts, WithCaptureDir(e.captureDir))
+	}
+	if e.targetBatchSize != 0 {
+		engineOpts = append(engineOpts, WithTargetBatchSize(e.targetBatchSize))
+	}
+	if e.maxBufferedItems != 0 {
+		engineOpts = append(engineOpts, WithMaxBufferedItems(e.maxBufferedItems))
+	}
+	if e.profilingContext != nil {
+		engineOpts = append(engineOpts, WithProfilingContext(e.profilingContext))
+	}
+	return append(engineOpts, opts...)
+}
+
+// PipelineOption configures a query pipeline created by [CreateQueryPipeline].
+type PipelineOption func(*pipelineOptions) error
+
+type pipelineOptions struct {
+	partitionKey            *string
+	partitionKeyDefinition  string
+	effectivePartitionKey   *string
+	maxConcurrentPartitions *uint32
+	targetBatchSize         *uint32
+	maxBufferedItems        *uint32
+	onTurn                  func(TurnInfo)
+	captureDir              *string
+	profilingContext        context.Context
+}
+
+// WithPartitionKey scopes the pipeline to a single partition key value.
+//
+// The partitionKey is a JSON array with one value per path in the partition key definition, for example `["tenant1"]`.
+// The engine computes the effective partition key (EPK) using the definition, and all requests target the partition key range that owns it.
+// Only single-path hash partitioning (version 1 or 2) is currently supported.
+func WithPartitionKey(partitionKey string, definition azcosmos.PartitionKeyDefinition) PipelineOption {
+	return func(o *pipelineOptions) error {
+		encoded, err := json.Marshal(definition)
+		if err != nil {
+			return err
+		}
+		o.partitionKey = &partitionKey
+		o.partitionKeyDefinition = string(encoded)
+		o.effectivePartitionKey = nil
+		return nil
+	}
+}
+
+// WithEffectivePartitionKey scopes the pipeline to a single, already hashed, effective partition key (EPK).
+//
+// All requests target the partition key range that owns the EPK.
+func WithEffectivePartitionKey(epk string) PipelineOption {
+	return func(o *pipelineOptions) error {
+		o.effectivePartitionKey = &epk
+		o.partitionKey = nil
+		return nil
+	}
+}
+
+// WithMaxConcurrentPartitions sets the maximum number of partitions that the pipeline requests data for in a single turn, or 0 for no limit.
+//
+// Queries without an ORDER BY return items from one partition at a time, in partition key range order, and by default only request data for that partition.
+// Raising this limit lets the pipeline request data for the partitions that follow while the current one is drained, so that they can be fetched in parallel.
+// Items are still returned in the same order, but the items for the partitions that follow are buffered until the current one is exhausted.
+// Other queries already request data for every partition in each turn, so this has no effect on them.
+func WithMaxConcurrentPartitions(max int) PipelineOption {
+	return func(o *pipelineOptions) error {
+		if max < 0 || max > math.MaxUint32 {
+			return fmt.Errorf("max concurrent partitions must be between 0 and %d, but was %d", uint32(math.MaxUint32), max)
+		}
+		value := uint32(max)
+		o.maxConcurrentPartitions = &value
+		return nil
+	}
+}
+
+// WithTargetBatchSize sets the number of items the consumer wants from each call to Run, or 0 if it has no preference.
+//
+// This is a hint, used to keep the data the pipeline fetches and buffers proportional to the consumer's demand, rather than a hard page size.
+// Each call to Run returns at most this many items, leaving the rest buffered for the next call.
+// Queries that can stream results only request the data needed to return the next item,
+// and only prefetch more while the items buffered (and expected from the requests being made) fall short of the target.
+// Queries that have to fetch all the data before returning any items still request data for every partition.
+func WithTargetBatchSize(target int) PipelineOption {
+	return func(o *pipelineOptions) error {
+		if target < 0 || target > math.MaxUint32 {
+			return fmt.Errorf("target batch size must be between 0 and %d, but was %d", uint32(math.MaxUint32), target)
+		}
+		value := uint32(target)
+		o.targetBatchSize = &value
+		return nil
+	}
+}
+
+// WithMaxBufferedItems sets the maximum number of items the pipeline may buffer while it waits for every partition to be drained, or 0 for no limit.
+//
+// Queries that have to fetch all the data before returning any items, such as ORDER BY queries on a vector distance, buffer every item from every partition
+// (or, if the query uses TOP or OFFSET/LIMIT, only as many as it can return). If more items than this would be buffered, ProvideData fails with
+// an error matching [ErrBufferLimitExceeded], rather than the process running out of memory. Queries that stream their results aren't affected.
+func WithMaxBufferedItems(max int) PipelineOption {
+	return func(o *pipelineOptions) error {
+		if max < 0 || max > math.MaxUint32 {
+			return fmt.Errorf("max buffered items must be between 0 and %d, but was %d", uint32(math.MaxUint32), max)
+		}
+		value := uint32(max)
+		o.maxBufferedItems = &value
+		return nil
+	}
+}
+
+// CreateQueryPipeline creates a new query pipeline from the provided plan and partition key ranges, applying the provided options.
+//
+// Without any options, this is equivalent to calling CreateQueryPipeline on the engine returned by [NewQueryEngine].
+func CreateQueryPipeline(query string, plan string, pkranges string, opts ...PipelineOption) (queryengine.QueryPipeline, error) {
+	var options pipelineOptions
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return nil, err
+		}
+	}
+
+	var pipeline *Pipeline
+	var err error
+	switch {
+	case options.partitionKey != nil:
+		pipeline, err = newPipelineForPartitionKey(query, plan, pkranges, *options.partitionKey, options.partitionKeyDefinition)
+	case options.effectivePartitionKey != nil:
+		pipeline, err = newPipelineForEffectivePartitionKey(query, plan, pkranges, *options.effectivePartitionKey)
+	default:
+		pipeline, err = newPipeline(query, plan, pkranges)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	query, err = pipeline.Query()
+	if options.maxConcurrentPartitions != nil {
+		if err := pipeline.SetMaxConcurrentPartitions(*options.maxConcurrentPartitions); err != nil {
+			pipeline.Free()
+			return nil, err
+		}
+	}
+
+	if options.targetBatchSize != nil {
+		if err := pipeline.SetTargetBatchSize(*options.targetBatchSize); err != nil {
+			pipeline.Free()
+			return nil, err
+		}
+	}
+
+	if options.maxBufferedItems != nil {
+		if err := pipeline.SetMaxBufferedItems(*options.maxBufferedItems); err != nil {
+			pipeline.Free()
+			return nil, err
+		}
+	}
+
+	rewrittenQuery, err := pipeline.Query()
 	if err != nil {
 		// The only expected error here is if the pipeline is null. Still, we should report it.
 		pipeline.Free()
 		return nil, err
 	}
-	return &clientEngineQueryPipeline{pipeline, query, false}, nil
+
+	// Capture the query as it was provided, rather than the rewritten query, so that the capture can recreate the pipeline.
+	// The capture is only created once nothing else can fail, so that a failed pipeline doesn't leave a partial capture behind.
+	var capture *capture
+	if dir := options.resolveCaptureDir(); dir != "" {
+		capture, err = newCapture(dir, query, plan, pkranges, &options)
+		if err != nil {
+			pipeline.Free()
+			return nil, err
+		}
+	}
+	query = rewrittenQuery
+	id := totalPipelines.Add(1)
+	return &clientEngineQueryPipeline{pipeline: pipeline, query: query, onTurn: options.onTurn, capture: capture, labels: newPipelineLabels(options.profilingContext, query, id)}, nil
 }
 
 func (e *nativeQueryEngine) SupportedFeatures() string {
-	return C.GoString(C.cosmoscx_v0_query_supported_features())
+	return SupportedFeatures()
 }
 
+// QueryPlanCache returns the engine's cache of query plans, or nil if the engine was created without caches.
+func (e *nativeQueryEngine) QueryPlanCache() *QueryPlanCache {
+	return e.planCache
+}
+
+// PartitionKeyRangeCache returns the engine's cache of partition key ranges, or nil if the engine was created without caches.
+func (e *nativeQueryEngine) PartitionKeyRangeCache() *PartitionKeyRangeCache {
+	return e.pkrangeCache
+}
+
+// CreateCachedQueryPipeline creates a new query pipeline for the query in the container, using the engine's caches for the query plan and partition key ranges.
+func (e *nativeQueryEngine) CreateCachedQueryPipeline(container string, query string, fetchPlan func() (string, error), fetchRanges func() (string, error), opts ...PipelineOption) (queryengine.QueryPipeline, error) {
+	if e.planCache == nil || e.pkrangeCache == nil {
+		return nil, ErrNoCache
+	}
+
+	plan, err := e.planCache.GetOrFetch(container, query, fetchPlan)
+	if err != nil {
+		return nil, err
+	}
+	pkranges, err := e.pkrangeCache.GetOrFetch(container, fetchRanges)
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateRanges := func() {
+		e.pkrangeCache.Invalidate(container)
+	}
+	pipeline, err := CreateQueryPipeline(query, plan, pkranges, e.pipelineOptions(opts...)...)
+	if err != nil {
+		if errors.Is(err, ErrUnknownPartitionKeyRange) {
+			invalidateRanges()
+		}
+		return nil, err
+	}
+	pipeline.(*clientEngineQueryPipeline).onUnknownPartitionKeyRange = invalidateRanges
+	return pipeline, nil
+}
+
+// DrainablePipeline is a [queryengine.QueryPipeline] that can stop fetching data while still producing the items it has already buffered.
+//
+// Pipelines returned by this package implement this interface.
+type DrainablePipeline interface {
+	queryengine.QueryPipeline
+
+	// Drain stops the pipeline from fetching any more data.
+	//
+	// This is useful when the application no longer needs more results (for example, because it applies its own limit), but wants to consume what's already been fetched.
+	// After Drain is called, Run never returns requests, and the pipeline completes once the buffered items have been returned.
+	// Responses to requests that were already in flight may still be provided, and their items are returned too.
+	//
+	// Ordered queries return every buffered item, in order, treating each partition as if it had no more data.
+	// Queries that aggregate over all results (such as COUNT) return a result computed from the buffered data only.
+	Drain() error
+}
+
+var _ DrainablePipeline = (*clientEngineQueryPipeline)(nil)
+
+// ExplainablePipeline is a [queryengine.QueryPipeline] that can describe how it was constructed from the query plan.
+//
+// Pipelines returned by this package implement this interface.
+type ExplainablePipeline interface {
+	queryengine.QueryPipeline
+
+	// Explain returns a human-readable description of the pipeline, for debugging.
+	//
+	// It lists the (possibly rewritten) query, the strategy used to merge the results from each partition (such as "Unordered" or "StreamingOrderBy"),
+	// the number of ORDER BY items, the stages applied to the merged results (such as OFFSET, LIMIT, and aggregates), and the partition key ranges the query targets.
+	// The format is intended for people, and may change between versions, so it shouldn't be parsed.
+	Explain() (string, error)
+}
+
+var _ ExplainablePipeline = (*clientEngineQueryPipeline)(nil)
+
 type clientEngineQueryPipeline struct {
 	pipeline  *Pipeline
 	query     string
 	completed bool
+	counters  pipelineCounters
+
+	// onTurn, if set, is called after every turn.
+	onTurn func(TurnInfo)
+
+	// pagesBeforeTurn is the number of pages that had been provided when the last turn ran, to report those provided since in its TurnInfo.
+	pagesBeforeTurn uint64
+
+	// capture, if set, records the pipeline's inputs and outputs.
+	capture *capture
+
+	// labels, if set, are the pprof labels of the pipeline's calls into the native engine.
+	labels *pipelineLabels
+
+	// onUnknownPartitionKeyRange, if set, is called when the engine reports that the partition key ranges the pipeline was created with are out of date.
+	onUnknownPartitionKeyRange func()
+
+	// warnings holds the warnings reported by the most recent turn.
+	warnings []Warning
+
+	// undelivered holds a batch returned by the native pipeline that couldn't be converted, to be delivered by the next turn.
+	undelivered *PipelineResult
 }
 
 // GetRewrittenQuery returns the query text, possibly rewritten by the gateway, which will be used for per-partition queries.
+// Every request the pipeline returns carries the query to execute for it, which is this one unless the engine rewrote it for the request's partition,
+// so consumers should always use the request's query.
 func (p *clientEngineQueryPipeline) Query() string {
 	return p.query
 }
 
 func (p *clientEngineQueryPipeline) Close() {
+	if p.undelivered != nil {
+		p.undelivered.Free()
+		p.undelivered = nil
+	}
 	p.pipeline.Free()
 }
 
@@ -75,41 +423,174 @@ func (p *clientEngineQueryPipeline) IsComplete() bool {
 // The number of items retrieved will be capped by the provided maxPageSize if it is positive.
 // Any remaining items will be returned by the next call to NextBatch.
 func (p *clientEngineQueryPipeline) Run() (*queryengine.PipelineResult, error) {
-	result, err := p.pipeline.NextBatch()
-	defer result.Free()
+	return p.run(nil)
+}
+
+// RunInto is equivalent to Run, but stores the items in the provided buffer instead of allocating new memory for them.
+// The Items of the returned result share memory with the buffer, and are only valid until the buffer is reused or released.
+func (p *clientEngineQueryPipeline) RunInto(buf *ItemBuffer) (*queryengine.PipelineResult, error) {
+	if buf == nil {
+		return nil, &Error{code: C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL, message: "item buffer must not be nil"}
+	}
+	return p.run(buf)
+}
+
+// run executes a turn of the pipeline, copying the items into buf if it's provided, or into newly allocated memory otherwise.
+//
+// The native pipeline considers a batch delivered as soon as it returns it, so if the batch can't be converted, it's kept and delivered again by the next turn,
+// instead of its items being lost.
+func (p *clientEngineQueryPipeline) run(buf *ItemBuffer) (*queryengine.PipelineResult, error) {
+	var converted *queryengine.PipelineResult
+	var native time.Duration
+	var err error
+	p.labels.do("run", func() { converted, native, err = p.runTurn(buf) })
+	items := 0
+	if converted != nil {
+		items = len(converted.Items)
+	}
+	p.counters.recordTurn(items, native)
+	if p.capture != nil {
+		p.capture.run(converted, p.query, err)
+	}
+	if p.onTurn != nil {
+		pages := p.counters.pagesProvided.Load()
+		p.onTurn(newTurnInfo(int(p.counters.turns.Load())-1, converted, int(pages-p.pagesBeforeTurn), native, err))
+		p.pagesBeforeTurn = pages
+	}
+	return converted, err
+}
+
+// runTurn does the work of run, returning the converted result and the time spent in the native engine.
+func (p *clientEngineQueryPipeline) runTurn(buf *ItemBuffer) (*queryengine.PipelineResult, time.Duration, error) {
+	start := time.Now()
+	result := p.undelivered
+	p.undelivered = nil
+	if result == nil {
+		var err error
+		result, err = p.pipeline.NextBatch()
+		if err != nil {
+			p.warnings = nil
+			return nil, time.Since(start), p.checkErr(err)
+		}
+	}
+	native := time.Since(start)
+
+	converted, warnings, err := convertResult(result, buf, p.query)
 	if err != nil {
-		return nil, err
+		// Nothing borrows from the result once the conversion has failed, so it can be freed if the pipeline is abandoned before it's delivered.
+		runtime.SetFinalizer(result, (*PipelineResult).Free)
+		p.undelivered = result
+		p.warnings = nil
+		return nil, native, err
 	}
 
-	p.completed = result.IsCompleted()
+	start = time.Now()
+	result.Free()
+	native += time.Since(start)
+	p.completed = converted.IsCompleted
+	p.warnings = warnings
+	return converted, native, nil
+}
+
+// testHookConvertResult, if set, is called by convertResult after the items are copied, and any error it returns is returned from the conversion.
+// It's only set by tests, to simulate a failure partway through a turn.
+var testHookConvertResult func() error
 
-	items, err := result.ItemsCloned()
+// convertResult copies a native result into Go memory, storing the items in buf if it's provided.
+// Requests without a query of their own are given the pipeline's query, so that consumers can always use the request's query.
+func convertResult(result *PipelineResult, buf *ItemBuffer, query string) (*queryengine.PipelineResult, []Warning, error) {
+	warnings, err := result.Warnings()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	var items [][]byte
+	if buf != nil {
+		sourceItems, err := result.Items()
+		if err != nil {
+			return nil, nil, err
+		}
+		buf.fill(sourceItems)
+		items = buf.Items()
+	} else {
+		items, err = result.ItemsCloned()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if testHookConvertResult != nil {
+		if err := testHookConvertResult(); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	sourceRequests, err := result.Requests()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	requests := make([]queryengine.QueryRequest, 0, len(sourceRequests))
 	for _, request := range sourceRequests {
+		requestQuery := query
+		if q := request.Query(); q.len > 0 {
+			requestQuery = q.CloneString()
+		}
 		requests = append(requests, queryengine.QueryRequest{
 			Id:                  request.Id(),
 			PartitionKeyRangeID: string(request.PartitionKeyRangeID().CloneString()),
 			Continuation:        string(request.Continuation().CloneString()),
-			Query:               string(request.Query().CloneString()),
+			Query:               requestQuery,
 			IncludeParameters:   request.IncludeParameters(),
 		})
 	}
 	return &queryengine.PipelineResult{
-		IsCompleted: p.completed,
+		IsCompleted: result.IsCompleted(),
 		Items:       items,
 		Requests:    requests,
-	}, nil
+	}, warnings, nil
+}
+
+// Explain returns a human-readable description of how the engine constructed the pipeline from the query plan.
+func (p *clientEngineQueryPipeline) Explain() (string, error) {
+	return p.pipeline.Explain()
+}
+
+// Drain stops the pipeline from fetching any more data, so that it only produces the items it has already buffered.
+func (p *clientEngineQueryPipeline) Drain() error {
+	return p.pipeline.Drain()
 }
 
 // ProvideData provides more data for a given partition key range ID, using data retrieved from the server in response to making a DataRequest.
+//
+// If a result can't be applied (for example, because the body is malformed), an error is returned and that result, and any after it, are not applied.
+// The pipeline remains usable, and the next call to Run will request the same data again.
 func (p *clientEngineQueryPipeline) ProvideData(results []queryengine.QueryResult) error {
-	return p.pipeline.ProvideData(results)
+	bytes := 0
+	for _, result := range results {
+		bytes += len(result.Data)
+	}
+
+	start := time.Now()
+	var err error
+	p.labels.do("provideData", func() { err = p.pipeline.ProvideData(results) })
+	p.counters.recordProvideData(len(results), bytes, time.Since(start))
+	if p.capture != nil {
+		p.capture.provide(len(results), func(i int) (queryengine.QueryResult, ContentEncoding) {
+			return results[i], ContentEncodingIdentity
+		}, err)
+	}
+	return p.checkErr(err)
+}
+
+// checkErr notifies onUnknownPartitionKeyRange if err reports an unknown partition key range, and returns err.
+func (p *clientEngineQueryPipeline) checkErr(err error) error {
+	if p.onUnknownPartitionKeyRange != nil && errors.Is(err, ErrUnknownPartitionKeyRange) {
+		p.onUnknownPartitionKeyRange()
+	}
+	return err
+}
+
+// Stats returns a snapshot of the pipeline's counters.
+func (p *clientEngineQueryPipeline) Stats() PipelineStats {
+	return p.counters.snapshot()
 }
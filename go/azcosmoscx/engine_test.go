@@ -4,13 +4,66 @@
 package azcosmoscx_test
 
 import (
+	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestVersion(t *testing.T) {
 	version := azcosmoscx.Version()
 	assert.Regexp(t, `\d+\.\d+\.\d+`, version)
 }
+
+func TestSupportedFeatureSetMatchesSupportedFeatures(t *testing.T) {
+	// If this fails after a feature is added to the native engine, add a matching field to FeatureSet.
+	expected := strings.Split(strings.TrimSuffix(azcosmoscx.SupportedFeatures(), ","), ",")
+	assert.ElementsMatch(t, expected, azcosmoscx.SupportedFeatureSet().Names())
+	assert.Equal(t, azcosmoscx.SupportedFeatures(), azcosmoscx.NewQueryEngine().SupportedFeatures())
+}
+
+func TestSupportedFeatureSet(t *testing.T) {
+	features := azcosmoscx.SupportedFeatureSet()
+	assert.True(t, features.OrderBy)
+	assert.True(t, features.OffsetLimit)
+	assert.True(t, features.NonStreamingOrderBy)
+	assert.False(t, features.GroupBy)
+}
+
+func TestSelfTest(t *testing.T) {
+	assert.NoError(t, azcosmoscx.SelfTest())
+}
+
+func TestTracingConcurrentCallers(t *testing.T) {
+	// Put back the filter the other tests trace with.
+	t.Cleanup(func() {
+		require.NoError(t, azcosmoscx.SetTraceFilter(os.Getenv("COSMOSCX_LOG")))
+	})
+
+	// Enable tracing and adjust its filter from several goroutines, each running a pipeline meanwhile.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			azcosmoscx.EnableTracing()
+			pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, []azcosmoscx.PartitionKeyRange{{ID: "partition0", MinInclusive: "", MaxExclusive: "FF"}})
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer pipeline.Close()
+			assert.NoError(t, azcosmoscx.SetTraceFilter([]string{"off", "error"}[i%2]))
+			_, err = pipeline.Run()
+			assert.NoError(t, err)
+			azcosmoscx.EnableTracing()
+		}()
+	}
+	wg.Wait()
+
+	err := azcosmoscx.SetTraceFilter("azure_data_cosmos_engine=loud")
+	assert.ErrorIs(t, err, azcosmoscx.ErrDeserialization)
+}
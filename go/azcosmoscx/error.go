@@ -7,43 +7,134 @@ package azcosmoscx
 // #include <cosmoscx.h>
 import "C"
 
+// ErrInvalidContinuation is matched, using [errors.Is], by errors reporting that a continuation token provided to ProvideData doesn't belong to the partition key range it was provided for.
+//
+// This happens when a stale token, issued before the partition key ranges changed, is used, or when tokens are swapped between partitions.
+// Retrying with the same token fails in the same way, so this error should not be retried.
+// The error's message names the partition key range, and the token it expected and received.
+var ErrInvalidContinuation error = &Error{code: C.COSMOS_CX_RESULT_CODE_INVALID_CONTINUATION}
+
+// ErrUnknownPartitionKeyRange is matched, using [errors.Is], by errors reporting that a partition key range isn't one the pipeline was created with.
+//
+// This happens when the partition key ranges the pipeline was created with are out of date, for example because a partition has split.
+// Cached ranges for the container should be invalidated (see [PartitionKeyRangeCache.Invalidate]) and the query restarted with fresh ranges.
+var ErrUnknownPartitionKeyRange error = &Error{code: C.COSMOS_CX_RESULT_CODE_UNKNOWN_PARTITION_KEY_RANGE}
+
+// ErrBufferLimitExceeded is matched, using [errors.Is], by errors reporting that a query would buffer more items than the limit set with [WithMaxBufferedItems].
+//
+// Retrying the query with the same limit fails in the same way. Narrow the query, such as with TOP or a filter, or raise the limit.
+var ErrBufferLimitExceeded error = &Error{code: C.COSMOS_CX_RESULT_CODE_BUFFER_LIMIT_EXCEEDED}
+
+// The following errors are matched, using [errors.Is], by errors with the corresponding [ResultCode].
+var (
+	ErrInvalidGatewayResponse error = &Error{code: C.COSMOS_CX_RESULT_CODE_INVALID_GATEWAY_RESPONSE}
+	ErrDeserialization        error = &Error{code: C.COSMOS_CX_RESULT_CODE_DESERIALIZATION_ERROR}
+	ErrInternal               error = &Error{code: C.COSMOS_CX_RESULT_CODE_INTERNAL_ERROR}
+	ErrUnsupportedQueryPlan   error = &Error{code: C.COSMOS_CX_RESULT_CODE_UNSUPPORTED_QUERY_PLAN}
+	ErrInvalidUTF8String      error = &Error{code: C.COSMOS_CX_RESULT_CODE_INVALID_UTF8_STRING}
+	ErrArgumentNull           error = &Error{code: C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL}
+	ErrArithmeticOverflow     error = &Error{code: C.COSMOS_CX_RESULT_CODE_ARITHMETIC_OVERFLOW}
+	ErrInvalidRequestID       error = &Error{code: C.COSMOS_CX_RESULT_CODE_INVALID_REQUEST_ID}
+	ErrInvalidQuery           error = &Error{code: C.COSMOS_CX_RESULT_CODE_INVALID_QUERY}
+)
+
+// ResultCode identifies the kind of error reported by the engine, using the values of the C API's `CosmosCxResultCode`.
+type ResultCode int
+
+const (
+	ResultCodeSuccess                  ResultCode = C.COSMOS_CX_RESULT_CODE_SUCCESS
+	ResultCodeInvalidGatewayResponse   ResultCode = C.COSMOS_CX_RESULT_CODE_INVALID_GATEWAY_RESPONSE
+	ResultCodeDeserializationError     ResultCode = C.COSMOS_CX_RESULT_CODE_DESERIALIZATION_ERROR
+	ResultCodeUnknownPartitionKeyRange ResultCode = C.COSMOS_CX_RESULT_CODE_UNKNOWN_PARTITION_KEY_RANGE
+	ResultCodeInternalError            ResultCode = C.COSMOS_CX_RESULT_CODE_INTERNAL_ERROR
+	ResultCodeUnsupportedQueryPlan     ResultCode = C.COSMOS_CX_RESULT_CODE_UNSUPPORTED_QUERY_PLAN
+	ResultCodeInvalidUTF8String        ResultCode = C.COSMOS_CX_RESULT_CODE_INVALID_UTF8_STRING
+	ResultCodeArgumentNull             ResultCode = C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL
+	ResultCodeArithmeticOverflow       ResultCode = C.COSMOS_CX_RESULT_CODE_ARITHMETIC_OVERFLOW
+	ResultCodeInvalidRequestID         ResultCode = C.COSMOS_CX_RESULT_CODE_INVALID_REQUEST_ID
+	ResultCodeInvalidQuery             ResultCode = C.COSMOS_CX_RESULT_CODE_INVALID_QUERY
+	ResultCodeInvalidContinuation      ResultCode = C.COSMOS_CX_RESULT_CODE_INVALID_CONTINUATION
+	ResultCodeBufferLimitExceeded      ResultCode = C.COSMOS_CX_RESULT_CODE_BUFFER_LIMIT_EXCEEDED
+)
+
+// String returns a description of the code, which is the message of an [Error] with this code if the engine didn't describe the error in more detail.
+func (c ResultCode) String() string {
+	switch c {
+	case ResultCodeSuccess:
+		return "action was successful" // Shouldn't call this, but might as well return something descriptive.
+	case ResultCodeInvalidGatewayResponse:
+		return "invalid response from gateway"
+	case ResultCodeDeserializationError:
+		return "deserialization error"
+	case ResultCodeUnknownPartitionKeyRange:
+		return "unknown partition key range"
+	case ResultCodeInternalError:
+		return "internal error"
+	case ResultCodeUnsupportedQueryPlan:
+		return "unsupported query plan"
+	case ResultCodeInvalidUTF8String:
+		return "invalid UTF-8 string"
+	case ResultCodeArgumentNull:
+		return "provided argument was null"
+	case ResultCodeArithmeticOverflow:
+		return "arithmetic overflow occurred"
+	case ResultCodeInvalidRequestID:
+		return "invalid request ID"
+	case ResultCodeInvalidQuery:
+		return "invalid query"
+	case ResultCodeInvalidContinuation:
+		return "invalid continuation token"
+	case ResultCodeBufferLimitExceeded:
+		return "buffer limit exceeded"
+	default:
+		return "unknown error"
+	}
+}
+
 func mapErr(code C.CosmosCxResultCode) error {
 	if code == C.COSMOS_CX_RESULT_CODE_SUCCESS {
 		return nil
 	} else {
-		return &Error{code}
+		return &Error{code: code}
 	}
 }
 
 type Error struct {
 	code C.CosmosCxResultCode
+
+	// message provides details about the error, if the engine reported any.
+	message string
 }
 
+// Code returns the error's result code, converted to a uint.
+//
+// Deprecated: result codes are negative, so they wrap around when converted. Use [Error.ResultCode] instead.
 func (e *Error) Code() uint {
 	return uint(e.code)
 }
 
+// ResultCode returns the kind of error the engine reported.
+func (e *Error) ResultCode() ResultCode {
+	return ResultCode(e.code)
+}
+
+// Is reports whether the target is an [Error] with the same code, so that errors can be matched against sentinels such as [ErrInvalidContinuation].
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.code == e.code
+}
+
 func (e *Error) Error() string {
-	switch e.code {
-	case C.COSMOS_CX_RESULT_CODE_SUCCESS:
-		return "action was successful" // Shouldn't call this, but might as well return something descriptive.
-	case C.COSMOS_CX_RESULT_CODE_INVALID_GATEWAY_RESPONSE:
-		return "invalid response from gateway"
-	case C.COSMOS_CX_RESULT_CODE_DESERIALIZATION_ERROR:
-		return "deserialization error"
-	case C.COSMOS_CX_RESULT_CODE_UNKNOWN_PARTITION_KEY_RANGE:
-		return "unknown partition key range"
-	case C.COSMOS_CX_RESULT_CODE_INTERNAL_ERROR:
-		return "internal error"
-	case C.COSMOS_CX_RESULT_CODE_UNSUPPORTED_QUERY_PLAN:
-		return "unsupported query plan"
-	case C.COSMOS_CX_RESULT_CODE_INVALID_UTF8_STRING:
-		return "invalid UTF-8 string"
-	case C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL:
-		return "provided argument was null"
-	case C.COSMOS_CX_RESULT_CODE_ARITHMETIC_OVERFLOW:
-		return "arithmetic overflow occurred"
-	default:
-		return "unknown error"
+	if e.message != "" {
+		return e.message
 	}
+	return e.ResultCode().String()
+}
+
+// lastErrorMessage takes the engine's description of the last error reported on the current OS thread.
+// The caller must lock the goroutine to its OS thread (see [runtime.LockOSThread]) around the failing call and this one.
+func lastErrorMessage() string {
+	message := C.cosmoscx_v0_last_error_message()
+	defer C.cosmoscx_v0_string_free(message)
+	return EngineString(message).CloneString()
 }
@@ -0,0 +1,98 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// headerResultCodes returns the values of every result code declared in the C header, by name.
+func headerResultCodes(t *testing.T) map[string]int {
+	header, err := os.ReadFile("include/cosmoscx.h")
+	require.NoError(t, err)
+	codes := map[string]int{}
+	for _, match := range regexp.MustCompile(`COSMOS_CX_RESULT_CODE_(\w+) = (-?\d+)`).FindAllStringSubmatch(string(header), -1) {
+		value, err := strconv.Atoi(match[2])
+		require.NoError(t, err)
+		codes[match[1]] = value
+	}
+	require.NotEmpty(t, codes)
+	return codes
+}
+
+func TestResultCodesMatchHeader(t *testing.T) {
+	expected := map[string]azcosmoscx.ResultCode{
+		"SUCCESS":                     azcosmoscx.ResultCodeSuccess,
+		"INVALID_GATEWAY_RESPONSE":    azcosmoscx.ResultCodeInvalidGatewayResponse,
+		"DESERIALIZATION_ERROR":       azcosmoscx.ResultCodeDeserializationError,
+		"UNKNOWN_PARTITION_KEY_RANGE": azcosmoscx.ResultCodeUnknownPartitionKeyRange,
+		"INTERNAL_ERROR":              azcosmoscx.ResultCodeInternalError,
+		"UNSUPPORTED_QUERY_PLAN":      azcosmoscx.ResultCodeUnsupportedQueryPlan,
+		"INVALID_UTF8_STRING":         azcosmoscx.ResultCodeInvalidUTF8String,
+		"ARGUMENT_NULL":               azcosmoscx.ResultCodeArgumentNull,
+		"ARITHMETIC_OVERFLOW":         azcosmoscx.ResultCodeArithmeticOverflow,
+		"INVALID_REQUEST_ID":          azcosmoscx.ResultCodeInvalidRequestID,
+		"INVALID_QUERY":               azcosmoscx.ResultCodeInvalidQuery,
+		"INVALID_CONTINUATION":        azcosmoscx.ResultCodeInvalidContinuation,
+		"BUFFER_LIMIT_EXCEEDED":       azcosmoscx.ResultCodeBufferLimitExceeded,
+	}
+	codes := headerResultCodes(t)
+	assert.Len(t, expected, len(codes), "every result code in the header needs a ResultCode constant")
+	for name, value := range codes {
+		code, ok := expected[name]
+		if assert.True(t, ok, "missing ResultCode for %s", name) {
+			assert.Equal(t, value, int(code), name)
+		}
+		assert.NotEqual(t, "unknown error", azcosmoscx.ResultCode(value).String(), "missing description for %s", name)
+	}
+	assert.Equal(t, "unknown error", azcosmoscx.ResultCode(-100).String())
+}
+
+func TestSentinelErrors(t *testing.T) {
+	sentinels := map[azcosmoscx.ResultCode]error{
+		azcosmoscx.ResultCodeInvalidGatewayResponse:   azcosmoscx.ErrInvalidGatewayResponse,
+		azcosmoscx.ResultCodeDeserializationError:     azcosmoscx.ErrDeserialization,
+		azcosmoscx.ResultCodeUnknownPartitionKeyRange: azcosmoscx.ErrUnknownPartitionKeyRange,
+		azcosmoscx.ResultCodeInternalError:            azcosmoscx.ErrInternal,
+		azcosmoscx.ResultCodeUnsupportedQueryPlan:     azcosmoscx.ErrUnsupportedQueryPlan,
+		azcosmoscx.ResultCodeInvalidUTF8String:        azcosmoscx.ErrInvalidUTF8String,
+		azcosmoscx.ResultCodeArgumentNull:             azcosmoscx.ErrArgumentNull,
+		azcosmoscx.ResultCodeArithmeticOverflow:       azcosmoscx.ErrArithmeticOverflow,
+		azcosmoscx.ResultCodeInvalidRequestID:         azcosmoscx.ErrInvalidRequestID,
+		azcosmoscx.ResultCodeInvalidQuery:             azcosmoscx.ErrInvalidQuery,
+		azcosmoscx.ResultCodeInvalidContinuation:      azcosmoscx.ErrInvalidContinuation,
+		azcosmoscx.ResultCodeBufferLimitExceeded:      azcosmoscx.ErrBufferLimitExceeded,
+	}
+
+	// Every failure code in the header has a sentinel, described by the code, and matching only errors with that code.
+	codes := headerResultCodes(t)
+	assert.Len(t, sentinels, len(codes)-1, "every failure code in the header needs a sentinel error")
+	for code, sentinel := range sentinels {
+		var e *azcosmoscx.Error
+		require.True(t, errors.As(sentinel, &e))
+		assert.Equal(t, code, e.ResultCode())
+		assert.Equal(t, code.String(), sentinel.Error())
+		for otherCode, other := range sentinels {
+			assert.Equal(t, code == otherCode, errors.Is(sentinel, other), "errors.Is(%v, %v)", code, otherCode)
+		}
+	}
+}
+
+func TestEngineErrorsMatchSentinels(t *testing.T) {
+	_, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, nil)
+	assert.ErrorIs(t, err, azcosmoscx.ErrArgumentNull)
+
+	var e *azcosmoscx.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, azcosmoscx.ResultCodeArgumentNull, e.ResultCode())
+	assert.Equal(t, "at least one partition key range must be provided", err.Error())
+}
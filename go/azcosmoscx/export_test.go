@@ -0,0 +1,31 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+// SetConvertResultHook sets a function called partway through converting each native result, returning a function that removes it.
+func SetConvertResultHook(hook func() error) (restore func()) {
+	testHookConvertResult = hook
+	return func() { testHookConvertResult = nil }
+}
+
+// SetProfilingLabels enables or disables profiling labels, returning a function that restores the previous setting.
+func SetProfilingLabels(enabled bool) (restore func()) {
+	previous := profilingLabels.Swap(enabled)
+	return func() { profilingLabels.Store(previous) }
+}
+
+// LeakCheck reports leaked native memory, when built with AddressSanitizer (the asan tag). Otherwise, it does nothing.
+func LeakCheck() {
+	leakCheck()
+}
+
+// NewPipeline creates a low-level [Pipeline], for tests of the types it returns.
+func NewPipeline(query string, plan string, pkranges string) (*Pipeline, error) {
+	return newPipeline(query, plan, pkranges)
+}
+
+// TakeLastErrorMessage takes the engine's description of the last error reported on the current OS thread, which the caller must be locked to.
+func TakeLastErrorMessage() string {
+	return lastErrorMessage()
+}
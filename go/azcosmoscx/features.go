@@ -0,0 +1,96 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+// #cgo CFLAGS: -I${SRCDIR}/include
+// #include <cosmoscx.h>
+import "C"
+import (
+	"strings"
+	"sync"
+)
+
+// FeatureSet describes the query features supported by the engine.
+//
+// Each field corresponds to one of the feature names sent to the gateway in the `x-ms-cosmos-supported-query-features` header.
+type FeatureSet struct {
+	Aggregate                      bool
+	CompositeAggregate             bool
+	Distinct                       bool
+	GroupBy                        bool
+	MultipleAggregates             bool
+	MultipleOrderBy                bool
+	OffsetLimit                    bool
+	OrderBy                        bool
+	Top                            bool
+	NonValueAggregate              bool
+	DCount                         bool
+	NonStreamingOrderBy            bool
+	ListAndSetAggregate            bool
+	CountIf                        bool
+	HybridSearch                   bool
+	WeightedRankFusion             bool
+	HybridSearchSkipOrderByRewrite bool
+}
+
+// featureFields maps each feature name used by the native engine to the matching FeatureSet field.
+var featureFields = []struct {
+	name  string
+	field func(*FeatureSet) *bool
+}{
+	{"Aggregate", func(s *FeatureSet) *bool { return &s.Aggregate }},
+	{"CompositeAggregate", func(s *FeatureSet) *bool { return &s.CompositeAggregate }},
+	{"Distinct", func(s *FeatureSet) *bool { return &s.Distinct }},
+	{"GroupBy", func(s *FeatureSet) *bool { return &s.GroupBy }},
+	{"MultipleAggregates", func(s *FeatureSet) *bool { return &s.MultipleAggregates }},
+	{"MultipleOrderBy", func(s *FeatureSet) *bool { return &s.MultipleOrderBy }},
+	{"OffsetAndLimit", func(s *FeatureSet) *bool { return &s.OffsetLimit }},
+	{"OrderBy", func(s *FeatureSet) *bool { return &s.OrderBy }},
+	{"Top", func(s *FeatureSet) *bool { return &s.Top }},
+	{"NonValueAggregate", func(s *FeatureSet) *bool { return &s.NonValueAggregate }},
+	{"DCount", func(s *FeatureSet) *bool { return &s.DCount }},
+	{"NonStreamingOrderBy", func(s *FeatureSet) *bool { return &s.NonStreamingOrderBy }},
+	{"ListAndSetAggregate", func(s *FeatureSet) *bool { return &s.ListAndSetAggregate }},
+	{"CountIf", func(s *FeatureSet) *bool { return &s.CountIf }},
+	{"HybridSearch", func(s *FeatureSet) *bool { return &s.HybridSearch }},
+	{"WeightedRankFusion", func(s *FeatureSet) *bool { return &s.WeightedRankFusion }},
+	{"HybridSearchSkipOrderByRewrite", func(s *FeatureSet) *bool { return &s.HybridSearchSkipOrderByRewrite }},
+}
+
+// Names returns the names of the features in the set, as used in the supported features string returned by [SupportedFeatures].
+func (s FeatureSet) Names() []string {
+	names := make([]string, 0, len(featureFields))
+	for _, f := range featureFields {
+		if *f.field(&s) {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// SupportedFeatures returns the comma-separated list of query features supported by the engine.
+//
+// This string is suitable to be sent as the value for the `x-ms-cosmos-supported-query-features` header in a query plan request.
+func SupportedFeatures() string {
+	return C.GoString(C.cosmoscx_v0_query_supported_features())
+}
+
+var supportedFeatureSet = sync.OnceValue(func() FeatureSet {
+	var set FeatureSet
+	for _, name := range strings.Split(SupportedFeatures(), ",") {
+		for _, f := range featureFields {
+			if f.name == name {
+				*f.field(&set) = true
+			}
+		}
+	}
+	return set
+})
+
+// SupportedFeatureSet returns the query features supported by the engine, as a [FeatureSet].
+//
+// The set is built from the same native list as [SupportedFeatures], so the two always agree.
+func SupportedFeatureSet() FeatureSet {
+	return supportedFeatureSet()
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// maxFormattedContinuationLength is the number of bytes of a continuation included when a request is formatted for logging.
+// Continuations can be long, so longer ones are truncated.
+const maxFormattedContinuationLength = 32
+
+// String returns a compact description of the request, such as "#1 partition0@<start>", for logging.
+//
+// A DataRequest borrows from the [PipelineResult] it came from, so String must be called before the result is freed.
+// The returned string is a copy in Go memory, and remains valid after the result is freed. No native memory is allocated.
+func (r *DataRequest) String() string {
+	s := fmt.Sprintf("#%d %s", r.Id(), formatRequestTarget(r.PartitionKeyRangeID().BorrowString(), r.Continuation().BorrowString()))
+	if min, max, minInclusive, maxInclusive, ok := r.EpkRange(); ok {
+		s += " " + formatEpkRange(min.BorrowString(), max.BorrowString(), minInclusive, maxInclusive)
+	}
+	return s
+}
+
+// GoString returns a description of every field of the request, without truncating them, for the %#v verb and dump utilities.
+//
+// Like [DataRequest.String], it must be called before the result the request came from is freed, and the returned string remains valid after that.
+func (r *DataRequest) GoString() string {
+	epkRange := "nil"
+	if min, max, minInclusive, maxInclusive, ok := r.EpkRange(); ok {
+		epkRange = fmt.Sprintf("%q", formatEpkRange(min.BorrowString(), max.BorrowString(), minInclusive, maxInclusive))
+	}
+	return fmt.Sprintf("azcosmoscx.DataRequest{Id:%d, PartitionKeyRangeID:%q, Continuation:%q, Query:%q, IncludeParameters:%t, EpkRange:%s}",
+		r.Id(), r.PartitionKeyRangeID().BorrowString(), r.Continuation().BorrowString(), r.Query().BorrowString(), r.IncludeParameters(), epkRange)
+}
+
+// FormatQueryRequests returns a compact, single-line description of the requests returned by a turn, such as "partition0@<continuation> partition1@<start>", for logging.
+//
+// Continuations longer than 32 bytes are truncated. If there are no requests, it returns "(none)".
+func FormatQueryRequests(requests []queryengine.QueryRequest) string {
+	if len(requests) == 0 {
+		return "(none)"
+	}
+	targets := make([]string, 0, len(requests))
+	for _, request := range requests {
+		targets = append(targets, formatRequestTarget(request.PartitionKeyRangeID, request.Continuation))
+	}
+	return strings.Join(targets, " ")
+}
+
+// formatRequestTarget formats the partition key range and continuation a request is for, as "pkrange@continuation", or "pkrange@<start>" if there's no continuation.
+func formatRequestTarget(pkrangeID string, continuation string) string {
+	if continuation == "" {
+		return pkrangeID + "@<start>"
+	}
+	if len(continuation) > maxFormattedContinuationLength {
+		return pkrangeID + "@" + continuation[:maxFormattedContinuationLength] + "..."
+	}
+	return pkrangeID + "@" + continuation
+}
+
+// formatEpkRange formats an EPK range in interval notation, such as "[00,80)".
+func formatEpkRange(min string, max string, minInclusive bool, maxInclusive bool) string {
+	left, right := "(", ")"
+	if minInclusive {
+		left = "["
+	}
+	if maxInclusive {
+		right = "]"
+	}
+	return left + min + "," + max + right
+}
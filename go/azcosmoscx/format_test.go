@@ -0,0 +1,64 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataRequestString(t *testing.T) {
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"FF"}]}`
+	pipeline, err := azcosmoscx.NewPipeline("SELECT * FROM c", unorderedPlan, pkranges)
+	require.NoError(t, err)
+	defer pipeline.Free()
+
+	result, err := pipeline.NextBatch()
+	require.NoError(t, err)
+	requests, err := result.Requests()
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, fmt.Sprintf("#%d partition0@<start>", requests[0].Id()), requests[0].String())
+	result.Free()
+
+	continuation := strings.Repeat("c", 40)
+	require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[]}`, continuation)}))
+	result, err = pipeline.NextBatch()
+	require.NoError(t, err)
+	requests, err = result.Requests()
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+
+	id := requests[0].Id()
+	str := requests[0].String()
+	goStr := fmt.Sprintf("%#v", &requests[0])
+	assert.Equal(t, fmt.Sprintf("#%d partition0@%s...", id, continuation[:32]), str)
+	assert.Equal(t, fmt.Sprintf(`azcosmoscx.DataRequest{Id:%d, PartitionKeyRangeID:"partition0", Continuation:%q, Query:"", IncludeParameters:%t, EpkRange:nil}`, id, continuation, requests[0].IncludeParameters()), goStr)
+
+	// The strings are copies, so they remain valid once the result they were formatted from is freed, even after its memory is reused.
+	result.Free()
+	require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[]}`, strings.Repeat("x", 40))}))
+	result, err = pipeline.NextBatch()
+	require.NoError(t, err)
+	defer result.Free()
+	assert.Equal(t, fmt.Sprintf("#%d partition0@%s...", id, continuation[:32]), str)
+	assert.Contains(t, goStr, continuation)
+}
+
+func TestFormatQueryRequests(t *testing.T) {
+	long := strings.Repeat("0123456789", 5)
+	requests := []queryengine.QueryRequest{
+		{PartitionKeyRangeID: "partition0", Continuation: "abc"},
+		{PartitionKeyRangeID: "partition1"},
+		{PartitionKeyRangeID: "partition2", Continuation: long},
+	}
+	assert.Equal(t, "partition0@abc partition1@<start> partition2@"+long[:32]+"...", azcosmoscx.FormatQueryRequests(requests))
+	assert.Equal(t, "(none)", azcosmoscx.FormatQueryRequests(nil))
+}
@@ -0,0 +1,149 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx/internal/cosmostest"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGatewayContainer starts a mock gateway with a container of the given number of partitions, holding items with IDs "0" to "count-1",
+// and returns a client for the container.
+func newGatewayContainer(t testing.TB, partitionCount int, count int) (*cosmostest.Server, *azcosmos.ContainerClient) {
+	server := cosmostest.NewServer()
+	t.Cleanup(server.Close)
+
+	server.CreateContainer("db", "items", partitionCount)
+	for i := 0; i < count; i++ {
+		item := fmt.Sprintf(`{"id":"%d","value":%d,"group":"%s"}`, i, (i*7)%count, []string{"even", "odd"}[i%2])
+		require.NoError(t, server.AddItems("db", "items", item))
+	}
+
+	cred, err := azcosmos.NewKeyCredential(cosmostest.Key)
+	require.NoError(t, err)
+	client, err := azcosmos.NewClientWithKey(server.URL, cred, nil)
+	require.NoError(t, err)
+	container, err := client.NewContainer("db", "items")
+	require.NoError(t, err)
+	return server, container
+}
+
+type gatewayItem struct {
+	ID    string `json:"id"`
+	Value int    `json:"value"`
+	Group string `json:"group"`
+}
+
+// queryGateway runs the query through the SDK using the azcosmoscx engine, returning every item.
+func queryGateway(t *testing.T, container *azcosmos.ContainerClient, query string, parameters ...azcosmos.QueryParameter) []gatewayItem {
+	pager := container.NewQueryItemsPager(query, azcosmos.NewPartitionKey(), &azcosmos.QueryOptions{
+		QueryEngine:     azcosmoscx.NewQueryEngine(),
+		QueryParameters: parameters,
+	})
+
+	var items []gatewayItem
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		require.NoError(t, err)
+		for _, data := range page.Items {
+			var item gatewayItem
+			require.NoError(t, json.Unmarshal(data, &item))
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func TestGatewaySelectAll(t *testing.T) {
+	server, container := newGatewayContainer(t, 4, 20)
+	server.SetPageSize(3)
+
+	items := queryGateway(t, container, "SELECT * FROM c")
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	expected := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		expected = append(expected, fmt.Sprint(i))
+	}
+	assert.ElementsMatch(t, expected, ids)
+}
+
+func TestGatewayOrderBy(t *testing.T) {
+	server, container := newGatewayContainer(t, 3, 20)
+	server.SetPageSize(2)
+
+	for _, direction := range []string{"ASC", "DESC"} {
+		t.Run(direction, func(t *testing.T) {
+			items := queryGateway(t, container, "SELECT * FROM c ORDER BY c.value "+direction)
+			require.Len(t, items, 20)
+			for i, item := range items {
+				expected := i
+				if direction == "DESC" {
+					expected = 19 - i
+				}
+				assert.Equal(t, expected, item.Value)
+			}
+		})
+	}
+}
+
+func TestGatewayFilterWithParameter(t *testing.T) {
+	_, container := newGatewayContainer(t, 2, 10)
+
+	items := queryGateway(t, container, "SELECT * FROM c WHERE c.group = @group ORDER BY c.value", azcosmos.QueryParameter{Name: "@group", Value: "odd"})
+	values := make([]int, 0, len(items))
+	for _, item := range items {
+		assert.Equal(t, "odd", item.Group)
+		values = append(values, item.Value)
+	}
+	assert.Equal(t, []int{1, 3, 5, 7, 9}, values)
+}
+
+// BenchmarkGatewayQuery runs queries end to end, through the SDK's pager and an in-process mock gateway over 8 partitions of 2000 items,
+// including the SDK's requests, headers, and serialization, with and without the engine, and reports the items per second.
+// Without the engine, the gateway runs the query across partitions itself, which it can't do with ORDER BY.
+func BenchmarkGatewayQuery(b *testing.B) {
+	const partitionCount, count = 8, 2000
+	_, container := newGatewayContainer(b, partitionCount, count)
+
+	for _, c := range []struct {
+		name   string
+		query  string
+		engine bool
+	}{
+		{"SelectAll/WithoutEngine", "SELECT * FROM c", false},
+		{"SelectAll/WithEngine", "SELECT * FROM c", true},
+		{"OrderBy/WithEngine", "SELECT * FROM c ORDER BY c.value", true},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			profileScenario(b)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				options := &azcosmos.QueryOptions{}
+				if c.engine {
+					options.QueryEngine = azcosmoscx.NewQueryEngineWithOptions(azcosmoscx.EngineOptions{ProfilingContext: context.Background()})
+				}
+				pager := container.NewQueryItemsPager(c.query, azcosmos.NewPartitionKey(), options)
+				items := 0
+				for pager.More() {
+					page, err := pager.NextPage(context.Background())
+					require.NoError(b, err)
+					items += len(page.Items)
+				}
+				require.Equal(b, count, items)
+			}
+			b.ReportMetric(float64(count)*float64(b.N)/b.Elapsed().Seconds(), "items/s")
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package cosmostest
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// orderByFilterPlaceholder is the placeholder the gateway includes in rewritten ORDER BY queries, which the engine replaces with a filter when resuming a query.
+const orderByFilterPlaceholder = "{documentdb-formattableorderbyquery-filter}"
+
+var (
+	queryPattern = regexp.MustCompile(`(?is)^\s*SELECT\s+(\*|c\._rid,\s*\[\{"item":\s*c\.(\w+)\}\]\s+AS\s+orderByItems,\s*c\s+AS\s+payload)\s+FROM\s+c` +
+		`(?:\s+WHERE\s+(.+?))?(?:\s+ORDER\s+BY\s+c\.(\w+)(?:\s+(ASC|DESC))?)?\s*$`)
+	andPattern       = regexp.MustCompile(`(?i)\s+AND\s+`)
+	conditionPattern = regexp.MustCompile(`(?s)^c\.(\w+)\s*=\s*(.+)$`)
+)
+
+// query is a parsed query, in the subset of the query language the server supports.
+type query struct {
+	// conditions are the equality filters of the WHERE clause, which must all match.
+	conditions []condition
+
+	// orderBy is the property the results are sorted by, or empty if they're returned in insertion order.
+	orderBy    string
+	descending bool
+
+	// wrapped is set if each result is wrapped with its ORDER BY item, as in the queries the gateway rewrites ORDER BY queries into.
+	wrapped bool
+}
+
+type condition struct {
+	property string
+	value    any
+}
+
+type queryParameter struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+}
+
+// parseQuery parses a query of the form `SELECT * FROM c [WHERE c.a = <value> [AND ...]] [ORDER BY c.b [ASC|DESC]]`,
+// where each value is a JSON literal, a single-quoted string, or a parameter.
+// It also accepts the queries that the gateway rewrites ORDER BY queries into, as returned by [query.rewrite].
+func parseQuery(text string, parameters []queryParameter) (*query, error) {
+	match := queryPattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, fmt.Errorf("unsupported query: %s", text)
+	}
+
+	q := &query{
+		wrapped:    match[1] != "*",
+		orderBy:    match[4],
+		descending: strings.EqualFold(match[5], "DESC"),
+	}
+	if q.wrapped && match[2] != q.orderBy {
+		return nil, fmt.Errorf("unsupported query: the ORDER BY item doesn't match the ORDER BY clause: %s", text)
+	}
+
+	if match[3] != "" {
+		for _, term := range andPattern.Split(match[3], -1) {
+			term = strings.TrimSpace(term)
+			for strings.HasPrefix(term, "(") && strings.HasSuffix(term, ")") {
+				term = strings.TrimSpace(term[1 : len(term)-1])
+			}
+			if strings.EqualFold(term, "true") || term == orderByFilterPlaceholder {
+				continue
+			}
+
+			condition, err := parseCondition(term, parameters)
+			if err != nil {
+				return nil, err
+			}
+			q.conditions = append(q.conditions, condition)
+		}
+	}
+	return q, nil
+}
+
+func parseCondition(term string, parameters []queryParameter) (condition, error) {
+	match := conditionPattern.FindStringSubmatch(term)
+	if match == nil {
+		return condition{}, fmt.Errorf("unsupported condition: %s", term)
+	}
+
+	literal := strings.TrimSpace(match[2])
+	if strings.HasPrefix(literal, "@") {
+		for _, parameter := range parameters {
+			if parameter.Name == literal {
+				return condition{match[1], parameter.Value}, nil
+			}
+		}
+		return condition{}, fmt.Errorf("parameter %s isn't defined", literal)
+	}
+	if len(literal) >= 2 && strings.HasPrefix(literal, "'") && strings.HasSuffix(literal, "'") {
+		return condition{match[1], literal[1 : len(literal)-1]}, nil
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(literal), &value); err != nil {
+		return condition{}, fmt.Errorf("unsupported value in condition: %s", term)
+	}
+	return condition{match[1], value}, nil
+}
+
+// rewrite returns the query the gateway tells the engine to run against each partition, or an empty string if it's run as is.
+func (q *query) rewrite() string {
+	if q.orderBy == "" {
+		return ""
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, `SELECT c._rid, [{"item": c.%s}] AS orderByItems, c AS payload FROM c WHERE (%s)`, q.orderBy, orderByFilterPlaceholder)
+	for _, condition := range q.conditions {
+		value, _ := json.Marshal(condition.value)
+		fmt.Fprintf(&builder, " AND (c.%s = %s)", condition.property, value)
+	}
+	fmt.Fprintf(&builder, " ORDER BY c.%s %s", q.orderBy, q.direction())
+	return builder.String()
+}
+
+func (q *query) direction() string {
+	if q.descending {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// plan returns the query plan the gateway returns for the query.
+func (q *query) plan() map[string]any {
+	queryInfo := map[string]any{
+		"distinctType":       "None",
+		"orderBy":            []string{},
+		"orderByExpressions": []string{},
+		"groupByExpressions": []string{},
+		"aggregates":         []string{},
+		"rewrittenQuery":     q.rewrite(),
+		"hasSelectValue":     false,
+	}
+	if q.orderBy != "" {
+		order := "Ascending"
+		if q.descending {
+			order = "Descending"
+		}
+		queryInfo["orderBy"] = []string{order}
+		queryInfo["orderByExpressions"] = []string{"c." + q.orderBy}
+	}
+	return map[string]any{
+		"partitionedQueryExecutionInfoVersion": 2,
+		"queryInfo":                            queryInfo,
+		"queryRanges": []map[string]any{
+			{"min": "", "max": "FF", "isMinInclusive": true, "isMaxInclusive": false},
+		},
+	}
+}
+
+// execute returns the results of the query over the documents, in the order they'd be returned by a partition.
+func (q *query) execute(documents []map[string]any) []any {
+	var matched []map[string]any
+	for _, document := range documents {
+		if q.matches(document) {
+			matched = append(matched, document)
+		}
+	}
+
+	if q.orderBy != "" {
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, aok := matched[i][q.orderBy]
+			b, bok := matched[j][q.orderBy]
+			c := compareValues(a, aok, b, bok)
+			if q.descending {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	results := make([]any, 0, len(matched))
+	for _, document := range matched {
+		if !q.wrapped {
+			results = append(results, document)
+			continue
+		}
+
+		item := map[string]any{}
+		if value, ok := document[q.orderBy]; ok {
+			item["item"] = value
+		}
+		results = append(results, map[string]any{
+			"_rid":         document["_rid"],
+			"orderByItems": []any{item},
+			"payload":      document,
+		})
+	}
+	return results
+}
+
+func (q *query) matches(document map[string]any) bool {
+	for _, condition := range q.conditions {
+		value, ok := document[condition.property]
+		if !ok || compareValues(value, true, condition.value, true) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compareValues compares two JSON values in the order used by ORDER BY: undefined (missing), then null, booleans, numbers, and strings.
+// Other values compare as equal to each other.
+func compareValues(a any, aDefined bool, b any, bDefined bool) int {
+	rank := func(value any, defined bool) int {
+		if !defined {
+			return 0
+		}
+		switch value.(type) {
+		case nil:
+			return 1
+		case bool:
+			return 2
+		case float64:
+			return 3
+		case string:
+			return 4
+		default:
+			return 5
+		}
+	}
+
+	ra, rb := rank(a, aDefined), rank(b, bDefined)
+	if ra != rb {
+		return ra - rb
+	}
+	switch a := a.(type) {
+	case bool:
+		b := b.(bool)
+		if a == b {
+			return 0
+		} else if !a {
+			return -1
+		}
+		return 1
+	case float64:
+		b := b.(float64)
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package cosmostest provides an in-memory stand-in for the Cosmos DB gateway, for running queries through the azcosmos SDK and the engine without the emulator.
+//
+// The server implements only the parts of the REST API that the SDK uses to run a query with a query engine:
+// reading the account, generating a query plan, reading a container's partition key ranges, and running a query against a single partition key range.
+// Like the gateway, it also runs a query without ORDER BY across every partition key range when the request doesn't name one, as the SDK does without a query engine.
+// It supports a small subset of the query language: `SELECT * FROM c`, with an optional WHERE clause made of equality conditions joined by AND,
+// and an optional ORDER BY on a single property.
+package cosmostest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Key is an account key the server accepts. The server doesn't check authorization, so any valid key works.
+var Key = base64.StdEncoding.EncodeToString([]byte("cosmostest"))
+
+// DefaultPageSize is the maximum number of items in a page of query results, if the request doesn't set one.
+const DefaultPageSize = 100
+
+// Server is an HTTP server that serves containers stored in memory.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	pageSize   int
+	containers map[string]*container
+}
+
+type container struct {
+	ranges     []partitionKeyRange
+	partitions [][]map[string]any
+}
+
+type partitionKeyRange struct {
+	ID           string `json:"id"`
+	MinInclusive string `json:"minInclusive"`
+	MaxExclusive string `json:"maxExclusive"`
+}
+
+// NewServer starts a server with no containers. The caller should call Close when it's done with the server.
+func NewServer() *Server {
+	s := &Server{
+		pageSize:   DefaultPageSize,
+		containers: make(map[string]*container),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// SetPageSize sets the maximum number of items in a page of query results, for requests that don't set one.
+func (s *Server) SetPageSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = size
+}
+
+// CreateContainer creates an empty container in the database, with the given number of partition key ranges, replacing any existing container with the same name.
+//
+// The ranges are named "0" onwards, and evenly cover the key space.
+func (s *Server) CreateContainer(database string, name string, partitionCount int) {
+	if partitionCount <= 0 || partitionCount > 0x100 {
+		panic(fmt.Sprintf("partition count must be between 1 and 256, but was %d", partitionCount))
+	}
+
+	c := &container{
+		ranges:     make([]partitionKeyRange, partitionCount),
+		partitions: make([][]map[string]any, partitionCount),
+	}
+	// The bounds have four hex digits, so that there's room for 256 ranges below the maximum, "FF", which sorts before any longer bound starting with FF.
+	width := 0xFF00 / partitionCount
+	for i := range c.ranges {
+		c.ranges[i] = partitionKeyRange{
+			ID:           strconv.Itoa(i),
+			MinInclusive: fmt.Sprintf("%04X", i*width),
+			MaxExclusive: fmt.Sprintf("%04X", (i+1)*width),
+		}
+	}
+	c.ranges[0].MinInclusive = ""
+	c.ranges[partitionCount-1].MaxExclusive = "FF"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.containers[containerKey(database, name)] = c
+}
+
+// AddItems adds items, each a JSON object with a string "id" property, to a container created by [Server.CreateContainer].
+//
+// Each item is stored in a partition chosen by hashing its ID. Items are returned in the order they were added, unless the query has an ORDER BY.
+func (s *Server) AddItems(database string, name string, items ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.containers[containerKey(database, name)]
+	if !ok {
+		return fmt.Errorf("container %s/%s doesn't exist", database, name)
+	}
+
+	for i, item := range items {
+		var document map[string]any
+		if err := json.Unmarshal([]byte(item), &document); err != nil {
+			return fmt.Errorf("item %d isn't a JSON object: %w", i, err)
+		}
+		id, ok := document["id"].(string)
+		if !ok {
+			return fmt.Errorf("item %d doesn't have a string id", i)
+		}
+
+		hash := fnv.New32a()
+		hash.Write([]byte(id))
+		partition := int(hash.Sum32() % uint32(len(c.partitions)))
+		document["_rid"] = fmt.Sprintf("%s.%d.%d", c.ranges[partition].ID, len(c.partitions[partition]), i)
+		c.partitions[partition] = append(c.partitions[partition], document)
+	}
+	return nil
+}
+
+func containerKey(database string, name string) string {
+	return database + "/" + name
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		s.serveAccount(w)
+	case len(segments) == 5 && segments[0] == "dbs" && segments[2] == "colls":
+		s.mu.Lock()
+		c, ok := s.containers[containerKey(segments[1], segments[3])]
+		pageSize := s.pageSize
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("container %s/%s doesn't exist", segments[1], segments[3]))
+			return
+		}
+
+		switch {
+		case segments[4] == "pkranges" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"_rid": segments[3], "PartitionKeyRanges": c.ranges, "_count": len(c.ranges)})
+		case segments[4] == "docs" && r.Method == http.MethodPost:
+			s.serveQuery(w, r, c, pageSize)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("%s %s isn't supported", r.Method, r.URL.Path))
+		}
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%s %s isn't supported", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) serveAccount(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":                           "cosmostest",
+		"writableLocations":            []any{},
+		"readableLocations":            []any{},
+		"enableMultipleWriteLocations": false,
+		"userConsistencyPolicy":        map[string]any{"defaultConsistencyLevel": "Session"},
+	})
+}
+
+// serveQuery generates a query plan, if the request asks for one, or runs the query against the partition key range named by the request, or every one if it doesn't name one.
+func (s *Server) serveQuery(w http.ResponseWriter, r *http.Request, c *container, pageSize int) {
+	var body struct {
+		Query      string           `json:"query"`
+		Parameters []queryParameter `json:"parameters"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("invalid query body: %v", err))
+		return
+	}
+	q, err := parseQuery(body.Query, body.Parameters)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	if strings.EqualFold(r.Header.Get("x-ms-cosmos-is-query-plan-request"), "true") {
+		writeJSON(w, http.StatusOK, q.plan())
+		return
+	}
+
+	pkrangeID := r.Header.Get("x-ms-documentdb-partitionkeyrangeid")
+	partitions := c.partitions
+	if pkrangeID == "" {
+		// The gateway only runs queries across partitions itself if their results don't need to be merged.
+		if q.orderBy != "" {
+			writeError(w, http.StatusBadRequest, "BadRequest", "a cross-partition query with ORDER BY must be run against each partition key range, using its query plan")
+			return
+		}
+	} else {
+		partition := -1
+		for i, pkrange := range c.ranges {
+			if pkrange.ID == pkrangeID {
+				partition = i
+			}
+		}
+		if partition < 0 {
+			// The gateway reports ranges that no longer exist, such as after a split, as gone.
+			writeError(w, http.StatusGone, "Gone", fmt.Sprintf("partition key range %q doesn't exist", pkrangeID))
+			return
+		}
+		partitions = partitions[partition : partition+1]
+	}
+
+	if size, err := strconv.Atoi(r.Header.Get("x-ms-max-item-count")); err == nil && size > 0 {
+		pageSize = size
+	}
+	start := 0
+	if continuation := r.Header.Get("x-ms-continuation"); continuation != "" {
+		if start, err = strconv.Atoi(continuation); err != nil || start < 0 {
+			writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("invalid continuation %q", continuation))
+			return
+		}
+	}
+
+	var results []any
+	s.mu.Lock()
+	for _, documents := range partitions {
+		results = append(results, q.execute(documents)...)
+	}
+	s.mu.Unlock()
+
+	start = min(start, len(results))
+	end := min(start+pageSize, len(results))
+	if end < len(results) {
+		w.Header().Set("x-ms-continuation", strconv.Itoa(end))
+	}
+	w.Header().Set("x-ms-request-charge", "1")
+	writeJSON(w, http.StatusOK, map[string]any{"_rid": pkrangeID, "Documents": results[start:end], "_count": end - start})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, map[string]any{"code": code, "message": message})
+}
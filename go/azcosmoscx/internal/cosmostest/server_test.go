@@ -0,0 +1,248 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package cosmostest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type response struct {
+	status       int
+	continuation string
+	body         map[string]any
+}
+
+func send(t *testing.T, server *Server, method string, path string, body string, headers map[string]string) response {
+	request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	raw, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer raw.Body.Close()
+
+	result := response{status: raw.StatusCode, continuation: raw.Header.Get("x-ms-continuation")}
+	require.NoError(t, json.NewDecoder(raw.Body).Decode(&result.body))
+	return result
+}
+
+func queryBody(query string) string {
+	body, _ := json.Marshal(map[string]any{"query": query})
+	return string(body)
+}
+
+// ids returns the ids of the documents in a page of query results, unwrapping ORDER BY results.
+func ids(t *testing.T, body map[string]any) []string {
+	var ids []string
+	for _, document := range body["Documents"].([]any) {
+		document := document.(map[string]any)
+		if payload, ok := document["payload"]; ok {
+			document = payload.(map[string]any)
+		}
+		ids = append(ids, document["id"].(string))
+	}
+	return ids
+}
+
+func newTestServer(t *testing.T, partitionCount int, items ...string) *Server {
+	server := NewServer()
+	t.Cleanup(server.Close)
+	server.CreateContainer("db", "c1", partitionCount)
+	require.NoError(t, server.AddItems("db", "c1", items...))
+	return server
+}
+
+func TestPartitionKeyRanges(t *testing.T) {
+	server := newTestServer(t, 3)
+	response := send(t, server, http.MethodGet, "/dbs/db/colls/c1/pkranges", "", nil)
+	require.Equal(t, http.StatusOK, response.status)
+	assert.Equal(t, []any{
+		map[string]any{"id": "0", "minInclusive": "", "maxExclusive": "5500"},
+		map[string]any{"id": "1", "minInclusive": "5500", "maxExclusive": "AA00"},
+		map[string]any{"id": "2", "minInclusive": "AA00", "maxExclusive": "FF"},
+	}, response.body["PartitionKeyRanges"])
+
+	response = send(t, server, http.MethodGet, "/dbs/db/colls/missing/pkranges", "", nil)
+	assert.Equal(t, http.StatusNotFound, response.status)
+}
+
+func TestQueryPlan(t *testing.T) {
+	server := newTestServer(t, 1)
+	headers := map[string]string{"x-ms-cosmos-is-query-plan-request": "True"}
+
+	response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody("SELECT * FROM c"), headers)
+	require.Equal(t, http.StatusOK, response.status)
+	queryInfo := response.body["queryInfo"].(map[string]any)
+	assert.Empty(t, queryInfo["orderBy"])
+	assert.Empty(t, queryInfo["rewrittenQuery"])
+
+	response = send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody("SELECT * FROM c WHERE c.kind = 'a' ORDER BY c.value DESC"), headers)
+	require.Equal(t, http.StatusOK, response.status)
+	queryInfo = response.body["queryInfo"].(map[string]any)
+	assert.Equal(t, []any{"Descending"}, queryInfo["orderBy"])
+	assert.Equal(t, []any{"c.value"}, queryInfo["orderByExpressions"])
+	assert.Equal(t,
+		`SELECT c._rid, [{"item": c.value}] AS orderByItems, c AS payload FROM c WHERE ({documentdb-formattableorderbyquery-filter}) AND (c.kind = "a") ORDER BY c.value DESC`,
+		queryInfo["rewrittenQuery"])
+
+	response = send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody("SELECT VALUE COUNT(1) FROM c"), headers)
+	assert.Equal(t, http.StatusBadRequest, response.status)
+	assert.Contains(t, response.body["message"], "unsupported query")
+}
+
+func TestQueryPagesWithContinuations(t *testing.T) {
+	var items []string
+	for i := 0; i < 5; i++ {
+		items = append(items, fmt.Sprintf(`{"id":"%d"}`, i))
+	}
+	server := newTestServer(t, 1, items...)
+	server.SetPageSize(2)
+
+	var pages [][]string
+	continuation := ""
+	for {
+		headers := map[string]string{"x-ms-documentdb-partitionkeyrangeid": "0", "x-ms-continuation": continuation}
+		response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody("SELECT * FROM c"), headers)
+		require.Equal(t, http.StatusOK, response.status)
+		pages = append(pages, ids(t, response.body))
+		if response.continuation == "" {
+			break
+		}
+		continuation = response.continuation
+	}
+	assert.Equal(t, [][]string{{"0", "1"}, {"2", "3"}, {"4"}}, pages)
+
+	// The request's page size takes precedence over the server's.
+	headers := map[string]string{"x-ms-documentdb-partitionkeyrangeid": "0", "x-ms-max-item-count": "4"}
+	response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody("SELECT * FROM c"), headers)
+	assert.Equal(t, []string{"0", "1", "2", "3"}, ids(t, response.body))
+	assert.Equal(t, "4", response.continuation)
+}
+
+func TestQueryFiltersAndOrdersPartition(t *testing.T) {
+	server := newTestServer(t, 1,
+		`{"id":"a","kind":"x","value":3}`,
+		`{"id":"b","kind":"y","value":1}`,
+		`{"id":"c","kind":"x","value":"text"}`,
+		`{"id":"d","kind":"x"}`,
+		`{"id":"e","kind":"x","value":null}`,
+		`{"id":"f","kind":"x","value":1}`,
+	)
+	headers := map[string]string{"x-ms-documentdb-partitionkeyrangeid": "0"}
+
+	cases := []struct {
+		query    string
+		expected []string
+	}{
+		{"SELECT * FROM c", []string{"a", "b", "c", "d", "e", "f"}},
+		{"SELECT * FROM c WHERE c.kind = 'x'", []string{"a", "c", "d", "e", "f"}},
+		{`SELECT * FROM c WHERE c.kind = "x" AND c.value = 1`, []string{"f"}},
+		// Undefined sorts before null, then numbers and strings.
+		{"SELECT * FROM c WHERE c.kind = 'x' ORDER BY c.value", []string{"d", "e", "f", "a", "c"}},
+		{"select * from c order by c.value desc", []string{"c", "a", "b", "f", "e", "d"}},
+		{`SELECT c._rid, [{"item": c.value}] AS orderByItems, c AS payload FROM c WHERE (true) AND (c.kind = "y") ORDER BY c.value ASC`, []string{"b"}},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody(c.query), headers)
+			require.Equal(t, http.StatusOK, response.status, response.body["message"])
+			assert.Equal(t, c.expected, ids(t, response.body))
+		})
+	}
+}
+
+func TestQueryWrapsOrderByItems(t *testing.T) {
+	server := newTestServer(t, 1, `{"id":"a","value":2}`, `{"id":"b"}`)
+	headers := map[string]string{"x-ms-documentdb-partitionkeyrangeid": "0"}
+
+	query := `SELECT c._rid, [{"item": c.value}] AS orderByItems, c AS payload FROM c WHERE ({documentdb-formattableorderbyquery-filter}) ORDER BY c.value ASC`
+	response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody(query), headers)
+	require.Equal(t, http.StatusOK, response.status, response.body["message"])
+
+	documents := response.body["Documents"].([]any)
+	require.Len(t, documents, 2)
+	assert.Equal(t, []any{map[string]any{}}, documents[0].(map[string]any)["orderByItems"])
+	assert.Equal(t, []any{map[string]any{"item": float64(2)}}, documents[1].(map[string]any)["orderByItems"])
+}
+
+func TestQueryParameters(t *testing.T) {
+	server := newTestServer(t, 1, `{"id":"a","value":1}`, `{"id":"b","value":2}`)
+	headers := map[string]string{"x-ms-documentdb-partitionkeyrangeid": "0"}
+
+	body := `{"query":"SELECT * FROM c WHERE c.value = @value","parameters":[{"name":"@value","value":2}]}`
+	response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", body, headers)
+	require.Equal(t, http.StatusOK, response.status, response.body["message"])
+	assert.Equal(t, []string{"b"}, ids(t, response.body))
+
+	body = `{"query":"SELECT * FROM c WHERE c.value = @missing"}`
+	response = send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", body, headers)
+	assert.Equal(t, http.StatusBadRequest, response.status)
+}
+
+func TestQueryUnknownPartitionKeyRange(t *testing.T) {
+	server := newTestServer(t, 2)
+	headers := map[string]string{"x-ms-documentdb-partitionkeyrangeid": "7"}
+	response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody("SELECT * FROM c"), headers)
+	assert.Equal(t, http.StatusGone, response.status)
+}
+
+func TestQueryAcrossPartitions(t *testing.T) {
+	var items []string
+	for i := 0; i < 10; i++ {
+		items = append(items, fmt.Sprintf(`{"id":"item%d","value":%d}`, i, i))
+	}
+	server := newTestServer(t, 3, items...)
+	server.SetPageSize(4)
+
+	// Without a partition key range, every partition's items are returned, a page at a time.
+	var all []string
+	continuation := ""
+	for {
+		headers := map[string]string{"x-ms-continuation": continuation}
+		response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody("SELECT * FROM c"), headers)
+		require.Equal(t, http.StatusOK, response.status, response.body["message"])
+		page := ids(t, response.body)
+		assert.LessOrEqual(t, len(page), 4)
+		all = append(all, page...)
+		if response.continuation == "" {
+			break
+		}
+		continuation = response.continuation
+	}
+	assert.ElementsMatch(t, []string{"item0", "item1", "item2", "item3", "item4", "item5", "item6", "item7", "item8", "item9"}, all)
+
+	// Ordering the items would require merging the partitions' results, which the gateway leaves to the SDK.
+	response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody("SELECT * FROM c ORDER BY c.value"), nil)
+	assert.Equal(t, http.StatusBadRequest, response.status)
+}
+
+func TestAddItemsDistributesByID(t *testing.T) {
+	var items []string
+	for i := 0; i < 50; i++ {
+		items = append(items, fmt.Sprintf(`{"id":"item%d"}`, i))
+	}
+	server := newTestServer(t, 4, items...)
+
+	total := 0
+	for i := 0; i < 4; i++ {
+		headers := map[string]string{"x-ms-documentdb-partitionkeyrangeid": fmt.Sprint(i)}
+		response := send(t, server, http.MethodPost, "/dbs/db/colls/c1/docs", queryBody("SELECT * FROM c"), headers)
+		count := len(ids(t, response.body))
+		assert.NotZero(t, count, "partition %d is empty", i)
+		total += count
+	}
+	assert.Equal(t, 50, total)
+
+	assert.Error(t, server.AddItems("db", "c1", `{"value":1}`))
+	assert.Error(t, server.AddItems("db", "c1", `[1]`))
+	assert.Error(t, server.AddItems("db", "missing", `{"id":"1"}`))
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// maxPooledItemBufferSize is the largest buffer (in bytes) that [ItemBuffer.Release] returns to the pool.
+// Larger buffers are left for the garbage collector, so that one large batch doesn't pin its memory for the life of the process.
+const maxPooledItemBufferSize = 4 * 1024 * 1024
+
+var itemBufferPool = sync.Pool{
+	New: func() any { return new(ItemBuffer) },
+}
+
+// ItemBuffer holds the items returned by [PooledPipeline.RunInto], reusing its memory from one call to the next.
+//
+// The items returned by RunInto are only valid until the buffer is used for another call to RunInto, or released.
+// Callers that need to retain items must copy them first, or use Run instead.
+//
+// The zero value is an empty buffer, ready to use. Buffers can also be taken from a shared pool using [AcquireItemBuffer].
+type ItemBuffer struct {
+	data     []byte
+	items    [][]byte
+	released bool
+}
+
+// AcquireItemBuffer gets an empty [ItemBuffer] from a shared pool.
+// Call [ItemBuffer.Release] to return it to the pool when you're finished with it.
+func AcquireItemBuffer() *ItemBuffer {
+	b := itemBufferPool.Get().(*ItemBuffer)
+	b.released = false
+	return b
+}
+
+// Items returns the items currently held by the buffer.
+func (b *ItemBuffer) Items() [][]byte {
+	b.checkNotReleased()
+	return b.items
+}
+
+// Release returns the buffer to the shared pool.
+// The buffer, and any items returned from it, must not be used after it's released.
+// Releasing a buffer again does nothing (or panics, with the race detector), so that the pool never hands it to two callers.
+func (b *ItemBuffer) Release() {
+	b.checkNotReleased()
+	if b.released {
+		return
+	}
+	if raceEnabled {
+		// Overwrite the released memory, so that any items used after release are obviously wrong.
+		for i := range b.data {
+			b.data[i] = releasedItemByte
+		}
+	}
+	b.items = b.items[:0]
+	b.released = true
+	if cap(b.data) <= maxPooledItemBufferSize {
+		itemBufferPool.Put(b)
+	}
+}
+
+// fill replaces the contents of the buffer with copies of the provided items.
+func (b *ItemBuffer) fill(items []EngineString) {
+	b.checkNotReleased()
+
+	size := 0
+	for _, item := range items {
+		size += int(item.len)
+	}
+	if cap(b.data) < size {
+		b.data = make([]byte, 0, size)
+	}
+	b.data = b.data[:0]
+	b.items = b.items[:0]
+	for _, item := range items {
+		start := len(b.data)
+		b.data = append(b.data, item.BorrowBytes()...)
+
+		// Limit the capacity of each item, so that appending to one can't overwrite the next.
+		b.items = append(b.items, b.data[start:len(b.data):len(b.data)])
+	}
+}
+
+func (b *ItemBuffer) checkNotReleased() {
+	if raceEnabled && b.released {
+		panic("azcosmoscx: ItemBuffer used after Release")
+	}
+}
+
+// PooledPipeline is a [queryengine.QueryPipeline] that can return items in a reusable [ItemBuffer].
+//
+// Pipelines returned by this package implement this interface.
+type PooledPipeline interface {
+	queryengine.QueryPipeline
+
+	// RunInto is equivalent to Run, but stores the items in the provided buffer instead of allocating new memory for them.
+	// The Items of the returned result share memory with the buffer, and are only valid until the buffer is reused or released.
+	RunInto(buf *ItemBuffer) (*queryengine.PipelineResult, error)
+}
+
+var _ PooledPipeline = (*clientEngineQueryPipeline)(nil)
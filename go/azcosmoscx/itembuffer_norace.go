@@ -0,0 +1,10 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+//go:build !race
+
+package azcosmoscx
+
+const raceEnabled = false
+
+const releasedItemByte = 0
@@ -0,0 +1,26 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+//go:build !race
+
+package azcosmoscx_test
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemBufferReleasedTwiceIsPooledOnce(t *testing.T) {
+	buf := azcosmoscx.AcquireItemBuffer()
+	buf.Release()
+	buf.Release()
+
+	// If the buffer were in the pool twice, both of these could get it, and overwrite each other's items.
+	first := azcosmoscx.AcquireItemBuffer()
+	defer first.Release()
+	second := azcosmoscx.AcquireItemBuffer()
+	defer second.Release()
+	assert.NotSame(t, first, second)
+}
@@ -0,0 +1,12 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+//go:build race
+
+package azcosmoscx
+
+// raceEnabled enables extra checks for misuse of pooled memory, when running with the race detector.
+const raceEnabled = true
+
+// releasedItemByte is written over the memory of a released ItemBuffer.
+const releasedItemByte = 0xDD
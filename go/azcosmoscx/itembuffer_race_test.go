@@ -0,0 +1,39 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+//go:build race
+
+package azcosmoscx_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItemBufferDetectsUseAfterRelease(t *testing.T) {
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+	pooled := pipeline.(azcosmoscx.PooledPipeline)
+
+	buf := azcosmoscx.AcquireItemBuffer()
+	_, err := pooled.RunInto(buf)
+	require.NoError(t, err)
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[12345]}`, "p0c1")})
+	require.NoError(t, err)
+	result, err := pooled.RunInto(buf)
+	require.NoError(t, err)
+	retained := result.Items[0]
+
+	buf.Release()
+
+	// The released memory is overwritten, so items retained past release don't silently keep working.
+	assert.Equal(t, bytes.Repeat([]byte{0xDD}, len("12345")), retained)
+	assert.PanicsWithValue(t, "azcosmoscx: ItemBuffer used after Release", func() { buf.Items() })
+	assert.PanicsWithValue(t, "azcosmoscx: ItemBuffer used after Release", func() { buf.Release() })
+	assert.PanicsWithValue(t, "azcosmoscx: ItemBuffer used after Release", func() { _, _ = pooled.RunInto(buf) })
+}
@@ -0,0 +1,191 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunIntoReusesBuffer(t *testing.T) {
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+	pooled, ok := pipeline.(azcosmoscx.PooledPipeline)
+	require.True(t, ok)
+
+	buf := azcosmoscx.AcquireItemBuffer()
+	defer buf.Release()
+
+	result, err := pooled.RunInto(buf)
+	require.NoError(t, err)
+	require.Len(t, result.Requests, 1)
+	assert.Empty(t, result.Items)
+
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,"two",{"three":3}]}`, "p0c1")})
+	require.NoError(t, err)
+	result, err = pooled.RunInto(buf)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte(`"two"`), []byte(`{"three":3}`)}, result.Items)
+	assert.Equal(t, result.Items, buf.Items())
+
+	// Appending to one item mustn't overwrite the next one.
+	_ = append(result.Items[0], 'x')
+	assert.Equal(t, []byte(`"two"`), result.Items[1])
+
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[4,5]}`, "")})
+	require.NoError(t, err)
+	result, err = pooled.RunInto(buf)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("4"), []byte("5")}, result.Items)
+	assert.True(t, result.IsCompleted)
+}
+
+func TestRunKeepsItemsIndependentOfBuffers(t *testing.T) {
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+	pooled := pipeline.(azcosmoscx.PooledPipeline)
+
+	_, err := pipeline.Run()
+	require.NoError(t, err)
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,2]}`, "p0c1")})
+	require.NoError(t, err)
+	retained, err := pipeline.Run()
+	require.NoError(t, err)
+
+	// Items returned by Run are unaffected by later turns that use a buffer.
+	buf := azcosmoscx.AcquireItemBuffer()
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[3,4]}`, "")})
+	require.NoError(t, err)
+	_, err = pooled.RunInto(buf)
+	require.NoError(t, err)
+	buf.Release()
+
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, retained.Items)
+}
+
+func TestRunIntoRejectsNilBuffer(t *testing.T) {
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+
+	_, err := pipeline.(azcosmoscx.PooledPipeline).RunInto(nil)
+	var engineErr *azcosmoscx.Error
+	require.ErrorAs(t, err, &engineErr)
+}
+
+// benchmarkPageItems is the number of documents in each page a benchmark provides to a pipeline.
+const benchmarkPageItems = 100
+
+// benchmarkDocumentShapes runs a sub-benchmark for each document shape, with a page of documents of that shape.
+// The bytes of each iteration are the serialized size of the documents, so the throughput is comparable across shapes.
+func benchmarkDocumentShapes(b *testing.B, bench func(b *testing.B, page string)) {
+	for _, shape := range append([]documentShape{smallDocuments}, sizedDocuments...) {
+		b.Run(shape.String(), func(b *testing.B) {
+			profileScenario(b)
+			page, size := shape.page(benchmarkPageItems)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			bench(b, page)
+		})
+	}
+}
+
+// reportBytesCloned reports the bytes of items copied into Go memory over the iterations of the benchmark, per iteration.
+func reportBytesCloned(b *testing.B, cloned int) {
+	b.ReportMetric(float64(cloned)/float64(b.N), "bytes-cloned/op")
+}
+
+// benchmarkPipelineTurns feeds a page into a single-partition pipeline and runs a turn, once per iteration, using the provided run function.
+func benchmarkPipelineTurns(b *testing.B, run func(pipeline queryengine.QueryPipeline) (*queryengine.PipelineResult, error)) {
+	benchmarkDocumentShapes(b, func(b *testing.B, page string) {
+		pipeline := newSinglePartitionPipeline(b)
+		defer pipeline.Close()
+
+		cloned := 0
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			err := pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", page, "next")})
+			require.NoError(b, err)
+			result, err := run(pipeline)
+			require.NoError(b, err)
+			require.Len(b, result.Items, benchmarkPageItems)
+			for _, item := range result.Items {
+				cloned += len(item)
+			}
+		}
+		reportBytesCloned(b, cloned)
+	})
+}
+
+func BenchmarkRun(b *testing.B) {
+	benchmarkPipelineTurns(b, func(pipeline queryengine.QueryPipeline) (*queryengine.PipelineResult, error) {
+		return pipeline.Run()
+	})
+}
+
+func BenchmarkRunInto(b *testing.B) {
+	buf := azcosmoscx.AcquireItemBuffer()
+	defer buf.Release()
+	benchmarkPipelineTurns(b, func(pipeline queryengine.QueryPipeline) (*queryengine.PipelineResult, error) {
+		return pipeline.(azcosmoscx.PooledPipeline).RunInto(buf)
+	})
+}
+
+// benchmarkNativeTurns feeds a page into a low-level single-partition pipeline and gets its next batch, once per iteration,
+// passing the result to the provided read function, which returns the number of items and their total size.
+// If the read function clones the items, that size is reported as cloned.
+// Unlike benchmarkPipelineTurns, the requests aren't converted, so this isolates the cost of reading the items.
+func benchmarkNativeTurns(b *testing.B, clones bool, read func(result *azcosmoscx.PipelineResult) (items int, size int, err error)) {
+	benchmarkDocumentShapes(b, func(b *testing.B, page string) {
+		pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"FF"}]}`
+		pipeline, err := azcosmoscx.NewPipeline("SELECT * FROM c", unorderedPlan, pkranges)
+		require.NoError(b, err)
+		defer pipeline.Free()
+
+		cloned := 0
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			err := pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", page, "next")})
+			require.NoError(b, err)
+			result, err := pipeline.NextBatch()
+			require.NoError(b, err)
+			items, size, err := read(result)
+			result.Free()
+			require.NoError(b, err)
+			require.Equal(b, benchmarkPageItems, items)
+			if clones {
+				cloned += size
+			}
+		}
+		reportBytesCloned(b, cloned)
+	})
+}
+
+// BenchmarkItemsCloned reads each batch's items by cloning them into Go memory, as Run does.
+func BenchmarkItemsCloned(b *testing.B) {
+	benchmarkNativeTurns(b, true, func(result *azcosmoscx.PipelineResult) (int, int, error) {
+		items, err := result.ItemsCloned()
+		size := 0
+		for _, item := range items {
+			size += len(item)
+		}
+		return len(items), size, err
+	})
+}
+
+// BenchmarkItemsBorrowed reads each batch's items in place, without copying them, before the batch is freed.
+// It's the lower bound of the cost of reading items, for comparison with BenchmarkItemsCloned.
+func BenchmarkItemsBorrowed(b *testing.B) {
+	benchmarkNativeTurns(b, false, func(result *azcosmoscx.PipelineResult) (int, int, error) {
+		items, err := result.Items()
+		size := 0
+		for _, item := range items {
+			size += len(item.BorrowBytes())
+		}
+		return len(items), size, err
+	})
+}
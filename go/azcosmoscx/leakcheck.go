@@ -0,0 +1,9 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+//go:build !asan
+
+package azcosmoscx
+
+// leakCheck reports leaked native memory, when built with AddressSanitizer (the asan tag). Otherwise, it does nothing.
+func leakCheck() {}
@@ -0,0 +1,16 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+//go:build asan
+
+package azcosmoscx
+
+// #cgo CFLAGS: -fsanitize=address
+// #cgo LDFLAGS: -fsanitize=address
+// void __lsan_do_leak_check(void);
+import "C"
+
+// leakCheck runs LeakSanitizer, which reports any leaked native memory and exits the process.
+func leakCheck() {
+	C.__lsan_do_leak_check()
+}
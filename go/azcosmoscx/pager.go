@@ -0,0 +1,182 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// ErrNoMorePages is returned by [Pager.Next] once the query has completed and its last page has been returned.
+var ErrNoMorePages = errors.New("no more pages")
+
+// FetchFunc fetches the data for a request made by a pipeline, by executing the request's query against its partition key range.
+//
+// The returned result's partition key range ID should be the request's, and its continuation the one returned by the gateway.
+type FetchFunc func(ctx context.Context, request queryengine.QueryRequest) (queryengine.QueryResult, error)
+
+// PagerOptions configures a [Pager].
+type PagerOptions struct {
+	// MaxConcurrentRequests is the maximum number of requests the pager fetches at the same time.
+	// If zero or negative, all the requests the pipeline makes in a turn are fetched at the same time.
+	//
+	// The pipeline decides how many requests it makes in each turn (see [WithMaxConcurrentPartitions]), so this only limits how many of those are in flight.
+	MaxConcurrentRequests int
+}
+
+// Pager drives a query pipeline to completion without the azcosmos SDK, calling a [FetchFunc] to fetch the data the pipeline requests,
+// and returning the items it produces a page at a time.
+//
+// The pager owns the pipeline: it closes the pipeline when the query completes or fails, or when [Pager.Close] is called.
+// A Pager isn't safe for concurrent use.
+type Pager struct {
+	pipeline      queryengine.QueryPipeline
+	fetch         FetchFunc
+	maxConcurrent int
+
+	// pending holds the requests made by the last turn, which haven't been fetched yet.
+	pending []queryengine.QueryRequest
+
+	done bool
+	err  error
+}
+
+// NewPager creates a pager that runs the pipeline, fetching its data with fetch. The options may be nil.
+func NewPager(pipeline queryengine.QueryPipeline, fetch FetchFunc, options *PagerOptions) *Pager {
+	if options == nil {
+		options = &PagerOptions{}
+	}
+	return &Pager{
+		pipeline:      pipeline,
+		fetch:         fetch,
+		maxConcurrent: max(options.MaxConcurrentRequests, 0),
+	}
+}
+
+// More reports whether there may be more pages, meaning that the query hasn't completed or failed.
+func (p *Pager) More() bool {
+	return !p.done
+}
+
+// Next returns the next page of items, running the pipeline and fetching the data it requests until it produces items or completes.
+//
+// The last page may be empty. Once it's been returned, Next returns [ErrNoMorePages].
+// If running the pipeline, fetching data, or providing it fails, or ctx is done, the error is returned, the pipeline is closed,
+// and every later call to Next returns the same error. So is a turn that neither completes the query, produces items, nor requests data,
+// since running the pipeline again wouldn't make any more progress.
+func (p *Pager) Next(ctx context.Context) ([][]byte, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.done {
+		return nil, ErrNoMorePages
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, p.fail(err)
+		}
+
+		if len(p.pending) > 0 {
+			responses, err := p.fetchAll(ctx, p.pending)
+			if err != nil {
+				return nil, p.fail(err)
+			}
+			p.pending = nil
+			if err := p.pipeline.ProvideData(responses); err != nil {
+				return nil, p.fail(err)
+			}
+		}
+
+		result, err := p.pipeline.Run()
+		if err != nil {
+			return nil, p.fail(err)
+		}
+		if result.IsCompleted {
+			p.done = true
+			p.pipeline.Close()
+			return result.Items, nil
+		}
+
+		if len(result.Items) == 0 && len(result.Requests) == 0 {
+			return nil, p.fail(errors.New("azcosmoscx: pipeline made no progress"))
+		}
+
+		// The requests are fetched by the next call, so that the items are returned even if fetching fails.
+		p.pending = result.Requests
+		if len(result.Items) > 0 {
+			return result.Items, nil
+		}
+	}
+}
+
+// Close closes the pipeline, if the query hasn't already completed or failed. Later calls to Next return [ErrNoMorePages].
+func (p *Pager) Close() {
+	if !p.done {
+		p.done = true
+		p.pipeline.Close()
+	}
+}
+
+// fail closes the pipeline and records err, to be returned by every later call to Next.
+func (p *Pager) fail(err error) error {
+	p.Close()
+	p.err = err
+	return err
+}
+
+// fetchAll fetches the data for the requests, at most maxConcurrent at a time, returning the results in the same order as the requests.
+// If any fetch fails, the context passed to the others is canceled, and the first error is returned.
+func (p *Pager) fetchAll(ctx context.Context, requests []queryengine.QueryRequest) ([]queryengine.QueryResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limit := p.maxConcurrent
+	if limit == 0 || limit > len(requests) {
+		limit = len(requests)
+	}
+	slots := make(chan struct{}, limit)
+
+	results := make([]queryengine.QueryResult, len(requests))
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i, request := range requests {
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result, err := p.fetch(ctx, request)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("failed to fetch data for partition key range %q: %w", request.PartitionKeyRangeID, err)
+					cancel()
+				})
+				return
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
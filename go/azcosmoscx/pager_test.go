@@ -0,0 +1,275 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockPartitions holds the pages of documents of each partition key range, as the "Documents" JSON array of each page.
+type mockPartitions map[string][]string
+
+// fetch returns the page of the request's partition key range identified by its continuation, which is the page's index.
+func (m mockPartitions) fetch(ctx context.Context, request queryengine.QueryRequest) (queryengine.QueryResult, error) {
+	pages, ok := m[request.PartitionKeyRangeID]
+	if !ok {
+		return queryengine.QueryResult{}, fmt.Errorf("unknown partition key range %q", request.PartitionKeyRangeID)
+	}
+	page := 0
+	if request.Continuation != "" {
+		var err error
+		if page, err = strconv.Atoi(request.Continuation); err != nil {
+			return queryengine.QueryResult{}, err
+		}
+	}
+	continuation := ""
+	if page+1 < len(pages) {
+		continuation = strconv.Itoa(page + 1)
+	}
+	return queryengine.NewQueryResultString(request.PartitionKeyRangeID, `{"Documents":`+pages[page]+`}`, continuation), nil
+}
+
+// newMockPartitionRanges returns count partition key ranges, named "partition0" onwards, that evenly cover the key space.
+//
+// The bounds have four hex digits, so that every range is non-empty for thousands of partitions: with two, there's no room for a 256th range below the maximum, "FF",
+// which sorts before any longer bound starting with FF.
+func newMockPartitionRanges(count int) []azcosmoscx.PartitionKeyRange {
+	ranges := make([]azcosmoscx.PartitionKeyRange, count)
+	width := 0xFF00 / count
+	for i := range ranges {
+		ranges[i] = azcosmoscx.PartitionKeyRange{
+			ID:           fmt.Sprintf("partition%d", i),
+			MinInclusive: fmt.Sprintf("%04X", i*width),
+			MaxExclusive: fmt.Sprintf("%04X", (i+1)*width),
+		}
+	}
+	ranges[0].MinInclusive = ""
+	ranges[count-1].MaxExclusive = "FF"
+	return ranges
+}
+
+func TestMockPartitionRangesAreValid(t *testing.T) {
+	for _, count := range []int{1, 3, 256, 1000} {
+		pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(count))
+		require.NoError(t, err, "%d partitions", count)
+		pipeline.Close()
+	}
+}
+
+const unorderedPlan = `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+
+// collectPages calls Next until the pager has no more pages, returning the items of every page.
+func collectPages(t testing.TB, pager *azcosmoscx.Pager) [][]byte {
+	var items [][]byte
+	for pager.More() {
+		page, err := pager.Next(context.Background())
+		require.NoError(t, err)
+		items = append(items, page...)
+	}
+	_, err := pager.Next(context.Background())
+	require.ErrorIs(t, err, azcosmoscx.ErrNoMorePages)
+	return items
+}
+
+func TestPagerRunsQueryToCompletion(t *testing.T) {
+	partitions := mockPartitions{
+		"partition0": {`[1,2]`, `[]`, `[3]`},
+		"partition1": {`[4]`},
+		"partition2": {`[5,6]`, `[7]`},
+	}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(3))
+	require.NoError(t, err)
+
+	pager := azcosmoscx.NewPager(pipeline, partitions.fetch, nil)
+	items := collectPages(t, pager)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2"), []byte("3"), []byte("4"), []byte("5"), []byte("6"), []byte("7")}, items)
+	assert.True(t, pipeline.IsComplete())
+}
+
+func TestPagerLimitsConcurrentRequests(t *testing.T) {
+	const partitionCount = 8
+	partitions := mockPartitions{}
+	for i := 0; i < partitionCount; i++ {
+		partitions[fmt.Sprintf("partition%d", i)] = []string{fmt.Sprintf("[%d]", i), fmt.Sprintf("[%d]", i+partitionCount)}
+	}
+
+	for _, limit := range []int{1, 3, 0} {
+		t.Run(fmt.Sprintf("MaxConcurrentRequests=%d", limit), func(t *testing.T) {
+			pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(partitionCount), azcosmoscx.WithMaxConcurrentPartitions(0))
+			require.NoError(t, err)
+
+			var inflight, peak atomic.Int32
+			fetch := func(ctx context.Context, request queryengine.QueryRequest) (queryengine.QueryResult, error) {
+				current := inflight.Add(1)
+				defer inflight.Add(-1)
+				for {
+					previous := peak.Load()
+					if current <= previous || peak.CompareAndSwap(previous, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				return partitions.fetch(ctx, request)
+			}
+
+			pager := azcosmoscx.NewPager(pipeline, fetch, &azcosmoscx.PagerOptions{MaxConcurrentRequests: limit})
+			items := collectPages(t, pager)
+
+			// Items are returned in partition order, regardless of the order the requests complete in.
+			expected := make([][]byte, 0, 2*partitionCount)
+			for i := 0; i < partitionCount; i++ {
+				expected = append(expected, []byte(strconv.Itoa(i)), []byte(strconv.Itoa(i+partitionCount)))
+			}
+			assert.Equal(t, expected, items)
+
+			if limit > 0 {
+				assert.LessOrEqual(t, peak.Load(), int32(limit))
+			} else {
+				assert.Greater(t, peak.Load(), int32(1))
+			}
+		})
+	}
+}
+
+func TestPagerPropagatesFetchErrors(t *testing.T) {
+	partitions := mockPartitions{
+		"partition0": {`[1]`, `[2]`},
+		"partition1": {`[3]`},
+	}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(2))
+	require.NoError(t, err)
+
+	injected := errors.New("gateway unavailable")
+	fetch := func(ctx context.Context, request queryengine.QueryRequest) (queryengine.QueryResult, error) {
+		if request.PartitionKeyRangeID == "partition1" {
+			return queryengine.QueryResult{}, injected
+		}
+		return partitions.fetch(ctx, request)
+	}
+
+	pager := azcosmoscx.NewPager(pipeline, fetch, nil)
+	var items [][]byte
+	for {
+		page, err := pager.Next(context.Background())
+		if err != nil {
+			require.ErrorIs(t, err, injected)
+			assert.Contains(t, err.Error(), `"partition1"`)
+			break
+		}
+		items = append(items, page...)
+	}
+
+	// The items that could be fetched are returned before the error, and the pipeline is closed after it.
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, items)
+	assert.False(t, pager.More())
+	assert.True(t, pipeline.IsComplete())
+
+	_, err = pager.Next(context.Background())
+	assert.ErrorIs(t, err, injected)
+}
+
+func TestPagerCancelsPendingFetchesAfterError(t *testing.T) {
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(4), azcosmoscx.WithMaxConcurrentPartitions(0))
+	require.NoError(t, err)
+
+	injected := errors.New("request failed")
+	var canceled atomic.Int32
+	fetch := func(ctx context.Context, request queryengine.QueryRequest) (queryengine.QueryResult, error) {
+		if request.PartitionKeyRangeID == "partition0" {
+			return queryengine.QueryResult{}, injected
+		}
+		select {
+		case <-ctx.Done():
+			canceled.Add(1)
+			return queryengine.QueryResult{}, ctx.Err()
+		case <-time.After(10 * time.Second):
+			return queryengine.QueryResult{}, errors.New("fetch wasn't canceled")
+		}
+	}
+
+	pager := azcosmoscx.NewPager(pipeline, fetch, nil)
+	_, err = pager.Next(context.Background())
+	require.ErrorIs(t, err, injected)
+	assert.Equal(t, int32(3), canceled.Load())
+}
+
+func TestPagerStopsWhenContextIsDone(t *testing.T) {
+	partitions := mockPartitions{"partition0": {`[1]`, `[2]`}}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(1))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pager := azcosmoscx.NewPager(pipeline, partitions.fetch, nil)
+	page, err := pager.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1")}, page)
+
+	cancel()
+	_, err = pager.Next(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.True(t, pipeline.IsComplete())
+}
+
+// stalledPipeline is a pipeline whose turns never complete, produce items, or make requests.
+type stalledPipeline struct {
+	runs   int
+	closed bool
+}
+
+func (p *stalledPipeline) Query() string    { return "SELECT * FROM c" }
+func (p *stalledPipeline) IsComplete() bool { return false }
+func (p *stalledPipeline) Run() (*queryengine.PipelineResult, error) {
+	p.runs++
+	return &queryengine.PipelineResult{}, nil
+}
+func (p *stalledPipeline) ProvideData(data []queryengine.QueryResult) error { return nil }
+func (p *stalledPipeline) Close()                                           { p.closed = true }
+
+func TestPagerFailsWhenPipelineMakesNoProgress(t *testing.T) {
+	pipeline := &stalledPipeline{}
+	pager := azcosmoscx.NewPager(pipeline, func(ctx context.Context, request queryengine.QueryRequest) (queryengine.QueryResult, error) {
+		return queryengine.QueryResult{}, errors.New("unexpected fetch")
+	}, nil)
+
+	_, err := pager.Next(context.Background())
+	require.EqualError(t, err, "azcosmoscx: pipeline made no progress")
+	assert.Equal(t, 1, pipeline.runs)
+	assert.True(t, pipeline.closed)
+	assert.False(t, pager.More())
+
+	// The error is returned again, without running the pipeline.
+	_, err = pager.Next(context.Background())
+	require.EqualError(t, err, "azcosmoscx: pipeline made no progress")
+	assert.Equal(t, 1, pipeline.runs)
+}
+
+func TestPagerClose(t *testing.T) {
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(1))
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	pager := azcosmoscx.NewPager(pipeline, func(ctx context.Context, request queryengine.QueryRequest) (queryengine.QueryResult, error) {
+		fetches.Add(1)
+		return queryengine.QueryResult{}, errors.New("unexpected fetch")
+	}, nil)
+	pager.Close()
+	pager.Close()
+
+	assert.False(t, pager.More())
+	assert.True(t, pipeline.IsComplete())
+	_, err = pager.Next(context.Background())
+	assert.ErrorIs(t, err, azcosmoscx.ErrNoMorePages)
+	assert.Zero(t, fetches.Load())
+}
@@ -24,12 +24,51 @@ func newPipeline(query string, queryPlan string, partitionKeyRanges string) (*Pi
 	queryPlanC := makeStr(queryPlan)
 	pkRangesC := makeStr(partitionKeyRanges)
 
-	r := C.cosmoscx_v0_query_pipeline_create(queryC, queryPlanC, pkRangesC)
-	if err := mapErr(r.code); err != nil {
-		return nil, err
+	return createPipeline(func() C.CosmosCxFfiResult_Pipeline {
+		return C.cosmoscx_v0_query_pipeline_create(queryC, queryPlanC, pkRangesC)
+	})
+}
+
+func newPipelineForPartitionKey(query string, queryPlan string, partitionKeyRanges string, partitionKey string, partitionKeyDefinition string) (*Pipeline, error) {
+	queryC := makeStr(query)
+	queryPlanC := makeStr(queryPlan)
+	pkRangesC := makeStr(partitionKeyRanges)
+	partitionKeyC := makeStr(partitionKey)
+	partitionKeyDefinitionC := makeStr(partitionKeyDefinition)
+
+	return createPipeline(func() C.CosmosCxFfiResult_Pipeline {
+		return C.cosmoscx_v0_query_pipeline_create_for_partition_key(queryC, queryPlanC, pkRangesC, partitionKeyC, partitionKeyDefinitionC)
+	})
+}
+
+func newPipelineForEffectivePartitionKey(query string, queryPlan string, partitionKeyRanges string, epk string) (*Pipeline, error) {
+	queryC := makeStr(query)
+	queryPlanC := makeStr(queryPlan)
+	pkRangesC := makeStr(partitionKeyRanges)
+	epkC := makeStr(epk)
+
+	return createPipeline(func() C.CosmosCxFfiResult_Pipeline {
+		return C.cosmoscx_v0_query_pipeline_create_for_epk(queryC, queryPlanC, pkRangesC, epkC)
+	})
+}
+
+// createPipeline calls one of the engine's pipeline creation functions, including the engine's description of the problem in any error it returns.
+//
+// The description names the offending input, such as a partition key range with a duplicate ID, which the error code alone doesn't identify.
+func createPipeline(create func() C.CosmosCxFfiResult_Pipeline) (*Pipeline, error) {
+	// The engine's description of an error is stored per-thread, so stay on this thread until we've retrieved it.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	r := create()
+	if r.code != C.COSMOS_CX_RESULT_CODE_SUCCESS {
+		return nil, &Error{code: r.code, message: lastErrorMessage()}
 	}
 
-	return &Pipeline{r.value}, nil
+	// Free the native pipeline if it's abandoned without being freed, for example by a caller that stops iterating the SDK's pager early.
+	// Methods that pass the native pipeline to the engine keep the Pipeline alive until the call returns, so it isn't freed during the call.
+	pipeline := &Pipeline{r.value}
+	runtime.SetFinalizer(pipeline, (*Pipeline).Free)
+	return pipeline, nil
 }
 
 // IsFreed returns a boolean indicating whether the pipeline has been freed.
@@ -48,6 +87,7 @@ func (p *Pipeline) Free() {
 
 // Query gets the, possibly rewritten, query that should be used when issuing queries to satisfy DataRequests.
 func (p *Pipeline) Query() (string, error) {
+	defer runtime.KeepAlive(p)
 	r := C.cosmoscx_v0_query_pipeline_query(p.ptr)
 	if err := mapErr(r.code); err != nil {
 		return "", err
@@ -58,7 +98,45 @@ func (p *Pipeline) Query() (string, error) {
 	return strings.Clone(s), nil
 }
 
+// Explain returns a human-readable description of how the engine constructed the pipeline from the query plan, for debugging.
+func (p *Pipeline) Explain() (string, error) {
+	defer runtime.KeepAlive(p)
+	r := C.cosmoscx_v0_query_pipeline_explain(p.ptr)
+	if err := mapErr(r.code); err != nil {
+		return "", err
+	}
+	defer C.cosmoscx_v0_query_pipeline_free_explanation(r.value)
+
+	// Clone the string into Go memory
+	return EngineString(*r.value).CloneString(), nil
+}
+
+// SetMaxConcurrentPartitions sets the maximum number of partitions that the pipeline requests data for in a single turn, or 0 for no limit.
+func (p *Pipeline) SetMaxConcurrentPartitions(max uint32) error {
+	defer runtime.KeepAlive(p)
+	return mapErr(C.cosmoscx_v0_query_pipeline_set_max_concurrent_partitions(p.ptr, C.uint32_t(max)))
+}
+
+// SetTargetBatchSize sets the number of items the consumer wants from each call to NextBatch, or 0 if it has no preference.
+func (p *Pipeline) SetTargetBatchSize(target uint32) error {
+	defer runtime.KeepAlive(p)
+	return mapErr(C.cosmoscx_v0_query_pipeline_set_target_batch_size(p.ptr, C.uint32_t(target)))
+}
+
+// SetMaxBufferedItems sets the maximum number of items the pipeline may buffer while it waits for every partition to be drained, or 0 for no limit.
+func (p *Pipeline) SetMaxBufferedItems(max uint32) error {
+	defer runtime.KeepAlive(p)
+	return mapErr(C.cosmoscx_v0_query_pipeline_set_max_buffered_items(p.ptr, C.uint32_t(max)))
+}
+
+// Drain stops the pipeline from fetching any more data, so that it only produces the items it has already buffered.
+func (p *Pipeline) Drain() error {
+	defer runtime.KeepAlive(p)
+	return mapErr(C.cosmoscx_v0_query_pipeline_drain(p.ptr))
+}
+
 func (p *Pipeline) NextBatch() (*PipelineResult, error) {
+	defer runtime.KeepAlive(p)
 	r := C.cosmoscx_v0_query_pipeline_run(p.ptr)
 	if err := mapErr(r.code); err != nil {
 		return nil, err
@@ -68,7 +146,20 @@ func (p *Pipeline) NextBatch() (*PipelineResult, error) {
 }
 
 func (p *Pipeline) ProvideData(results []queryengine.QueryResult) error {
-	if len(results) == 0 {
+	return p.provideData(len(results), func(i int) (queryengine.QueryResult, ContentEncoding) {
+		return results[i], ContentEncodingIdentity
+	})
+}
+
+// ProvideEncodedData provides data whose bodies may be encoded (for example, compressed with gzip), for the engine to decode.
+func (p *Pipeline) ProvideEncodedData(results []EncodedQueryResult) error {
+	return p.provideData(len(results), func(i int) (queryengine.QueryResult, ContentEncoding) {
+		return results[i].QueryResult, results[i].ContentEncoding
+	})
+}
+
+func (p *Pipeline) provideData(count int, result func(i int) (queryengine.QueryResult, ContentEncoding)) error {
+	if count == 0 {
 		return nil
 	}
 
@@ -77,19 +168,23 @@ func (p *Pipeline) ProvideData(results []queryengine.QueryResult) error {
 	var pinner runtime.Pinner
 	defer pinner.Unpin()
 
-	resultsC := make([]C.CosmosCxQueryResponse, len(results))
-	for i, result := range results {
+	resultsC := make([]C.CosmosCxQueryResponse, count)
+	for i := range resultsC {
+		result, encoding := result(i)
+
 		// We need to pin these strings because they're held within a C struct.
 		// Normally, the values passed DIRECTLY in to cgo functions are pinned automatically,
 		// but here we're building an array of structs to pass in, so we need to pin them ourselves.
 		pkrangeidC := makeStrPinned(result.PartitionKeyRangeID, &pinner)
-		dataC := makeStrPinned(string(result.Data), &pinner)
+		dataC := makeBytesPinned(result.Data, &pinner)
 		continuationC := makeStrPinned(result.NextContinuation, &pinner)
+		encodingC := makeStrPinned(string(encoding), &pinner)
 		resultsC[i] = C.CosmosCxQueryResponse{
-			request_id:   C.uint64_t(result.RequestId),
-			pkrange_id:   pkrangeidC,
-			data:         dataC,
-			continuation: continuationC,
+			request_id:       C.uint64_t(result.RequestId),
+			pkrange_id:       pkrangeidC,
+			data:             dataC,
+			continuation:     continuationC,
+			content_encoding: encodingC,
 		}
 	}
 
@@ -98,7 +193,16 @@ func (p *Pipeline) ProvideData(results []queryengine.QueryResult) error {
 		len:  C.uintptr_t(len(resultsC)),
 	}
 
-	return mapErr(C.cosmoscx_v0_query_pipeline_provide_data(p.ptr, slice))
+	// The engine's description of an error is stored per-thread, so stay on this thread until we've retrieved it.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	code := C.cosmoscx_v0_query_pipeline_provide_data(p.ptr, slice)
+	runtime.KeepAlive(p)
+	if code != C.COSMOS_CX_RESULT_CODE_SUCCESS {
+		// The code alone doesn't say what was wrong with the data, such as a truncated response or a continuation from another partition, so include the engine's description of it.
+		return &Error{code: code, message: lastErrorMessage()}
+	}
+	return nil
 }
 
 type PipelineResult struct {
@@ -121,7 +225,7 @@ func (r *PipelineResult) IsCompleted() bool {
 
 func (r *PipelineResult) Items() ([]EngineString, error) {
 	if r.ptr == nil {
-		return nil, &Error{C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL}
+		return nil, &Error{code: C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL}
 	}
 	ptr := (*EngineString)(r.ptr.items.data)
 	return unsafe.Slice(ptr, r.ptr.items.len), nil
@@ -142,7 +246,7 @@ func (r *PipelineResult) ItemsCloned() ([][]byte, error) {
 
 func (r *PipelineResult) Requests() ([]DataRequest, error) {
 	if r.ptr == nil {
-		return nil, &Error{C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL}
+		return nil, &Error{code: C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL}
 	}
 	ptr := (*DataRequest)(r.ptr.requests.data)
 	return unsafe.Slice(ptr, r.ptr.requests.len), nil
@@ -180,6 +284,8 @@ func (r *DataRequest) Id() uint64 {
 	return uint64(r.id)
 }
 
+// Query gets the query to execute for this request, or an empty string if the pipeline's query (see [Pipeline.Query]) should be used.
+// The requests returned by the queryengine.QueryPipeline of [CreateQueryPipeline] always carry a query, falling back to the pipeline's.
 func (r *DataRequest) Query() EngineString {
 	return EngineString(r.query)
 }
@@ -195,3 +301,13 @@ func (r *DataRequest) PartitionKeyRangeID() EngineString {
 func (r *DataRequest) Continuation() EngineString {
 	return EngineString(r.continuation)
 }
+
+// EpkRange gets the range of effective partition key (EPK) values this request is scoped to.
+//
+// If ok is false, the request covers the entire partition key range and the other values should be ignored.
+func (r *DataRequest) EpkRange() (min EngineString, max EngineString, minInclusive bool, maxInclusive bool, ok bool) {
+	if r.epk_max.len == 0 {
+		return EngineString{}, EngineString{}, false, false, false
+	}
+	return EngineString(r.epk_min), EngineString(r.epk_max), bool(r.epk_min_inclusive), bool(r.epk_max_inclusive), true
+}
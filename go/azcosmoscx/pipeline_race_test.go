@@ -0,0 +1,149 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests are most useful with the race detector enabled (`go test -race`), which checks that the wrapper's use of shared state is synchronized.
+const (
+	raceWorkers          = 8
+	raceQueriesPerWorker = 10
+)
+
+// TestConcurrentPipelines runs queries on several goroutines at once through a shared engine, with tracing enabled,
+// while another goroutine calls the package-level functions and creates and destroys more pipelines.
+func TestConcurrentPipelines(t *testing.T) {
+	engine := azcosmoscx.NewQueryEngineWithCache(azcosmoscx.CacheOptions{})
+	pkranges, err := json.Marshal(map[string]any{"PartitionKeyRanges": newMockPartitionRanges(3)})
+	require.NoError(t, err)
+
+	queriesPerWorker := raceQueriesPerWorker
+	if testing.Short() {
+		queriesPerWorker = 2
+	}
+
+	stop := make(chan struct{})
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			azcosmoscx.EnableTracing()
+			azcosmoscx.PublishExpvar()
+			assert.NotEmpty(t, azcosmoscx.Version())
+			assert.NotEmpty(t, azcosmoscx.SupportedFeatures())
+			assert.True(t, azcosmoscx.SupportedFeatureSet().OrderBy)
+			assert.NotEmpty(t, expvar.Get("azcosmoscx").String())
+
+			pipeline, err := engine.CreateQueryPipeline("SELECT * FROM c", unorderedPlan, string(pkranges))
+			if assert.NoError(t, err) {
+				pipeline.Close()
+			}
+
+			// Abandon a pipeline, and collect it, so that finalizers run alongside the queries.
+			_, err = engine.CreateQueryPipeline("SELECT * FROM c", unorderedPlan, string(pkranges))
+			assert.NoError(t, err)
+			runtime.GC()
+		}
+	}()
+
+	var workers sync.WaitGroup
+	for worker := 0; worker < raceWorkers; worker++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for query := 0; query < queriesPerWorker; query++ {
+				runConcurrentQuery(t, engine, fmt.Sprintf("container%d", worker%2), string(pkranges))
+			}
+		}()
+	}
+	workers.Wait()
+	close(stop)
+	background.Wait()
+}
+
+// runConcurrentQuery runs a query to completion, providing data on one goroutine and consuming items on another, as callers that fetch and process concurrently do.
+// It reports failures with assert, since it's called from goroutines other than the test's.
+func runConcurrentQuery(t *testing.T, engine azcosmoscx.CachingQueryEngine, container string, pkranges string) {
+	partitions := mockPartitions{
+		"partition0": {`[1,2]`, `[3]`},
+		"partition1": {`[4]`},
+		"partition2": {`[]`, `[5,6]`},
+	}
+	pipeline, err := engine.CreateCachedQueryPipeline(container, "SELECT * FROM c",
+		func() (string, error) { return unorderedPlan, nil },
+		func() (string, error) { return pkranges, nil })
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pipeline.Close()
+
+	items := make(chan []byte)
+	sum := make(chan int)
+	go func() {
+		total := 0
+		for item := range items {
+			var value int
+			assert.NoError(t, json.Unmarshal(item, &value))
+			total += value
+		}
+		sum <- total
+	}()
+
+	requests := make(chan queryengine.QueryRequest)
+	provided := make(chan error)
+	go func() {
+		for request := range requests {
+			result, err := partitions.fetch(context.Background(), request)
+			if err == nil {
+				err = pipeline.ProvideData([]queryengine.QueryResult{result})
+			}
+			provided <- err
+		}
+	}()
+
+	defer func() {
+		close(requests)
+		close(items)
+		assert.Equal(t, 21, <-sum)
+	}()
+	for turns := 0; !pipeline.IsComplete(); turns++ {
+		if !assert.Less(t, turns, maxRecordedTurns, "pipeline didn't complete") {
+			return
+		}
+		result, err := pipeline.Run()
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, item := range result.Items {
+			items <- item
+		}
+		for _, request := range result.Requests {
+			requests <- request
+			if !assert.NoError(t, <-provided) {
+				return
+			}
+		}
+		assert.NotZero(t, pipeline.(azcosmoscx.StatsReporter).Stats().Turns)
+	}
+}
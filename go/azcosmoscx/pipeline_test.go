@@ -4,10 +4,22 @@
 package azcosmoscx_test
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,7 +32,7 @@ func init() {
 
 func TestAllocAndFree(t *testing.T) {
 	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
-	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"00","maxExclusive":"FF"}]}`
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"FF"}]}`
 	pipeline, err := azcosmoscx.NewQueryEngine().CreateQueryPipeline("SELECT * FROM c", plan, pkranges)
 	require.NoError(t, err)
 	defer pipeline.Close()
@@ -31,7 +43,7 @@ func TestAllocAndFree(t *testing.T) {
 
 func TestRewrittenQuery(t *testing.T) {
 	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{"rewrittenQuery": "WE REWRITTEN"}, "queryRanges": []}`
-	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"00","maxExclusive":"FF"}]}`
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"FF"}]}`
 	pipeline, err := azcosmoscx.NewQueryEngine().CreateQueryPipeline("SELECT * FROM c", plan, pkranges)
 	require.NoError(t, err)
 	defer pipeline.Close()
@@ -41,9 +53,43 @@ func TestRewrittenQuery(t *testing.T) {
 	assert.Equal(t, "WE REWRITTEN", pipelineQuery)
 }
 
+func TestExplain(t *testing.T) {
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"80"},{"id":"partition1","minInclusive":"80","maxExclusive":"FF"}]}`
+	cases := []struct {
+		name     string
+		plan     string
+		expected []string
+	}{
+		{
+			"Unordered",
+			`{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{"offset":5,"limit":10}, "queryRanges": []}`,
+			[]string{"Producer: Unordered", "Sort keys: 0", "Limit(10)", "Offset(5)", "partition0 ['', '80')", "partition1 ['80', 'FF')"},
+		},
+		{
+			"OrderBy",
+			`{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{"orderBy":["Ascending","Descending"],"rewrittenQuery":"SELECT REWRITTEN"}, "queryRanges": []}`,
+			[]string{"Query: SELECT REWRITTEN", "Producer: StreamingOrderBy", "Sort keys: 2"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pipeline, err := azcosmoscx.NewQueryEngine().CreateQueryPipeline("SELECT * FROM c", c.plan, pkranges)
+			require.NoError(t, err)
+			defer pipeline.Close()
+
+			explanation, err := pipeline.(azcosmoscx.ExplainablePipeline).Explain()
+			require.NoError(t, err)
+			for _, expected := range c.expected {
+				assert.Contains(t, explanation, expected)
+			}
+		})
+	}
+}
+
 func TestEmptyPipelineReturnsRequests(t *testing.T) {
 	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
-	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"00","maxExclusive":"99"},{"id":"partition1","minInclusive":"99","maxExclusive":"FF"}]}`
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"99"},{"id":"partition1","minInclusive":"99","maxExclusive":"FF"}]}`
 	pipeline, err := azcosmoscx.NewQueryEngine().CreateQueryPipeline("SELECT * FROM c", plan, pkranges)
 	require.NoError(t, err)
 	defer pipeline.Close()
@@ -63,9 +109,147 @@ func TestEmptyPipelineReturnsRequests(t *testing.T) {
 	}
 }
 
+func TestRequestsCarryTheirQuery(t *testing.T) {
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"99"},{"id":"partition1","minInclusive":"99","maxExclusive":"FF"}]}`
+
+	t.Run("Unordered", func(t *testing.T) {
+		pipeline, err := azcosmoscx.CreateQueryPipeline("SELECT * FROM c", unorderedPlan, pkranges)
+		require.NoError(t, err)
+		defer pipeline.Close()
+
+		result, err := pipeline.Run()
+		require.NoError(t, err)
+		require.NotEmpty(t, result.Requests)
+		for _, request := range result.Requests {
+			assert.Equal(t, "SELECT * FROM c", request.Query)
+			assert.True(t, request.IncludeParameters)
+		}
+	})
+
+	t.Run("RewrittenByPlan", func(t *testing.T) {
+		pipeline, err := azcosmoscx.CreateQueryPipeline("SELECT * FROM c ORDER BY c.value", orderedPlan("ASC", ""), pkranges)
+		require.NoError(t, err)
+		defer pipeline.Close()
+
+		result, err := pipeline.Run()
+		require.NoError(t, err)
+		require.Len(t, result.Requests, 2)
+		for _, request := range result.Requests {
+			assert.Equal(t, pipeline.Query(), request.Query)
+			assert.Contains(t, request.Query, "orderByItems")
+		}
+	})
+
+	t.Run("HybridSearch", func(t *testing.T) {
+		// Hybrid search requests have queries of their own, starting with the one that gathers the global statistics.
+		const statisticsQuery = "SELECT COUNT(1) AS documentCount, [] AS fullTextStatistics FROM c"
+		plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryRanges": [], "hybridSearchQueryInfo": {` +
+			`"globalStatisticsQuery": "` + statisticsQuery + `", "requiresGlobalStatistics": true, "take": 10, ` +
+			`"componentQueryInfos": [{"orderBy": ["Descending"], "orderByExpressions": ["_FullTextScore(c.text, ['cosmos'])"], "rewrittenQuery": "SELECT c._rid, [] AS orderByItems, c AS payload FROM c", "hasNonStreamingOrderBy": true}]}}`
+		pipeline, err := azcosmoscx.CreateQueryPipeline("SELECT TOP 10 * FROM c ORDER BY RANK FullTextScore(c.text, ['cosmos'])", plan, pkranges)
+		require.NoError(t, err)
+		defer pipeline.Close()
+
+		result, err := pipeline.Run()
+		require.NoError(t, err)
+		require.Len(t, result.Requests, 2)
+		for _, request := range result.Requests {
+			assert.Equal(t, statisticsQuery, request.Query)
+		}
+	})
+}
+
+func TestPinnedPartitionKeyReturnsSingleRequest(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": [{"min":"55","max":"55","isMinInclusive":true,"isMaxInclusive":true}]}`
+	ranges := make([]azcosmoscx.PartitionKeyRange, 10)
+	for i := range ranges {
+		ranges[i] = azcosmoscx.PartitionKeyRange{
+			ID:           fmt.Sprintf("partition%d", i),
+			MinInclusive: fmt.Sprintf("%d0", i),
+			MaxExclusive: fmt.Sprintf("%d0", i+1),
+		}
+	}
+	ranges[0].MinInclusive = ""
+	ranges[9].MaxExclusive = "FF"
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c WHERE c.pk = 'pinned'", plan, ranges)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+
+	require.Len(t, result.Requests, 1)
+	assert.Equal(t, "partition5", result.Requests[0].PartitionKeyRangeID)
+}
+
+func TestPartitionKeyScopedPipeline(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": [{"min":"","max":"FF","isMinInclusive":true,"isMaxInclusive":false}]}`
+	cases := []struct {
+		name         string
+		pkranges     string
+		partitionKey string
+		version      int
+		expectedID   string
+		expectedEpk  string
+	}{
+		{
+			name:         "HashV1",
+			pkranges:     `{"PartitionKeyRanges":[{"id":"pk1","minInclusive":"","maxExclusive":"05C1D"},{"id":"pk2","minInclusive":"05C1D","maxExclusive":"05C1E2"},{"id":"pk3","minInclusive":"05C1E2","maxExclusive":"FF"}]}`,
+			partitionKey: `["partitionKey"]`,
+			version:      1,
+			expectedID:   "pk2",
+			expectedEpk:  "05C1E1B3D9CD2608716273756A756A706F4C667A00",
+		},
+		{
+			name:         "HashV2",
+			pkranges:     `{"PartitionKeyRanges":[{"id":"pk1","minInclusive":"","maxExclusive":"10"},{"id":"pk2","minInclusive":"10","maxExclusive":"20"},{"id":"pk3","minInclusive":"20","maxExclusive":"30"},{"id":"pk4","minInclusive":"30","maxExclusive":"FF"}]}`,
+			partitionKey: `["redmond"]`,
+			version:      2,
+			expectedID:   "pk3",
+			expectedEpk:  "22E342F38A486A088463DFF7838A5963",
+		},
+		{
+			name:         "RangeBoundary",
+			pkranges:     `{"PartitionKeyRanges":[{"id":"pk1","minInclusive":"","maxExclusive":"22E342F38A486A088463DFF7838A5963"},{"id":"pk2","minInclusive":"22E342F38A486A088463DFF7838A5963","maxExclusive":"FF"}]}`,
+			partitionKey: `["redmond"]`,
+			version:      2,
+			expectedID:   "pk2",
+			expectedEpk:  "22E342F38A486A088463DFF7838A5963",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			definition := azcosmos.PartitionKeyDefinition{
+				Kind:    azcosmos.PartitionKeyKindHash,
+				Paths:   []string{"/pk"},
+				Version: c.version,
+			}
+			pipeline, err := azcosmoscx.CreateQueryPipeline("SELECT * FROM c", plan, c.pkranges, azcosmoscx.WithPartitionKey(c.partitionKey, definition))
+			require.NoError(t, err)
+			defer pipeline.Close()
+
+			result, err := pipeline.Run()
+			require.NoError(t, err)
+
+			require.Len(t, result.Requests, 1)
+			assert.Equal(t, c.expectedID, result.Requests[0].PartitionKeyRangeID)
+
+			// The same pipeline can be created from the EPK directly.
+			epkPipeline, err := azcosmoscx.CreateQueryPipeline("SELECT * FROM c", plan, c.pkranges, azcosmoscx.WithEffectivePartitionKey(c.expectedEpk))
+			require.NoError(t, err)
+			defer epkPipeline.Close()
+
+			epkResult, err := epkPipeline.Run()
+			require.NoError(t, err)
+			assert.Equal(t, result.Requests, epkResult.Requests)
+		})
+	}
+}
+
 func TestPipelineWithDataReturnsData(t *testing.T) {
 	plan := "{\"partitionedQueryExecutionInfoVersion\": 1, \"queryInfo\":{}, \"queryRanges\": []}"
-	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"00","maxExclusive":"99"},{"id":"partition1","minInclusive":"99","maxExclusive":"FF"}]}`
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"99"},{"id":"partition1","minInclusive":"99","maxExclusive":"FF"}]}`
 	pipeline, err := azcosmoscx.NewQueryEngine().CreateQueryPipeline("SELECT * FROM c", plan, pkranges)
 	require.NoError(t, err)
 	defer pipeline.Close()
@@ -141,7 +325,7 @@ func TestPipelineWithDataReturnsData(t *testing.T) {
 
 func TestPipelineWithMultipleQueryResultsInSingleCall(t *testing.T) {
 	plan := "{\"partitionedQueryExecutionInfoVersion\": 1, \"queryInfo\":{\"orderBy\":[\"Ascending\"]}, \"queryRanges\": []}"
-	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"00","maxExclusive":"99"},{"id":"partition1","minInclusive":"99","maxExclusive":"FF"}]}`
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"99"},{"id":"partition1","minInclusive":"99","maxExclusive":"FF"}]}`
 	pipeline, err := azcosmoscx.NewQueryEngine().CreateQueryPipeline("SELECT * FROM c", plan, pkranges)
 	require.NoError(t, err)
 	defer pipeline.Close()
@@ -184,3 +368,857 @@ func TestPipelineWithMultipleQueryResultsInSingleCall(t *testing.T) {
 	assert.Empty(t, result.Requests)
 	assert.True(t, pipeline.IsComplete())
 }
+
+func TestProvideDataWithEmptySlice(t *testing.T) {
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(1))
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	// Providing no results is allowed, and leaves the pipeline waiting for the same data.
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.NoError(t, pipeline.ProvideData(nil))
+	require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{}))
+	assert.Equal(t, uint64(2), pipeline.(azcosmoscx.StatsReporter).Stats().ProvideDataCalls)
+
+	next, err := pipeline.Run()
+	require.NoError(t, err)
+	assert.Empty(t, next.Items)
+	assert.Equal(t, result.Requests, next.Requests)
+}
+
+func TestProvideDataWithLargeBatch(t *testing.T) {
+	const partitionCount = 64
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c ORDER BY c.value", orderedPlan("ASC", ""), newMockPartitionRanges(partitionCount))
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Requests, partitionCount)
+
+	// Provide every partition's data in a single call, with values that interleave across partitions, so that all of them must be merged.
+	results := make([]queryengine.QueryResult, 0, partitionCount)
+	for i, request := range result.Requests {
+		documents := fmt.Sprintf(`{"Documents":[{"orderByItems":[{"item":%d}],"payload":%d},{"orderByItems":[{"item":%d}],"payload":%d}]}`, i, i, i+partitionCount, i+partitionCount)
+		results = append(results, queryengine.NewQueryResultString(request.PartitionKeyRangeID, documents, ""))
+	}
+	require.NoError(t, pipeline.ProvideData(results))
+
+	result, err = pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Items, 2*partitionCount)
+	for i, item := range result.Items {
+		assert.Equal(t, fmt.Sprint(i), string(item))
+	}
+	assert.True(t, result.IsCompleted)
+}
+
+func TestMaxConcurrentPartitions(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{
+		{ID: "partition0", MinInclusive: "", MaxExclusive: "55"},
+		{ID: "partition1", MinInclusive: "55", MaxExclusive: "AA"},
+		{ID: "partition2", MinInclusive: "AA", MaxExclusive: "FF"},
+	}
+	cases := []struct {
+		name     string
+		opts     []azcosmoscx.PipelineOption
+		expected []string
+	}{
+		{"Default", nil, []string{"partition0"}},
+		{"Two", []azcosmoscx.PipelineOption{azcosmoscx.WithMaxConcurrentPartitions(2)}, []string{"partition0", "partition1"}},
+		{"Unlimited", []azcosmoscx.PipelineOption{azcosmoscx.WithMaxConcurrentPartitions(0)}, []string{"partition0", "partition1", "partition2"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, c.opts...)
+			require.NoError(t, err)
+			defer pipeline.Close()
+
+			result, err := pipeline.Run()
+			require.NoError(t, err)
+			ids := make([]string, 0, len(result.Requests))
+			for _, request := range result.Requests {
+				ids = append(ids, request.PartitionKeyRangeID)
+			}
+			assert.Equal(t, c.expected, ids)
+		})
+	}
+
+	t.Run("Negative", func(t *testing.T) {
+		_, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, azcosmoscx.WithMaxConcurrentPartitions(-1))
+		require.Error(t, err)
+	})
+}
+
+func TestTargetBatchSize(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{{ID: "partition0", MinInclusive: "", MaxExclusive: "FF"}}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, azcosmoscx.WithTargetBatchSize(2))
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Requests, 1)
+
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,2,3]}`, "p0c1")})
+	require.NoError(t, err)
+
+	// The buffered item covers part of the next batch, so the pipeline still needs more data.
+	result, err = pipeline.Run()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, result.Items)
+	require.Len(t, result.Requests, 1)
+	assert.Equal(t, "p0c1", result.Requests[0].Continuation)
+
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[4]}`, "")})
+	require.NoError(t, err)
+
+	result, err = pipeline.Run()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("3"), []byte("4")}, result.Items)
+	assert.Empty(t, result.Requests)
+	assert.True(t, result.IsCompleted)
+
+	_, err = azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, azcosmoscx.WithTargetBatchSize(-1))
+	require.Error(t, err)
+}
+
+func TestEngineTargetBatchSize(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"FF"}]}`
+	engine := azcosmoscx.NewQueryEngineWithOptions(azcosmoscx.EngineOptions{TargetBatchSize: 2})
+	pipeline, err := engine.CreateQueryPipeline("SELECT * FROM c", plan, pkranges)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	_, err = pipeline.Run()
+	require.NoError(t, err)
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,2,3]}`, "")})
+	require.NoError(t, err)
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, result.Items)
+
+	// An invalid target is reported when the pipeline is created.
+	engine = azcosmoscx.NewQueryEngineWithOptions(azcosmoscx.EngineOptions{TargetBatchSize: -1})
+	_, err = engine.CreateQueryPipeline("SELECT * FROM c", plan, pkranges)
+	require.Error(t, err)
+}
+
+func TestMaxBufferedItems(t *testing.T) {
+	plan := orderedPlan("ASC", `"hasNonStreamingOrderBy": true, `)
+	ranges := []azcosmoscx.PartitionKeyRange{{ID: "partition0", MinInclusive: "", MaxExclusive: "FF"}}
+	page := `{"Documents":[` +
+		`{"orderByItems":[{"item":3}],"payload":{"id":"3"}},` +
+		`{"orderByItems":[{"item":1}],"payload":{"id":"1"}},` +
+		`{"orderByItems":[{"item":2}],"payload":{"id":"2"}}]}`
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, azcosmoscx.WithMaxBufferedItems(2))
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Requests, 1)
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", page, "")})
+	require.ErrorIs(t, err, azcosmoscx.ErrBufferLimitExceeded)
+	assert.Contains(t, err.Error(), "limit of 2 items")
+
+	// The limit is set on pipelines the engine creates too, and an invalid limit is reported when the pipeline is created.
+	engine := azcosmoscx.NewQueryEngineWithOptions(azcosmoscx.EngineOptions{MaxBufferedItems: 3})
+	pipeline, err = engine.CreateQueryPipeline("SELECT * FROM c", plan, `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"FF"}]}`)
+	require.NoError(t, err)
+	defer pipeline.Close()
+	_, err = pipeline.Run()
+	require.NoError(t, err)
+	require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", page, "")}))
+
+	_, err = azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, azcosmoscx.WithMaxBufferedItems(-1))
+	require.Error(t, err)
+}
+
+// BenchmarkUnorderedConcurrentPartitions runs an unordered query over several partitions, simulating 10ms of latency for each request.
+// Requests returned in the same turn are made in parallel, so raising the number of concurrent partitions reduces the total latency.
+func BenchmarkUnorderedConcurrentPartitions(b *testing.B) {
+	const partitionCount = 8
+	const latency = 10 * time.Millisecond
+
+	partitions := mockPartitions{}
+	for i := 0; i < partitionCount; i++ {
+		partitions[fmt.Sprintf("partition%d", i)] = []string{`[1,2,3]`, `[1,2,3]`}
+	}
+	fetch := func(ctx context.Context, request queryengine.QueryRequest) (queryengine.QueryResult, error) {
+		time.Sleep(latency)
+		return partitions.fetch(ctx, request)
+	}
+
+	for _, max := range []int{1, 2, 4, 0} {
+		b.Run(fmt.Sprintf("MaxConcurrentPartitions=%d", max), func(b *testing.B) {
+			profileScenario(b)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(partitionCount), azcosmoscx.WithMaxConcurrentPartitions(max), scenarioProfilingContext)
+				require.NoError(b, err)
+
+				items := collectPages(b, azcosmoscx.NewPager(pipeline, fetch, nil))
+				require.Equal(b, partitionCount*2*3, len(items))
+			}
+		})
+	}
+}
+
+// benchmarkQuery drains a query over the partitions through a pager without latency, once per iteration, checking that it returns every one of their items.
+// Besides the items per second, it reports the calls into the native engine per iteration (turns and ProvideData calls) as cgo-calls/op.
+func benchmarkQuery(b *testing.B, plan string, partitions mockPartitions) {
+	profileScenario(b)
+	ranges := newMockPartitionRanges(len(partitions))
+	total := 0
+	for _, pages := range partitions {
+		for _, page := range pages {
+			var documents []json.RawMessage
+			require.NoError(b, json.Unmarshal([]byte(page), &documents))
+			total += len(documents)
+		}
+	}
+
+	calls := uint64(0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, scenarioProfilingContext)
+		require.NoError(b, err)
+
+		items := collectPages(b, azcosmoscx.NewPager(pipeline, partitions.fetch, nil))
+		require.Len(b, items, total)
+		stats := pipeline.(azcosmoscx.StatsReporter).Stats()
+		calls += stats.Turns + stats.ProvideDataCalls
+		pipeline.Close()
+	}
+	b.ReportMetric(float64(total)*float64(b.N)/b.Elapsed().Seconds(), "items/s")
+	b.ReportMetric(float64(calls)/float64(b.N), "cgo-calls/op")
+}
+
+// orderByPartitions returns partitionCount partitions with pagesPerPartition pages of itemsPerPage ORDER BY results each.
+// The sort keys are generated by key, and dealt to the partitions in turn, which each sort theirs with compare, as the backend would,
+// so an ordered query merges every partition's items. Each result's payload is the index of its key.
+func orderByPartitions(partitionCount, pagesPerPartition, itemsPerPage int, key func(i int) []any, compare func(a, b []any) int) mockPartitions {
+	type result struct {
+		key   []any
+		index int
+	}
+	results := make([][]result, partitionCount)
+	for i := 0; i < partitionCount*pagesPerPartition*itemsPerPage; i++ {
+		results[i%partitionCount] = append(results[i%partitionCount], result{key(i), i})
+	}
+
+	partitions := mockPartitions{}
+	for p, sorted := range results {
+		slices.SortStableFunc(sorted, func(a, b result) int { return compare(a.key, b.key) })
+		for page := range slices.Chunk(sorted, itemsPerPage) {
+			documents := make([]map[string]any, 0, len(page))
+			for _, r := range page {
+				orderByItems := make([]map[string]any, len(r.key))
+				for i, k := range r.key {
+					orderByItems[i] = map[string]any{"item": k}
+				}
+				documents = append(documents, map[string]any{"orderByItems": orderByItems, "payload": r.index})
+			}
+			data, err := json.Marshal(documents)
+			if err != nil {
+				panic(err)
+			}
+			partitionID := fmt.Sprintf("partition%d", p)
+			partitions[partitionID] = append(partitions[partitionID], string(data))
+		}
+	}
+	return partitions
+}
+
+// BenchmarkPartitionCounts shows how ordered and unordered queries scale with the number of partitions,
+// which the ordered merge's heap, and the requests of each turn, grow with.
+func BenchmarkPartitionCounts(b *testing.B) {
+	for _, mode := range []struct {
+		name string
+		plan string
+	}{
+		{"Unordered", unorderedPlan},
+		{"Ordered", orderedPlan("ASC", "")},
+	} {
+		for _, partitionCount := range []int{4, 16, 64, 256} {
+			b.Run(fmt.Sprintf("%s/Partitions=%d", mode.name, partitionCount), func(b *testing.B) {
+				// Each partition has two pages of 10 items, whose values interleave across partitions.
+				partitions := orderByPartitions(partitionCount, 2, 10, func(i int) []any { return []any{i} }, compareOrderByKeys)
+				benchmarkQuery(b, mode.plan, partitions)
+			})
+		}
+	}
+}
+
+// compareOrderByKeys compares sort keys of integers or strings, component by component, in ascending order.
+func compareOrderByKeys(a, b []any) int {
+	for i := range a {
+		var c int
+		switch x := a[i].(type) {
+		case int:
+			c = cmp.Compare(x, b[i].(int))
+		case string:
+			c = cmp.Compare(x, b[i].(string))
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// randomString returns a string of n random letters and digits.
+func randomString(rng *rand.Rand, n int) string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = alphabet[rng.IntN(len(alphabet))]
+	}
+	return string(s)
+}
+
+// BenchmarkOrderByKeys merges the items of 16 partitions by sort keys of different types, to track the cost of comparing them separately from that of providing the items:
+// random integers, random 32-character strings, and composite keys of an integer with few distinct values and an 8-character string, which break the integer's frequent ties.
+// The keys are generated from a fixed seed, so every run merges the same items.
+func BenchmarkOrderByKeys(b *testing.B) {
+	compositePlan := `{"partitionedQueryExecutionInfoVersion": 2, "queryInfo": {` +
+		`"orderBy": ["Ascending", "Ascending"], "orderByExpressions": ["c.category", "c.name"], ` +
+		`"rewrittenQuery": "SELECT c._rid, [{\"item\": c.category}, {\"item\": c.name}] AS orderByItems, c AS payload FROM c WHERE ({documentdb-formattableorderbyquery-filter}) ORDER BY c.category ASC, c.name ASC"` +
+		`}, "queryRanges": []}`
+	for _, variant := range []struct {
+		name string
+		plan string
+		key  func(rng *rand.Rand) []any
+	}{
+		{"Integer", orderedPlan("ASC", ""), func(rng *rand.Rand) []any { return []any{rng.IntN(1 << 30)} }},
+		{"String", orderedPlan("ASC", ""), func(rng *rand.Rand) []any { return []any{randomString(rng, 32)} }},
+		{"Composite", compositePlan, func(rng *rand.Rand) []any { return []any{rng.IntN(10), randomString(rng, 8)} }},
+	} {
+		b.Run(variant.name, func(b *testing.B) {
+			rng := rand.New(rand.NewPCG(1, 2))
+			partitions := orderByPartitions(16, 5, 20, func(int) []any { return variant.key(rng) }, compareOrderByKeys)
+			benchmarkQuery(b, variant.plan, partitions)
+		})
+	}
+}
+
+// BenchmarkSmallPages drains queries over partitions that return their 100 items in pages of 1 to 100 items, since the backend often returns far fewer items than requested.
+// Every page takes a round trip, providing it and running a turn, so with small pages the overhead of calling the native engine dominates.
+// round-trips/op counts the ProvideData calls of each query.
+func BenchmarkSmallPages(b *testing.B) {
+	const partitionCount, itemsPerPartition = 4, 100
+	ranges := newMockPartitionRanges(partitionCount)
+	total := partitionCount * itemsPerPartition
+
+	for _, mode := range []struct {
+		name string
+		plan string
+	}{
+		{"Unordered", unorderedPlan},
+		{"Ordered", orderedPlan("ASC", "")},
+	} {
+		for _, pageSize := range []int{1, 10, 25, 100} {
+			b.Run(fmt.Sprintf("%s/PageSize=%d", mode.name, pageSize), func(b *testing.B) {
+				profileScenario(b)
+				partitions := orderByPartitions(partitionCount, itemsPerPartition/pageSize, pageSize, func(i int) []any { return []any{i} }, compareOrderByKeys)
+
+				roundTrips := uint64(0)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", mode.plan, ranges, scenarioProfilingContext)
+					require.NoError(b, err)
+					items, err := drainPipeline(pipeline, partitions)
+					require.NoError(b, err)
+					require.Equal(b, total, items)
+					roundTrips += pipeline.(azcosmoscx.StatsReporter).Stats().ProvideDataCalls
+					pipeline.Close()
+				}
+				b.ReportMetric(float64(total)*float64(b.N)/b.Elapsed().Seconds(), "items/s")
+				b.ReportMetric(float64(roundTrips)/float64(b.N), "round-trips/op")
+			})
+		}
+	}
+}
+
+// BenchmarkProvideData provides a 4KB page to each partition of an unordered query, and runs the turn that returns their items, once per iteration.
+// The pages are provided in a single ProvideData call (Batched) or a call for each (Separate), so the difference between the two is the cost of the calls,
+// which pin each page's strings and build the array of them passed to the engine. BatchedFromString also converts each page from a string, as NewQueryResultString does.
+// Creating the pipeline, and its first turn, aren't timed.
+func BenchmarkProvideData(b *testing.B) {
+	page, _ := documentShape{Size: 4 * 1024, Depth: 1, Properties: 8}.page(1)
+	data := []byte(page)
+
+	for _, batchSize := range []int{1, 4, 16, 64} {
+		ranges := newMockPartitionRanges(batchSize)
+		for _, variant := range []struct {
+			name       string
+			batched    bool
+			fromString bool
+		}{
+			{"Batched", true, false},
+			{"Separate", false, false},
+			{"BatchedFromString", true, true},
+		} {
+			b.Run(fmt.Sprintf("BatchSize=%d/%s", batchSize, variant.name), func(b *testing.B) {
+				profileScenario(b)
+				results := make([]queryengine.QueryResult, batchSize)
+				for i, r := range ranges {
+					results[i] = queryengine.NewQueryResult(r.ID, data, "")
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, ranges, scenarioProfilingContext)
+					require.NoError(b, err)
+					_, err = pipeline.Run()
+					require.NoError(b, err)
+					b.StartTimer()
+
+					if variant.fromString {
+						for j, r := range ranges {
+							results[j] = queryengine.NewQueryResultString(r.ID, page, "")
+						}
+					}
+					if variant.batched {
+						require.NoError(b, pipeline.ProvideData(results))
+					} else {
+						for j := range results {
+							require.NoError(b, pipeline.ProvideData(results[j:j+1]))
+						}
+					}
+					result, err := pipeline.Run()
+					require.NoError(b, err)
+					require.Len(b, result.Items, batchSize)
+
+					b.StopTimer()
+					pipeline.Close()
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
+
+// residentBytes returns the process's resident memory, which, unlike runtime.MemStats, includes the native engine's allocations.
+// It's only available on Linux.
+func residentBytes() (uint64, bool) {
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	return pages * uint64(os.Getpagesize()), err == nil
+}
+
+// BenchmarkNonStreamingOrderByMemory feeds 4 partitions of 50,000 items each to a non-streaming ORDER BY, which buffers them until every partition is drained,
+// with and without a TOP that bounds how many it keeps. The resident memory is sampled before each turn, so its peak is the high-water mark of the buffering,
+// and its growth over the resident memory before the query, per item provided, is reported as bytes-buffered/item.
+// Memory freed by one iteration is reused by the next, so that's the largest growth of any iteration, and only meaningful when the benchmark is run on its own, on Linux.
+func BenchmarkNonStreamingOrderByMemory(b *testing.B) {
+	const partitionCount, pagesPerPartition, itemsPerPage = 4, 50, 1000
+	total := partitionCount * pagesPerPartition * itemsPerPage
+	partitions := orderByPartitions(partitionCount, pagesPerPartition, itemsPerPage, func(i int) []any { return []any{i} }, compareOrderByKeys)
+	ranges := newMockPartitionRanges(partitionCount)
+
+	for _, c := range []struct {
+		name  string
+		plan  string
+		items int
+	}{
+		{"Unbounded", orderedPlan("ASC", `"hasNonStreamingOrderBy": true, `), total},
+		{"Top=100", orderedPlan("ASC", `"top": 100, "hasNonStreamingOrderBy": true, `), 100},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			profileScenario(b)
+			growth, measured := uint64(0), true
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				before, ok := residentBytes()
+				measured = measured && ok
+				pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", c.plan, ranges, scenarioProfilingContext)
+				require.NoError(b, err)
+
+				items := 0
+				for !pipeline.IsComplete() {
+					if peak, ok := residentBytes(); ok && peak > before {
+						growth = max(growth, peak-before)
+					}
+					result, err := pipeline.Run()
+					require.NoError(b, err)
+					items += len(result.Items)
+					for _, request := range result.Requests {
+						response, err := partitions.fetch(context.Background(), request)
+						require.NoError(b, err)
+						require.NoError(b, pipeline.ProvideData([]queryengine.QueryResult{response}))
+					}
+				}
+				require.Equal(b, c.items, items)
+				pipeline.Close()
+			}
+			b.ReportMetric(float64(total)*float64(b.N)/b.Elapsed().Seconds(), "items/s")
+			if measured {
+				b.ReportMetric(float64(growth)/float64(total), "bytes-buffered/item")
+			}
+		})
+	}
+}
+
+// drainPipeline runs the pipeline to completion, providing the page of each request from the partitions, one at a time as the SDK does, and returns the number of items.
+// It returns errors rather than failing the test, so that it can be called from the goroutines of a parallel benchmark.
+func drainPipeline(pipeline queryengine.QueryPipeline, partitions mockPartitions) (int, error) {
+	items := 0
+	for !pipeline.IsComplete() {
+		result, err := pipeline.Run()
+		if err != nil {
+			return items, err
+		}
+		items += len(result.Items)
+		for _, request := range result.Requests {
+			response, err := partitions.fetch(context.Background(), request)
+			if err != nil {
+				return items, err
+			}
+			if err := pipeline.ProvideData([]queryengine.QueryResult{response}); err != nil {
+				return items, err
+			}
+		}
+	}
+	return items, nil
+}
+
+// throughputPartitions are the partitions the throughput benchmarks query: 8 partitions with two pages of 50 items each, merged by an ordered query.
+func throughputPartitions() (mockPartitions, int) {
+	const partitionCount, pagesPerPartition, itemsPerPage = 8, 2, 50
+	return orderByPartitions(partitionCount, pagesPerPartition, itemsPerPage, func(i int) []any { return []any{i} }, compareOrderByKeys),
+		partitionCount * pagesPerPartition * itemsPerPage
+}
+
+// runThroughputQuery creates a pipeline for the ordered query over the partitions and drains it, checking that it returns every item.
+func runThroughputQuery(ranges []azcosmoscx.PartitionKeyRange, partitions mockPartitions, total int) error {
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", orderedPlan("ASC", ""), ranges, scenarioProfilingContext)
+	if err != nil {
+		return err
+	}
+	defer pipeline.Close()
+	items, err := drainPipeline(pipeline, partitions)
+	if err == nil && items != total {
+		err = fmt.Errorf("expected %d items, got %d", total, items)
+	}
+	return err
+}
+
+// BenchmarkPipelineThroughput runs one ordered query after another, on a single goroutine.
+// It's the baseline for BenchmarkPipelineThroughput_Parallel, which does the same work per iteration.
+func BenchmarkPipelineThroughput(b *testing.B) {
+	profileScenario(b)
+	partitions, total := throughputPartitions()
+	ranges := newMockPartitionRanges(len(partitions))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		require.NoError(b, runThroughputQuery(ranges, partitions, total))
+	}
+	b.ReportMetric(float64(total)*float64(b.N)/b.Elapsed().Seconds(), "items/s")
+}
+
+// BenchmarkPipelineThroughput_Parallel runs the ordered queries of BenchmarkPipelineThroughput on many goroutines at once, each creating and draining its own pipelines,
+// so the aggregate items/s shows whether the native library serializes independent pipelines, such as on a lock or its allocator.
+func BenchmarkPipelineThroughput_Parallel(b *testing.B) {
+	partitions, total := throughputPartitions()
+	ranges := newMockPartitionRanges(len(partitions))
+
+	for _, goroutines := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("Goroutines=%d", goroutines), func(b *testing.B) {
+			profileScenario(b)
+			// RunParallel starts parallelism * GOMAXPROCS goroutines, so round up to at least the number asked for.
+			b.SetParallelism((goroutines + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := runThroughputQuery(ranges, partitions, total); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(total)*float64(b.N)/b.Elapsed().Seconds(), "items/s")
+		})
+	}
+}
+
+func TestDrainReturnsBufferedItemsWithoutRequests(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{
+		{ID: "partition0", MinInclusive: "", MaxExclusive: "99"},
+		{ID: "partition1", MinInclusive: "99", MaxExclusive: "FF"},
+	}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Requests, 1)
+
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,2,3]}`, "p0c1")})
+	require.NoError(t, err)
+
+	drainable, ok := pipeline.(azcosmoscx.DrainablePipeline)
+	require.True(t, ok)
+	require.NoError(t, drainable.Drain())
+
+	result, err = pipeline.Run()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2"), []byte("3")}, result.Items)
+	assert.Empty(t, result.Requests)
+	assert.True(t, result.IsCompleted)
+	assert.True(t, pipeline.IsComplete())
+
+	result, err = pipeline.Run()
+	require.NoError(t, err)
+	assert.Empty(t, result.Items)
+	assert.Empty(t, result.Requests)
+	assert.True(t, result.IsCompleted)
+}
+
+func newSinglePartitionPipeline(t testing.TB) queryengine.QueryPipeline {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{{ID: "partition0", MinInclusive: "", MaxExclusive: "FF"}}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, scenarioProfilingContext)
+	require.NoError(t, err)
+	return pipeline
+}
+
+// requireInitialRequest asserts that the pipeline is still waiting for the first page of partition0.
+func requireInitialRequest(t testing.TB, pipeline queryengine.QueryPipeline) {
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.Empty(t, result.Items)
+	require.Len(t, result.Requests, 1)
+	require.Equal(t, "partition0", result.Requests[0].PartitionKeyRangeID)
+	require.Empty(t, result.Requests[0].Continuation)
+}
+
+func TestRunRedeliversBatchAfterConversionFailure(t *testing.T) {
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+	requireInitialRequest(t, pipeline)
+
+	err := pipeline.ProvideData([]queryengine.QueryResult{
+		queryengine.NewQueryResultString("partition0", `{"Documents":[{"id":"1"},{"id":"2"}]}`, ""),
+	})
+	require.NoError(t, err)
+
+	injected := errors.New("injected conversion failure")
+	failures := 1
+	defer azcosmoscx.SetConvertResultHook(func() error {
+		if failures > 0 {
+			failures--
+			return injected
+		}
+		return nil
+	})()
+
+	_, err = pipeline.Run()
+	require.ErrorIs(t, err, injected)
+	assert.False(t, pipeline.IsComplete())
+
+	// The batch the native pipeline returned is delivered again, instead of its items being lost.
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"id":"1"}`), []byte(`{"id":"2"}`)}, result.Items)
+	assert.True(t, result.IsCompleted)
+	assert.True(t, pipeline.IsComplete())
+}
+
+func TestProvideDataRejectsMalformedPayloads(t *testing.T) {
+	const (
+		empty     = "query response body was empty"
+		truncated = "query response body was truncated"
+		notJSON   = "query response body is not valid JSON"
+		shape     = "query response body does not have the expected shape"
+	)
+	cases := []struct {
+		name     string
+		payload  string
+		expected string
+	}{
+		{"EmptyBody", "", empty},
+		{"WhitespaceOnly", " \r\n\t ", empty},
+		{"ByteOrderMarkOnly", "\uFEFF", empty},
+		{"TruncatedObject", `{"Documents":[1,2`, truncated},
+		{"TruncatedString", `{"Documents":["abc`, truncated},
+		{"Html", `<html><body>Service Unavailable</body></html>`, notJSON},
+		{"TopLevelArray", `[1, 2]`, shape},
+		{"TopLevelString", `"Documents"`, shape},
+		{"DocumentsString", `{"Documents":"nope"}`, shape},
+		{"DocumentsObject", `{"Documents":{"id":"1"}}`, shape},
+		{"DocumentsNumber", `{"Documents":42}`, shape},
+		{"MissingDocuments", `{"_rid":"Ut9xAOe2n2g="}`, shape},
+		{"CountOnly", `{"_count":0}`, shape},
+		{"GatewayError", `{"code":"BadRequest","message":"Request is malformed"}`, shape},
+		{"TrailingGarbage", `{"Documents":[]} trailing`, notJSON},
+		{"InvalidEscape", `{"Documents":["\x"]}`, notJSON},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pipeline := newSinglePartitionPipeline(t)
+			defer pipeline.Close()
+			requireInitialRequest(t, pipeline)
+
+			err := pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", c.payload, "")})
+			require.ErrorIs(t, err, azcosmoscx.ErrInvalidGatewayResponse)
+			assert.Contains(t, err.Error(), c.expected)
+
+			// The pipeline should be unchanged, so the request can be retried with corrected data.
+			requireInitialRequest(t, pipeline)
+			err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1]}`, "")})
+			require.NoError(t, err)
+
+			result, err := pipeline.Run()
+			require.NoError(t, err)
+			assert.Equal(t, [][]byte{[]byte("1")}, result.Items)
+			assert.True(t, result.IsCompleted)
+		})
+	}
+}
+
+func TestProvideDataTakesErrorMessages(t *testing.T) {
+	// The engine stores the description of an error per thread, so stay on the thread ProvideData is called on.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+	requireInitialRequest(t, pipeline)
+
+	// Whatever the code of the error, its description is taken by ProvideData, so a later failure can't report it.
+	for _, payload := range []string{"", `{"Documents":42}`} {
+		err := pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", payload, "")})
+		require.Error(t, err)
+		assert.Empty(t, azcosmoscx.TakeLastErrorMessage())
+	}
+	err := pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition9", `{"Documents":[1]}`, "")})
+	require.ErrorIs(t, err, azcosmoscx.ErrUnknownPartitionKeyRange)
+	assert.Empty(t, azcosmoscx.TakeLastErrorMessage())
+}
+
+func TestProvideDataAcceptsByteOrderMarkAndWhitespace(t *testing.T) {
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+	requireInitialRequest(t, pipeline)
+
+	err := pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", "\uFEFF\r\n  {\"Documents\":[1, 2]}", "")})
+	require.NoError(t, err)
+
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, result.Items)
+}
+
+func TestProvideDataAcceptsEmptyOrNullDocuments(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload string
+	}{
+		{"CountAndEmptyDocuments", `{"_count": 0, "Documents": []}`},
+		{"NullDocuments", `{"Documents": null}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pipeline := newSinglePartitionPipeline(t)
+			defer pipeline.Close()
+			requireInitialRequest(t, pipeline)
+
+			err := pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", c.payload, "")})
+			require.NoError(t, err)
+
+			result, err := pipeline.Run()
+			require.NoError(t, err)
+			assert.Empty(t, result.Items)
+			assert.Empty(t, result.Requests)
+			assert.True(t, result.IsCompleted)
+		})
+	}
+}
+
+func FuzzProvideData(f *testing.F) {
+	// Seeds are based on page bodies captured from the gateway.
+	f.Add(`{"_rid":"Ut9xAOe2n2g=","Documents":[{"id":"1","pk":"a","_rid":"Ut9xAOe2n2gBAAAAAAAAAA==","_self":"dbs/Ut9xAA==/colls/Ut9xAOe2n2g=/docs/Ut9xAOe2n2gBAAAAAAAAAA==/","_etag":"\"00000000-0000-0000-7f5c-39f9b2a301da\"","_attachments":"attachments/","_ts":1712345678}],"_count":1}`)
+	f.Add(`{"_rid":"Ut9xAOe2n2g=","Documents":[],"_count":0}`)
+	f.Add(`{"_rid":"Ut9xAOe2n2g=","Documents":[42,"forty-two",null,true,{"nested":[1,2,3]}],"_count":5}`)
+	f.Add("\uFEFF{\"Documents\":[{\"id\":\"\u00e9t\u00e9\"}]}")
+	f.Add(`{"Documents":[1,`)
+	f.Add(``)
+
+	f.Fuzz(func(t *testing.T, payload string) {
+		pipeline := newSinglePartitionPipeline(t)
+		defer pipeline.Close()
+		requireInitialRequest(t, pipeline)
+
+		err := pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", payload, "")})
+		if err != nil {
+			// A rejected payload must leave the pipeline ready to retry the same request.
+			requireInitialRequest(t, pipeline)
+			return
+		}
+
+		result, err := pipeline.Run()
+		require.NoError(t, err)
+		assert.True(t, result.IsCompleted)
+	})
+}
+
+func TestProvideDataRejectsContinuationFromAnotherPartition(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{
+		{ID: "partition0", MinInclusive: "", MaxExclusive: "99"},
+		{ID: "partition1", MinInclusive: "99", MaxExclusive: "FF"},
+	}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, azcosmoscx.WithMaxConcurrentPartitions(0))
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Requests, 2)
+
+	partition0Token := `{"token":"+RID:~Ut9xAOe2n2gBAAAAAAAAAA==#RT:1#TRC:1","range":{"min":"","max":"99"}}`
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1]}`, partition0Token)})
+	require.NoError(t, err)
+
+	// Replay partition0's token against partition1.
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition1", `{"Documents":[2]}`, partition0Token)})
+	require.ErrorIs(t, err, azcosmoscx.ErrInvalidContinuation)
+	assert.Contains(t, err.Error(), "partition key range 'partition1'")
+	assert.Contains(t, err.Error(), "['99', 'FF')")
+	assert.Contains(t, err.Error(), partition0Token)
+
+	// The rejected page wasn't applied, so partition1 is still waiting for its first page.
+	result, err = pipeline.Run()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1")}, result.Items)
+	require.Len(t, result.Requests, 2)
+	assert.Equal(t, "partition0", result.Requests[0].PartitionKeyRangeID)
+	assert.Equal(t, partition0Token, result.Requests[0].Continuation)
+	assert.Equal(t, "partition1", result.Requests[1].PartitionKeyRangeID)
+	assert.Empty(t, result.Requests[1].Continuation)
+}
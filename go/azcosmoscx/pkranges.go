@@ -0,0 +1,73 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+// #cgo CFLAGS: -I${SRCDIR}/include
+// #include <cosmoscx.h>
+import "C"
+import (
+	"encoding/json"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// PartitionKeyRange describes a single partition key range of a container, as returned by the gateway.
+type PartitionKeyRange struct {
+	ID           string `json:"id"`
+	MinInclusive string `json:"minInclusive"`
+	MaxExclusive string `json:"maxExclusive"`
+}
+
+// ParsePartitionKeyRanges parses and validates partition key ranges JSON, in the `{"PartitionKeyRanges": [...]}` form returned by the gateway.
+//
+// The same validation is performed when a pipeline is created, so this can be used to check the ranges up front.
+// The ranges must have hexadecimal bounds, have a minimum less than their maximum, have unique IDs, and cover the entire range from "" to "FF" without gaps or overlaps.
+// If they don't, the returned error names the offending range and the rule it violates.
+func ParsePartitionKeyRanges(pkranges string) ([]PartitionKeyRange, error) {
+	problem := C.cosmoscx_v0_query_pkranges_validate(makeStr(pkranges))
+	defer C.cosmoscx_v0_string_free(problem)
+	if problem.len > 0 {
+		return nil, &Error{
+			code:    C.COSMOS_CX_RESULT_CODE_INVALID_GATEWAY_RESPONSE,
+			message: EngineString(problem).CloneString(),
+		}
+	}
+
+	var result struct {
+		Ranges []PartitionKeyRange `json:"PartitionKeyRanges"`
+	}
+	if err := json.Unmarshal([]byte(pkranges), &result); err != nil {
+		return nil, err
+	}
+	return result.Ranges, nil
+}
+
+// CreateQueryPipelineRanges creates a new query pipeline from the provided plan and partition key ranges, applying the provided options.
+//
+// This is equivalent to [CreateQueryPipeline], but serializes the ranges into the `{"PartitionKeyRanges": [...]}` form expected by the engine.
+// At least one range must be provided.
+func CreateQueryPipelineRanges(query string, plan string, ranges []PartitionKeyRange, opts ...PipelineOption) (queryengine.QueryPipeline, error) {
+	pkranges, err := marshalPartitionKeyRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+	return CreateQueryPipeline(query, plan, pkranges, opts...)
+}
+
+func marshalPartitionKeyRanges(ranges []PartitionKeyRange) (string, error) {
+	if len(ranges) == 0 {
+		return "", &Error{
+			code:    C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL,
+			message: "at least one partition key range must be provided",
+		}
+	}
+
+	encoded, err := json.Marshal(struct {
+		Ranges []PartitionKeyRange `json:"PartitionKeyRanges"`
+	}{ranges})
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePartitionKeyRanges(t *testing.T) {
+	ranges, err := azcosmoscx.ParsePartitionKeyRanges(`{"PartitionKeyRanges":[{"id":"1","minInclusive":"80","maxExclusive":"FF"},{"id":"0","minInclusive":"","maxExclusive":"80"}]}`)
+	require.NoError(t, err)
+	assert.Equal(t, []azcosmoscx.PartitionKeyRange{
+		{ID: "1", MinInclusive: "80", MaxExclusive: "FF"},
+		{ID: "0", MinInclusive: "", MaxExclusive: "80"},
+	}, ranges)
+}
+
+func TestParsePartitionKeyRangesReportsViolations(t *testing.T) {
+	cases := []struct {
+		name     string
+		pkranges string
+		expected string
+	}{
+		{
+			"MissingMinInclusive",
+			`{"PartitionKeyRanges":[{"id":"0","maxExclusive":"FF"}]}`,
+			"partition key range '0' (at index 0) is invalid: missing field `minInclusive`",
+		},
+		{
+			"NonHexBound",
+			`{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"ZZ"},{"id":"1","minInclusive":"ZZ","maxExclusive":"FF"}]}`,
+			"partition key range '0' has a bound that is not an uppercase hexadecimal string",
+		},
+		{
+			"LowercaseBound",
+			`{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"8a"},{"id":"1","minInclusive":"8a","maxExclusive":"FF"}]}`,
+			"partition key range '0' has a bound that is not an uppercase hexadecimal string",
+		},
+		{
+			"MinNotLessThanMax",
+			`{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"80"},{"id":"1","minInclusive":"80","maxExclusive":"80"},{"id":"2","minInclusive":"80","maxExclusive":"FF"}]}`,
+			"partition key range '1' has a minInclusive ('80') that is not less than its maxExclusive ('80')",
+		},
+		{
+			"DuplicateID",
+			`{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"80"},{"id":"0","minInclusive":"80","maxExclusive":"FF"}]}`,
+			"partition key range ID '0' is not unique",
+		},
+		{
+			"Overlap",
+			`{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"90"},{"id":"1","minInclusive":"80","maxExclusive":"FF"}]}`,
+			"partition key range '0' overlaps partition key range '1'",
+		},
+		{
+			"Gap",
+			`{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"70"},{"id":"1","minInclusive":"80","maxExclusive":"FF"}]}`,
+			"there is a gap between partition key range '0' (maxExclusive '70') and partition key range '1' (minInclusive '80')",
+		},
+		{
+			"DoesNotStartAtMinimum",
+			`{"PartitionKeyRanges":[{"id":"0","minInclusive":"00","maxExclusive":"FF"}]}`,
+			"partition key range '0' is the first range, but its minInclusive is '00' instead of ''",
+		},
+		{
+			"DoesNotEndAtMaximum",
+			`{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"F0"}]}`,
+			"partition key range '0' is the last range, but its maxExclusive is 'F0' instead of 'FF'",
+		},
+		{
+			"Empty",
+			`{"PartitionKeyRanges":[]}`,
+			"no partition key ranges were provided",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := azcosmoscx.ParsePartitionKeyRanges(c.pkranges)
+			var engineErr *azcosmoscx.Error
+			require.ErrorAs(t, err, &engineErr)
+			assert.Contains(t, engineErr.Error(), c.expected)
+		})
+	}
+}
+
+func TestCreateQueryPipelineRangesEscapesIDs(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{
+		{ID: `quoted "range"`, MinInclusive: "", MaxExclusive: "80"},
+		{ID: `back\slash</script>`, MinInclusive: "80", MaxExclusive: "FF"},
+	}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	// Ranges are drained one at a time, so complete each one before checking the next request.
+	for _, r := range ranges {
+		result, err := pipeline.Run()
+		require.NoError(t, err)
+		require.Len(t, result.Requests, 1)
+		assert.Equal(t, r.ID, result.Requests[0].PartitionKeyRangeID)
+
+		err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString(r.ID, `{"Documents":[]}`, "")})
+		require.NoError(t, err)
+	}
+}
+
+func TestCreateQueryPipelineRangesRejectsEmptySlice(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	for _, ranges := range [][]azcosmoscx.PartitionKeyRange{nil, {}} {
+		_, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges)
+		var engineErr *azcosmoscx.Error
+		require.ErrorAs(t, err, &engineErr)
+		assert.Equal(t, "at least one partition key range must be provided", engineErr.Error())
+	}
+}
+
+func TestCreateQueryPipelineRejectsDuplicateRangeIDs(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{
+		{ID: "partition0", MinInclusive: "", MaxExclusive: "80"},
+		{ID: "partition1", MinInclusive: "80", MaxExclusive: "FF"},
+	}
+
+	// Simulate two copies of the same ranges being concatenated.
+	duplicated := append(slices.Clone(ranges), ranges...)
+	encoded, err := json.Marshal(map[string]any{"PartitionKeyRanges": duplicated})
+	require.NoError(t, err)
+
+	create := map[string]func() (queryengine.QueryPipeline, error){
+		"JSON": func() (queryengine.QueryPipeline, error) {
+			return azcosmoscx.NewQueryEngine().CreateQueryPipeline("SELECT * FROM c", plan, string(encoded))
+		},
+		"Ranges": func() (queryengine.QueryPipeline, error) {
+			return azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, duplicated)
+		},
+		"EffectivePartitionKey": func() (queryengine.QueryPipeline, error) {
+			return azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, duplicated, azcosmoscx.WithEffectivePartitionKey("10"))
+		},
+	}
+	for name, create := range create {
+		t.Run(name, func(t *testing.T) {
+			pipeline, err := create()
+			assert.Nil(t, pipeline)
+			var engineErr *azcosmoscx.Error
+			require.ErrorAs(t, err, &engineErr)
+			assert.Equal(t, "partition key range ID 'partition0' is not unique", engineErr.Error())
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+// #cgo CFLAGS: -I${SRCDIR}/include
+// #include <cosmoscx.h>
+import "C"
+import (
+	"slices"
+	"strings"
+)
+
+// PlanSupport describes the features required by a query plan, and which of them are supported by the engine.
+type PlanSupport struct {
+	// Required lists the camelCase names (e.g. "orderBy", "groupBy") of the features required by the query plan.
+	Required []string
+
+	// Supported lists the required features that are supported by the engine.
+	Supported []string
+
+	// Missing lists the required features that are NOT supported by the engine.
+	Missing []string
+}
+
+// IsSupported returns a boolean indicating if the engine supports every feature required by the query plan.
+func (s PlanSupport) IsSupported() bool {
+	return len(s.Missing) == 0
+}
+
+// CheckQueryPlan determines if the engine can execute the provided JSON query plan, without creating a pipeline.
+//
+// This allows a caller to decide whether to use the engine, or fall back to another way of running the query, before doing any other work.
+// An error is only returned if the plan cannot be parsed; an unsupported plan is reported through [PlanSupport.Missing].
+func CheckQueryPlan(plan string) (PlanSupport, error) {
+	r := C.cosmoscx_v0_query_plan_check(makeStr(plan))
+	if err := mapErr(r.code); err != nil {
+		return PlanSupport{}, err
+	}
+	defer C.cosmoscx_v0_query_plan_free_check_result(r.value)
+
+	required := splitFeatures(EngineString(r.value.required_features).CloneString())
+	missing := splitFeatures(EngineString(r.value.missing_features).CloneString())
+	supported := make([]string, 0, len(required))
+	for _, feature := range required {
+		if !slices.Contains(missing, feature) {
+			supported = append(supported, feature)
+		}
+	}
+	return PlanSupport{required, supported, missing}, nil
+}
+
+func splitFeatures(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSupportedQueryPlan(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{"orderBy":["Ascending"],"orderByExpressions":["c.id"],"top":10}, "queryRanges": []}`
+	support, err := azcosmoscx.CheckQueryPlan(plan)
+	require.NoError(t, err)
+
+	assert.True(t, support.IsSupported())
+	assert.Equal(t, []string{"orderBy", "top"}, support.Required)
+	assert.Equal(t, []string{"orderBy", "top"}, support.Supported)
+	assert.Empty(t, support.Missing)
+}
+
+func TestCheckPartiallySupportedQueryPlan(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{"distinctType":"Unordered","groupByExpressions":["c.category"],"offset":5,"limit":5}, "queryRanges": []}`
+	support, err := azcosmoscx.CheckQueryPlan(plan)
+	require.NoError(t, err)
+
+	assert.False(t, support.IsSupported())
+	assert.Equal(t, []string{"offsetAndLimit", "groupBy", "distinct"}, support.Required)
+	assert.Equal(t, []string{"offsetAndLimit"}, support.Supported)
+	assert.Equal(t, []string{"groupBy", "distinct"}, support.Missing)
+}
+
+func TestCheckInvalidQueryPlan(t *testing.T) {
+	_, err := azcosmoscx.CheckQueryPlan(`{"partitionedQueryExecutionInfoVersion": `)
+
+	var engineErr *azcosmoscx.Error
+	require.True(t, errors.As(err, &engineErr))
+	assert.Equal(t, "invalid response from gateway", engineErr.Error())
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+)
+
+// The pprof labels of calls into the native engine, when profiling labels are enabled.
+const (
+	// LabelQuery is the label of a hash of the pipeline's query, which identifies the calls made for the same query across pipelines.
+	LabelQuery = "cosmoscx.query"
+	// LabelPipeline is the label of the pipeline's ID, which is unique within the process.
+	LabelPipeline = "cosmoscx.pipeline"
+	// LabelOperation is the label of the operation: "run", for a turn of the pipeline, or "provideData", for providing it data.
+	LabelOperation = "cosmoscx.operation"
+)
+
+var profilingLabels atomic.Bool
+
+// EnableProfilingLabels labels the goroutines running a pipeline's turns, or providing it data, with pprof labels while they do,
+// so that CPU and goroutine profiles attribute the time spent in the native engine, which is otherwise lumped into runtime.cgocall, to the query and operation.
+// See [LabelQuery], [LabelPipeline], and [LabelOperation].
+//
+// Only pipelines with a profiling context (see [WithProfilingContext]) are labeled. The labels are added to those of the context,
+// which are restored when the call returns. A pipeline without one leaves the goroutine's labels alone, since they can't be restored without it.
+//
+// Only pipelines created after it's called are labeled, and labeling can't be disabled once it's enabled.
+// It's safe to call this more than once, and from several goroutines at once.
+func EnableProfilingLabels() {
+	profilingLabels.Store(true)
+}
+
+// WithProfilingContext sets the context whose pprof labels, such as those set by [pprof.Do] around the caller's request, the pipeline's calls into the native engine keep
+// when profiling labels are enabled (see [EnableProfilingLabels]). Only the context's labels are used: it doesn't cancel or time out the pipeline's calls. A nil context is ignored.
+func WithProfilingContext(ctx context.Context) PipelineOption {
+	return func(o *pipelineOptions) error {
+		if ctx != nil {
+			o.profilingContext = ctx
+		}
+		return nil
+	}
+}
+
+// pipelineLabels are the labels of a pipeline's calls into the native engine, besides their operation, and the context they're added to.
+type pipelineLabels struct {
+	ctx      context.Context
+	query    string
+	pipeline string
+}
+
+// newPipelineLabels returns the labels of the pipeline with the ID, added to those of ctx, or nil if profiling labels aren't enabled or ctx is nil.
+func newPipelineLabels(ctx context.Context, query string, id uint64) *pipelineLabels {
+	if !profilingLabels.Load() || ctx == nil {
+		return nil
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(query))
+	return &pipelineLabels{ctx: ctx, query: fmt.Sprintf("%016x", hash.Sum64()), pipeline: strconv.FormatUint(id, 10)}
+}
+
+// do calls f with the labels, and that of the operation, set on the calling goroutine, or just calls f if l is nil.
+// The goroutine's labels are those of l's context again once f returns.
+func (l *pipelineLabels) do(operation string, f func()) {
+	if l == nil {
+		f()
+		return
+	}
+	pprof.Do(l.ctx, pprof.Labels(LabelQuery, l.query, LabelPipeline, l.pipeline, LabelOperation, operation), func(context.Context) {
+		f()
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilingLabels(t *testing.T) {
+	t.Cleanup(azcosmoscx.SetProfilingLabels(true))
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+
+	// The goroutine profile is taken partway through a turn, while the goroutine running it is labeled.
+	var profile bytes.Buffer
+	restore := azcosmoscx.SetConvertResultHook(func() error {
+		return pprof.Lookup("goroutine").WriteTo(&profile, 1)
+	})
+	_, err := pipeline.Run()
+	restore()
+	require.NoError(t, err)
+	assert.Contains(t, profile.String(), `"cosmoscx.operation":"run"`)
+	assert.Regexp(t, `"cosmoscx.pipeline":"[0-9]+"`, profile.String())
+	assert.Regexp(t, `"cosmoscx.query":"[0-9a-f]{16}"`, profile.String())
+
+	// The labels are removed once the turn ends.
+	profile.Reset()
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&profile, 1))
+	assert.NotContains(t, profile.String(), azcosmoscx.LabelOperation)
+}
+
+func TestProfilingLabelsKeepTheCallersLabels(t *testing.T) {
+	t.Cleanup(azcosmoscx.SetProfilingLabels(true))
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{{ID: "partition0", MinInclusive: "", MaxExclusive: "FF"}}
+
+	pprof.Do(context.Background(), pprof.Labels("caller", "request42"), func(ctx context.Context) {
+		pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges, azcosmoscx.WithProfilingContext(ctx))
+		require.NoError(t, err)
+		defer pipeline.Close()
+
+		// The caller's label is kept alongside the pipeline's during the turn.
+		var profile bytes.Buffer
+		restore := azcosmoscx.SetConvertResultHook(func() error {
+			return pprof.Lookup("goroutine").WriteTo(&profile, 1)
+		})
+		_, err = pipeline.Run()
+		restore()
+		require.NoError(t, err)
+		assert.Regexp(t, `"caller":"request42".*"cosmoscx.operation":"run"`, profile.String())
+
+		// Only the caller's label is left once the turn ends.
+		profile.Reset()
+		require.NoError(t, pprof.Lookup("goroutine").WriteTo(&profile, 1))
+		assert.Contains(t, profile.String(), `"caller":"request42"`)
+		assert.NotContains(t, profile.String(), azcosmoscx.LabelOperation)
+	})
+}
+
+func TestProfilingLabelsRequireAProfilingContext(t *testing.T) {
+	t.Cleanup(azcosmoscx.SetProfilingLabels(true))
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{{ID: "partition0", MinInclusive: "", MaxExclusive: "FF"}}
+
+	pprof.Do(context.Background(), pprof.Labels("caller", "request42"), func(ctx context.Context) {
+		pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges)
+		require.NoError(t, err)
+		defer pipeline.Close()
+
+		// Without a profiling context, the pipeline doesn't label the turn, and the caller's label is left alone.
+		var profile bytes.Buffer
+		restore := azcosmoscx.SetConvertResultHook(func() error {
+			return pprof.Lookup("goroutine").WriteTo(&profile, 1)
+		})
+		_, err = pipeline.Run()
+		restore()
+		require.NoError(t, err)
+		assert.Contains(t, profile.String(), `"caller":"request42"`)
+		assert.NotContains(t, profile.String(), azcosmoscx.LabelOperation)
+
+		profile.Reset()
+		require.NoError(t, pprof.Lookup("goroutine").WriteTo(&profile, 1))
+		assert.Contains(t, profile.String(), `"caller":"request42"`)
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// ReplayReport describes the result of replaying a captured pipeline with [Replay].
+type ReplayReport struct {
+	// Calls is the number of captured calls (to Run and ProvideData) that were replayed.
+	Calls int
+
+	// Items is the number of items that were returned and matched the capture.
+	Items int
+
+	// Divergence describes the first call whose result differed from the capture, or is nil if every call matched.
+	// Replay stops at the first divergence.
+	Divergence *ReplayDivergence
+}
+
+// Matched returns true if every replayed call matched the capture.
+func (r *ReplayReport) Matched() bool {
+	return r.Divergence == nil
+}
+
+// ReplayDivergence describes a call whose result differed from the capture.
+type ReplayDivergence struct {
+	// File is the name of the capture file recording the call, such as "0004-run.json".
+	File string
+
+	// Message describes the difference, including the expected and actual values.
+	Message string
+}
+
+func (d *ReplayDivergence) String() string {
+	return d.File + ": " + d.Message
+}
+
+// captureFilePattern matches the numbered files of a capture, capturing their kind.
+var captureFilePattern = regexp.MustCompile(`^\d+-(run|provide)\.json$`)
+
+// Replay re-executes a pipeline captured with [WithCaptureDir], without a Cosmos DB account.
+//
+// The dir is the capture's pipeline subdirectory (containing pipeline.json). The pipeline is recreated from the captured query, options, plan, and partition key ranges,
+// and the captured calls are made again in order: pages are provided as they were captured, and the items, requests, and errors of each turn are compared to the captured ones.
+// This reproduces ordering and merging bugs in the engine from a capture attached to a bug report.
+//
+// An error is returned if the capture can't be read or the pipeline can't be recreated. A difference from the capture is reported in the [ReplayReport].
+func Replay(dir string) (*ReplayReport, error) {
+	var created capturedPipeline
+	if err := readCaptureJSON(dir, "pipeline.json", &created); err != nil {
+		return nil, err
+	}
+	plan, err := os.ReadFile(filepath.Join(dir, "plan.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture: %w", err)
+	}
+	pkranges, err := os.ReadFile(filepath.Join(dir, "pkranges.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if captureFilePattern.MatchString(entry.Name()) {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+
+	pipeline, err := CreateQueryPipeline(created.Query, string(plan), string(pkranges), created.options()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recreate captured pipeline: %w", err)
+	}
+	defer pipeline.Close()
+	replayed := pipeline.(*clientEngineQueryPipeline)
+
+	report := &ReplayReport{}
+	for _, file := range files {
+		var message string
+		if captureFilePattern.FindStringSubmatch(file)[1] == "run" {
+			var run capturedRun
+			if err := readCaptureJSON(dir, file, &run); err != nil {
+				return nil, err
+			}
+			message = replayRun(replayed, &run, report)
+		} else {
+			var provided capturedProvide
+			if err := readCaptureJSON(dir, file, &provided); err != nil {
+				return nil, err
+			}
+			message = replayProvide(replayed, &provided)
+		}
+		report.Calls++
+		if message != "" {
+			report.Divergence = &ReplayDivergence{File: file, Message: message}
+			break
+		}
+	}
+	return report, nil
+}
+
+// options returns the options that recreate the captured pipeline, without capturing it again.
+func (c *capturedPipeline) options() []PipelineOption {
+	return []PipelineOption{WithCaptureDir(""), func(o *pipelineOptions) error {
+		o.partitionKey = c.PartitionKey
+		o.partitionKeyDefinition = string(c.PartitionKeyDefinition)
+		o.effectivePartitionKey = c.EffectivePartitionKey
+		o.maxConcurrentPartitions = c.MaxConcurrentPartitions
+		o.targetBatchSize = c.TargetBatchSize
+		o.maxBufferedItems = c.MaxBufferedItems
+		return nil
+	}}
+}
+
+// replayRun runs a turn of the pipeline, returning a description of how it differs from the captured turn, or "" if it matches.
+func replayRun(pipeline *clientEngineQueryPipeline, expected *capturedRun, report *ReplayReport) string {
+	result, err := pipeline.Run()
+	if message := compareErrors(expected.Error, err); message != "" {
+		return message
+	}
+	if err != nil {
+		return ""
+	}
+
+	for i, item := range result.Items {
+		if i >= len(expected.Items) {
+			return fmt.Sprintf("returned %d items, expected %d; item %d is unexpected: %s", len(result.Items), len(expected.Items), i, item)
+		}
+		if string(item) != expected.Items[i] {
+			return fmt.Sprintf("item %d differs: expected %s, got %s", i, expected.Items[i], item)
+		}
+		report.Items++
+	}
+	if len(result.Items) < len(expected.Items) {
+		return fmt.Sprintf("returned %d items, expected %d; item %d is missing: %s", len(result.Items), len(expected.Items), len(result.Items), expected.Items[len(result.Items)])
+	}
+	if result.IsCompleted != expected.Completed {
+		return fmt.Sprintf("completed is %t, expected %t", result.IsCompleted, expected.Completed)
+	}
+
+	actual := newCapturedRequests(result.Requests, pipeline.query)
+	expectedJSON, _ := json.Marshal(expected.Requests)
+	actualJSON, _ := json.Marshal(actual)
+	if string(expectedJSON) != string(actualJSON) {
+		return fmt.Sprintf("requests differ: expected %s, got %s", expectedJSON, actualJSON)
+	}
+	return ""
+}
+
+// replayProvide provides the captured pages to the pipeline, returning a description of how the result differs from the captured one, or "" if it matches.
+func replayProvide(pipeline *clientEngineQueryPipeline, provided *capturedProvide) string {
+	results := make([]EncodedQueryResult, 0, len(provided.Pages))
+	encoded := false
+	for _, page := range provided.Pages {
+		data := page.EncodedData
+		if page.ContentEncoding == ContentEncodingIdentity {
+			data = []byte(page.Data)
+		} else {
+			encoded = true
+		}
+		results = append(results, EncodedQueryResult{
+			QueryResult: queryengine.QueryResult{
+				RequestId:           page.RequestID,
+				PartitionKeyRangeID: page.PartitionKeyRangeID,
+				NextContinuation:    page.Continuation,
+				Data:                data,
+			},
+			ContentEncoding: page.ContentEncoding,
+		})
+	}
+
+	var err error
+	if encoded {
+		err = pipeline.ProvideEncodedData(results)
+	} else {
+		plain := make([]queryengine.QueryResult, 0, len(results))
+		for _, result := range results {
+			plain = append(plain, result.QueryResult)
+		}
+		err = pipeline.ProvideData(plain)
+	}
+	return compareErrors(provided.Error, err)
+}
+
+// compareErrors describes how an error differs from the captured one, or returns "" if both calls succeeded or both failed.
+// Only the presence of an error is compared, since its message may change between versions of the engine.
+func compareErrors(expected string, actual error) string {
+	switch {
+	case expected == "" && actual != nil:
+		return fmt.Sprintf("failed with %q, expected success", actual.Error())
+	case expected != "" && actual == nil:
+		return fmt.Sprintf("succeeded, expected failure with %q", expected)
+	default:
+		return ""
+	}
+}
+
+func readCaptureJSON(dir string, name string, value any) error {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to read capture: %w", err)
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to parse capture file %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const replayFixture = "testdata/replay/order_by"
+
+// copyCapture copies a capture directory into a temporary directory, so that a test can modify it.
+func copyCapture(t *testing.T, dir string) string {
+	copied := t.TempDir()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(copied, entry.Name()), data, 0o644))
+	}
+	return copied
+}
+
+func TestReplayMatchesFixture(t *testing.T) {
+	report, err := azcosmoscx.Replay(replayFixture)
+	require.NoError(t, err)
+	assert.True(t, report.Matched(), "%v", report.Divergence)
+	assert.Equal(t, 8, report.Calls)
+	assert.Equal(t, 6, report.Items)
+}
+
+func TestReplayReportsFirstDivergence(t *testing.T) {
+	dir := copyCapture(t, replayFixture)
+
+	// Swap the order of two items, as a merging bug would.
+	path := filepath.Join(dir, "0008-run.json")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	swapped := strings.NewReplacer(`\"id\":\"c\",\"value\":3`, `\"id\":\"d\",\"value\":4`, `\"id\":\"d\",\"value\":4`, `\"id\":\"c\",\"value\":3`).Replace(string(data))
+	require.NoError(t, os.WriteFile(path, []byte(swapped), 0o644))
+
+	report, err := azcosmoscx.Replay(dir)
+	require.NoError(t, err)
+	require.False(t, report.Matched())
+	assert.Equal(t, "0008-run.json", report.Divergence.File)
+	assert.Equal(t, `item 0 differs: expected {"id":"d","value":4}, got {"id":"c","value":3}`, report.Divergence.Message)
+	assert.Equal(t, 8, report.Calls)
+	assert.Equal(t, 2, report.Items)
+}
+
+func TestReplayReportsUnexpectedErrors(t *testing.T) {
+	dir := copyCapture(t, replayFixture)
+
+	// A page that the engine rejects diverges from a capture in which it was accepted.
+	path := filepath.Join(dir, "0003-provide.json")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), `{\"Documents\":[`, `{\"Documents\":`, 1)), 0o644))
+
+	report, err := azcosmoscx.Replay(dir)
+	require.NoError(t, err)
+	require.False(t, report.Matched())
+	assert.Equal(t, "0003-provide.json", report.Divergence.File)
+	assert.Contains(t, report.Divergence.Message, "expected success")
+}
+
+func TestReplayCapturedPipeline(t *testing.T) {
+	dir := t.TempDir()
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(3), azcosmoscx.WithCaptureDir(dir), azcosmoscx.WithMaxConcurrentPartitions(2))
+	require.NoError(t, err)
+	runScripted(t, pipeline, mockPartitions{
+		"partition0": {`[1,2]`, `[3]`},
+		"partition1": {`[]`},
+		"partition2": {`[4]`, `[5]`},
+	})
+	pipeline.Close()
+
+	report, err := azcosmoscx.Replay(captureSubdir(t, dir))
+	require.NoError(t, err)
+	assert.True(t, report.Matched(), "%v", report.Divergence)
+	assert.Equal(t, 5, report.Items)
+
+	// Replaying doesn't capture the replayed pipeline.
+	captureSubdir(t, dir)
+}
+
+func TestReplayRejectsInvalidCaptures(t *testing.T) {
+	_, err := azcosmoscx.Replay(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorContains(t, err, "failed to read capture")
+
+	dir := copyCapture(t, replayFixture)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "0001-run.json"), []byte("{"), 0o644))
+	_, err = azcosmoscx.Replay(dir)
+	assert.ErrorContains(t, err, "failed to parse capture file 0001-run.json")
+}
@@ -0,0 +1,200 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+// requestScenario is a query run against canned pages, whose requests are recorded and compared to a golden file.
+type requestScenario struct {
+	name       string
+	plan       string
+	partitions int
+	pages      mockPartitions
+	options    []azcosmoscx.PipelineOption
+}
+
+// recordedTurn is a turn of a pipeline, as recorded in a golden file.
+type recordedTurn struct {
+	Items     int               `json:"items"`
+	Completed bool              `json:"completed,omitempty"`
+	Requests  []recordedRequest `json:"requests"`
+}
+
+type recordedRequest struct {
+	PartitionKeyRangeID string `json:"pkrangeId"`
+	Continuation        string `json:"continuation,omitempty"`
+	Query               string `json:"query,omitempty"`
+	Drain               bool   `json:"drain,omitempty"`
+}
+
+// maxRecordedTurns bounds the turns recorded for a scenario, so that a pipeline that never completes fails the test instead of hanging.
+const maxRecordedTurns = 100
+
+// recordRequests runs the scenario to completion, fetching each request's page from the canned pages, and returns every turn.
+func recordRequests(t *testing.T, scenario requestScenario) []recordedTurn {
+	ranges := newMockPartitionRanges(scenario.partitions)
+	for i := range ranges {
+		if _, ok := scenario.pages[ranges[i].ID]; !ok {
+			scenario.pages[ranges[i].ID] = []string{`[]`}
+		}
+	}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", scenario.plan, ranges, scenario.options...)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	turns := []recordedTurn{}
+	for !pipeline.IsComplete() {
+		require.Less(t, len(turns), maxRecordedTurns, "pipeline didn't complete")
+		result, err := pipeline.Run()
+		require.NoError(t, err)
+
+		turn := recordedTurn{Items: len(result.Items), Completed: result.IsCompleted, Requests: []recordedRequest{}}
+		for _, request := range result.Requests {
+			turn.Requests = append(turn.Requests, recordedRequest{
+				PartitionKeyRangeID: request.PartitionKeyRangeID,
+				Continuation:        request.Continuation,
+				Query:               request.Query,
+				Drain:               request.Drain,
+			})
+
+			// Results are provided one at a time, as the SDK does.
+			response, err := scenario.pages.fetch(context.Background(), request)
+			require.NoError(t, err)
+			require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{response}))
+		}
+		turns = append(turns, turn)
+	}
+	return turns
+}
+
+// orderedPlan returns the plan of a query sorted by a single property, rewritten in the same way as by the gateway.
+func orderedPlan(direction string, extra string) string {
+	order := map[string]string{"ASC": "Ascending", "DESC": "Descending"}[direction]
+	return `{"partitionedQueryExecutionInfoVersion": 2, "queryInfo": {` +
+		`"orderBy": ["` + order + `"], "orderByExpressions": ["c.value"], ` + extra +
+		`"rewrittenQuery": "SELECT c._rid, [{\"item\": c.value}] AS orderByItems, c AS payload FROM c WHERE ({documentdb-formattableorderbyquery-filter}) ORDER BY c.value ` + direction + `"` +
+		`}, "queryRanges": []}`
+}
+
+func TestRequestSequences(t *testing.T) {
+	scenarios := []requestScenario{
+		{
+			name:       "unordered",
+			plan:       unorderedPlan,
+			partitions: 3,
+			pages: mockPartitions{
+				"partition0": {`[1,2]`, `[]`, `[3]`},
+				"partition1": {`[]`},
+				"partition2": {`[4]`, `[5]`},
+			},
+		},
+		{
+			name:       "unordered_concurrent_partitions",
+			plan:       unorderedPlan,
+			partitions: 4,
+			pages: mockPartitions{
+				"partition0": {`[1]`, `[2]`},
+				"partition1": {`[3]`},
+				"partition2": {`[4]`, `[5]`, `[6]`},
+				"partition3": {`[7]`},
+			},
+			options: []azcosmoscx.PipelineOption{azcosmoscx.WithMaxConcurrentPartitions(2)},
+		},
+		{
+			name:       "unordered_target_batch_size",
+			plan:       unorderedPlan,
+			partitions: 2,
+			pages: mockPartitions{
+				"partition0": {`[1,2,3,4,5]`, `[6]`},
+				"partition1": {`[7,8,9]`},
+			},
+			options: []azcosmoscx.PipelineOption{azcosmoscx.WithTargetBatchSize(2)},
+		},
+		{
+			name:       "offset_limit",
+			plan:       `{"partitionedQueryExecutionInfoVersion": 2, "queryInfo": {"offset": 1, "limit": 2}, "queryRanges": []}`,
+			partitions: 3,
+			pages: mockPartitions{
+				"partition0": {`[1]`, `[2]`},
+				"partition1": {`[3,4]`},
+				"partition2": {`[5]`},
+			},
+		},
+		{
+			name:       "scoped_to_effective_partition_key",
+			plan:       unorderedPlan,
+			partitions: 4,
+			pages: mockPartitions{
+				"partition2": {`[1]`, `[2]`},
+			},
+			options: []azcosmoscx.PipelineOption{azcosmoscx.WithEffectivePartitionKey("90")},
+		},
+		{
+			name:       "order_by_ascending",
+			plan:       orderedPlan("ASC", ""),
+			partitions: 3,
+			pages: mockPartitions{
+				"partition0": {
+					`[{"orderByItems":[{"item":1}],"payload":{"id":"a"}},{"orderByItems":[{"item":4}],"payload":{"id":"d"}}]`,
+					`[{"orderByItems":[{"item":6}],"payload":{"id":"f"}}]`,
+				},
+				"partition1": {
+					`[{"orderByItems":[{"item":2}],"payload":{"id":"b"}}]`,
+					`[{"orderByItems":[{"item":5}],"payload":{"id":"e"}}]`,
+				},
+				"partition2": {
+					`[{"orderByItems":[{"item":3}],"payload":{"id":"c"}}]`,
+				},
+			},
+		},
+		{
+			name:       "order_by_descending_top",
+			plan:       orderedPlan("DESC", `"top": 2, `),
+			partitions: 2,
+			pages: mockPartitions{
+				"partition0": {
+					`[{"orderByItems":[{"item":9}],"payload":{"id":"a"}}]`,
+					`[{"orderByItems":[{"item":5}],"payload":{"id":"c"}}]`,
+				},
+				"partition1": {
+					`[{"orderByItems":[{"item":8}],"payload":{"id":"b"}}]`,
+					`[{"orderByItems":[{"item":1}],"payload":{"id":"d"}}]`,
+				},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			actual, err := json.MarshalIndent(recordRequests(t, scenario), "", "  ")
+			require.NoError(t, err)
+			actual = append(actual, '\n')
+
+			path := filepath.Join("testdata", "requests", scenario.name+".json")
+			if *update {
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, actual, 0o644))
+				return
+			}
+
+			expected, err := os.ReadFile(path)
+			require.NoError(t, err, "golden file is missing; run the tests with -update to create it")
+			assert.JSONEq(t, string(expected), string(actual), "requests differ from %s; if the change is intended, run the tests with -update and review the diff", path)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// selfTestMaxTurns bounds the turns SelfTest runs, so that a broken engine that never completes is reported instead of hanging.
+const selfTestMaxTurns = 10
+
+// SelfTest checks that the native library linked into the program works, by running a small query over one in-memory partition and verifying its results.
+//
+// It's intended for startup validation, such as a readiness probe, to detect a native library that doesn't match this package
+// (for example, one built from a different version, or for the wrong C library) before the first real query fails.
+// It doesn't make any network requests. If the engine doesn't behave as expected, the returned error describes the first mismatch.
+func SelfTest() error {
+	const (
+		pkrangeID    = "selftest0"
+		continuation = "selftest-continuation"
+	)
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := fmt.Sprintf(`{"PartitionKeyRanges":[{"id":%q,"minInclusive":"","maxExclusive":"FF"}]}`, pkrangeID)
+	pages := []struct {
+		data         string
+		continuation string
+	}{
+		{`{"Documents":[{"id":"1"}]}`, continuation},
+		{`{"Documents":[{"id":"2"}]}`, ""},
+	}
+	expected := [][]byte{[]byte(`{"id":"1"}`), []byte(`{"id":"2"}`)}
+
+	pipeline, err := CreateQueryPipeline("SELECT * FROM c", plan, ranges)
+	if err != nil {
+		return fmt.Errorf("azcosmoscx self-test: failed to create pipeline: %w", err)
+	}
+	defer pipeline.Close()
+
+	var items [][]byte
+	provided := 0
+	for turn := 1; ; turn++ {
+		if turn > selfTestMaxTurns {
+			return fmt.Errorf("azcosmoscx self-test: pipeline didn't complete after %d turns", selfTestMaxTurns)
+		}
+
+		result, err := pipeline.Run()
+		if err != nil {
+			return fmt.Errorf("azcosmoscx self-test: turn %d failed: %w", turn, err)
+		}
+		items = append(items, result.Items...)
+		if result.IsCompleted {
+			if len(result.Requests) != 0 {
+				return fmt.Errorf("azcosmoscx self-test: turn %d completed the pipeline, but requested %d more pages", turn, len(result.Requests))
+			}
+			break
+		}
+		if len(result.Requests) != 1 {
+			return fmt.Errorf("azcosmoscx self-test: turn %d requested %d pages, expected 1", turn, len(result.Requests))
+		}
+
+		request := result.Requests[0]
+		if provided == len(pages) {
+			return fmt.Errorf("azcosmoscx self-test: turn %d requested another page after all %d pages were provided", turn, len(pages))
+		}
+		if request.PartitionKeyRangeID != pkrangeID {
+			return fmt.Errorf("azcosmoscx self-test: turn %d requested partition key range %q, expected %q", turn, request.PartitionKeyRangeID, pkrangeID)
+		}
+		expectedContinuation := ""
+		if provided > 0 {
+			expectedContinuation = pages[provided-1].continuation
+		}
+		if request.Continuation != expectedContinuation {
+			return fmt.Errorf("azcosmoscx self-test: turn %d requested continuation %q, expected %q", turn, request.Continuation, expectedContinuation)
+		}
+
+		page := pages[provided]
+		err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString(pkrangeID, page.data, page.continuation)})
+		if err != nil {
+			return fmt.Errorf("azcosmoscx self-test: failed to provide page %d: %w", provided+1, err)
+		}
+		provided++
+	}
+
+	if provided != len(pages) {
+		return fmt.Errorf("azcosmoscx self-test: pipeline completed after %d of %d pages were provided", provided, len(pages))
+	}
+	if len(items) != len(expected) {
+		return fmt.Errorf("azcosmoscx self-test: pipeline returned %d items, expected %d", len(items), len(expected))
+	}
+	for i := range expected {
+		if !bytes.Equal(items[i], expected[i]) {
+			return fmt.Errorf("azcosmoscx self-test: item %d is %q, expected %q", i, items[i], expected[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+//go:build soak
+
+package azcosmoscx_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/require"
+)
+
+// The soak test is configured by environment variables:
+//
+//   - AZCOSMOSCX_SOAK_DURATION is how long the workload runs, as a duration such as "10m" (default "1m").
+//   - AZCOSMOSCX_SOAK_MAX_GROWTH_MB is how much the resident set size may grow, in MiB, between the start and the end of the run (default 32).
+const (
+	defaultSoakDuration      = time.Minute
+	defaultSoakMaxGrowthMiB  = 32
+	soakSampleCount          = 20
+	soakSamplesPerComparison = 3
+)
+
+// TestSoakNativeMemory creates, runs, and destroys pipelines for a long time, mixing successful queries, failures, and pipelines abandoned without being closed,
+// and fails if the process's memory keeps growing, which would indicate leaked native memory.
+//
+// Run it with the soak tag, for example `go test -tags azcosmoscx_local,soak -run Soak -timeout 0 .`.
+// With the asan tag, and AddressSanitizer enabled (`-asan`), LeakSanitizer also checks for leaked native memory at the end of the run.
+func TestSoakNativeMemory(t *testing.T) {
+	duration := defaultSoakDuration
+	if value := os.Getenv("AZCOSMOSCX_SOAK_DURATION"); value != "" {
+		var err error
+		duration, err = time.ParseDuration(value)
+		require.NoError(t, err, "invalid AZCOSMOSCX_SOAK_DURATION")
+	}
+	maxGrowthMiB := defaultSoakMaxGrowthMiB
+	if value := os.Getenv("AZCOSMOSCX_SOAK_MAX_GROWTH_MB"); value != "" {
+		var err error
+		maxGrowthMiB, err = strconv.Atoi(value)
+		require.NoError(t, err, "invalid AZCOSMOSCX_SOAK_MAX_GROWTH_MB")
+	}
+	if _, err := residentSetSize(); err != nil {
+		t.Skipf("can't measure memory use: %v", err)
+	}
+
+	// Warm up, so that memory the allocators and runtime keep after the first iterations isn't counted as growth.
+	iteration := 0
+	for deadline := time.Now().Add(duration / 10); time.Now().Before(deadline); iteration++ {
+		runSoakIteration(t, iteration)
+	}
+
+	samples := make([]uint64, 0, soakSampleCount)
+	interval := duration / soakSampleCount
+	for len(samples) < soakSampleCount {
+		for deadline := time.Now().Add(interval); time.Now().Before(deadline); iteration++ {
+			runSoakIteration(t, iteration)
+		}
+		rss, err := settledResidentSetSize()
+		require.NoError(t, err)
+		samples = append(samples, rss)
+	}
+
+	start := median(samples[:soakSamplesPerComparison])
+	end := median(samples[len(samples)-soakSamplesPerComparison:])
+	growth := int64(end) - int64(start)
+	t.Logf("ran %d iterations; resident set size went from %.1f MiB to %.1f MiB (samples: %s)", iteration, mib(start), mib(end), formatSamples(samples))
+	if growth > int64(maxGrowthMiB)<<20 {
+		t.Errorf("resident set size grew by %.1f MiB, more than the %d MiB allowed", mib(uint64(growth)), maxGrowthMiB)
+	}
+
+	azcosmoscx.LeakCheck()
+}
+
+// runSoakIteration runs one of the workloads, chosen by the iteration number.
+func runSoakIteration(t *testing.T, iteration int) {
+	switch iteration % 5 {
+	case 0:
+		// A query run to completion.
+		partitions := mockPartitions{
+			"partition0": {`[1,2,3]`, `[4]`},
+			"partition1": {`[5]`},
+			"partition2": {`[]`, `[6,7]`},
+		}
+		pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(3))
+		require.NoError(t, err)
+		items := collectPages(t, azcosmoscx.NewPager(pipeline, partitions.fetch, nil))
+		require.Len(t, items, 7)
+	case 1:
+		// A query that fails when it's provided a malformed response, and is closed.
+		pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(2))
+		require.NoError(t, err)
+		_, err = pipeline.Run()
+		require.NoError(t, err)
+		err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,`, "")})
+		require.Error(t, err)
+		pipeline.Close()
+	case 2:
+		// Pipelines that can't be created.
+		_, err := azcosmoscx.CreateQueryPipeline("SELECT * FROM c", `{"queryInfo":`, `{"PartitionKeyRanges":[]}`)
+		require.Error(t, err)
+		ranges := newMockPartitionRanges(2)
+		ranges[1].ID = ranges[0].ID
+		_, err = azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, ranges)
+		require.Error(t, err)
+	case 3:
+		// A query abandoned partway through without being closed, holding buffered items.
+		pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(2))
+		require.NoError(t, err)
+		_, err = pipeline.Run()
+		require.NoError(t, err)
+		err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,2,3]}`, "next")})
+		require.NoError(t, err)
+	case 4:
+		// A query abandoned without being closed after a turn failed, holding a batch that wasn't delivered.
+		pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(1))
+		require.NoError(t, err)
+		_, err = pipeline.Run()
+		require.NoError(t, err)
+		err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,2]}`, "")})
+		require.NoError(t, err)
+
+		injected := errors.New("injected conversion failure")
+		restore := azcosmoscx.SetConvertResultHook(func() error { return injected })
+		_, err = pipeline.Run()
+		restore()
+		require.ErrorIs(t, err, injected)
+	}
+}
+
+// settledResidentSetSize runs the garbage collector, so that abandoned pipelines are finalized and their native memory freed, and returns the resident set size.
+func settledResidentSetSize() (uint64, error) {
+	// The first collection queues the finalizers of unreachable pipelines, which run on another goroutine, and the second frees their Go memory.
+	runtime.GC()
+	time.Sleep(10 * time.Millisecond)
+	runtime.GC()
+	return residentSetSize()
+}
+
+// residentSetSize returns the process's resident set size, in bytes. It's only supported on Linux.
+func residentSetSize() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected /proc/self/statm contents: %q", data)
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
+
+func median(samples []uint64) uint64 {
+	sorted := append([]uint64(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+func mib(bytes uint64) float64 {
+	return float64(bytes) / (1 << 20)
+}
+
+func formatSamples(samples []uint64) string {
+	formatted := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		formatted = append(formatted, fmt.Sprintf("%.1f", mib(sample)))
+	}
+	return strings.Join(formatted, ", ")
+}
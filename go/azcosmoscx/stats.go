@@ -0,0 +1,110 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PipelineStats describes the work done by a query pipeline.
+type PipelineStats struct {
+	// Turns is the number of times Run has been called.
+	Turns uint64
+
+	// ItemsEmitted is the number of items returned by Run.
+	ItemsEmitted uint64
+
+	// ProvideDataCalls is the number of times ProvideData has been called.
+	ProvideDataCalls uint64
+
+	// PagesProvided is the number of query results (pages) provided to ProvideData.
+	PagesProvided uint64
+
+	// BytesProvided is the total size of the data in the query results provided to ProvideData.
+	BytesProvided uint64
+
+	// NativeTime is the wall time spent inside calls to the native engine.
+	NativeTime time.Duration
+}
+
+// StatsReporter is implemented by query pipelines that track [PipelineStats].
+//
+// Pipelines returned by this package implement this interface.
+type StatsReporter interface {
+	// Stats returns a snapshot of the pipeline's counters.
+	Stats() PipelineStats
+}
+
+var _ StatsReporter = (*clientEngineQueryPipeline)(nil)
+
+// pipelineCounters holds the counters behind [PipelineStats].
+// They're updated atomically, so that they can be read while the pipeline is in use.
+type pipelineCounters struct {
+	turns            atomic.Uint64
+	itemsEmitted     atomic.Uint64
+	provideDataCalls atomic.Uint64
+	pagesProvided    atomic.Uint64
+	bytesProvided    atomic.Uint64
+	nativeNanos      atomic.Uint64
+}
+
+// totalCounters aggregates the counters of every pipeline in the process, for [PublishExpvar].
+var (
+	totalCounters  pipelineCounters
+	totalPipelines atomic.Uint64
+)
+
+func (c *pipelineCounters) recordTurn(items int, native time.Duration) {
+	for _, counters := range []*pipelineCounters{c, &totalCounters} {
+		counters.turns.Add(1)
+		counters.itemsEmitted.Add(uint64(items))
+		counters.nativeNanos.Add(uint64(native))
+	}
+}
+
+func (c *pipelineCounters) recordProvideData(pages int, bytes int, native time.Duration) {
+	for _, counters := range []*pipelineCounters{c, &totalCounters} {
+		counters.provideDataCalls.Add(1)
+		counters.pagesProvided.Add(uint64(pages))
+		counters.bytesProvided.Add(uint64(bytes))
+		counters.nativeNanos.Add(uint64(native))
+	}
+}
+
+func (c *pipelineCounters) snapshot() PipelineStats {
+	return PipelineStats{
+		Turns:            c.turns.Load(),
+		ItemsEmitted:     c.itemsEmitted.Load(),
+		ProvideDataCalls: c.provideDataCalls.Load(),
+		PagesProvided:    c.pagesProvided.Load(),
+		BytesProvided:    c.bytesProvided.Load(),
+		NativeTime:       time.Duration(c.nativeNanos.Load()),
+	}
+}
+
+var publishExpvarOnce sync.Once
+
+// PublishExpvar publishes the combined [PipelineStats] of every pipeline created by this package as the "azcosmoscx" [expvar] variable.
+//
+// The variable also includes "Pipelines", the number of pipelines created.
+// It's safe to call this more than once, the variable is only published the first time.
+func PublishExpvar() {
+	publishExpvarOnce.Do(func() {
+		expvar.Publish("azcosmoscx", expvar.Func(func() any {
+			stats := totalCounters.snapshot()
+			return map[string]any{
+				"Pipelines":        totalPipelines.Load(),
+				"Turns":            stats.Turns,
+				"ItemsEmitted":     stats.ItemsEmitted,
+				"ProvideDataCalls": stats.ProvideDataCalls,
+				"PagesProvided":    stats.PagesProvided,
+				"BytesProvided":    stats.BytesProvided,
+				"NativeTimeNanos":  int64(stats.NativeTime),
+			}
+		}))
+	})
+}
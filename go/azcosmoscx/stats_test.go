@@ -0,0 +1,83 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineStats(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{}, "queryRanges": []}`
+	ranges := []azcosmoscx.PartitionKeyRange{
+		{ID: "partition0", MinInclusive: "", MaxExclusive: "99"},
+		{ID: "partition1", MinInclusive: "99", MaxExclusive: "FF"},
+	}
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", plan, ranges)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	reporter, ok := pipeline.(azcosmoscx.StatsReporter)
+	require.True(t, ok)
+	assert.Equal(t, azcosmoscx.PipelineStats{}, reporter.Stats())
+
+	page0 := `{"Documents":[1,2]}`
+	page1 := `{"Documents":[3]}`
+
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Requests, 1)
+	require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", page0, "")}))
+
+	result, err = pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Items, 2)
+	require.Len(t, result.Requests, 1)
+	require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition1", page1, "")}))
+
+	result, err = pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Items, 1)
+	require.True(t, result.IsCompleted)
+
+	stats := reporter.Stats()
+	assert.Equal(t, uint64(3), stats.Turns)
+	assert.Equal(t, uint64(3), stats.ItemsEmitted)
+	assert.Equal(t, uint64(2), stats.ProvideDataCalls)
+	assert.Equal(t, uint64(2), stats.PagesProvided)
+	assert.Equal(t, uint64(len(page0)+len(page1)), stats.BytesProvided)
+	assert.Positive(t, stats.NativeTime)
+}
+
+func TestPublishExpvar(t *testing.T) {
+	azcosmoscx.PublishExpvar()
+	azcosmoscx.PublishExpvar() // Publishing again is a no-op, rather than a panic.
+
+	readTotals := func() map[string]float64 {
+		v := expvar.Get("azcosmoscx")
+		require.NotNil(t, v)
+		var totals map[string]float64
+		require.NoError(t, json.Unmarshal([]byte(v.String()), &totals))
+		return totals
+	}
+
+	before := readTotals()
+	pipeline := newSinglePartitionPipeline(t)
+	defer pipeline.Close()
+	_, err := pipeline.Run()
+	require.NoError(t, err)
+	after := readTotals()
+
+	assert.Equal(t, before["Pipelines"]+1, after["Pipelines"])
+	assert.Equal(t, before["Turns"]+1, after["Turns"])
+	for _, name := range []string{"ItemsEmitted", "ProvideDataCalls", "PagesProvided", "BytesProvided", "NativeTimeNanos"} {
+		assert.Contains(t, after, name)
+	}
+}
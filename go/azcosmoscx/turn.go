@@ -0,0 +1,64 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+import (
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// TurnInfo describes a turn of a pipeline (a call to Run or RunInto), as reported to the callback set by [WithOnTurn] or [EngineOptions].
+type TurnInfo struct {
+	// Turn is the index of the turn, starting at 0 for the first call to Run.
+	Turn int
+
+	// Items is the number of items the turn returned.
+	Items int
+
+	// Requests holds the partition key range IDs of the data requests the turn returned, in order.
+	Requests []string
+
+	// Continuations holds the continuation of each data request in Requests, which is empty for a request for the partition key range's first page.
+	Continuations []string
+
+	// PagesProvided is the number of pages provided to the pipeline with ProvideData between the previous turn and this one.
+	// When it's 0, the items the turn returned were already buffered in the pipeline.
+	PagesProvided int
+
+	// Completed is true if the pipeline has returned all of its items.
+	Completed bool
+
+	// NativeTime is the wall time the turn spent inside calls to the native engine.
+	NativeTime time.Duration
+
+	// Err is the error returned by the turn, if it failed. When set, Items is 0, and Requests and Continuations are empty.
+	Err error
+}
+
+// WithOnTurn sets a function that's called after every turn of the pipeline, describing what the turn did, for logging or metrics.
+//
+// The function is called on the goroutine that called Run, after Run has finished updating the pipeline, and not while holding any lock,
+// so it can safely call the pipeline's other methods (such as Stats). A nil function is ignored.
+func WithOnTurn(onTurn func(TurnInfo)) PipelineOption {
+	return func(o *pipelineOptions) error {
+		o.onTurn = onTurn
+		return nil
+	}
+}
+
+func newTurnInfo(turn int, result *queryengine.PipelineResult, pagesProvided int, native time.Duration, err error) TurnInfo {
+	info := TurnInfo{Turn: turn, PagesProvided: pagesProvided, NativeTime: native, Err: err}
+	if result != nil {
+		info.Items = len(result.Items)
+		info.Completed = result.IsCompleted
+		info.Requests = make([]string, 0, len(result.Requests))
+		info.Continuations = make([]string, 0, len(result.Requests))
+		for _, request := range result.Requests {
+			info.Requests = append(info.Requests, request.PartitionKeyRangeID)
+			info.Continuations = append(info.Continuations, request.Continuation)
+		}
+	}
+	return info
+}
@@ -0,0 +1,173 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runScripted runs the pipeline to completion, providing each request's page from the partitions one at a time, and returns the result of each turn.
+func runScripted(t *testing.T, pipeline queryengine.QueryPipeline, partitions mockPartitions) []*queryengine.PipelineResult {
+	var results []*queryengine.PipelineResult
+	for !pipeline.IsComplete() {
+		require.Less(t, len(results), maxRecordedTurns, "pipeline didn't complete")
+		result, err := pipeline.Run()
+		require.NoError(t, err)
+		results = append(results, result)
+		for _, request := range result.Requests {
+			response, err := partitions.fetch(context.Background(), request)
+			require.NoError(t, err)
+			require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{response}))
+		}
+	}
+	return results
+}
+
+func TestOnTurnReportsEachTurn(t *testing.T) {
+	partitions := mockPartitions{
+		"partition0": {`[1,2]`, `[3]`},
+		"partition1": {`[4]`},
+	}
+	var turns []azcosmoscx.TurnInfo
+	var pipeline queryengine.QueryPipeline
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(2), azcosmoscx.WithOnTurn(func(turn azcosmoscx.TurnInfo) {
+		// The callback isn't called under a lock, so it can use the pipeline.
+		assert.Equal(t, uint64(turn.Turn+1), pipeline.(azcosmoscx.StatsReporter).Stats().Turns)
+		turns = append(turns, turn)
+	}))
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	results := runScripted(t, pipeline, partitions)
+	require.Len(t, turns, len(results))
+	for i, turn := range turns {
+		assert.Equal(t, i, turn.Turn)
+		assert.Equal(t, len(results[i].Items), turn.Items)
+		assert.Equal(t, results[i].IsCompleted, turn.Completed)
+		assert.NoError(t, turn.Err)
+
+		requests, continuations := []string{}, []string{}
+		for _, request := range results[i].Requests {
+			requests = append(requests, request.PartitionKeyRangeID)
+			continuations = append(continuations, request.Continuation)
+		}
+		assert.Equal(t, requests, turn.Requests)
+		assert.Equal(t, continuations, turn.Continuations)
+
+		// runScripted provides a page for each request of a turn before the next one.
+		if i == 0 {
+			assert.Zero(t, turn.PagesProvided)
+		} else {
+			assert.Equal(t, len(results[i-1].Requests), turn.PagesProvided)
+		}
+	}
+
+	// Every item is reported once, in the turn that returned it, and only the last turn completes the pipeline.
+	items := 0
+	for _, turn := range turns {
+		items += turn.Items
+	}
+	assert.Equal(t, 4, items)
+	assert.Equal(t, []string{"partition0"}, turns[0].Requests)
+	assert.Equal(t, []string{""}, turns[0].Continuations)
+	assert.True(t, turns[len(turns)-1].Completed)
+	for _, turn := range turns[:len(turns)-1] {
+		assert.False(t, turn.Completed)
+	}
+}
+
+func TestOnTurnReportsFailedTurns(t *testing.T) {
+	var turns []azcosmoscx.TurnInfo
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(1), azcosmoscx.WithOnTurn(func(turn azcosmoscx.TurnInfo) {
+		turns = append(turns, turn)
+	}))
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	_, err = pipeline.Run()
+	require.NoError(t, err)
+	require.NoError(t, pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", `{"Documents":[1,2]}`, "")}))
+
+	injected := errors.New("injected conversion failure")
+	restore := azcosmoscx.SetConvertResultHook(func() error { return injected })
+	_, err = pipeline.Run()
+	restore()
+	require.ErrorIs(t, err, injected)
+
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Items, 2)
+
+	require.Len(t, turns, 3)
+	assert.Equal(t, 1, turns[1].Turn)
+	assert.ErrorIs(t, turns[1].Err, injected)
+	assert.Zero(t, turns[1].Items)
+	assert.Empty(t, turns[1].Requests)
+	assert.Equal(t, 1, turns[1].PagesProvided)
+	assert.Equal(t, 2, turns[2].Turn)
+	assert.Equal(t, 2, turns[2].Items)
+	assert.Zero(t, turns[2].PagesProvided, "the items were buffered by the failed turn")
+	assert.NoError(t, turns[2].Err)
+}
+
+func TestEngineOnTurn(t *testing.T) {
+	var turns []azcosmoscx.TurnInfo
+	engine := azcosmoscx.NewQueryEngineWithOptions(azcosmoscx.EngineOptions{
+		OnTurn: func(turn azcosmoscx.TurnInfo) { turns = append(turns, turn) },
+	})
+	pkranges, err := json.Marshal(map[string]any{"PartitionKeyRanges": newMockPartitionRanges(2)})
+	require.NoError(t, err)
+
+	partitions := mockPartitions{"partition0": {`[1]`}, "partition1": {`[2]`}}
+	pipeline, err := engine.CreateQueryPipeline("SELECT * FROM c", unorderedPlan, string(pkranges))
+	require.NoError(t, err)
+	defer pipeline.Close()
+	results := runScripted(t, pipeline, partitions)
+	assert.Len(t, turns, len(results))
+
+	// Without Cache, the engine has no caches.
+	turns = nil
+	pipeline, err = engine.CreateCachedQueryPipeline("container", "SELECT * FROM c",
+		func() (string, error) { return unorderedPlan, nil },
+		func() (string, error) { return string(pkranges), nil },
+		azcosmoscx.WithMaxConcurrentPartitions(2))
+	assert.ErrorContains(t, err, "without caches")
+	assert.Nil(t, pipeline)
+
+	// The engine's callback also applies to pipelines created from its caches, alongside their own options.
+	cached := azcosmoscx.NewQueryEngineWithOptions(azcosmoscx.EngineOptions{
+		Cache:  &azcosmoscx.CacheOptions{},
+		OnTurn: func(turn azcosmoscx.TurnInfo) { turns = append(turns, turn) },
+	})
+	pipeline, err = cached.CreateCachedQueryPipeline("container", "SELECT * FROM c",
+		func() (string, error) { return unorderedPlan, nil },
+		func() (string, error) { return string(pkranges), nil },
+		azcosmoscx.WithMaxConcurrentPartitions(2))
+	require.NoError(t, err)
+	defer pipeline.Close()
+	results = runScripted(t, pipeline, partitions)
+	require.Len(t, turns, len(results))
+	assert.Equal(t, []string{"partition0", "partition1"}, turns[0].Requests)
+}
+
+func TestNilOnTurnIsIgnored(t *testing.T) {
+	pipeline, err := azcosmoscx.CreateQueryPipelineRanges("SELECT * FROM c", unorderedPlan, newMockPartitionRanges(1), azcosmoscx.WithOnTurn(nil))
+	require.NoError(t, err)
+	defer pipeline.Close()
+	runScripted(t, pipeline, mockPartitions{"partition0": {`[1]`}})
+
+	engine := azcosmoscx.NewQueryEngineWithOptions(azcosmoscx.EngineOptions{})
+	pipeline, err = engine.CreateQueryPipeline("SELECT * FROM c", unorderedPlan, `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"FF"}]}`)
+	require.NoError(t, err)
+	defer pipeline.Close()
+	runScripted(t, pipeline, mockPartitions{"partition0": {`[1]`}})
+}
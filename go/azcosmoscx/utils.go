@@ -28,3 +28,15 @@ func makeStrPinned(s string, pin *runtime.Pinner) C.CosmosCxStr {
 		len:  C.uintptr_t(len(s)),
 	}
 }
+
+func makeBytesPinned(b []byte, pin *runtime.Pinner) C.CosmosCxStr {
+	if len(b) == 0 {
+		return C.CosmosCxStr{}
+	}
+	ptr := unsafe.SliceData(b)
+	pin.Pin(ptr)
+	return C.CosmosCxStr{
+		data: (*C.uint8_t)(ptr),
+		len:  C.uintptr_t(len(b)),
+	}
+}
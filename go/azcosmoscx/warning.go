@@ -0,0 +1,81 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx
+
+// #cgo CFLAGS: -I${SRCDIR}/include
+// #include <cosmoscx.h>
+import "C"
+import "unsafe"
+
+// WarningCode identifies the kind of problem described by a [Warning].
+type WarningCode int
+
+const (
+	// WarningCodeUndefinedOrderByItem indicates that an ORDER BY item had a type that can't be ordered (an object or array),
+	// so it was treated as undefined, which sorts before every other value.
+	WarningCodeUndefinedOrderByItem WarningCode = C.COSMOS_CX_WARNING_CODE_UNDEFINED_ORDER_BY_ITEM
+
+	// WarningCodeSkippedItem indicates that an item in the results of an ORDER BY query wasn't an object with `orderByItems` and `payload` properties, so it was skipped.
+	WarningCodeSkippedItem WarningCode = C.COSMOS_CX_WARNING_CODE_SKIPPED_ITEM
+)
+
+func (c WarningCode) String() string {
+	switch c {
+	case WarningCodeUndefinedOrderByItem:
+		return "UndefinedOrderByItem"
+	case WarningCodeSkippedItem:
+		return "SkippedItem"
+	default:
+		return "Unknown"
+	}
+}
+
+// Warning describes a problem with the data provided to a pipeline that the engine worked around, rather than failing the query.
+type Warning struct {
+	// Code identifies the kind of problem.
+	Code WarningCode
+
+	// Message describes the problem.
+	Message string
+
+	// PartitionKeyRangeID is the ID of the partition key range whose data had the problem.
+	PartitionKeyRangeID string
+}
+
+// WarningReporter is implemented by query pipelines that report [Warning]s.
+//
+// Pipelines returned by this package implement this interface.
+type WarningReporter interface {
+	// Warnings returns the warnings reported by the most recent call to Run (or RunInto),
+	// which describe problems with the data provided since the call before it.
+	Warnings() []Warning
+}
+
+var _ WarningReporter = (*clientEngineQueryPipeline)(nil)
+
+// Warnings returns the warnings reported by the most recent call to Run (or RunInto).
+func (p *clientEngineQueryPipeline) Warnings() []Warning {
+	return p.warnings
+}
+
+// Warnings returns the warnings reported by this turn of the pipeline, cloned into Go memory.
+func (r *PipelineResult) Warnings() ([]Warning, error) {
+	if r.ptr == nil {
+		return nil, &Error{code: C.COSMOS_CX_RESULT_CODE_ARGUMENT_NULL}
+	}
+	if r.ptr.warnings.len == 0 {
+		return nil, nil
+	}
+
+	source := unsafe.Slice(r.ptr.warnings.data, r.ptr.warnings.len)
+	warnings := make([]Warning, 0, len(source))
+	for _, warning := range source {
+		warnings = append(warnings, Warning{
+			Code:                WarningCode(warning.code),
+			Message:             EngineString(warning.message).CloneString(),
+			PartitionKeyRangeID: EngineString(warning.pkrange_id).CloneString(),
+		})
+	}
+	return warnings, nil
+}
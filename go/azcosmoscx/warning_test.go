@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package azcosmoscx_test
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReportsWarnings(t *testing.T) {
+	plan := `{"partitionedQueryExecutionInfoVersion": 1, "queryInfo":{"orderBy":["Ascending"]}, "queryRanges": []}`
+	pkranges := `{"PartitionKeyRanges":[{"id":"partition0","minInclusive":"","maxExclusive":"FF"}]}`
+	pipeline, err := azcosmoscx.NewQueryEngine().CreateQueryPipeline("SELECT * FROM c ORDER BY c.value", plan, pkranges)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	_, err = pipeline.Run()
+	require.NoError(t, err)
+	assert.Empty(t, pipeline.(azcosmoscx.WarningReporter).Warnings())
+
+	page := `{"Documents":[
+		{"orderByItems":[{"item":2}],"payload":{"id":"2"}},
+		"not an item",
+		{"orderByItems":[{"item":{"nested":1}}],"payload":{"id":"1"}}
+	]}`
+	err = pipeline.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("partition0", page, "")})
+	require.NoError(t, err)
+
+	// The query completes, skipping the malformed item and sorting the undefined ORDER BY item first.
+	result, err := pipeline.Run()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"id":"1"}`), []byte(`{"id":"2"}`)}, result.Items)
+	assert.True(t, result.IsCompleted)
+
+	warnings := pipeline.(azcosmoscx.WarningReporter).Warnings()
+	require.Len(t, warnings, 2)
+	assert.Equal(t, azcosmoscx.WarningCodeSkippedItem, warnings[0].Code)
+	assert.Contains(t, warnings[0].Message, "skipped item 1")
+	assert.Equal(t, azcosmoscx.WarningCodeUndefinedOrderByItem, warnings[1].Code)
+	assert.Contains(t, warnings[1].Message, "is an object")
+	for _, warning := range warnings {
+		assert.Equal(t, "partition0", warning.PartitionKeyRangeID)
+	}
+
+	// Warnings are only reported by the turn after the data was provided.
+	_, err = pipeline.Run()
+	require.NoError(t, err)
+	assert.Empty(t, pipeline.(azcosmoscx.WarningReporter).Warnings())
+}
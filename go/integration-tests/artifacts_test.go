@@ -0,0 +1,97 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wI2L/jsondiff"
+)
+
+// ArtifactsEnvVar, if set, is the directory failure artifacts are written to, instead of next to each baseline.
+const ArtifactsEnvVar = "COSMOSCX_IT_ARTIFACTS"
+
+// artifactsDir returns the directory the failure artifacts for the baseline at resultsPath are written to.
+func artifactsDir(resultsPath string) string {
+	if dir := os.Getenv(ArtifactsEnvVar); dir != "" {
+		return dir
+	}
+	return path.Dir(resultsPath)
+}
+
+// writeFailureArtifacts writes the actual results of a query that failed validation to "<query>.actual.json" in dir, formatted like a baseline,
+// and the JSON patch from the expected results to the actual results (with JSON pointer paths) to "<query>.diff.json", returning their paths.
+func writeFailureArtifacts(dir, queryName string, expected, actual []interface{}) (string, string, error) {
+	expectedJson, err := formatBaseline(expected)
+	if err != nil {
+		return "", "", err
+	}
+	actualJson, err := formatBaseline(actual)
+	if err != nil {
+		return "", "", err
+	}
+	patch, err := jsondiff.CompareJSON(expectedJson, actualJson)
+	if err != nil {
+		return "", "", err
+	}
+	if patch == nil {
+		patch = jsondiff.Patch{}
+	}
+	diffJson, err := json.MarshalIndent(patch, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	actualPath := path.Join(dir, queryName+".actual.json")
+	if err := os.WriteFile(actualPath, actualJson, 0o644); err != nil {
+		return "", "", err
+	}
+	diffPath := path.Join(dir, queryName+".diff.json")
+	if err := os.WriteFile(diffPath, diffJson, 0o644); err != nil {
+		return "", "", err
+	}
+	return actualPath, diffPath, nil
+}
+
+func TestWriteFailureArtifacts(t *testing.T) {
+	var expected, actual []interface{}
+	require.NoError(t, json.Unmarshal([]byte(`[{"id": "1", "price": 10}, {"id": "2", "price": 20}]`), &expected))
+	require.NoError(t, json.Unmarshal([]byte(`[{"id": "1", "price": 10, "_rid": "x"}, {"id": "2", "price": 25, "_rid": "y"}, {"id": "3", "price": 30, "_rid": "z"}]`), &actual))
+
+	dir := path.Join(t.TempDir(), "artifacts")
+	actualPath, diffPath, err := writeFailureArtifacts(dir, "prices", expected, actual)
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "prices.actual.json"), actualPath)
+	assert.Equal(t, path.Join(dir, "prices.diff.json"), diffPath)
+
+	// The actual results are formatted like a baseline, so they can be compared with it, or copied over it.
+	data, err := os.ReadFile(actualPath)
+	require.NoError(t, err)
+	formatted, err := formatBaseline(actual)
+	require.NoError(t, err)
+	assert.Equal(t, string(formatted), string(data))
+	assert.NotContains(t, string(data), "_rid")
+
+	data, err = os.ReadFile(diffPath)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"op": "replace", "path": "/1/price", "value": 25},
+		{"op": "add", "path": "/-", "value": {"id": "3", "price": 30}}
+	]`, string(data))
+}
+
+func TestArtifactsDir(t *testing.T) {
+	t.Setenv(ArtifactsEnvVar, "")
+	assert.Equal(t, path.Join("baselines", "queries", "order_by"), artifactsDir(path.Join("baselines", "queries", "order_by", "streaming_1.results.json")))
+	t.Setenv(ArtifactsEnvVar, "/tmp/artifacts")
+	assert.Equal(t, "/tmp/artifacts", artifactsDir(path.Join("baselines", "queries", "order_by", "streaming_1.results.json")))
+}
@@ -0,0 +1,154 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/emulator"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// EndpointEnvVar is the endpoint of the account to run the integration tests against. It defaults to the emulator.
+const EndpointEnvVar = "AZURE_COSMOS_ENDPOINT"
+
+// KeyEnvVar is the key of the account. If it's empty, the emulator's well-known key is used for local endpoints,
+// and Entra ID authentication (azidentity.DefaultAzureCredential) for any other endpoint.
+const KeyEnvVar = "AZURE_COSMOS_KEY"
+
+// ThroughputEnvVar overrides the throughput of the databases and containers the integration tests create:
+// "manual:<RU/s>", "autoscale:<max RU/s>", or "none" for serverless accounts.
+const ThroughputEnvVar = "COSMOSCX_IT_THROUGHPUT"
+
+const defaultEndpoint = emulator.Endpoint
+
+// emulatorThroughput is the manual throughput used by default against local endpoints, which is free, and splits each container into several partitions.
+const emulatorThroughput = 40000
+
+// accountThroughput is the manual throughput used by default against other accounts, which is enough for two partitions, like the baseline generator.
+const accountThroughput = 12000
+
+func createClient(endpoint, key string) (*azcosmos.Client, error) {
+	options := &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{
+		PerCallPolicies:  []policy.Policy{partitionRequestPolicy{}},
+		PerRetryPolicies: []policy.Policy{requestChargePolicy{}},
+	}}
+	client, err := emulator.NewClient(endpoint, key, options)
+	if err != nil && key == "" {
+		return nil, fmt.Errorf("%s is empty, so Entra ID authentication is used, but no credential is available: %w", KeyEnvVar, err)
+	}
+	return client, err
+}
+
+// parseThroughput returns the throughput for the databases and containers the integration tests create (see ThroughputEnvVar), or nil for none.
+func parseThroughput(endpoint, override string) (*azcosmos.ThroughputProperties, error) {
+	if override == "" {
+		throughput := azcosmos.NewManualThroughputProperties(accountThroughput)
+		if emulator.IsLocalEndpoint(endpoint) {
+			throughput = azcosmos.NewManualThroughputProperties(emulatorThroughput)
+		}
+		return &throughput, nil
+	}
+	if override == "none" {
+		return nil, nil
+	}
+
+	kind, value, _ := strings.Cut(override, ":")
+	ru, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || ru <= 0 {
+		return nil, fmt.Errorf("%s must be 'manual:<RU/s>', 'autoscale:<max RU/s>', or 'none', but was '%s'", ThroughputEnvVar, override)
+	}
+	var throughput azcosmos.ThroughputProperties
+	switch kind {
+	case "manual":
+		throughput = azcosmos.NewManualThroughputProperties(int32(ru))
+	case "autoscale":
+		throughput = azcosmos.NewAutoscaleThroughputProperties(int32(ru))
+	default:
+		return nil, fmt.Errorf("%s must be 'manual:<RU/s>', 'autoscale:<max RU/s>', or 'none', but was '%s'", ThroughputEnvVar, override)
+	}
+	return &throughput, nil
+}
+
+// explainAuthError adds a hint to authorization failures, which are otherwise hard to diagnose, particularly with Entra ID.
+func explainAuthError(err error, entraID bool) error {
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) || (responseErr.StatusCode != http.StatusUnauthorized && responseErr.StatusCode != http.StatusForbidden) {
+		return err
+	}
+	if !entraID {
+		return fmt.Errorf("%w (check %s is the account's key)", err, KeyEnvVar)
+	}
+	return fmt.Errorf("%w (with Entra ID authentication, the identity needs a Cosmos DB data-plane role assignment on the account, such as 'Cosmos DB Built-in Data Contributor', "+
+		"and data-plane roles don't allow creating databases and containers, so set %s to use a key if that's what failed)", err, KeyEnvVar)
+}
+
+func TestParseThroughput(t *testing.T) {
+	throughput, err := parseThroughput(defaultEndpoint, "")
+	require.NoError(t, err)
+	ru, ok := throughput.ManualThroughput()
+	require.True(t, ok)
+	assert.Equal(t, int32(emulatorThroughput), ru)
+
+	throughput, err = parseThroughput("https://myaccount.documents.azure.com:443/", "")
+	require.NoError(t, err)
+	ru, ok = throughput.ManualThroughput()
+	require.True(t, ok)
+	assert.Equal(t, int32(accountThroughput), ru)
+
+	throughput, err = parseThroughput(defaultEndpoint, "autoscale:4000")
+	require.NoError(t, err)
+	ru, ok = throughput.AutoscaleMaxThroughput()
+	require.True(t, ok)
+	assert.Equal(t, int32(4000), ru)
+
+	throughput, err = parseThroughput(defaultEndpoint, "manual:400")
+	require.NoError(t, err)
+	ru, ok = throughput.ManualThroughput()
+	require.True(t, ok)
+	assert.Equal(t, int32(400), ru)
+
+	throughput, err = parseThroughput(defaultEndpoint, "none")
+	require.NoError(t, err)
+	assert.Nil(t, throughput)
+
+	for _, invalid := range []string{"400", "manual:", "manual:-1", "serverless:400", "autoscale:lots"} {
+		_, err := parseThroughput(defaultEndpoint, invalid)
+		assert.ErrorContains(t, err, ThroughputEnvVar, invalid)
+	}
+}
+
+func TestExplainAuthError(t *testing.T) {
+	forbidden := fmt.Errorf("failed to create database: %w", &azcore.ResponseError{StatusCode: http.StatusForbidden})
+	err := explainAuthError(forbidden, true)
+	assert.ErrorIs(t, err, forbidden)
+	assert.ErrorContains(t, err, "failed to create database: ")
+	assert.ErrorContains(t, err, "(with Entra ID authentication, the identity needs a Cosmos DB data-plane role assignment")
+
+	err = explainAuthError(&azcore.ResponseError{StatusCode: http.StatusUnauthorized}, false)
+	assert.ErrorContains(t, err, "(check AZURE_COSMOS_KEY is the account's key)")
+
+	conflict := &azcore.ResponseError{StatusCode: http.StatusConflict}
+	assert.Equal(t, conflict, explainAuthError(conflict, true))
+	assert.NoError(t, explainAuthError(nil, true))
+}
+
+func TestCreateClientUsesEntraIDWithoutAKey(t *testing.T) {
+	// Creating the credential doesn't authenticate, so this works without any credentials in the environment.
+	client, err := createClient("https://myaccount.documents.azure.com:443/", "")
+	if err != nil {
+		assert.ErrorContains(t, err, "Entra ID authentication")
+		return
+	}
+	assert.Equal(t, "https://myaccount.documents.azure.com:443/", client.Endpoint())
+}
@@ -0,0 +1,65 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Command cleanup deletes the databases that interrupted integration test runs leave behind.
+//
+// Usage:
+//
+//	go run ./cmd/cleanup [--endpoint ENDPOINT] [--key KEY] [--prefix PREFIX] [--older-than DURATION] [--dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/integration-tests/internal/cleanup"
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/emulator"
+)
+
+func getenvOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func main() {
+	endpoint := flag.String("endpoint", getenvOrDefault("AZURE_COSMOS_ENDPOINT", emulator.Endpoint), "the account endpoint, which defaults to AZURE_COSMOS_ENDPOINT or the emulator")
+	key := flag.String("key", os.Getenv("AZURE_COSMOS_KEY"), "the account key, which defaults to AZURE_COSMOS_KEY, the emulator's key for local endpoints, or Entra ID authentication")
+	prefix := flag.String("prefix", cleanup.DefaultPrefix, "only delete the databases whose name starts with this prefix")
+	olderThan := flag.Duration("older-than", 0, "only delete the databases last modified longer ago than this, such as 2h")
+	dryRun := flag.Bool("dry-run", false, "list the databases that would be deleted, without deleting them")
+	flag.Parse()
+
+	if *prefix == "" {
+		fmt.Fprintln(os.Stderr, "--prefix can't be empty, that would delete every database in the account")
+		os.Exit(2)
+	}
+
+	// Connect like the integration tests: with the emulator's key for local endpoints without a key, and with Entra ID for other endpoints without a key.
+	client, err := emulator.NewClient(*endpoint, emulator.ResolveKey(*endpoint, *key), nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	deleted, err := cleanup.Run(context.Background(), cleanup.NewClient(client), cleanup.Options{
+		Prefix:    *prefix,
+		OlderThan: *olderThan,
+		DryRun:    *dryRun,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Printf(format+"\n", args...)
+		},
+	})
+	if *dryRun {
+		fmt.Printf("Would delete %d databases\n", len(deleted))
+	} else {
+		fmt.Printf("Deleted %d databases\n", len(deleted))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
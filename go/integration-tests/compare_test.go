@@ -0,0 +1,65 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// CompareEnvVar, if set to "gateway", validates each query's results against the results of the same query run without the engine,
+// which the gateway executes, rather than against its baseline.
+// Queries the gateway can't run, such as cross-partition ORDER BY or aggregate queries, are still validated against their baseline, if they have one,
+// and skipped otherwise, so that queries don't need a baseline in this mode.
+const CompareEnvVar = "COSMOSCX_IT_COMPARE"
+
+const CompareGateway = "gateway"
+
+// What a query's results were validated against, as recorded in the report.
+const ValidationBaseline = "baseline"
+const ValidationGateway = "gateway"
+
+// ValidationBounds is recorded for a query without a baseline that's validated against its MinResults and MaxResults (see validateWithoutBaseline).
+const ValidationBounds = "bounds"
+
+// parseCompareMode parses the value of CompareEnvVar, which is "" when results are validated against baselines.
+func parseCompareMode(value string) (string, error) {
+	switch value {
+	case "", CompareGateway:
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid %s '%s', expected '%s' or nothing", CompareEnvVar, value, CompareGateway)
+	}
+}
+
+// executeGatewayQuery runs the query without the engine, so that the gateway executes it, with the same parameters and page size as executeQuery.
+func executeGatewayQuery(testData *TestData, query QuerySpec, container *azcosmos.ContainerClient) ([]interface{}, QueryStats, error) {
+	return runQuery(testData, query, container, nil)
+}
+
+func TestParseCompareMode(t *testing.T) {
+	mode, err := parseCompareMode("")
+	require.NoError(t, err)
+	assert.Equal(t, "", mode)
+
+	mode, err = parseCompareMode(CompareGateway)
+	require.NoError(t, err)
+	assert.Equal(t, CompareGateway, mode)
+
+	_, err = parseCompareMode("baseline")
+	assert.ErrorContains(t, err, CompareEnvVar)
+}
+
+func TestQueryStatsStringWithValidation(t *testing.T) {
+	stats := QueryStats{PageSizes: []int{2}, PageCharges: []float64{1.5}, TotalRU: 1.5, Requests: 2, Duration: 3 * time.Millisecond}
+	assert.Equal(t, "1 pages, 2 requests, 1.50 RU (per page: [1.5]), 3ms", stats.String())
+
+	stats.Validation = ValidationGateway
+	assert.Equal(t, "1 pages, 2 requests, 1.50 RU (per page: [1.5]), 3ms, validated against the gateway", stats.String())
+}
@@ -0,0 +1,388 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// CoverageDirEnvVar, if set, is the directory TestFeatureCoverage writes its coverage matrix to, as feature-coverage.json and feature-coverage.md.
+const CoverageDirEnvVar = "COSMOSCX_IT_COVERAGE_DIR"
+
+// Values of QueryCoverage.Source.
+const CoverageSourcePlan = "plan"
+const CoverageSourceInferred = "inferred"
+
+// QueryCoverage is the features a query of the baseline suite requires of the engine.
+type QueryCoverage struct {
+	QuerySet string   `json:"querySet"`
+	Query    string   `json:"query"`
+	Features []string `json:"features"`
+
+	// Source is CoverageSourcePlan if the features come from the query plan recorded in the query's fixture (see Fixture),
+	// or CoverageSourceInferred if they were inferred from the query's text (see inferFeatures).
+	Source string `json:"source"`
+}
+
+// CoverageReport is the matrix of the features the queries of the baseline suite require, by query set.
+type CoverageReport struct {
+	// Supported are the features the engine claims in azcosmoscx.SupportedFeatures.
+	Supported []string `json:"supported"`
+
+	// Coverage lists the queries requiring each feature, by feature and then by query set.
+	// Every supported feature is listed, even if no query requires it.
+	Coverage map[string]map[string][]string `json:"coverage"`
+
+	Queries []QueryCoverage `json:"queries"`
+}
+
+// buildCoverageReport builds the coverage matrix of the query sets in dir (see queryCoverage). Queries expected to fail are left out,
+// since they don't run the features they would require.
+func buildCoverageReport(dir string, supported []string) (*CoverageReport, error) {
+	querySets, err := discoverQuerySets(dir, "", "")
+	if err != nil {
+		return nil, err
+	}
+	report := &CoverageReport{Supported: supported, Coverage: make(map[string]map[string][]string), Queries: []QueryCoverage{}}
+	for _, feature := range supported {
+		report.Coverage[feature] = map[string][]string{}
+	}
+	for _, fileName := range querySets {
+		querySetPath := path.Join(dir, fileName)
+		data, err := os.ReadFile(querySetPath)
+		if err != nil {
+			return nil, err
+		}
+		querySet, err := decodeQuerySet(querySetPath, data)
+		if err != nil {
+			return nil, err
+		}
+		for _, query := range querySet.Queries {
+			if query.ExpectError != nil {
+				continue
+			}
+			coverage, err := queryCoverage(querySetPath, query)
+			if err != nil {
+				return nil, err
+			}
+			report.Queries = append(report.Queries, coverage)
+			for _, feature := range coverage.Features {
+				if report.Coverage[feature] == nil {
+					report.Coverage[feature] = map[string][]string{}
+				}
+				report.Coverage[feature][coverage.QuerySet] = append(report.Coverage[feature][coverage.QuerySet], query.Name)
+			}
+		}
+	}
+	return report, nil
+}
+
+// queryCoverage returns the features a query requires: those of the plan recorded in its fixture, if it has one that's up to date, which are what the engine checks plans for,
+// or those inferred from its text otherwise. Recording fixtures (see FixturesEnvVar) is how plans are fetched from the gateway and cached.
+func queryCoverage(querySetPath string, query QuerySpec) (QueryCoverage, error) {
+	coverage := QueryCoverage{QuerySet: querySetName(querySetPath), Query: query.Name}
+	fixture, err := loadFixture(fixturePath(querySetPath, query.Name), query)
+	if errors.Is(err, os.ErrNotExist) {
+		coverage.Features = inferFeatures(query.Text).Names()
+		coverage.Source = CoverageSourceInferred
+		return coverage, nil
+	}
+	if err != nil {
+		return QueryCoverage{}, err
+	}
+	support, err := azcosmoscx.CheckQueryPlan(string(fixture.Plan))
+	if err != nil {
+		return QueryCoverage{}, fmt.Errorf("invalid plan in the fixture of query %s: %w", query.Name, err)
+	}
+	coverage.Features = make([]string, 0, len(support.Required))
+	for _, feature := range support.Required {
+		// The engine reports features by their camelCase names, such as "orderBy", rather than the names it claims them by, such as "OrderBy".
+		coverage.Features = append(coverage.Features, strings.ToUpper(feature[:1])+feature[1:])
+	}
+	coverage.Source = CoverageSourcePlan
+	return coverage, nil
+}
+
+var (
+	stringLiteralPattern = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"`)
+	rankPattern          = regexp.MustCompile(`\bORDER\s+BY\s+RANK\b`)
+	dCountPattern        = regexp.MustCompile(`\bFROM\s*\(\s*SELECT\s+DISTINCT\b`)
+	projectionPattern    = regexp.MustCompile(`^\s*SELECT\s+(.*?)\s+FROM\b`)
+	distinctPattern      = regexp.MustCompile(`^DISTINCT\b`)
+	topPattern           = regexp.MustCompile(`^(?:DISTINCT\s+)?TOP\b`)
+	valuePattern         = regexp.MustCompile(`^(?:DISTINCT\s+)?(?:TOP\s+\S+\s+)?VALUE\b`)
+	aggregatePattern     = regexp.MustCompile(`\b(COUNT|SUM|AVG|MIN|MAX|COUNTIF|MAKELIST|MAKESET)\s*\(`)
+	groupByPattern       = regexp.MustCompile(`\bGROUP\s+BY\b`)
+	orderByPattern       = regexp.MustCompile(`\bORDER\s+BY\b(.*?)(?:\bOFFSET\b|\bLIMIT\b|$)`)
+	offsetLimitPattern   = regexp.MustCompile(`\b(?:OFFSET|LIMIT)\b`)
+)
+
+// inferFeatures infers the features the query plan of a query requires from its text, as the engine checks plans for them (see azcosmoscx.CheckQueryPlan).
+// Only the outermost query is considered, since subqueries, such as in an EXISTS, run within each partition.
+// A hybrid search query only requires HybridSearch, since its plan describes its component queries instead of the query itself.
+func inferFeatures(text string) azcosmoscx.FeatureSet {
+	var features azcosmoscx.FeatureSet
+	text = stringLiteralPattern.ReplaceAllString(strings.ToUpper(text), "''")
+	outer := outermostQuery(text)
+	if rankPattern.MatchString(outer) {
+		features.HybridSearch = true
+		return features
+	}
+
+	projection := ""
+	if match := projectionPattern.FindStringSubmatch(outer); match != nil {
+		projection = match[1]
+	}
+	features.Top = topPattern.MatchString(projection)
+	features.OffsetLimit = offsetLimitPattern.MatchString(outer)
+
+	switch {
+	case dCountPattern.MatchString(text):
+		// A count of a DISTINCT subquery is executed as a DCOUNT, whose DISTINCT is part of it.
+		features.DCount = true
+	case groupByPattern.MatchString(outer):
+		// The aggregates of a GROUP BY query are aggregated per group, rather than across the query.
+		features.GroupBy = true
+		features.Distinct = distinctPattern.MatchString(projection)
+	default:
+		features.Distinct = distinctPattern.MatchString(projection)
+		aggregates := aggregatePattern.FindAllStringSubmatch(projection, -1)
+		features.Aggregate = len(aggregates) > 0
+		features.MultipleAggregates = len(aggregates) > 1
+		features.NonValueAggregate = len(aggregates) > 0 && !valuePattern.MatchString(projection)
+		for _, aggregate := range aggregates {
+			switch aggregate[1] {
+			case "COUNTIF":
+				features.CountIf = true
+			case "MAKELIST", "MAKESET":
+				features.ListAndSetAggregate = true
+			}
+		}
+	}
+
+	if match := orderByPattern.FindStringSubmatch(outer); match != nil {
+		features.OrderBy = true
+		features.MultipleOrderBy = strings.Contains(match[1], ",")
+		features.NonStreamingOrderBy = strings.Contains(match[1], "VECTORDISTANCE")
+	}
+	return features
+}
+
+// outermostQuery removes what's inside the parentheses of a query, leaving the parentheses, so that only the outermost query's clauses remain,
+// such as "SELECT VALUE COUNT() FROM ()" for a count of a subquery.
+func outermostQuery(text string) string {
+	var outer strings.Builder
+	depth := 0
+	for _, r := range text {
+		switch {
+		case r == '(':
+			if depth == 0 {
+				outer.WriteRune(r)
+			}
+			depth++
+		case r == ')':
+			depth = max(depth-1, 0)
+			if depth == 0 {
+				outer.WriteRune(r)
+			}
+		case depth == 0:
+			outer.WriteRune(r)
+		}
+	}
+	return outer.String()
+}
+
+// features returns every feature in the report, the supported ones first, each sorted.
+func (r *CoverageReport) features() []string {
+	features := slices.Clone(r.Supported)
+	sort.Strings(features)
+	var others []string
+	for feature := range r.Coverage {
+		if !slices.Contains(r.Supported, feature) {
+			others = append(others, feature)
+		}
+	}
+	sort.Strings(others)
+	return append(features, others...)
+}
+
+// querySets returns the names of the query sets in the report, sorted.
+func (r *CoverageReport) querySets() []string {
+	var querySets []string
+	for _, query := range r.Queries {
+		if !slices.Contains(querySets, query.QuerySet) {
+			querySets = append(querySets, query.QuerySet)
+		}
+	}
+	sort.Strings(querySets)
+	return querySets
+}
+
+// uncovered returns the supported features no query requires.
+func (r *CoverageReport) uncovered() []string {
+	var uncovered []string
+	for _, feature := range r.features() {
+		if slices.Contains(r.Supported, feature) && len(r.Coverage[feature]) == 0 {
+			uncovered = append(uncovered, feature)
+		}
+	}
+	return uncovered
+}
+
+// markdown renders the report as a table with a row per feature and a column per query set, counting the queries that require each feature.
+func (r *CoverageReport) markdown() string {
+	querySets := r.querySets()
+	var b strings.Builder
+	b.WriteString("| Feature | Supported |")
+	for _, querySet := range querySets {
+		fmt.Fprintf(&b, " %s |", querySet)
+	}
+	b.WriteString("\n| --- | --- |")
+	b.WriteString(strings.Repeat(" ---: |", len(querySets)))
+	b.WriteString("\n")
+	for _, feature := range r.features() {
+		supported := "no"
+		if slices.Contains(r.Supported, feature) {
+			supported = "yes"
+		}
+		fmt.Fprintf(&b, "| %s | %s |", feature, supported)
+		for _, querySet := range querySets {
+			if count := len(r.Coverage[feature][querySet]); count > 0 {
+				fmt.Fprintf(&b, " %d |", count)
+			} else {
+				b.WriteString(" - |")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// write writes the report to dir, as indented JSON to feature-coverage.json and as a markdown table to feature-coverage.md.
+func (r *CoverageReport) write(dir string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(dir, "feature-coverage.json"), data, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, "feature-coverage.md"), []byte(r.markdown()), 0o644)
+}
+
+// TestFeatureCoverage checks that every feature the engine claims to support is required by at least one query of the baseline suite,
+// so that claiming a feature the suite doesn't exercise fails. It runs without an account.
+func TestFeatureCoverage(t *testing.T) {
+	report, err := buildCoverageReport(path.Join("..", "..", "baselines", "queries"), azcosmoscx.SupportedFeatureSet().Names())
+	require.NoError(t, err)
+	t.Logf("Feature coverage of %d queries:\n%s", len(report.Queries), report.markdown())
+
+	if dir := os.Getenv(CoverageDirEnvVar); dir != "" {
+		require.NoError(t, report.write(dir))
+		t.Logf("Wrote the feature coverage to %s", dir)
+	}
+	for _, feature := range report.uncovered() {
+		t.Errorf("The engine supports %s, but no query in baselines/queries requires it; add one", feature)
+	}
+}
+
+func TestInferFeatures(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected []string
+	}{
+		{"SELECT * FROM c", nil},
+		{"SELECT * FROM c ORDER BY c.name", []string{"OrderBy"}},
+		{"SELECT c.id FROM c ORDER BY c.category ASC, c.price DESC", []string{"MultipleOrderBy", "OrderBy"}},
+		{"SELECT TOP 5 c.id FROM c ORDER BY VectorDistance(c.embedding, [1, 2])", []string{"OrderBy", "Top", "NonStreamingOrderBy"}},
+		{"SELECT c.id FROM c ORDER BY c.seq OFFSET 10 LIMIT 10", []string{"OffsetAndLimit", "OrderBy"}},
+		{"SELECT VALUE COUNT(1) FROM c", []string{"Aggregate"}},
+		{"SELECT COUNT(1) AS count, SUM(c.price) AS total FROM c", []string{"Aggregate", "MultipleAggregates", "NonValueAggregate"}},
+		{"SELECT VALUE MakeSet(c.name) FROM c", []string{"Aggregate", "ListAndSetAggregate"}},
+		{"SELECT VALUE CountIf(c.price > 10) FROM c", []string{"Aggregate", "CountIf"}},
+		{"SELECT DISTINCT VALUE c.name FROM c", []string{"Distinct"}},
+		{"SELECT VALUE COUNT(1) FROM (SELECT DISTINCT VALUE t.name FROM c JOIN t IN c.tags)", []string{"DCount"}},
+		{"SELECT c.categoryId, COUNT(1) AS count FROM c GROUP BY c.categoryId", []string{"GroupBy"}},
+		{"SELECT TOP 10 c.title FROM c ORDER BY RANK RRF(FullTextScore(c.title, 'a'), FullTextScore(c.text, 'b'))", []string{"HybridSearch"}},
+
+		// Subqueries, string literals, and function names that contain keywords don't count.
+		{"SELECT c.id, ARRAY(SELECT VALUE COUNT(1) FROM t IN c.tags) AS tags FROM c", nil},
+		{"SELECT * FROM c WHERE c.name = 'ORDER BY c.x, c.y' AND EXISTS(SELECT VALUE t FROM t IN c.tags ORDER BY t)", nil},
+		{"select top 3 c.id from c where c.pk = 'b' order by c.id", []string{"OrderBy", "Top"}},
+	}
+	for _, c := range cases {
+		assert.ElementsMatch(t, c.expected, inferFeatures(c.query).Names(), c.query)
+	}
+}
+
+func TestOutermostQuery(t *testing.T) {
+	assert.Equal(t, "SELECT VALUE COUNT() FROM ()", outermostQuery("SELECT VALUE COUNT(1) FROM (SELECT DISTINCT VALUE LOWER(c.name) FROM c)"))
+	assert.Equal(t, "SELECT * FROM c WHERE )", outermostQuery("SELECT * FROM c WHERE )"))
+}
+
+func TestQueryCoverageFromFixture(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(FixturesDirEnvVar, dir)
+	data, err := os.ReadFile(path.Join("testdata", "order_by.fixture.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(path.Join(dir, "set"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(dir, "set", "order_by.fixture.json"), data, 0o644))
+
+	coverage, err := queryCoverage("set.json", orderByFixtureQuery)
+	require.NoError(t, err)
+	assert.Equal(t, QueryCoverage{QuerySet: "set", Query: "order_by", Features: []string{"OrderBy"}, Source: CoverageSourcePlan}, coverage)
+
+	// A query without a fixture has its features inferred.
+	coverage, err = queryCoverage("set.json", QuerySpec{Name: "top", Text: "SELECT TOP 1 * FROM c"})
+	require.NoError(t, err)
+	assert.Equal(t, QueryCoverage{QuerySet: "set", Query: "top", Features: []string{"Top"}, Source: CoverageSourceInferred}, coverage)
+
+	// A fixture recorded for another text fails, rather than reporting stale features.
+	_, err = queryCoverage("set.json", QuerySpec{Name: "order_by", Text: "SELECT * FROM c"})
+	assert.ErrorContains(t, err, "record it again")
+}
+
+func TestCoverageReport(t *testing.T) {
+	report := &CoverageReport{
+		Supported: []string{"Top", "OrderBy"},
+		Coverage: map[string]map[string][]string{
+			"OrderBy": {"order_by": {"a", "b"}, "vector": {"c"}},
+			"Top":     {},
+			"GroupBy": {"errors": {"d"}},
+		},
+		Queries: []QueryCoverage{{QuerySet: "vector"}, {QuerySet: "order_by"}, {QuerySet: "errors"}},
+	}
+	assert.Equal(t, []string{"OrderBy", "Top", "GroupBy"}, report.features())
+	assert.Equal(t, []string{"Top"}, report.uncovered())
+	assert.Equal(t, "| Feature | Supported | errors | order_by | vector |\n"+
+		"| --- | --- | ---: | ---: | ---: |\n"+
+		"| OrderBy | yes | - | 2 | 1 |\n"+
+		"| Top | yes | - | - | - |\n"+
+		"| GroupBy | no | 1 | - | - |\n", report.markdown())
+
+	dir := t.TempDir()
+	require.NoError(t, report.write(dir))
+	assert.FileExists(t, path.Join(dir, "feature-coverage.md"))
+	data, err := os.ReadFile(path.Join(dir, "feature-coverage.json"))
+	require.NoError(t, err)
+	var written CoverageReport
+	require.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, report.Coverage, written.Coverage)
+}
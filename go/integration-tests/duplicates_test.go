@@ -0,0 +1,168 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// maxReportedDuplicates is the most duplicated items checkDuplicates lists, so that a query that repeats every item doesn't produce a huge message.
+const maxReportedDuplicates = 10
+
+// duplicateItem is an item a query returned more than once.
+type duplicateItem struct {
+	// Key identifies the item, by its id and, if available, its partition key values (see duplicateKey).
+	Key string
+
+	// Pages are the indices of the pages the item was returned on, once per time it was returned.
+	Pages []int
+}
+
+// duplicateKey identifies an item by its "id" and, if it has them, the values of the container's partition key paths,
+// since items in different logical partitions can have the same id. Items without an id, such as projections, aren't identified.
+func duplicateKey(item interface{}, partitionKeyPaths []string) (string, bool) {
+	object, ok := item.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	id, ok := object["id"].(string)
+	if !ok {
+		return "", false
+	}
+	encodedID, _ := json.Marshal(id)
+	key := "id " + string(encodedID)
+
+	values := make([]interface{}, 0, len(partitionKeyPaths))
+	for _, path := range partitionKeyPaths {
+		value, found, err := lookupProperty(item, path)
+		if err != nil || !found {
+			return key, true
+		}
+		values = append(values, value)
+	}
+	if len(values) > 0 {
+		if encodedValues, err := json.Marshal(values); err == nil {
+			key += " (partition key " + string(encodedValues) + ")"
+		}
+	}
+	return key, true
+}
+
+// findDuplicates returns the items returned more than once, in the order they were first returned, with the pages they were returned on.
+// pageSizes are the number of items in each page (see pageSizes), which locate each item's page.
+func findDuplicates(items []interface{}, pageSizes []int, partitionKeyPaths []string) []duplicateItem {
+	pages := make(map[string][]int, len(items))
+	var order []string
+	page, pageEnd := 0, 0
+	if len(pageSizes) > 0 {
+		pageEnd = pageSizes[0]
+	}
+	for i, item := range items {
+		for i >= pageEnd && page < len(pageSizes)-1 {
+			page++
+			pageEnd += pageSizes[page]
+		}
+		key, ok := duplicateKey(item, partitionKeyPaths)
+		if !ok {
+			continue
+		}
+		if _, seen := pages[key]; !seen {
+			order = append(order, key)
+		}
+		pages[key] = append(pages[key], page)
+	}
+
+	var duplicates []duplicateItem
+	for _, key := range order {
+		if len(pages[key]) > 1 {
+			duplicates = append(duplicates, duplicateItem{Key: key, Pages: pages[key]})
+		}
+	}
+	return duplicates
+}
+
+// checkDuplicates fails if the query returned an item more than once, unless it allows duplicates, listing the duplicated items and the pages they were returned on.
+func checkDuplicates(query QuerySpec, items []interface{}, pageSizes []int, partitionKeyPaths []string) error {
+	if query.AllowDuplicates {
+		return nil
+	}
+	duplicates := findDuplicates(items, pageSizes, partitionKeyPaths)
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	descriptions := make([]string, 0, min(len(duplicates), maxReportedDuplicates))
+	for _, duplicate := range duplicates[:min(len(duplicates), maxReportedDuplicates)] {
+		descriptions = append(descriptions, fmt.Sprintf("%s on pages %v", duplicate.Key, duplicate.Pages))
+	}
+	if len(duplicates) > maxReportedDuplicates {
+		descriptions = append(descriptions, fmt.Sprintf("and %d more", len(duplicates)-maxReportedDuplicates))
+	}
+	return fmt.Errorf("query returned %d items more than once (set allowDuplicates if it can): %s", len(duplicates), strings.Join(descriptions, "; "))
+}
+
+// partitionKeyPaths returns the partition key paths of a container in the test data, or nil if it isn't found.
+func (d *TestData) partitionKeyPaths(containerID string) []string {
+	for _, container := range d.Containers {
+		if container.ID == containerID {
+			return container.PartitionKeyDefinition.Paths
+		}
+	}
+	return nil
+}
+
+func keyedItem(id string, pk string) interface{} {
+	return map[string]interface{}{"id": id, "pk": pk}
+}
+
+func TestFindDuplicatesAcrossPages(t *testing.T) {
+	items := []interface{}{keyedItem("a", "1"), keyedItem("b", "1"), keyedItem("c", "2"), keyedItem("a", "1"), keyedItem("b", "1"), keyedItem("a", "1")}
+	duplicates := findDuplicates(items, []int{2, 1, 3}, []string{"/pk"})
+	assert.Equal(t, []duplicateItem{
+		{Key: `id "a" (partition key ["1"])`, Pages: []int{0, 2, 2}},
+		{Key: `id "b" (partition key ["1"])`, Pages: []int{0, 2}},
+	}, duplicates)
+}
+
+func TestFindDuplicatesDistinguishesPartitionKeys(t *testing.T) {
+	items := []interface{}{keyedItem("a", "1"), keyedItem("a", "2")}
+	assert.Empty(t, findDuplicates(items, []int{2}, []string{"/pk"}))
+
+	// Without the partition key, items are identified by id alone.
+	assert.Len(t, findDuplicates(items, []int{2}, nil), 1)
+	assert.Len(t, findDuplicates([]interface{}{map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "a"}}, []int{2}, []string{"/pk"}), 1, "projections without the partition key")
+}
+
+func TestFindDuplicatesIgnoresItemsWithoutID(t *testing.T) {
+	items := []interface{}{1.0, 1.0, map[string]interface{}{"name": "x"}, map[string]interface{}{"name": "x"}}
+	assert.Empty(t, findDuplicates(items, []int{4}, nil))
+}
+
+func TestCheckDuplicates(t *testing.T) {
+	items := []interface{}{keyedItem("a", "1"), keyedItem("a", "1")}
+	err := checkDuplicates(QuerySpec{}, items, []int{1, 1}, []string{"/pk"})
+	require.Error(t, err)
+	assert.Equal(t, `query returned 1 items more than once (set allowDuplicates if it can): id "a" (partition key ["1"]) on pages [0 1]`, err.Error())
+
+	assert.NoError(t, checkDuplicates(QuerySpec{AllowDuplicates: true}, items, []int{1, 1}, nil))
+	assert.NoError(t, checkDuplicates(QuerySpec{}, []interface{}{keyedItem("a", "1"), keyedItem("b", "1")}, []int{2}, nil))
+}
+
+func TestCheckDuplicatesLimitsTheMessage(t *testing.T) {
+	var items []interface{}
+	for i := 0; i < maxReportedDuplicates+2; i++ {
+		id := fmt.Sprintf("item-%d", i)
+		items = append(items, keyedItem(id, "1"), keyedItem(id, "1"))
+	}
+	err := checkDuplicates(QuerySpec{}, items, []int{len(items)}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("query returned %d items", maxReportedDuplicates+2))
+	assert.True(t, strings.HasSuffix(err.Error(), "; and 2 more"), err.Error())
+}
@@ -0,0 +1,215 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The stages at which a query can fail.
+const (
+	// ErrorStagePipelineCreation is an error from the client engine while creating the query pipeline, such as an unsupported query plan.
+	ErrorStagePipelineCreation = "pipelineCreation"
+
+	// ErrorStageFirstPage is any other error while fetching the first page, such as the service rejecting the query.
+	ErrorStageFirstPage = "firstPage"
+
+	// ErrorStagePage is an error while fetching a later page.
+	ErrorStagePage = "page"
+)
+
+// engineErrorCodes are the codes that ExpectedError.Code can use to match errors from the client engine.
+var engineErrorCodes = map[string]error{
+	"InvalidGatewayResponse":   azcosmoscx.ErrInvalidGatewayResponse,
+	"DeserializationError":     azcosmoscx.ErrDeserialization,
+	"UnknownPartitionKeyRange": azcosmoscx.ErrUnknownPartitionKeyRange,
+	"InternalError":            azcosmoscx.ErrInternal,
+	"UnsupportedQueryPlan":     azcosmoscx.ErrUnsupportedQueryPlan,
+	"InvalidUTF8String":        azcosmoscx.ErrInvalidUTF8String,
+	"ArgumentNull":             azcosmoscx.ErrArgumentNull,
+	"ArithmeticOverflow":       azcosmoscx.ErrArithmeticOverflow,
+	"InvalidRequestID":         azcosmoscx.ErrInvalidRequestID,
+	"InvalidQuery":             azcosmoscx.ErrInvalidQuery,
+	"InvalidContinuation":      azcosmoscx.ErrInvalidContinuation,
+}
+
+// ExpectedError describes the error a query is expected to fail with, for queries that document what the engine or the service doesn't support.
+type ExpectedError struct {
+	// Message, if set, must be a substring of the error's message.
+	Message string `json:"message"`
+
+	// Code, if set, must match the error's code: the name of a client engine result code (one of engineErrorCodes, such as "UnsupportedQueryPlan"),
+	// or the error code (such as "BadRequest") or HTTP status code (such as "400") of a service error.
+	Code string `json:"code"`
+
+	// Stage, if set, is the stage at which the query must fail, either ErrorStagePipelineCreation or ErrorStageFirstPage.
+	Stage string `json:"stage"`
+}
+
+// QueryError is an error that a query failed with, and the stage at which it failed.
+type QueryError struct {
+	Stage string
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("query failed (%s): %v", e.Stage, e.Err)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// stageRecordingEngine wraps a query engine to record whether creating the pipeline failed.
+type stageRecordingEngine struct {
+	queryengine.QueryEngine
+	createErr error
+}
+
+func (e *stageRecordingEngine) CreateQueryPipeline(query string, plan string, pkranges string) (queryengine.QueryPipeline, error) {
+	pipeline, err := e.QueryEngine.CreateQueryPipeline(query, plan, pkranges)
+	if err != nil {
+		e.createErr = err
+	}
+	return pipeline, err
+}
+
+// checkExpectedError checks that a query failed as expected, returning an error describing how it didn't.
+func checkExpectedError(expected *ExpectedError, items []interface{}, err error) error {
+	if err == nil {
+		return fmt.Errorf("query returned %d items, but was expected to fail with %s", len(items), expected)
+	}
+
+	var queryErr *QueryError
+	stage := ""
+	if errors.As(err, &queryErr) {
+		stage = queryErr.Stage
+	}
+	switch expected.Stage {
+	case "":
+	case ErrorStagePipelineCreation, ErrorStageFirstPage:
+		if stage != expected.Stage {
+			return fmt.Errorf("expected an error at stage '%s', but the query failed at stage '%s': %w", expected.Stage, stage, err)
+		}
+	default:
+		return fmt.Errorf("unknown error stage '%s'", expected.Stage)
+	}
+
+	if expected.Message != "" && !strings.Contains(err.Error(), expected.Message) {
+		return fmt.Errorf("expected an error containing %q: %w", expected.Message, err)
+	}
+	if expected.Code != "" {
+		matched, codeErr := matchesErrorCode(err, expected.Code)
+		if codeErr != nil {
+			return codeErr
+		}
+		if !matched {
+			return fmt.Errorf("expected an error with code '%s': %w", expected.Code, err)
+		}
+	}
+	return nil
+}
+
+// matchesErrorCode checks whether an error has a code (see ExpectedError.Code).
+func matchesErrorCode(err error, code string) (bool, error) {
+	if sentinel, ok := engineErrorCodes[code]; ok {
+		return errors.Is(err, sentinel), nil
+	}
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) {
+		return false, nil
+	}
+	if status, parseErr := strconv.Atoi(code); parseErr == nil {
+		return responseErr.StatusCode == status, nil
+	}
+	if code == "" || strings.ContainsAny(code, " :") {
+		return false, fmt.Errorf("invalid error code '%s'", code)
+	}
+	return responseErr.ErrorCode == code, nil
+}
+
+func (e *ExpectedError) String() string {
+	parts := make([]string, 0, 3)
+	if e.Code != "" {
+		parts = append(parts, fmt.Sprintf("code '%s'", e.Code))
+	}
+	if e.Message != "" {
+		parts = append(parts, fmt.Sprintf("message containing %q", e.Message))
+	}
+	if e.Stage != "" {
+		parts = append(parts, fmt.Sprintf("at stage '%s'", e.Stage))
+	}
+	if len(parts) == 0 {
+		return "an error"
+	}
+	return "an error with " + strings.Join(parts, ", ")
+}
+
+func TestCheckExpectedErrorMatches(t *testing.T) {
+	engineErr := &QueryError{Stage: ErrorStagePipelineCreation, Err: fmt.Errorf("creating pipeline: %w", azcosmoscx.ErrUnsupportedQueryPlan)}
+	serviceErr := &QueryError{Stage: ErrorStageFirstPage, Err: &azcore.ResponseError{StatusCode: http.StatusBadRequest, ErrorCode: "BadRequest"}}
+
+	cases := []struct {
+		expected ExpectedError
+		err      error
+	}{
+		{ExpectedError{}, engineErr},
+		{ExpectedError{Code: "UnsupportedQueryPlan", Stage: ErrorStagePipelineCreation}, engineErr},
+		{ExpectedError{Message: "unsupported query plan"}, engineErr},
+		{ExpectedError{Code: "BadRequest", Stage: ErrorStageFirstPage}, serviceErr},
+		{ExpectedError{Code: "400"}, serviceErr},
+	}
+	for _, c := range cases {
+		assert.NoError(t, checkExpectedError(&c.expected, nil, c.err), "%s", &c.expected)
+	}
+}
+
+func TestCheckExpectedErrorMismatches(t *testing.T) {
+	engineErr := &QueryError{Stage: ErrorStagePipelineCreation, Err: azcosmoscx.ErrUnsupportedQueryPlan}
+	serviceErr := &QueryError{Stage: ErrorStageFirstPage, Err: &azcore.ResponseError{StatusCode: http.StatusBadRequest, ErrorCode: "BadRequest"}}
+
+	err := checkExpectedError(&ExpectedError{Code: "UnsupportedQueryPlan"}, []interface{}{1.0, 2.0}, nil)
+	assert.EqualError(t, err, "query returned 2 items, but was expected to fail with an error with code 'UnsupportedQueryPlan'")
+
+	err = checkExpectedError(&ExpectedError{Stage: ErrorStagePipelineCreation}, nil, serviceErr)
+	assert.ErrorContains(t, err, "expected an error at stage 'pipelineCreation', but the query failed at stage 'firstPage'")
+
+	err = checkExpectedError(&ExpectedError{Code: "InvalidQuery"}, nil, engineErr)
+	assert.ErrorContains(t, err, "expected an error with code 'InvalidQuery'")
+	err = checkExpectedError(&ExpectedError{Code: "404"}, nil, serviceErr)
+	assert.ErrorContains(t, err, "expected an error with code '404'")
+	err = checkExpectedError(&ExpectedError{Code: "NotFound"}, nil, serviceErr)
+	assert.ErrorContains(t, err, "expected an error with code 'NotFound'")
+	err = checkExpectedError(&ExpectedError{Code: "BadRequest"}, nil, engineErr)
+	assert.ErrorContains(t, err, "expected an error with code 'BadRequest'")
+
+	err = checkExpectedError(&ExpectedError{Message: "GROUP BY"}, nil, engineErr)
+	assert.ErrorContains(t, err, `expected an error containing "GROUP BY"`)
+
+	err = checkExpectedError(&ExpectedError{Stage: "later"}, nil, engineErr)
+	assert.EqualError(t, err, "unknown error stage 'later'")
+
+	// The original error is kept, so that it's reported in full.
+	err = checkExpectedError(&ExpectedError{Stage: ErrorStageFirstPage}, nil, engineErr)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, azcosmoscx.ErrUnsupportedQueryPlan)
+}
+
+func TestStageRecordingEngine(t *testing.T) {
+	engine := &stageRecordingEngine{QueryEngine: azcosmoscx.NewQueryEngine()}
+	_, err := engine.CreateQueryPipeline("SELECT * FROM c", "{", `{"PartitionKeyRanges":[]}`)
+	require.Error(t, err)
+	assert.Equal(t, err, engine.createErr)
+}
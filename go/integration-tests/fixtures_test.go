@@ -0,0 +1,406 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// FixturesEnvVar, if set to "record", records a fixture of what the engine is given while running each query: the query plan, the partition key ranges,
+// and the response to every request it makes. If set to "replay", the queries are run from their fixtures instead, without an account,
+// by driving the engine's pipeline directly, and their results are validated against the same baselines.
+// Queries without a fixture, and queries that resume each page from a new pipeline, which fixtures don't record, are skipped in replay mode.
+const FixturesEnvVar = "COSMOSCX_IT_FIXTURES"
+
+// FixturesDirEnvVar overrides the directory fixtures are recorded to and replayed from, which is baselines/fixtures by default.
+// Each query's fixture is at <query set>/<query>.fixture.json in the directory.
+const FixturesDirEnvVar = "COSMOSCX_IT_FIXTURES_DIR"
+
+const FixturesRecord = "record"
+const FixturesReplay = "replay"
+
+// FixtureVersion is the version of the fixture format that's recorded and replayed. Fixtures with another version must be recorded again.
+const FixtureVersion = 1
+
+// Fixture records what the engine was given while running a query, so that the query can be replayed without an account (see replayQuery).
+type Fixture struct {
+	// Version is the version of the fixture format (see FixtureVersion).
+	Version int `json:"version"`
+
+	// Query and MaxItemCount are the query's text and page size when the fixture was recorded. A fixture isn't replayed for a query that has changed since.
+	Query        string `json:"query"`
+	MaxItemCount int32  `json:"maxItemCount,omitempty"`
+
+	// Plan and PartitionKeyRanges are the query plan and partition key ranges the pipeline was created with, as the gateway returned them.
+	Plan               json.RawMessage `json:"plan"`
+	PartitionKeyRanges json.RawMessage `json:"pkranges"`
+
+	// Responses are the responses to the requests the pipeline made, in the order they were made.
+	Responses []FixtureResponse `json:"responses"`
+}
+
+// FixtureResponse is the response to a request the pipeline made, which is identified by its partition key range, continuation, and query.
+type FixtureResponse struct {
+	PartitionKeyRangeID string `json:"pkrangeId"`
+	Continuation        string `json:"continuation,omitempty"`
+
+	// Query is the query the request overrode the pipeline's query with, if any.
+	Query string `json:"query,omitempty"`
+
+	// Pages are the pages the request returned, which are more than one if the pipeline asked for the partition to be drained.
+	Pages []FixturePage `json:"pages"`
+}
+
+// FixturePage is a page of a response: its body, and the continuation returned with it.
+type FixturePage struct {
+	Continuation string          `json:"continuation,omitempty"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// parseFixturesMode parses the value of FixturesEnvVar, which is "" when fixtures are neither recorded nor replayed.
+func parseFixturesMode(value string) (string, error) {
+	switch value {
+	case "", FixturesRecord, FixturesReplay:
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid %s '%s', expected '%s', '%s', or nothing", FixturesEnvVar, value, FixturesRecord, FixturesReplay)
+	}
+}
+
+// fixturePath returns the path of the fixture of a query in a query set.
+func fixturePath(querySetPath string, queryName string) string {
+	dir := getenvOrDefault(FixturesDirEnvVar, path.Join("..", "..", "baselines", "fixtures"))
+	return path.Join(dir, querySetName(querySetPath), queryName+".fixture.json")
+}
+
+// loadFixture reads the fixture at path, checking that it has the current version and was recorded for the query as it's specified now.
+// If the fixture doesn't exist, the error wraps os.ErrNotExist.
+func loadFixture(path string, query QuerySpec) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	if fixture.Version != FixtureVersion {
+		return nil, fmt.Errorf("fixture %s has version %d, but version %d is expected; record it again with %s=%s", path, fixture.Version, FixtureVersion, FixturesEnvVar, FixturesRecord)
+	}
+	if fixture.Query != query.Text || fixture.MaxItemCount != query.MaxItemCount {
+		return nil, fmt.Errorf("fixture %s was recorded for a different text or maxItemCount than query %s has; record it again with %s=%s", path, query.Name, FixturesEnvVar, FixturesRecord)
+	}
+	return &fixture, nil
+}
+
+// write writes the fixture to path, creating its directory if needed.
+func (f *Fixture) write(fixturePath string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(fixturePath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(fixturePath, append(data, '\n'), 0o644)
+}
+
+// recordQuery runs the query through the engine, like executeQuery, and records its fixture to fixturePath.
+// A query that fails before its pipeline is created, or because a request failed, can't be replayed, so no fixture is recorded for it.
+func recordQuery(testData *TestData, query QuerySpec, container *azcosmos.ContainerClient, fixturePath string) ([]interface{}, QueryStats, error) {
+	recorder := &fixtureRecorder{QueryEngine: azcosmoscx.NewQueryEngine()}
+	items, stats, err := runQuery(testData, query, container, recorder)
+	var responseErr *azcore.ResponseError
+	if recorder.fixture == nil || errors.As(err, &responseErr) {
+		return items, stats, err
+	}
+	recorder.fixture.MaxItemCount = query.MaxItemCount
+	if writeErr := recorder.fixture.write(fixturePath); writeErr != nil {
+		return items, stats, errors.Join(err, fmt.Errorf("failed to record fixture: %w", writeErr))
+	}
+	return items, stats, err
+}
+
+// replayQuery runs the query through the engine from its fixture, without an account, and returns the items it produced, like executeQuery.
+// Request charges aren't recorded, so they're reported as zero.
+func replayQuery(query QuerySpec, fixture *Fixture) ([]interface{}, QueryStats, error) {
+	queryEngine := &stageRecordingEngine{QueryEngine: azcosmoscx.NewQueryEngine()}
+	newPager := func(continuation *string) *runtime.Pager[azcosmos.QueryItemsResponse] {
+		return fixture.newPager(queryEngine)
+	}
+	return readQuery(query, newPager, false, queryEngine)
+}
+
+// fixtureRecorder wraps a query engine to record a fixture of the first pipeline it creates, even if creating it fails.
+type fixtureRecorder struct {
+	queryengine.QueryEngine
+	fixture *Fixture
+}
+
+func (r *fixtureRecorder) CreateQueryPipeline(query string, plan string, pkranges string) (queryengine.QueryPipeline, error) {
+	pipeline, err := r.QueryEngine.CreateQueryPipeline(query, plan, pkranges)
+	if r.fixture != nil {
+		return pipeline, err
+	}
+	r.fixture = &Fixture{
+		Version:            FixtureVersion,
+		Query:              query,
+		Plan:               json.RawMessage(plan),
+		PartitionKeyRanges: json.RawMessage(pkranges),
+		Responses:          []FixtureResponse{},
+	}
+	if err != nil {
+		return pipeline, err
+	}
+	return &recordingPipeline{QueryPipeline: pipeline, fixture: r.fixture}, nil
+}
+
+// requestKey identifies a request among those of a turn of the pipeline. Request IDs are only unique within a partition key range.
+type requestKey struct {
+	partitionKeyRangeID string
+	id                  uint64
+}
+
+// recordingPipeline records the response to each request the pipeline makes in a fixture.
+type recordingPipeline struct {
+	queryengine.QueryPipeline
+	fixture *Fixture
+
+	// requests are the requests of the latest turn, and responses are the indices of the fixture's responses to those of them that have been answered.
+	requests  map[requestKey]queryengine.QueryRequest
+	responses map[requestKey]int
+}
+
+func (p *recordingPipeline) Run() (*queryengine.PipelineResult, error) {
+	result, err := p.QueryPipeline.Run()
+	if err == nil {
+		p.requests = make(map[requestKey]queryengine.QueryRequest, len(result.Requests))
+		p.responses = make(map[requestKey]int, len(result.Requests))
+		for _, request := range result.Requests {
+			p.requests[requestKey{request.PartitionKeyRangeID, request.Id}] = request
+		}
+	}
+	return result, err
+}
+
+func (p *recordingPipeline) ProvideData(data []queryengine.QueryResult) error {
+	for _, result := range data {
+		key := requestKey{result.PartitionKeyRangeID, result.RequestId}
+		index, ok := p.responses[key]
+		if !ok {
+			request := p.requests[key]
+			p.fixture.Responses = append(p.fixture.Responses, FixtureResponse{
+				PartitionKeyRangeID: result.PartitionKeyRangeID,
+				Continuation:        request.Continuation,
+				Query:               request.Query,
+			})
+			index = len(p.fixture.Responses) - 1
+			p.responses[key] = index
+		}
+		p.fixture.Responses[index].Pages = append(p.fixture.Responses[index].Pages, FixturePage{
+			Continuation: result.NextContinuation,
+			Body:         json.RawMessage(bytes.Clone(result.Data)),
+		})
+	}
+	return p.QueryPipeline.ProvideData(data)
+}
+
+// newPager returns a pager that runs the pipeline the engine creates from the fixture, answering each of its requests with the recorded response.
+// It drives the pipeline as azcosmos does, returning a page for each turn that produces items.
+func (f *Fixture) newPager(engine queryengine.QueryEngine) *runtime.Pager[azcosmos.QueryItemsResponse] {
+	var pipeline queryengine.QueryPipeline
+	used := make([]bool, len(f.Responses))
+	return runtime.NewPager(runtime.PagingHandler[azcosmos.QueryItemsResponse]{
+		More: func(page azcosmos.QueryItemsResponse) bool {
+			if pipeline == nil {
+				return true
+			}
+			if pipeline.IsComplete() {
+				pipeline.Close()
+				return false
+			}
+			return true
+		},
+		Fetcher: func(ctx context.Context, page *azcosmos.QueryItemsResponse) (azcosmos.QueryItemsResponse, error) {
+			if pipeline == nil {
+				var err error
+				pipeline, err = engine.CreateQueryPipeline(f.Query, string(f.Plan), string(f.PartitionKeyRanges))
+				if err != nil {
+					return azcosmos.QueryItemsResponse{}, err
+				}
+			}
+			for !pipeline.IsComplete() {
+				result, err := pipeline.Run()
+				if err != nil {
+					pipeline.Close()
+					return azcosmos.QueryItemsResponse{}, err
+				}
+				if len(result.Items) > 0 {
+					return azcosmos.QueryItemsResponse{Items: result.Items}, nil
+				}
+				if len(result.Requests) == 0 && !result.IsCompleted {
+					pipeline.Close()
+					return azcosmos.QueryItemsResponse{}, fmt.Errorf("the pipeline returned no items or requests, but isn't complete")
+				}
+				for _, request := range result.Requests {
+					response, err := f.response(request, used)
+					if err != nil {
+						pipeline.Close()
+						return azcosmos.QueryItemsResponse{}, err
+					}
+					// Each page of a response is the response to a request of its own, resumed from the previous page's continuation.
+					continuation := request.Continuation
+					for _, responsePage := range response.Pages {
+						recordPartitionRequest(ctx, PartitionRequest{PartitionKeyRangeID: request.PartitionKeyRangeID, Continuation: continuation})
+						continuation = responsePage.Continuation
+						err := pipeline.ProvideData([]queryengine.QueryResult{{
+							PartitionKeyRangeID: request.PartitionKeyRangeID,
+							RequestId:           request.Id,
+							NextContinuation:    responsePage.Continuation,
+							Data:                responsePage.Body,
+						}})
+						if err != nil {
+							pipeline.Close()
+							return azcosmos.QueryItemsResponse{}, err
+						}
+					}
+				}
+			}
+			pipeline.Close()
+			return azcosmos.QueryItemsResponse{}, nil
+		},
+	})
+}
+
+// response returns the first unused response to a request in the fixture, and marks it used.
+func (f *Fixture) response(request queryengine.QueryRequest, used []bool) (*FixtureResponse, error) {
+	for i := range f.Responses {
+		response := &f.Responses[i]
+		if !used[i] && response.PartitionKeyRangeID == request.PartitionKeyRangeID && response.Continuation == request.Continuation && response.Query == request.Query {
+			used[i] = true
+			return response, nil
+		}
+	}
+	return nil, fmt.Errorf("the fixture has no response to the request to partition key range %s with continuation %q; record it again with %s=%s",
+		request.PartitionKeyRangeID, request.Continuation, FixturesEnvVar, FixturesRecord)
+}
+
+// orderByFixtureQuery is the query of the hand-written fixture in testdata/order_by.fixture.json,
+// which orders six items from three partition key ranges, two of which return a second page.
+var orderByFixtureQuery = QuerySpec{Name: "order_by", Text: "SELECT * FROM c ORDER BY c.value"}
+
+func TestParseFixturesMode(t *testing.T) {
+	for _, value := range []string{"", FixturesRecord, FixturesReplay} {
+		mode, err := parseFixturesMode(value)
+		require.NoError(t, err)
+		assert.Equal(t, value, mode)
+	}
+	_, err := parseFixturesMode("capture")
+	assert.ErrorContains(t, err, FixturesEnvVar)
+}
+
+func TestFixturePath(t *testing.T) {
+	t.Setenv(FixturesDirEnvVar, "")
+	assert.Equal(t, path.Join("..", "..", "baselines", "fixtures", "order_by", "streaming_1.fixture.json"), fixturePath("order_by.json", "streaming_1"))
+	t.Setenv(FixturesDirEnvVar, "/tmp/fixtures")
+	assert.Equal(t, "/tmp/fixtures/order_by/streaming_1.fixture.json", fixturePath("order_by.json", "streaming_1"))
+}
+
+func TestReplayFixture(t *testing.T) {
+	fixture, err := loadFixture(path.Join("testdata", "order_by.fixture.json"), orderByFixtureQuery)
+	require.NoError(t, err)
+
+	items, stats, err := replayQuery(orderByFixtureQuery, fixture)
+	require.NoError(t, err)
+	ids := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.(map[string]interface{})["id"])
+	}
+	assert.Equal(t, []interface{}{"a", "b", "c", "d", "e", "f"}, ids)
+	assert.Equal(t, []int{2, 4}, stats.PageSizes)
+	assert.Zero(t, stats.TotalRU)
+}
+
+func TestReplayFixtureRecordsTheSameFixture(t *testing.T) {
+	fixture, err := loadFixture(path.Join("testdata", "order_by.fixture.json"), orderByFixtureQuery)
+	require.NoError(t, err)
+
+	// Replaying through a recorder answers the same requests, so it records the same responses.
+	recorder := &fixtureRecorder{QueryEngine: azcosmoscx.NewQueryEngine()}
+	_, err = readPages(context.Background(), func(*string) *runtime.Pager[azcosmos.QueryItemsResponse] { return fixture.newPager(recorder) }, false, nil)
+	require.NoError(t, err)
+	require.NotNil(t, recorder.fixture)
+
+	expected, err := json.Marshal(fixture)
+	require.NoError(t, err)
+	actual, err := json.Marshal(recorder.fixture)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(actual))
+}
+
+func TestReplayFixtureWithoutAResponse(t *testing.T) {
+	fixture, err := loadFixture(path.Join("testdata", "order_by.fixture.json"), orderByFixtureQuery)
+	require.NoError(t, err)
+	fixture.Responses = fixture.Responses[:len(fixture.Responses)-1]
+
+	_, _, err = replayQuery(orderByFixtureQuery, fixture)
+	var queryErr *QueryError
+	require.ErrorAs(t, err, &queryErr)
+	assert.Equal(t, ErrorStagePage, queryErr.Stage)
+	assert.ErrorContains(t, err, `the fixture has no response to the request to partition key range partition1 with continuation "1"`)
+}
+
+func TestReplayFixtureWithAnInvalidPlan(t *testing.T) {
+	fixture, err := loadFixture(path.Join("testdata", "order_by.fixture.json"), orderByFixtureQuery)
+	require.NoError(t, err)
+	fixture.Plan = json.RawMessage(`{}`)
+
+	_, _, err = replayQuery(orderByFixtureQuery, fixture)
+	var queryErr *QueryError
+	require.ErrorAs(t, err, &queryErr)
+	assert.Equal(t, ErrorStagePipelineCreation, queryErr.Stage)
+}
+
+func TestLoadFixture(t *testing.T) {
+	dir := t.TempDir()
+	write := func(fixture Fixture) string {
+		fixturePath := path.Join(dir, "order_by", "q.fixture.json")
+		require.NoError(t, fixture.write(fixturePath))
+		return fixturePath
+	}
+	fixture := Fixture{Version: FixtureVersion, Query: "SELECT * FROM c", MaxItemCount: 2, Plan: json.RawMessage(`{}`), PartitionKeyRanges: json.RawMessage(`{}`)}
+	query := QuerySpec{Name: "q", Text: "SELECT * FROM c", MaxItemCount: 2}
+
+	loaded, err := loadFixture(write(fixture), query)
+	require.NoError(t, err)
+	assert.Equal(t, fixture.Query, loaded.Query)
+
+	_, err = loadFixture(path.Join(dir, "missing.fixture.json"), query)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	newer := fixture
+	newer.Version = FixtureVersion + 1
+	_, err = loadFixture(write(newer), query)
+	assert.ErrorContains(t, err, fmt.Sprintf("has version %d, but version %d is expected", FixtureVersion+1, FixtureVersion))
+
+	_, err = loadFixture(write(fixture), QuerySpec{Name: "q", Text: "SELECT * FROM c WHERE c.x", MaxItemCount: 2})
+	assert.ErrorContains(t, err, "recorded for a different text or maxItemCount than query q has")
+	_, err = loadFixture(write(fixture), QuerySpec{Name: "q", Text: "SELECT * FROM c"})
+	assert.ErrorContains(t, err, "recorded for a different text or maxItemCount than query q has")
+}
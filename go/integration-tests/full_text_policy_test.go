@@ -0,0 +1,116 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+)
+
+// fullTextSearchUnsupported is the hint added to errors creating containers with full-text policies.
+const fullTextSearchUnsupported = "the account or emulator may not support full-text search; enable the NoSQL full-text search capability on the account, or use an emulator that supports it"
+
+// validateFullTextPolicy checks that the container's full-text paths are JSON pointers, and that each full-text index is for one of them.
+func validateFullTextPolicy(container azcosmos.ContainerProperties) error {
+	paths := make(map[string]bool)
+	if container.FullTextPolicy != nil {
+		for _, path := range container.FullTextPolicy.FullTextPaths {
+			if len(path.Path) < 2 || path.Path[0] != '/' {
+				return fmt.Errorf("full-text path '%s' must be a JSON pointer, such as '/text'", path.Path)
+			}
+			paths[path.Path] = true
+		}
+	}
+
+	if container.IndexingPolicy == nil {
+		return nil
+	}
+	for _, index := range container.IndexingPolicy.FullTextIndexes {
+		if !paths[index.Path] {
+			return fmt.Errorf("full-text index '%s' has no matching path in the full-text policy", index.Path)
+		}
+	}
+	return nil
+}
+
+// hasFullTextPolicy reports whether the container has full-text paths or full-text indexes.
+func hasFullTextPolicy(container azcosmos.ContainerProperties) bool {
+	return (container.FullTextPolicy != nil && len(container.FullTextPolicy.FullTextPaths) > 0) ||
+		(container.IndexingPolicy != nil && len(container.IndexingPolicy.FullTextIndexes) > 0)
+}
+
+// checkCreatedFullTextPolicy checks that a container created with a full-text policy kept it, like checkCreatedVectorPolicy.
+func checkCreatedFullTextPolicy(requested azcosmos.ContainerProperties, created *azcosmos.ContainerProperties, createErr error) error {
+	if !hasFullTextPolicy(requested) {
+		return createErr
+	}
+	if createErr != nil {
+		var responseErr *azcore.ResponseError
+		if errors.As(createErr, &responseErr) && responseErr.StatusCode == http.StatusBadRequest {
+			return fmt.Errorf("failed to create container '%s' with a full-text policy (%s): %w", requested.ID, fullTextSearchUnsupported, createErr)
+		}
+		return createErr
+	}
+
+	var paths []azcosmos.FullTextPath
+	if created != nil && created.FullTextPolicy != nil {
+		paths = created.FullTextPolicy.FullTextPaths
+	}
+	if requested.FullTextPolicy != nil && len(paths) != len(requested.FullTextPolicy.FullTextPaths) {
+		return fmt.Errorf("container '%s' was created with %d of its %d full-text paths (%s)", requested.ID, len(paths), len(requested.FullTextPolicy.FullTextPaths), fullTextSearchUnsupported)
+	}
+
+	var indexes []azcosmos.FullTextIndex
+	if created != nil && created.IndexingPolicy != nil {
+		indexes = created.IndexingPolicy.FullTextIndexes
+	}
+	if requested.IndexingPolicy != nil && len(indexes) != len(requested.IndexingPolicy.FullTextIndexes) {
+		return fmt.Errorf("container '%s' was created with %d of its %d full-text indexes (%s)", requested.ID, len(indexes), len(requested.IndexingPolicy.FullTextIndexes), fullTextSearchUnsupported)
+	}
+	return nil
+}
+
+// fullTextContainer returns a container with a single full-text path at /text, with a full-text index.
+func fullTextContainer() azcosmos.ContainerProperties {
+	return azcosmos.ContainerProperties{
+		ID:             "fulltext",
+		FullTextPolicy: &azcosmos.FullTextPolicy{DefaultLanguage: "en-US", FullTextPaths: []azcosmos.FullTextPath{{Path: "/text", Language: "en-US"}}},
+		IndexingPolicy: &azcosmos.IndexingPolicy{FullTextIndexes: []azcosmos.FullTextIndex{{Path: "/text"}}},
+	}
+}
+
+func TestValidateFullTextPolicy(t *testing.T) {
+	assert.NoError(t, validateFullTextPolicy(fullTextContainer()))
+	assert.NoError(t, validateFullTextPolicy(azcosmos.ContainerProperties{ID: "plain"}))
+
+	container := fullTextContainer()
+	container.IndexingPolicy.FullTextIndexes[0].Path = "/title"
+	assert.EqualError(t, validateFullTextPolicy(container), "full-text index '/title' has no matching path in the full-text policy")
+
+	container = fullTextContainer()
+	container.FullTextPolicy.FullTextPaths[0].Path = "text"
+	assert.EqualError(t, validateFullTextPolicy(container), "full-text path 'text' must be a JSON pointer, such as '/text'")
+}
+
+func TestCheckCreatedFullTextPolicy(t *testing.T) {
+	requested := fullTextContainer()
+	assert.NoError(t, checkCreatedFullTextPolicy(requested, &requested, nil))
+
+	created := azcosmos.ContainerProperties{ID: requested.ID, IndexingPolicy: &azcosmos.IndexingPolicy{}}
+	assert.ErrorContains(t, checkCreatedFullTextPolicy(requested, &created, nil), "container 'fulltext' was created with 0 of its 1 full-text paths")
+	created.FullTextPolicy = requested.FullTextPolicy
+	assert.ErrorContains(t, checkCreatedFullTextPolicy(requested, &created, nil), "container 'fulltext' was created with 0 of its 1 full-text indexes")
+
+	badRequest := &azcore.ResponseError{StatusCode: http.StatusBadRequest}
+	err := checkCreatedFullTextPolicy(requested, nil, badRequest)
+	assert.ErrorIs(t, err, badRequest)
+	assert.ErrorContains(t, err, "failed to create container 'fulltext' with a full-text policy")
+	assert.Equal(t, badRequest, checkCreatedFullTextPolicy(azcosmos.ContainerProperties{ID: "plain"}, nil, badRequest))
+}
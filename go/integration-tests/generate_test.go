@@ -0,0 +1,381 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// GenerateSpec describes items generated when test data is loaded, for scenarios that need more items than can be reviewed in a JSON file.
+// The items are the same on every run, so their queries can have baselines, although those are best kept to aggregates, such as counts and sums,
+// or left to the comparison with the gateway (see CompareEnvVar and QuerySpec.CompareOnly).
+type GenerateSpec struct {
+	// Count is the number of items to generate.
+	Count int `json:"count"`
+
+	// Seed seeds the random generators.
+	Seed uint64 `json:"seed"`
+
+	// ID is the template of the items' IDs, such as "item-{n}" (see expandTemplate).
+	ID string `json:"id"`
+
+	// Container, if set, is the container the items are inserted into, when the test data's items are per container.
+	// Otherwise, they're inserted into every container.
+	Container string `json:"container"`
+
+	// Fields are the generators of the items' other properties, by property name.
+	Fields map[string]FieldGenerator `json:"fields"`
+}
+
+// The kinds of field generators.
+const GeneratorSequence = "sequence"
+const GeneratorRandomFloat = "randomFloat"
+const GeneratorChoice = "choice"
+const GeneratorTemplate = "template"
+
+// FieldGenerator generates a property of each generated item.
+type FieldGenerator struct {
+	// Kind is the kind of generator: GeneratorSequence, GeneratorRandomFloat, GeneratorChoice, or GeneratorTemplate.
+	Kind string `json:"kind"`
+
+	// Start and Step define a GeneratorSequence, which gives item n the integer Start + n*Step. Step defaults to 1.
+	Start int64  `json:"start"`
+	Step  *int64 `json:"step"`
+
+	// Min and Max bound a GeneratorRandomFloat, which gives each item a random number in [Min, Max), rounded to Decimals decimal places if set.
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Decimals *int    `json:"decimals"`
+
+	// Choices are the values a GeneratorChoice picks from at random.
+	Choices []interface{} `json:"choices"`
+
+	// Template is the string a GeneratorTemplate gives each item (see expandTemplate).
+	Template string `json:"template"`
+}
+
+// templatePlaceholder matches the placeholders of a template: "{n}" for the item's index, from 0, or "{<field>}" for the value of another field, which can't be a template.
+var templatePlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// expandTemplate replaces the placeholders of a template with the item's index and field values.
+func expandTemplate(template string, n int, fields map[string]interface{}) string {
+	return templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if name == "n" {
+			return fmt.Sprint(n)
+		}
+		return fmt.Sprint(fields[name])
+	})
+}
+
+// validateTemplate checks that the placeholders of a template refer to the item's index or to fields that aren't templates.
+func validateTemplate(template string, fields map[string]FieldGenerator) error {
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(template, -1) {
+		name := match[1]
+		if name == "n" {
+			continue
+		}
+		field, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("template '%s' refers to unknown field '%s'", template, name)
+		}
+		if field.Kind == GeneratorTemplate {
+			return fmt.Errorf("template '%s' refers to field '%s', which is itself a template", template, name)
+		}
+	}
+	return nil
+}
+
+// validate checks that the spec is complete, and that its generators are valid.
+func (spec *GenerateSpec) validate() error {
+	if spec.Count <= 0 {
+		return fmt.Errorf("count must be positive, but was %d", spec.Count)
+	}
+	if spec.ID == "" {
+		return fmt.Errorf("id is required, such as \"item-{n}\"")
+	}
+	if err := validateTemplate(spec.ID, spec.Fields); err != nil {
+		return fmt.Errorf("id: %w", err)
+	}
+	for name, field := range spec.Fields {
+		if name == "id" || name == "n" {
+			return fmt.Errorf("field '%s' is reserved", name)
+		}
+		var err error
+		switch field.Kind {
+		case GeneratorSequence:
+			if field.Step != nil && *field.Step == 0 {
+				err = fmt.Errorf("step must not be 0")
+			}
+		case GeneratorRandomFloat:
+			if !(field.Min < field.Max) {
+				err = fmt.Errorf("min (%v) must be less than max (%v)", field.Min, field.Max)
+			} else if field.Decimals != nil && *field.Decimals < 0 {
+				err = fmt.Errorf("decimals must not be negative, but was %d", *field.Decimals)
+			}
+		case GeneratorChoice:
+			if len(field.Choices) == 0 {
+				err = fmt.Errorf("choices must not be empty")
+			}
+		case GeneratorTemplate:
+			err = validateTemplate(field.Template, spec.Fields)
+		default:
+			err = fmt.Errorf("unknown kind '%s'", field.Kind)
+		}
+		if err != nil {
+			return fmt.Errorf("field '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// fieldRand returns the random generator of a field, seeded from the spec's seed and the field's name,
+// so that adding or removing a field doesn't change the values of the others.
+func fieldRand(seed uint64, name string) *rand.Rand {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return rand.New(rand.NewPCG(seed, hash.Sum64()))
+}
+
+// items generates the spec's items.
+func (spec *GenerateSpec) items() ([]json.RawMessage, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+
+	// Generate the fields in a fixed order, templates last, since they refer to other fields.
+	names := make([]string, 0, len(spec.Fields))
+	for name := range spec.Fields {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		iTemplate, jTemplate := spec.Fields[names[i]].Kind == GeneratorTemplate, spec.Fields[names[j]].Kind == GeneratorTemplate
+		if iTemplate != jTemplate {
+			return jTemplate
+		}
+		return names[i] < names[j]
+	})
+	rands := make(map[string]*rand.Rand, len(names))
+	for _, name := range names {
+		rands[name] = fieldRand(spec.Seed, name)
+	}
+
+	items := make([]json.RawMessage, 0, spec.Count)
+	for n := 0; n < spec.Count; n++ {
+		item := make(map[string]interface{}, len(names)+1)
+		for _, name := range names {
+			field := spec.Fields[name]
+			switch field.Kind {
+			case GeneratorSequence:
+				step := int64(1)
+				if field.Step != nil {
+					step = *field.Step
+				}
+				item[name] = field.Start + int64(n)*step
+			case GeneratorRandomFloat:
+				value := field.Min + rands[name].Float64()*(field.Max-field.Min)
+				if field.Decimals != nil {
+					scale := math.Pow10(*field.Decimals)
+					value = math.Round(value*scale) / scale
+				}
+				item[name] = value
+			case GeneratorChoice:
+				item[name] = field.Choices[rands[name].IntN(len(field.Choices))]
+			case GeneratorTemplate:
+				item[name] = expandTemplate(field.Template, n, item)
+			}
+		}
+		item["id"] = expandTemplate(spec.ID, n, item)
+
+		// Maps are marshaled with sorted keys, so the items are the same on every run.
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, data)
+	}
+	return items, nil
+}
+
+// expandGenerated adds the items described by the test data's generate spec, if any, to its items.
+func (d *TestData) expandGenerated() error {
+	if d.Generate == nil {
+		return nil
+	}
+	items, err := d.Generate.items()
+	if err != nil {
+		return fmt.Errorf("invalid generate spec: %w", err)
+	}
+
+	if d.Generate.Container == "" {
+		if d.Data.PerContainer != nil {
+			return fmt.Errorf("invalid generate spec: the test data's items are per container, so it must set the container to generate items for")
+		}
+		d.Data.AllContainers = append(d.Data.AllContainers, items...)
+		return nil
+	}
+
+	if d.Data.AllContainers != nil {
+		return fmt.Errorf("invalid generate spec: the test data's items are inserted into every container, so it can't set a container")
+	}
+	found := false
+	for _, container := range d.Containers {
+		found = found || container.ID == d.Generate.Container
+	}
+	if !found {
+		return fmt.Errorf("invalid generate spec: container '%s' is not defined in the test data", d.Generate.Container)
+	}
+	if d.Data.PerContainer == nil {
+		d.Data.PerContainer = make(map[string][]json.RawMessage)
+	}
+	d.Data.PerContainer[d.Generate.Container] = append(d.Data.PerContainer[d.Generate.Container], items...)
+	return nil
+}
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func testGenerateSpec() *GenerateSpec {
+	return &GenerateSpec{
+		Count: 4,
+		Seed:  42,
+		ID:    "item-{n}",
+		Fields: map[string]FieldGenerator{
+			"seq":      {Kind: GeneratorSequence, Start: 10, Step: int64Ptr(5)},
+			"score":    {Kind: GeneratorRandomFloat, Min: 0, Max: 1, Decimals: intPtr(3)},
+			"category": {Kind: GeneratorChoice, Choices: []interface{}{"red", "green", "blue"}},
+			"label":    {Kind: GeneratorTemplate, Template: "{category}-{seq}"},
+		},
+	}
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	first, err := testGenerateSpec().items()
+	require.NoError(t, err)
+	second, err := testGenerateSpec().items()
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	// The items must also be the same across runs and platforms, so that baselines stay valid.
+	expected := []string{
+		`{"category":"red","id":"item-0","label":"red-10","score":0.208,"seq":10}`,
+		`{"category":"blue","id":"item-1","label":"blue-15","score":0.954,"seq":15}`,
+		`{"category":"blue","id":"item-2","label":"blue-20","score":0.838,"seq":20}`,
+		`{"category":"green","id":"item-3","label":"green-25","score":0.983,"seq":25}`,
+	}
+	require.Len(t, first, len(expected))
+	for i, item := range first {
+		assert.JSONEq(t, expected[i], string(item), "item %d", i)
+	}
+}
+
+func TestGenerateFieldsAreIndependent(t *testing.T) {
+	spec := testGenerateSpec()
+	before, err := spec.items()
+	require.NoError(t, err)
+
+	spec.Fields["extra"] = FieldGenerator{Kind: GeneratorRandomFloat, Min: -1, Max: 1}
+	after, err := spec.items()
+	require.NoError(t, err)
+	for i := range before {
+		var beforeItem, afterItem map[string]interface{}
+		require.NoError(t, json.Unmarshal(before[i], &beforeItem))
+		require.NoError(t, json.Unmarshal(after[i], &afterItem))
+		delete(afterItem, "extra")
+		assert.Equal(t, beforeItem, afterItem, "item %d", i)
+	}
+}
+
+func TestGenerateSeedChangesItems(t *testing.T) {
+	spec := testGenerateSpec()
+	first, err := spec.items()
+	require.NoError(t, err)
+	spec.Seed = 43
+	second, err := spec.items()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestGenerateSpecValidation(t *testing.T) {
+	cases := map[string]func(spec *GenerateSpec){
+		"count must be positive":  func(spec *GenerateSpec) { spec.Count = 0 },
+		"id is required":          func(spec *GenerateSpec) { spec.ID = "" },
+		"unknown field 'missing'": func(spec *GenerateSpec) { spec.ID = "item-{missing}" },
+		"unknown kind 'uuid'":     func(spec *GenerateSpec) { spec.Fields["other"] = FieldGenerator{Kind: "uuid"} },
+		"step must not be 0": func(spec *GenerateSpec) {
+			spec.Fields["seq"] = FieldGenerator{Kind: GeneratorSequence, Step: int64Ptr(0)}
+		},
+		"must be less than max": func(spec *GenerateSpec) {
+			spec.Fields["score"] = FieldGenerator{Kind: GeneratorRandomFloat, Min: 1, Max: 1}
+		},
+		"choices must not be empty":  func(spec *GenerateSpec) { spec.Fields["category"] = FieldGenerator{Kind: GeneratorChoice} },
+		"which is itself a template": func(spec *GenerateSpec) { spec.ID = "item-{label}" },
+		"field 'id' is reserved":     func(spec *GenerateSpec) { spec.Fields["id"] = FieldGenerator{Kind: GeneratorSequence} },
+		"decimals must not be negative": func(spec *GenerateSpec) {
+			spec.Fields["score"] = FieldGenerator{Kind: GeneratorRandomFloat, Max: 1, Decimals: intPtr(-1)}
+		},
+	}
+	for message, mutate := range cases {
+		spec := testGenerateSpec()
+		mutate(spec)
+		_, err := spec.items()
+		assert.ErrorContains(t, err, message)
+	}
+}
+
+func TestExpandGenerated(t *testing.T) {
+	var testData TestData
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"containers": [{"id": "Generated"}],
+		"data": [{"id": "fixed"}],
+		"generate": {"count": 3, "id": "gen-{n}", "fields": {"seq": {"kind": "sequence"}}}
+	}`), &testData))
+	require.NoError(t, testData.expandGenerated())
+	items := testData.Data.ItemsFor("Generated")
+	require.Len(t, items, 4)
+	assert.JSONEq(t, `{"id": "fixed"}`, string(items[0]))
+	assert.JSONEq(t, `{"id": "gen-2", "seq": 2}`, string(items[3]))
+
+	// Items can be generated for one container, when items are per container.
+	testData = TestData{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"containers": [{"id": "Generated"}, {"id": "Other"}],
+		"data": {"Other": [{"id": "fixed"}]},
+		"generate": {"count": 2, "id": "gen-{n}", "container": "Generated"}
+	}`), &testData))
+	require.NoError(t, testData.expandGenerated())
+	assert.Len(t, testData.Data.ItemsFor("Generated"), 2)
+	assert.Len(t, testData.Data.ItemsFor("Other"), 1)
+
+	testData = TestData{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"containers": [{"id": "Generated"}],
+		"data": {},
+		"generate": {"count": 2, "id": "gen-{n}", "container": "Missing"}
+	}`), &testData))
+	assert.ErrorContains(t, testData.expandGenerated(), "container 'Missing' is not defined")
+
+	testData = TestData{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"containers": [{"id": "Generated"}],
+		"data": {},
+		"generate": {"count": 2, "id": "gen-{n}"}
+	}`), &testData))
+	assert.ErrorContains(t, testData.expandGenerated(), "must set the container")
+}
@@ -0,0 +1,162 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validateGroupBy checks that a query sets its grouping keys if and only if its results are matched by group.
+func (query *QuerySpec) validateGroupBy() error {
+	if query.ResultOrder == ResultOrderGroupBy && len(query.GroupBy) == 0 {
+		return fmt.Errorf("resultOrder '%s' requires groupBy, the properties that identify each group", ResultOrderGroupBy)
+	}
+	if query.ResultOrder != ResultOrderGroupBy && len(query.GroupBy) > 0 {
+		return fmt.Errorf("groupBy requires resultOrder '%s'", ResultOrderGroupBy)
+	}
+	for _, key := range query.GroupBy {
+		if key == "" {
+			return fmt.Errorf("groupBy must not contain an empty property")
+		}
+	}
+	return nil
+}
+
+// matchGroups matches the expected and actual rows of a GROUP BY query by the values of their grouping keys, since groups can be returned in any order.
+// It returns the matched rows, in the expected order, so that their aggregates can be validated like ordered items,
+// and a validation error for each group that's missing from the actual results, returned more than once, or not expected.
+func matchGroups(expected, actual []interface{}, keys []string) ([]interface{}, []interface{}, []ValidationError) {
+	var errors []ValidationError
+	actualByGroup := make(map[string]int, len(actual))
+	for i, row := range actual {
+		group, err := groupKey(row, keys)
+		if err != nil {
+			errors = append(errors, ValidationError{Item: i, Property: "<group>", Message: fmt.Sprintf("invalid actual row: %v", err), Actual: row})
+			continue
+		}
+		if _, ok := actualByGroup[group]; ok {
+			errors = append(errors, ValidationError{Item: i, Property: "<group>", Message: fmt.Sprintf("group %s was returned more than once", group), Actual: row})
+			continue
+		}
+		actualByGroup[group] = i
+	}
+
+	matchedExpected := make([]interface{}, 0, len(expected))
+	matchedActual := make([]interface{}, 0, len(expected))
+	seen := make(map[string]bool, len(expected))
+	for i, row := range expected {
+		group, err := groupKey(row, keys)
+		if err != nil {
+			errors = append(errors, ValidationError{Item: i, Property: "<group>", Message: fmt.Sprintf("invalid expected row: %v", err), Expected: row})
+			continue
+		}
+		if seen[group] {
+			errors = append(errors, ValidationError{Item: i, Property: "<group>", Message: fmt.Sprintf("group %s is expected more than once", group), Expected: row})
+			continue
+		}
+		seen[group] = true
+		index, ok := actualByGroup[group]
+		if !ok {
+			errors = append(errors, ValidationError{Item: i, Property: "<group>", Message: fmt.Sprintf("expected group %s not found in actual results", group), Expected: row})
+			continue
+		}
+		matchedExpected = append(matchedExpected, row)
+		matchedActual = append(matchedActual, actual[index])
+	}
+	for i, row := range actual {
+		group, err := groupKey(row, keys)
+		if err == nil && !seen[group] && actualByGroup[group] == i {
+			errors = append(errors, ValidationError{Item: i, Property: "<group>", Message: fmt.Sprintf("actual group %s not found in expected results", group), Actual: row})
+		}
+	}
+	return matchedExpected, matchedActual, errors
+}
+
+// groupKey describes the group of a row by the values of its grouping keys, such as "(categoryId=\"a\", year=2020)".
+// A missing key is a group of its own, since GROUP BY groups items that lack the property together.
+func groupKey(row interface{}, keys []string) (string, error) {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value, found, err := lookupProperty(row, key)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			parts = append(parts, key+" missing")
+			continue
+		}
+		// encoding/json sorts the keys of maps, so equal values have the same encoding.
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("property '%s' can't be encoded: %w", key, err)
+		}
+		parts = append(parts, key+"="+string(encoded))
+	}
+	return "(" + strings.Join(parts, ", ") + ")", nil
+}
+
+func TestValidateGroupBy(t *testing.T) {
+	assert.NoError(t, (&QuerySpec{ResultOrder: ResultOrderGroupBy, GroupBy: []string{"categoryId"}}).validateGroupBy())
+	assert.NoError(t, (&QuerySpec{}).validateGroupBy())
+	assert.ErrorContains(t, (&QuerySpec{ResultOrder: ResultOrderGroupBy}).validateGroupBy(), "requires groupBy")
+	assert.ErrorContains(t, (&QuerySpec{GroupBy: []string{"categoryId"}}).validateGroupBy(), "requires resultOrder")
+	assert.ErrorContains(t, (&QuerySpec{ResultOrder: ResultOrderGroupBy, GroupBy: []string{""}}).validateGroupBy(), "empty property")
+}
+
+func TestMatchGroupsIgnoresOrder(t *testing.T) {
+	expected := []interface{}{
+		map[string]interface{}{"category": "a", "year": 2020.0, "total": 1.5},
+		map[string]interface{}{"category": "a", "year": 2021.0, "total": 2.5},
+		map[string]interface{}{"category": "b", "year": 2020.0, "total": 3.5},
+	}
+	actual := []interface{}{
+		map[string]interface{}{"category": "b", "year": 2020.0, "total": 3.5000001},
+		map[string]interface{}{"category": "a", "year": 2021.0, "total": 2.5},
+		map[string]interface{}{"category": "a", "year": 2020.0, "total": 1.5},
+	}
+	matchedExpected, matchedActual, errors := matchGroups(expected, actual, []string{"category", "year"})
+	require.Empty(t, errors)
+	assert.Equal(t, expected, matchedExpected)
+	assert.Equal(t, []interface{}{actual[2], actual[1], actual[0]}, matchedActual)
+}
+
+func TestMatchGroupsReportsGroupsByKey(t *testing.T) {
+	expected := []interface{}{
+		map[string]interface{}{"category": "a", "count": 1.0},
+		map[string]interface{}{"category": "b", "count": 2.0},
+		map[string]interface{}{"count": 3.0},
+	}
+	actual := []interface{}{
+		map[string]interface{}{"category": "a", "count": 1.0},
+		map[string]interface{}{"category": "c", "count": 2.0},
+		map[string]interface{}{"category": "a", "count": 1.0},
+		map[string]interface{}{"count": 3.0},
+	}
+	matchedExpected, matchedActual, errors := matchGroups(expected, actual, []string{"category"})
+	assert.Len(t, matchedExpected, 2)
+	assert.Len(t, matchedActual, 2)
+
+	messages := make([]string, 0, len(errors))
+	for _, err := range errors {
+		messages = append(messages, err.Message)
+	}
+	assert.ElementsMatch(t, []string{
+		`group (category="a") was returned more than once`,
+		`expected group (category="b") not found in actual results`,
+		`actual group (category="c") not found in expected results`,
+	}, messages)
+}
+
+func TestMatchGroupsRejectsRowsThatAreNotObjects(t *testing.T) {
+	_, _, errors := matchGroups([]interface{}{1.0}, []interface{}{map[string]interface{}{"category": "a"}}, []string{"category"})
+	require.Len(t, errors, 2)
+	assert.Contains(t, errors[0].Message, "invalid expected row")
+	assert.Contains(t, errors[1].Message, `actual group (category="a") not found`)
+}
@@ -0,0 +1,199 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// applyIndexingPolicyDefaults enables automatic indexing in the indexing policies of the test data's containers that don't set "automatic",
+// which is the default of the service and of the .NET SDK that generates the baselines, but not of azcosmos.IndexingPolicy. data is the raw test data file.
+func applyIndexingPolicyDefaults(data []byte, testData *TestData) error {
+	var raw struct {
+		Containers []struct {
+			IndexingPolicy *struct {
+				Automatic *bool `json:"automatic"`
+			} `json:"indexingPolicy"`
+		} `json:"containers"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for i, container := range raw.Containers {
+		if i < len(testData.Containers) && container.IndexingPolicy != nil && container.IndexingPolicy.Automatic == nil && testData.Containers[i].IndexingPolicy != nil {
+			testData.Containers[i].IndexingPolicy.Automatic = true
+		}
+	}
+	return nil
+}
+
+// validateIndexingPolicy checks that the container's included, excluded, and composite index paths are JSON pointers,
+// and that each composite index has at least two paths with a known order.
+func validateIndexingPolicy(container azcosmos.ContainerProperties) error {
+	if container.IndexingPolicy == nil {
+		return nil
+	}
+	for _, path := range container.IndexingPolicy.IncludedPaths {
+		if !strings.HasPrefix(path.Path, "/") {
+			return fmt.Errorf("included path '%s' must start with '/', such as '/*'", path.Path)
+		}
+	}
+	for _, path := range container.IndexingPolicy.ExcludedPaths {
+		if !strings.HasPrefix(path.Path, "/") {
+			return fmt.Errorf("excluded path '%s' must start with '/', such as '/\"_etag\"/?'", path.Path)
+		}
+	}
+	for _, index := range container.IndexingPolicy.CompositeIndexes {
+		if len(index) < 2 {
+			return fmt.Errorf("composite index (%s) must have at least two paths", compositeIndexString(index))
+		}
+		for _, path := range index {
+			if len(path.Path) < 2 || path.Path[0] != '/' {
+				return fmt.Errorf("composite index path '%s' must be a JSON pointer, such as '/name'", path.Path)
+			}
+			switch path.Order {
+			case "", azcosmos.CompositeIndexAscending, azcosmos.CompositeIndexDescending:
+			default:
+				return fmt.Errorf("composite index path '%s' has unknown order '%s'", path.Path, path.Order)
+			}
+		}
+	}
+	return nil
+}
+
+// checkCreatedIndexingPolicy checks that a container, read back after it was created, kept the included and excluded paths and the composite indexes it was created with.
+// The service adds paths and indexes of its own, so only missing ones are reported. Without its composite indexes, ORDER BY queries on several properties fail with a bad request.
+func checkCreatedIndexingPolicy(requested azcosmos.ContainerProperties, created *azcosmos.ContainerProperties) error {
+	if requested.IndexingPolicy == nil {
+		return nil
+	}
+	if created == nil || created.IndexingPolicy == nil {
+		return fmt.Errorf("container '%s' was read back without its indexing policy", requested.ID)
+	}
+
+	included := make(map[string]bool, len(created.IndexingPolicy.IncludedPaths))
+	for _, path := range created.IndexingPolicy.IncludedPaths {
+		included[path.Path] = true
+	}
+	for _, path := range requested.IndexingPolicy.IncludedPaths {
+		if !included[path.Path] {
+			return fmt.Errorf("container '%s' was created without its included path '%s'", requested.ID, path.Path)
+		}
+	}
+
+	excluded := make(map[string]bool, len(created.IndexingPolicy.ExcludedPaths))
+	for _, path := range created.IndexingPolicy.ExcludedPaths {
+		excluded[path.Path] = true
+	}
+	for _, path := range requested.IndexingPolicy.ExcludedPaths {
+		if !excluded[path.Path] {
+			return fmt.Errorf("container '%s' was created without its excluded path '%s'", requested.ID, path.Path)
+		}
+	}
+
+	composites := make(map[string]bool, len(created.IndexingPolicy.CompositeIndexes))
+	for _, index := range created.IndexingPolicy.CompositeIndexes {
+		composites[compositeIndexString(index)] = true
+	}
+	for _, index := range requested.IndexingPolicy.CompositeIndexes {
+		if !composites[compositeIndexString(index)] {
+			return fmt.Errorf("container '%s' was created without its composite index (%s), which ORDER BY queries on those paths need", requested.ID, compositeIndexString(index))
+		}
+	}
+	return nil
+}
+
+// compositeIndexString describes a composite index by its paths and their orders, such as "/category ascending, /price descending".
+// A path without an order is ascending, which is the service's default.
+func compositeIndexString(index []azcosmos.CompositeIndex) string {
+	paths := make([]string, 0, len(index))
+	for _, path := range index {
+		order := path.Order
+		if order == "" {
+			order = azcosmos.CompositeIndexAscending
+		}
+		paths = append(paths, fmt.Sprintf("%s %s", path.Path, order))
+	}
+	return strings.Join(paths, ", ")
+}
+
+// compositeIndexContainer returns a container with a composite index on /category, ascending, and /price, descending.
+func compositeIndexContainer() azcosmos.ContainerProperties {
+	return azcosmos.ContainerProperties{
+		ID: "composite",
+		IndexingPolicy: &azcosmos.IndexingPolicy{
+			Automatic:     true,
+			IncludedPaths: []azcosmos.IncludedPath{{Path: "/*"}},
+			ExcludedPaths: []azcosmos.ExcludedPath{{Path: "/\"_etag\"/?"}},
+			CompositeIndexes: [][]azcosmos.CompositeIndex{{
+				{Path: "/category", Order: azcosmos.CompositeIndexAscending},
+				{Path: "/price", Order: azcosmos.CompositeIndexDescending},
+			}},
+		},
+	}
+}
+
+func TestApplyIndexingPolicyDefaults(t *testing.T) {
+	data := []byte(`{"containers": [
+		{"id": "unset", "indexingPolicy": {"indexingMode": "consistent"}},
+		{"id": "disabled", "indexingPolicy": {"automatic": false, "indexingMode": "none"}},
+		{"id": "none"}
+	]}`)
+	var testData TestData
+	require.NoError(t, json.Unmarshal(data, &testData))
+	require.NoError(t, applyIndexingPolicyDefaults(data, &testData))
+	assert.True(t, testData.Containers[0].IndexingPolicy.Automatic)
+	assert.False(t, testData.Containers[1].IndexingPolicy.Automatic)
+	assert.Nil(t, testData.Containers[2].IndexingPolicy)
+}
+
+func TestValidateIndexingPolicy(t *testing.T) {
+	assert.NoError(t, validateIndexingPolicy(compositeIndexContainer()))
+	assert.NoError(t, validateIndexingPolicy(azcosmos.ContainerProperties{ID: "plain"}))
+
+	container := compositeIndexContainer()
+	container.IndexingPolicy.CompositeIndexes[0] = container.IndexingPolicy.CompositeIndexes[0][:1]
+	assert.EqualError(t, validateIndexingPolicy(container), "composite index (/category ascending) must have at least two paths")
+
+	container = compositeIndexContainer()
+	container.IndexingPolicy.CompositeIndexes[0][1].Path = "price"
+	assert.EqualError(t, validateIndexingPolicy(container), "composite index path 'price' must be a JSON pointer, such as '/name'")
+
+	container = compositeIndexContainer()
+	container.IndexingPolicy.CompositeIndexes[0][1].Order = "desc"
+	assert.EqualError(t, validateIndexingPolicy(container), "composite index path '/price' has unknown order 'desc'")
+
+	container = compositeIndexContainer()
+	container.IndexingPolicy.IncludedPaths[0].Path = "*"
+	assert.EqualError(t, validateIndexingPolicy(container), "included path '*' must start with '/', such as '/*'")
+}
+
+func TestCheckCreatedIndexingPolicy(t *testing.T) {
+	requested := compositeIndexContainer()
+	assert.NoError(t, checkCreatedIndexingPolicy(requested, &requested))
+	assert.NoError(t, checkCreatedIndexingPolicy(azcosmos.ContainerProperties{ID: "plain"}, nil))
+
+	// The service adds paths of its own, and reports the default order.
+	created := compositeIndexContainer()
+	created.IndexingPolicy.ExcludedPaths = append(created.IndexingPolicy.ExcludedPaths, azcosmos.ExcludedPath{Path: "/_ts/?"})
+	requested.IndexingPolicy.CompositeIndexes[0][0].Order = ""
+	assert.NoError(t, checkCreatedIndexingPolicy(requested, &created))
+
+	created.IndexingPolicy.CompositeIndexes = nil
+	assert.EqualError(t, checkCreatedIndexingPolicy(requested, &created),
+		"container 'composite' was created without its composite index (/category ascending, /price descending), which ORDER BY queries on those paths need")
+
+	created = compositeIndexContainer()
+	created.IndexingPolicy.ExcludedPaths = nil
+	assert.EqualError(t, checkCreatedIndexingPolicy(requested, &created), `container 'composite' was created without its excluded path '/"_etag"/?'`)
+
+	assert.EqualError(t, checkCreatedIndexingPolicy(requested, &azcosmos.ContainerProperties{ID: "composite"}), "container 'composite' was read back without its indexing policy")
+}
@@ -4,31 +4,64 @@
 package integrationtests
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"crypto/rand"
-	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"math"
-	"net/http"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/emulator"
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/seeding"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
-	"github.com/stretchr/testify/assert"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
 	"github.com/stretchr/testify/require"
 	"github.com/wI2L/jsondiff"
 )
 
 type TestData struct {
 	Containers []azcosmos.ContainerProperties `json:"containers"`
-	Data       []json.RawMessage              `json:"data"`
+	Data       TestDataItems                  `json:"data"`
 	Parameters map[string]interface{}         `json:"parameters"`
+
+	// Generate, if set, describes more items to insert, which are generated when the test data is loaded (see GenerateSpec).
+	Generate *GenerateSpec `json:"generate"`
+}
+
+// TestDataItems holds the items of a test data file.
+// In JSON, it's either an array of items, which are inserted into every container, or an object mapping container IDs to the array of items to insert into that container.
+type TestDataItems struct {
+	AllContainers []json.RawMessage
+	PerContainer  map[string][]json.RawMessage
+}
+
+func (d *TestDataItems) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return json.Unmarshal(trimmed, &d.PerContainer)
+	}
+	return json.Unmarshal(trimmed, &d.AllContainers)
+}
+
+// ItemsFor returns the items to insert into the container with the given ID.
+func (d *TestDataItems) ItemsFor(containerID string) []json.RawMessage {
+	if d.PerContainer != nil {
+		return d.PerContainer[containerID]
+	}
+	return d.AllContainers
 }
 
 type QuerySet struct {
@@ -43,6 +76,70 @@ type QuerySpec struct {
 	Container  string                 `json:"container"`
 	Parameters map[string]interface{} `json:"parameters"`
 	Validators map[string]string      `json:"validators"`
+
+	// ResultOrder is ResultOrderUnordered if the query's items can be returned in any order, such as a cross-partition query without ORDER BY,
+	// ResultOrderRanked if items with tied scores, such as in ORDER BY RANK queries, can be returned in any order,
+	// or ResultOrderGroupBy if the query's rows are groups, which can be returned in any order and are matched by their GroupBy properties.
+	// By default, items are compared in order.
+	ResultOrder string `json:"resultOrder"`
+
+	// GroupBy are the properties whose values identify each row, when ResultOrder is ResultOrderGroupBy (see matchGroups).
+	GroupBy []string `json:"groupBy"`
+
+	// RankTolerance is the number of places an item may be from its expected place, when ResultOrder is ResultOrderRanked (see matchRanked).
+	RankTolerance int `json:"rankTolerance"`
+
+	// FloatTolerance overrides AllowedFloatError for the query's numbers (see withinTolerance). A property's "approx:<tolerance>" validator overrides both.
+	FloatTolerance *float64 `json:"floatTolerance"`
+
+	// NaNEqual treats an expected NaN as equal to an actual NaN. By default, NaN isn't equal to anything, so that a NaN result always fails.
+	NaNEqual bool `json:"nanEqual"`
+
+	// Mode is QueryModeResumePerPage to read each page from a new pager, resumed from the previous page's continuation token.
+	// By default, every page is read from a single pager.
+	Mode string `json:"mode"`
+
+	// ResultsFrom, if set, is the name of another query in the set whose results file this query is validated against, such as the query a
+	// QueryModeResumePerPage query runs in a different mode. The query has no results file of its own, and isn't updated with the baselines.
+	ResultsFrom string `json:"resultsFrom"`
+
+	// MaxItemCount, if positive, is the maximum number of items per page, sent to the service as QueryOptions.PageSizeHint.
+	// Pages the query returns with more items fail the test.
+	MaxItemCount int32 `json:"maxItemCount"`
+
+	// MaxRU, if positive, is the most request units the query may consume, to catch egregious regressions in its request charge (see QueryStats).
+	MaxRU float64 `json:"maxRU"`
+
+	// MaxRequestsPerPartition, if positive, is the most query requests the engine may make to each partition key range, such as 1 for a query that must complete
+	// in one round per partition. ExpectedPartitions, if positive, is the number of partition key ranges the engine must request (see checkPartitionRequests).
+	MaxRequestsPerPartition int `json:"maxRequestsPerPartition"`
+	ExpectedPartitions      int `json:"expectedPartitions"`
+
+	// MinPages and MaxPages, if positive, bound the number of pages the query returns, not counting the empty page that ends it (see pageSizes).
+	MinPages int `json:"minPages"`
+	MaxPages int `json:"maxPages"`
+
+	// MinResults and MaxResults, if positive, bound the number of items the query returns, for queries whose items aren't stable, such as queries over generated items.
+	// The bounds are checked before the items are compared with the baseline. A query with bounds needs no results file, and without one,
+	// its items are only checked against the bounds and its ordered validators (see validateWithoutBaseline).
+	MinResults int `json:"minResults"`
+	MaxResults int `json:"maxResults"`
+
+	// ExpectError, if set, describes the error the query is expected to fail with, in which case it has no expected results.
+	ExpectError *ExpectedError `json:"expectError"`
+
+	// Requires, if set, is what the query needs from the account to run. The query is skipped, with the unmet requirement, otherwise.
+	Requires *Requirements `json:"requires"`
+
+	// CompareOnly marks a query without a baseline, such as one over generated items that returns too many to review,
+	// whose results are only validated against the gateway's (see CompareEnvVar). It's skipped otherwise.
+	CompareOnly bool `json:"compareOnly"`
+
+	// AllowDuplicates permits the query to return items with the same id (and partition key) more than once, such as a JOIN that flattens an array (see checkDuplicates).
+	AllowDuplicates bool `json:"allowDuplicates"`
+
+	// AllowEmpty permits regenerating the query's baseline when it returns no items (see UpdateBaselinesEnvVar).
+	AllowEmpty bool `json:"allowEmpty"`
 }
 
 const ValidationIgnore = "ignore"
@@ -51,12 +148,24 @@ const ValidationOrderedDescending = "orderedDescending"
 const ValidationOrderedAscending = "orderedAscending"
 const AllowedFloatError = 1e-6
 
+// ValidationApprox is the prefix of a validator that compares numbers with a tolerance, such as "approx:1e-2" (see withinTolerance).
+const ValidationApprox = "approx"
+
+// Values of QuerySpec.ResultOrder.
+const ResultOrderOrdered = "ordered"
+const ResultOrderUnordered = "unordered"
+const ResultOrderRanked = "ranked"
+const ResultOrderGroupBy = "groupBy"
+
 type QueryContext struct {
 	Query      QuerySet
 	TestData   TestData
 	UniqueId   string
 	Directory  string
 	Containers map[string]*azcosmos.ContainerClient
+
+	// Skipped are the unmet requirements of the queries that are skipped, by query name (see Requirements).
+	Skipped map[string]string
 }
 
 type ValidationError struct {
@@ -72,37 +181,29 @@ var Validators = map[string]func(t *testing.T, propertyName string, expected, ac
 		return nil
 	},
 	ValidationEqual: func(t *testing.T, propertyName string, expected, actual []interface{}) []ValidationError {
-		errors := make([]ValidationError, 0)
-		for i, exp := range expected {
-			if i >= len(actual) {
-				return []ValidationError{{Item: i, Property: propertyName, Expected: exp, Actual: nil}}
-			}
-			act := actual[i]
-			expectedPropertyValue := expected[i].(map[string]interface{})[propertyName]
-			actualPropertyValue, ok := act.(map[string]interface{})[propertyName]
-			if !ok {
-				errors = append(errors, ValidationError{Item: i, Property: propertyName, Message: "missing expected property", Expected: expectedPropertyValue, Actual: nil})
-				continue
-			}
-
-			validationError, err := validateJsonEquality(t, i, propertyName, expectedPropertyValue, actualPropertyValue)
-			if err != nil {
-				return []ValidationError{{Item: i, Property: propertyName, Message: fmt.Sprintf("error during validation: %v", err), Expected: expectedPropertyValue, Actual: actualPropertyValue}}
-			}
-			if validationError != nil {
-				errors = append(errors, *validationError)
-			}
-		}
-		return errors
+		return validateEqual(t, propertyName, expected, actual, AllowedFloatError, false, nil)
 	},
 	ValidationOrderedDescending: func(t *testing.T, propertyName string, expected, actual []interface{}) []ValidationError {
-		return validateOrdered(propertyName, actual, false)
+		return validateOrdered(propertyName, actual, false, orderOptions{})
 	},
 	ValidationOrderedAscending: func(t *testing.T, propertyName string, expected, actual []interface{}) []ValidationError {
-		return validateOrdered(propertyName, actual, true)
+		return validateOrdered(propertyName, actual, true, orderOptions{})
 	},
 }
 
+// Options for the ordered validators, given after a colon and separated by commas (for example, "orderedAscending:ignoreCase,timestamps").
+const OrderOptionIgnoreCase = "ignoreCase"
+const OrderOptionTimestamps = "timestamps"
+
+// orderOptions control how validateOrdered compares values.
+type orderOptions struct {
+	// ignoreCase compares strings case-insensitively.
+	ignoreCase bool
+
+	// timestamps compares strings that are both RFC 3339 timestamps as times, rather than as strings.
+	timestamps bool
+}
+
 var DefaultValidators = map[string]string{
 	"_etag":        ValidationIgnore,
 	"_rid":         ValidationIgnore,
@@ -115,14 +216,11 @@ func LoadQueryContext(context context.Context, queryPath string) (queryContext Q
 	queryDir := path.Dir(queryPath)
 
 	// Read the integration test baseline file
-	queryFile, err := os.Open(queryPath)
+	data, err := os.ReadFile(queryPath)
 	if err != nil {
 		return QueryContext{}, err
 	}
-
-	defer queryFile.Close()
-	var querySpec QuerySet
-	err = json.NewDecoder(queryFile).Decode(&querySpec)
+	querySpec, err := decodeQuerySet(queryPath, data)
 	if err != nil {
 		return QueryContext{}, err
 	}
@@ -140,9 +238,16 @@ func LoadQueryContext(context context.Context, queryPath string) (queryContext Q
 		return QueryContext{}, err
 	}
 
+	if err := validateQuerySet(queryPath, data, querySpec, testData); err != nil {
+		return QueryContext{}, err
+	}
+	if err := validateContainers(querySpec, testData); err != nil {
+		return QueryContext{}, err
+	}
+
 	queryResultDir := path.Join(queryDir, querySpec.Name)
 
-	return QueryContext{querySpec, testData, uniqueId, queryResultDir, nil}, nil
+	return QueryContext{querySpec, testData, uniqueId, queryResultDir, nil, nil}, nil
 }
 
 func (queryContext *QueryContext) RunWithTestResources(context context.Context, endpoint, key string, fn func(context context.Context, client *azcosmos.Client, database *azcosmos.DatabaseClient, queryContext *QueryContext)) error {
@@ -150,85 +255,130 @@ func (queryContext *QueryContext) RunWithTestResources(context context.Context,
 	if err != nil {
 		return err
 	}
+	entraID := key == ""
 
-	throughputProperties := azcosmos.NewManualThroughputProperties(40000)
-	dbResponse, err := client.CreateDatabase(context, azcosmos.DatabaseProperties{
-		ID: queryContext.UniqueId,
-	}, &azcosmos.CreateDatabaseOptions{
-		ThroughputProperties: &throughputProperties,
-	})
+	throughputProperties, err := parseThroughput(endpoint, os.Getenv(ThroughputEnvVar))
 	if err != nil {
 		return err
 	}
+	isolation, err := parseIsolation(os.Getenv(IsolationEnvVar))
+	if err != nil {
+		return err
+	}
+
+	// Deferred deletions also run if a query panics, so that the resources of this query set aren't leaked.
+	var database *azcosmos.DatabaseClient
+	if isolation == IsolationShared {
+		database, err = runDatabase.get(context, client)
+		if err != nil {
+			return explainAuthError(err, entraID)
+		}
+	} else {
+		dbResponse, err := client.CreateDatabase(context, azcosmos.DatabaseProperties{
+			ID: queryContext.UniqueId,
+		}, &azcosmos.CreateDatabaseOptions{
+			ThroughputProperties: throughputProperties,
+		})
+		if err != nil {
+			return explainAuthError(fmt.Errorf("failed to create database: %w", err), entraID)
+		}
+
+		database, err = client.NewDatabase(dbResponse.DatabaseProperties.ID)
+		if err != nil {
+			return err
+		}
+		defer database.Delete(context, nil)
+	}
+
+	// Find the queries whose requirements aren't met, before creating the containers, which may need features the account lacks.
+	environment, err := runEnvironment.get(context, client, endpoint)
+	if err != nil {
+		return explainAuthError(err, entraID)
+	}
+	queryContext.Skipped = queryContext.evaluateRequirements(environment, func(feature string) error {
+		return runFeatures.supports(context, database, queryContext.containerResourceID("probe_"+feature, isolation), feature)
+	})
 
-	database, err := client.NewDatabase(dbResponse.DatabaseProperties.ID)
+	seeder, err := newSeeder()
 	if err != nil {
 		return err
 	}
-	defer database.Delete(context, nil)
 
 	// Create all containers
 	queryContext.Containers = make(map[string]*azcosmos.ContainerClient)
 	for _, containerProps := range queryContext.TestData.Containers {
-		containerResponse, err := database.CreateContainer(context, containerProps, &azcosmos.CreateContainerOptions{
-			ThroughputProperties: &throughputProperties,
+		if queryContext.containerUnused(containerProps.ID) {
+			log.Printf("Not creating container %s, since all its queries are skipped", containerProps.ID)
+			continue
+		}
+		resourceProps := containerProps
+		resourceProps.ID = queryContext.containerResourceID(containerProps.ID, isolation)
+		containerResponse, err := database.CreateContainer(context, resourceProps, &azcosmos.CreateContainerOptions{
+			ThroughputProperties: throughputProperties,
 		})
-		if err != nil {
-			return err
+		if err == nil && isolation == IsolationShared {
+			defer deleteContainer(context, database, resourceProps.ID)
+		}
+		err = checkCreatedVectorPolicy(resourceProps, containerResponse.ContainerProperties, err)
+		if err := checkCreatedFullTextPolicy(resourceProps, containerResponse.ContainerProperties, err); err != nil {
+			return explainAuthError(fmt.Errorf("failed to create container %s: %w", resourceProps.ID, err), entraID)
 		}
 
 		container, err := database.NewContainer(containerResponse.ContainerProperties.ID)
 		if err != nil {
 			return err
 		}
-		queryContext.Containers[containerProps.ID] = container
-
-		// Insert test data into this container
-		for _, item := range queryContext.TestData.Data {
-			// Build partition key
-			var deserializedItem map[string]interface{}
-			err = json.Unmarshal(item, &deserializedItem)
+		if resourceProps.IndexingPolicy != nil {
+			// Read the container back to check that the service kept its indexing policy, since a missing composite index only shows up later, as a query failing with a bad request.
+			readResponse, err := container.Read(context, nil)
 			if err != nil {
-				return err
-			}
-
-			partitionKey := azcosmos.NewPartitionKey()
-			for _, path := range containerProps.PartitionKeyDefinition.Paths {
-				if path[0] != '/' {
-					return fmt.Errorf("Partition key path %s must start with '/'", path)
-				}
-				property := path[1:]
-				if strings.Contains(property, "/") {
-					return fmt.Errorf("Partition key path %s must not contain '/'", path)
-				}
-				if value, ok := deserializedItem[property]; ok {
-					switch v := value.(type) {
-					case string:
-						partitionKey = partitionKey.AppendString(v)
-					default:
-						return fmt.Errorf("Unsupported partition key type %T", v)
-					}
-				} else {
-					return fmt.Errorf("Partition key property %s not found in item", property)
-				}
+				return fmt.Errorf("failed to read back container %s: %w", resourceProps.ID, err)
 			}
-
-			jsonItem, err := item.MarshalJSON()
-			if err != nil {
+			if err := checkCreatedIndexingPolicy(resourceProps, readResponse.ContainerProperties); err != nil {
 				return err
 			}
+		}
+		queryContext.Containers[containerProps.ID] = container
 
-			_, err = container.CreateItem(context, partitionKey, jsonItem, nil)
-			if err != nil {
-				return err
-			}
+		// Insert test data into this container, before any query runs
+		items, err := seeding.BuildItems(containerProps.PartitionKeyDefinition, queryContext.TestData.Data.ItemsFor(containerProps.ID))
+		if err != nil {
+			return err
 		}
+		containerID := resourceProps.ID
+		seeder.Progress = func(inserted, total int) {
+			log.Printf("Seeding %s: inserted %d/%d items", containerID, inserted, total)
+		}
+		start := time.Now()
+		if err := seeder.Seed(context, container, items); err != nil {
+			return explainAuthError(fmt.Errorf("failed to seed container %s: %w", containerID, err), entraID)
+		}
+		log.Printf("Seeded %d items into %s in %v (concurrency %d)", len(items), containerID, time.Since(start).Round(time.Millisecond), seeder.Concurrency)
 	}
 
 	fn(context, client, database, queryContext)
 	return nil
 }
 
+// validateContainers checks that every container referenced by the test data's items and by the queries is defined in the test data.
+func validateContainers(querySet QuerySet, testData TestData) error {
+	defined := make(map[string]bool, len(testData.Containers))
+	for _, container := range testData.Containers {
+		defined[container.ID] = true
+	}
+	for containerID := range testData.Data.PerContainer {
+		if !defined[containerID] {
+			return fmt.Errorf("Test data lists items for container '%s', but that container is not defined in the test data", containerID)
+		}
+	}
+	for _, query := range querySet.Queries {
+		if !defined[query.Container] {
+			return fmt.Errorf("Query '%s' references container '%s', but that container is not defined in the test data", query.Name, query.Container)
+		}
+	}
+	return nil
+}
+
 func resolvePath(baseDir, relativePath string) string {
 	// Resolve the path relative to the base directory
 	if path.IsAbs(relativePath) {
@@ -238,17 +388,34 @@ func resolvePath(baseDir, relativePath string) string {
 }
 
 func loadTestData(path, uniqueId string) (TestData, error) {
-	testDataFile, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return TestData{}, err
 	}
 
-	defer testDataFile.Close()
 	var testData TestData
-	err = json.NewDecoder(testDataFile).Decode(&testData)
+	err = json.Unmarshal(data, &testData)
 	if err != nil {
 		return TestData{}, err
 	}
+	if err := testData.expandGenerated(); err != nil {
+		return TestData{}, err
+	}
+	if err := applyIndexingPolicyDefaults(data, &testData); err != nil {
+		return TestData{}, err
+	}
+
+	if err := validateVectorPolicies(data, testData); err != nil {
+		return TestData{}, err
+	}
+	for _, container := range testData.Containers {
+		if err := validateFullTextPolicy(container); err != nil {
+			return TestData{}, fmt.Errorf("Container '%s': %w", container.ID, err)
+		}
+		if err := validateIndexingPolicy(container); err != nil {
+			return TestData{}, fmt.Errorf("Container '%s': %w", container.ID, err)
+		}
+	}
 
 	// Container IDs are already unique within the test data, no need to modify them
 	return testData, nil
@@ -270,25 +437,6 @@ func loadExpectedResults(path string) ([]interface{}, error) {
 	return results, nil
 }
 
-func createClient(endpoint, key string) (*azcosmos.Client, error) {
-	// Create a client with a custom transport that skips TLS verification
-	// Since there's a self-signed certificate in the emulator, we need to skip verification
-	transport := &http.Client{Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}}
-
-	options := &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{
-		Transport: transport,
-	}}
-
-	// Open a cosmos client
-	keyCredential, err := azcosmos.NewKeyCredential(key)
-	if err != nil {
-		return nil, err
-	}
-	return azcosmos.NewClientWithKey(endpoint, keyCredential, options)
-}
-
 func getenvOrDefault(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -299,9 +447,9 @@ func getenvOrDefault(key, def string) string {
 func runIntegrationTest(t *testing.T, querySetPath string) {
 	azcosmoscx.EnableTracing()
 
-	// Default to the emulator and it's well-known (not secret) key.
-	endpoint := getenvOrDefault("AZURE_COSMOS_ENDPOINT", "https://localhost:8081")
-	key := getenvOrDefault("AZURE_COSMOS_KEY", "C2y6yDjf5/R+ob0N8A7Cgv30VRDJIWEHLM+4QDU5DE2nQ9nDuVTqobD4b8mGGyPMbIZnqyMsEcaGQy67XIw/Jw==")
+	// Default to the emulator and its well-known (not secret) key, or Entra ID authentication for other accounts without a key.
+	endpoint := getenvOrDefault(EndpointEnvVar, defaultEndpoint)
+	key := emulator.ResolveKey(endpoint, os.Getenv(KeyEnvVar))
 
 	// Find the integration test baseline file
 	fullPath := path.Join("..", "..", "baselines", "queries", querySetPath)
@@ -312,38 +460,140 @@ func runIntegrationTest(t *testing.T, querySetPath string) {
 		t.Errorf("Failed to load query context: %v", err)
 		return
 	}
+	compare, err := parseCompareMode(os.Getenv(CompareEnvVar))
+	require.NoError(t, err)
+	fixtures, err := parseFixturesMode(os.Getenv(FixturesEnvVar))
+	require.NoError(t, err)
 
+	if fixtures == FixturesReplay {
+		// Replaying fixtures doesn't need an account, so no resources are created.
+		require.Empty(t, compare, "%s=%s can't be combined with %s, since replayed queries don't reach the gateway", FixturesEnvVar, FixturesReplay, CompareEnvVar)
+		require.NotEqual(t, "1", os.Getenv(UpdateBaselinesEnvVar), "%s=%s can't be combined with %s", FixturesEnvVar, FixturesReplay, UpdateBaselinesEnvVar)
+		runQueries(t, querySetPath, &queryContext, compare, fixtures)
+		return
+	}
 	err = queryContext.RunWithTestResources(context.Background(), endpoint, key, func(ctx context.Context, client *azcosmos.Client, database *azcosmos.DatabaseClient, queryContext *QueryContext) {
-		for _, query := range queryContext.Query.Queries {
-			t.Run(query.Name, func(t *testing.T) {
-				// Find the container for this query
-				container, ok := queryContext.Containers[query.Container]
-				if !ok {
-					t.Errorf("Query '%s' references container '%s', but that container was not found", query.Name, query.Container)
+		runQueries(t, querySetPath, queryContext, compare, fixtures)
+	})
+	require.NoError(t, err)
+}
+
+// runQueries runs each query of the query set as a subtest, validating its results against its baseline or the gateway (see CompareEnvVar),
+// and recording or replaying its fixture (see FixturesEnvVar).
+func runQueries(t *testing.T, querySetPath string, queryContext *QueryContext, compare string, fixtures string) {
+	for _, query := range queryContext.Query.Queries {
+		t.Run(query.Name, func(t *testing.T) {
+			defer recoverPanic(t)
+
+			if reason, ok := queryContext.Skipped[query.Name]; ok {
+				runReport.add(QueryStats{Query: query.Name, Skipped: reason})
+				t.Skipf("Query %s requires %s", query.Name, reason)
+			}
+
+			if fixtures == FixturesReplay && query.Mode == QueryModeResumePerPage {
+				t.Skipf("Query %s resumes each page from a new pipeline, which fixtures don't record", query.Name)
+			}
+			fixturePath := fixturePath(querySetPath, query.Name)
+			execute, err := queryContext.executor(query, fixtures, fixturePath)
+			if errors.Is(err, os.ErrNotExist) && fixtures == FixturesReplay {
+				t.Skipf("Query %s has no fixture to replay at %s (record one with %s=%s)", query.Name, fixturePath, FixturesEnvVar, FixturesRecord)
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			// Load results for this test
+			resultsFileName := fmt.Sprintf("%s.results.json", query.resultsName())
+			resultsPath := path.Join(queryContext.Directory, resultsFileName)
+			if query.ExpectError != nil {
+				err := runSingleQuery(t, &queryContext.TestData, nil, "", "", query, execute)
+				require.NoError(t, err)
+				return
+			}
+			if query.CompareOnly && compare != CompareGateway && !query.hasResultBounds() {
+				t.Skipf("Query %s has no baseline, and is only validated against the gateway (set %s=%s)", query.Name, CompareEnvVar, CompareGateway)
+			}
+			// A query with result bounds and no baseline is validated against its bounds (see MinResults and MaxResults).
+			_, statErr := os.Stat(resultsPath)
+			bounded := query.hasResultBounds() && errors.Is(statErr, os.ErrNotExist)
+			container := queryContext.Containers[query.Container]
+			if os.Getenv(UpdateBaselinesEnvVar) == "1" {
+				if query.ResultsFrom != "" {
+					t.Skipf("Query %s is validated against the baseline of %s", query.Name, query.ResultsFrom)
+				}
+				if bounded {
+					t.Skipf("Query %s is validated against its minResults and maxResults rather than a baseline", query.Name)
+				}
+				updateBaseline(t, &queryContext.TestData, query, container, resultsPath)
+				return
+			}
+			if compare == CompareGateway {
+				gatewayResults, gatewayStats, gatewayErr := executeGatewayQuery(&queryContext.TestData, query, container)
+				if gatewayErr == nil {
+					t.Logf("Query %s on the gateway: %s", query.Name, gatewayStats)
+					err := runSingleQuery(t, &queryContext.TestData, gatewayResults, resultsPath, ValidationGateway, query, execute)
+					require.NoError(t, err)
 					return
 				}
-
-				// Load results for this test
-				resultsFileName := fmt.Sprintf("%s.results.json", query.Name)
-				resultsPath := path.Join(queryContext.Directory, resultsFileName)
-				results, err := loadExpectedResults(resultsPath)
+				t.Logf("The gateway can't run query %s, so it's validated against its baseline: %v", query.Name, gatewayErr)
+				if errors.Is(statErr, os.ErrNotExist) && !bounded {
+					t.Skipf("Query %s has no baseline to validate it against", query.Name)
+				}
+			}
+			if bounded {
+				err := runSingleQuery(t, &queryContext.TestData, nil, "", ValidationBounds, query, execute)
 				require.NoError(t, err)
+				return
+			}
+			results, err := loadExpectedResults(resultsPath)
+			require.NoError(t, err)
 
-				err = runSingleQuery(t, &queryContext.TestData, results, query, container)
-				require.NoError(t, err)
-			})
-		}
-	})
-	require.NoError(t, err)
+			err = runSingleQuery(t, &queryContext.TestData, results, resultsPath, ValidationBaseline, query, execute)
+			require.NoError(t, err)
+		})
+	}
+}
+
+// resultsName returns the name of the query whose results file the query is validated against (see ResultsFrom).
+func (query *QuerySpec) resultsName() string {
+	if query.ResultsFrom != "" {
+		return query.ResultsFrom
+	}
+	return query.Name
 }
 
-func floatEqual(index int, expected, actual, allowedError float64) *ValidationError {
-	delta := math.Abs(expected - actual)
-	if delta > allowedError {
+// tolerance returns the tolerance for comparing the query's numbers.
+func (query *QuerySpec) tolerance() float64 {
+	if query.FloatTolerance != nil {
+		return *query.FloatTolerance
+	}
+	return AllowedFloatError
+}
+
+// withinTolerance checks that two numbers are equal within a tolerance.
+// The tolerance is absolute for numbers of magnitude up to 1, and relative to the larger magnitude beyond that, so that it scales with large values whose precision is limited.
+// An infinity is only equal to the infinity of the same sign, and NaN is only equal to NaN if nanEqual is set.
+func withinTolerance(expected, actual, tolerance float64, nanEqual bool) bool {
+	if expected == actual {
+		return true
+	}
+	if math.IsNaN(expected) || math.IsNaN(actual) {
+		return nanEqual && math.IsNaN(expected) && math.IsNaN(actual)
+	}
+	if math.IsInf(expected, 0) || math.IsInf(actual, 0) {
+		return false
+	}
+	scale := math.Max(1, math.Max(math.Abs(expected), math.Abs(actual)))
+	return math.Abs(expected-actual) <= tolerance*scale
+}
+
+func floatEqual(index int, property string, expected, actual, allowedError float64, nanEqual bool) *ValidationError {
+	if !withinTolerance(expected, actual, allowedError, nanEqual) {
 		return &ValidationError{
 			Item:     index,
-			Property: "<item>",
-			Message:  fmt.Sprintf("float mismatch: expected %f, got %f (delta %f exceeds allowed error %f)", expected, actual, delta, AllowedFloatError),
+			Property: property,
+			Message:  fmt.Sprintf("float mismatch: expected %g, got %g (delta %.3g exceeds allowed error %g)", expected, actual, math.Abs(expected-actual), allowedError),
 			Expected: expected,
 			Actual:   actual,
 		}
@@ -351,7 +601,44 @@ func floatEqual(index int, expected, actual, allowedError float64) *ValidationEr
 	return nil
 }
 
-func runSingleQuery(t *testing.T, testData *TestData, expectedResults []interface{}, query QuerySpec, container *azcosmos.ContainerClient) error {
+// queryExecutor runs a query and returns the items it produced, and statistics about how it ran (see executeQuery).
+type queryExecutor func(testData *TestData, query QuerySpec) ([]interface{}, QueryStats, error)
+
+// executor returns how a query is run in a fixtures mode (see FixturesEnvVar): against its container, recording its fixture to fixturePath as it runs,
+// or replaying the fixture at fixturePath without a container.
+func (queryContext *QueryContext) executor(query QuerySpec, fixtures string, fixturePath string) (queryExecutor, error) {
+	if fixtures == FixturesReplay {
+		fixture, err := loadFixture(fixturePath, query)
+		if err != nil {
+			return nil, err
+		}
+		return func(testData *TestData, query QuerySpec) ([]interface{}, QueryStats, error) {
+			return replayQuery(query, fixture)
+		}, nil
+	}
+
+	container, ok := queryContext.Containers[query.Container]
+	if !ok {
+		return nil, fmt.Errorf("Query '%s' references container '%s', but that container was not found", query.Name, query.Container)
+	}
+	if fixtures == FixturesRecord && query.Mode != QueryModeResumePerPage {
+		return func(testData *TestData, query QuerySpec) ([]interface{}, QueryStats, error) {
+			return recordQuery(testData, query, container, fixturePath)
+		}, nil
+	}
+	return func(testData *TestData, query QuerySpec) ([]interface{}, QueryStats, error) {
+		return executeQuery(testData, query, container)
+	}, nil
+}
+
+// executeQuery runs the query through the client engine and returns the items it produced, and statistics about how it ran.
+// If the query fails, the error is a *QueryError recording the stage at which it failed.
+func executeQuery(testData *TestData, query QuerySpec, container *azcosmos.ContainerClient) ([]interface{}, QueryStats, error) {
+	return runQuery(testData, query, container, azcosmoscx.NewQueryEngine())
+}
+
+// runQuery runs the query through the engine, or, if it's nil, as the gateway executes it (see executeGatewayQuery).
+func runQuery(testData *TestData, query QuerySpec, container *azcosmos.ContainerClient, engine queryengine.QueryEngine) ([]interface{}, QueryStats, error) {
 	// Set up query parameters
 	parameters := make([]azcosmos.QueryParameter, 0, len(query.Parameters)+len(testData.Parameters))
 	for name, value := range query.Parameters {
@@ -363,33 +650,171 @@ func runSingleQuery(t *testing.T, testData *TestData, expectedResults []interfac
 		parameters = append(parameters, azcosmos.QueryParameter{Name: paramName, Value: value})
 	}
 
-	queryEngine := azcosmoscx.NewQueryEngine()
-	queryOptions := &azcosmos.QueryOptions{
-		QueryEngine:     queryEngine,
-		QueryParameters: parameters,
+	var resume bool
+	switch query.Mode {
+	case "":
+	case QueryModeResumePerPage:
+		resume = true
+	default:
+		return nil, QueryStats{}, fmt.Errorf("unknown query mode '%s'", query.Mode)
 	}
 
-	pager := container.NewQueryItemsPager(query.Text, azcosmos.NewPartitionKey(), queryOptions)
+	queryEngine := &stageRecordingEngine{QueryEngine: engine}
+	newPager := func(continuation *string) *runtime.Pager[azcosmos.QueryItemsResponse] {
+		queryOptions := &azcosmos.QueryOptions{
+			QueryParameters:   parameters,
+			PageSizeHint:      query.MaxItemCount,
+			ContinuationToken: continuation,
+		}
+		if engine != nil {
+			queryOptions.QueryEngine = queryEngine
+		}
+		return container.NewQueryItemsPager(query.Text, azcosmos.NewPartitionKey(), queryOptions)
+	}
+	return readQuery(query, newPager, resume, queryEngine)
+}
 
-	actualItemCount := 0
-	actualItems := make([]interface{}, 0, len(expectedResults))
-	for pager.More() {
-		page, err := pager.NextPage(context.TODO())
-		if err != nil {
-			return err
+// readQuery reads every page of the query from the pagers newPager creates (see readPages), and returns the items, and statistics about how it ran.
+// The queryEngine is the engine the pagers use, if any, which records whether a failure happened while creating the pipeline.
+func readQuery(query QuerySpec, newPager func(continuation *string) *runtime.Pager[azcosmos.QueryItemsResponse], resume bool, queryEngine *stageRecordingEngine) ([]interface{}, QueryStats, error) {
+	recorder := &chargeRecorder{}
+	partitionRequests := &partitionRequestLog{}
+	start := time.Now()
+	pages, err := readPages(withPartitionRequestLog(withChargeRecorder(context.TODO(), recorder), partitionRequests), newPager, resume, recorder)
+	stats := QueryStats{
+		Query:             query.Name,
+		PageSizes:         pageSizes(pages),
+		TotalRU:           recorder.total,
+		Requests:          recorder.requests,
+		PartitionRequests: partitionRequests.requests,
+		Duration:          time.Since(start),
+	}
+	stats.PageCharges = foldPageCharges(recorder.pageCharges, len(stats.PageSizes))
+	if errors.Is(err, ErrPipelineNotResumable) || errors.Is(err, ErrQueryNotResumed) {
+		return nil, QueryStats{}, err
+	}
+	if err != nil {
+		stage := ErrorStagePage
+		switch {
+		case queryEngine.createErr != nil:
+			stage = ErrorStagePipelineCreation
+		case len(pages) == 0:
+			stage = ErrorStageFirstPage
 		}
+		return nil, QueryStats{}, &QueryError{Stage: stage, Err: err}
+	}
 
+	actualItems := make([]interface{}, 0)
+	for _, page := range pages {
 		for idx, actualJson := range page.Items {
-			actualItemCount++
 			var actualItem interface{}
 			err := json.Unmarshal(actualJson, &actualItem)
 			if err != nil {
-				return fmt.Errorf("failed to unmarshal item %d: %v", idx, err)
+				return nil, QueryStats{}, fmt.Errorf("failed to unmarshal item %d: %v", idx, err)
 			}
 			actualItems = append(actualItems, actualItem)
 		}
 	}
-	assert.Equal(t, len(actualItems), actualItemCount, "Expected %d items, but got %d", len(actualItems), actualItemCount)
+	return actualItems, stats, nil
+}
+
+// runSingleQuery runs the query and validates its results against the expected results, which come from the baseline or the gateway, as recorded in the report (see ValidationBaseline and ValidationGateway).
+// If validation fails, the actual results and their diff from the expected results are written next to the baseline at resultsPath (see writeFailureArtifacts), unless resultsPath is "".
+func runSingleQuery(t *testing.T, testData *TestData, expectedResults []interface{}, resultsPath string, validation string, query QuerySpec, execute queryExecutor) (err error) {
+	actualItems, stats, err := execute(testData, query)
+	stats.Validation = validation
+	skipIfNotResumable(t, err)
+	if query.ExpectError != nil {
+		return checkExpectedError(query.ExpectError, actualItems, err)
+	}
+	if err != nil {
+		return err
+	}
+	if resultsPath != "" {
+		originalExpected, originalActual := expectedResults, actualItems
+		defer func() {
+			if err == nil && !t.Failed() {
+				return
+			}
+			actualPath, diffPath, artifactErr := writeFailureArtifacts(artifactsDir(resultsPath), query.Name, originalExpected, originalActual)
+			if artifactErr != nil {
+				t.Errorf("Failed to write failure artifacts: %v", artifactErr)
+				return
+			}
+			if err != nil {
+				err = fmt.Errorf("%w (actual results written to %s, diff to %s)", err, actualPath, diffPath)
+			} else {
+				t.Errorf("Validation failed; actual results written to %s, diff to %s", actualPath, diffPath)
+			}
+		}()
+	}
+	t.Logf("Query %s: %s", query.Name, stats)
+	runReport.add(stats)
+	if err := checkDuplicates(query, actualItems, stats.PageSizes, testData.partitionKeyPaths(query.Container)); err != nil {
+		return err
+	}
+	if err := checkPageShape(query, stats.PageSizes); err != nil {
+		return err
+	}
+	if err := checkRequestCharge(query, stats); err != nil {
+		return err
+	}
+	if err := checkPartitionRequests(query, stats.PartitionRequests); err != nil {
+		return err
+	}
+	if err := checkResultCount(query, len(actualItems)); err != nil {
+		return err
+	}
+	if validation == ValidationBounds {
+		errors, err := validateWithoutBaseline(query, actualItems)
+		if err != nil {
+			return err
+		}
+		reportValidationErrors(t, errors)
+		return nil
+	}
+
+	switch query.ResultOrder {
+	case "", ResultOrderOrdered:
+	case ResultOrderUnordered:
+		// Pair up the items, so that they can be validated in order.
+		var unmatched []ValidationError
+		actualItems, unmatched = matchUnordered(expectedResults, actualItems)
+		if len(unmatched) > 0 {
+			for _, err := range unmatched {
+				t.Errorf("Item %d: %s\nExpected: %v\nActual: %v", err.Item, err.Message, err.Expected, err.Actual)
+			}
+			return fmt.Errorf("%d items of the expected and actual results didn't match", len(unmatched))
+		}
+	case ResultOrderRanked:
+		if query.RankTolerance < 0 {
+			return fmt.Errorf("rankTolerance must not be negative, but was %d", query.RankTolerance)
+		}
+		if len(actualItems) != len(expectedResults) {
+			return fmt.Errorf("expected %d results, but got %d", len(expectedResults), len(actualItems))
+		}
+		// Pair up the items, so that they can be validated in order.
+		var misranked []ValidationError
+		expectedResults, actualItems, misranked = matchRanked(expectedResults, actualItems, query.RankTolerance)
+		if len(misranked) > 0 {
+			for _, err := range misranked {
+				t.Errorf("Item %d: %s\nExpected: %v\nActual: %v", err.Item, err.Message, err.Expected, err.Actual)
+			}
+			return fmt.Errorf("%d items of the expected and actual results weren't ranked within %d places of each other", len(misranked), query.RankTolerance)
+		}
+	case ResultOrderGroupBy:
+		// Pair up the groups, so that their aggregates can be validated in order.
+		var unmatched []ValidationError
+		expectedResults, actualItems, unmatched = matchGroups(expectedResults, actualItems, query.GroupBy)
+		if len(unmatched) > 0 {
+			for _, err := range unmatched {
+				t.Errorf("Row %d: %s\nExpected: %v\nActual: %v", err.Item, err.Message, err.Expected, err.Actual)
+			}
+			return fmt.Errorf("%d groups of the expected and actual results didn't match", len(unmatched))
+		}
+	default:
+		return fmt.Errorf("unknown result order '%s'", query.ResultOrder)
+	}
 
 	if len(actualItems) != len(expectedResults) {
 		return fmt.Errorf("expected %d results, but got %d", len(expectedResults), len(actualItems))
@@ -404,14 +829,14 @@ func runSingleQuery(t *testing.T, testData *TestData, expectedResults []interfac
 	var errors []ValidationError
 	if _, ok := expectedResults[0].(map[string]interface{}); ok {
 		var err error
-		errors, err = validateUsingValidators(t, actualItems, expectedResults, query.Validators)
+		errors, err = validateUsingValidators(t, actualItems, expectedResults, query.Validators, query.tolerance(), query.NaNEqual)
 		if err != nil {
 			return err
 		}
 	} else {
 		// Just do a direct comparison of each object. We already know the counts match
 		for i := 0; i < len(expectedResults); i++ {
-			validationError, err := validateJsonEquality(t, i, "<item>", expectedResults[i], actualItems[i])
+			validationError, err := validateJsonEquality(t, i, "<item>", expectedResults[i], actualItems[i], query.tolerance(), query.NaNEqual)
 			if err != nil {
 				return err
 			}
@@ -421,51 +846,143 @@ func runSingleQuery(t *testing.T, testData *TestData, expectedResults []interfac
 		}
 	}
 
-	if len(errors) > 0 {
-		for _, err := range errors {
-			t.Errorf("Item %d, property '%s' validation failed: %s\nExpected: %v\nActual: %v\nMessage: %s",
-				err.Item, err.Property, err.Message, err.Expected, err.Actual, err.Message)
-		}
-	}
+	reportValidationErrors(t, errors)
 	return nil
 }
 
-func validateJsonEquality(t *testing.T, index int, property string, expected, actual interface{}) (*ValidationError, error) {
-	// special handling for floats to allow for small differences
-	switch expected.(type) {
-	case float32:
-		expectedFloat := expected.(float32)
-		actualFloat := actual.(float32)
-		return floatEqual(0, float64(expectedFloat), float64(actualFloat), AllowedFloatError), nil
-	case float64:
-		expectedFloat := expected.(float64)
-		actualFloat := actual.(float64)
-		return floatEqual(0, expectedFloat, actualFloat, AllowedFloatError), nil
-	default:
-		patch, err := jsondiff.Compare(expected, actual, jsondiff.Ignores("_etag", "_rid", "_self", "_ts", "_attachments"))
+// reportValidationErrors fails the test with each validation error.
+func reportValidationErrors(t *testing.T, errors []ValidationError) {
+	for _, err := range errors {
+		t.Errorf("Item %d, property '%s' validation failed: %s\nExpected: %v\nActual: %v\nMessage: %s",
+			err.Item, err.Property, err.Message, err.Expected, err.Actual, err.Message)
+	}
+}
+
+// validateEqual checks that the property of each actual item equals the property of the corresponding expected item.
+// Numbers are compared within tolerance, and ignores lists JSON pointers, relative to the property's value, of nested values to leave out of the comparison.
+func validateEqual(t *testing.T, propertyName string, expected, actual []interface{}, tolerance float64, nanEqual bool, ignores []string) []ValidationError {
+	errors := make([]ValidationError, 0)
+	for i, exp := range expected {
+		if i >= len(actual) {
+			return []ValidationError{{Item: i, Property: propertyName, Expected: exp, Actual: nil}}
+		}
+		expectedPropertyValue, _, err := lookupProperty(exp, propertyName)
 		if err != nil {
-			return nil, fmt.Errorf("error comparing item %d: %v", index, err)
+			errors = append(errors, ValidationError{Item: i, Property: propertyName, Message: fmt.Sprintf("invalid expected item: %v", err), Expected: exp, Actual: nil})
+			continue
+		}
+		actualPropertyValue, ok, err := lookupProperty(actual[i], propertyName)
+		if err != nil {
+			errors = append(errors, ValidationError{Item: i, Property: propertyName, Message: err.Error(), Expected: expectedPropertyValue, Actual: actual[i]})
+			continue
+		}
+		if !ok {
+			errors = append(errors, ValidationError{Item: i, Property: propertyName, Message: "missing expected property", Expected: expectedPropertyValue, Actual: nil})
+			continue
+		}
+
+		validationError, err := validateJsonEquality(t, i, propertyName, expectedPropertyValue, actualPropertyValue, tolerance, nanEqual, ignores...)
+		if err != nil {
+			return []ValidationError{{Item: i, Property: propertyName, Message: fmt.Sprintf("error during validation: %v", err), Expected: expectedPropertyValue, Actual: actualPropertyValue}}
+		}
+		if validationError != nil {
+			errors = append(errors, *validationError)
 		}
-		if len(patch) > 0 {
+	}
+	return errors
+}
+
+// validateJsonEquality compares an expected and actual value, ignoring system properties and the nested values at the JSON pointers in ignores.
+// Numbers of any Go numeric type, or json.Number, are compared as float64s within tolerance (see withinTolerance), so an integer equals the integer-valued float.
+func validateJsonEquality(t *testing.T, index int, property string, expected, actual interface{}, tolerance float64, nanEqual bool, ignores ...string) (*ValidationError, error) {
+	// special handling for floats to allow for small differences
+	if expectedFloat, ok := toFloat64(expected); ok {
+		actualFloat, ok := toFloat64(actual)
+		if !ok {
 			return &ValidationError{
 				Item:     index,
 				Property: property,
-				Message:  fmt.Sprintf("item mismatch: %s", patch),
+				Message:  fmt.Sprintf("type mismatch: expected a number, got %T", actual),
 				Expected: expected,
 				Actual:   actual,
 			}, nil
 		}
-		break
+		return floatEqual(index, property, expectedFloat, actualFloat, tolerance, nanEqual), nil
+	}
+
+	patch, err := jsondiff.Compare(expected, actual, jsondiff.Ignores(append([]string{"_etag", "_rid", "_self", "_ts", "_attachments"}, ignores...)...))
+	if err != nil {
+		return nil, fmt.Errorf("error comparing item %d: %v", index, err)
+	}
+	if len(patch) > 0 {
+		return &ValidationError{
+			Item:     index,
+			Property: property,
+			Message:  fmt.Sprintf("item mismatch: %s", patch),
+			Expected: expected,
+			Actual:   actual,
+		}, nil
 	}
 	return nil, nil
 }
 
-func validateUsingValidators(t *testing.T, actualItems, expectedResults []interface{}, validators map[string]string) ([]ValidationError, error) {
+// toFloat64 converts a number, of any Go numeric type or json.Number, to a float64.
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// validateUsingValidators validates each property of the items with the validator configured for it, or a default one.
+// Validators can also be configured for nested properties, by a dot-separated path ("address.city") or a JSON pointer ("/address/city").
+// A nested property's validator replaces the comparison of that value when its top-level property is compared for equality.
+func validateUsingValidators(t *testing.T, actualItems, expectedResults []interface{}, validators map[string]string, tolerance float64, nanEqual bool) ([]ValidationError, error) {
 	firstItem := actualItems[0].(map[string]interface{})
 	properties := make([]string, 0, len(firstItem))
 	for property := range firstItem {
 		properties = append(properties, property)
 	}
+
+	// Find the validators for nested properties, grouped by their top-level property.
+	nestedPaths := make([]string, 0)
+	nestedPointers := make(map[string][]string)
+	for path := range validators {
+		segments := splitPropertyPath(path)
+		if len(segments) > 1 {
+			nestedPaths = append(nestedPaths, path)
+			nestedPointers[segments[0]] = append(nestedPointers[segments[0]], jsonPointer(segments[1:]))
+		}
+	}
+	sort.Strings(nestedPaths)
+
 	errors := make([]ValidationError, 0)
 	for _, property := range properties {
 		validator, ok := validators[property]
@@ -475,19 +992,143 @@ func validateUsingValidators(t *testing.T, actualItems, expectedResults []interf
 				validator = ValidationEqual // Default to equal if no validator is specified
 			}
 		}
-		validateFunc, ok := Validators[validator]
-		if !ok {
-			return nil, fmt.Errorf("unknown validator %s for property %s", validator, property)
+		if validator == ValidationEqual && len(nestedPointers[property]) > 0 {
+			errors = append(errors, validateEqual(t, topLevelPath(property), expectedResults, actualItems, tolerance, nanEqual, nestedPointers[property])...)
+			continue
 		}
-		localErrors := validateFunc(t, property, expectedResults, actualItems)
+		validateFunc, err := resolveValidator(validator, tolerance, nanEqual)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validator %s for property %s: %v", validator, property, err)
+		}
+		localErrors := validateFunc(t, topLevelPath(property), expectedResults, actualItems)
 		errors = append(errors, localErrors...)
 	}
+	for _, path := range nestedPaths {
+		validateFunc, err := resolveValidator(validators[path], tolerance, nanEqual)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validator %s for property %s: %v", validators[path], path, err)
+		}
+		errors = append(errors, validateFunc(t, path, expectedResults, actualItems)...)
+	}
 	return errors, nil
 }
 
+// splitPropertyPath splits a validator's property path, which is a dot-separated path ("address.city") or a JSON pointer ("/address/city"), into property names.
+func splitPropertyPath(path string) []string {
+	if !strings.HasPrefix(path, "/") {
+		return strings.Split(path, ".")
+	}
+	segments := strings.Split(path[1:], "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+	}
+	return segments
+}
+
+// topLevelPath returns the path to a top-level property, which is its name unless the name would be parsed as a nested path.
+func topLevelPath(property string) string {
+	if strings.HasPrefix(property, "/") || strings.Contains(property, ".") {
+		return jsonPointer([]string{property})
+	}
+	return property
+}
+
+// jsonPointer returns the JSON pointer to a nested property.
+func jsonPointer(segments []string) string {
+	var pointer strings.Builder
+	for _, segment := range segments {
+		pointer.WriteString("/")
+		pointer.WriteString(strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1"))
+	}
+	return pointer.String()
+}
+
+// lookupProperty returns the value of the property at a path (see splitPropertyPath) in an item, and whether it was found.
+// An error names the path if the item, or a value along the path, isn't an object.
+func lookupProperty(item interface{}, path string) (interface{}, bool, error) {
+	segments := splitPropertyPath(path)
+	value := item
+	for i, segment := range segments {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			if i == 0 {
+				return nil, false, fmt.Errorf("item is not an object, so it has no property '%s'", path)
+			}
+			return nil, false, fmt.Errorf("property '%s' is missing or isn't an object, so it has no property '%s'", strings.Join(segments[:i], "."), path)
+		}
+		value, ok = object[segment]
+		if !ok {
+			if i < len(segments)-1 {
+				return nil, false, fmt.Errorf("property '%s' is missing, so it has no property '%s'", strings.Join(segments[:i+1], "."), path)
+			}
+			return nil, false, nil
+		}
+	}
+	return value, true, nil
+}
+
+// resolveValidator returns the validation function for a validator, which is the name of one of the Validators, optionally followed by a colon and its options,
+// or ValidationApprox followed by a colon and a tolerance. The equal validator compares numbers within the query's tolerance, and both treat NaN as equal to NaN if nanEqual is set.
+func resolveValidator(validator string, tolerance float64, nanEqual bool) (func(t *testing.T, propertyName string, expected, actual []interface{}) []ValidationError, error) {
+	name, args, hasArgs := strings.Cut(validator, ":")
+	if name == ValidationApprox {
+		tolerance, err := parseTolerance(args)
+		if !hasArgs || err != nil {
+			return nil, fmt.Errorf("%s must be followed by a colon and a non-negative tolerance, such as %s:1e-3", ValidationApprox, ValidationApprox)
+		}
+		return func(t *testing.T, propertyName string, expected, actual []interface{}) []ValidationError {
+			return validateEqual(t, propertyName, expected, actual, tolerance, nanEqual, nil)
+		}, nil
+	}
+	if name == ValidationEqual && !hasArgs {
+		return func(t *testing.T, propertyName string, expected, actual []interface{}) []ValidationError {
+			return validateEqual(t, propertyName, expected, actual, tolerance, nanEqual, nil)
+		}, nil
+	}
+	if !hasArgs {
+		validateFunc, ok := Validators[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown validator")
+		}
+		return validateFunc, nil
+	}
+
+	if name != ValidationOrderedAscending && name != ValidationOrderedDescending {
+		return nil, fmt.Errorf("validator %s doesn't take options", name)
+	}
+	var options orderOptions
+	for _, option := range strings.Split(args, ",") {
+		switch option {
+		case OrderOptionIgnoreCase:
+			options.ignoreCase = true
+		case OrderOptionTimestamps:
+			options.timestamps = true
+		default:
+			return nil, fmt.Errorf("unknown option '%s'", option)
+		}
+	}
+	ascending := name == ValidationOrderedAscending
+	return func(t *testing.T, propertyName string, expected, actual []interface{}) []ValidationError {
+		return validateOrdered(propertyName, actual, ascending, options)
+	}, nil
+}
+
+// parseTolerance parses the tolerance of an approx validator.
+func parseTolerance(value string) (float64, error) {
+	tolerance, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if tolerance < 0 || math.IsNaN(tolerance) || math.IsInf(tolerance, 0) {
+		return 0, fmt.Errorf("tolerance must be a non-negative number")
+	}
+	return tolerance, nil
+}
+
 // validateOrdered checks that the actual results are ordered by the specified property.
 // ascending determines whether to check for ascending (true) or descending (false) order.
-func validateOrdered(propertyName string, actual []interface{}, ascending bool) []ValidationError {
+// Numbers are compared numerically and strings lexicographically (or as configured by options). Values of different types can't be compared, and are reported as errors.
+func validateOrdered(propertyName string, actual []interface{}, ascending bool, options orderOptions) []ValidationError {
 	errors := make([]ValidationError, 0)
 	if len(actual) == 0 {
 		return []ValidationError{{Item: 0, Property: propertyName, Message: "no actual results to validate against"}}
@@ -496,27 +1137,34 @@ func validateOrdered(propertyName string, actual []interface{}, ascending bool)
 		return nil // A single item is always ordered
 	}
 	for i := 1; i < len(actual); i++ {
-		currentValue, ok := actual[i-1].(map[string]interface{})[propertyName]
-		if !ok {
-			errors = append(errors, ValidationError{Item: i - 1, Property: propertyName, Message: "missing expected property", Expected: nil, Actual: nil})
+		currentValue, ok, err := lookupProperty(actual[i-1], propertyName)
+		if err != nil || !ok {
+			errors = append(errors, missingPropertyError(i-1, propertyName, err))
 			continue
 		}
-		nextValue, ok := actual[i].(map[string]interface{})[propertyName]
-		if !ok {
-			errors = append(errors, ValidationError{Item: i, Property: propertyName, Message: "missing expected property", Expected: nil, Actual: nil})
+		nextValue, ok, err := lookupProperty(actual[i], propertyName)
+		if err != nil || !ok {
+			errors = append(errors, missingPropertyError(i, propertyName, err))
 			continue
 		}
 
-		// Compare current and next values
-		// TODO: Handle different types (e.g., strings, numbers)
-		currentFloat := currentValue.(float64)
-		nextFloat := nextValue.(float64)
+		comparison, err := compareOrderValues(currentValue, nextValue, options)
+		if err != nil {
+			errors = append(errors, ValidationError{
+				Item:     i,
+				Property: propertyName,
+				Message:  err.Error(),
+				Expected: currentValue,
+				Actual:   nextValue,
+			})
+			continue
+		}
 
 		var orderValid bool
 		if ascending {
-			orderValid = currentFloat <= nextFloat
+			orderValid = comparison <= 0
 		} else {
-			orderValid = currentFloat >= nextFloat
+			orderValid = comparison >= 0
 		}
 
 		if !orderValid {
@@ -527,7 +1175,7 @@ func validateOrdered(propertyName string, actual []interface{}, ascending bool)
 			errors = append(errors, ValidationError{
 				Item:     i,
 				Property: propertyName,
-				Message:  fmt.Sprintf("expected %v to be %s relative to %v", nextFloat, orderDirection, currentFloat),
+				Message:  fmt.Sprintf("expected %v to be %s relative to %v", nextValue, orderDirection, currentValue),
 				Expected: currentValue,
 				Actual:   nextValue,
 			})
@@ -535,3 +1183,51 @@ func validateOrdered(propertyName string, actual []interface{}, ascending bool)
 	}
 	return errors
 }
+
+// missingPropertyError reports a property that couldn't be found in an item, because of err, or because it was missing if err is nil.
+func missingPropertyError(item int, propertyName string, err error) ValidationError {
+	message := "missing expected property"
+	if err != nil {
+		message = err.Error()
+	}
+	return ValidationError{Item: item, Property: propertyName, Message: message, Expected: nil, Actual: nil}
+}
+
+// compareOrderValues compares two values of an ordered property, returning a negative number if left sorts before right, zero if they're equal, or a positive number otherwise.
+func compareOrderValues(left, right interface{}, options orderOptions) (int, error) {
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			return cmp.Compare(l, r), nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			if options.timestamps {
+				leftTime, leftErr := time.Parse(time.RFC3339Nano, l)
+				rightTime, rightErr := time.Parse(time.RFC3339Nano, r)
+				if leftErr == nil && rightErr == nil {
+					return leftTime.Compare(rightTime), nil
+				}
+			}
+			if options.ignoreCase {
+				return strings.Compare(strings.ToLower(l), strings.ToLower(r)), nil
+			}
+			return strings.Compare(l, r), nil
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			// false sorts before true
+			switch {
+			case l == r:
+				return 0, nil
+			case r:
+				return -1, nil
+			default:
+				return 1, nil
+			}
+		}
+	default:
+		return 0, fmt.Errorf("can't order values of type %T", left)
+	}
+	return 0, fmt.Errorf("can't order values of different types: %T and %T", left, right)
+}
@@ -0,0 +1,139 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package cleanup deletes the databases that integration test runs leave behind when they're interrupted before they can delete them.
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// DefaultPrefix starts the names of all the databases the integration tests create.
+const DefaultPrefix = "it_"
+
+// Database is a database in the account.
+type Database struct {
+	ID string
+
+	// LastModified is the database's "_ts", which for the databases the integration tests create is when they were created.
+	LastModified time.Time
+}
+
+// Client lists and deletes the databases of an account.
+type Client interface {
+	ListDatabases(ctx context.Context) ([]Database, error)
+	DeleteDatabase(ctx context.Context, id string) error
+}
+
+// Options control which databases Run deletes.
+type Options struct {
+	// Prefix is the prefix of the names of the databases to delete. It defaults to DefaultPrefix.
+	Prefix string
+
+	// OlderThan, if set, only deletes the databases last modified longer ago than this.
+	OlderThan time.Duration
+
+	// DryRun selects the databases to delete, but doesn't delete them.
+	DryRun bool
+
+	// Now is the time ages are measured from. It defaults to the current time.
+	Now time.Time
+
+	// Logf, if set, is called for each database deleted.
+	Logf func(format string, args ...interface{})
+}
+
+// Select returns the databases whose ID starts with prefix, and which were last modified longer ago than olderThan, if it's set.
+func Select(databases []Database, prefix string, olderThan time.Duration, now time.Time) []Database {
+	var selected []Database
+	for _, database := range databases {
+		if !strings.HasPrefix(database.ID, prefix) {
+			continue
+		}
+		if olderThan > 0 && now.Sub(database.LastModified) <= olderThan {
+			continue
+		}
+		selected = append(selected, database)
+	}
+	return selected
+}
+
+// Run deletes the databases selected by the options, and returns their IDs.
+// It carries on after failing to delete a database, and returns the errors for all the databases it failed to delete.
+func Run(ctx context.Context, client Client, options Options) ([]string, error) {
+	prefix := options.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	now := options.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	logf := options.Logf
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+
+	databases, err := client.ListDatabases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	var deleted []string
+	var errs []error
+	for _, database := range Select(databases, prefix, options.OlderThan, now) {
+		age := now.Sub(database.LastModified).Round(time.Second)
+		if options.DryRun {
+			logf("Would delete database %s (last modified %v ago)", database.ID, age)
+			deleted = append(deleted, database.ID)
+			continue
+		}
+		if err := client.DeleteDatabase(ctx, database.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete database %s: %w", database.ID, err))
+			continue
+		}
+		logf("Deleted database %s (last modified %v ago)", database.ID, age)
+		deleted = append(deleted, database.ID)
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// cosmosClient is the Client for a Cosmos DB account.
+type cosmosClient struct {
+	client *azcosmos.Client
+}
+
+// NewClient returns the Client for the account of a Cosmos DB client.
+func NewClient(client *azcosmos.Client) Client {
+	return cosmosClient{client}
+}
+
+func (c cosmosClient) ListDatabases(ctx context.Context) ([]Database, error) {
+	var databases []Database
+	pager := c.client.NewQueryDatabasesPager("SELECT * FROM c", nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, properties := range page.Databases {
+			databases = append(databases, Database{ID: properties.ID, LastModified: properties.LastModified})
+		}
+	}
+	return databases, nil
+}
+
+func (c cosmosClient) DeleteDatabase(ctx context.Context, id string) error {
+	database, err := c.client.NewDatabase(id)
+	if err != nil {
+		return err
+	}
+	_, err = database.Delete(ctx, nil)
+	return err
+}
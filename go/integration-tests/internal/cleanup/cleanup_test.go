@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClient is a Client for an account with the given databases.
+type fakeClient struct {
+	databases []Database
+	listErr   error
+
+	// deleteErrs are the errors to fail the deletion of databases with, by ID.
+	deleteErrs map[string]error
+	deleted    []string
+}
+
+func (c *fakeClient) ListDatabases(ctx context.Context) ([]Database, error) {
+	return c.databases, c.listErr
+}
+
+func (c *fakeClient) DeleteDatabase(ctx context.Context, id string) error {
+	if err := c.deleteErrs[id]; err != nil {
+		return err
+	}
+	c.deleted = append(c.deleted, id)
+	return nil
+}
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func testDatabases() []Database {
+	return []Database{
+		{ID: "it_order_by_abcdef", LastModified: now.Add(-2 * time.Hour)},
+		{ID: "it_run_1714564800_xyz", LastModified: now.Add(-10 * time.Minute)},
+		{ID: "SampleDB", LastModified: now.Add(-48 * time.Hour)},
+		{ID: "commit_it_later", LastModified: now.Add(-48 * time.Hour)},
+	}
+}
+
+func ids(databases []Database) []string {
+	var ids []string
+	for _, database := range databases {
+		ids = append(ids, database.ID)
+	}
+	return ids
+}
+
+func TestSelectByPrefix(t *testing.T) {
+	assert.Equal(t, []string{"it_order_by_abcdef", "it_run_1714564800_xyz"}, ids(Select(testDatabases(), DefaultPrefix, 0, now)))
+	assert.Equal(t, []string{"it_run_1714564800_xyz"}, ids(Select(testDatabases(), "it_run_", 0, now)))
+	assert.Empty(t, Select(testDatabases(), "missing_", 0, now))
+}
+
+func TestSelectByAge(t *testing.T) {
+	assert.Equal(t, []string{"it_order_by_abcdef"}, ids(Select(testDatabases(), DefaultPrefix, time.Hour, now)))
+	assert.Empty(t, Select(testDatabases(), DefaultPrefix, 2*time.Hour, now), "databases exactly as old as the limit are kept")
+	assert.Empty(t, Select(testDatabases(), DefaultPrefix, 24*time.Hour, now))
+}
+
+func TestRunDeletesSelectedDatabases(t *testing.T) {
+	client := &fakeClient{databases: testDatabases()}
+	var logged []string
+	deleted, err := Run(context.Background(), client, Options{Now: now, Logf: func(format string, args ...interface{}) {
+		logged = append(logged, format)
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"it_order_by_abcdef", "it_run_1714564800_xyz"}, deleted)
+	assert.Equal(t, deleted, client.deleted)
+	assert.Len(t, logged, 2)
+}
+
+func TestRunDryRun(t *testing.T) {
+	client := &fakeClient{databases: testDatabases()}
+	deleted, err := Run(context.Background(), client, Options{OlderThan: time.Hour, DryRun: true, Now: now})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"it_order_by_abcdef"}, deleted)
+	assert.Empty(t, client.deleted)
+}
+
+func TestRunContinuesAfterDeleteFailure(t *testing.T) {
+	deleteErr := errors.New("conflict")
+	client := &fakeClient{databases: testDatabases(), deleteErrs: map[string]error{"it_order_by_abcdef": deleteErr}}
+	deleted, err := Run(context.Background(), client, Options{Now: now})
+	assert.ErrorIs(t, err, deleteErr)
+	assert.ErrorContains(t, err, "it_order_by_abcdef")
+	assert.Equal(t, []string{"it_run_1714564800_xyz"}, deleted)
+}
+
+func TestRunListFailure(t *testing.T) {
+	listErr := errors.New("unauthorized")
+	_, err := Run(context.Background(), &fakeClient{listErr: listErr}, Options{})
+	assert.ErrorIs(t, err, listErr)
+}
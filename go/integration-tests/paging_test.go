@@ -0,0 +1,99 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validatePaging checks the query's paging fields: MaxItemCount, MinPages and MaxPages.
+func (query *QuerySpec) validatePaging() error {
+	if query.MaxItemCount < 0 {
+		return fmt.Errorf("maxItemCount must not be negative, but was %d", query.MaxItemCount)
+	}
+	if query.MinPages < 0 || query.MaxPages < 0 {
+		return fmt.Errorf("minPages and maxPages must not be negative, but were %d and %d", query.MinPages, query.MaxPages)
+	}
+	if query.MaxPages > 0 && query.MinPages > query.MaxPages {
+		return fmt.Errorf("minPages (%d) must not be greater than maxPages (%d)", query.MinPages, query.MaxPages)
+	}
+	return nil
+}
+
+// pageSizes returns the number of items in each page.
+// The pager for a query run by the client engine returns an empty page once the query is complete, which isn't included.
+func pageSizes(pages []azcosmos.QueryItemsResponse) []int {
+	sizes := make([]int, 0, len(pages))
+	for _, page := range pages {
+		sizes = append(sizes, len(page.Items))
+	}
+	if len(sizes) > 0 && sizes[len(sizes)-1] == 0 {
+		sizes = sizes[:len(sizes)-1]
+	}
+	return sizes
+}
+
+// checkPageShape checks the number of items in each page of the query's results against its MaxItemCount, MinPages and MaxPages.
+func checkPageShape(query QuerySpec, pageSizes []int) error {
+	if query.MinPages > 0 && len(pageSizes) < query.MinPages {
+		return fmt.Errorf("expected at least %d pages, but got %d (page sizes %v)", query.MinPages, len(pageSizes), pageSizes)
+	}
+	if query.MaxPages > 0 && len(pageSizes) > query.MaxPages {
+		return fmt.Errorf("expected at most %d pages, but got %d (page sizes %v)", query.MaxPages, len(pageSizes), pageSizes)
+	}
+	if query.MaxItemCount > 0 {
+		for i, size := range pageSizes {
+			if size > int(query.MaxItemCount) {
+				return fmt.Errorf("page %d has %d items, but maxItemCount is %d (page sizes %v)", i+1, size, query.MaxItemCount, pageSizes)
+			}
+		}
+	}
+	return nil
+}
+
+func TestPagingSpecParsing(t *testing.T) {
+	var query QuerySpec
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "q", "maxItemCount": 10, "minPages": 5, "maxPages": 7}`), &query))
+	assert.Equal(t, int32(10), query.MaxItemCount)
+	assert.Equal(t, 5, query.MinPages)
+	assert.Equal(t, 7, query.MaxPages)
+	assert.NoError(t, query.validatePaging())
+
+	// Each field is optional.
+	assert.NoError(t, (&QuerySpec{MinPages: 2}).validatePaging())
+	assert.NoError(t, (&QuerySpec{MaxItemCount: 1}).validatePaging())
+
+	assert.EqualError(t, (&QuerySpec{MaxItemCount: -1}).validatePaging(), "maxItemCount must not be negative, but was -1")
+	assert.EqualError(t, (&QuerySpec{MaxPages: -1}).validatePaging(), "minPages and maxPages must not be negative, but were 0 and -1")
+	assert.EqualError(t, (&QuerySpec{MinPages: 3, MaxPages: 2}).validatePaging(), "minPages (3) must not be greater than maxPages (2)")
+}
+
+func TestPageSizes(t *testing.T) {
+	page := func(n int) azcosmos.QueryItemsResponse {
+		return azcosmos.QueryItemsResponse{Items: make([][]byte, n)}
+	}
+	assert.Equal(t, []int{3, 2}, pageSizes([]azcosmos.QueryItemsResponse{page(3), page(2), page(0)}))
+	assert.Equal(t, []int{3, 0, 2}, pageSizes([]azcosmos.QueryItemsResponse{page(3), page(0), page(2)}))
+	assert.Empty(t, pageSizes([]azcosmos.QueryItemsResponse{page(0)}))
+	assert.Empty(t, pageSizes(nil))
+}
+
+func TestCheckPageShape(t *testing.T) {
+	query := QuerySpec{MaxItemCount: 10, MinPages: 2, MaxPages: 3}
+	assert.NoError(t, checkPageShape(query, []int{10, 10, 4}))
+	assert.NoError(t, checkPageShape(query, []int{10, 0}))
+	assert.EqualError(t, checkPageShape(query, []int{24}), "expected at least 2 pages, but got 1 (page sizes [24])")
+	assert.EqualError(t, checkPageShape(query, []int{10, 0, 0, 4}), "expected at most 3 pages, but got 4 (page sizes [10 0 0 4])")
+	assert.EqualError(t, checkPageShape(query, []int{10, 11}), "page 2 has 11 items, but maxItemCount is 10 (page sizes [10 11])")
+
+	// A query without paging fields accepts any pages.
+	assert.NoError(t, checkPageShape(QuerySpec{}, []int{1000}))
+	assert.NoError(t, checkPageShape(QuerySpec{}, nil))
+}
@@ -0,0 +1,187 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Headers of the query requests the SDK makes to a partition key range for the engine.
+const partitionKeyRangeIDHeader = "x-ms-documentdb-partitionkeyrangeid"
+const continuationHeader = "x-ms-continuation"
+const queryPlanRequestHeader = "x-ms-cosmos-is-query-plan-request"
+
+// PartitionRequest is a query request made to a partition key range, for the engine.
+type PartitionRequest struct {
+	PartitionKeyRangeID string `json:"pkrangeId"`
+
+	// Continuation is the continuation the partition was resumed from, which is "" for its first request.
+	Continuation string `json:"continuation,omitempty"`
+}
+
+// partitionRequestLog records the partition requests made with a context returned by withPartitionRequestLog.
+type partitionRequestLog struct {
+	mu       sync.Mutex
+	requests []PartitionRequest
+}
+
+type partitionRequestLogKey struct{}
+
+// withPartitionRequestLog returns a context whose partition requests are recorded by the log, when made by a client with a partitionRequestPolicy, or replayed from a fixture.
+func withPartitionRequestLog(ctx context.Context, log *partitionRequestLog) context.Context {
+	return context.WithValue(ctx, partitionRequestLogKey{}, log)
+}
+
+// recordPartitionRequest records a partition request with the log of the context, if it has one.
+func recordPartitionRequest(ctx context.Context, request PartitionRequest) {
+	log, ok := ctx.Value(partitionRequestLogKey{}).(*partitionRequestLog)
+	if !ok {
+		return
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.requests = append(log.requests, request)
+}
+
+// partitionRequestPolicy records the query requests made to a partition key range with the partitionRequestLog of their context, if they have one.
+// It runs once per call, so that retries of a request aren't counted as requests of their own. Query plan and partition key range requests aren't recorded,
+// nor are queries the gateway runs, which aren't made to a partition key range.
+type partitionRequestPolicy struct{}
+
+func (partitionRequestPolicy) Do(req *policy.Request) (*http.Response, error) {
+	header := req.Raw().Header
+	if id := header.Get(partitionKeyRangeIDHeader); id != "" && header.Get(queryPlanRequestHeader) == "" {
+		recordPartitionRequest(req.Raw().Context(), PartitionRequest{PartitionKeyRangeID: id, Continuation: header.Get(continuationHeader)})
+	}
+	return req.Next()
+}
+
+// partitionRequestCounts returns the number of requests made to each partition key range, and the partition key ranges, sorted.
+func partitionRequestCounts(requests []PartitionRequest) (map[string]int, []string) {
+	counts := make(map[string]int)
+	var ids []string
+	for _, request := range requests {
+		if counts[request.PartitionKeyRangeID] == 0 {
+			ids = append(ids, request.PartitionKeyRangeID)
+		}
+		counts[request.PartitionKeyRangeID]++
+	}
+	sort.Strings(ids)
+	return counts, ids
+}
+
+// checkPartitionRequests checks the requests the query made to each partition key range against its MaxRequestsPerPartition and ExpectedPartitions.
+func checkPartitionRequests(query QuerySpec, requests []PartitionRequest) error {
+	counts, ids := partitionRequestCounts(requests)
+	if query.ExpectedPartitions > 0 && len(ids) != query.ExpectedPartitions {
+		return fmt.Errorf("expected requests to %d partition key ranges, but %d were requested (%s)", query.ExpectedPartitions, len(ids), strings.Join(ids, ", "))
+	}
+	if query.MaxRequestsPerPartition > 0 {
+		for _, id := range ids {
+			if counts[id] <= query.MaxRequestsPerPartition {
+				continue
+			}
+			var continuations []string
+			for _, request := range requests {
+				if request.PartitionKeyRangeID == id {
+					continuations = append(continuations, fmt.Sprintf("%q", request.Continuation))
+				}
+			}
+			return fmt.Errorf("partition key range %s was requested %d times, more than maxRequestsPerPartition of %d (continuations %s)",
+				id, counts[id], query.MaxRequestsPerPartition, strings.Join(continuations, ", "))
+		}
+	}
+	return nil
+}
+
+// validatePartitionRequests checks that the query's MaxRequestsPerPartition and ExpectedPartitions aren't negative.
+func (query *QuerySpec) validatePartitionRequests() error {
+	if query.MaxRequestsPerPartition < 0 || query.ExpectedPartitions < 0 {
+		return fmt.Errorf("maxRequestsPerPartition and expectedPartitions must not be negative, but were %d and %d", query.MaxRequestsPerPartition, query.ExpectedPartitions)
+	}
+	return nil
+}
+
+// sendCanned sends a request with the headers through a pipeline with a partitionRequestPolicy, which cannedTransport answers.
+func sendCanned(t *testing.T, ctx context.Context, headers map[string]string) {
+	req, err := runtime.NewRequest(ctx, http.MethodPost, "https://localhost/dbs/db/colls/c/docs")
+	require.NoError(t, err)
+	for name, value := range headers {
+		req.Raw().Header.Set(name, value)
+	}
+	pipeline := runtime.NewPipeline("integrationtests", "v0.0.0", runtime.PipelineOptions{PerCall: []policy.Policy{partitionRequestPolicy{}}}, &policy.ClientOptions{Transport: cannedTransport{}})
+	_, err = pipeline.Do(req)
+	require.NoError(t, err)
+}
+
+func TestPartitionRequestPolicy(t *testing.T) {
+	log := &partitionRequestLog{}
+	ctx := withPartitionRequestLog(context.Background(), log)
+	sendCanned(t, ctx, map[string]string{partitionKeyRangeIDHeader: "0"})
+	sendCanned(t, ctx, map[string]string{partitionKeyRangeIDHeader: "1"})
+	sendCanned(t, ctx, map[string]string{partitionKeyRangeIDHeader: "0", continuationHeader: "token"})
+
+	// Query plan requests, requests without a partition key range, and requests without a log aren't recorded.
+	sendCanned(t, ctx, map[string]string{queryPlanRequestHeader: "True", partitionKeyRangeIDHeader: "0"})
+	sendCanned(t, ctx, map[string]string{continuationHeader: "token"})
+	sendCanned(t, context.Background(), map[string]string{partitionKeyRangeIDHeader: "2"})
+
+	assert.Equal(t, []PartitionRequest{
+		{PartitionKeyRangeID: "0"},
+		{PartitionKeyRangeID: "1"},
+		{PartitionKeyRangeID: "0", Continuation: "token"},
+	}, log.requests)
+}
+
+func TestCheckPartitionRequests(t *testing.T) {
+	requests := []PartitionRequest{
+		{PartitionKeyRangeID: "1"},
+		{PartitionKeyRangeID: "0"},
+		{PartitionKeyRangeID: "0", Continuation: "a"},
+		{PartitionKeyRangeID: "0", Continuation: "b"},
+	}
+	assert.NoError(t, checkPartitionRequests(QuerySpec{}, requests))
+	assert.NoError(t, checkPartitionRequests(QuerySpec{MaxRequestsPerPartition: 3, ExpectedPartitions: 2}, requests))
+	assert.EqualError(t, checkPartitionRequests(QuerySpec{MaxRequestsPerPartition: 2}, requests),
+		`partition key range 0 was requested 3 times, more than maxRequestsPerPartition of 2 (continuations "", "a", "b")`)
+	assert.EqualError(t, checkPartitionRequests(QuerySpec{ExpectedPartitions: 1}, requests),
+		"expected requests to 1 partition key ranges, but 2 were requested (0, 1)")
+
+	// A partition requested again from its start, such as one that was exhausted, counts against the limit too.
+	assert.Error(t, checkPartitionRequests(QuerySpec{MaxRequestsPerPartition: 1}, []PartitionRequest{{PartitionKeyRangeID: "0"}, {PartitionKeyRangeID: "0"}}))
+	assert.EqualError(t, checkPartitionRequests(QuerySpec{ExpectedPartitions: 1}, nil), "expected requests to 1 partition key ranges, but 0 were requested ()")
+}
+
+func TestValidatePartitionRequests(t *testing.T) {
+	assert.NoError(t, (&QuerySpec{MaxRequestsPerPartition: 1, ExpectedPartitions: 1}).validatePartitionRequests())
+	assert.EqualError(t, (&QuerySpec{MaxRequestsPerPartition: -1}).validatePartitionRequests(), "maxRequestsPerPartition and expectedPartitions must not be negative, but were -1 and 0")
+}
+
+func TestReplayedFixtureRecordsPartitionRequests(t *testing.T) {
+	fixture, err := loadFixture("testdata/order_by.fixture.json", orderByFixtureQuery)
+	require.NoError(t, err)
+
+	_, stats, err := replayQuery(orderByFixtureQuery, fixture)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []PartitionRequest{
+		{PartitionKeyRangeID: "partition0"},
+		{PartitionKeyRangeID: "partition1"},
+		{PartitionKeyRangeID: "partition2"},
+		{PartitionKeyRangeID: "partition0", Continuation: "1"},
+		{PartitionKeyRangeID: "partition1", Continuation: "1"},
+	}, stats.PartitionRequests)
+	assert.NoError(t, checkPartitionRequests(QuerySpec{MaxRequestsPerPartition: 2, ExpectedPartitions: 3}, stats.PartitionRequests))
+	assert.Error(t, checkPartitionRequests(QuerySpec{MaxRequestsPerPartition: 1}, stats.PartitionRequests))
+}
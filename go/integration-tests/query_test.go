@@ -4,21 +4,149 @@
 package integrationtests
 
 import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestOrderBy(t *testing.T) {
-	runIntegrationTest(t, "order_by.json")
+// QuerySetsEnvVar, if set, is a comma-separated list of the query sets to run, such as "order_by,vector*".
+// Query sets are named after their file in baselines/queries, without the ".json" extension, and can be matched by a pattern (see path.Match).
+const QuerySetsEnvVar = "COSMOSCX_QUERY_SETS"
+
+// SkipQuerySetsEnvVar, if set, is a comma-separated list of the query sets not to run, in the same form as QuerySetsEnvVar.
+const SkipQuerySetsEnvVar = "COSMOSCX_SKIP_QUERY_SETS"
+
+// TestQuerySets runs every query set in baselines/queries, each as a subtest named after its file.
+func TestQuerySets(t *testing.T) {
+	querySets, err := discoverQuerySets(path.Join("..", "..", "baselines", "queries"), os.Getenv(QuerySetsEnvVar), os.Getenv(SkipQuerySetsEnvVar))
+	require.NoError(t, err)
+	for _, querySet := range querySets {
+		t.Run(querySetName(querySet), func(t *testing.T) {
+			defer recoverPanic(t)
+			runIntegrationTest(t, querySet)
+		})
+	}
+
+	if reportPath := os.Getenv(ReportEnvVar); reportPath != "" {
+		require.NoError(t, runReport.write(reportPath))
+		t.Logf("Wrote a report of %d queries to %s", len(runReport.Queries), reportPath)
+	}
+}
+
+// discoverQuerySets returns the file names of the query sets in dir, sorted, filtered by the include and skip lists (see QuerySetsEnvVar and SkipQuerySetsEnvVar).
+// It fails if a pattern in the include list matches no query set, to catch typos.
+func discoverQuerySets(dir string, include string, skip string) ([]string, error) {
+	files, err := filepath.Glob(path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no query sets found in %s", dir)
+	}
+
+	includePatterns, err := parseQuerySetPatterns(include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", QuerySetsEnvVar, err)
+	}
+	skipPatterns, err := parseQuerySetPatterns(skip)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", SkipQuerySetsEnvVar, err)
+	}
+
+	used := make(map[string]bool, len(includePatterns))
+	querySets := make([]string, 0, len(files))
+	for _, file := range files {
+		fileName := path.Base(file)
+		name := querySetName(fileName)
+		included := len(includePatterns) == 0
+		for _, pattern := range includePatterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				included = true
+				used[pattern] = true
+			}
+		}
+		for _, pattern := range skipPatterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				included = false
+			}
+		}
+		if included {
+			querySets = append(querySets, fileName)
+		}
+	}
+
+	for _, pattern := range includePatterns {
+		if !used[pattern] {
+			return nil, fmt.Errorf("%s includes '%s', which matches no query set in %s", QuerySetsEnvVar, pattern, dir)
+		}
+	}
+	sort.Strings(querySets)
+	return querySets, nil
 }
 
-func TestAggregates(t *testing.T) {
-	runIntegrationTest(t, "aggregates.json")
+// parseQuerySetPatterns parses a comma-separated list of query set names or patterns, ignoring empty entries and surrounding whitespace.
+func parseQuerySetPatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSuffix(strings.TrimSpace(pattern), ".json")
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("pattern '%s': %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
 }
 
-func TestVectorQuery(t *testing.T) {
-	runIntegrationTest(t, "vector.json")
+// querySetName returns the name of a query set, which is its file name without the ".json" extension.
+func querySetName(fileName string) string {
+	return strings.TrimSuffix(path.Base(fileName), ".json")
 }
 
-func TestHybridQuery(t *testing.T) {
-	runIntegrationTest(t, "hybrid.json")
+func TestDiscoverQuerySets(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"order_by.json", "vector.json", "small_vector.json", "aggregates.json", "notes.txt"} {
+		require.NoError(t, os.WriteFile(path.Join(dir, name), []byte("{}"), 0o644))
+	}
+	// Results directories aren't query sets.
+	require.NoError(t, os.MkdirAll(path.Join(dir, "order_by"), 0o755))
+
+	querySets, err := discoverQuerySets(dir, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aggregates.json", "order_by.json", "small_vector.json", "vector.json"}, querySets)
+
+	querySets, err = discoverQuerySets(dir, "order_by, *vector", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order_by.json", "small_vector.json", "vector.json"}, querySets)
+
+	querySets, err = discoverQuerySets(dir, "", "small_*,aggregates.json")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order_by.json", "vector.json"}, querySets)
+
+	querySets, err = discoverQuerySets(dir, "*vector", "small_vector")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vector.json"}, querySets)
+}
+
+func TestDiscoverQuerySetsRejectsInvalidLists(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "order_by.json"), []byte("{}"), 0o644))
+
+	_, err := discoverQuerySets(dir, "order_by,orderby", "")
+	assert.ErrorContains(t, err, "COSMOSCX_QUERY_SETS includes 'orderby', which matches no query set")
+
+	_, err = discoverQuerySets(dir, "[", "")
+	assert.ErrorContains(t, err, "invalid COSMOSCX_QUERY_SETS: pattern '['")
+
+	_, err = discoverQuerySets(t.TempDir(), "", "")
+	assert.ErrorContains(t, err, "no query sets found")
 }
@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// matchRanked matches the expected and actual items of a ranked query, such as an ORDER BY RANK query, whose tied items can be returned in any order.
+// Items are matched by key (see unorderedKey), and each actual item must be within tolerance places of the expected item it's matched with.
+// Within tolerance places of either end of the results, an item may also be missing from the other results, since a tie at the cutoff of a TOP, OFFSET, or LIMIT can select either item.
+// It returns the matched expected and actual items, in the order they were returned, and a validation error for each item that was misranked or left unmatched.
+func matchRanked(expected, actual []interface{}, tolerance int) ([]interface{}, []interface{}, []ValidationError) {
+	positions := make(map[string][]int, len(expected))
+	for i, item := range expected {
+		key := unorderedKey(item)
+		positions[key] = append(positions[key], i)
+	}
+	nearEnd := func(i, count int) bool {
+		return i < tolerance || i >= count-tolerance
+	}
+
+	var errors []ValidationError
+	matched := make([]bool, len(expected))
+	pairedExpected := make([]interface{}, 0, len(actual))
+	pairedActual := make([]interface{}, 0, len(actual))
+	for i, item := range actual {
+		// Match the closest unmatched expected item with the same key.
+		best := -1
+		for _, j := range positions[unorderedKey(item)] {
+			if !matched[j] && (best == -1 || abs(i-j) < abs(i-best)) {
+				best = j
+			}
+		}
+		switch {
+		case best == -1 && nearEnd(i, len(actual)):
+		case best == -1:
+			errors = append(errors, ValidationError{Item: i, Property: "<item>", Message: "actual item not found in expected results", Actual: item})
+		case abs(i-best) > tolerance:
+			matched[best] = true
+			errors = append(errors, ValidationError{Item: i, Property: "<item>", Message: fmt.Sprintf("item ranked at %d, but expected at %d", i, best), Expected: expected[best], Actual: item})
+		default:
+			matched[best] = true
+			pairedExpected = append(pairedExpected, expected[best])
+			pairedActual = append(pairedActual, item)
+		}
+	}
+	for j, item := range expected {
+		if !matched[j] && !nearEnd(j, len(expected)) {
+			errors = append(errors, ValidationError{Item: j, Property: "<item>", Message: "expected item not found in actual results", Expected: item})
+		}
+	}
+	return pairedExpected, pairedActual, errors
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// ranked returns items with an "index" property for each of the indexes, like the results of the hybrid search queries.
+func ranked(indexes ...float64) []interface{} {
+	items := make([]interface{}, 0, len(indexes))
+	for _, index := range indexes {
+		items = append(items, map[string]interface{}{"index": index, "title": fmt.Sprint(index)})
+	}
+	return items
+}
+
+func TestMatchRankedAllowsTiesWithinTolerance(t *testing.T) {
+	expected := ranked(1, 2, 3, 4, 5)
+	pairedExpected, pairedActual, errors := matchRanked(expected, ranked(2, 1, 3, 5, 4), 1)
+	assert.Empty(t, errors)
+	assert.Equal(t, ranked(2, 1, 3, 5, 4), pairedExpected)
+	assert.Equal(t, pairedExpected, pairedActual)
+
+	// Without a tolerance, the order must match exactly.
+	_, _, errors = matchRanked(expected, ranked(2, 1, 3, 4, 5), 0)
+	require.Len(t, errors, 2)
+	assert.Equal(t, "item ranked at 0, but expected at 1", errors[0].Message)
+	assert.Equal(t, "item ranked at 1, but expected at 0", errors[1].Message)
+	_, _, errors = matchRanked(expected, expected, 0)
+	assert.Empty(t, errors)
+}
+
+func TestMatchRankedReportsMisrankedItems(t *testing.T) {
+	expected := ranked(1, 2, 3, 4, 5, 6)
+	_, _, errors := matchRanked(expected, ranked(4, 2, 3, 1, 5, 6), 1)
+	require.Len(t, errors, 2)
+	assert.Equal(t, 0, errors[0].Item)
+	assert.Equal(t, "item ranked at 0, but expected at 3", errors[0].Message)
+	assert.Equal(t, "item ranked at 3, but expected at 0", errors[1].Message)
+}
+
+func TestMatchRankedAllowsTiesAtTheCutoff(t *testing.T) {
+	// Item 6 tied with item 5 at the cutoff of a TOP 5, and was selected instead.
+	expected := ranked(1, 2, 3, 4, 5)
+	pairedExpected, pairedActual, errors := matchRanked(expected, ranked(1, 2, 3, 4, 6), 1)
+	assert.Empty(t, errors)
+	assert.Equal(t, ranked(1, 2, 3, 4), pairedExpected)
+	assert.Equal(t, ranked(1, 2, 3, 4), pairedActual)
+
+	// Likewise at the start of the results, after an OFFSET.
+	_, _, errors = matchRanked(expected, ranked(0, 2, 3, 4, 5), 1)
+	assert.Empty(t, errors)
+
+	// But not in the middle.
+	_, _, errors = matchRanked(expected, ranked(1, 2, 7, 4, 5), 1)
+	require.Len(t, errors, 2)
+	assert.Equal(t, "actual item not found in expected results", errors[0].Message)
+	assert.Equal(t, "expected item not found in actual results", errors[1].Message)
+	assert.Equal(t, 2, errors[1].Item)
+}
@@ -0,0 +1,289 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ReportEnvVar, if set, is the path of a JSON report of the request charge, pages, and duration of every query run by TestQuerySets.
+const ReportEnvVar = "COSMOSCX_IT_REPORT"
+
+// requestChargeHeader is the response header holding the request units a request consumed.
+const requestChargeHeader = "x-ms-request-charge"
+
+// QueryStats describes how a query ran.
+type QueryStats struct {
+	Query string `json:"query"`
+
+	// PageSizes is the number of items in each page (see pageSizes).
+	PageSizes []int `json:"pageSizes"`
+
+	// PageCharges is the request charge of each page, in request units, including the query plan and partition key range requests for the first page.
+	PageCharges []float64 `json:"pageCharges"`
+
+	// TotalRU is the request charge of the whole query, in request units.
+	TotalRU float64 `json:"totalRU"`
+
+	// Requests is the number of requests made to the service, including retries.
+	Requests int `json:"requests"`
+
+	// PartitionRequests are the query requests made to each partition key range, in the order they were made, not counting retries (see partitionRequestPolicy).
+	PartitionRequests []PartitionRequest `json:"partitionRequests,omitempty"`
+
+	// Duration is the wall time the query took.
+	Duration time.Duration `json:"-"`
+
+	// Validation is what the results were validated against: ValidationBaseline or ValidationGateway.
+	Validation string `json:"validation,omitempty"`
+
+	// Skipped, if set, is the unmet requirement the query was skipped for, in which case it didn't run (see Requirements).
+	Skipped string `json:"skipped,omitempty"`
+}
+
+func (s QueryStats) MarshalJSON() ([]byte, error) {
+	type stats QueryStats
+	return json.Marshal(struct {
+		stats
+		DurationMs float64 `json:"durationMs"`
+	}{stats(s), float64(s.Duration) / float64(time.Millisecond)})
+}
+
+func (s QueryStats) String() string {
+	summary := fmt.Sprintf("%d pages, %d requests, %.2f RU (per page: %v), %s", len(s.PageSizes), s.Requests, s.TotalRU, s.PageCharges, s.Duration.Round(time.Millisecond))
+	if s.Validation != "" {
+		summary += ", validated against the " + s.Validation
+	}
+	return summary
+}
+
+// foldPageCharges returns the charges of the first pages, adding the charges of any later pages, such as the empty page that ends a query (see pageSizes), to the last of them.
+func foldPageCharges(charges []float64, pages int) []float64 {
+	if len(charges) <= pages || pages == 0 {
+		return charges[:min(pages, len(charges))]
+	}
+	folded := append([]float64(nil), charges[:pages]...)
+	for _, charge := range charges[pages:] {
+		folded[pages-1] += charge
+	}
+	return folded
+}
+
+// checkRequestCharge fails if the query consumed more than its MaxRU.
+func checkRequestCharge(query QuerySpec, stats QueryStats) error {
+	if query.MaxRU > 0 && stats.TotalRU > query.MaxRU {
+		return fmt.Errorf("query consumed %.2f RU, more than its maxRU of %.2f", stats.TotalRU, query.MaxRU)
+	}
+	return nil
+}
+
+// parseRequestCharge returns the request charge in the response headers, and whether there was one.
+func parseRequestCharge(header http.Header) (float64, bool, error) {
+	value := header.Get(requestChargeHeader)
+	if value == "" {
+		return 0, false, nil
+	}
+	charge, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s header '%s': %w", requestChargeHeader, value, err)
+	}
+	return charge, true, nil
+}
+
+// chargeRecorder accumulates the request charges of the requests made with a context returned by withChargeRecorder.
+type chargeRecorder struct {
+	mu          sync.Mutex
+	requests    int
+	total       float64
+	pageStart   float64
+	pageCharges []float64
+}
+
+type chargeRecorderKey struct{}
+
+// withChargeRecorder returns a context whose requests' charges are recorded by the recorder, when made by a client with a requestChargePolicy.
+func withChargeRecorder(ctx context.Context, recorder *chargeRecorder) context.Context {
+	return context.WithValue(ctx, chargeRecorderKey{}, recorder)
+}
+
+func (r *chargeRecorder) record(charge float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	r.total += charge
+}
+
+// endPage records the charge of the requests made since the previous page as the charge of a page. It does nothing if the recorder is nil.
+func (r *chargeRecorder) endPage() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pageCharges = append(r.pageCharges, r.total-r.pageStart)
+	r.pageStart = r.total
+}
+
+// requestChargePolicy records the request charge of each response with the chargeRecorder of its request's context, if it has one.
+type requestChargePolicy struct{}
+
+func (requestChargePolicy) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	recorder, ok := req.Raw().Context().Value(chargeRecorderKey{}).(*chargeRecorder)
+	if !ok || resp == nil {
+		return resp, err
+	}
+	// The service always reports a numeric charge, so a malformed header is counted as free rather than failing the request.
+	charge, _, _ := parseRequestCharge(resp.Header)
+	recorder.record(charge)
+	return resp, err
+}
+
+// queryReport aggregates the statistics of the queries in a run, for ReportEnvVar.
+type queryReport struct {
+	mu      sync.Mutex
+	Queries []QueryStats `json:"queries"`
+	TotalRU float64      `json:"totalRU"`
+}
+
+// runReport is the report of the queries run by TestQuerySets.
+var runReport = &queryReport{}
+
+func (r *queryReport) add(stats QueryStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Queries = append(r.Queries, stats)
+	r.TotalRU += stats.TotalRU
+}
+
+// write writes the report as indented JSON to reportPath.
+func (r *queryReport) write(reportPath string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Queries == nil {
+		r.Queries = []QueryStats{}
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(reportPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, data, 0o644)
+}
+
+func TestParseRequestCharge(t *testing.T) {
+	header := http.Header{}
+	_, found, err := parseRequestCharge(header)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	header.Set(requestChargeHeader, "2.86")
+	charge, found, err := parseRequestCharge(header)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 2.86, charge)
+
+	header.Set(requestChargeHeader, "lots")
+	_, _, err = parseRequestCharge(header)
+	assert.EqualError(t, err, `invalid x-ms-request-charge header 'lots': strconv.ParseFloat: parsing "lots": invalid syntax`)
+}
+
+func TestChargeRecorderSplitsPages(t *testing.T) {
+	recorder := &chargeRecorder{}
+	recorder.record(1)
+	recorder.record(2.5)
+	recorder.endPage()
+	recorder.record(3)
+	recorder.endPage()
+	recorder.endPage()
+	assert.Equal(t, 3, recorder.requests)
+	assert.Equal(t, 6.5, recorder.total)
+	assert.Equal(t, []float64{3.5, 3, 0}, recorder.pageCharges)
+
+	// A nil recorder ignores pages, so that readPages can be used without one.
+	var none *chargeRecorder
+	none.endPage()
+}
+
+// cannedTransport returns a response with the given request charge header to every request.
+type cannedTransport struct {
+	charge string
+}
+
+func (c cannedTransport) Do(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	if c.charge != "" {
+		header.Set(requestChargeHeader, c.charge)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: http.NoBody, Request: req}, nil
+}
+
+func TestRequestChargePolicy(t *testing.T) {
+	recorder := &chargeRecorder{}
+	send := func(ctx context.Context, charge string) {
+		req, err := runtime.NewRequest(ctx, http.MethodGet, "https://localhost/dbs")
+		require.NoError(t, err)
+		pipeline := runtime.NewPipeline("integrationtests", "v0.0.0", runtime.PipelineOptions{PerRetry: []policy.Policy{requestChargePolicy{}}}, &policy.ClientOptions{Transport: cannedTransport{charge}})
+		_, err = pipeline.Do(req)
+		require.NoError(t, err)
+	}
+	ctx := withChargeRecorder(context.Background(), recorder)
+	send(ctx, "1.5")
+	send(ctx, "")
+	send(context.Background(), "100")
+	assert.Equal(t, 2, recorder.requests)
+	assert.Equal(t, 1.5, recorder.total)
+}
+
+func TestQueryReportWrite(t *testing.T) {
+	report := &queryReport{}
+	reportPath := path.Join(t.TempDir(), "reports", "it.json")
+	require.NoError(t, report.write(reportPath))
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"queries": [], "totalRU": 0}`, string(data))
+
+	report.add(QueryStats{Query: "count_all", PageSizes: []int{1}, PageCharges: []float64{3.5}, TotalRU: 3.5, Requests: 3, Duration: 1500 * time.Microsecond})
+	report.add(QueryStats{Query: "streaming_1", PageSizes: []int{10, 4}, PageCharges: []float64{5, 2}, TotalRU: 7, Requests: 5, Duration: 20 * time.Millisecond, Validation: ValidationGateway})
+	require.NoError(t, report.write(reportPath))
+	data, err = os.ReadFile(reportPath)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"queries": [
+			{"query": "count_all", "pageSizes": [1], "pageCharges": [3.5], "totalRU": 3.5, "requests": 3, "durationMs": 1.5},
+			{"query": "streaming_1", "pageSizes": [10, 4], "pageCharges": [5, 2], "totalRU": 7, "requests": 5, "durationMs": 20, "validation": "gateway"}
+		],
+		"totalRU": 10.5
+	}`, string(data))
+}
+
+func TestFoldPageCharges(t *testing.T) {
+	assert.Equal(t, []float64{1, 2}, foldPageCharges([]float64{1, 2}, 2))
+	assert.Equal(t, []float64{1, 2.5}, foldPageCharges([]float64{1, 2, 0.5}, 2))
+	assert.Equal(t, []float64{}, foldPageCharges([]float64{3}, 0))
+	assert.Empty(t, foldPageCharges(nil, 0))
+}
+
+func TestCheckRequestCharge(t *testing.T) {
+	stats := QueryStats{TotalRU: 12.5}
+	assert.NoError(t, checkRequestCharge(QuerySpec{}, stats))
+	assert.NoError(t, checkRequestCharge(QuerySpec{MaxRU: 20}, stats))
+	assert.EqualError(t, checkRequestCharge(QuerySpec{MaxRU: 10}, stats), "query consumed 12.50 RU, more than its maxRU of 10.00")
+}
@@ -0,0 +1,395 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/emulator"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// EnvironmentEnvVar overrides the environment the integration tests detect from the endpoint: "emulator" or "cloud".
+// Set it to "emulator" for an emulator that isn't on this machine, such as in another container.
+const EnvironmentEnvVar = "COSMOSCX_IT_ENVIRONMENT"
+
+// The environments a query can require.
+const EnvironmentEmulator = "emulator"
+const EnvironmentCloud = "cloud"
+
+// The features a query can require, which are probed once per run by creating a container that uses them (see featureProbes).
+const FeatureFullTextSearch = "fullTextSearch"
+const FeatureVectorSearch = "vectorSearch"
+
+// serviceVersionHeader is the response header with the version of the service, such as "version=2.14.0.0", which is the emulator's version.
+const serviceVersionHeader = "x-ms-serviceversion"
+
+// Requirements are what a query needs from the account to run. Queries whose requirements aren't met are skipped, with the unmet requirement.
+type Requirements struct {
+	// Environment, if set, is the only environment the query runs in: EnvironmentEmulator or EnvironmentCloud.
+	Environment string `json:"environment"`
+
+	// MinEmulatorVersion, if set, is the oldest emulator the query runs against, such as "2.14.16". It doesn't apply to other accounts.
+	MinEmulatorVersion string `json:"minEmulatorVersion"`
+
+	// Features are the features the account must support, such as FeatureFullTextSearch.
+	Features []string `json:"features"`
+}
+
+// testEnvironment is what the integration tests are running against.
+type testEnvironment struct {
+	// Name is EnvironmentEmulator or EnvironmentCloud.
+	Name string
+
+	// EmulatorVersion is the version the emulator reports, or "" if it's unknown or the account isn't the emulator.
+	EmulatorVersion string
+}
+
+// featureSupport returns nil if the account supports a feature, or the reason it doesn't.
+type featureSupport func(feature string) error
+
+// validate checks that the requirements name known environments and features, and a valid version.
+func (r *Requirements) validate() error {
+	if r == nil {
+		return nil
+	}
+	switch r.Environment {
+	case "", EnvironmentEmulator, EnvironmentCloud:
+	default:
+		return fmt.Errorf("unknown environment '%s', expected '%s' or '%s'", r.Environment, EnvironmentEmulator, EnvironmentCloud)
+	}
+	if r.MinEmulatorVersion != "" {
+		if r.Environment == EnvironmentCloud {
+			return fmt.Errorf("minEmulatorVersion can't be set for queries that require the '%s' environment", EnvironmentCloud)
+		}
+		if _, err := parseVersion(r.MinEmulatorVersion); err != nil {
+			return fmt.Errorf("invalid minEmulatorVersion: %w", err)
+		}
+	}
+	for _, feature := range r.Features {
+		if _, ok := featureProbes[feature]; !ok {
+			return fmt.Errorf("unknown feature '%s'", feature)
+		}
+	}
+	return nil
+}
+
+// unmet returns the first requirement the environment doesn't meet, or "" if it meets them all.
+// Features are only checked once the environment and version are, since checking them may create a container.
+func (r *Requirements) unmet(environment testEnvironment, supports featureSupport) string {
+	if r == nil {
+		return ""
+	}
+	if r.Environment != "" && r.Environment != environment.Name {
+		return fmt.Sprintf("the %s environment, but the tests are running against the %s", r.Environment, environment.Name)
+	}
+	if r.MinEmulatorVersion != "" && environment.Name == EnvironmentEmulator {
+		if environment.EmulatorVersion == "" {
+			return fmt.Sprintf("emulator version %s or later, but the emulator's version is unknown", r.MinEmulatorVersion)
+		}
+		if compareVersions(environment.EmulatorVersion, r.MinEmulatorVersion) < 0 {
+			return fmt.Sprintf("emulator version %s or later, but the emulator is version %s", r.MinEmulatorVersion, environment.EmulatorVersion)
+		}
+	}
+	for _, feature := range r.Features {
+		if err := supports(feature); err != nil {
+			return fmt.Sprintf("the %s feature, which the account doesn't support: %v", feature, err)
+		}
+	}
+	return ""
+}
+
+// parseVersion parses a dotted version, such as "2.14.0.0".
+func parseVersion(version string) ([]int, error) {
+	parts := strings.Split(version, ".")
+	numbers := make([]int, 0, len(parts))
+	for _, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("'%s' is not a dotted version, such as 2.14.0", version)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+// compareVersions compares two dotted versions, treating missing parts as 0, so that "2.14" equals "2.14.0.0".
+// Versions that can't be parsed compare as older than any other.
+func compareVersions(a, b string) int {
+	aParts, aErr := parseVersion(a)
+	bParts, bErr := parseVersion(b)
+	switch {
+	case aErr != nil && bErr != nil:
+		return 0
+	case aErr != nil:
+		return -1
+	case bErr != nil:
+		return 1
+	}
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		if aPart != bPart {
+			if aPart < bPart {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseServiceVersion returns the version in a service version header, such as "version=2.14.0.0", or "" if there is none.
+func parseServiceVersion(header string) string {
+	for _, part := range strings.Split(header, ";") {
+		if version, ok := strings.CutPrefix(strings.TrimSpace(part), "version="); ok {
+			return version
+		}
+	}
+	return ""
+}
+
+// detectEnvironmentName returns the environment, from the override if set (see EnvironmentEnvVar), or otherwise from the endpoint.
+func detectEnvironmentName(endpoint, override string) (string, error) {
+	switch override {
+	case "":
+		if emulator.IsLocalEndpoint(endpoint) {
+			return EnvironmentEmulator, nil
+		}
+		return EnvironmentCloud, nil
+	case EnvironmentEmulator, EnvironmentCloud:
+		return override, nil
+	default:
+		return "", fmt.Errorf("invalid %s '%s', expected '%s' or '%s'", EnvironmentEnvVar, override, EnvironmentEmulator, EnvironmentCloud)
+	}
+}
+
+// environmentCache holds the environment of the test run, which is detected by the first query set that needs it.
+type environmentCache struct {
+	mu          sync.Mutex
+	environment *testEnvironment
+}
+
+var runEnvironment environmentCache
+
+// get returns the environment of the test run, detecting it if needed.
+// The emulator's version is read from the response to listing the databases, which is a cheap request.
+func (c *environmentCache) get(ctx context.Context, client *azcosmos.Client, endpoint string) (testEnvironment, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.environment != nil {
+		return *c.environment, nil
+	}
+
+	name, err := detectEnvironmentName(endpoint, os.Getenv(EnvironmentEnvVar))
+	if err != nil {
+		return testEnvironment{}, err
+	}
+	environment := testEnvironment{Name: name}
+	if name == EnvironmentEmulator {
+		page, err := client.NewQueryDatabasesPager("SELECT VALUE COUNT(1) FROM c", nil).NextPage(ctx)
+		if err != nil {
+			return testEnvironment{}, fmt.Errorf("failed to read the emulator's version: %w", err)
+		}
+		if page.RawResponse != nil {
+			environment.EmulatorVersion = parseServiceVersion(page.RawResponse.Header.Get(serviceVersionHeader))
+		}
+	}
+	c.environment = &environment
+	return environment, nil
+}
+
+// featureProbes are the properties of the containers that probe whether the account supports each feature, by their ID, and the checks that they were created with the feature.
+var featureProbes = map[string]struct {
+	container func(id string) azcosmos.ContainerProperties
+	check     func(requested azcosmos.ContainerProperties, created *azcosmos.ContainerProperties, createErr error) error
+}{
+	FeatureFullTextSearch: {
+		container: func(id string) azcosmos.ContainerProperties {
+			return azcosmos.ContainerProperties{
+				ID:                     id,
+				PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{Paths: []string{"/pk"}},
+				FullTextPolicy:         &azcosmos.FullTextPolicy{DefaultLanguage: "en-US", FullTextPaths: []azcosmos.FullTextPath{{Path: "/text", Language: "en-US"}}},
+				IndexingPolicy:         &azcosmos.IndexingPolicy{FullTextIndexes: []azcosmos.FullTextIndex{{Path: "/text"}}},
+			}
+		},
+		check: checkCreatedFullTextPolicy,
+	},
+	FeatureVectorSearch: {
+		container: func(id string) azcosmos.ContainerProperties {
+			return azcosmos.ContainerProperties{
+				ID:                     id,
+				PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{Paths: []string{"/pk"}},
+				VectorEmbeddingPolicy: &azcosmos.VectorEmbeddingPolicy{VectorEmbeddings: []azcosmos.VectorEmbedding{
+					{Path: "/embedding", DataType: azcosmos.VectorDataTypeFloat32, DistanceFunction: azcosmos.VectorDistanceFunctionCosine, Dimensions: 2},
+				}},
+				IndexingPolicy: &azcosmos.IndexingPolicy{VectorIndexes: []azcosmos.VectorIndex{{Path: "/embedding", Type: azcosmos.VectorIndexTypeFlat}}},
+			}
+		},
+		check: checkCreatedVectorPolicy,
+	},
+}
+
+// featureCache holds the results of the feature probes of the test run, since every query set uses the same account.
+type featureCache struct {
+	mu      sync.Mutex
+	results map[string]error
+}
+
+var runFeatures featureCache
+
+// supports returns nil if the account supports the feature, or the reason it doesn't.
+// The first call for a feature probes it by creating, then deleting, a container with the given ID in the database.
+func (c *featureCache) supports(ctx context.Context, database *azcosmos.DatabaseClient, containerID string, feature string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if result, ok := c.results[feature]; ok {
+		return result
+	}
+
+	probe := featureProbes[feature]
+	requested := probe.container(containerID)
+	response, createErr := database.CreateContainer(ctx, requested, nil)
+	if createErr == nil {
+		defer deleteContainer(ctx, database, containerID)
+	}
+	result := probe.check(requested, response.ContainerProperties, createErr)
+	if c.results == nil {
+		c.results = make(map[string]error)
+	}
+	c.results[feature] = result
+	return result
+}
+
+// evaluateRequirements returns the unmet requirement of each query that has one, by query name.
+func (queryContext *QueryContext) evaluateRequirements(environment testEnvironment, supports featureSupport) map[string]string {
+	skipped := make(map[string]string)
+	for _, query := range queryContext.Query.Queries {
+		if reason := query.Requires.unmet(environment, supports); reason != "" {
+			skipped[query.Name] = reason
+		}
+	}
+	return skipped
+}
+
+// containerUnused reports whether every query that uses a container is skipped, in which case the container isn't created,
+// since it may need the features they lack.
+func (queryContext *QueryContext) containerUnused(containerID string) bool {
+	used := false
+	for _, query := range queryContext.Query.Queries {
+		if query.Container != containerID {
+			continue
+		}
+		if _, skipped := queryContext.Skipped[query.Name]; !skipped {
+			return false
+		}
+		used = true
+	}
+	return used
+}
+
+func TestRequirementsValidate(t *testing.T) {
+	var none *Requirements
+	assert.NoError(t, none.validate())
+	assert.NoError(t, (&Requirements{Environment: EnvironmentCloud, Features: []string{FeatureFullTextSearch}}).validate())
+	assert.NoError(t, (&Requirements{MinEmulatorVersion: "2.14.16"}).validate())
+	assert.ErrorContains(t, (&Requirements{Environment: "staging"}).validate(), "unknown environment 'staging'")
+	assert.ErrorContains(t, (&Requirements{MinEmulatorVersion: "2.x"}).validate(), "invalid minEmulatorVersion")
+	assert.ErrorContains(t, (&Requirements{Environment: EnvironmentCloud, MinEmulatorVersion: "2.14"}).validate(), "minEmulatorVersion can't be set")
+	assert.ErrorContains(t, (&Requirements{Features: []string{"changeFeed"}}).validate(), "unknown feature 'changeFeed'")
+}
+
+func TestRequirementsUnmet(t *testing.T) {
+	probed := []string{}
+	supports := func(feature string) error {
+		probed = append(probed, feature)
+		if feature == FeatureFullTextSearch {
+			return fmt.Errorf("the emulator doesn't support full-text search")
+		}
+		return nil
+	}
+	emulator := testEnvironment{Name: EnvironmentEmulator, EmulatorVersion: "2.14.16.0"}
+	cloud := testEnvironment{Name: EnvironmentCloud}
+
+	var none *Requirements
+	assert.Equal(t, "", none.unmet(emulator, supports))
+
+	assert.Equal(t, "", (&Requirements{Environment: EnvironmentEmulator}).unmet(emulator, supports))
+	assert.Equal(t, "the cloud environment, but the tests are running against the emulator", (&Requirements{Environment: EnvironmentCloud}).unmet(emulator, supports))
+
+	assert.Equal(t, "", (&Requirements{MinEmulatorVersion: "2.14.16"}).unmet(emulator, supports))
+	assert.Equal(t, "emulator version 2.14.20 or later, but the emulator is version 2.14.16.0", (&Requirements{MinEmulatorVersion: "2.14.20"}).unmet(emulator, supports))
+	assert.Equal(t, "", (&Requirements{MinEmulatorVersion: "99"}).unmet(cloud, supports), "the emulator version doesn't apply to other accounts")
+	assert.Contains(t, (&Requirements{MinEmulatorVersion: "2.14"}).unmet(testEnvironment{Name: EnvironmentEmulator}, supports), "version is unknown")
+
+	assert.Equal(t, "", (&Requirements{Features: []string{FeatureVectorSearch}}).unmet(emulator, supports))
+	assert.Equal(t, "the fullTextSearch feature, which the account doesn't support: the emulator doesn't support full-text search",
+		(&Requirements{Features: []string{FeatureVectorSearch, FeatureFullTextSearch}}).unmet(emulator, supports))
+
+	// Features aren't probed when an earlier requirement is already unmet.
+	probed = probed[:0]
+	(&Requirements{Environment: EnvironmentCloud, Features: []string{FeatureVectorSearch}}).unmet(emulator, supports)
+	assert.Empty(t, probed)
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("2.14", "2.14.0.0"))
+	assert.Equal(t, -1, compareVersions("2.9", "2.14"))
+	assert.Equal(t, 1, compareVersions("3.0", "2.14.99"))
+	assert.Equal(t, -1, compareVersions("unknown", "2.14"))
+}
+
+func TestParseServiceVersion(t *testing.T) {
+	assert.Equal(t, "2.14.0.0", parseServiceVersion("version=2.14.0.0"))
+	assert.Equal(t, "2.14.0.0", parseServiceVersion("acl=1; version=2.14.0.0"))
+	assert.Equal(t, "", parseServiceVersion(""))
+}
+
+func TestDetectEnvironmentName(t *testing.T) {
+	name, err := detectEnvironmentName("https://localhost:8081", "")
+	require.NoError(t, err)
+	assert.Equal(t, EnvironmentEmulator, name)
+
+	name, err = detectEnvironmentName("https://myaccount.documents.azure.com:443/", "")
+	require.NoError(t, err)
+	assert.Equal(t, EnvironmentCloud, name)
+
+	name, err = detectEnvironmentName("https://cosmos-emulator:8081", EnvironmentEmulator)
+	require.NoError(t, err)
+	assert.Equal(t, EnvironmentEmulator, name)
+
+	_, err = detectEnvironmentName("https://localhost:8081", "local")
+	assert.ErrorContains(t, err, EnvironmentEnvVar)
+}
+
+func TestContainerUnused(t *testing.T) {
+	queryContext := QueryContext{
+		Query: QuerySet{Queries: []QuerySpec{
+			{Name: "hybrid_1", Container: "Hybrid"},
+			{Name: "hybrid_2", Container: "Hybrid"},
+			{Name: "plain_1", Container: "Plain"},
+			{Name: "plain_2", Container: "Plain"},
+		}},
+	}
+	queryContext.Skipped = queryContext.evaluateRequirements(testEnvironment{Name: EnvironmentEmulator}, func(string) error { return nil })
+	assert.Empty(t, queryContext.Skipped)
+
+	queryContext.Skipped = map[string]string{"hybrid_1": "fullTextSearch", "hybrid_2": "fullTextSearch", "plain_1": "cloud"}
+	assert.True(t, queryContext.containerUnused("Hybrid"))
+	assert.False(t, queryContext.containerUnused("Plain"))
+	assert.False(t, queryContext.containerUnused("Unqueried"), "containers no query uses are still created")
+}
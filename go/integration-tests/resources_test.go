@@ -0,0 +1,219 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/integration-tests/internal/cleanup"
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/emulator"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// IsolationEnvVar selects how query sets are isolated from each other:
+// "shared" (the default) runs every query set in one database created for the test run, with containers per query set,
+// and "database" creates a database per query set.
+const IsolationEnvVar = "COSMOSCX_IT_ISOLATION"
+
+const IsolationShared = "shared"
+const IsolationDatabase = "database"
+
+// runDatabasePrefix starts the name of the database shared by a test run, so that databases leaked by a run that crashed can be recognized and deleted by a later run.
+// The rest of the name is the time the database was created, in Unix seconds, and a random suffix.
+const runDatabasePrefix = "it_run_"
+
+// staleRunDatabaseAge is how old a shared database must be for a later run to delete it.
+// It's much longer than a test run, so that runs against the same account don't delete each other's database.
+const staleRunDatabaseAge = 6 * time.Hour
+
+// parseIsolation parses the value of IsolationEnvVar.
+func parseIsolation(value string) (string, error) {
+	switch value {
+	case "", IsolationShared:
+		return IsolationShared, nil
+	case IsolationDatabase:
+		return IsolationDatabase, nil
+	default:
+		return "", fmt.Errorf("invalid %s '%s', expected '%s' or '%s'", IsolationEnvVar, value, IsolationShared, IsolationDatabase)
+	}
+}
+
+// containerResourceID returns the ID of the container created for a test data container.
+// In a shared database, it's prefixed with the query set's unique ID, since several query sets use the same test data.
+func (queryContext *QueryContext) containerResourceID(containerID string, isolation string) string {
+	if isolation == IsolationShared {
+		return queryContext.UniqueId + "_" + containerID
+	}
+	return containerID
+}
+
+// runDatabaseName returns the name of a shared database created at the given time.
+func runDatabaseName(created time.Time, suffix string) string {
+	return fmt.Sprintf("%s%d_%s", runDatabasePrefix, created.Unix(), suffix)
+}
+
+// sharedDatabase is the database shared by the query sets of a test run.
+// It's created by the first query set that needs it, so that tests that don't use the emulator don't need one, and deleted by TestMain.
+type sharedDatabase struct {
+	mu       sync.Mutex
+	database *azcosmos.DatabaseClient
+}
+
+// runDatabase is the database shared by the query sets of this test run.
+var runDatabase sharedDatabase
+
+// get returns the shared database, creating it if needed.
+// Databases leaked by earlier runs are deleted first. The database has no throughput of its own, each container gets dedicated throughput.
+func (s *sharedDatabase) get(ctx context.Context, client *azcosmos.Client) (*azcosmos.DatabaseClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.database != nil {
+		return s.database, nil
+	}
+
+	if err := deleteStaleRunDatabases(ctx, client, time.Now()); err != nil {
+		return nil, err
+	}
+
+	suffixBytes := make([]byte, 4)
+	if _, err := rand.Read(suffixBytes); err != nil {
+		return nil, err
+	}
+	name := runDatabaseName(time.Now(), base64.RawURLEncoding.EncodeToString(suffixBytes))
+	if _, err := client.CreateDatabase(ctx, azcosmos.DatabaseProperties{ID: name}, nil); err != nil {
+		return nil, fmt.Errorf("failed to create database: %w", err)
+	}
+	database, err := client.NewDatabase(name)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Created shared database %s", name)
+	s.database = database
+	return database, nil
+}
+
+// delete deletes the shared database, if it was created.
+func (s *sharedDatabase) delete(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.database == nil {
+		return nil
+	}
+	if _, err := s.database.Delete(ctx, nil); err != nil {
+		return fmt.Errorf("failed to delete shared database %s: %w", s.database.ID(), err)
+	}
+	s.database = nil
+	return nil
+}
+
+// deleteStaleRunDatabases deletes the shared databases leaked by earlier runs that crashed before they could delete them.
+func deleteStaleRunDatabases(ctx context.Context, client *azcosmos.Client, now time.Time) error {
+	_, err := cleanup.Run(ctx, cleanup.NewClient(client), cleanup.Options{
+		Prefix:    runDatabasePrefix,
+		OlderThan: staleRunDatabaseAge,
+		Now:       now,
+		Logf:      log.Printf,
+	})
+	return err
+}
+
+// deleteContainer deletes a container created by a query set in the shared database.
+// It only logs failures, since it runs while the query set is being torn down, possibly because of an earlier failure.
+func deleteContainer(ctx context.Context, database *azcosmos.DatabaseClient, containerID string) {
+	container, err := database.NewContainer(containerID)
+	if err == nil {
+		_, err = container.Delete(ctx, nil)
+	}
+	if err != nil {
+		log.Printf("Failed to delete container %s: %v", containerID, err)
+	}
+}
+
+// recoverPanic reports a panic in a test as a failure, rather than letting it crash the test binary.
+// A crash would skip the remaining query sets, as well as the deferred deletion of their containers and of the shared database.
+// It must be deferred directly by the test function.
+func recoverPanic(t *testing.T) {
+	if r := recover(); r != nil {
+		t.Errorf("panic: %v\n%s", r, debug.Stack())
+	}
+}
+
+// CleanEnvVar, if set to "1", deletes every database the integration tests created (see cleanup.DefaultPrefix) before the tests run,
+// including the databases of runs in progress against the same account.
+const CleanEnvVar = "COSMOSCX_IT_CLEAN"
+
+// cleanAccount deletes every database the integration tests created.
+func cleanAccount(ctx context.Context) error {
+	endpoint := getenvOrDefault(EndpointEnvVar, defaultEndpoint)
+	key := emulator.ResolveKey(endpoint, os.Getenv(KeyEnvVar))
+	client, err := createClient(endpoint, key)
+	if err != nil {
+		return err
+	}
+	deleted, err := cleanup.Run(ctx, cleanup.NewClient(client), cleanup.Options{Logf: log.Printf})
+	if err != nil {
+		return explainAuthError(err, key == "")
+	}
+	log.Printf("Deleted %d databases left by earlier runs", len(deleted))
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(CleanEnvVar) == "1" {
+		if err := cleanAccount(context.Background()); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+	}
+
+	code := m.Run()
+	if err := runDatabase.delete(context.Background()); err != nil {
+		log.Print(err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+func TestParseIsolation(t *testing.T) {
+	isolation, err := parseIsolation("")
+	require.NoError(t, err)
+	assert.Equal(t, IsolationShared, isolation)
+
+	isolation, err = parseIsolation(IsolationShared)
+	require.NoError(t, err)
+	assert.Equal(t, IsolationShared, isolation)
+
+	isolation, err = parseIsolation(IsolationDatabase)
+	require.NoError(t, err)
+	assert.Equal(t, IsolationDatabase, isolation)
+
+	_, err = parseIsolation("container")
+	assert.ErrorContains(t, err, IsolationEnvVar)
+}
+
+func TestContainerResourceID(t *testing.T) {
+	queryContext := QueryContext{UniqueId: "it_order_by_abcdef"}
+	assert.Equal(t, "it_order_by_abcdef_QuickStartProducts", queryContext.containerResourceID("QuickStartProducts", IsolationShared))
+	assert.Equal(t, "QuickStartProducts", queryContext.containerResourceID("QuickStartProducts", IsolationDatabase))
+}
+
+func TestRunDatabaseName(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "it_run_1714564800_a_b-c", runDatabaseName(created, "a_b-c"))
+	assert.True(t, strings.HasPrefix(runDatabaseName(created, "x"), cleanup.DefaultPrefix), "the cleanup command must find shared databases")
+}
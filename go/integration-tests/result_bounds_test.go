@@ -0,0 +1,143 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hasResultBounds returns whether the query bounds the number of items it returns, in which case it needs no results file.
+func (query *QuerySpec) hasResultBounds() bool {
+	return query.MinResults > 0 || query.MaxResults > 0
+}
+
+// validateResultBounds checks that the query's MinResults and MaxResults aren't negative or reversed, and that a query expected to fail doesn't set them.
+func (query *QuerySpec) validateResultBounds() error {
+	if query.MinResults < 0 || query.MaxResults < 0 {
+		return fmt.Errorf("minResults and maxResults must not be negative, but were %d and %d", query.MinResults, query.MaxResults)
+	}
+	if query.MaxResults > 0 && query.MinResults > query.MaxResults {
+		return fmt.Errorf("minResults (%d) must not be greater than maxResults (%d)", query.MinResults, query.MaxResults)
+	}
+	if query.hasResultBounds() && query.ExpectError != nil {
+		return fmt.Errorf("minResults and maxResults can't be combined with expectError, since a query expected to fail returns no items")
+	}
+	return nil
+}
+
+// checkResultCount checks the number of items the query returned against its MinResults and MaxResults.
+func checkResultCount(query QuerySpec, count int) error {
+	if query.MinResults > 0 && count < query.MinResults {
+		return fmt.Errorf("expected at least %d results, but got %d", query.MinResults, count)
+	}
+	if query.MaxResults > 0 && count > query.MaxResults {
+		return fmt.Errorf("expected at most %d results, but got %d", query.MaxResults, count)
+	}
+	return nil
+}
+
+// validateWithoutBaseline validates the items of a query that has result bounds but no baseline, using those of its validators that need no expected items:
+// orderedAscending and orderedDescending. Its other validators, and its ResultOrder, compare items with expected ones, so they don't apply.
+func validateWithoutBaseline(query QuerySpec, actualItems []interface{}) ([]ValidationError, error) {
+	properties := make([]string, 0, len(query.Validators))
+	for property := range query.Validators {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	var errors []ValidationError
+	for _, property := range properties {
+		validator := query.Validators[property]
+		name, _, _ := strings.Cut(validator, ":")
+		if name != ValidationOrderedAscending && name != ValidationOrderedDescending {
+			continue
+		}
+		validateFunc, err := resolveValidator(validator, query.tolerance(), query.NaNEqual)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validator %s for property %s: %v", validator, property, err)
+		}
+		errors = append(errors, validateFunc(nil, property, nil, actualItems)...)
+	}
+	return errors, nil
+}
+
+func TestResultBoundsParsing(t *testing.T) {
+	var query QuerySpec
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "q", "minResults": 90, "maxResults": 110}`), &query))
+	assert.Equal(t, 90, query.MinResults)
+	assert.Equal(t, 110, query.MaxResults)
+	assert.True(t, query.hasResultBounds())
+	assert.NoError(t, query.validateResultBounds())
+
+	// Each bound is optional.
+	assert.True(t, (&QuerySpec{MinResults: 1}).hasResultBounds())
+	assert.True(t, (&QuerySpec{MaxResults: 1}).hasResultBounds())
+	assert.False(t, (&QuerySpec{}).hasResultBounds())
+
+	assert.EqualError(t, (&QuerySpec{MinResults: -1}).validateResultBounds(), "minResults and maxResults must not be negative, but were -1 and 0")
+	assert.EqualError(t, (&QuerySpec{MinResults: 5, MaxResults: 4}).validateResultBounds(), "minResults (5) must not be greater than maxResults (4)")
+	assert.Error(t, (&QuerySpec{MinResults: 1, ExpectError: &ExpectedError{}}).validateResultBounds())
+}
+
+func TestCheckResultCount(t *testing.T) {
+	query := QuerySpec{MinResults: 90, MaxResults: 110}
+	assert.NoError(t, checkResultCount(query, 90))
+	assert.NoError(t, checkResultCount(query, 110))
+	assert.EqualError(t, checkResultCount(query, 89), "expected at least 90 results, but got 89")
+	assert.EqualError(t, checkResultCount(query, 111), "expected at most 110 results, but got 111")
+
+	assert.NoError(t, checkResultCount(QuerySpec{MinResults: 1}, 1000))
+	assert.EqualError(t, checkResultCount(QuerySpec{MinResults: 1}, 0), "expected at least 1 results, but got 0")
+	assert.NoError(t, checkResultCount(QuerySpec{}, 0))
+}
+
+func TestValidateWithoutBaseline(t *testing.T) {
+	items := []interface{}{
+		map[string]interface{}{"id": "b", "seq": 1.0},
+		map[string]interface{}{"id": "a", "seq": 2.0},
+	}
+
+	// Validators that compare with expected items, and the result order, are ignored without a baseline.
+	query := QuerySpec{ResultOrder: ResultOrderUnordered, Validators: map[string]string{"id": ValidationEqual, "seq": ValidationOrderedAscending}}
+	errors, err := validateWithoutBaseline(query, items)
+	require.NoError(t, err)
+	assert.Empty(t, errors)
+
+	query.Validators["id"] = ValidationOrderedAscending + ":" + OrderOptionIgnoreCase
+	errors, err = validateWithoutBaseline(query, items)
+	require.NoError(t, err)
+	require.Len(t, errors, 1)
+	assert.Equal(t, "id", errors[0].Property)
+	assert.Equal(t, 1, errors[0].Item)
+}
+
+func TestResultBoundsPrecedence(t *testing.T) {
+	expected := []interface{}{map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "b"}}
+	actual := []interface{}{map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "b"}}
+	execute := func(testData *TestData, query QuerySpec) ([]interface{}, QueryStats, error) {
+		return actual, QueryStats{Query: query.Name, PageSizes: []int{len(actual)}}, nil
+	}
+
+	// The bounds are checked before the items are compared with the baseline, and fail even if the baseline would pass.
+	query := QuerySpec{Name: "bounded", MinResults: 3}
+	assert.EqualError(t, runSingleQuery(t, &TestData{}, expected, "", ValidationBaseline, query, execute), "expected at least 3 results, but got 2")
+
+	// Within the bounds, the items are still compared with the baseline.
+	query = QuerySpec{Name: "bounded", MaxResults: 2}
+	assert.NoError(t, runSingleQuery(t, &TestData{}, expected, "", ValidationBaseline, query, execute))
+	assert.EqualError(t, runSingleQuery(t, &TestData{}, expected[:1], "", ValidationBaseline, query, execute), "expected 1 results, but got 2")
+
+	// Without a baseline, only the bounds and the order validators apply (see TestValidateWithoutBaseline), so the ranked result order and the equal validator are ignored.
+	query = QuerySpec{Name: "bounded", MinResults: 1, ResultOrder: ResultOrderRanked, Validators: map[string]string{"id": ValidationOrderedAscending, "seq": ValidationEqual}}
+	assert.NoError(t, runSingleQuery(t, &TestData{}, nil, "", ValidationBounds, query, execute))
+	query.MaxResults = 1
+	assert.EqualError(t, runSingleQuery(t, &TestData{}, nil, "", ValidationBounds, query, execute), "expected at most 1 results, but got 2")
+}
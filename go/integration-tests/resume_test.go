@@ -0,0 +1,168 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// QueryModeResumePerPage is the value of QuerySpec.Mode that reads each page of a query from a new pager, and so a new query pipeline, resumed from the previous page's continuation token.
+// It catches bugs in serializing and restoring pipeline state, such as buffered items being lost between pages.
+const QueryModeResumePerPage = "resumePerPage"
+
+// ErrPipelineNotResumable is returned when a query is run in QueryModeResumePerPage, but a page that isn't the last has no continuation token to resume from.
+// Until the client engine can serialize its pipeline state, this is the case for every query that returns more than one page, and the query is skipped.
+var ErrPipelineNotResumable = errors.New("the query pipeline can't be resumed, because the page has no continuation token")
+
+// ErrQueryNotResumed is returned when a query is run in QueryModeResumePerPage, but returns a single page, so it's never resumed and tests nothing the query doesn't.
+// The query is skipped; lower its maxItemCount so that it returns more than one page.
+var ErrQueryNotResumed = errors.New("the query returned a single page, so it was never resumed")
+
+// skipIfNotResumable skips the test if err is ErrPipelineNotResumable or ErrQueryNotResumed. Any other error, or a mismatch in the query's results, still fails it.
+func skipIfNotResumable(t *testing.T, err error) {
+	if errors.Is(err, ErrPipelineNotResumable) || errors.Is(err, ErrQueryNotResumed) {
+		t.Skipf("resume not supported: %v", err)
+	}
+}
+
+// readPages reads every page of a query from pagers created by newPager, starting with newPager(nil).
+// If resume is set, each page after the first is read from a new pager, created with the previous page's continuation token.
+// The recorder, if not nil, records the request charge of each page.
+// If reading a page fails, the pages read before it are returned with the error. If resume is set and the query is never resumed, the pages are returned with ErrQueryNotResumed.
+func readPages(ctx context.Context, newPager func(continuation *string) *runtime.Pager[azcosmos.QueryItemsResponse], resume bool, recorder *chargeRecorder) ([]azcosmos.QueryItemsResponse, error) {
+	var pages []azcosmos.QueryItemsResponse
+	resumed := false
+	pager := newPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, page)
+		recorder.endPage()
+
+		if resume && pager.More() {
+			if page.ContinuationToken == nil {
+				return pages, fmt.Errorf("page %d: %w", len(pages), ErrPipelineNotResumable)
+			}
+			pager = newPager(page.ContinuationToken)
+			resumed = true
+		}
+	}
+	if resume && !resumed {
+		return pages, ErrQueryNotResumed
+	}
+	return pages, nil
+}
+
+// fakePages returns a newPager function for readPages whose pagers return a page for each of the items, with a continuation token of the next item's index.
+// If tokens is false, pages have no continuation tokens. The continuations each pager is created with are recorded.
+func fakePages(items []string, tokens bool, continuations *[]string) func(*string) *runtime.Pager[azcosmos.QueryItemsResponse] {
+	return func(continuation *string) *runtime.Pager[azcosmos.QueryItemsResponse] {
+		next := 0
+		if continuation != nil {
+			*continuations = append(*continuations, *continuation)
+			fmt.Sscan(*continuation, &next)
+		} else {
+			*continuations = append(*continuations, "")
+		}
+		return runtime.NewPager(runtime.PagingHandler[azcosmos.QueryItemsResponse]{
+			More: func(page azcosmos.QueryItemsResponse) bool {
+				return next < len(items)
+			},
+			Fetcher: func(ctx context.Context, page *azcosmos.QueryItemsResponse) (azcosmos.QueryItemsResponse, error) {
+				if items[next] == "error" {
+					return azcosmos.QueryItemsResponse{}, errors.New("page failed")
+				}
+				response := azcosmos.QueryItemsResponse{Items: [][]byte{[]byte(fmt.Sprintf("%q", items[next]))}}
+				next++
+				if tokens && next < len(items) {
+					token := fmt.Sprint(next)
+					response.ContinuationToken = &token
+				}
+				return response, nil
+			},
+		})
+	}
+}
+
+func pageItems(pages []azcosmos.QueryItemsResponse) []string {
+	var items []string
+	for _, page := range pages {
+		for _, item := range page.Items {
+			var value string
+			_ = json.Unmarshal(item, &value)
+			items = append(items, value)
+		}
+	}
+	return items
+}
+
+func TestReadPages(t *testing.T) {
+	var continuations []string
+	pages, err := readPages(context.Background(), fakePages([]string{"a", "b", "c"}, false, &continuations), false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, pageItems(pages))
+	assert.Equal(t, []string{""}, continuations)
+}
+
+func TestReadPagesResumingPerPage(t *testing.T) {
+	var continuations []string
+	pages, err := readPages(context.Background(), fakePages([]string{"a", "b", "c"}, true, &continuations), true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, pageItems(pages))
+	assert.Equal(t, []string{"", "1", "2"}, continuations)
+}
+
+func TestReadPagesResumingPerPageWithoutContinuations(t *testing.T) {
+	var continuations []string
+	pages, err := readPages(context.Background(), fakePages([]string{"a", "b"}, false, &continuations), true, nil)
+	assert.ErrorIs(t, err, ErrPipelineNotResumable)
+	assert.ErrorContains(t, err, "page 1:")
+	assert.Equal(t, []string{"a"}, pageItems(pages))
+
+}
+
+func TestReadPagesResumingPerPageWithASinglePage(t *testing.T) {
+	var continuations []string
+	pages, err := readPages(context.Background(), fakePages([]string{"a"}, true, &continuations), true, nil)
+	assert.ErrorIs(t, err, ErrQueryNotResumed)
+	assert.Equal(t, []string{"a"}, pageItems(pages))
+	assert.Equal(t, []string{""}, continuations)
+}
+
+func TestReadPagesReturnsPagesBeforeAnError(t *testing.T) {
+	var continuations []string
+	pages, err := readPages(context.Background(), fakePages([]string{"a", "error"}, true, &continuations), true, nil)
+	assert.EqualError(t, err, "page failed")
+	assert.Equal(t, []string{"a"}, pageItems(pages))
+}
+
+func TestSkipIfNotResumable(t *testing.T) {
+	for _, err := range []error{fmt.Errorf("page 1: %w", ErrPipelineNotResumable), ErrQueryNotResumed} {
+		var skipped bool
+		t.Run("skipped", func(t *testing.T) {
+			defer func() { skipped = t.Skipped() }()
+			skipIfNotResumable(t, err)
+		})
+		assert.True(t, skipped, "%v", err)
+	}
+
+	// Other errors are left to fail the test.
+	var skipped bool
+	t.Run("failed", func(t *testing.T) {
+		defer func() { skipped = t.Skipped() }()
+		skipIfNotResumable(t, errors.New("items differ"))
+	})
+	assert.False(t, skipped)
+}
@@ -0,0 +1,384 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// QuerySetError lists the mistakes found in a query set file, each prefixed with the file, line, and column it was found at.
+type QuerySetError struct {
+	Problems []string
+}
+
+func (e *QuerySetError) Error() string {
+	return fmt.Sprintf("query set has %d problems:\n  %s", len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+// schemaProblem is a mistake in a query set file, at a byte offset in it.
+type schemaProblem struct {
+	offset  int64
+	message string
+}
+
+// decodeQuerySet decodes a query set file, reporting the line and column of a syntax error or a value of the wrong type.
+func decodeQuerySet(queryPath string, data []byte) (QuerySet, error) {
+	var querySet QuerySet
+	err := json.Unmarshal(data, &querySet)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return QuerySet{}, fmt.Errorf("%s: %w", position(queryPath, data, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		return QuerySet{}, fmt.Errorf("%s: %w", position(queryPath, data, typeErr.Offset), err)
+	case err != nil:
+		return QuerySet{}, fmt.Errorf("%s: %w", queryPath, err)
+	}
+	return querySet, nil
+}
+
+// validateQuerySet checks a query set for mistakes that would otherwise be ignored, or fail deep inside the run, and reports all of them at once in a *QuerySetError:
+// fields the harness doesn't know (such as "validtors"), queries on containers the test data doesn't define, missing results files, unknown validators, and invalid options.
+// A query with resultsFrom must name another query in the set, and is validated against its results file.
+// data is the raw query set file, which locates each problem. Queries that expect an error, that are only compared with the gateway, or that bound their number of results need no results file,
+// and no query does when results are compared with the gateway (see CompareEnvVar) or baselines are being updated (see UpdateBaselinesEnvVar).
+func validateQuerySet(queryPath string, data []byte, querySet QuerySet, testData TestData) error {
+	problems, positions, err := unknownFields(data, reflect.TypeOf(querySet))
+	if err != nil {
+		return fmt.Errorf("%s: %w", queryPath, err)
+	}
+
+	containers := make(map[string]bool, len(testData.Containers))
+	for _, container := range testData.Containers {
+		containers[container.ID] = true
+	}
+	resultsRequired := os.Getenv(UpdateBaselinesEnvVar) != "1" && os.Getenv(CompareEnvVar) != CompareGateway
+	resultsDir := path.Join(path.Dir(queryPath), querySet.Name)
+	names := make(map[string]bool, len(querySet.Queries))
+	for _, query := range querySet.Queries {
+		names[query.Name] = true
+	}
+
+	for i, query := range querySet.Queries {
+		at := positions[fmt.Sprintf("queries[%d]", i)]
+		report := func(offset int64, format string, args ...interface{}) {
+			problems = append(problems, schemaProblem{offset, fmt.Sprintf("query '%s': ", query.Name) + fmt.Sprintf(format, args...)})
+		}
+
+		if query.Name == "" {
+			report(at, "has no name")
+		}
+		if query.Text == "" {
+			report(at, "has no query text")
+		}
+		if !containers[query.Container] {
+			report(at, "references container '%s', which the test data doesn't define", query.Container)
+		}
+		if query.ResultsFrom != "" && (query.ResultsFrom == query.Name || !names[query.ResultsFrom]) {
+			report(at, "resultsFrom '%s' isn't another query in the set", query.ResultsFrom)
+		}
+		if resultsRequired && query.ExpectError == nil && !query.CompareOnly && !query.hasResultBounds() && query.Name != "" {
+			resultsPath := path.Join(resultsDir, query.resultsName()+".results.json")
+			if _, err := os.Stat(resultsPath); err != nil {
+				report(at, "has no results file at %s (set %s=1 to create it)", resultsPath, UpdateBaselinesEnvVar)
+			}
+		}
+
+		validatorsAt, ok := positions[fmt.Sprintf("queries[%d].validators", i)]
+		if !ok {
+			validatorsAt = at
+		}
+		properties := make([]string, 0, len(query.Validators))
+		for property := range query.Validators {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+		for _, property := range properties {
+			if _, err := resolveValidator(query.Validators[property], AllowedFloatError, false); err != nil {
+				report(validatorsAt, "invalid validator '%s' for property '%s': %v", query.Validators[property], property, err)
+			}
+		}
+
+		if err := query.validatePaging(); err != nil {
+			report(at, "%v", err)
+		}
+		if err := query.validateGroupBy(); err != nil {
+			report(at, "%v", err)
+		}
+		if err := query.validatePartitionRequests(); err != nil {
+			report(at, "%v", err)
+		}
+		if err := query.validateResultBounds(); err != nil {
+			report(at, "%v", err)
+		}
+		if err := query.Requires.validate(); err != nil {
+			report(at, "invalid requires: %v", err)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].offset < problems[j].offset })
+	queryErr := &QuerySetError{Problems: make([]string, 0, len(problems))}
+	for _, problem := range problems {
+		queryErr.Problems = append(queryErr.Problems, fmt.Sprintf("%s: %s", position(queryPath, data, problem.offset), problem.message))
+	}
+	return queryErr
+}
+
+// unknownFields finds the object keys in data that don't match a field of the type it's decoded into, which encoding/json would silently ignore.
+// Like encoding/json, keys match field names case-insensitively, and the keys of maps, and values decoded into interfaces or custom unmarshalers, aren't checked.
+// It also returns the offset of each object and array, by its path, such as "queries[2].validators".
+func unknownFields(data []byte, t reflect.Type) ([]schemaProblem, map[string]int64, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var problems []schemaProblem
+	positions := make(map[string]int64)
+	if err := walkJSON(decoder, t, "", &problems, positions); err != nil {
+		return nil, nil, err
+	}
+	return problems, positions, nil
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// walkJSON reads the next value from the decoder, reporting its unknown fields (see unknownFields). A nil type accepts any value.
+func walkJSON(decoder *json.Decoder, t reflect.Type, valuePath string, problems *[]schemaProblem, positions map[string]int64) error {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && (t.Kind() == reflect.Interface || reflect.PointerTo(t).Implements(unmarshalerType)) {
+		t = nil
+	}
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return nil
+	}
+	positions[valuePath] = decoder.InputOffset() - 1
+
+	switch delim {
+	case '{':
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			key := token.(string)
+			keyPath := key
+			if valuePath != "" {
+				keyPath = valuePath + "." + key
+			}
+
+			var fieldType reflect.Type
+			if t != nil {
+				switch t.Kind() {
+				case reflect.Struct:
+					field, ok := jsonField(t, key)
+					if !ok {
+						in := valuePath
+						if in == "" {
+							in = "the query set"
+						}
+						*problems = append(*problems, schemaProblem{decoder.InputOffset() - int64(len(key)) - 2, fmt.Sprintf("unknown field %q in %s", key, in)})
+					}
+					fieldType = field
+				case reflect.Map:
+					fieldType = t.Elem()
+				}
+			}
+			if err := walkJSON(decoder, fieldType, keyPath, problems, positions); err != nil {
+				return err
+			}
+		}
+	case '[':
+		var elementType reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elementType = t.Elem()
+		}
+		for i := 0; decoder.More(); i++ {
+			if err := walkJSON(decoder, elementType, fmt.Sprintf("%s[%d]", valuePath, i), problems, positions); err != nil {
+				return err
+			}
+		}
+	}
+	// Read the closing delimiter.
+	_, err = decoder.Token()
+	return err
+}
+
+// jsonField returns the type of the struct's field that a JSON key decodes into, matching the names in the fields' json tags, or their names, case-insensitively.
+func jsonField(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// position describes an offset in a file as "<file>:<line>:<column>".
+func position(file string, data []byte, offset int64) string {
+	offset = max(0, min(offset, int64(len(data))))
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("%s:%d:%d", file, line, column)
+}
+
+// writeQuerySet writes a query set, whose test data has a container "c", and results files for the named queries, to a temporary directory, returning its path.
+func writeQuerySet(t *testing.T, querySet string, results ...string) string {
+	dir := t.TempDir()
+	testData := `{"containers": [{"id": "c", "partitionKey": {"paths": ["/pk"], "kind": "Hash"}}], "data": []}`
+	require.NoError(t, os.WriteFile(path.Join(dir, "data.json"), []byte(testData), 0o644))
+	require.NoError(t, os.MkdirAll(path.Join(dir, "q"), 0o755))
+	for _, name := range results {
+		require.NoError(t, os.WriteFile(path.Join(dir, "q", name+".results.json"), []byte("[]"), 0o644))
+	}
+	queryPath := path.Join(dir, "q.json")
+	require.NoError(t, os.WriteFile(queryPath, []byte(querySet), 0o644))
+	return queryPath
+}
+
+// querySetProblems loads a query set, and returns its problems, with the file's directory stripped from their positions.
+func querySetProblems(t *testing.T, queryPath string) []string {
+	_, err := LoadQueryContext(context.Background(), queryPath)
+	var queryErr *QuerySetError
+	require.ErrorAs(t, err, &queryErr)
+	problems := make([]string, 0, len(queryErr.Problems))
+	for _, problem := range queryErr.Problems {
+		problems = append(problems, strings.TrimPrefix(problem, path.Dir(queryPath)+"/"))
+	}
+	return problems
+}
+
+func TestValidateQuerySetUnknownFields(t *testing.T) {
+	queryPath := writeQuerySet(t, `{
+  "name": "q",
+  "testData": "data.json",
+  "queries": [
+    {
+      "name": "a",
+      "query": "SELECT * FROM c",
+      "container": "c",
+      "validtors": {"id": "equal"},
+      "requires": {"feature": ["vectorSearch"]}
+    }
+  ],
+  "extra": true
+}`, "a")
+	assert.Equal(t, []string{
+		`q.json:9:7: unknown field "validtors" in queries[0]`,
+		`q.json:10:20: unknown field "feature" in queries[0].requires`,
+		`q.json:13:3: unknown field "extra" in the query set`,
+	}, querySetProblems(t, queryPath))
+}
+
+func TestValidateQuerySetReportsEveryProblem(t *testing.T) {
+	queryPath := writeQuerySet(t, `{
+  "name": "q",
+  "testData": "data.json",
+  "queries": [
+    {"name": "a", "query": "SELECT * FROM c", "container": "missing"},
+    {"name": "b", "query": "SELECT * FROM c", "container": "c"},
+    {"name": "c", "query": "SELECT * FROM c", "container": "c",
+     "validators": {"id": "eqaul", "n": "approx:-1"}},
+    {"name": "d", "query": "SELECT * FROM c", "container": "c", "resultOrder": "groupBy"}
+  ]
+}`, "a", "c", "d")
+	assert.Equal(t, []string{
+		"q.json:5:5: query 'a': references container 'missing', which the test data doesn't define",
+		"q.json:6:5: query 'b': has no results file at " + path.Join(path.Dir(queryPath), "q", "b.results.json") + " (set COSMOSCX_UPDATE_BASELINES=1 to create it)",
+		"q.json:8:20: query 'c': invalid validator 'eqaul' for property 'id': unknown validator",
+		"q.json:8:20: query 'c': invalid validator 'approx:-1' for property 'n': approx must be followed by a colon and a non-negative tolerance, such as approx:1e-3",
+		"q.json:9:5: query 'd': resultOrder 'groupBy' requires groupBy, the properties that identify each group",
+	}, querySetProblems(t, queryPath))
+}
+
+func TestValidateQuerySetResultsFiles(t *testing.T) {
+	querySet := `{"name": "q", "testData": "data.json", "queries": [
+		{"name": "fails", "query": "SELECT * FROM c", "container": "c", "expectError": {"code": "BadRequest"}},
+		{"name": "compared", "query": "SELECT * FROM c", "container": "c", "compareOnly": true},
+		{"name": "baselined", "query": "SELECT * FROM c", "container": "c"},
+		{"name": "resumed", "query": "SELECT * FROM c", "container": "c", "mode": "resumePerPage", "resultsFrom": "baselined"}
+	]}`
+	_, err := LoadQueryContext(context.Background(), writeQuerySet(t, querySet, "baselined"))
+	assert.NoError(t, err)
+
+	// A query with resultsFrom is validated against the other query's results file.
+	problems := querySetProblems(t, writeQuerySet(t, querySet))
+	require.Len(t, problems, 2)
+	assert.Contains(t, problems[0], "query 'baselined': has no results file")
+	assert.Contains(t, problems[1], "query 'resumed': has no results file")
+	assert.Contains(t, problems[1], "/q/baselined.results.json")
+
+	// Results files aren't needed when they're being created, or results are compared with the gateway.
+	t.Setenv(UpdateBaselinesEnvVar, "1")
+	_, err = LoadQueryContext(context.Background(), writeQuerySet(t, querySet))
+	assert.NoError(t, err)
+	t.Setenv(UpdateBaselinesEnvVar, "")
+	t.Setenv(CompareEnvVar, CompareGateway)
+	_, err = LoadQueryContext(context.Background(), writeQuerySet(t, querySet))
+	assert.NoError(t, err)
+}
+
+func TestValidateQuerySetSyntaxErrors(t *testing.T) {
+	queryPath := writeQuerySet(t, "{\n  \"name\": \"q\",\n  \"queries\": [\n    {\"name\": \"a\",}\n  ]\n}")
+	_, err := LoadQueryContext(context.Background(), queryPath)
+	assert.ErrorContains(t, err, queryPath+":4:19: invalid character '}'")
+
+	queryPath = writeQuerySet(t, "{\n  \"name\": \"q\",\n  \"queries\": [\n    {\"name\": \"a\", \"maxItemCount\": \"ten\"}\n  ]\n}")
+	_, err = LoadQueryContext(context.Background(), queryPath)
+	assert.ErrorContains(t, err, queryPath+":4:40: json: cannot unmarshal string")
+}
+
+func TestUnknownFieldsSkipsMapsAndInterfaces(t *testing.T) {
+	problems, positions, err := unknownFields([]byte(`{"queries": [{"parameters": {"anything": {"nested": 1}}, "validators": {"any.path": "equal"}}]}`), reflect.TypeOf(QuerySet{}))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+	assert.Contains(t, positions, "queries[0].validators")
+
+	_, _, err = unknownFields([]byte(`{"queries": [`), reflect.TypeOf(QuerySet{}))
+	assert.Error(t, err)
+}
+
+func TestValidateQuerySetResultsFrom(t *testing.T) {
+	queryPath := writeQuerySet(t, `{"name": "q", "testData": "data.json", "queries": [
+		{"name": "a", "query": "SELECT * FROM c", "container": "c", "resultsFrom": "missing"},
+		{"name": "b", "query": "SELECT * FROM c", "container": "c", "resultsFrom": "b"}
+	]}`, "missing", "b")
+	assert.Equal(t, []string{
+		"q.json:2:3: query 'a': resultsFrom 'missing' isn't another query in the set",
+		"q.json:3:3: query 'b': resultsFrom 'b' isn't another query in the set",
+	}, querySetProblems(t, queryPath))
+}
@@ -0,0 +1,28 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/seeding"
+)
+
+// SeedConcurrencyEnvVar sets the number of items inserted concurrently when seeding test data.
+const SeedConcurrencyEnvVar = "COSMOSCX_SEED_CONCURRENCY"
+
+// newSeeder creates a seeder whose concurrency is read from SeedConcurrencyEnvVar.
+func newSeeder() (*seeding.Seeder, error) {
+	concurrency := seeding.DefaultConcurrency
+	if v := os.Getenv(SeedConcurrencyEnvVar); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			return nil, fmt.Errorf("%s must be a positive integer, but was '%s'", SeedConcurrencyEnvVar, v)
+		}
+		concurrency = parsed
+	}
+	return seeding.New(concurrency), nil
+}
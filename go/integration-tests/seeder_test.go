@@ -0,0 +1,28 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/seeding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSeederReadsConcurrency(t *testing.T) {
+	t.Setenv(SeedConcurrencyEnvVar, "")
+	s, err := newSeeder()
+	require.NoError(t, err)
+	assert.Equal(t, seeding.DefaultConcurrency, s.Concurrency)
+
+	t.Setenv(SeedConcurrencyEnvVar, "3")
+	s, err = newSeeder()
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.Concurrency)
+
+	t.Setenv(SeedConcurrencyEnvVar, "0")
+	_, err = newSeeder()
+	assert.ErrorContains(t, err, SeedConcurrencyEnvVar)
+}
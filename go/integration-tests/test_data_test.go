@@ -0,0 +1,60 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllBaselinesLoad(t *testing.T) {
+	querySets, err := filepath.Glob(path.Join("..", "..", "baselines", "queries", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, querySets)
+	for _, querySet := range querySets {
+		t.Run(path.Base(querySet), func(t *testing.T) {
+			_, err := LoadQueryContext(context.Background(), querySet)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTestDataItemsRouting(t *testing.T) {
+	var shared TestDataItems
+	require.NoError(t, json.Unmarshal([]byte(`[{"id":"1"},{"id":"2"}]`), &shared))
+	assert.Len(t, shared.ItemsFor("a"), 2)
+	assert.Len(t, shared.ItemsFor("b"), 2)
+
+	queryContext, err := LoadQueryContext(context.Background(), path.Join("..", "..", "baselines", "queries", "per_container.json"))
+	require.NoError(t, err)
+	orders := queryContext.TestData.Data.ItemsFor("PerContainerOrders")
+	customers := queryContext.TestData.Data.ItemsFor("PerContainerCustomers")
+	assert.Len(t, orders, 6)
+	assert.Len(t, customers, 3)
+	var customer map[string]interface{}
+	require.NoError(t, json.Unmarshal(customers[0], &customer))
+	assert.Equal(t, "customer-1", customer["id"])
+	assert.Contains(t, customer, "region")
+	assert.Empty(t, queryContext.TestData.Data.ItemsFor("Missing"))
+}
+
+func TestValidateContainers(t *testing.T) {
+	var testData TestData
+	require.NoError(t, json.Unmarshal([]byte(`{"containers":[{"id":"a"}],"data":{"a":[],"b":[]}}`), &testData))
+	assert.EqualError(t, validateContainers(QuerySet{}, testData), "Test data lists items for container 'b', but that container is not defined in the test data")
+
+	testData.Data.PerContainer = nil
+	querySet := QuerySet{Queries: []QuerySpec{{Name: "q", Container: "c"}}}
+	assert.EqualError(t, validateContainers(querySet, testData), "Query 'q' references container 'c', but that container is not defined in the test data")
+
+	querySet.Queries[0].Container = "a"
+	assert.NoError(t, validateContainers(querySet, TestData{Containers: []azcosmos.ContainerProperties{{ID: "a"}}}))
+}
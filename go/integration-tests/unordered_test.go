@@ -0,0 +1,115 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// matchUnordered matches the expected and actual items as multisets, for queries whose items can be returned in any order.
+// Items are matched by their "id" property, if they have one, or by their whole content otherwise (ignoring system properties).
+// It returns the actual items reordered to line up with the expected items, and a validation error for each expected or actual item left unmatched.
+func matchUnordered(expected, actual []interface{}) ([]interface{}, []ValidationError) {
+	// Index the actual items by key, keeping duplicates in the order they were returned.
+	remaining := make(map[string][]int, len(actual))
+	for i, item := range actual {
+		key := unorderedKey(item)
+		remaining[key] = append(remaining[key], i)
+	}
+
+	var errors []ValidationError
+	aligned := make([]interface{}, 0, len(actual))
+	for i, item := range expected {
+		key := unorderedKey(item)
+		indices := remaining[key]
+		if len(indices) == 0 {
+			errors = append(errors, ValidationError{Item: i, Property: "<item>", Message: "expected item not found in actual results", Expected: item})
+			continue
+		}
+		aligned = append(aligned, actual[indices[0]])
+		remaining[key] = indices[1:]
+	}
+	for i, item := range actual {
+		key := unorderedKey(item)
+		if len(remaining[key]) > 0 && remaining[key][0] == i {
+			errors = append(errors, ValidationError{Item: i, Property: "<item>", Message: "actual item not found in expected results", Actual: item})
+			remaining[key] = remaining[key][1:]
+		}
+	}
+	return aligned, errors
+}
+
+// unorderedKey returns the key that matches an item between the expected and actual results.
+func unorderedKey(item interface{}) string {
+	if object, ok := item.(map[string]interface{}); ok {
+		if id, ok := object["id"].(string); ok {
+			return "id:" + id
+		}
+		stripped := make(map[string]interface{}, len(object))
+		for key, value := range object {
+			stripped[key] = value
+		}
+		for _, property := range systemProperties {
+			delete(stripped, property)
+		}
+		item = stripped
+	}
+
+	// encoding/json sorts the keys of maps, so equal items have the same encoding.
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Sprintf("unencodable:%v", item)
+	}
+	return "json:" + string(encoded)
+}
+
+func TestMatchUnorderedById(t *testing.T) {
+	expected := []interface{}{
+		map[string]interface{}{"id": "a", "value": 1.0},
+		map[string]interface{}{"id": "b", "value": 2.0},
+		map[string]interface{}{"id": "c", "value": 3.0},
+	}
+	actual := []interface{}{
+		map[string]interface{}{"id": "c", "value": 3.0, "_rid": "x"},
+		map[string]interface{}{"id": "a", "value": 1.0},
+		map[string]interface{}{"id": "b", "value": 20.0},
+	}
+	aligned, errors := matchUnordered(expected, actual)
+	assert.Empty(t, errors)
+	assert.Equal(t, []interface{}{actual[1], actual[2], actual[0]}, aligned)
+}
+
+func TestMatchUnorderedByContent(t *testing.T) {
+	expected := []interface{}{1.0, "x", 1.0, map[string]interface{}{"a": 1.0, "b": []interface{}{true}}}
+	actual := []interface{}{map[string]interface{}{"b": []interface{}{true}, "a": 1.0, "_etag": "e"}, 1.0, "x", 1.0}
+	aligned, errors := matchUnordered(expected, actual)
+	assert.Empty(t, errors)
+	assert.Equal(t, []interface{}{1.0, "x", 1.0, actual[0]}, aligned)
+}
+
+func TestMatchUnorderedReportsUnmatchedItems(t *testing.T) {
+	expected := []interface{}{
+		map[string]interface{}{"id": "a"},
+		map[string]interface{}{"id": "b"},
+		2.0,
+		2.0,
+	}
+	actual := []interface{}{
+		2.0,
+		map[string]interface{}{"id": "c"},
+		map[string]interface{}{"id": "a"},
+		3.0,
+	}
+	_, errors := matchUnordered(expected, actual)
+	require.Len(t, errors, 4)
+	assert.Equal(t, ValidationError{Item: 1, Property: "<item>", Message: "expected item not found in actual results", Expected: expected[1]}, errors[0])
+	assert.Equal(t, ValidationError{Item: 3, Property: "<item>", Message: "expected item not found in actual results", Expected: 2.0}, errors[1])
+	assert.Equal(t, ValidationError{Item: 1, Property: "<item>", Message: "actual item not found in expected results", Actual: actual[1]}, errors[2])
+	assert.Equal(t, ValidationError{Item: 3, Property: "<item>", Message: "actual item not found in expected results", Actual: 3.0}, errors[3])
+}
@@ -0,0 +1,118 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// UpdateBaselinesEnvVar, set to "1", makes the integration tests write the items each query returns to its expected-results file, instead of comparing them.
+// Each updated query is reported as skipped. Review the diff of the results files before committing them.
+const UpdateBaselinesEnvVar = "COSMOSCX_UPDATE_BASELINES"
+
+// systemProperties are the properties the service adds to every item, which are stripped from regenerated baselines.
+var systemProperties = []string{"_etag", "_rid", "_self", "_ts", "_attachments"}
+
+// updateBaseline runs the query and writes its items to the expected-results file at resultsPath, then skips the test.
+func updateBaseline(t *testing.T, testData *TestData, query QuerySpec, container *azcosmos.ContainerClient, resultsPath string) {
+	items, _, err := executeQuery(testData, query, container)
+	skipIfNotResumable(t, err)
+	require.NoError(t, err)
+	require.NoError(t, writeBaseline(resultsPath, query, items))
+	t.Skipf("Updated baseline %s with %d items", resultsPath, len(items))
+}
+
+// writeBaseline writes the normalized items to the expected-results file at resultsPath.
+// It fails without writing anything if there are no items and the query doesn't allow it, to avoid committing an empty baseline by accident.
+func writeBaseline(resultsPath string, query QuerySpec, items []interface{}) error {
+	if len(items) == 0 && !query.AllowEmpty {
+		return fmt.Errorf("Query '%s' returned no items; set \"allowEmpty\": true in its spec if that's expected", query.Name)
+	}
+
+	data, err := formatBaseline(items)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(resultsPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(resultsPath, data, 0o644)
+}
+
+// formatBaseline formats items as an expected-results file.
+// System properties are stripped from top-level objects, object keys are sorted, numbers are formatted as the shortest representation of their float64 value, and the output is indented with two spaces.
+func formatBaseline(items []interface{}) ([]byte, error) {
+	normalized := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if object, ok := item.(map[string]interface{}); ok {
+			stripped := make(map[string]interface{}, len(object))
+			for key, value := range object {
+				stripped[key] = value
+			}
+			for _, property := range systemProperties {
+				delete(stripped, property)
+			}
+			item = stripped
+		}
+		normalized = append(normalized, item)
+	}
+
+	// encoding/json sorts the keys of maps, and formats float64 values consistently.
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(normalized); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func TestFormatBaseline(t *testing.T) {
+	var items []interface{}
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"name": "<b>", "_rid": "x", "_etag": "y", "_ts": 1, "_self": "z", "_attachments": "a", "id": "1", "nested": {"b": 2.50, "a": 1.0}},
+		3.0,
+		"value"
+	]`), &items))
+
+	data, err := formatBaseline(items)
+	require.NoError(t, err)
+	assert.Equal(t, `[
+  {
+    "id": "1",
+    "name": "<b>",
+    "nested": {
+      "a": 1,
+      "b": 2.5
+    }
+  },
+  3,
+  "value"
+]`, string(data))
+
+	// The items themselves are left untouched.
+	assert.Contains(t, items[0], "_rid")
+}
+
+func TestWriteBaselineRejectsEmptyResults(t *testing.T) {
+	resultsPath := path.Join(t.TempDir(), "suite", "query.results.json")
+	err := writeBaseline(resultsPath, QuerySpec{Name: "query"}, nil)
+	assert.ErrorContains(t, err, "returned no items")
+	assert.NoFileExists(t, resultsPath)
+
+	require.NoError(t, writeBaseline(resultsPath, QuerySpec{Name: "query", AllowEmpty: true}, nil))
+	data, err := os.ReadFile(resultsPath)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(data))
+}
@@ -0,0 +1,303 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// itemsWith returns items with a single property, "v", holding each of the values.
+func itemsWith(values ...interface{}) []interface{} {
+	items := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		items = append(items, map[string]interface{}{"v": value})
+	}
+	return items
+}
+
+func TestValidateOrdered(t *testing.T) {
+	cases := []struct {
+		name      string
+		validator string
+		values    []interface{}
+		valid     bool
+	}{
+		{"numbers ascending", ValidationOrderedAscending, []interface{}{1.0, 2.5, 2.5, 10.0}, true},
+		{"numbers out of order", ValidationOrderedAscending, []interface{}{1.0, 10.0, 2.0}, false},
+		{"numbers descending", ValidationOrderedDescending, []interface{}{10.0, 2.0, -1.0}, true},
+		{"strings ascending", ValidationOrderedAscending, []interface{}{"Apple", "apple", "banana"}, true},
+		{"strings are case-sensitive", ValidationOrderedAscending, []interface{}{"apple", "Banana"}, false},
+		{"strings ignoring case", ValidationOrderedAscending + ":" + OrderOptionIgnoreCase, []interface{}{"apple", "Banana", "cherry"}, true},
+		{"strings descending", ValidationOrderedDescending, []interface{}{"b", "a"}, true},
+		{"timestamps as strings", ValidationOrderedAscending, []interface{}{"2024-01-02T00:00:00+05:00", "2024-01-01T23:00:00Z"}, false},
+		{"timestamps as times", ValidationOrderedAscending + ":" + OrderOptionTimestamps, []interface{}{"2024-01-02T00:00:00+05:00", "2024-01-01T23:00:00Z"}, true},
+		{"timestamps descending", ValidationOrderedDescending + ":" + OrderOptionTimestamps, []interface{}{"2024-01-02T00:00:00.5Z", "2024-01-02T00:00:00Z"}, true},
+		{"non-timestamps with the timestamps option", ValidationOrderedAscending + ":" + OrderOptionTimestamps + "," + OrderOptionIgnoreCase, []interface{}{"a", "B"}, true},
+		{"booleans", ValidationOrderedAscending, []interface{}{false, true, true}, true},
+		{"single item", ValidationOrderedAscending, []interface{}{"a"}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			validate, err := resolveValidator(c.validator, AllowedFloatError, false)
+			require.NoError(t, err)
+			errors := validate(t, "v", nil, itemsWith(c.values...))
+			if c.valid {
+				assert.Empty(t, errors)
+			} else {
+				assert.NotEmpty(t, errors)
+			}
+		})
+	}
+}
+
+func TestValidateOrderedReportsMixedTypes(t *testing.T) {
+	errors := validateOrdered("v", itemsWith(1.0, "2", 3.0), true, orderOptions{})
+	require.Len(t, errors, 2)
+	assert.Equal(t, 1, errors[0].Item)
+	assert.Equal(t, "can't order values of different types: float64 and string", errors[0].Message)
+	assert.Equal(t, "can't order values of different types: string and float64", errors[1].Message)
+
+	errors = validateOrdered("v", itemsWith(nil, nil), true, orderOptions{})
+	require.Len(t, errors, 1)
+	assert.Equal(t, "can't order values of type <nil>", errors[0].Message)
+}
+
+func TestValidateOrderedReportsMissingProperties(t *testing.T) {
+	errors := validateOrdered("v", []interface{}{map[string]interface{}{"v": 1.0}, map[string]interface{}{}}, true, orderOptions{})
+	require.Len(t, errors, 1)
+	assert.Equal(t, "missing expected property", errors[0].Message)
+
+	errors = validateOrdered("v", nil, true, orderOptions{})
+	require.Len(t, errors, 1)
+	assert.Equal(t, "no actual results to validate against", errors[0].Message)
+}
+
+func TestResolveValidatorRejectsInvalidValidators(t *testing.T) {
+	_, err := resolveValidator("unknown", AllowedFloatError, false)
+	assert.EqualError(t, err, "unknown validator")
+	_, err = resolveValidator(ValidationEqual+":"+OrderOptionIgnoreCase, AllowedFloatError, false)
+	assert.EqualError(t, err, "validator equal doesn't take options")
+	_, err = resolveValidator(ValidationOrderedAscending+":reverse", AllowedFloatError, false)
+	assert.EqualError(t, err, "unknown option 'reverse'")
+}
+
+func TestLookupProperty(t *testing.T) {
+	item := map[string]interface{}{
+		"name":    "Contoso",
+		"a.b":     1.0,
+		"address": map[string]interface{}{"city": "Redmond", "geo/loc": 2.0, "zip": nil},
+	}
+	cases := map[string]interface{}{
+		"name":              "Contoso",
+		"address.city":      "Redmond",
+		"/address/city":     "Redmond",
+		"/address/geo~1loc": 2.0,
+		"/a.b":              1.0,
+		"address.zip":       nil,
+	}
+	for path, expected := range cases {
+		value, found, err := lookupProperty(item, path)
+		require.NoError(t, err, path)
+		assert.True(t, found, path)
+		assert.Equal(t, expected, value, path)
+	}
+
+	_, found, err := lookupProperty(item, "address.state")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, _, err = lookupProperty(item, "billing.city")
+	assert.EqualError(t, err, "property 'billing' is missing, so it has no property 'billing.city'")
+	_, _, err = lookupProperty(item, "name.first")
+	assert.EqualError(t, err, "property 'name' is missing or isn't an object, so it has no property 'name.first'")
+	_, _, err = lookupProperty(1.0, "name")
+	assert.EqualError(t, err, "item is not an object, so it has no property 'name'")
+}
+
+func TestValidateUsingNestedValidators(t *testing.T) {
+	expected := []interface{}{
+		map[string]interface{}{"id": "1", "address": map[string]interface{}{"city": "Redmond", "geo": map[string]interface{}{"lat": 47.6}}},
+	}
+	actual := []interface{}{
+		map[string]interface{}{"id": "1", "address": map[string]interface{}{"city": "Redmond", "geo": map[string]interface{}{"lat": 0.0}}},
+	}
+
+	// The nested geo property differs, so comparing the whole address fails.
+	errors, err := validateUsingValidators(t, actual, expected, nil, AllowedFloatError, false)
+	require.NoError(t, err)
+	require.Len(t, errors, 1)
+	assert.Equal(t, "address", errors[0].Property)
+
+	// Ignoring it, by either form of path, leaves the rest of the address compared.
+	for _, path := range []string{"address.geo", "/address/geo"} {
+		errors, err = validateUsingValidators(t, actual, expected, map[string]string{path: ValidationIgnore}, AllowedFloatError, false)
+		require.NoError(t, err)
+		assert.Empty(t, errors, path)
+	}
+
+	actual[0].(map[string]interface{})["address"].(map[string]interface{})["city"] = "Seattle"
+	errors, err = validateUsingValidators(t, actual, expected, map[string]string{"address.geo": ValidationIgnore}, AllowedFloatError, false)
+	require.NoError(t, err)
+	require.Len(t, errors, 1)
+	assert.Equal(t, "address", errors[0].Property)
+
+	// A nested validator can compare a single value, even if its top-level property is ignored.
+	errors, err = validateUsingValidators(t, actual, expected, map[string]string{"address": ValidationIgnore, "address.city": ValidationEqual}, AllowedFloatError, false)
+	require.NoError(t, err)
+	require.Len(t, errors, 1)
+	assert.Equal(t, "address.city", errors[0].Property)
+}
+
+func TestValidateUsingNestedValidatorsReportsMissingObjects(t *testing.T) {
+	expected := []interface{}{map[string]interface{}{"id": "1", "address": map[string]interface{}{"city": "Redmond"}}}
+	actual := []interface{}{map[string]interface{}{"id": "1"}}
+	errors, err := validateUsingValidators(t, actual, expected, map[string]string{"address.city": ValidationEqual}, AllowedFloatError, false)
+	require.NoError(t, err)
+	require.Len(t, errors, 1)
+	assert.Equal(t, "address.city", errors[0].Property)
+	assert.Equal(t, "property 'address' is missing, so it has no property 'address.city'", errors[0].Message)
+
+	errors = validateOrdered("address.zip", []interface{}{actual[0], actual[0]}, true, orderOptions{})
+	require.Len(t, errors, 1)
+	assert.Equal(t, "property 'address' is missing, so it has no property 'address.zip'", errors[0].Message)
+}
+
+func TestWithinTolerance(t *testing.T) {
+	cases := []struct {
+		expected, actual, tolerance float64
+		within                      bool
+	}{
+		{1.0, 1.0, 0, true},
+		{0.5, 0.5 + 0.9e-6, 1e-6, true},
+		{0.5, 0.5 + 1.1e-6, 1e-6, false},
+		{-0.25, -0.25 - 0.9e-3, 1e-3, true},
+		// Beyond a magnitude of 1, the tolerance is relative.
+		{1e6, 1e6 + 1, 1e-6, true},
+		{1e6, 1e6 + 1.5, 1e-6, false},
+		{-1e9, -1e9 - 500, 1e-6, true},
+		{123.45, 123.46, 0, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.within, withinTolerance(c.expected, c.actual, c.tolerance, false), "withinTolerance(%g, %g, %g)", c.expected, c.actual, c.tolerance)
+	}
+}
+
+func TestValidateJsonEqualityNumbers(t *testing.T) {
+	inf, nan := math.Inf(1), math.NaN()
+	cases := []struct {
+		name             string
+		expected, actual interface{}
+		nanEqual         bool
+		equal            bool
+	}{
+		{"float32 against float64", float32(0.5), 0.5, false, true},
+		{"float32 within tolerance", float32(0.1), 0.1, false, true},
+		{"int against integer-valued float", 3, 3.0, false, true},
+		{"integer-valued float against int64", 3.0, int64(3), false, true},
+		{"int against other float", 3, 3.5, false, false},
+		{"json.Number against float", json.Number("3"), 3.0, false, true},
+		{"infinity against itself", inf, inf, false, true},
+		{"infinity against negative infinity", inf, -inf, false, false},
+		{"infinity against the largest float", inf, math.MaxFloat64, false, false},
+		{"large finite against infinity", 1e308, inf, false, false},
+		{"NaN against NaN", nan, nan, false, false},
+		{"NaN against NaN when opted in", nan, nan, true, true},
+		{"NaN against a number when opted in", nan, 1.0, true, false},
+		{"number against NaN when opted in", 1.0, nan, true, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			validationError, err := validateJsonEquality(t, 0, "v", c.expected, c.actual, AllowedFloatError, c.nanEqual)
+			require.NoError(t, err)
+			if c.equal {
+				assert.Nil(t, validationError)
+			} else {
+				require.NotNil(t, validationError)
+				assert.Contains(t, validationError.Message, "float mismatch")
+			}
+		})
+	}
+}
+
+func TestValidateJsonEqualityTypeMismatch(t *testing.T) {
+	validationError, err := validateJsonEquality(t, 2, "v", 3, "3", AllowedFloatError, false)
+	require.NoError(t, err)
+	require.NotNil(t, validationError)
+	assert.Equal(t, 2, validationError.Item)
+	assert.Equal(t, "type mismatch: expected a number, got string", validationError.Message)
+}
+
+func TestQueryNaNEqual(t *testing.T) {
+	var query QuerySpec
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "q", "nanEqual": true}`), &query))
+	assert.True(t, query.NaNEqual)
+
+	expected := itemsWith(math.NaN())
+	actual := itemsWith(math.NaN())
+	errors, err := validateUsingValidators(t, actual, expected, nil, query.tolerance(), query.NaNEqual)
+	require.NoError(t, err)
+	assert.Empty(t, errors)
+
+	errors, err = validateUsingValidators(t, actual, expected, map[string]string{"v": "approx:1e-3"}, query.tolerance(), query.NaNEqual)
+	require.NoError(t, err)
+	assert.Empty(t, errors)
+
+	errors, err = validateUsingValidators(t, actual, expected, nil, AllowedFloatError, false)
+	require.NoError(t, err)
+	assert.Len(t, errors, 1)
+}
+
+func TestApproxValidator(t *testing.T) {
+	expected := itemsWith(0.5)
+	validate, err := resolveValidator("approx:1e-2", AllowedFloatError, false)
+	require.NoError(t, err)
+	assert.Empty(t, validate(t, "v", expected, itemsWith(0.509)))
+	errors := validate(t, "v", expected, itemsWith(0.52))
+	require.Len(t, errors, 1)
+	assert.Equal(t, "v", errors[0].Property)
+	assert.Equal(t, "float mismatch: expected 0.5, got 0.52 (delta 0.02 exceeds allowed error 0.01)", errors[0].Message)
+
+	// Values that aren't numbers are reported rather than panicking.
+	errors = validate(t, "v", expected, itemsWith("0.5"))
+	require.Len(t, errors, 1)
+	assert.Equal(t, "type mismatch: expected a number, got string", errors[0].Message)
+
+	for _, invalid := range []string{"approx", "approx:", "approx:x", "approx:-1", "approx:NaN", "approx:Inf"} {
+		_, err := resolveValidator(invalid, AllowedFloatError, false)
+		assert.EqualError(t, err, "approx must be followed by a colon and a non-negative tolerance, such as approx:1e-3", invalid)
+	}
+}
+
+func TestQueryFloatTolerance(t *testing.T) {
+	var query QuerySpec
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "q", "floatTolerance": 1e-3, "validators": {"exact": "approx:0"}}`), &query))
+	assert.Equal(t, 1e-3, query.tolerance())
+	assert.Equal(t, AllowedFloatError, (&QuerySpec{}).tolerance())
+
+	expected := []interface{}{map[string]interface{}{"avg": 10.0, "exact": 9.99}}
+	actual := []interface{}{map[string]interface{}{"avg": 10.005, "exact": 9.99}}
+	errors, err := validateUsingValidators(t, actual, expected, query.Validators, query.tolerance(), false)
+	require.NoError(t, err)
+	assert.Empty(t, errors)
+
+	// The query's tolerance also applies to properties validated explicitly with equal.
+	errors, err = validateUsingValidators(t, actual, expected, map[string]string{"avg": ValidationEqual}, query.tolerance(), false)
+	require.NoError(t, err)
+	assert.Empty(t, errors)
+
+	actual[0].(map[string]interface{})["exact"] = 9.991
+	errors, err = validateUsingValidators(t, actual, expected, query.Validators, query.tolerance(), false)
+	require.NoError(t, err)
+	require.Len(t, errors, 1)
+	assert.Equal(t, "exact", errors[0].Property)
+
+	errors, err = validateUsingValidators(t, actual, expected, nil, AllowedFloatError, false)
+	require.NoError(t, err)
+	assert.Len(t, errors, 2)
+}
@@ -0,0 +1,266 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package integrationtests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// maxFlatIndexDimensions is the largest number of dimensions a flat vector index supports.
+const maxFlatIndexDimensions = 505
+
+var vectorDataTypes = []azcosmos.VectorDataType{azcosmos.VectorDataTypeFloat32, azcosmos.VectorDataTypeInt8, azcosmos.VectorDataTypeUint8}
+var vectorDistanceFunctions = []azcosmos.VectorDistanceFunction{azcosmos.VectorDistanceFunctionCosine, azcosmos.VectorDistanceFunctionDotProduct, azcosmos.VectorDistanceFunctionEuclidean}
+var vectorIndexTypes = []azcosmos.VectorIndexType{azcosmos.VectorIndexTypeFlat, azcosmos.VectorIndexTypeQuantizedFlat, azcosmos.VectorIndexTypeDiskANN}
+
+// validateVectorPolicies checks the vector embedding policies and vector indexes of the containers in a test data file, and the embeddings of the items inserted into them.
+// data is the raw test data file, which is checked for indexing policy properties that azcosmos.ContainerProperties would silently drop, such as "vectorIndex" instead of "vectorIndexes".
+func validateVectorPolicies(data []byte, testData TestData) error {
+	var raw struct {
+		Containers []struct {
+			ID             string          `json:"id"`
+			IndexingPolicy json.RawMessage `json:"indexingPolicy"`
+		} `json:"containers"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for _, container := range raw.Containers {
+		if len(container.IndexingPolicy) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(container.IndexingPolicy))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&azcosmos.IndexingPolicy{}); err != nil {
+			return fmt.Errorf("Container '%s' has an invalid indexing policy: %w", container.ID, err)
+		}
+	}
+
+	for _, container := range testData.Containers {
+		if err := validateVectorPolicy(container); err != nil {
+			return fmt.Errorf("Container '%s': %w", container.ID, err)
+		}
+		if err := validateEmbeddings(container, testData.Data.ItemsFor(container.ID)); err != nil {
+			return fmt.Errorf("Container '%s': %w", container.ID, err)
+		}
+	}
+	return nil
+}
+
+// validateVectorPolicy checks that the container's vector embeddings are well-formed, and that each vector index is for one of them.
+func validateVectorPolicy(container azcosmos.ContainerProperties) error {
+	embeddings := make(map[string]azcosmos.VectorEmbedding)
+	if container.VectorEmbeddingPolicy != nil {
+		for _, embedding := range container.VectorEmbeddingPolicy.VectorEmbeddings {
+			if len(embedding.Path) < 2 || embedding.Path[0] != '/' {
+				return fmt.Errorf("vector embedding path '%s' must be a JSON pointer, such as '/embedding'", embedding.Path)
+			}
+			if _, ok := embeddings[embedding.Path]; ok {
+				return fmt.Errorf("vector embedding path '%s' is listed more than once", embedding.Path)
+			}
+			if embedding.Dimensions <= 0 {
+				return fmt.Errorf("vector embedding '%s' must have a positive number of dimensions", embedding.Path)
+			}
+			if embedding.DataType != "" && !slices.Contains(vectorDataTypes, embedding.DataType) {
+				return fmt.Errorf("vector embedding '%s' has unknown data type '%s'", embedding.Path, embedding.DataType)
+			}
+			if !slices.Contains(vectorDistanceFunctions, embedding.DistanceFunction) {
+				return fmt.Errorf("vector embedding '%s' has unknown distance function '%s'", embedding.Path, embedding.DistanceFunction)
+			}
+			embeddings[embedding.Path] = embedding
+		}
+	}
+
+	if container.IndexingPolicy == nil {
+		return nil
+	}
+	for _, index := range container.IndexingPolicy.VectorIndexes {
+		embedding, ok := embeddings[index.Path]
+		if !ok {
+			return fmt.Errorf("vector index '%s' has no matching embedding in the vector embedding policy", index.Path)
+		}
+		if !slices.Contains(vectorIndexTypes, index.Type) {
+			return fmt.Errorf("vector index '%s' has unknown type '%s'", index.Path, index.Type)
+		}
+		if index.Type == azcosmos.VectorIndexTypeFlat && embedding.Dimensions > maxFlatIndexDimensions {
+			return fmt.Errorf("vector index '%s' is flat, which supports at most %d dimensions, but the embedding has %d", index.Path, maxFlatIndexDimensions, embedding.Dimensions)
+		}
+	}
+	return nil
+}
+
+// validateEmbeddings checks that every embedding in the items is an array of numbers with the dimensions given by the container's vector embedding policy.
+// Items without an embedding are allowed.
+func validateEmbeddings(container azcosmos.ContainerProperties, items []json.RawMessage) error {
+	if container.VectorEmbeddingPolicy == nil {
+		return nil
+	}
+	for i, itemJson := range items {
+		var item interface{}
+		if err := json.Unmarshal(itemJson, &item); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+		for _, embedding := range container.VectorEmbeddingPolicy.VectorEmbeddings {
+			value, found, err := lookupProperty(item, embedding.Path)
+			if err != nil || !found {
+				continue
+			}
+			vector, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("item %d: embedding '%s' is a %T, not an array", i, embedding.Path, value)
+			}
+			if len(vector) != int(embedding.Dimensions) {
+				return fmt.Errorf("item %d: embedding '%s' has %d dimensions, but the vector embedding policy has %d", i, embedding.Path, len(vector), embedding.Dimensions)
+			}
+			for _, element := range vector {
+				if _, ok := element.(float64); !ok {
+					return fmt.Errorf("item %d: embedding '%s' has a %T element, not a number", i, embedding.Path, element)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasVectorPolicy reports whether the container has vector embeddings or vector indexes.
+func hasVectorPolicy(container azcosmos.ContainerProperties) bool {
+	return (container.VectorEmbeddingPolicy != nil && len(container.VectorEmbeddingPolicy.VectorEmbeddings) > 0) ||
+		(container.IndexingPolicy != nil && len(container.IndexingPolicy.VectorIndexes) > 0)
+}
+
+// vectorSearchUnsupported is the hint added to errors creating containers with vector policies.
+const vectorSearchUnsupported = "the account or emulator may not support vector search; enable the NoSQL vector search capability on the account, or use an emulator that supports it"
+
+// checkCreatedVectorPolicy checks that a container created with a vector policy kept it, failing fast if the account or emulator silently ignored it.
+// createErr is the error creating the container, if any, which is annotated if the container has a vector policy.
+func checkCreatedVectorPolicy(requested azcosmos.ContainerProperties, created *azcosmos.ContainerProperties, createErr error) error {
+	if !hasVectorPolicy(requested) {
+		return createErr
+	}
+	if createErr != nil {
+		var responseErr *azcore.ResponseError
+		if errors.As(createErr, &responseErr) && responseErr.StatusCode == http.StatusBadRequest {
+			return fmt.Errorf("failed to create container '%s' with a vector policy (%s): %w", requested.ID, vectorSearchUnsupported, createErr)
+		}
+		return createErr
+	}
+
+	var embeddings []azcosmos.VectorEmbedding
+	if created != nil && created.VectorEmbeddingPolicy != nil {
+		embeddings = created.VectorEmbeddingPolicy.VectorEmbeddings
+	}
+	if requested.VectorEmbeddingPolicy != nil && len(embeddings) != len(requested.VectorEmbeddingPolicy.VectorEmbeddings) {
+		return fmt.Errorf("container '%s' was created with %d of its %d vector embeddings (%s)", requested.ID, len(embeddings), len(requested.VectorEmbeddingPolicy.VectorEmbeddings), vectorSearchUnsupported)
+	}
+
+	var indexes []azcosmos.VectorIndex
+	if created != nil && created.IndexingPolicy != nil {
+		indexes = created.IndexingPolicy.VectorIndexes
+	}
+	if requested.IndexingPolicy != nil && len(indexes) != len(requested.IndexingPolicy.VectorIndexes) {
+		return fmt.Errorf("container '%s' was created with %d of its %d vector indexes (%s)", requested.ID, len(indexes), len(requested.IndexingPolicy.VectorIndexes), vectorSearchUnsupported)
+	}
+	return nil
+}
+
+// vectorContainer returns a container with a single vector embedding at /embedding, indexed with the given index type.
+func vectorContainer(dimensions int32, indexType azcosmos.VectorIndexType) azcosmos.ContainerProperties {
+	return azcosmos.ContainerProperties{
+		ID: "vectors",
+		VectorEmbeddingPolicy: &azcosmos.VectorEmbeddingPolicy{VectorEmbeddings: []azcosmos.VectorEmbedding{
+			{Path: "/embedding", DataType: azcosmos.VectorDataTypeFloat32, DistanceFunction: azcosmos.VectorDistanceFunctionCosine, Dimensions: dimensions},
+		}},
+		IndexingPolicy: &azcosmos.IndexingPolicy{VectorIndexes: []azcosmos.VectorIndex{{Path: "/embedding", Type: indexType}}},
+	}
+}
+
+func TestValidateVectorPolicy(t *testing.T) {
+	assert.NoError(t, validateVectorPolicy(vectorContainer(8, azcosmos.VectorIndexTypeFlat)))
+	assert.NoError(t, validateVectorPolicy(azcosmos.ContainerProperties{ID: "plain"}))
+
+	container := vectorContainer(1024, azcosmos.VectorIndexTypeFlat)
+	assert.EqualError(t, validateVectorPolicy(container), "vector index '/embedding' is flat, which supports at most 505 dimensions, but the embedding has 1024")
+	container.IndexingPolicy.VectorIndexes[0].Type = azcosmos.VectorIndexTypeDiskANN
+	assert.NoError(t, validateVectorPolicy(container))
+
+	container = vectorContainer(8, azcosmos.VectorIndexTypeFlat)
+	container.IndexingPolicy.VectorIndexes[0].Path = "/other"
+	assert.EqualError(t, validateVectorPolicy(container), "vector index '/other' has no matching embedding in the vector embedding policy")
+
+	container = vectorContainer(0, azcosmos.VectorIndexTypeFlat)
+	assert.EqualError(t, validateVectorPolicy(container), "vector embedding '/embedding' must have a positive number of dimensions")
+
+	container = vectorContainer(8, azcosmos.VectorIndexTypeFlat)
+	container.VectorEmbeddingPolicy.VectorEmbeddings[0].DistanceFunction = "manhattan"
+	assert.EqualError(t, validateVectorPolicy(container), "vector embedding '/embedding' has unknown distance function 'manhattan'")
+
+	container = vectorContainer(8, azcosmos.VectorIndexTypeFlat)
+	container.VectorEmbeddingPolicy.VectorEmbeddings[0].Path = "embedding"
+	assert.EqualError(t, validateVectorPolicy(container), "vector embedding path 'embedding' must be a JSON pointer, such as '/embedding'")
+}
+
+func TestValidateVectorPoliciesRejectsUnknownIndexingPolicyFields(t *testing.T) {
+	data := []byte(`{
+		"containers": [{"id": "vectors", "indexingPolicy": {"vectorIndex": [{"path": "/embedding", "type": "flat"}]}}],
+		"data": []
+	}`)
+	var testData TestData
+	require.NoError(t, json.Unmarshal(data, &testData))
+	// azcosmos.ContainerProperties drops the misspelled property, so only the raw check catches it.
+	assert.Empty(t, testData.Containers[0].IndexingPolicy.VectorIndexes)
+	assert.EqualError(t, validateVectorPolicies(data, testData), `Container 'vectors' has an invalid indexing policy: json: unknown field "vectorIndex"`)
+}
+
+func TestValidateEmbeddings(t *testing.T) {
+	container := vectorContainer(3, azcosmos.VectorIndexTypeFlat)
+	items := []json.RawMessage{
+		json.RawMessage(`{"id": "1", "embedding": [0.1, 0.2, 0.3]}`),
+		json.RawMessage(`{"id": "2"}`),
+	}
+	assert.NoError(t, validateEmbeddings(container, items))
+
+	items = append(items, json.RawMessage(`{"id": "3", "embedding": [0.1, 0.2]}`))
+	assert.EqualError(t, validateEmbeddings(container, items), "item 2: embedding '/embedding' has 2 dimensions, but the vector embedding policy has 3")
+
+	items[2] = json.RawMessage(`{"id": "3", "embedding": [0.1, "0.2", 0.3]}`)
+	assert.EqualError(t, validateEmbeddings(container, items), "item 2: embedding '/embedding' has a string element, not a number")
+
+	items[2] = json.RawMessage(`{"id": "3", "embedding": "0.1,0.2,0.3"}`)
+	assert.EqualError(t, validateEmbeddings(container, items), "item 2: embedding '/embedding' is a string, not an array")
+}
+
+func TestCheckCreatedVectorPolicy(t *testing.T) {
+	requested := vectorContainer(8, azcosmos.VectorIndexTypeFlat)
+	assert.NoError(t, checkCreatedVectorPolicy(requested, &requested, nil))
+
+	// An account without vector search may create the container, but drop its policy.
+	created := azcosmos.ContainerProperties{ID: requested.ID, IndexingPolicy: &azcosmos.IndexingPolicy{}}
+	assert.EqualError(t, checkCreatedVectorPolicy(requested, &created, nil),
+		"container 'vectors' was created with 0 of its 1 vector embeddings (the account or emulator may not support vector search; enable the NoSQL vector search capability on the account, or use an emulator that supports it)")
+	created.VectorEmbeddingPolicy = requested.VectorEmbeddingPolicy
+	assert.ErrorContains(t, checkCreatedVectorPolicy(requested, &created, nil), "container 'vectors' was created with 0 of its 1 vector indexes")
+
+	// Or it may reject it.
+	badRequest := &azcore.ResponseError{StatusCode: http.StatusBadRequest}
+	err := checkCreatedVectorPolicy(requested, nil, badRequest)
+	assert.ErrorIs(t, err, badRequest)
+	assert.ErrorContains(t, err, "failed to create container 'vectors' with a vector policy")
+
+	// Containers without vector policies, and other errors, are left alone.
+	conflict := &azcore.ResponseError{StatusCode: http.StatusConflict}
+	assert.Equal(t, conflict, checkCreatedVectorPolicy(requested, nil, conflict))
+	assert.Equal(t, badRequest, checkCreatedVectorPolicy(azcosmos.ContainerProperties{ID: "plain"}, nil, badRequest))
+	assert.NoError(t, checkCreatedVectorPolicy(azcosmos.ContainerProperties{ID: "plain"}, &azcosmos.ContainerProperties{}, nil))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package emulator connects to the Cosmos DB emulator, or to an account, the same way wherever the integration tests, their cleanup command, and the sample do.
+package emulator
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// Endpoint is the emulator's default endpoint.
+const Endpoint = "https://localhost:8081"
+
+// Key is the emulator's well-known key, which is published in its documentation and isn't a secret.
+const Key = "C2y6yDjf5/R+ob0N8A7Cgv30VRDJIWEHLM+4QDU5DE2nQ9nDuVTqobD4b8mGGyPMbIZnqyMsEcaGQy67XIw/Jw=="
+
+// IsLocalEndpoint reports whether the endpoint is on this machine, such as the emulator.
+func IsLocalEndpoint(endpoint string) bool {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ResolveKey returns the key to authenticate to the endpoint with: the key if it's set, the emulator's [Key] for local endpoints,
+// or "" for Entra ID authentication with any other endpoint.
+func ResolveKey(endpoint, key string) string {
+	if key == "" && IsLocalEndpoint(endpoint) {
+		return Key
+	}
+	return key
+}
+
+// NewClient creates a client for the endpoint, authenticating with the key, or with Entra ID (azidentity.DefaultAzureCredential) if the key is "".
+// Unless the options have a transport, the client skips verifying the certificate of local endpoints, since the emulator's is self-signed.
+// The options may be nil.
+func NewClient(endpoint, key string, options *azcosmos.ClientOptions) (*azcosmos.Client, error) {
+	if options == nil {
+		options = &azcosmos.ClientOptions{}
+	}
+	if options.Transport == nil && IsLocalEndpoint(endpoint) {
+		copied := *options
+		copied.Transport = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}}
+		options = &copied
+	}
+
+	if key == "" {
+		credential, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, err
+		}
+		return azcosmos.NewClient(endpoint, credential, options)
+	}
+	keyCredential, err := azcosmos.NewKeyCredential(key)
+	if err != nil {
+		return nil, err
+	}
+	return azcosmos.NewClientWithKey(endpoint, keyCredential, options)
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsLocalEndpoint(t *testing.T) {
+	for endpoint, local := range map[string]bool{
+		"https://localhost:8081":                     true,
+		"https://127.0.0.1:8081/":                    true,
+		"https://[::1]:8081":                         true,
+		"https://myaccount.documents.azure.com:443/": false,
+		"https://localhost.documents.azure.com:443/": false,
+		"https://10.0.0.1:8081":                      false,
+		"://not a url":                               false,
+	} {
+		assert.Equal(t, local, IsLocalEndpoint(endpoint), endpoint)
+	}
+}
+
+func TestResolveKey(t *testing.T) {
+	assert.Equal(t, Key, ResolveKey(Endpoint, ""))
+	assert.Equal(t, "key", ResolveKey(Endpoint, "key"))
+	assert.Equal(t, "", ResolveKey("https://myaccount.documents.azure.com:443/", ""))
+	assert.Equal(t, "key", ResolveKey("https://myaccount.documents.azure.com:443/", "key"))
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient("https://myaccount.documents.azure.com:443/", "a2V5", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://myaccount.documents.azure.com:443/", client.Endpoint())
+
+	client, err = NewClient(Endpoint, Key, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Endpoint, client.Endpoint())
+
+	// Without a key, the client authenticates with DefaultAzureCredential, which only looks for a credential when it's first used.
+	_, err = NewClient("https://myaccount.documents.azure.com:443/", "", nil)
+	require.NoError(t, err)
+
+	_, err = NewClient("https://myaccount.documents.azure.com:443/", "not base64", nil)
+	assert.Error(t, err, "expected an error for a key that isn't base64")
+}
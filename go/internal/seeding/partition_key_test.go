@@ -0,0 +1,66 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package seeding
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendPartitionKeyValue(t *testing.T) {
+	cases := map[string]azcosmos.PartitionKey{
+		`"abc"`:            azcosmos.NewPartitionKey().AppendString("abc"),
+		`42`:               azcosmos.NewPartitionKey().AppendNumber(42),
+		`-7`:               azcosmos.NewPartitionKey().AppendNumber(-7),
+		`2.5`:              azcosmos.NewPartitionKey().AppendNumber(2.5),
+		`1e3`:              azcosmos.NewPartitionKey().AppendNumber(1000),
+		`9007199254740992`: azcosmos.NewPartitionKey().AppendNumber(9007199254740992),
+		`true`:             azcosmos.NewPartitionKey().AppendBool(true),
+		`null`:             azcosmos.NewPartitionKey().AppendNull(),
+	}
+	for value, expected := range cases {
+		t.Run(value, func(t *testing.T) {
+			actual, err := appendPartitionKeyValue(azcosmos.NewPartitionKey(), decodeNumber(t, value))
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestAppendPartitionKeyValueRejectsUnsupportedValues(t *testing.T) {
+	_, err := appendPartitionKeyValue(azcosmos.NewPartitionKey(), decodeNumber(t, `9007199254740993`))
+	assert.ErrorContains(t, err, "can't be represented exactly")
+
+	_, err = appendPartitionKeyValue(azcosmos.NewPartitionKey(), decodeNumber(t, `{"a":1}`))
+	assert.ErrorContains(t, err, "Unsupported partition key type")
+}
+
+func TestBuildItems(t *testing.T) {
+	definition := azcosmos.PartitionKeyDefinition{Kind: azcosmos.PartitionKeyKindMultiHash, Paths: []string{"/tenant", "/user"}, Version: 2}
+	items, err := BuildItems(definition, []json.RawMessage{json.RawMessage(`{"id":"1","tenant":"a","user":2}`)})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, azcosmos.NewPartitionKey().AppendString("a").AppendNumber(2), items[0].PartitionKey)
+	assert.Equal(t, `{"id":"1","tenant":"a","user":2}`, string(items[0].Body))
+
+	_, err = BuildItems(definition, []json.RawMessage{json.RawMessage(`{"id":"1","tenant":"a"}`)})
+	assert.ErrorContains(t, err, "Partition key property user not found in item")
+
+	_, err = BuildItems(azcosmos.PartitionKeyDefinition{Paths: []string{"/address/city"}}, []json.RawMessage{json.RawMessage(`{"id":"1"}`)})
+	assert.ErrorContains(t, err, "must not contain '/'")
+}
+
+// decodeNumber decodes a JSON value the way BuildItems does, with json.Number for numbers.
+func decodeNumber(t *testing.T, value string) interface{} {
+	var decoded interface{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&decoded))
+	return decoded
+}
@@ -0,0 +1,235 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package seeding inserts items into a container with a bounded number of concurrent inserts, retrying those that are throttled.
+// The integration tests seed their test data with it, and the sample's seed subcommand loads documents with it.
+package seeding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// DefaultConcurrency is the number of items inserted concurrently by a Seeder created with New, unless it's given another.
+const DefaultConcurrency = 16
+
+// maxAttempts is the number of times an item is attempted before seeding fails, when its inserts are throttled.
+const maxAttempts = 10
+
+// maxRetryDelay caps the delay before retrying a throttled insert, whatever the server asks for.
+const maxRetryDelay = 5 * time.Second
+
+// defaultRetryDelay is the delay before the first retry of a throttled insert without an x-ms-retry-after-ms header. It doubles with each attempt.
+const defaultRetryDelay = 100 * time.Millisecond
+
+// maxExactInteger is the largest integer that can be represented exactly as a float64 (2^53).
+const maxExactInteger = 1 << 53
+
+// ItemCreator is the part of *azcosmos.ContainerClient used to seed a container, so that seeding can be tested without an account.
+type ItemCreator interface {
+	CreateItem(ctx context.Context, partitionKey azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error)
+}
+
+// Item is an item to insert, with its partition key.
+type Item struct {
+	PartitionKey azcosmos.PartitionKey
+	Body         []byte
+}
+
+// Seeder inserts items into a container with a bounded number of concurrent inserts, retrying throttled inserts.
+type Seeder struct {
+	Concurrency int
+
+	// Sleep waits before retrying a throttled insert. It's replaced in tests.
+	Sleep func(ctx context.Context, delay time.Duration) error
+
+	// Progress, if set, is called after every tenth of the items (and the last item) have been inserted. Calls are serialized.
+	Progress func(inserted, total int)
+
+	// Throttled, if set, is called each time an insert is throttled and will be retried after the delay. It may be called concurrently.
+	Throttled func(delay time.Duration)
+}
+
+// New creates a Seeder that inserts up to concurrency items at once.
+func New(concurrency int) *Seeder {
+	return &Seeder{Concurrency: concurrency, Sleep: sleepContext}
+}
+
+// Seed inserts every item into the container, returning once they have all been inserted, or with the first error.
+// Inserts still in progress when an insert fails are cancelled.
+func (s *Seeder) Seed(ctx context.Context, container ItemCreator, items []Item) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan Item)
+	var wg sync.WaitGroup
+	var firstErr error
+	var errOnce sync.Once
+	var inserted int
+	var progressMu sync.Mutex
+	step := max(len(items)/10, 1)
+
+	for i := 0; i < min(s.Concurrency, len(items)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				if err := s.insert(ctx, container, item); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				progressMu.Lock()
+				inserted++
+				if s.Progress != nil && (inserted%step == 0 || inserted == len(items)) {
+					s.Progress(inserted, len(items))
+				}
+				progressMu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		select {
+		case work <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// insert creates a single item, retrying while it's throttled.
+func (s *Seeder) insert(ctx context.Context, container ItemCreator, item Item) error {
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err := container.CreateItem(ctx, item.PartitionKey, item.Body, nil)
+		delay, throttled := retryDelay(err, attempt)
+		if !throttled {
+			return err
+		}
+		if attempt == maxAttempts {
+			return fmt.Errorf("item still throttled after %d attempts: %w", attempt, err)
+		}
+		if s.Throttled != nil {
+			s.Throttled(delay)
+		}
+		if err := s.Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// retryDelay returns how long to wait before retrying an insert that failed with err, and whether it was throttled (HTTP 429) and should be retried.
+// The delay is the server's x-ms-retry-after-ms, if present, or an exponential backoff otherwise, capped at maxRetryDelay.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	delay := defaultRetryDelay << (attempt - 1)
+	if responseErr.RawResponse != nil {
+		if ms, err := strconv.ParseInt(responseErr.RawResponse.Header.Get("x-ms-retry-after-ms"), 10, 64); err == nil && ms >= 0 {
+			delay = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return min(delay, maxRetryDelay), true
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BuildItems builds the partition key of each item to insert into a container with the partition key definition.
+func BuildItems(definition azcosmos.PartitionKeyDefinition, items []json.RawMessage) ([]Item, error) {
+	seedItems := make([]Item, 0, len(items))
+	for _, item := range items {
+		// Decode numbers as json.Number, so that integral partition key values can be checked for precision.
+		var deserializedItem map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(item))
+		decoder.UseNumber()
+		err := decoder.Decode(&deserializedItem)
+		if err != nil {
+			return nil, err
+		}
+
+		partitionKey := azcosmos.NewPartitionKey()
+		for _, path := range definition.Paths {
+			if path[0] != '/' {
+				return nil, fmt.Errorf("Partition key path %s must start with '/'", path)
+			}
+			property := path[1:]
+			if strings.Contains(property, "/") {
+				return nil, fmt.Errorf("Partition key path %s must not contain '/'", path)
+			}
+			if value, ok := deserializedItem[property]; ok {
+				partitionKey, err = appendPartitionKeyValue(partitionKey, value)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				return nil, fmt.Errorf("Partition key property %s not found in item", property)
+			}
+		}
+
+		seedItems = append(seedItems, Item{PartitionKey: partitionKey, Body: item})
+	}
+	return seedItems, nil
+}
+
+// appendPartitionKeyValue appends a partition key value decoded from an item (with json.Number for numbers) to the partition key.
+func appendPartitionKeyValue(partitionKey azcosmos.PartitionKey, value interface{}) (azcosmos.PartitionKey, error) {
+	switch v := value.(type) {
+	case string:
+		return partitionKey.AppendString(v), nil
+	case json.Number:
+		// Partition key numbers are doubles, so an integral value must be exactly representable as one, or the item would be stored under a different value.
+		if i, err := v.Int64(); err == nil {
+			if i > maxExactInteger || i < -maxExactInteger {
+				return partitionKey, fmt.Errorf("Partition key value %s can't be represented exactly as a number", v)
+			}
+			return partitionKey.AppendNumber(float64(i)), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return partitionKey, fmt.Errorf("Invalid partition key number %s: %v", v, err)
+		}
+		return partitionKey.AppendNumber(f), nil
+	case bool:
+		return partitionKey.AppendBool(v), nil
+	case nil:
+		return partitionKey.AppendNull(), nil
+	default:
+		return partitionKey, fmt.Errorf("Unsupported partition key type %T", v)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package seeding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeContainer is an ItemCreator that throttles the first attempts to create each item.
+type fakeContainer struct {
+	// throttle is the number of times each item is throttled before it's created.
+	throttle int
+
+	// retryAfter is the value of the x-ms-retry-after-ms header on throttled responses, or "" to omit it.
+	retryAfter string
+
+	// fail, if set, is returned instead of creating the item with this body.
+	fail map[string]error
+
+	mu          sync.Mutex
+	attempts    map[string]int
+	created     []string
+	inFlight    int
+	maxInFlight int
+}
+
+func (c *fakeContainer) CreateItem(ctx context.Context, partitionKey azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.maxInFlight = max(c.maxInFlight, c.inFlight)
+	c.attempts[string(item)]++
+	attempt := c.attempts[string(item)]
+	c.mu.Unlock()
+
+	// Give other workers a chance to start inserting concurrently.
+	time.Sleep(time.Millisecond)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	if err, ok := c.fail[string(item)]; ok {
+		return azcosmos.ItemResponse{}, err
+	}
+	if attempt <= c.throttle {
+		response := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		if c.retryAfter != "" {
+			response.Header.Set("x-ms-retry-after-ms", c.retryAfter)
+		}
+		return azcosmos.ItemResponse{}, &azcore.ResponseError{StatusCode: http.StatusTooManyRequests, RawResponse: response}
+	}
+	c.created = append(c.created, string(item))
+	return azcosmos.ItemResponse{}, nil
+}
+
+func newFakeContainer() *fakeContainer {
+	return &fakeContainer{attempts: map[string]int{}}
+}
+
+func makeSeedItems(n int) []Item {
+	items := make([]Item, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, Item{PartitionKey: azcosmos.NewPartitionKeyString("pk"), Body: []byte(fmt.Sprintf(`{"id":"%d"}`, i))})
+	}
+	return items
+}
+
+// recordSleeps returns a Sleep function that records the delays it was asked to wait for, without waiting.
+func recordSleeps(delays *[]time.Duration) func(context.Context, time.Duration) error {
+	var mu sync.Mutex
+	return func(ctx context.Context, delay time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*delays = append(*delays, delay)
+		return nil
+	}
+}
+
+func TestSeedInsertsEveryItemConcurrently(t *testing.T) {
+	container := newFakeContainer()
+	var progress [][2]int
+	s := &Seeder{Concurrency: 4, Sleep: sleepContext, Progress: func(inserted, total int) {
+		progress = append(progress, [2]int{inserted, total})
+	}}
+	require.NoError(t, s.Seed(context.Background(), container, makeSeedItems(40)))
+
+	assert.Len(t, container.created, 40)
+	assert.LessOrEqual(t, container.maxInFlight, 4)
+	assert.Greater(t, container.maxInFlight, 1)
+	require.NotEmpty(t, progress)
+	assert.Equal(t, [2]int{40, 40}, progress[len(progress)-1])
+}
+
+func TestSeedRetriesThrottledInsertsUsingRetryAfter(t *testing.T) {
+	container := newFakeContainer()
+	container.throttle = 2
+	container.retryAfter = "250"
+	var delays []time.Duration
+	var throttled atomic.Int32
+	s := &Seeder{Concurrency: 2, Sleep: recordSleeps(&delays), Throttled: func(time.Duration) { throttled.Add(1) }}
+	require.NoError(t, s.Seed(context.Background(), container, makeSeedItems(3)))
+
+	assert.Len(t, container.created, 3)
+	assert.Len(t, delays, 6)
+	assert.Equal(t, int32(6), throttled.Load())
+	for _, delay := range delays {
+		assert.Equal(t, 250*time.Millisecond, delay)
+	}
+}
+
+func TestSeedCapsRetryDelay(t *testing.T) {
+	container := newFakeContainer()
+	container.throttle = 1
+	container.retryAfter = "600000"
+	var delays []time.Duration
+	s := &Seeder{Concurrency: 1, Sleep: recordSleeps(&delays)}
+	require.NoError(t, s.Seed(context.Background(), container, makeSeedItems(1)))
+	assert.Equal(t, []time.Duration{maxRetryDelay}, delays)
+}
+
+func TestSeedBacksOffWithoutRetryAfter(t *testing.T) {
+	container := newFakeContainer()
+	container.throttle = 4
+	var delays []time.Duration
+	s := &Seeder{Concurrency: 1, Sleep: recordSleeps(&delays)}
+	require.NoError(t, s.Seed(context.Background(), container, makeSeedItems(1)))
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond}, delays)
+}
+
+func TestSeedGivesUpAfterMaxAttempts(t *testing.T) {
+	container := newFakeContainer()
+	container.throttle = maxAttempts
+	container.retryAfter = "1"
+	var delays []time.Duration
+	s := &Seeder{Concurrency: 1, Sleep: recordSleeps(&delays)}
+	err := s.Seed(context.Background(), container, makeSeedItems(1))
+
+	var responseErr *azcore.ResponseError
+	require.ErrorAs(t, err, &responseErr)
+	assert.Equal(t, http.StatusTooManyRequests, responseErr.StatusCode)
+	assert.ErrorContains(t, err, fmt.Sprintf("after %d attempts", maxAttempts))
+	assert.Len(t, delays, maxAttempts-1)
+	assert.Empty(t, container.created)
+}
+
+func TestSeedStopsAtFirstError(t *testing.T) {
+	items := makeSeedItems(100)
+	failure := errors.New("conflict")
+	container := newFakeContainer()
+	container.fail = map[string]error{string(items[5].Body): failure}
+	s := &Seeder{Concurrency: 2, Sleep: sleepContext}
+	err := s.Seed(context.Background(), container, items)
+
+	assert.ErrorIs(t, err, failure)
+	assert.Less(t, len(container.created), 99)
+}
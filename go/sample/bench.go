@@ -0,0 +1,228 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// pageResult is the time, items, and request charge of one page of a query.
+type pageResult struct {
+	duration time.Duration
+	items    int
+	charge   float64
+}
+
+// iterationResult is the time, items, and request charge of one run of a query, and of each of its pages.
+type iterationResult struct {
+	duration time.Duration
+	items    int
+	charge   float64
+	pages    []pageResult
+}
+
+// latencies are the percentiles of a set of durations, in milliseconds.
+type latencies struct {
+	Min float64 `json:"min"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// figures summarize a set of queries or pages. The rates are of the time spent in them, so they're unaffected by how many run at once.
+type figures struct {
+	Count          int       `json:"count"`
+	LatencyMs      latencies `json:"latencyMs"`
+	Items          int       `json:"items"`
+	RequestCharge  float64   `json:"requestCharge"`
+	ItemsPerSecond float64   `json:"itemsPerSecond"`
+	RUPerSecond    float64   `json:"ruPerSecond"`
+}
+
+// benchmarkSummary is the result of --repeat, which is written to the --report file.
+type benchmarkSummary struct {
+	Iterations  int `json:"iterations"`
+	Warmup      int `json:"warmup"`
+	Concurrency int `json:"concurrency"`
+
+	// WallTimeMs is the time it took to run every measured iteration, and the throughputs are of that time, so they include the effect of concurrency.
+	WallTimeMs               float64 `json:"wallTimeMs"`
+	ThroughputItemsPerSecond float64 `json:"throughputItemsPerSecond"`
+	ThroughputRUPerSecond    float64 `json:"throughputRuPerSecond"`
+
+	Query figures `json:"query"`
+	Page  figures `json:"page"`
+}
+
+// summarize aggregates the results of the measured iterations of a benchmark, which took wallTime to run.
+func summarize(results []iterationResult, warmup, concurrency int, wallTime time.Duration) benchmarkSummary {
+	var queries, pages []pageResult
+	for _, result := range results {
+		queries = append(queries, pageResult{result.duration, result.items, result.charge})
+		pages = append(pages, result.pages...)
+	}
+	summary := benchmarkSummary{
+		Iterations:  len(results),
+		Warmup:      warmup,
+		Concurrency: concurrency,
+		WallTimeMs:  milliseconds(wallTime),
+		Query:       summarizeFigures(queries),
+		Page:        summarizeFigures(pages),
+	}
+	if wallTime > 0 {
+		summary.ThroughputItemsPerSecond = float64(summary.Query.Items) / wallTime.Seconds()
+		summary.ThroughputRUPerSecond = summary.Query.RequestCharge / wallTime.Seconds()
+	}
+	return summary
+}
+
+func summarizeFigures(results []pageResult) figures {
+	f := figures{Count: len(results)}
+	if len(results) == 0 {
+		return f
+	}
+	durations := make([]time.Duration, len(results))
+	var total time.Duration
+	for i, result := range results {
+		durations[i] = result.duration
+		total += result.duration
+		f.Items += result.items
+		f.RequestCharge += result.charge
+	}
+	slices.Sort(durations)
+	f.LatencyMs = latencies{
+		Min: milliseconds(durations[0]),
+		P50: milliseconds(percentile(durations, 50)),
+		P95: milliseconds(percentile(durations, 95)),
+		P99: milliseconds(percentile(durations, 99)),
+		Max: milliseconds(durations[len(durations)-1]),
+	}
+	if total > 0 {
+		f.ItemsPerSecond = float64(f.Items) / total.Seconds()
+		f.RUPerSecond = f.RequestCharge / total.Seconds()
+	}
+	return f
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations: the smallest that's at least p percent of them.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// runIteration runs a query to completion, timing it and each of its pages, and adding up the request charges of the requests made for it.
+// The charges are those of the requests made with the pager's context, so each iteration's are its own even if several run at once.
+func runIteration(pager queryPager) (iterationResult, error) {
+	meter := &chargeMeter{}
+	ctx := withChargeMeter(context.Background(), meter)
+	var result iterationResult
+	start := time.Now()
+	pageStart, pageCharge := start, 0.0
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return iterationResult{}, err
+		}
+		now, charge := time.Now(), meter.Total()
+		result.pages = append(result.pages, pageResult{now.Sub(pageStart), len(page.Items), charge - pageCharge})
+		result.items += len(page.Items)
+		pageStart, pageCharge = now, charge
+	}
+	result.duration = time.Since(start)
+	result.charge = meter.Total()
+	return result, nil
+}
+
+// runIterations runs the query count times, with up to concurrency iterations at once, each with a new pager, and so a new pipeline.
+// It stops at the first iteration that fails.
+func runIterations(newPager func() queryPager, count, concurrency int) ([]iterationResult, error) {
+	results := make([]iterationResult, count)
+	var mu sync.Mutex
+	var next int
+	var firstErr error
+	// claim returns the index of the next iteration to run, or false once every iteration has run or one has failed.
+	claim := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= count || firstErr != nil {
+			return 0, false
+		}
+		next++
+		return next - 1, true
+	}
+
+	var wg sync.WaitGroup
+	for range min(concurrency, count) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, ok := claim(); ok; i, ok = claim() {
+				result, err := runIteration(newPager())
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("iteration %d failed: %w", i, err)
+					}
+					mu.Unlock()
+					return
+				}
+				results[i] = result
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// runBenchmark runs the query warmup times, discarding the results, and then repeat times, and summarizes those.
+func runBenchmark(newPager func() queryPager, repeat, warmup, concurrency int) (benchmarkSummary, error) {
+	if _, err := runIterations(newPager, warmup, concurrency); err != nil {
+		return benchmarkSummary{}, fmt.Errorf("warmup failed: %w", err)
+	}
+	start := time.Now()
+	results, err := runIterations(newPager, repeat, concurrency)
+	if err != nil {
+		return benchmarkSummary{}, err
+	}
+	return summarize(results, warmup, concurrency, time.Since(start)), nil
+}
+
+// print prints the summary of a benchmark.
+func (s benchmarkSummary) print(out io.Writer) {
+	fmt.Fprintf(out, "%d iterations (after %d warmup), %d at once, in %.1fms: %.1f items/s, %.2f RU/s\n",
+		s.Iterations, s.Warmup, s.Concurrency, s.WallTimeMs, s.ThroughputItemsPerSecond, s.ThroughputRUPerSecond)
+	for _, f := range []struct {
+		name    string
+		figures figures
+	}{{"query", s.Query}, {"page", s.Page}} {
+		l := f.figures.LatencyMs
+		fmt.Fprintf(out, "%s: %d, latency min %.2fms p50 %.2fms p95 %.2fms p99 %.2fms max %.2fms, %d items, %.2f RU, %.1f items/s, %.2f RU/s\n",
+			f.name, f.figures.Count, l.Min, l.P50, l.P95, l.P99, l.Max, f.figures.Items, f.figures.RequestCharge, f.figures.ItemsPerSecond, f.figures.RUPerSecond)
+	}
+}
+
+// writeReport writes the summary of a benchmark to the file as JSON.
+func (s benchmarkSummary) writeReport(file string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,139 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	// 100 iterations taking 1ms to 100ms, each with two pages splitting its time, items, and charge.
+	var results []iterationResult
+	for i := 100; i >= 1; i-- {
+		d := time.Duration(i) * time.Millisecond
+		results = append(results, iterationResult{
+			duration: d, items: 10, charge: 2.5,
+			pages: []pageResult{{d / 4, 4, 1}, {d - d/4, 6, 1.5}},
+		})
+	}
+	summary := summarize(results, 5, 2, 2*time.Second)
+
+	if summary.Iterations != 100 || summary.Warmup != 5 || summary.Concurrency != 2 || summary.WallTimeMs != 2000 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	// 1000 items and 250 RU in the two seconds it took to run them all.
+	if summary.ThroughputItemsPerSecond != 500 || summary.ThroughputRUPerSecond != 125 {
+		t.Errorf("unexpected throughput %v items/s, %v RU/s", summary.ThroughputItemsPerSecond, summary.ThroughputRUPerSecond)
+	}
+
+	query := summary.Query
+	if expected := (latencies{Min: 1, P50: 50, P95: 95, P99: 99, Max: 100}); query.LatencyMs != expected {
+		t.Errorf("expected query latencies %+v, got %+v", expected, query.LatencyMs)
+	}
+	// The iterations took 5050ms in all.
+	if query.Count != 100 || query.Items != 1000 || query.RequestCharge != 250 || query.ItemsPerSecond != 1000/5.05 || query.RUPerSecond != 250/5.05 {
+		t.Errorf("unexpected query figures %+v", query)
+	}
+
+	page := summary.Page
+	if page.Count != 200 || page.Items != 1000 || page.RequestCharge != 250 {
+		t.Errorf("unexpected page figures %+v", page)
+	}
+	if page.LatencyMs.Min != 0.25 || page.LatencyMs.Max != 75 {
+		t.Errorf("unexpected page latencies %+v", page.LatencyMs)
+	}
+}
+
+func TestSummarizeWithoutResults(t *testing.T) {
+	summary := summarize(nil, 0, 1, 0)
+	if summary.Query != (figures{}) || summary.Page != (figures{}) || summary.ThroughputItemsPerSecond != 0 {
+		t.Errorf("expected empty figures, got %+v", summary)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4}
+	for p, expected := range map[float64]time.Duration{0: 1, 25: 1, 26: 2, 50: 2, 75: 3, 99: 4, 100: 4} {
+		if actual := percentile(sorted, p); actual != expected {
+			t.Errorf("p%v: expected %v, got %v", p, expected, actual)
+		}
+	}
+	if percentile([]time.Duration{7}, 99) != 7 {
+		t.Error("expected the only duration to be every percentile")
+	}
+}
+
+func TestRunBenchmark(t *testing.T) {
+	var pagers atomic.Int64
+	newPager := func() queryPager {
+		pagers.Add(1)
+		return pagerOf(fakePage{items: []string{`1`, `2`}, charge: 1.5}, fakePage{items: []string{`3`}, charge: 0.5})
+	}
+	summary, err := runBenchmark(newPager, 20, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every iteration has its own pager, but only the measured ones are summarized, and each only has its own charges, although they run at once.
+	if pagers.Load() != 23 {
+		t.Errorf("expected a pager for each of the 23 iterations, got %d", pagers.Load())
+	}
+	if summary.Iterations != 20 || summary.Query.Items != 60 || summary.Query.RequestCharge != 40 || summary.Page.Count != 40 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	var output bytes.Buffer
+	summary.print(&output)
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "20 iterations (after 3 warmup), 4 at once") ||
+		!strings.HasPrefix(lines[1], "query: 20, latency min") || !strings.HasPrefix(lines[2], "page: 40, latency min") {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+
+	report := filepath.Join(t.TempDir(), "bench.json")
+	if err := summary.writeReport(report); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written map[string]any
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if written["iterations"] != 20.0 || written["query"].(map[string]any)["requestCharge"] != 40.0 {
+		t.Errorf("unexpected report %s", data)
+	}
+}
+
+func TestRunBenchmarkFails(t *testing.T) {
+	failure := errors.New("request failed")
+	var pagers atomic.Int64
+	newPager := func() queryPager {
+		if pagers.Add(1) == 3 {
+			return pagerOf(fakePage{err: failure})
+		}
+		return pagerOf(fakePage{items: []string{`1`}})
+	}
+	if _, err := runBenchmark(newPager, 10, 0, 1); !errors.Is(err, failure) || err.Error() != "iteration 2 failed: request failed" {
+		t.Errorf("expected the failed iteration's error, got %v", err)
+	}
+	// Running stops at the failed iteration.
+	if pagers.Load() != 3 {
+		t.Errorf("expected 3 iterations, got %d", pagers.Load())
+	}
+
+	pagers.Store(0)
+	if _, err := runBenchmark(newPager, 10, 5, 1); !errors.Is(err, failure) || !strings.HasPrefix(err.Error(), "warmup failed: ") {
+		t.Errorf("expected the warmup's error, got %v", err)
+	}
+}
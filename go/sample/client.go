@@ -0,0 +1,87 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/emulator"
+)
+
+// ConnectionStringEnvVar is the environment variable holding the connection string used when neither the endpoint nor a way to authenticate is given.
+const ConnectionStringEnvVar = "AZURE_COSMOS_CONNECTION_STRING"
+
+// connection is the account the sample connects to, and how it authenticates.
+type connection struct {
+	endpoint string
+
+	// key is the account key, or "" to authenticate with DefaultAzureCredential, which covers the Azure CLI, environment variables, and managed identity.
+	key string
+}
+
+// resolveConnection returns the account to connect to, from the first of these that's given:
+//   - --connection-string, which can't be combined with --endpoint, --key, or --use-default-credential.
+//   - --use-default-credential, with --endpoint (which can't be combined with --key).
+//   - --endpoint or --key, using the emulator's for the other.
+//   - The connection string in the AZURE_COSMOS_CONNECTION_STRING environment variable.
+//   - The emulator's endpoint and key.
+//
+// The conflicting combinations are rejected by parseArgs.
+func resolveConnection(opts options, getenv func(string) string) (connection, error) {
+	switch {
+	case opts.connectionString != "":
+		return parseConnectionString(opts.connectionString)
+	case opts.useDefaultCredential:
+		return connection{endpoint: valueOrDefault(opts.endpoint, emulator.Endpoint)}, nil
+	case opts.endpoint != "" || opts.key != "":
+		return connection{endpoint: valueOrDefault(opts.endpoint, emulator.Endpoint), key: valueOrDefault(opts.key, emulator.Key)}, nil
+	}
+	if connectionString := getenv(ConnectionStringEnvVar); connectionString != "" {
+		conn, err := parseConnectionString(connectionString)
+		if err != nil {
+			return connection{}, fmt.Errorf("%s is invalid: %w", ConnectionStringEnvVar, err)
+		}
+		return conn, nil
+	}
+	return connection{endpoint: emulator.Endpoint, key: emulator.Key}, nil
+}
+
+func valueOrDefault(value, def string) string {
+	if value != "" {
+		return value
+	}
+	return def
+}
+
+// parseConnectionString extracts the endpoint and key of a connection string, such as "AccountEndpoint=https://myaccount.documents.azure.com:443/;AccountKey=...;".
+// The names of its settings aren't case-sensitive, and settings other than the endpoint and key are ignored.
+func parseConnectionString(connectionString string) (connection, error) {
+	var conn connection
+	for _, setting := range strings.Split(connectionString, ";") {
+		if strings.TrimSpace(setting) == "" {
+			continue
+		}
+		// Keys are base64, so they can contain '='.
+		name, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return connection{}, fmt.Errorf("the connection string setting %q isn't of the form Name=Value", setting)
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "accountendpoint":
+			conn.endpoint = strings.TrimSpace(value)
+		case "accountkey":
+			conn.key = strings.TrimSpace(value)
+		}
+	}
+	if conn.endpoint == "" || conn.key == "" {
+		return connection{}, fmt.Errorf("the connection string must have both an AccountEndpoint and an AccountKey")
+	}
+	endpoint, err := url.Parse(conn.endpoint)
+	if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+		return connection{}, fmt.Errorf("the connection string's AccountEndpoint %q isn't an http or https URL", conn.endpoint)
+	}
+	return conn, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/emulator"
+)
+
+const testConnectionString = "AccountEndpoint=https://myaccount.documents.azure.com:443/;AccountKey=a2V5==;"
+
+func TestResolveConnection(t *testing.T) {
+	envConnectionString := "AccountEndpoint=https://env.documents.azure.com:443/;AccountKey=ZW52;"
+	emulatorConnection := connection{endpoint: emulator.Endpoint, key: emulator.Key}
+	cases := []struct {
+		name     string
+		opts     options
+		env      string
+		expected connection
+	}{
+		{"emulator by default", options{}, "", emulatorConnection},
+		{"environment over the emulator", options{}, envConnectionString, connection{endpoint: "https://env.documents.azure.com:443/", key: "ZW52"}},
+		{"connection string over the environment", options{connectionString: testConnectionString}, envConnectionString, connection{endpoint: "https://myaccount.documents.azure.com:443/", key: "a2V5=="}},
+		{"key over the environment", options{key: "a2V5"}, envConnectionString, connection{endpoint: emulator.Endpoint, key: "a2V5"}},
+		{"endpoint over the environment", options{endpoint: "https://other:8081"}, envConnectionString, connection{endpoint: "https://other:8081", key: emulator.Key}},
+		{"endpoint and key", options{endpoint: "https://other:8081", key: "a2V5"}, "", connection{endpoint: "https://other:8081", key: "a2V5"}},
+		{"default credential over the environment", options{useDefaultCredential: true, endpoint: "https://other:8081"}, envConnectionString, connection{endpoint: "https://other:8081"}},
+		{"default credential for the emulator", options{useDefaultCredential: true}, "", connection{endpoint: emulator.Endpoint}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			getenv := func(name string) string {
+				if name == ConnectionStringEnvVar {
+					return c.env
+				}
+				return ""
+			}
+			conn, err := resolveConnection(c.opts, getenv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conn != c.expected {
+				t.Errorf("expected %+v, got %+v", c.expected, conn)
+			}
+		})
+	}
+
+	_, err := resolveConnection(options{}, func(string) string { return "AccountKey=a2V5" })
+	if err == nil || !strings.HasPrefix(err.Error(), ConnectionStringEnvVar+" is invalid") {
+		t.Errorf("expected an error naming the environment variable, got %v", err)
+	}
+}
+
+func TestParseConnectionString(t *testing.T) {
+	// Names aren't case-sensitive, other settings are ignored, and the key keeps its padding.
+	conn, err := parseConnectionString(" accountendpoint=https://myaccount.documents.azure.com:443/ ; ACCOUNTKEY=a2V5== ;Database=db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (connection{endpoint: "https://myaccount.documents.azure.com:443/", key: "a2V5=="}); conn != expected {
+		t.Errorf("expected %+v, got %+v", expected, conn)
+	}
+
+	for connectionString, message := range map[string]string{
+		"":                                    "must have both an AccountEndpoint and an AccountKey",
+		"AccountEndpoint=https://example":     "must have both an AccountEndpoint and an AccountKey",
+		"AccountKey=a2V5":                     "must have both an AccountEndpoint and an AccountKey",
+		"AccountEndpoint=https://example;key": `the connection string setting "key" isn't of the form Name=Value`,
+		"AccountEndpoint=example;AccountKey=a2V5":          `AccountEndpoint "example" isn't an http or https URL`,
+		"AccountEndpoint=ftp://example;AccountKey=a2V5":    `AccountEndpoint "ftp://example" isn't an http or https URL`,
+		"AccountEndpoint=https://;AccountKey=a2V5":         `AccountEndpoint "https://" isn't an http or https URL`,
+		"AccountEndpoint=https://example;AccountKey=  ;  ": "must have both an AccountEndpoint and an AccountKey",
+	} {
+		if _, err := parseConnectionString(connectionString); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected an error containing %q for %q, got %v", message, connectionString, err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wI2L/jsondiff"
+)
+
+// errResultsDiffer is returned by --compare when the query returns different items with the query engine than without it.
+var errResultsDiffer = errors.New("the results with and without the query engine differ")
+
+// systemPropertyIgnores are the JSON pointers of the system properties Cosmos DB adds to items, which aren't compared.
+var systemPropertyIgnores = jsondiff.Ignores("/_etag", "/_rid", "/_self", "/_ts", "/_attachments")
+
+// difference is a difference between the items returned with the query engine and those returned without it.
+type difference struct {
+	// item identifies the item: its index, or its id if the items were matched by id.
+	item    string
+	message string
+}
+
+func (d difference) String() string {
+	return fmt.Sprintf("%s: %s", d.item, d.message)
+}
+
+// collectItems returns every item the pager returns.
+func collectItems(pager queryPager) ([][]byte, error) {
+	var items [][]byte
+	for pager.More() {
+		page, err := pager.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+// compareItems compares the items returned with the query engine with those returned without it, in order.
+func compareItems(withEngine, withoutEngine [][]byte) ([]difference, error) {
+	var differences []difference
+	for i := 0; i < max(len(withEngine), len(withoutEngine)); i++ {
+		item := fmt.Sprintf("item %d", i)
+		switch {
+		case i >= len(withEngine):
+			differences = append(differences, difference{item, fmt.Sprintf("only returned without the engine: %s", withoutEngine[i])})
+		case i >= len(withoutEngine):
+			differences = append(differences, difference{item, fmt.Sprintf("only returned with the engine: %s", withEngine[i])})
+		default:
+			d, err := compareItem(item, withEngine[i], withoutEngine[i])
+			if err != nil {
+				return nil, err
+			}
+			if d != nil {
+				differences = append(differences, *d)
+			}
+		}
+	}
+	return differences, nil
+}
+
+// compareItemsByID compares the items returned with the query engine with those returned without it, matching them by their id, for queries whose results have no defined order.
+// Items in different partitions can share an id, so items with the same id are matched in the order they were returned.
+func compareItemsByID(withEngine, withoutEngine [][]byte) ([]difference, error) {
+	withEngineByID, ids, err := groupByID(withEngine, "with")
+	if err != nil {
+		return nil, err
+	}
+	withoutEngineByID, withoutEngineIDs, err := groupByID(withoutEngine, "without")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range withoutEngineIDs {
+		if _, ok := withEngineByID[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+
+	var differences []difference
+	for _, id := range ids {
+		with, without := withEngineByID[id], withoutEngineByID[id]
+		for i := 0; i < max(len(with), len(without)); i++ {
+			item := fmt.Sprintf("id %q", id)
+			if max(len(with), len(without)) > 1 {
+				item = fmt.Sprintf("id %q (%d)", id, i)
+			}
+			switch {
+			case i >= len(with):
+				differences = append(differences, difference{item, fmt.Sprintf("only returned without the engine: %s", without[i])})
+			case i >= len(without):
+				differences = append(differences, difference{item, fmt.Sprintf("only returned with the engine: %s", with[i])})
+			default:
+				d, err := compareItem(item, with[i], without[i])
+				if err != nil {
+					return nil, err
+				}
+				if d != nil {
+					differences = append(differences, *d)
+				}
+			}
+		}
+	}
+	return differences, nil
+}
+
+// groupByID groups items by their id, returning the ids in the order they were first returned.
+func groupByID(items [][]byte, engine string) (map[string][][]byte, []string, error) {
+	byID := make(map[string][][]byte)
+	var ids []string
+	for i, item := range items {
+		var withID struct {
+			ID *string `json:"id"`
+		}
+		if err := json.Unmarshal(item, &withID); err != nil || withID.ID == nil {
+			return nil, nil, fmt.Errorf("item %d returned %s the engine has no id, but --compare-unordered matches items by their id: %s", i, engine, item)
+		}
+		if _, ok := byID[*withID.ID]; !ok {
+			ids = append(ids, *withID.ID)
+		}
+		byID[*withID.ID] = append(byID[*withID.ID], item)
+	}
+	return byID, ids, nil
+}
+
+// compareItem compares an item returned with the query engine with one returned without it, ignoring system properties.
+func compareItem(item string, withEngine, withoutEngine []byte) (*difference, error) {
+	patch, err := jsondiff.CompareJSON(withoutEngine, withEngine, systemPropertyIgnores)
+	if err != nil {
+		return nil, fmt.Errorf("error comparing %s: %w", item, err)
+	}
+	if len(patch) == 0 {
+		return nil, nil
+	}
+	// Items that aren't objects, or whose types differ, are replaced whole.
+	if len(patch) == 1 && patch[0].Path == "" {
+		return &difference{item, fmt.Sprintf("is %s with the engine, but %s without it", withEngine, withoutEngine)}, nil
+	}
+	changes := make([]string, 0, len(patch))
+	for _, op := range patch {
+		changes = append(changes, formatOperation(op))
+	}
+	return &difference{item, strings.Join(changes, "; ")}, nil
+}
+
+// formatOperation describes an operation of the patch from an item returned without the query engine to the one returned with it.
+func formatOperation(op jsondiff.Operation) string {
+	switch op.Type {
+	case jsondiff.OperationAdd:
+		return fmt.Sprintf("%s is only returned with the engine: %s", op.Path, formatValue(op.Value))
+	case jsondiff.OperationRemove:
+		return fmt.Sprintf("%s is only returned without the engine: %s", op.Path, formatValue(op.OldValue))
+	case jsondiff.OperationReplace:
+		return fmt.Sprintf("%s is %s with the engine, but %s without it", op.Path, formatValue(op.Value), formatValue(op.OldValue))
+	default:
+		return op.String()
+	}
+}
+
+func formatValue(value interface{}) string {
+	formatted, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(formatted)
+}
+
+// reportDifferences prints the number of items returned with and without the query engine, and the first maxDifferences differences between them.
+func reportDifferences(out io.Writer, withEngine, withoutEngine int, differences []difference, maxDifferences int) {
+	fmt.Fprintf(out, "compared %d items with the query engine and %d without it: %d differences\n", withEngine, withoutEngine, len(differences))
+	for i, d := range differences {
+		if maxDifferences > 0 && i >= maxDifferences {
+			fmt.Fprintf(out, "(%d more differences)\n", len(differences)-i)
+			break
+		}
+		fmt.Fprintln(out, d)
+	}
+}
+
+// compareQuery runs the query with the query engine and then without it, and reports the differences between the items each returned.
+// It returns errResultsDiffer if there are any.
+func compareQuery(withEngine, withoutEngine queryPager, unordered bool, maxDifferences int, out io.Writer) error {
+	withEngineItems, err := collectItems(withEngine)
+	if err != nil {
+		return fmt.Errorf("running the query with the query engine failed: %w", err)
+	}
+	withoutEngineItems, err := collectItems(withoutEngine)
+	if err != nil {
+		return fmt.Errorf("running the query without the query engine failed: %w", err)
+	}
+
+	var differences []difference
+	if unordered {
+		differences, err = compareItemsByID(withEngineItems, withoutEngineItems)
+	} else {
+		differences, err = compareItems(withEngineItems, withoutEngineItems)
+	}
+	if err != nil {
+		return err
+	}
+	reportDifferences(out, len(withEngineItems), len(withoutEngineItems), differences, maxDifferences)
+	if len(differences) > 0 {
+		return errResultsDiffer
+	}
+	return nil
+}
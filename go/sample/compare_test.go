@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func pagerOf(pages ...fakePage) *fakePager {
+	return &fakePager{pages: pages, charges: &chargeMeter{}, clock: &fakeClock{}}
+}
+
+func TestCompareQueryMatches(t *testing.T) {
+	// System properties differ between runs of a query, and aren't compared, nor is how the items are split into pages.
+	withEngine := pagerOf(fakePage{items: []string{`{"id":"1","n":1,"_etag":"a","_ts":1}`, `{"id":"2","n":2.0}`}})
+	withoutEngine := pagerOf(fakePage{items: []string{`{"n":1,"id":"1","_etag":"b","_ts":2}`}}, fakePage{items: []string{`{"id":"2","n":2}`}})
+	var output bytes.Buffer
+	if err := compareQuery(withEngine, withoutEngine, false, 10, &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "compared 2 items with the query engine and 2 without it: 0 differences\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+func TestCompareQueryDiffers(t *testing.T) {
+	withEngine := pagerOf(fakePage{items: []string{`{"id":"1","n":1}`, `{"id":"2","n":2}`, `{"id":"3","n":3}`}})
+	withoutEngine := pagerOf(fakePage{items: []string{`{"id":"1","n":10}`, `{"id":"3","n":3}`}})
+	var output bytes.Buffer
+	if err := compareQuery(withEngine, withoutEngine, false, 2, &output); !errors.Is(err, errResultsDiffer) {
+		t.Fatalf("expected errResultsDiffer, got %v", err)
+	}
+	expected := "" +
+		"compared 3 items with the query engine and 2 without it: 3 differences\n" +
+		"item 0: /n is 1 with the engine, but 10 without it\n" +
+		`item 1: /id is "2" with the engine, but "3" without it; /n is 2 with the engine, but 3 without it` + "\n" +
+		"(1 more differences)\n"
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
+
+func TestCompareQueryUnordered(t *testing.T) {
+	// Items are matched by id, and items with the same id in different partitions are matched in order.
+	withEngine := pagerOf(fakePage{items: []string{`{"id":"2","pk":"a"}`, `{"id":"1"}`, `{"id":"2","pk":"b"}`, `{"id":"4"}`}})
+	withoutEngine := pagerOf(fakePage{items: []string{`{"id":"1"}`, `{"id":"3"}`, `{"id":"2","pk":"a"}`, `{"id":"2","pk":"c"}`}})
+	var output bytes.Buffer
+	if err := compareQuery(withEngine, withoutEngine, true, 0, &output); !errors.Is(err, errResultsDiffer) {
+		t.Fatalf("expected errResultsDiffer, got %v", err)
+	}
+	expected := "" +
+		"compared 4 items with the query engine and 4 without it: 3 differences\n" +
+		`id "2" (1): /pk is "b" with the engine, but "c" without it` + "\n" +
+		`id "4": only returned with the engine: {"id":"4"}` + "\n" +
+		`id "3": only returned without the engine: {"id":"3"}` + "\n"
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output.String())
+	}
+
+	// Properties only one of the items has, and items that aren't objects, are reported too.
+	output.Reset()
+	withEngine = pagerOf(fakePage{items: []string{`{"id":"1","a":1}`, `1`}})
+	withoutEngine = pagerOf(fakePage{items: []string{`{"id":"1","b":[2]}`, `"1"`}})
+	if err := compareQuery(withEngine, withoutEngine, false, 0, &output); !errors.Is(err, errResultsDiffer) {
+		t.Fatalf("expected errResultsDiffer, got %v", err)
+	}
+	expected = "" +
+		"compared 2 items with the query engine and 2 without it: 2 differences\n" +
+		"item 0: /a is only returned with the engine: 1; /b is only returned without the engine: [2]\n" +
+		`item 1: is 1 with the engine, but "1" without it` + "\n"
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output.String())
+	}
+
+	withEngine = pagerOf(fakePage{items: []string{`{"id":"1"}`}})
+	withoutEngine = pagerOf(fakePage{items: []string{`42`}})
+	err := compareQuery(withEngine, withoutEngine, true, 0, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "item 0 returned without the engine has no id") {
+		t.Errorf("expected an error for an item without an id, got %v", err)
+	}
+}
+
+func TestCompareQueryFails(t *testing.T) {
+	failure := errors.New("cross-partition ORDER BY isn't supported")
+	err := compareQuery(pagerOf(), pagerOf(fakePage{err: failure}), false, 0, &bytes.Buffer{})
+	if !errors.Is(err, failure) || !strings.Contains(err.Error(), "without the query engine") {
+		t.Errorf("expected the error of the run without the engine, got %v", err)
+	}
+}
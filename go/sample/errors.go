@@ -0,0 +1,128 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// Exit codes of the sample.
+const (
+	exitRuntimeError  = 1
+	exitUsage         = 2
+	exitAuth          = 3
+	exitNotFound      = 4
+	exitThrottled     = 5
+	exitEngineError   = 6
+	exitResultsDiffer = 7
+)
+
+// failure is what the sample reports about an error it stops with, and the code it exits with.
+type failure struct {
+	exitCode int
+
+	// message describes the error, without the details below, which are only set for the kind of error they describe.
+	message string
+
+	// status, errorCode, serverMessage, activityID, and request describe a response error from the service.
+	status        int
+	errorCode     string
+	serverMessage string
+	activityID    string
+	request       string
+
+	// resultCode is the kind of error the query engine reported.
+	resultCode azcosmoscx.ResultCode
+}
+
+// classifyError returns the failure the error is reported as: a response error from the service is unwrapped to show its details,
+// and exits with a code for authentication failures, missing resources, and throttling, and the query engine's errors exit with their own code.
+func classifyError(err error) failure {
+	f := failure{exitCode: exitRuntimeError, message: err.Error()}
+
+	var responseErr *azcore.ResponseError
+	var authErr *azidentity.AuthenticationFailedError
+	var engineErr *azcosmoscx.Error
+	switch {
+	case errors.Is(err, errResultsDiffer):
+		f.exitCode = exitResultsDiffer
+	case errors.As(err, &responseErr):
+		// The response error's own message spans several lines, so it's replaced by its details, keeping what the sample said it was doing.
+		f.message = strings.TrimSuffix(strings.TrimSuffix(err.Error(), responseErr.Error()), ": ")
+		if f.message == "" {
+			f.message = "the request failed"
+		}
+		f.status = responseErr.StatusCode
+		f.errorCode = responseErr.ErrorCode
+		if resp := responseErr.RawResponse; resp != nil {
+			f.activityID = resp.Header.Get("x-ms-activity-id")
+			f.serverMessage = serverMessage(resp)
+			if resp.Request != nil {
+				f.request = resp.Request.Method + " " + resp.Request.URL.String()
+			}
+		}
+		switch responseErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			f.exitCode = exitAuth
+		case http.StatusNotFound:
+			f.exitCode = exitNotFound
+		case http.StatusTooManyRequests:
+			f.exitCode = exitThrottled
+		}
+	case errors.As(err, &authErr):
+		f.exitCode = exitAuth
+	case errors.As(err, &engineErr):
+		f.exitCode = exitEngineError
+		f.resultCode = engineErr.ResultCode()
+	}
+	return f
+}
+
+// serverMessage returns the message of the service's error response, which is a JSON object with a code and message, or the whole body if it isn't one.
+func serverMessage(resp *http.Response) string {
+	body, err := runtime.Payload(resp)
+	if err != nil {
+		return ""
+	}
+	var response struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && response.Message != "" {
+		return strings.TrimSpace(response.Message)
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// print writes the failure, with a line for each of its details.
+func (f failure) print(out io.Writer) {
+	fmt.Fprintf(out, "Error: %s\n", f.message)
+	if f.status != 0 {
+		fmt.Fprintf(out, "  status: %d %s\n", f.status, http.StatusText(f.status))
+	}
+	if f.errorCode != "" {
+		fmt.Fprintf(out, "  error code: %s\n", f.errorCode)
+	}
+	if f.serverMessage != "" {
+		fmt.Fprintf(out, "  message: %s\n", strings.ReplaceAll(strings.ReplaceAll(f.serverMessage, "\r\n", "\n"), "\n", "\n    "))
+	}
+	if f.activityID != "" {
+		fmt.Fprintf(out, "  activity id: %s\n", f.activityID)
+	}
+	if f.request != "" {
+		fmt.Fprintf(out, "  request: %s\n", f.request)
+	}
+	if f.exitCode == exitEngineError {
+		fmt.Fprintf(out, "  engine result code: %s (%d)\n", f.resultCode, int(f.resultCode))
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// newResponseError returns the error azcore returns for the gateway's response with the status and body.
+func newResponseError(t *testing.T, status int, body string) error {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "https://example.documents.azure.com/dbs/db/colls/c/docs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set("x-ms-activity-id", "2a3b4c5d-0000-0000-0000-000000000000")
+	header.Set("Content-Type", "application/json")
+	return runtime.NewResponseError(&http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(body)), Request: req})
+}
+
+func TestClassifyError(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		err      error
+		exitCode int
+	}{
+		{"unauthorized", newResponseError(t, http.StatusUnauthorized, `{"code":"Unauthorized","message":"The input authorization token can't serve the request."}`), exitAuth},
+		{"forbidden", newResponseError(t, http.StatusForbidden, `{"code":"Forbidden","message":"Request blocked by Auth"}`), exitAuth},
+		{"not found", fmt.Errorf("failed to read container c: %w", newResponseError(t, http.StatusNotFound, `{"code":"NotFound","message":"Resource Not Found"}`)), exitNotFound},
+		{"throttled", &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}, exitThrottled},
+		{"bad request", newResponseError(t, http.StatusBadRequest, `{"code":"BadRequest","message":"Syntax error"}`), exitRuntimeError},
+		{"credential", fmt.Errorf("getting a token: %w", &azidentity.AuthenticationFailedError{}), exitAuth},
+		{"engine", fmt.Errorf("creating the pipeline: %w", azcosmoscx.ErrUnsupportedQueryPlan), exitEngineError},
+		{"results differ", errResultsDiffer, exitResultsDiffer},
+		{"other", errors.New("no query was given"), exitRuntimeError},
+	} {
+		if actual := classifyError(c.err).exitCode; actual != c.exitCode {
+			t.Errorf("%s: expected exit code %d, got %d", c.name, c.exitCode, actual)
+		}
+	}
+}
+
+func TestClassifyResponseError(t *testing.T) {
+	f := classifyError(fmt.Errorf("failed to read container c: %w", newResponseError(t, http.StatusNotFound, `{"code":"NotFound","message":"Message: {\"Errors\":[\"Resource Not Found.\"]}\r\nActivityId: 2a3b4c5d"}`)))
+	var out strings.Builder
+	f.print(&out)
+	expected := `Error: failed to read container c
+  status: 404 Not Found
+  error code: NotFound
+  message: Message: {"Errors":["Resource Not Found."]}
+    ActivityId: 2a3b4c5d
+  activity id: 2a3b4c5d-0000-0000-0000-000000000000
+  request: POST https://example.documents.azure.com/dbs/db/colls/c/docs
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	// Without a JSON body, the body is the message, and an unwrapped error has nothing to add to the status.
+	f = classifyError(newResponseError(t, http.StatusServiceUnavailable, "upstream unavailable"))
+	if f.message != "the request failed" || f.serverMessage != "upstream unavailable" || f.status != http.StatusServiceUnavailable {
+		t.Errorf("unexpected failure %+v", f)
+	}
+
+	// A synthetic error, without a response, still has its status.
+	out.Reset()
+	classifyError(&azcore.ResponseError{StatusCode: http.StatusTooManyRequests, ErrorCode: "TooManyRequests"}).print(&out)
+	if expected := "Error: the request failed\n  status: 429 Too Many Requests\n  error code: TooManyRequests\n"; out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestClassifyEngineError(t *testing.T) {
+	var out strings.Builder
+	classifyError(fmt.Errorf("the pipeline failed: %w", azcosmoscx.ErrInvalidQuery)).print(&out)
+	expected := fmt.Sprintf("Error: the pipeline failed: invalid query\n  engine result code: invalid query (%d)\n", int(azcosmoscx.ResultCodeInvalidQuery))
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// gatewayAPIVersion is the version of the gateway's REST API that the requests are made with, which is the SDK's.
+const gatewayAPIVersion = "2020-11-05"
+
+// gatewayClient requests the query plan and partition key ranges of a container from the account's gateway, as the SDK does before creating a pipeline.
+// The SDK doesn't expose those requests, so they're made with azcore, authenticating like the SDK.
+type gatewayClient struct {
+	endpoint string
+	pipeline runtime.Pipeline
+}
+
+// newGatewayClient creates a client for the account, authenticating with its key, or with DefaultAzureCredential if it has none.
+func newGatewayClient(conn connection, options azcore.ClientOptions) (*gatewayClient, error) {
+	var auth policy.Policy
+	if conn.key == "" {
+		credential, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, err
+		}
+		endpoint, err := url.Parse(conn.endpoint)
+		if err != nil {
+			return nil, err
+		}
+		auth = &tokenAuthPolicy{credential: credential, scope: fmt.Sprintf("%s://%s/.default", endpoint.Scheme, endpoint.Hostname())}
+	} else {
+		key, err := base64.StdEncoding.DecodeString(conn.key)
+		if err != nil {
+			return nil, fmt.Errorf("the account key isn't base64: %w", err)
+		}
+		auth = &keyAuthPolicy{key: key}
+	}
+	pipeline := runtime.NewPipeline("sample", "v0.0.0", runtime.PipelineOptions{PerRetry: []policy.Policy{auth}}, &options)
+	return &gatewayClient{endpoint: conn.endpoint, pipeline: pipeline}, nil
+}
+
+// queryPlan returns the gateway's plan for the query and its parameters, telling it which query features the engine supports, exactly as the gateway returned it.
+func (c *gatewayClient) queryPlan(ctx context.Context, database, container, query string, parameters []azcosmos.QueryParameter, supportedFeatures string) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, containerPath(database, container)+"/docs")
+	if err != nil {
+		return nil, err
+	}
+	if parameters == nil {
+		parameters = []azcosmos.QueryParameter{}
+	}
+	if err := runtime.MarshalAsJSON(req, map[string]any{"query": query, "parameters": parameters}); err != nil {
+		return nil, err
+	}
+	header := req.Raw().Header
+	header.Set("Content-Type", "application/query+json")
+	header.Set("x-ms-documentdb-query", "True")
+	header.Set("x-ms-documentdb-query-enablecrosspartition", "True")
+	header.Set("x-ms-cosmos-is-query-plan-request", "True")
+	header.Set("x-ms-cosmos-supported-query-features", supportedFeatures)
+	return c.do(req)
+}
+
+// partitionKeyRanges returns the container's partition key ranges, in the `{"PartitionKeyRanges": [...]}` form the gateway returns them in.
+func (c *gatewayClient) partitionKeyRanges(ctx context.Context, database, container string) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, containerPath(database, container)+"/pkranges")
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *gatewayClient) newRequest(ctx context.Context, method, path string) (*policy.Request, error) {
+	req, err := runtime.NewRequest(ctx, method, runtime.JoinPaths(c.endpoint, path))
+	if err != nil {
+		return nil, err
+	}
+	req.Raw().Header.Set("x-ms-version", gatewayAPIVersion)
+	return req, nil
+}
+
+// do sends the request and returns the body of its response, or an error for a response that isn't a success.
+func (c *gatewayClient) do(req *policy.Request) ([]byte, error) {
+	resp, err := c.pipeline.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, runtime.NewResponseError(resp)
+	}
+	return runtime.Payload(resp)
+}
+
+func containerPath(database, container string) string {
+	return "dbs/" + url.PathEscape(database) + "/colls/" + url.PathEscape(container)
+}
+
+// keyAuthPolicy signs each request with the account key, as the gateway requires.
+// See https://learn.microsoft.com/rest/api/cosmos-db/access-control-on-cosmosdb-resources.
+type keyAuthPolicy struct {
+	key []byte
+}
+
+func (p *keyAuthPolicy) Do(req *policy.Request) (*http.Response, error) {
+	// The signature covers the date, so each retry is dated and signed again.
+	date := time.Now().UTC().Format(http.TimeFormat)
+	req.Raw().Header.Set("x-ms-date", date)
+	req.Raw().Header.Set("Authorization", p.authorization(req.Raw().Method, req.Raw().URL.Path, date))
+	return req.Next()
+}
+
+// authorization returns the Authorization header of a request for the path, made at the date.
+func (p *keyAuthPolicy) authorization(method, path, date string) string {
+	resourceType, resourceLink := resourceOf(path)
+	stringToSign := strings.ToLower(method) + "\n" + strings.ToLower(resourceType) + "\n" + resourceLink + "\n" + strings.ToLower(date) + "\n\n"
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(stringToSign))
+	return url.QueryEscape("type=master&ver=1.0&sig=" + base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// resourceOf returns the type and link of the resource a request for the path is signed for.
+// A path with an odd number of segments, like dbs/db/colls/c/docs, is for a feed, which is signed for its parent,
+// and one with an even number, like dbs/db/colls/c, is for the resource itself.
+func resourceOf(path string) (resourceType string, resourceLink string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments)%2 == 1 {
+		return segments[len(segments)-1], strings.Join(segments[:len(segments)-1], "/")
+	}
+	return segments[len(segments)-2], strings.Join(segments, "/")
+}
+
+// tokenAuthPolicy authorizes each request with a Microsoft Entra token for the account, in the form the gateway expects.
+// The credential caches its tokens, so one is only requested when it's about to expire.
+type tokenAuthPolicy struct {
+	credential azcore.TokenCredential
+	scope      string
+}
+
+func (p *tokenAuthPolicy) Do(req *policy.Request) (*http.Response, error) {
+	token, err := p.credential.GetToken(req.Raw().Context(), policy.TokenRequestOptions{Scopes: []string{p.scope}})
+	if err != nil {
+		return nil, err
+	}
+	req.Raw().Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Raw().Header.Set("Authorization", "type=aad&ver=1.0&sig="+token.Token)
+	return req.Next()
+}
@@ -0,0 +1,177 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+const testKey = "a2V5"
+
+// recordedGateway serves the responses recorded in testdata/gateway, and keeps the requests it receives.
+type recordedGateway struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func newRecordedGateway(t *testing.T) *recordedGateway {
+	g := &recordedGateway{}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		g.mu.Lock()
+		g.requests = append(g.requests, r)
+		g.bodies = append(g.bodies, string(body))
+		g.mu.Unlock()
+
+		var recorded string
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/dbs/db/colls/c/docs" && r.Header.Get("x-ms-cosmos-is-query-plan-request") == "True":
+			recorded = "plan.json"
+		case r.Method == http.MethodGet && r.URL.Path == "/dbs/db/colls/c/pkranges":
+			recorded = "pkranges.json"
+		case r.Method == http.MethodGet && r.URL.Path == "/dbs/db/colls/c":
+			w.Write([]byte(`{"id":"c"}`))
+			return
+		case r.Method == http.MethodGet && r.URL.Path == "/":
+			w.Write([]byte(`{}`))
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"NotFound","message":"Resource Not Found"}`))
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", "gateway", recorded))
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(g.Close)
+	return g
+}
+
+func (g *recordedGateway) lastRequest() (*http.Request, string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.requests[len(g.requests)-1], g.bodies[len(g.bodies)-1]
+}
+
+func newTestGatewayClient(t *testing.T, endpoint string) *gatewayClient {
+	t.Helper()
+	client, err := newGatewayClient(connection{endpoint: endpoint, key: testKey}, azcore.ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestGatewayQueryPlan(t *testing.T) {
+	gateway := newRecordedGateway(t)
+	plan, err := newTestGatewayClient(t, gateway.URL).queryPlan(context.Background(), "db", "c", "SELECT TOP @n * FROM c ORDER BY c.value", []azcosmos.QueryParameter{{Name: "@n", Value: 10}}, "OrderBy,Top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded, _ := os.ReadFile(filepath.Join("testdata", "gateway", "plan.json")); string(plan) != string(recorded) {
+		t.Errorf("expected the recorded plan, got %s", plan)
+	}
+
+	req, body := gateway.lastRequest()
+	for header, expected := range map[string]string{
+		"Content-Type":                         "application/query+json",
+		"x-ms-documentdb-query":                "True",
+		"x-ms-cosmos-is-query-plan-request":    "True",
+		"x-ms-cosmos-supported-query-features": "OrderBy,Top",
+		"x-ms-version":                         gatewayAPIVersion,
+	} {
+		if actual := req.Header.Get(header); actual != expected {
+			t.Errorf("expected %s to be %q, got %q", header, expected, actual)
+		}
+	}
+	if expected := `{"parameters":[{"name":"@n","value":10}],"query":"SELECT TOP @n * FROM c ORDER BY c.value"}`; body != expected {
+		t.Errorf("expected the body %s, got %s", expected, body)
+	}
+	if expected := (&keyAuthPolicy{key: []byte("key")}).authorization(http.MethodPost, "/dbs/db/colls/c/docs", req.Header.Get("x-ms-date")); req.Header.Get("Authorization") != expected {
+		t.Errorf("expected the request to be signed for the container's documents, got %s", req.Header.Get("Authorization"))
+	}
+}
+
+func TestGatewayPartitionKeyRanges(t *testing.T) {
+	gateway := newRecordedGateway(t)
+	pkranges, err := newTestGatewayClient(t, gateway.URL).partitionKeyRanges(context.Background(), "db", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded, _ := os.ReadFile(filepath.Join("testdata", "gateway", "pkranges.json")); string(pkranges) != string(recorded) {
+		t.Errorf("expected the recorded partition key ranges, got %s", pkranges)
+	}
+
+	_, err = newTestGatewayClient(t, gateway.URL).partitionKeyRanges(context.Background(), "db", "missing")
+	var responseErr *azcore.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a response error for the missing container, got %v", err)
+	}
+}
+
+func TestKeyAuthPolicyMatchesSDK(t *testing.T) {
+	// The SDK signs a request to the account, a container, and its partition key ranges feed; each must be signed the same way.
+	gateway := newRecordedGateway(t)
+	credential, err := azcosmos.NewKeyCredential(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := azcosmos.NewClientWithKey(gateway.URL, credential, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container, err := client.NewContainer("db", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := container.Read(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := container.GetFeedRanges(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &keyAuthPolicy{key: []byte("key")}
+	paths := make(map[string]bool)
+	for _, req := range gateway.requests {
+		paths[req.URL.Path] = true
+		if expected := policy.authorization(req.Method, req.URL.Path, req.Header.Get("x-ms-date")); req.Header.Get("Authorization") != expected {
+			t.Errorf("%s %s: expected the SDK's signature %s, got %s", req.Method, req.URL.Path, req.Header.Get("Authorization"), expected)
+		}
+	}
+	if !paths["/"] || !paths["/dbs/db/colls/c"] || !paths["/dbs/db/colls/c/pkranges"] {
+		t.Errorf("expected requests to the account, container, and partition key ranges, got %v", paths)
+	}
+}
+
+func TestResourceOf(t *testing.T) {
+	for path, expected := range map[string][2]string{
+		"/":                        {"", ""},
+		"/dbs/db":                  {"dbs", "dbs/db"},
+		"/dbs/db/colls/c":          {"colls", "dbs/db/colls/c"},
+		"/dbs/db/colls/c/docs":     {"docs", "dbs/db/colls/c"},
+		"/dbs/db/colls/c/pkranges": {"pkranges", "dbs/db/colls/c"},
+	} {
+		if resourceType, resourceLink := resourceOf(path); resourceType != expected[0] || resourceLink != expected[1] {
+			t.Errorf("%s: expected %v, got %s and %s", path, expected, resourceType, resourceLink)
+		}
+	}
+}
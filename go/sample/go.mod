@@ -1,20 +1,34 @@
 module github.com/Azure/azure-cosmos-client-engine/go/sample
 
-go 1.23.5
+go 1.23.6
 
-replace (
-	github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx => ../azcosmoscx
-)
+replace github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx => ../azcosmoscx
+
+replace github.com/Azure/azure-cosmos-client-engine/go/internal => ../internal
 
 require (
 	github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx v1.5.0-beta.3
-	github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos v1.4.0
+	github.com/Azure/azure-cosmos-client-engine/go/internal v0.0.0-00010101000000-000000000000
+	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.18.1
+	github.com/Azure/azure-sdk-for-go/sdk/azidentity v1.10.1
+	github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos v1.5.0-beta.3
+	github.com/wI2L/jsondiff v0.6.1
 )
 
 require (
 	github.com/Azure/azure-sdk-for-go v68.0.0+incompatible // indirect
-	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.17.1 // indirect
 	github.com/Azure/azure-sdk-for-go/sdk/internal v1.11.1 // indirect
-	golang.org/x/net v0.38.0 // indirect
-	golang.org/x/text v0.23.0 // indirect
+	github.com/AzureAD/microsoft-authentication-library-for-go v1.4.2 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/kylelemons/godebug v1.1.0 // indirect
+	github.com/pkg/browser v0.0.0-20240102092130-5ac0b6a4141c // indirect
+	github.com/tidwall/gjson v1.18.0 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.1 // indirect
+	github.com/tidwall/sjson v1.2.5 // indirect
+	golang.org/x/crypto v0.40.0 // indirect
+	golang.org/x/net v0.42.0 // indirect
+	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
 )
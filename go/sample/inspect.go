@@ -0,0 +1,89 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// The subcommands, which print what the gateway returns for the query engine instead of running a query.
+const (
+	commandPlan               = "plan"
+	commandPartitionKeyRanges = "pkranges"
+)
+
+// inspect runs the plan or pkranges subcommand, printing the gateway's response to out, and writing it to --out exactly as it was returned,
+// so that it can be used as the plan.json or pkranges.json of a fixture.
+func inspect(ctx context.Context, gateway *gatewayClient, opts options, parameters []azcosmos.QueryParameter, out io.Writer) error {
+	var response []byte
+	var err error
+	if opts.command == commandPlan {
+		response, err = gateway.queryPlan(ctx, opts.database, opts.container, opts.query, parameters, azcosmoscx.SupportedFeatures())
+	} else {
+		response, err = gateway.partitionKeyRanges(ctx, opts.database, opts.container)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.out != "" {
+		if err := os.WriteFile(opts.out, response, 0o644); err != nil {
+			return err
+		}
+	}
+	if opts.command == commandPlan {
+		return printPlan(out, response)
+	}
+	return printPartitionKeyRanges(out, response)
+}
+
+// printPlan prints the query plan, and the features it requires, and whether the engine supports them.
+func printPlan(out io.Writer, plan []byte) error {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, plan, "", "  "); err != nil {
+		return fmt.Errorf("the query plan isn't JSON: %w", err)
+	}
+	support, err := azcosmoscx.CheckQueryPlan(string(plan))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, indented.String())
+	fmt.Fprintf(out, "required features: %s\n", featureList(support.Required))
+	fmt.Fprintf(out, "supported features: %s\n", featureList(support.Supported))
+	fmt.Fprintf(out, "missing features: %s\n", featureList(support.Missing))
+	if support.IsSupported() {
+		fmt.Fprintln(out, "The engine supports this query.")
+	} else {
+		fmt.Fprintln(out, "The engine doesn't support this query.")
+	}
+	return nil
+}
+
+func featureList(features []string) string {
+	if len(features) == 0 {
+		return "(none)"
+	}
+	return strings.Join(features, ", ")
+}
+
+// printPartitionKeyRanges prints the ID and effective partition key bounds of each partition key range, checking that they're valid for the engine.
+func printPartitionKeyRanges(out io.Writer, pkranges []byte) error {
+	ranges, err := azcosmoscx.ParsePartitionKeyRanges(string(pkranges))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d partition key ranges:\n", len(ranges))
+	for _, r := range ranges {
+		fmt.Fprintf(out, "  %s: [%q, %q)\n", r.ID, r.MinInclusive, r.MaxExclusive)
+	}
+	return nil
+}
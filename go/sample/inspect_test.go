@@ -0,0 +1,73 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInspectPlan(t *testing.T) {
+	gateway := newRecordedGateway(t)
+	out := filepath.Join(t.TempDir(), "plan.json")
+	var output bytes.Buffer
+	opts := options{command: commandPlan, database: "db", container: "c", query: "SELECT TOP 10 * FROM c ORDER BY c.value", out: out}
+	if err := inspect(context.Background(), newTestGatewayClient(t, gateway.URL), opts, nil, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file has the plan exactly as the gateway returned it, so that it can be used in a fixture.
+	written, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded, _ := os.ReadFile(filepath.Join("testdata", "gateway", "plan.json")); !bytes.Equal(written, recorded) {
+		t.Errorf("expected the recorded plan, got %s", written)
+	}
+
+	for _, expected := range []string{
+		"\n  \"partitionedQueryExecutionInfoVersion\": 2,\n",
+		"\nrequired features: orderBy, top\nsupported features: orderBy, top\nmissing features: (none)\nThe engine supports this query.\n",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected the output to contain %q, got:\n%s", expected, output.String())
+		}
+	}
+}
+
+func TestInspectPartitionKeyRanges(t *testing.T) {
+	gateway := newRecordedGateway(t)
+	var output bytes.Buffer
+	opts := options{command: commandPartitionKeyRanges, database: "db", container: "c"}
+	if err := inspect(context.Background(), newTestGatewayClient(t, gateway.URL), opts, nil, &output); err != nil {
+		t.Fatal(err)
+	}
+	expected := `2 partition key ranges:
+  1: ["", "7FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF")
+  2: ["7FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "FF")
+`
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
+
+func TestPrintPlanUnsupported(t *testing.T) {
+	var output bytes.Buffer
+	plan := `{"partitionedQueryExecutionInfoVersion":1,"queryInfo":{"distinctType":"Unordered","groupByExpressions":["c.category"],"offset":5,"limit":5},"queryRanges":[]}`
+	if err := printPlan(&output, []byte(plan)); err != nil {
+		t.Fatal(err)
+	}
+	expected := "required features: offsetAndLimit, groupBy, distinct\nsupported features: offsetAndLimit\nmissing features: groupBy, distinct\nThe engine doesn't support this query.\n"
+	if !strings.HasSuffix(output.String(), expected) {
+		t.Errorf("expected the output to end with:\n%s\ngot:\n%s", expected, output.String())
+	}
+
+	if err := printPlan(&output, []byte(`{"partitionedQueryExecutionInfoVersion":`)); err == nil {
+		t.Error("expected an error for a plan that isn't JSON")
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+// Package results writes the items returned by a query, as newline-delimited JSON, a JSON array, or a table.
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Format is a way of writing items.
+type Format string
+
+const (
+	// FormatNDJSON writes each item as it was returned, on its own line.
+	FormatNDJSON Format = "ndjson"
+
+	// FormatJSON writes the items as a single indented JSON array, streaming each item as it's written.
+	FormatJSON Format = "json"
+
+	// FormatTable writes the top-level scalar properties of the items as aligned columns, once every item has been written.
+	FormatTable Format = "table"
+)
+
+// Formats are the supported formats, in the order they're listed in usage.
+var Formats = []Format{FormatNDJSON, FormatJSON, FormatTable}
+
+// ParseFormat parses the name of a format.
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if name == string(format) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format '%s', expected ndjson, json, or table", name)
+}
+
+// Writer writes items in a format. Close must be called once every item has been written, to finish the output.
+type Writer interface {
+	Write(item []byte) error
+	Close() error
+}
+
+// Options control how items are written.
+type Options struct {
+	// MaxRows is the most rows a table has; the number of other items is written after them. Zero is unlimited.
+	MaxRows int
+}
+
+// NewWriter returns a Writer that writes items to w in the format.
+func NewWriter(w io.Writer, format Format, options Options) (Writer, error) {
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonWriter{w: w}, nil
+	case FormatJSON:
+		return &jsonWriter{w: w}, nil
+	case FormatTable:
+		if options.MaxRows < 0 {
+			return nil, fmt.Errorf("the maximum number of rows must not be negative, but was %d", options.MaxRows)
+		}
+		return &tableWriter{w: w, maxRows: options.MaxRows}, nil
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", format)
+	}
+}
+
+type ndjsonWriter struct {
+	w io.Writer
+}
+
+func (n *ndjsonWriter) Write(item []byte) error {
+	_, err := fmt.Fprintf(n.w, "%s\n", item)
+	return err
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+type jsonWriter struct {
+	w     io.Writer
+	items int
+}
+
+func (j *jsonWriter) Write(item []byte) error {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, item, "  ", "  "); err != nil {
+		return fmt.Errorf("item %d isn't valid JSON: %w", j.items, err)
+	}
+	separator := ",\n  "
+	if j.items == 0 {
+		separator = "[\n  "
+	}
+	j.items++
+	_, err := fmt.Fprintf(j.w, "%s%s", separator, indented.Bytes())
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if j.items == 0 {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+// property is a top-level scalar property of an item, with its value formatted for a table cell.
+type property struct {
+	name  string
+	value string
+}
+
+type tableWriter struct {
+	w       io.Writer
+	maxRows int
+	columns []string
+	rows    []map[string]string
+	items   int
+}
+
+// valueColumn is the column of items that aren't objects, such as those of a SELECT VALUE query.
+const valueColumn = "(value)"
+
+func (t *tableWriter) Write(item []byte) error {
+	t.items++
+	if t.maxRows > 0 && len(t.rows) >= t.maxRows {
+		return nil
+	}
+	properties, err := scalarProperties(item)
+	if err != nil {
+		return fmt.Errorf("item %d isn't valid JSON: %w", t.items-1, err)
+	}
+	row := make(map[string]string, len(properties))
+	for _, property := range properties {
+		if !slices.Contains(t.columns, property.name) {
+			t.columns = append(t.columns, property.name)
+		}
+		row[property.name] = property.value
+	}
+	t.rows = append(t.rows, row)
+	return nil
+}
+
+func (t *tableWriter) Close() error {
+	var table bytes.Buffer
+	tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	if len(t.columns) > 0 {
+		fmt.Fprintln(tw, strings.Join(t.columns, "\t"))
+		for _, row := range t.rows {
+			cells := make([]string, len(t.columns))
+			for i, column := range t.columns {
+				cells[i] = row[column]
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// Rows that end with empty cells are padded to the last column, so trim them.
+	for _, line := range strings.SplitAfter(table.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(t.w, strings.TrimRight(line, " \n")); err != nil {
+			return err
+		}
+	}
+	if omitted := t.items - len(t.rows); omitted > 0 {
+		_, err := fmt.Fprintf(t.w, "(%d more rows)\n", omitted)
+		return err
+	}
+	if t.items == 0 {
+		_, err := fmt.Fprintln(t.w, "(no rows)")
+		return err
+	}
+	return nil
+}
+
+// scalarProperties returns the top-level properties of an item that are strings, numbers, booleans, or null, in the order they appear,
+// skipping those that are objects or arrays. An item that isn't an object is a single property of valueColumn, unless it's an array.
+func scalarProperties(item []byte) ([]property, error) {
+	decoder := json.NewDecoder(bytes.NewReader(item))
+	decoder.UseNumber()
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+	case json.Delim('['):
+		return nil, skipValue(decoder)
+	default:
+		return []property{{valueColumn, formatCell(token)}}, nil
+	}
+
+	var properties []property
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		value, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if value == json.Delim('{') || value == json.Delim('[') {
+			if err := skipValue(decoder); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		properties = append(properties, property{key.(string), formatCell(value)})
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return properties, nil
+}
+
+// skipValue skips the rest of an object or array whose opening delimiter has been read.
+func skipValue(decoder *json.Decoder) error {
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// cellEscaper escapes the characters that would break a table's rows or columns.
+var cellEscaper = strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// formatCell formats a scalar JSON value for a table cell: strings without quotes, and numbers as they were written.
+func formatCell(value json.Token) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return cellEscaper.Replace(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// sampleItems are items as a query returns them, with nested objects and arrays, unicode, and properties that only some items have.
+var sampleItems = []string{
+	`{"id":"1","name":"Zoë","price":12.50,"tags":["a","b"],"address":{"city":"Zürich","zip":"8001"}}`,
+	`{"id":"2","name":"東京","price":1e3,"inStock":true,"address":null}`,
+	`{"id":"3","name":"tab\tand\nnewline","price":100000000000000000001,"note":null}`,
+}
+
+func write(t *testing.T, format Format, options Options, items []string) string {
+	t.Helper()
+	var output bytes.Buffer
+	writer, err := NewWriter(&output, format, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if err := writer.Write([]byte(item)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return output.String()
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range Formats {
+		parsed, err := ParseFormat(string(format))
+		if err != nil || parsed != format {
+			t.Errorf("expected %s, got %s (%v)", format, parsed, err)
+		}
+	}
+	if _, err := ParseFormat("csv"); err == nil || err.Error() != "unknown format 'csv', expected ndjson, json, or table" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	output := write(t, FormatNDJSON, Options{}, sampleItems)
+	if expected := strings.Join(sampleItems, "\n") + "\n"; output != expected {
+		t.Errorf("expected the items unchanged, got %q", output)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	output := write(t, FormatJSON, Options{}, sampleItems)
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte(output), &items); err != nil {
+		t.Fatalf("expected a JSON array, got %v:\n%s", err, output)
+	}
+	if len(items) != len(sampleItems) {
+		t.Fatalf("expected %d items, got %d", len(sampleItems), len(items))
+	}
+	for i, item := range items {
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, item); err != nil {
+			t.Fatal(err)
+		}
+		if compacted.String() != sampleItems[i] {
+			t.Errorf("item %d: expected %s, got %s", i, sampleItems[i], compacted.String())
+		}
+	}
+	if !strings.HasPrefix(output, "[\n  {\n    \"id\": \"1\",") || !strings.HasSuffix(output, "\n  }\n]\n") {
+		t.Errorf("expected an indented array, got:\n%s", output)
+	}
+}
+
+func TestJSONStreamsItems(t *testing.T) {
+	var output bytes.Buffer
+	writer, _ := NewWriter(&output, FormatJSON, Options{})
+	if err := writer.Write([]byte(`{"id":"1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "[\n  {\n    \"id\": \"1\"\n  }" {
+		t.Errorf("expected the first item to be written before the array is closed, got %q", output.String())
+	}
+	if err := writer.Write([]byte(`{"id":`)); err == nil {
+		t.Error("expected an error for an invalid item")
+	}
+}
+
+func TestJSONWithoutItems(t *testing.T) {
+	if output := write(t, FormatJSON, Options{}, nil); output != "[]\n" {
+		t.Errorf("expected an empty array, got %q", output)
+	}
+}
+
+func TestTable(t *testing.T) {
+	output := write(t, FormatTable, Options{}, sampleItems)
+	expected := "" +
+		"id  name               price                  inStock  address  note\n" +
+		"1   Zoë                12.50\n" +
+		"2   東京                 1e3                    true     null\n" +
+		"3   tab\\tand\\nnewline  100000000000000000001                    null\n"
+	if output != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestTableRowLimit(t *testing.T) {
+	output := write(t, FormatTable, Options{MaxRows: 1}, sampleItems)
+	expected := "" +
+		"id  name  price\n" +
+		"1   Zoë   12.50\n" +
+		"(2 more rows)\n"
+	if output != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	if _, err := NewWriter(&bytes.Buffer{}, FormatTable, Options{MaxRows: -1}); err == nil {
+		t.Error("expected an error for a negative row limit")
+	}
+}
+
+func TestTableValues(t *testing.T) {
+	output := write(t, FormatTable, Options{}, []string{`42`, `"Ωmega"`, `null`, `[1,2]`})
+	expected := "(value)\n42\nΩmega\nnull\n\n"
+	if output != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, output)
+	}
+	if output := write(t, FormatTable, Options{}, nil); output != "(no rows)\n" {
+		t.Errorf("expected no rows, got %q", output)
+	}
+}
+
+func TestTableInvalidItem(t *testing.T) {
+	writer, _ := NewWriter(&bytes.Buffer{}, FormatTable, Options{})
+	for _, item := range []string{`{"a":{"b":`, `{"a":`, ``} {
+		if err := writer.Write([]byte(item)); err == nil {
+			t.Errorf("expected an error for %q", item)
+		}
+	}
+}
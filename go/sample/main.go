@@ -5,10 +5,21 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
 	"os"
+	"strings"
 
 	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/emulator"
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/seeding"
+	"github.com/Azure/azure-cosmos-client-engine/go/sample/internal/results"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
 )
@@ -20,75 +31,525 @@ func getenvOrDefault(key, def string) string {
 	return def
 }
 
-func executeQuery(container *azcosmos.ContainerClient, query string, queryEngine queryengine.QueryEngine) {
-	// Query for all items
-	pager := container.NewQueryItemsPager(query, azcosmos.NewPartitionKey(), &azcosmos.QueryOptions{
-		QueryEngine: queryEngine,
-	})
+// explainingQueryEngine prints how the engine interpreted the query plan each time a pipeline is created.
+type explainingQueryEngine struct {
+	queryengine.QueryEngine
+}
+
+func (e explainingQueryEngine) CreateQueryPipeline(query string, plan string, pkranges string) (queryengine.QueryPipeline, error) {
+	pipeline, err := e.QueryEngine.CreateQueryPipeline(query, plan, pkranges)
+	if err != nil {
+		return nil, err
+	}
+
+	if explainable, ok := pipeline.(azcosmoscx.ExplainablePipeline); ok {
+		explanation, err := explainable.Explain()
+		if err != nil {
+			pipeline.Close()
+			return nil, err
+		}
+		fmt.Fprintln(os.Stderr, explanation)
+	}
+	return pipeline, nil
+}
+
+// logTurn prints what each turn of a pipeline did.
+func logTurn(turn azcosmoscx.TurnInfo) {
+	if turn.Err != nil {
+		fmt.Fprintf(os.Stderr, "turn %d: failed after %v: %v\n", turn.Turn, turn.NativeTime, turn.Err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "turn %d: %d items, requests %v, completed %t, %v in native code\n", turn.Turn, turn.Items, turn.Requests, turn.Completed, turn.NativeTime)
+}
+
+// replay re-executes a pipeline captured with azcosmoscx.WithCaptureDir (or the AZCOSMOSCX_CAPTURE_DIR environment variable), and reports whether it matched.
+func replay(dir string) error {
+	report, err := azcosmoscx.Replay(dir)
+	if err != nil {
+		return err
+	}
+	if !report.Matched() {
+		return fmt.Errorf("replay diverged after %d calls and %d matching items: %s", report.Calls, report.Items, report.Divergence)
+	}
+	fmt.Printf("Replay matched: %d calls, %d items\n", report.Calls, report.Items)
+	return nil
+}
+
+// queryPager is the part of the SDK's query pager that executeQuery uses.
+type queryPager interface {
+	More() bool
+	NextPage(ctx context.Context) (azcosmos.QueryItemsResponse, error)
+}
 
-	for pager.More() {
+// executeQuery writes every item the pager returns, or those of its first maxPages pages if maxPages isn't zero, recording each page with the metrics and diagnostics, if any.
+func executeQuery(pager queryPager, writer results.Writer, metrics *queryMetrics, diagnostics *pageDiagnostics, maxPages int) error {
+	metrics.begin()
+	for pages := 0; pager.More() && (maxPages == 0 || pages < maxPages); pages++ {
 		page, err := pager.NextPage(context.TODO())
 		if err != nil {
-			panic(err)
+			return err
 		}
+		metrics.page(len(page.Items))
+		diagnostics.page(len(page.Items))
 
 		for _, item := range page.Items {
-			fmt.Println(string(item))
+			if err := writer.Write(item); err != nil {
+				return err
+			}
 		}
 	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	metrics.end()
+	return nil
 }
 
-func main() {
-	endpoint := "https://localhost:8081"
-	key := "C2y6yDjf5/R+ob0N8A7Cgv30VRDJIWEHLM+4QDU5DE2nQ9nDuVTqobD4b8mGGyPMbIZnqyMsEcaGQy67XIw/Jw=="
-	databaseName := "SampleDB"
-	containerName := "SampleContainer"
-
-	var query string
-
-	for i := 1; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		switch arg {
-		case "--endpoint":
-			endpoint = os.Args[i+1]
-			i++
-		case "--key":
-			key = os.Args[i+1]
-			i++
-		case "--database":
-			databaseName = os.Args[i+1]
-			i++
-		case "--container":
-			containerName = os.Args[i+1]
-			i++
-		default:
-			query = arg
-		}
-	}
-
-	if len(query) == 0 {
-		fmt.Println("Usage: sample --endpoint ENDPOINT --key KEY --database DATABASE --container CONTAINER QUERY")
-		os.Exit(1)
-	}
-
-	cred, err := azcosmos.NewKeyCredential(key)
+// options are the sample's command-line options.
+type options struct {
+	endpoint  string
+	key       string
+	insecure  bool
+	caCert    string
+	database  string
+	container string
+	explain   bool
+	selfTest  bool
+	logTurns  bool
+	verbose   bool
+	metrics   bool
+	replayDir string
+	format    results.Format
+	out       string
+	maxRows   int
+	query     string
+
+	// maxItemCount is the most items in each page, or 0 for the default.
+	maxItemCount       int
+	maxPages           int
+	printContinuations bool
+
+	// compare runs the query with and without the query engine and reports the differences, instead of writing the items.
+	compare          bool
+	compareUnordered bool
+	maxDiffs         int
+
+	// connectionString and useDefaultCredential are alternatives to the key (see resolveConnection).
+	connectionString     string
+	useDefaultCredential bool
+
+	// repeat runs the query this many times and reports its latency and throughput, instead of writing the items.
+	repeat      int
+	warmup      int
+	concurrency int
+	report      string
+
+	// offlineDir is the fixture to run offline, instead of querying an account, and captureDir is where to write the query's fixture.
+	offlineDir string
+	captureDir string
+
+	// command is the subcommand, commandPlan, commandPartitionKeyRanges, or commandSeed, or "" to run the query.
+	command string
+
+	// parameters are those given with --param and --param-json, which follow those in parametersFile (see queryParameters).
+	parametersFile string
+	parameters     []azcosmos.QueryParameter
+
+	// documentsFile is the file of documents the seed subcommand loads, into a container it creates with these options.
+	documentsFile     string
+	partitionKeyPaths string
+	throughput        string
+	indexingPolicy    string
+	vectorPolicy      string
+	drop              bool
+}
+
+// parseArgs parses the command-line arguments, without the program name, writing the usage and any error to output.
+// The query can come before, between, or after the flags, and everything after "--" is part of it.
+// It returns flag.ErrHelp if the usage was asked for with -h.
+func parseArgs(args []string, output io.Writer) (options, error) {
+	var opts options
+	flags := flag.NewFlagSet("sample", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&opts.endpoint, "endpoint", "", "the account `endpoint` (the emulator's by default)")
+	flags.StringVar(&opts.key, "key", "", "the account `key` (the emulator's by default)")
+	flags.StringVar(&opts.connectionString, "connection-string", "", "the account's connection `string`, instead of its endpoint and key (read from "+ConnectionStringEnvVar+" if neither is given)")
+	flags.BoolVar(&opts.useDefaultCredential, "use-default-credential", false, "authenticate with DefaultAzureCredential, such as the Azure CLI's login or a managed identity, instead of a key")
+	flags.BoolVar(&opts.insecure, "insecure", false, "skip verifying the account's TLS certificate, which is only done by default for local endpoints like the emulator's")
+	flags.StringVar(&opts.caCert, "ca-cert", "", "trust the certificates in the PEM `file`, such as the emulator's, instead of skipping verification for local endpoints")
+	flags.StringVar(&opts.database, "database", "SampleDB", "the `database` to query, or for seed, to create")
+	flags.StringVar(&opts.container, "container", "SampleContainer", "the `container` to query, or for seed, to create")
+	flags.BoolVar(&opts.explain, "explain", false, "print how the engine interpreted the query plan")
+	flags.BoolVar(&opts.selfTest, "self-test", false, "check that the native engine works before connecting")
+	flags.BoolVar(&opts.logTurns, "log-turns", false, "print what each turn of the pipeline did")
+	flags.BoolVar(&opts.verbose, "verbose", false, "print, for each page, the requests the engine made and the continuations they resume from, how many of its items were buffered, and the engine's stats")
+	flags.BoolVar(&opts.metrics, "metrics", false, "print the request charge, items, and time of each page, and a summary with the engine's stats")
+	flags.StringVar(&opts.replayDir, "replay", "", "replay the pipeline captured in `dir`, instead of running a query")
+	flags.BoolVar(&opts.compare, "compare", false, "run the query with and without the query engine, and print the differences between the items, instead of the items")
+	flags.BoolVar(&opts.compareUnordered, "compare-unordered", false, "like --compare, but match the items by their id, for queries whose results have no defined order")
+	flags.IntVar(&opts.maxDiffs, "max-diffs", 10, "the most `differences` --compare prints, or 0 for no limit")
+	format := flags.String("format", string(results.FormatNDJSON), "write the items as ndjson (each on its own line), json (a single array), or table (their top-level scalar properties)")
+	flags.StringVar(&opts.out, "out", "", "write the items to `file`, instead of stdout, or with plan or pkranges, also write the gateway's response to it")
+	flags.IntVar(&opts.maxRows, "max-rows", 100, "the most `rows` a table has, or 0 for no limit")
+	flags.IntVar(&opts.maxItemCount, "max-item-count", 0, "the most `items` in each page, or 0 for the default")
+	flags.IntVar(&opts.maxPages, "max-pages", 0, "stop after reading this many `pages`, or 0 to read every page")
+	flags.BoolVar(&opts.printContinuations, "print-continuations", false, "print the continuation each partition was last read at, once the query stops")
+	flags.IntVar(&opts.repeat, "repeat", 0, "run the query this many `times`, each with a new pipeline, and print its latency and throughput instead of the items")
+	flags.IntVar(&opts.warmup, "warmup", 0, "with --repeat, first run the query this many `times` without measuring it")
+	flags.IntVar(&opts.concurrency, "concurrency", 1, "with --repeat, the most `queries` to run at once, or for seed, the most documents to insert at once (16 by default)")
+	flags.StringVar(&opts.report, "report", "", "with --repeat, also write the latency and throughput to `file` as JSON")
+	flags.StringVar(&opts.offlineDir, "offline", "", "run the query in the fixture in `dir` from its pages, without an account, instead of a query")
+	flags.StringVar(&opts.captureDir, "capture", "", "also write the query, its plan and partition key ranges, and the pages it read to `dir`, as a fixture for --offline")
+	flags.StringVar(&opts.parametersFile, "parameters-file", "", "read the query's parameters from the JSON `file`, either an object of names and values or an array of objects with a name and value")
+	flags.Func("param", "add a query parameter, given as `name=value`, whose value is null, true, false, or a number if it looks like one, or else a string (repeatable)", func(param string) error {
+		parameter, err := parseParam(param)
+		opts.parameters = append(opts.parameters, parameter)
+		return err
+	})
+	flags.Func("param-json", "add a query parameter, given as `name=JSON`, for objects, arrays, and strings that look like another type (repeatable)", func(param string) error {
+		parameter, err := parseParamJSON(param)
+		opts.parameters = append(opts.parameters, parameter)
+		return err
+	})
+	flags.StringVar(&opts.partitionKeyPaths, "partition-key-path", "/id", "for seed, the container's partition key `path`, or comma-separated paths for a hierarchical partition key")
+	flags.StringVar(&opts.throughput, "throughput", "", "for seed, the container's `RU/s`, or autoscale:<max RU/s>, instead of leaving it to the account")
+	flags.StringVar(&opts.indexingPolicy, "indexing-policy", "", "for seed, create the container with the indexing policy in the JSON `file`")
+	flags.StringVar(&opts.vectorPolicy, "vector-policy", "", "for seed, create the container with the vector embedding policy in the JSON `file`")
+	flags.BoolVar(&opts.drop, "drop", false, "for seed, delete the container, if it exists, and create it again before loading the documents")
+	flags.Usage = func() {
+		fmt.Fprintln(output, "Usage: sample [--endpoint ENDPOINT] [--key KEY | --use-default-credential | --connection-string STRING] [--insecure | --ca-cert FILE] [--database DATABASE] [--container CONTAINER] [--explain] [--self-test] [--log-turns] [--verbose] [--metrics] [--format ndjson|json|table] [--out FILE] [--max-rows ROWS] [--max-item-count ITEMS] [--max-pages PAGES] [--print-continuations] [--capture DIR] [--parameters-file FILE] [--param NAME=VALUE ...] [--param-json NAME=JSON ...] QUERY")
+		fmt.Fprintln(output, "       sample [--endpoint ENDPOINT] [--key KEY | --use-default-credential | --connection-string STRING] [--insecure | --ca-cert FILE] [--database DATABASE] [--container CONTAINER] [--explain] [--self-test] [--log-turns] [--max-item-count ITEMS] --compare|--compare-unordered [--max-diffs DIFFERENCES] [--parameters-file FILE] [--param NAME=VALUE ...] [--param-json NAME=JSON ...] QUERY")
+		fmt.Fprintln(output, "       sample [--endpoint ENDPOINT] [--key KEY | --use-default-credential | --connection-string STRING] [--insecure | --ca-cert FILE] [--database DATABASE] [--container CONTAINER] [--max-item-count ITEMS] --repeat TIMES [--warmup TIMES] [--concurrency QUERIES] [--report FILE] [--parameters-file FILE] [--param NAME=VALUE ...] [--param-json NAME=JSON ...] QUERY")
+		fmt.Fprintln(output, "       sample [--explain] [--log-turns] [--verbose] [--metrics] [--format ndjson|json|table] [--out FILE] [--max-rows ROWS] [--max-item-count ITEMS] [--max-pages PAGES] [--print-continuations] --offline DIR")
+		fmt.Fprintln(output, "       sample plan [--endpoint ENDPOINT] [--key KEY | --use-default-credential | --connection-string STRING] [--insecure | --ca-cert FILE] [--database DATABASE] [--container CONTAINER] [--out FILE] [--parameters-file FILE] [--param NAME=VALUE ...] [--param-json NAME=JSON ...] QUERY")
+		fmt.Fprintln(output, "       sample pkranges [--endpoint ENDPOINT] [--key KEY | --use-default-credential | --connection-string STRING] [--insecure | --ca-cert FILE] [--database DATABASE] [--container CONTAINER] [--out FILE]")
+		fmt.Fprintln(output, "       sample seed [--endpoint ENDPOINT] [--key KEY | --use-default-credential | --connection-string STRING] [--insecure | --ca-cert FILE] [--database DATABASE] [--container CONTAINER] [--partition-key-path PATH[,PATH...]] [--throughput RUS | --throughput autoscale:RUS] [--indexing-policy FILE] [--vector-policy FILE] [--drop] [--concurrency DOCUMENTS] FILE")
+		fmt.Fprintln(output, "       sample --replay DIR")
+		flags.PrintDefaults()
+	}
+
+	if len(args) > 0 && (args[0] == commandPlan || args[0] == commandPartitionKeyRanges || args[0] == commandSeed) {
+		opts.command, args = args[0], args[1:]
+	}
+
+	// The flag package stops at the first argument that isn't a flag, so parse again after each one.
+	var queries []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return options{}, err
+		}
+		rest := flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			queries = append(queries, rest...)
+			break
+		}
+		queries = append(queries, rest[0])
+		args = rest[1:]
+	}
+
+	opts.compare = opts.compare || opts.compareUnordered
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if opts.command == commandSeed && !set["concurrency"] {
+		opts.concurrency = seeding.DefaultConcurrency
+	}
+	// conflicting returns the flags that were set among names.
+	conflicting := func(names ...string) string {
+		var given []string
+		for _, name := range names {
+			if set[name] {
+				given = append(given, "--"+name)
+			}
+		}
+		return strings.Join(given, ", ")
+	}
+	itemFlags := []string{"format", "out", "max-rows", "metrics", "verbose", "max-pages", "print-continuations", "replay"}
+	notComparable := conflicting(itemFlags...)
+	notRepeatable := conflicting(append(itemFlags, "explain", "log-turns", "compare", "compare-unordered")...)
+	repeatOnly := conflicting("warmup", "concurrency", "report")
+	notOffline := conflicting("endpoint", "key", "connection-string", "use-default-credential", "insecure", "ca-cert", "database", "container",
+		"compare", "compare-unordered", "repeat", "replay", "capture", "parameters-file", "param", "param-json")
+	notCapturable := conflicting("compare", "compare-unordered", "repeat", "replay")
+	notInspectable := conflicting("explain", "log-turns", "verbose", "metrics", "replay", "format", "max-rows", "max-item-count", "max-pages", "print-continuations",
+		"compare", "compare-unordered", "max-diffs", "repeat", "warmup", "concurrency", "report", "offline", "capture")
+	notSeedable := conflicting("explain", "log-turns", "verbose", "metrics", "replay", "format", "out", "max-rows", "max-item-count", "max-pages", "print-continuations",
+		"compare", "compare-unordered", "max-diffs", "repeat", "warmup", "report", "offline", "capture", "parameters-file", "param", "param-json")
+	seedOnly := conflicting("partition-key-path", "throughput", "indexing-policy", "vector-policy", "drop")
+
+	var err error
+	opts.format, err = results.ParseFormat(*format)
+	switch {
+	case err != nil:
+	case opts.maxRows < 0:
+		err = fmt.Errorf("--max-rows must not be negative, but was %d", opts.maxRows)
+	case opts.connectionString != "" && (opts.endpoint != "" || opts.key != "" || opts.useDefaultCredential):
+		err = errors.New("--connection-string has the endpoint and key, so it can't be combined with --endpoint, --key, or --use-default-credential")
+	case opts.useDefaultCredential && opts.key != "":
+		err = errors.New("--use-default-credential authenticates without a key, so it can't be combined with --key")
+	case opts.insecure && opts.caCert != "":
+		err = errors.New("--insecure skips verifying the account's certificate, so it can't be combined with --ca-cert")
+	case opts.maxItemCount < 0 || opts.maxItemCount > math.MaxInt32:
+		err = fmt.Errorf("--max-item-count must be between 0 and %d, but was %d", math.MaxInt32, opts.maxItemCount)
+	case opts.maxPages < 0:
+		err = fmt.Errorf("--max-pages must not be negative, but was %d", opts.maxPages)
+	case opts.maxDiffs < 0:
+		err = fmt.Errorf("--max-diffs must not be negative, but was %d", opts.maxDiffs)
+	case opts.concurrency < 1:
+		err = fmt.Errorf("--concurrency must be at least 1, but was %d", opts.concurrency)
+	case opts.command != commandSeed && seedOnly != "":
+		err = fmt.Errorf("%s only apply to the seed subcommand", seedOnly)
+	case opts.command == commandSeed && notSeedable != "":
+		err = fmt.Errorf("the seed subcommand loads documents instead of running a query, so it can't be combined with %s", notSeedable)
+	case opts.command == commandSeed:
+		if len(queries) != 1 {
+			err = fmt.Errorf("the seed subcommand takes the file of documents to load, but got %d arguments", len(queries))
+		} else if _, err = parseThroughput(opts.throughput); err == nil {
+			opts.documentsFile = queries[0]
+		}
+	case opts.command != "" && notInspectable != "":
+		err = fmt.Errorf("the %s subcommand prints the gateway's response, so it can't be combined with %s", opts.command, notInspectable)
+	case opts.compare && notComparable != "":
+		err = fmt.Errorf("--compare prints the differences instead of the items, so it can't be combined with %s", notComparable)
+	case opts.repeat < 0 || opts.warmup < 0:
+		err = fmt.Errorf("--repeat and --warmup must not be negative, but were %d and %d", opts.repeat, opts.warmup)
+	case opts.repeat == 0 && repeatOnly != "":
+		err = fmt.Errorf("%s only apply to --repeat", repeatOnly)
+	case opts.repeat > 0 && notRepeatable != "":
+		err = fmt.Errorf("--repeat prints the latency and throughput instead of the items, so it can't be combined with %s", notRepeatable)
+	case opts.offlineDir != "" && notOffline != "":
+		err = fmt.Errorf("--offline reads the pages from the fixture instead of an account, so it can't be combined with %s", notOffline)
+	case opts.captureDir != "" && notCapturable != "":
+		err = fmt.Errorf("--capture records a single run of the query, so it can't be combined with %s", notCapturable)
+	case opts.replayDir != "" && len(queries) > 0:
+		err = fmt.Errorf("--replay doesn't take a query, but got %d", len(queries))
+	case opts.offlineDir != "" && len(queries) > 0:
+		err = fmt.Errorf("--offline runs the fixture's query, so it doesn't take one, but got %d", len(queries))
+	case opts.command == commandPartitionKeyRanges && conflicting("parameters-file", "param", "param-json") != "":
+		err = fmt.Errorf("the pkranges subcommand doesn't take a query, so it can't be combined with %s", conflicting("parameters-file", "param", "param-json"))
+	case opts.command == commandPartitionKeyRanges && len(queries) > 0:
+		err = fmt.Errorf("the pkranges subcommand doesn't take a query, but got %d", len(queries))
+	case opts.replayDir != "" || opts.offlineDir != "" || opts.command == commandPartitionKeyRanges:
+	case len(queries) == 0:
+		err = errors.New("no query was given")
+	case len(queries) > 1:
+		err = fmt.Errorf("expected exactly one query, but got %d; quote the query so that it's a single argument", len(queries))
+	default:
+		opts.query = queries[0]
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(output, err)
+		flags.Usage()
+		return options{}, err
 	}
+	return opts, nil
+}
 
-	azcosmoscx.EnableTracing()
+// newContainer connects to the account the options describe, recording the request charges with the meter.
+func newContainer(opts options, charges *chargeMeter) (*azcosmos.ContainerClient, error) {
+	client, err := newAccountClient(opts, charges)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewContainer(opts.database, opts.container)
+}
 
-	client, err := azcosmos.NewClientWithKey(endpoint, cred, nil)
+// newAccountClient connects to the account the options describe, recording the request charges with the meter.
+func newAccountClient(opts options, charges *chargeMeter) (*azcosmos.Client, error) {
+	conn, err := resolveConnection(opts, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	clientOptions, err := accountClientOptions(opts, conn, charges)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return emulator.NewClient(conn.endpoint, conn.key, &azcosmos.ClientOptions{ClientOptions: clientOptions})
+}
 
-	container, err := client.NewContainer(databaseName, containerName)
+// newGateway connects to the account the options describe with a gatewayClient, for the plan and pkranges subcommands.
+func newGateway(opts options) (*gatewayClient, error) {
+	conn, err := resolveConnection(opts, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	clientOptions, err := accountClientOptions(opts, conn, &chargeMeter{})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return newGatewayClient(conn, clientOptions)
+}
 
-	executeQuery(container, query, azcosmoscx.NewQueryEngine())
+// accountClientOptions returns the options of a client for the account, which record the request charges with the meter and verify its certificate as the options describe.
+func accountClientOptions(opts options, conn connection, charges *chargeMeter) (azcore.ClientOptions, error) {
+	clientOptions := azcore.ClientOptions{
+		PerRetryPolicies: []policy.Policy{charges},
+	}
+	tlsConfig, err := tlsConfig(conn.endpoint, opts.insecure, opts.caCert)
+	if err != nil {
+		return azcore.ClientOptions{}, err
+	}
+	if tlsConfig != nil {
+		if tlsConfig.InsecureSkipVerify {
+			fmt.Fprintf(os.Stderr, "WARNING: TLS certificate verification is disabled for %s. Anyone on the network path can impersonate the account. Use --ca-cert to trust the emulator's certificate instead.\n", conn.endpoint)
+		}
+		clientOptions.Transport = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	return clientOptions, nil
+}
+
+// run runs the query, offline or against the account, replays the capture, or runs the subcommand, described by the options.
+func run(opts options) error {
+	// Replaying a capture doesn't need a query or an account.
+	if opts.replayDir != "" {
+		return replay(opts.replayDir)
+	}
+
+	// Check that the native engine works before connecting, so that a mismatched library is reported up front.
+	if opts.selfTest {
+		if err := azcosmoscx.SelfTest(); err != nil {
+			return err
+		}
+	}
+
+	if opts.command == commandSeed {
+		charges := &chargeMeter{}
+		client, err := newAccountClient(opts, charges)
+		if err != nil {
+			return err
+		}
+		return seed(context.Background(), client, charges, opts, os.Stdout)
+	}
+
+	parameters, err := queryParameters(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.command != "" {
+		gateway, err := newGateway(opts)
+		if err != nil {
+			return err
+		}
+		return inspect(context.Background(), gateway, opts, parameters, os.Stdout)
+	}
+
+	azcosmoscx.EnableTracing()
+
+	// The SDK doesn't pass the page size hint on to the requests it makes for the engine, so the engine's target batch size limits its pages instead.
+	engineOptions := azcosmoscx.EngineOptions{TargetBatchSize: opts.maxItemCount}
+	var onTurn []func(azcosmoscx.TurnInfo)
+	if opts.logTurns {
+		onTurn = append(onTurn, logTurn)
+	}
+	var diagnostics *pageDiagnostics
+	if opts.verbose {
+		diagnostics = newPageDiagnostics(os.Stderr)
+		onTurn = append(onTurn, diagnostics.turn)
+	}
+	if len(onTurn) > 0 {
+		engineOptions.OnTurn = func(turn azcosmoscx.TurnInfo) {
+			for _, f := range onTurn {
+				f(turn)
+			}
+		}
+	}
+	var queryEngine queryengine.QueryEngine = azcosmoscx.NewQueryEngineWithOptions(engineOptions)
+	if opts.explain {
+		queryEngine = explainingQueryEngine{queryEngine}
+	}
+	pipelines := &trackingEngine{QueryEngine: queryEngine}
+	defer pipelines.Close()
+	if diagnostics != nil {
+		diagnostics.engine = pipelines
+	}
+	var engine queryengine.QueryEngine = pipelines
+	var recorder *fixtureRecorder
+	if opts.captureDir != "" {
+		recorder = &fixtureRecorder{QueryEngine: pipelines}
+		engine = recorder
+	}
+	charges := &chargeMeter{}
+	var metrics *queryMetrics
+	if opts.metrics {
+		metrics = newQueryMetrics(os.Stderr, charges, pipelines)
+	}
+
+	var pager queryPager
+	if opts.offlineDir != "" {
+		fixture, err := readFixture(opts.offlineDir)
+		if err != nil {
+			return err
+		}
+		pager, err = newOfflinePager(engine, fixture)
+		if err != nil {
+			return err
+		}
+	} else {
+		container, err := newContainer(opts, charges)
+		if err != nil {
+			return err
+		}
+		queryOptions := func(engine queryengine.QueryEngine) *azcosmos.QueryOptions {
+			return &azcosmos.QueryOptions{QueryEngine: engine, PageSizeHint: int32(opts.maxItemCount), QueryParameters: parameters}
+		}
+		if opts.repeat > 0 {
+			newPager := func() queryPager {
+				return container.NewQueryItemsPager(opts.query, azcosmos.NewPartitionKey(), queryOptions(engine))
+			}
+			summary, err := runBenchmark(newPager, opts.repeat, opts.warmup, opts.concurrency)
+			if err != nil {
+				return err
+			}
+			summary.print(os.Stdout)
+			if opts.report != "" {
+				return summary.writeReport(opts.report)
+			}
+			return nil
+		}
+
+		if opts.compare {
+			withEngine := container.NewQueryItemsPager(opts.query, azcosmos.NewPartitionKey(), queryOptions(engine))
+			withoutEngine := container.NewQueryItemsPager(opts.query, azcosmos.NewPartitionKey(), queryOptions(nil))
+			return compareQuery(withEngine, withoutEngine, opts.compareUnordered, opts.maxDiffs, os.Stdout)
+		}
+		pager = container.NewQueryItemsPager(opts.query, azcosmos.NewPartitionKey(), queryOptions(engine))
+	}
+
+	out := os.Stdout
+	if opts.out != "" {
+		var err error
+		out, err = os.Create(opts.out)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	writer, err := results.NewWriter(out, opts.format, results.Options{MaxRows: opts.maxRows})
+	if err != nil {
+		return err
+	}
+	if err := executeQuery(pager, writer, metrics, diagnostics, opts.maxPages); err != nil {
+		return err
+	}
+	if recorder != nil {
+		if err := recorder.write(opts.captureDir); err != nil {
+			return err
+		}
+	}
+	if opts.out != "" {
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+	if opts.printContinuations {
+		pipelines.printContinuations(os.Stderr)
+	}
+
+	// Stopping early leaves the pipeline open, so close it before checking for leaks.
+	pipelines.Close()
 
 	// Run leak checker
 	doLeakCheck()
@@ -96,4 +557,20 @@ func main() {
 	fmt.Println()
 	fmt.Println()
 	fmt.Println()
+	return nil
+}
+
+func main() {
+	opts, err := parseArgs(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(exitUsage)
+	}
+	if err := run(opts); err != nil {
+		failure := classifyError(err)
+		failure.print(os.Stderr)
+		os.Exit(failure.exitCode)
+	}
 }
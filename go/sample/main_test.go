@@ -0,0 +1,187 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/sample/internal/results"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// parsedOptions returns the default options, changed by set.
+func parsedOptions(set func(opts *options)) options {
+	opts := options{
+		database:  "SampleDB",
+		container: "SampleContainer",
+		format:    results.FormatNDJSON,
+		maxRows:   100,
+		maxDiffs:  10,
+
+		concurrency: 1,
+
+		partitionKeyPaths: "/id",
+	}
+	set(&opts)
+	return opts
+}
+
+func TestParseArgs(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []string
+		expected options
+	}{
+		{"defaults", []string{"SELECT * FROM c"}, parsedOptions(func(opts *options) { opts.query = "SELECT * FROM c" })},
+		{"flags", []string{"--endpoint", "https://example", "--key", "k", "--insecure", "--database", "db", "--container", "c", "--explain", "--self-test", "--log-turns", "--metrics", "SELECT 1"}, options{
+			endpoint: "https://example", key: "k", insecure: true, database: "db", container: "c", explain: true, selfTest: true, logTurns: true, metrics: true, query: "SELECT 1",
+			format: results.FormatNDJSON, maxRows: 100, maxDiffs: 10, concurrency: 1, partitionKeyPaths: "/id",
+		}},
+		{"repeat", []string{"--repeat", "10", "--warmup", "2", "--concurrency", "4", "--report", "bench.json", "--max-item-count", "100", "SELECT 1"}, parsedOptions(func(opts *options) {
+			opts.repeat, opts.warmup, opts.concurrency, opts.report, opts.maxItemCount, opts.query = 10, 2, 4, "bench.json", 100, "SELECT 1"
+		})},
+		{"connection string", []string{"--connection-string", "AccountEndpoint=https://example;AccountKey=k", "SELECT 1"}, parsedOptions(func(opts *options) {
+			opts.connectionString, opts.query = "AccountEndpoint=https://example;AccountKey=k", "SELECT 1"
+		})},
+		{"default credential", []string{"--use-default-credential", "--endpoint", "https://example", "SELECT 1"}, parsedOptions(func(opts *options) {
+			opts.useDefaultCredential, opts.endpoint, opts.query = true, "https://example", "SELECT 1"
+		})},
+		{"tls", []string{"--ca-cert", "emulator.pem", "SELECT 1"}, parsedOptions(func(opts *options) { opts.caCert, opts.query = "emulator.pem", "SELECT 1" })},
+		{"paging", []string{"--max-item-count", "5", "--max-pages", "2", "--print-continuations", "SELECT 1"}, parsedOptions(func(opts *options) {
+			opts.maxItemCount, opts.maxPages, opts.printContinuations, opts.query = 5, 2, true, "SELECT 1"
+		})},
+		{"compare", []string{"--compare", "--max-diffs", "0", "SELECT 1"}, parsedOptions(func(opts *options) {
+			opts.compare, opts.maxDiffs, opts.query = true, 0, "SELECT 1"
+		})},
+		{"compare unordered", []string{"--compare-unordered", "SELECT 1"}, parsedOptions(func(opts *options) {
+			opts.compare, opts.compareUnordered, opts.query = true, true, "SELECT 1"
+		})},
+		{"output", []string{"--format", "table", "--out", "items.txt", "--max-rows", "0", "SELECT 1"}, parsedOptions(func(opts *options) {
+			opts.format, opts.out, opts.maxRows, opts.query = results.FormatTable, "items.txt", 0, "SELECT 1"
+		})},
+		{"query before flags", []string{"SELECT 1", "-explain", "-database=db"}, parsedOptions(func(opts *options) {
+			opts.explain, opts.database, opts.query = true, "db", "SELECT 1"
+		})},
+		{"query after --", []string{"--explain", "--", "-1"}, parsedOptions(func(opts *options) { opts.explain, opts.query = true, "-1" })},
+		{"replay", []string{"--replay", "capture"}, parsedOptions(func(opts *options) { opts.replayDir = "capture" })},
+		{"offline", []string{"--offline", "fixture", "--metrics", "--max-item-count", "2"}, parsedOptions(func(opts *options) {
+			opts.offlineDir, opts.metrics, opts.maxItemCount = "fixture", true, 2
+		})},
+		{"verbose", []string{"--offline", "fixture", "--verbose"}, parsedOptions(func(opts *options) { opts.offlineDir, opts.verbose = "fixture", true })},
+		{"capture", []string{"--capture", "fixture", "SELECT 1"}, parsedOptions(func(opts *options) { opts.captureDir, opts.query = "fixture", "SELECT 1" })},
+		{"plan", []string{"plan", "--container", "c", "--out", "plan.json", "SELECT 1"}, parsedOptions(func(opts *options) {
+			opts.command, opts.container, opts.out, opts.query = commandPlan, "c", "plan.json", "SELECT 1"
+		})},
+		{"parameters", []string{"--parameters-file", "params.json", "--param", "x=1", "--param-json", `@o={"a":1}`, "--param", "s=abc", "SELECT @x, @o, @s"}, parsedOptions(func(opts *options) {
+			opts.parametersFile, opts.query = "params.json", "SELECT @x, @o, @s"
+			opts.parameters = []azcosmos.QueryParameter{{Name: "@x", Value: int64(1)}, {Name: "@o", Value: json.RawMessage(`{"a":1}`)}, {Name: "@s", Value: "abc"}}
+		})},
+		{"seed", []string{"seed", "--database", "db", "--container", "c", "--partition-key-path", "/tenant,/user", "--throughput", "autoscale:1000", "--indexing-policy", "indexing.json", "--vector-policy", "vector.json", "--drop", "docs.ndjson"}, parsedOptions(func(opts *options) {
+			opts.command, opts.database, opts.container, opts.documentsFile = commandSeed, "db", "c", "docs.ndjson"
+			opts.partitionKeyPaths, opts.throughput, opts.indexingPolicy, opts.vectorPolicy, opts.drop = "/tenant,/user", "autoscale:1000", "indexing.json", "vector.json", true
+			opts.concurrency = 16
+		})},
+		{"seed concurrency", []string{"seed", "--concurrency", "2", "docs.json"}, parsedOptions(func(opts *options) {
+			opts.command, opts.concurrency, opts.documentsFile = commandSeed, 2, "docs.json"
+		})},
+		{"pkranges", []string{"pkranges", "--use-default-credential"}, parsedOptions(func(opts *options) {
+			opts.command, opts.useDefaultCredential = commandPartitionKeyRanges, true
+		})},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var output bytes.Buffer
+			opts, err := parseArgs(c.args, &output)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\n%s", err, output.String())
+			}
+			if !reflect.DeepEqual(opts, c.expected) {
+				t.Errorf("expected %+v, got %+v", c.expected, opts)
+			}
+			if output.Len() != 0 {
+				t.Errorf("expected no output, got %q", output.String())
+			}
+		})
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		args    []string
+		message string
+	}{
+		{"no query", []string{"--explain"}, "no query was given"},
+		{"several queries", []string{"SELECT", "*", "FROM", "c"}, "expected exactly one query, but got 4"},
+		{"missing value", []string{"SELECT 1", "--key"}, "flag needs an argument: -key"},
+		{"unknown flag", []string{"--verbosity", "SELECT 1"}, "flag provided but not defined: -verbosity"},
+		{"unknown format", []string{"--format", "csv", "SELECT 1"}, "unknown format 'csv'"},
+		{"negative row limit", []string{"--max-rows", "-1", "SELECT 1"}, "--max-rows must not be negative, but was -1"},
+		{"connection string with a key", []string{"--connection-string", "AccountEndpoint=https://example;AccountKey=k", "--key", "k", "SELECT 1"}, "--connection-string has the endpoint and key"},
+		{"connection string with the default credential", []string{"--connection-string", "c", "--use-default-credential", "SELECT 1"}, "--connection-string has the endpoint and key"},
+		{"default credential with a key", []string{"--use-default-credential", "--key", "k", "SELECT 1"}, "--use-default-credential authenticates without a key"},
+		{"insecure with a certificate", []string{"--insecure", "--ca-cert", "emulator.pem", "SELECT 1"}, "--insecure skips verifying the account's certificate, so it can't be combined with --ca-cert"},
+		{"negative item count", []string{"--max-item-count", "-1", "SELECT 1"}, "--max-item-count must be between 0 and 2147483647, but was -1"},
+		{"item count too large", []string{"--max-item-count", "2147483648", "SELECT 1"}, "--max-item-count must be between 0 and 2147483647, but was 2147483648"},
+		{"negative page limit", []string{"--max-pages", "-1", "SELECT 1"}, "--max-pages must not be negative, but was -1"},
+		{"compare with a page limit", []string{"--compare", "--max-pages", "1", "SELECT 1"}, "can't be combined with --max-pages"},
+		{"negative repeat", []string{"--repeat", "-1", "SELECT 1"}, "--repeat and --warmup must not be negative, but were -1 and 0"},
+		{"no concurrency", []string{"--repeat", "1", "--concurrency", "0", "SELECT 1"}, "--concurrency must be at least 1, but was 0"},
+		{"warmup without repeat", []string{"--warmup", "1", "--report", "bench.json", "SELECT 1"}, "--warmup, --report only apply to --repeat"},
+		{"repeat with output flags", []string{"--repeat", "1", "--out", "items.json", "--explain", "SELECT 1"}, "can't be combined with --out, --explain"},
+		{"negative difference limit", []string{"--compare", "--max-diffs", "-1", "SELECT 1"}, "--max-diffs must not be negative, but was -1"},
+		{"compare with output flags", []string{"--compare-unordered", "--format", "json", "--metrics", "SELECT 1"}, "can't be combined with --format, --metrics"},
+		{"repeat verbosely", []string{"--repeat", "2", "--verbose", "SELECT 1"}, "can't be combined with --verbose"},
+		{"replay with a query", []string{"--replay", "capture", "SELECT 1"}, "--replay doesn't take a query, but got 1"},
+		{"offline with a query", []string{"--offline", "fixture", "SELECT 1"}, "--offline runs the fixture's query, so it doesn't take one, but got 1"},
+		{"offline with an account", []string{"--offline", "fixture", "--endpoint", "https://example", "--container", "c"}, "can't be combined with --endpoint, --container"},
+		{"offline with capture", []string{"--offline", "fixture", "--capture", "other"}, "can't be combined with --capture"},
+		{"plan without a query", []string{"plan", "--container", "c"}, "no query was given"},
+		{"pkranges with a query", []string{"pkranges", "SELECT 1"}, "the pkranges subcommand doesn't take a query, but got 1"},
+		{"plan with query flags", []string{"plan", "--explain", "--format", "json", "SELECT 1"}, "the plan subcommand prints the gateway's response, so it can't be combined with --explain, --format"},
+		{"parameter without a value", []string{"--param", "x", "SELECT @x"}, `invalid value "x" for flag -param: "x" isn't of the form name=value`},
+		{"parameter that isn't JSON", []string{"--param-json", "x={", "SELECT @x"}, "the value of @x isn't JSON: {"},
+		{"seed without documents", []string{"seed"}, "the seed subcommand takes the file of documents to load, but got 0 arguments"},
+		{"seed with a query", []string{"seed", "--max-pages", "1", "docs.json"}, "the seed subcommand loads documents instead of running a query, so it can't be combined with --max-pages"},
+		{"seed with invalid throughput", []string{"seed", "--throughput", "autoscale", "docs.json"}, `--throughput must be RU/s, or autoscale:<max RU/s>, but was "autoscale"`},
+		{"seed flags with a query", []string{"--drop", "--throughput", "400", "SELECT 1"}, "--throughput, --drop only apply to the seed subcommand"},
+		{"plan with seed flags", []string{"plan", "--partition-key-path", "/pk", "SELECT 1"}, "--partition-key-path only apply to the seed subcommand"},
+		{"pkranges with parameters", []string{"pkranges", "--param", "x=1"}, "the pkranges subcommand doesn't take a query, so it can't be combined with --param"},
+		{"capture with repeat", []string{"--capture", "fixture", "--repeat", "2", "SELECT 1"}, "--capture records a single run of the query, so it can't be combined with --repeat"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var output bytes.Buffer
+			_, err := parseArgs(c.args, &output)
+			if err == nil || !strings.Contains(err.Error(), c.message) {
+				t.Fatalf("expected an error containing %q, got %v", c.message, err)
+			}
+			if errors.Is(err, flag.ErrHelp) {
+				t.Errorf("expected a usage error, got %v", err)
+			}
+			if !strings.Contains(output.String(), c.message) || !strings.Contains(output.String(), "Usage: sample") {
+				t.Errorf("expected the error and the usage in the output, got %q", output.String())
+			}
+		})
+	}
+}
+
+func TestParseArgsHelp(t *testing.T) {
+	var output bytes.Buffer
+	_, err := parseArgs([]string{"-h"}, &output)
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("expected flag.ErrHelp, got %v", err)
+	}
+	for _, expected := range []string{"Usage: sample", "sample --replay DIR", "--offline DIR", "sample plan", "sample pkranges", "sample seed", "-endpoint endpoint", "-log-turns"} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected the usage to contain %q, got %q", expected, output.String())
+		}
+	}
+}
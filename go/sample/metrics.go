@@ -0,0 +1,125 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// chargeMeter adds up the request charges of the responses a client receives.
+// The SDK only reports the charge of the last request in each page it returns from the engine, so the charges are counted as they arrive instead.
+type chargeMeter struct {
+	mu    sync.Mutex
+	total float64
+}
+
+func (m *chargeMeter) add(charge float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total += charge
+}
+
+// Total returns the request charge of every response received so far, in request units.
+func (m *chargeMeter) Total() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+// Do records the request charge of each response, including those of requests that are retried.
+// The charge is also added to the meter of the request's context, if it has one (see withChargeMeter).
+func (m *chargeMeter) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	if resp != nil {
+		if charge, parseErr := strconv.ParseFloat(resp.Header.Get("x-ms-request-charge"), 64); parseErr == nil {
+			m.add(charge)
+			if scoped := contextChargeMeter(req.Raw().Context()); scoped != nil {
+				scoped.add(charge)
+			}
+		}
+	}
+	return resp, err
+}
+
+type chargeMeterKey struct{}
+
+// withChargeMeter returns a context whose requests' charges are added to the meter as well as the client's, so that the charges of queries running at once can be told apart.
+func withChargeMeter(ctx context.Context, meter *chargeMeter) context.Context {
+	return context.WithValue(ctx, chargeMeterKey{}, meter)
+}
+
+// contextChargeMeter returns the meter added to the context by withChargeMeter, or nil if it has none.
+func contextChargeMeter(ctx context.Context) *chargeMeter {
+	meter, _ := ctx.Value(chargeMeterKey{}).(*chargeMeter)
+	return meter
+}
+
+// queryMetrics prints the request charge, item count, and elapsed time of each page of a query, and a summary once it completes, for --metrics.
+// A nil *queryMetrics prints nothing.
+type queryMetrics struct {
+	out     io.Writer
+	charges *chargeMeter
+
+	// engine, if set, is the engine running the query, whose pipelines' stats are included in the summary.
+	engine *trackingEngine
+
+	// now returns the current time; it's replaced in tests.
+	now func() time.Time
+
+	start      time.Time
+	pageStart  time.Time
+	pageCharge float64
+	pages      int
+	items      int
+}
+
+func newQueryMetrics(out io.Writer, charges *chargeMeter, engine *trackingEngine) *queryMetrics {
+	return &queryMetrics{out: out, charges: charges, engine: engine, now: time.Now}
+}
+
+// begin starts timing the query and its first page.
+func (m *queryMetrics) begin() {
+	if m == nil {
+		return
+	}
+	m.start = m.now()
+	m.pageStart = m.start
+	m.pageCharge = m.charges.Total()
+}
+
+// page records and prints a page of the query, with the items it contained.
+func (m *queryMetrics) page(items int) {
+	if m == nil {
+		return
+	}
+	now := m.now()
+	total := m.charges.Total()
+	m.pages++
+	m.items += items
+	fmt.Fprintf(m.out, "page %d: %d items, %.2f RU, %v\n", m.pages, items, total-m.pageCharge, now.Sub(m.pageStart))
+	m.pageStart = now
+	m.pageCharge = total
+}
+
+// end prints the summary of the query.
+func (m *queryMetrics) end() {
+	if m == nil {
+		return
+	}
+	fmt.Fprintf(m.out, "total: %d pages, %d items, %.2f RU, %v\n", m.pages, m.items, m.charges.Total(), m.now().Sub(m.start))
+	if m.engine == nil {
+		return
+	}
+	stats, pipelines := m.engine.Stats()
+	fmt.Fprintf(m.out, "engine: %d pipelines, %d turns, %d items emitted, %d ProvideData calls, %d pages (%d bytes) provided, %v in native code\n",
+		pipelines, stats.Turns, stats.ItemsEmitted, stats.ProvideDataCalls, stats.PagesProvided, stats.BytesProvided, stats.NativeTime)
+}
@@ -0,0 +1,224 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/sample/internal/results"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// fakePage is a page a fakePager returns, and the request charge of the requests made to fetch it.
+type fakePage struct {
+	items  []string
+	charge float64
+	err    error
+}
+
+// fakePager returns its pages in order, adding each one's charge to the meter, if any, and that of the context,
+// and advancing the clock, if any, by a second as it's fetched.
+type fakePager struct {
+	pages   []fakePage
+	charges *chargeMeter
+	clock   *fakeClock
+}
+
+func (p *fakePager) More() bool {
+	return len(p.pages) > 0
+}
+
+func (p *fakePager) NextPage(ctx context.Context) (azcosmos.QueryItemsResponse, error) {
+	page := p.pages[0]
+	p.pages = p.pages[1:]
+	if p.charges != nil {
+		p.charges.add(page.charge)
+	}
+	if meter := contextChargeMeter(ctx); meter != nil {
+		meter.add(page.charge)
+	}
+	if p.clock != nil {
+		p.clock.advance(time.Second)
+	}
+	if page.err != nil {
+		return azcosmos.QueryItemsResponse{}, page.err
+	}
+	var response azcosmos.QueryItemsResponse
+	for _, item := range page.items {
+		response.Items = append(response.Items, []byte(item))
+	}
+	return response, nil
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newFakeMetrics(output io.Writer, charges *chargeMeter, engine *trackingEngine) (*queryMetrics, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	metrics := newQueryMetrics(output, charges, engine)
+	metrics.now = clock.Now
+	return metrics, clock
+}
+
+func TestExecuteQueryMetrics(t *testing.T) {
+	// The charges made before the query starts, such as those of creating the container client, aren't part of it.
+	charges := &chargeMeter{}
+	charges.add(1.5)
+
+	var metricsOutput, itemsOutput bytes.Buffer
+	metrics, clock := newFakeMetrics(&metricsOutput, charges, nil)
+	pager := &fakePager{charges: charges, clock: clock, pages: []fakePage{
+		{items: []string{`{"id":"1"}`, `{"id":"2"}`}, charge: 2.25},
+		{charge: 1},
+		{items: []string{`{"id":"3"}`}, charge: 3.5},
+	}}
+	writer, _ := results.NewWriter(&itemsOutput, results.FormatNDJSON, results.Options{})
+	if err := executeQuery(pager, writer, metrics, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "" +
+		"page 1: 2 items, 2.25 RU, 1s\n" +
+		"page 2: 0 items, 1.00 RU, 1s\n" +
+		"page 3: 1 items, 3.50 RU, 1s\n" +
+		"total: 3 pages, 3 items, 8.25 RU, 3s\n"
+	if metricsOutput.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, metricsOutput.String())
+	}
+	if itemsOutput.String() != "{\"id\":\"1\"}\n{\"id\":\"2\"}\n{\"id\":\"3\"}\n" {
+		t.Errorf("expected the items to be written, got %q", itemsOutput.String())
+	}
+}
+
+func TestExecuteQueryMetricsOnError(t *testing.T) {
+	charges := &chargeMeter{}
+	var output bytes.Buffer
+	metrics, clock := newFakeMetrics(&output, charges, nil)
+	failure := errors.New("request failed")
+	pager := &fakePager{charges: charges, clock: clock, pages: []fakePage{
+		{items: []string{`{"id":"1"}`}, charge: 1},
+		{err: failure},
+	}}
+	writer, _ := results.NewWriter(io.Discard, results.FormatNDJSON, results.Options{})
+	if err := executeQuery(pager, writer, metrics, nil, 0); !errors.Is(err, failure) {
+		t.Fatalf("expected the pager's error, got %v", err)
+	}
+	// The pages before the error are still reported, but there's no summary.
+	if output.String() != "page 1: 1 items, 1.00 RU, 1s\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+func TestExecuteQueryWithoutMetrics(t *testing.T) {
+	charges := &chargeMeter{}
+	pager := &fakePager{charges: charges, clock: &fakeClock{}, pages: []fakePage{{items: []string{`1`}}}}
+	var output bytes.Buffer
+	writer, _ := results.NewWriter(&output, results.FormatNDJSON, results.Options{})
+	if err := executeQuery(pager, writer, nil, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "1\n" {
+		t.Errorf("expected only the items, got %q", output.String())
+	}
+}
+
+func TestExecuteQueryMaxPages(t *testing.T) {
+	charges := &chargeMeter{}
+	var metricsOutput, itemsOutput bytes.Buffer
+	metrics, clock := newFakeMetrics(&metricsOutput, charges, nil)
+	pager := &fakePager{charges: charges, clock: clock, pages: []fakePage{
+		{items: []string{`1`, `2`}, charge: 1},
+		{items: []string{`3`}, charge: 1},
+		{items: []string{`4`}, charge: 1},
+	}}
+	writer, _ := results.NewWriter(&itemsOutput, results.FormatJSON, results.Options{})
+	if err := executeQuery(pager, writer, metrics, nil, 2); err != nil {
+		t.Fatal(err)
+	}
+	// Stopping early still finishes the output and the summary, and leaves the remaining pages unread.
+	if itemsOutput.String() != "[\n  1,\n  2,\n  3\n]\n" {
+		t.Errorf("expected the items of the first two pages, got %q", itemsOutput.String())
+	}
+	if !strings.HasSuffix(metricsOutput.String(), "total: 2 pages, 3 items, 2.00 RU, 2s\n") {
+		t.Errorf("expected a summary of two pages, got %q", metricsOutput.String())
+	}
+	if len(pager.pages) != 1 {
+		t.Errorf("expected one page to be left unread, got %d", len(pager.pages))
+	}
+}
+
+func TestQueryMetricsEngineStats(t *testing.T) {
+	var output bytes.Buffer
+	metrics, _ := newFakeMetrics(&output, &chargeMeter{}, &trackingEngine{})
+	metrics.begin()
+	metrics.end()
+	expected := "" +
+		"total: 0 pages, 0 items, 0.00 RU, 0s\n" +
+		"engine: 0 pipelines, 0 turns, 0 items emitted, 0 ProvideData calls, 0 pages (0 bytes) provided, 0s in native code\n"
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
+
+// cannedTransport responds to every request with the request charges, in order.
+type cannedTransport struct {
+	charges []string
+}
+
+func (c *cannedTransport) Do(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	if len(c.charges) > 0 {
+		header.Set("x-ms-request-charge", c.charges[0])
+		c.charges = c.charges[1:]
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestChargeMeter(t *testing.T) {
+	meter := &chargeMeter{}
+	pipeline := runtime.NewPipeline("sample", "v0", runtime.PipelineOptions{}, &policy.ClientOptions{
+		Transport:        &cannedTransport{charges: []string{"2.5", "", "not a number", "0.75"}},
+		PerRetryPolicies: []policy.Policy{meter},
+	})
+	scoped := &chargeMeter{}
+	for i := 0; i < 4; i++ {
+		ctx := context.Background()
+		if i == 3 {
+			ctx = withChargeMeter(ctx, scoped)
+		}
+		req, err := runtime.NewRequest(ctx, http.MethodGet, "https://localhost/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pipeline.Do(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Responses without a valid charge add nothing.
+	if meter.Total() != 3.25 {
+		t.Errorf("expected 3.25 RU, got %v", meter.Total())
+	}
+	// The charge of the request made with a meter in its context is added to that meter too.
+	if scoped.Total() != 0.75 {
+		t.Errorf("expected 0.75 RU, got %v", scoped.Total())
+	}
+}
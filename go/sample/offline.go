@@ -0,0 +1,278 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// A fixture is a query, its plan and partition key ranges, and the pages each partition key range returned for it, which is enough to run the query's pipeline without an account.
+// It's a directory with these files, which --capture writes and --offline reads:
+//   - query.txt: the query.
+//   - plan.json: the query plan the gateway returned.
+//   - pkranges.json: the container's partition key ranges.
+//   - pages/<pkrangeId>.json: an array of the pages the partition key range returned, each a fixturePage.
+type fixture struct {
+	query    string
+	plan     string
+	pkranges string
+	pages    map[string][]fixturePage
+}
+
+// fixturePage is a page a partition key range returned, and the request it returned it for.
+type fixturePage struct {
+	// Query is the query the page was requested with, if the pipeline asked for a different one than the fixture's.
+	Query string `json:"query,omitempty"`
+
+	// Continuation is the continuation the page was requested with, which is empty for the first page.
+	Continuation string `json:"continuation,omitempty"`
+
+	// NextContinuation is the continuation the page returned, which is empty for the last page.
+	NextContinuation string `json:"nextContinuation,omitempty"`
+
+	Body json.RawMessage `json:"body"`
+}
+
+// readFixture reads the fixture in dir.
+func readFixture(dir string) (*fixture, error) {
+	f := &fixture{pages: make(map[string][]fixturePage)}
+	for name, value := range map[string]*string{"query.txt": &f.query, "plan.json": &f.plan, "pkranges.json": &f.pkranges} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		*value = string(data)
+	}
+	f.query = strings.TrimSpace(f.query)
+
+	files, err := filepath.Glob(filepath.Join(dir, "pages", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var pages []fixturePage
+		if err := json.Unmarshal(data, &pages); err != nil {
+			return nil, fmt.Errorf("%s isn't an array of pages: %w", file, err)
+		}
+		// The files are indented to be readable, but the engine returns items as they are in the body, so provide them compact like the gateway's.
+		for i := range pages {
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, pages[i].Body); err != nil {
+				return nil, fmt.Errorf("page %d of %s has an invalid body: %w", i, file, err)
+			}
+			pages[i].Body = compacted.Bytes()
+		}
+		f.pages[strings.TrimSuffix(filepath.Base(file), ".json")] = pages
+	}
+	return f, nil
+}
+
+// write writes the fixture to dir, creating it if needed.
+func (f *fixture) write(dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "pages"), 0o755); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{"query.txt": f.query + "\n", "plan.json": f.plan, "pkranges.json": f.pkranges} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o644); err != nil {
+			return err
+		}
+	}
+	for pkrange, pages := range f.pages {
+		data, err := json.MarshalIndent(pages, "", "  ")
+		if err != nil {
+			return fmt.Errorf("the pages of partition key range %s can't be written: %w", pkrange, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "pages", pkrange+".json"), append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixtureQuery returns the query of a request as its fixture page records it: empty if it's the pipeline's own query, which every request carries unless the engine rewrote it.
+func fixtureQuery(pipeline queryengine.QueryPipeline, request queryengine.QueryRequest) string {
+	if request.Query == pipeline.Query() {
+		return ""
+	}
+	return request.Query
+}
+
+// page returns the page the partition key range returned for the query and continuation.
+func (f *fixture) page(pkrange string, query string, continuation string) (fixturePage, error) {
+	for _, page := range f.pages[pkrange] {
+		if page.Query == query && page.Continuation == continuation {
+			return page, nil
+		}
+	}
+	if query != "" {
+		return fixturePage{}, fmt.Errorf("the fixture has no page of partition key range %s for continuation %q of the query %q", pkrange, continuation, query)
+	}
+	return fixturePage{}, fmt.Errorf("the fixture has no page of partition key range %s for continuation %q", pkrange, continuation)
+}
+
+// offlinePager runs a pipeline without an account, providing it the pages of a fixture, for --offline.
+// Like the SDK's pager, each page has the items of the turn that returned some, or of the last turn.
+type offlinePager struct {
+	fixture  *fixture
+	pipeline queryengine.QueryPipeline
+}
+
+// newOfflinePager creates a pipeline for the fixture's query with the engine.
+func newOfflinePager(engine queryengine.QueryEngine, f *fixture) (*offlinePager, error) {
+	pipeline, err := engine.CreateQueryPipeline(f.query, f.plan, f.pkranges)
+	if err != nil {
+		return nil, err
+	}
+	return &offlinePager{fixture: f, pipeline: pipeline}, nil
+}
+
+func (p *offlinePager) More() bool {
+	return !p.pipeline.IsComplete()
+}
+
+func (p *offlinePager) NextPage(ctx context.Context) (azcosmos.QueryItemsResponse, error) {
+	for {
+		result, err := p.pipeline.Run()
+		if err != nil {
+			return azcosmos.QueryItemsResponse{}, err
+		}
+		if len(result.Requests) > 0 {
+			if err := p.provide(result.Requests); err != nil {
+				return azcosmos.QueryItemsResponse{}, err
+			}
+		} else if len(result.Items) == 0 && !result.IsCompleted {
+			return azcosmos.QueryItemsResponse{}, errors.New("the pipeline returned no items and requested no data, but isn't complete")
+		}
+		if len(result.Items) > 0 || result.IsCompleted {
+			return azcosmos.QueryItemsResponse{Items: result.Items}, nil
+		}
+	}
+}
+
+// provide provides the fixture's pages for the requests to the pipeline, following the continuations of those that ask to be drained.
+func (p *offlinePager) provide(requests []queryengine.QueryRequest) error {
+	var data []queryengine.QueryResult
+	for _, request := range requests {
+		continuation := request.Continuation
+		for {
+			page, err := p.fixture.page(request.PartitionKeyRangeID, fixtureQuery(p.pipeline, request), continuation)
+			if err != nil {
+				return err
+			}
+			data = append(data, queryengine.QueryResult{
+				PartitionKeyRangeID: request.PartitionKeyRangeID,
+				RequestId:           request.Id,
+				NextContinuation:    page.NextContinuation,
+				Data:                page.Body,
+			})
+			if !request.Drain || page.NextContinuation == "" {
+				break
+			}
+			continuation = page.NextContinuation
+		}
+	}
+	return p.pipeline.ProvideData(data)
+}
+
+// fixtureRecorder records the query, plan, partition key ranges, and pages of the pipeline it creates as a fixture, for --capture.
+// Only a single pipeline can be recorded.
+type fixtureRecorder struct {
+	queryengine.QueryEngine
+
+	mu       sync.Mutex
+	fixture  *fixture
+	requests map[requestKey]*recordedRequest
+}
+
+// requestKey identifies a request of a pipeline.
+type requestKey struct {
+	pkrange string
+	id      uint64
+}
+
+// recordedRequest is a request the pipeline made, and the continuation its next page is for, which is that of the page before it when the request is drained.
+type recordedRequest struct {
+	query        string
+	continuation string
+}
+
+func (r *fixtureRecorder) CreateQueryPipeline(query string, plan string, pkranges string) (queryengine.QueryPipeline, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fixture != nil {
+		return nil, errors.New("--capture can only record a single pipeline")
+	}
+	pipeline, err := r.QueryEngine.CreateQueryPipeline(query, plan, pkranges)
+	if err != nil {
+		return nil, err
+	}
+	r.fixture = &fixture{query: query, plan: plan, pkranges: pkranges, pages: make(map[string][]fixturePage)}
+	r.requests = make(map[requestKey]*recordedRequest)
+	return &recordedPipeline{QueryPipeline: pipeline, recorder: r}, nil
+}
+
+// write writes the fixture that was recorded to dir.
+func (r *fixtureRecorder) write(dir string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fixture == nil {
+		return errors.New("there's no pipeline to capture, since the query didn't use the query engine")
+	}
+	return r.fixture.write(dir)
+}
+
+// recordedPipeline records the requests the pipeline makes and the pages provided for them.
+type recordedPipeline struct {
+	queryengine.QueryPipeline
+	recorder *fixtureRecorder
+}
+
+func (p *recordedPipeline) Run() (*queryengine.PipelineResult, error) {
+	result, err := p.QueryPipeline.Run()
+	if err != nil {
+		return nil, err
+	}
+	p.recorder.mu.Lock()
+	for _, request := range result.Requests {
+		p.recorder.requests[requestKey{request.PartitionKeyRangeID, request.Id}] = &recordedRequest{query: fixtureQuery(p.QueryPipeline, request), continuation: request.Continuation}
+	}
+	p.recorder.mu.Unlock()
+	return result, nil
+}
+
+func (p *recordedPipeline) ProvideData(data []queryengine.QueryResult) error {
+	p.recorder.mu.Lock()
+	f := p.recorder.fixture
+	for _, result := range data {
+		request, ok := p.recorder.requests[requestKey{result.PartitionKeyRangeID, result.RequestId}]
+		if !ok {
+			continue
+		}
+		f.pages[result.PartitionKeyRangeID] = append(f.pages[result.PartitionKeyRangeID], fixturePage{
+			Query:            request.query,
+			Continuation:     request.continuation,
+			NextContinuation: result.NextContinuation,
+			Body:             slices.Clone(result.Data),
+		})
+		request.continuation = result.NextContinuation
+	}
+	p.recorder.mu.Unlock()
+	return p.QueryPipeline.ProvideData(data)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+)
+
+// runFixture runs the fixture in dir with the native engine and returns the items, as one string.
+func runFixture(t *testing.T, dir string) string {
+	t.Helper()
+	f, err := readFixture(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pager, err := newOfflinePager(azcosmoscx.NewQueryEngine(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.pipeline.Close()
+	items, err := collectItems(pager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var joined []string
+	for _, item := range items {
+		joined = append(joined, string(item))
+	}
+	return strings.Join(joined, "\n")
+}
+
+const orderByFixtureItems = `{"id":"a","value":1}
+{"id":"b","value":2}
+{"id":"c","value":3}
+{"id":"d","value":4}
+{"id":"e","value":5}
+{"id":"f","value":6}`
+
+func TestOfflinePager(t *testing.T) {
+	// The partitions' pages are merged in order, following the continuations of partition0 and partition1 to their second pages.
+	if items := runFixture(t, filepath.Join("testdata", "offline", "order_by")); items != orderByFixtureItems {
+		t.Errorf("expected the items in order, got:\n%s", items)
+	}
+}
+
+func TestOfflinePagerMissingPage(t *testing.T) {
+	f, err := readFixture(filepath.Join("testdata", "offline", "order_by"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.pages["partition1"] = f.pages["partition1"][:1]
+	pager, err := newOfflinePager(azcosmoscx.NewQueryEngine(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.pipeline.Close()
+	if _, err := collectItems(pager); err == nil || err.Error() != `the fixture has no page of partition key range partition1 for continuation "1"` {
+		t.Errorf("expected an error naming the missing page, got %v", err)
+	}
+}
+
+func TestFixtureRecorder(t *testing.T) {
+	f, err := readFixture(filepath.Join("testdata", "offline", "order_by"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &fixtureRecorder{QueryEngine: azcosmoscx.NewQueryEngine()}
+	pager, err := newOfflinePager(recorder, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.pipeline.Close()
+	if _, err := collectItems(pager); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.CreateQueryPipeline(f.query, f.plan, f.pkranges); err == nil {
+		t.Error("expected an error recording a second pipeline")
+	}
+
+	// The recorded fixture has every page that was read, so it runs offline like the one it was recorded from.
+	dir := t.TempDir()
+	if err := recorder.write(dir); err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := readFixture(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.query != f.query || recorded.plan != f.plan || recorded.pkranges != f.pkranges {
+		t.Errorf("expected the fixture's query, plan, and partition key ranges, got %+v", recorded)
+	}
+	for pkrange, pages := range f.pages {
+		if len(recorded.pages[pkrange]) != len(pages) {
+			t.Errorf("expected %d pages of %s, got %d", len(pages), pkrange, len(recorded.pages[pkrange]))
+		}
+	}
+	if items := runFixture(t, dir); items != orderByFixtureItems {
+		t.Errorf("expected the recorded fixture to return the items in order, got:\n%s", items)
+	}
+
+	if err := (&fixtureRecorder{}).write(dir); err == nil {
+		t.Error("expected an error writing a fixture without a pipeline")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// parameterName returns the name with the leading '@' the query refers to parameters with, adding it if it's missing.
+func parameterName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "@" {
+		return "", errors.New("the parameter has no name")
+	}
+	if !strings.HasPrefix(name, "@") {
+		name = "@" + name
+	}
+	return name, nil
+}
+
+// parseParam parses a --param, name=value, inferring the value's type: null, true, false, and numbers are those values, and anything else is a string.
+func parseParam(param string) (azcosmos.QueryParameter, error) {
+	name, value, ok := strings.Cut(param, "=")
+	if !ok {
+		return azcosmos.QueryParameter{}, fmt.Errorf("%q isn't of the form name=value", param)
+	}
+	name, err := parameterName(name)
+	if err != nil {
+		return azcosmos.QueryParameter{}, err
+	}
+	return azcosmos.QueryParameter{Name: name, Value: inferValue(value)}, nil
+}
+
+func inferValue(value string) any {
+	switch value {
+	case "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return value
+}
+
+// parseParamJSON parses a --param-json, name=JSON, for values that are objects or arrays, or strings that look like another type.
+func parseParamJSON(param string) (azcosmos.QueryParameter, error) {
+	name, value, ok := strings.Cut(param, "=")
+	if !ok {
+		return azcosmos.QueryParameter{}, fmt.Errorf("%q isn't of the form name=JSON", param)
+	}
+	name, err := parameterName(name)
+	if err != nil {
+		return azcosmos.QueryParameter{}, err
+	}
+	if !json.Valid([]byte(value)) {
+		return azcosmos.QueryParameter{}, fmt.Errorf("the value of %s isn't JSON: %s", name, value)
+	}
+	return azcosmos.QueryParameter{Name: name, Value: json.RawMessage(value)}, nil
+}
+
+// parseParametersFile parses the contents of a --parameters-file, which is either an object of names and values, like {"@x": 1},
+// or the SDK's array of parameters, like [{"name": "@x", "value": 1}]. The values are kept as they're written, and the parameters in the order they are.
+func parseParametersFile(data []byte) ([]azcosmos.QueryParameter, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []struct {
+			Name  *string         `json:"name"`
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, fmt.Errorf("the parameters aren't an array of names and values: %w", err)
+		}
+		parameters := make([]azcosmos.QueryParameter, 0, len(entries))
+		for i, entry := range entries {
+			if entry.Name == nil {
+				return nil, fmt.Errorf("parameter %d has no name", i)
+			}
+			name, err := parameterName(*entry.Name)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %d: %w", i, err)
+			}
+			if entry.Value == nil {
+				entry.Value = json.RawMessage("null")
+			}
+			parameters = append(parameters, azcosmos.QueryParameter{Name: name, Value: entry.Value})
+		}
+		return parameters, nil
+	}
+
+	// Decode the object a member at a time, to keep the order of the parameters and notice names that are repeated.
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, errors.New("the parameters must be a JSON object of names and values, or an array of objects with a name and value")
+	}
+	var parameters []azcosmos.QueryParameter
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("the parameters aren't a JSON object: %w", err)
+		}
+		name, err := parameterName(token.(string))
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("the value of %s isn't JSON: %w", name, err)
+		}
+		parameters = append(parameters, azcosmos.QueryParameter{Name: name, Value: value})
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("the parameters aren't a JSON object: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("the parameters aren't a JSON object: there's more after it")
+	}
+	return parameters, nil
+}
+
+// queryParameters returns the parameters of the query: those in the --parameters-file, if any, and then those given with --param and --param-json.
+// A name can only be given once, counting the '@' they're normalized to have.
+func queryParameters(opts options) ([]azcosmos.QueryParameter, error) {
+	var parameters []azcosmos.QueryParameter
+	if opts.parametersFile != "" {
+		data, err := os.ReadFile(opts.parametersFile)
+		if err != nil {
+			return nil, err
+		}
+		parameters, err = parseParametersFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", opts.parametersFile, err)
+		}
+	}
+	parameters = append(parameters, opts.parameters...)
+	seen := make(map[string]bool)
+	for _, parameter := range parameters {
+		if seen[parameter.Name] {
+			return nil, fmt.Errorf("the parameter %s is given more than once", parameter.Name)
+		}
+		seen[parameter.Name] = true
+	}
+	return parameters, nil
+}
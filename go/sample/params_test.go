@@ -0,0 +1,151 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+func TestParseParam(t *testing.T) {
+	for param, expected := range map[string]azcosmos.QueryParameter{
+		"x=1":           {Name: "@x", Value: int64(1)},
+		"@x=-20":        {Name: "@x", Value: int64(-20)},
+		"x=1.5":         {Name: "@x", Value: 1.5},
+		"x=1e3":         {Name: "@x", Value: 1000.0},
+		"x=true":        {Name: "@x", Value: true},
+		"x=false":       {Name: "@x", Value: false},
+		"x=null":        {Name: "@x", Value: nil},
+		"x=abc":         {Name: "@x", Value: "abc"},
+		"x=":            {Name: "@x", Value: ""},
+		"x=a=b":         {Name: "@x", Value: "a=b"},
+		"x=True":        {Name: "@x", Value: "True"},
+		"x=Inf":         {Name: "@x", Value: "Inf"},
+		"x=NaN":         {Name: "@x", Value: "NaN"},
+		"x=1e999":       {Name: "@x", Value: "1e999"},
+		" x =  padded ": {Name: "@x", Value: "  padded "},
+	} {
+		actual, err := parseParam(param)
+		if err != nil {
+			t.Errorf("%q: %v", param, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %#v, got %#v", param, expected, actual)
+		}
+	}
+
+	for param, message := range map[string]string{
+		"x":    `"x" isn't of the form name=value`,
+		"=1":   "the parameter has no name",
+		"@=1":  "the parameter has no name",
+		" = 1": "the parameter has no name",
+	} {
+		if _, err := parseParam(param); err == nil || err.Error() != message {
+			t.Errorf("%q: expected the error %q, got %v", param, message, err)
+		}
+	}
+}
+
+func TestParseParamJSON(t *testing.T) {
+	parameter, err := parseParamJSON(`tags=["a", "b"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parameter.Name != "@tags" || string(parameter.Value.(json.RawMessage)) != `["a", "b"]` {
+		t.Errorf("unexpected parameter %#v", parameter)
+	}
+	// A string that would otherwise be inferred as a number.
+	if parameter, err := parseParamJSON(`@id="1"`); err != nil || string(parameter.Value.(json.RawMessage)) != `"1"` {
+		t.Errorf("unexpected parameter %#v (%v)", parameter, err)
+	}
+	if _, err := parseParamJSON(`x=abc`); err == nil || err.Error() != "the value of @x isn't JSON: abc" {
+		t.Errorf("expected an error for a value that isn't JSON, got %v", err)
+	}
+}
+
+func TestParseParametersFile(t *testing.T) {
+	// Both shapes keep the order of the parameters and their values as they're written, and the names get an '@' if they don't have one.
+	expected := []azcosmos.QueryParameter{
+		{Name: "@x", Value: json.RawMessage(`1`)},
+		{Name: "@big", Value: json.RawMessage(`12345678901234567890`)},
+		{Name: "@o", Value: json.RawMessage(`{"a": [1, 2]}`)},
+		{Name: "@n", Value: json.RawMessage(`null`)},
+	}
+	for name, data := range map[string]string{
+		"object": ` {"@x": 1, "big": 12345678901234567890, "@o": {"a": [1, 2]}, "n": null}`,
+		"array":  `[{"name": "@x", "value": 1}, {"name": "big", "value": 12345678901234567890}, {"name": "@o", "value": {"a": [1, 2]}}, {"name": "@n"}]`,
+	} {
+		parameters, err := parseParametersFile([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(parameters, expected) {
+			t.Errorf("%s: expected %s, got %s", name, formatParameters(expected), formatParameters(parameters))
+		}
+	}
+
+	for data, message := range map[string]string{
+		`1`:                              "the parameters must be a JSON object of names and values, or an array of objects with a name and value",
+		``:                               "the parameters must be a JSON object of names and values, or an array of objects with a name and value",
+		`{"x": 1,}`:                      "the parameters aren't a JSON object",
+		`{"x": 1} {}`:                    "the parameters aren't a JSON object",
+		`{"": 1}`:                        "the parameter has no name",
+		`[{"value": 1}]`:                 "parameter 0 has no name",
+		`[{"name": "x"}, {"name": "@"}]`: "parameter 1: the parameter has no name",
+		`[1]`:                            "the parameters aren't an array of names and values",
+	} {
+		if _, err := parseParametersFile([]byte(data)); err == nil || !strings.HasPrefix(err.Error(), message) {
+			t.Errorf("%q: expected an error starting with %q, got %v", data, message, err)
+		}
+	}
+}
+
+func formatParameters(parameters []azcosmos.QueryParameter) string {
+	data, _ := json.Marshal(parameters)
+	return string(data)
+}
+
+func TestQueryParameters(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "params.json")
+	if err := os.WriteFile(file, []byte(`[{"name": "x", "value": 1}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file's parameters come first.
+	parameters, err := queryParameters(options{parametersFile: file, parameters: []azcosmos.QueryParameter{{Name: "@y", Value: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := formatParameters(parameters); actual != `[{"name":"@x","value":1},{"name":"@y","value":true}]` {
+		t.Errorf("unexpected parameters %s", actual)
+	}
+
+	// A name is the same with or without its '@', in the file or given inline.
+	_, err = queryParameters(options{parametersFile: file, parameters: []azcosmos.QueryParameter{{Name: "@x", Value: 2}}})
+	if err == nil || err.Error() != "the parameter @x is given more than once" {
+		t.Errorf("expected a duplicate name error, got %v", err)
+	}
+	if _, err := parseParametersFile([]byte(`{"x": 1, "@x": 2}`)); err != nil {
+		t.Fatal(err)
+	}
+	duplicates, _ := parseParametersFile([]byte(`{"x": 1, "@x": 2}`))
+	if _, err := queryParameters(options{parameters: duplicates}); err == nil || err.Error() != "the parameter @x is given more than once" {
+		t.Errorf("expected a duplicate name error, got %v", err)
+	}
+
+	if parameters, err := queryParameters(options{}); err != nil || parameters != nil {
+		t.Errorf("expected no parameters, got %v (%v)", parameters, err)
+	}
+	if _, err := queryParameters(options{parametersFile: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
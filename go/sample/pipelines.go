@@ -0,0 +1,107 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// trackingEngine keeps the pipelines it creates, so that their stats and the continuations they were given can be reported once the query stops,
+// and so that they can be closed if it stops early. The SDK only closes a pipeline once every page has been read.
+type trackingEngine struct {
+	queryengine.QueryEngine
+
+	mu        sync.Mutex
+	pipelines []*trackedPipeline
+}
+
+func (e *trackingEngine) CreateQueryPipeline(query string, plan string, pkranges string) (queryengine.QueryPipeline, error) {
+	pipeline, err := e.QueryEngine.CreateQueryPipeline(query, plan, pkranges)
+	if err != nil {
+		return nil, err
+	}
+	tracked := &trackedPipeline{QueryPipeline: pipeline, continuations: make(map[string]string)}
+	e.mu.Lock()
+	e.pipelines = append(e.pipelines, tracked)
+	e.mu.Unlock()
+	return tracked, nil
+}
+
+// Stats returns the sum of the stats of the pipelines the engine created, and the number of pipelines.
+func (e *trackingEngine) Stats() (azcosmoscx.PipelineStats, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var total azcosmoscx.PipelineStats
+	for _, pipeline := range e.pipelines {
+		reporter, ok := pipeline.QueryPipeline.(azcosmoscx.StatsReporter)
+		if !ok {
+			continue
+		}
+		stats := reporter.Stats()
+		total.Turns += stats.Turns
+		total.ItemsEmitted += stats.ItemsEmitted
+		total.ProvideDataCalls += stats.ProvideDataCalls
+		total.PagesProvided += stats.PagesProvided
+		total.BytesProvided += stats.BytesProvided
+		total.NativeTime += stats.NativeTime
+	}
+	return total, len(e.pipelines)
+}
+
+// Close closes every pipeline the engine created. Closing a pipeline that's already closed does nothing.
+func (e *trackingEngine) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, pipeline := range e.pipelines {
+		pipeline.Close()
+	}
+}
+
+// printContinuations prints, for each pipeline the engine created, the continuation each partition key range was last given, for --print-continuations.
+// The items of those pages that the pipeline hasn't returned yet are lost when it's closed, so they describe how far the pipeline read, rather than where a new query could resume.
+func (e *trackingEngine) printContinuations(out io.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, pipeline := range e.pipelines {
+		pipeline.mu.Lock()
+		fmt.Fprintf(out, "pipeline %d: complete %t\n", i, pipeline.IsComplete())
+		if len(pipeline.pkranges) == 0 {
+			fmt.Fprintln(out, "  no data was provided")
+		}
+		for _, pkrange := range pipeline.pkranges {
+			continuation := pipeline.continuations[pkrange]
+			if continuation == "" {
+				continuation = "(exhausted)"
+			}
+			fmt.Fprintf(out, "  %s: %s\n", pkrange, continuation)
+		}
+		pipeline.mu.Unlock()
+	}
+}
+
+// trackedPipeline records the last continuation provided to the pipeline for each partition key range.
+type trackedPipeline struct {
+	queryengine.QueryPipeline
+
+	mu            sync.Mutex
+	pkranges      []string
+	continuations map[string]string
+}
+
+func (p *trackedPipeline) ProvideData(data []queryengine.QueryResult) error {
+	p.mu.Lock()
+	for _, result := range data {
+		if _, ok := p.continuations[result.PartitionKeyRangeID]; !ok {
+			p.pkranges = append(p.pkranges, result.PartitionKeyRangeID)
+		}
+		p.continuations[result.PartitionKeyRangeID] = result.NextContinuation
+	}
+	p.mu.Unlock()
+	return p.QueryPipeline.ProvideData(data)
+}
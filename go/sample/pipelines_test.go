@@ -0,0 +1,103 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+)
+
+// fakeQueryEngine creates fakePipelines.
+type fakeQueryEngine struct {
+	pipelines []*fakePipeline
+}
+
+func (e *fakeQueryEngine) CreateQueryPipeline(query string, plan string, pkranges string) (queryengine.QueryPipeline, error) {
+	pipeline := &fakePipeline{stats: azcosmoscx.PipelineStats{Turns: 2, ItemsEmitted: 3, ProvideDataCalls: 1, PagesProvided: 2, BytesProvided: 100, NativeTime: time.Millisecond}}
+	e.pipelines = append(e.pipelines, pipeline)
+	return pipeline, nil
+}
+
+func (e *fakeQueryEngine) SupportedFeatures() string {
+	return ""
+}
+
+// fakePipeline is a pipeline that's complete once it's closed, and reports fixed stats.
+type fakePipeline struct {
+	closed   int
+	provided int
+	stats    azcosmoscx.PipelineStats
+}
+
+func (p *fakePipeline) Query() string { return "" }
+
+func (p *fakePipeline) IsComplete() bool { return p.closed > 0 }
+
+func (p *fakePipeline) Run() (*queryengine.PipelineResult, error) {
+	return &queryengine.PipelineResult{}, nil
+}
+
+func (p *fakePipeline) ProvideData(data []queryengine.QueryResult) error {
+	p.provided += len(data)
+	return nil
+}
+
+func (p *fakePipeline) Close() { p.closed++ }
+
+func (p *fakePipeline) Stats() azcosmoscx.PipelineStats { return p.stats }
+
+func TestTrackingEngine(t *testing.T) {
+	fake := &fakeQueryEngine{}
+	engine := &trackingEngine{QueryEngine: fake}
+	first, err := engine.CreateQueryPipeline("SELECT * FROM c", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.CreateQueryPipeline("SELECT * FROM c", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the last continuation provided for each partition key range is kept, and an empty one means the range has been read.
+	err = first.ProvideData([]queryengine.QueryResult{
+		queryengine.NewQueryResultString("1", `{"Documents":[]}`, "c1"),
+		queryengine.NewQueryResultString("0", `{"Documents":[]}`, "c0"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.ProvideData([]queryengine.QueryResult{queryengine.NewQueryResultString("1", `{"Documents":[]}`, "")}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.pipelines[0].provided != 3 {
+		t.Errorf("expected the data to be provided to the pipeline, got %d results", fake.pipelines[0].provided)
+	}
+
+	stats, pipelines := engine.Stats()
+	if pipelines != 2 || stats.Turns != 4 || stats.BytesProvided != 200 || stats.NativeTime != 2*time.Millisecond {
+		t.Errorf("expected the stats of both pipelines to be added up, got %+v from %d pipelines", stats, pipelines)
+	}
+
+	var output bytes.Buffer
+	engine.printContinuations(&output)
+	expected := "" +
+		"pipeline 0: complete false\n" +
+		"  1: (exhausted)\n" +
+		"  0: c0\n" +
+		"pipeline 1: complete false\n" +
+		"  no data was provided\n"
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output.String())
+	}
+
+	// Closing the engine closes every pipeline, even one the SDK already closed.
+	first.Close()
+	engine.Close()
+	if fake.pipelines[0].closed != 2 || fake.pipelines[1].closed != 1 {
+		t.Errorf("expected both pipelines to be closed, got %d and %d calls", fake.pipelines[0].closed, fake.pipelines[1].closed)
+	}
+}
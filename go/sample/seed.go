@@ -0,0 +1,233 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/seeding"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// commandSeed is the subcommand that creates the database and container and loads documents into it, so that there's something to query.
+const commandSeed = "seed"
+
+// seed runs the seed subcommand: it creates the database and container, if they don't exist, or recreates the container with --drop,
+// inserts the documents in opts.documentsFile with the integration tests' seeder, and prints a summary to out, with the request charges recorded by the meter.
+func seed(ctx context.Context, client *azcosmos.Client, charges *chargeMeter, opts options, out io.Writer) error {
+	data, err := os.ReadFile(opts.documentsFile)
+	if err != nil {
+		return err
+	}
+	documents, err := parseDocuments(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opts.documentsFile, err)
+	}
+	properties, err := containerProperties(opts)
+	if err != nil {
+		return err
+	}
+	items, err := seeding.BuildItems(properties.PartitionKeyDefinition, documents)
+	if err != nil {
+		return err
+	}
+	throughput, err := parseThroughput(opts.throughput)
+	if err != nil {
+		return err
+	}
+
+	database, created, err := ensureDatabase(ctx, client, opts.database)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Database %s: %s\n", opts.database, createdOrExisting(created))
+	container, status, err := ensureContainer(ctx, database, properties, throughput, opts.drop)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Container %s (partitioned by %s): %s\n", opts.container, strings.Join(properties.PartitionKeyDefinition.Paths, ", "), status)
+
+	seeder := seeding.New(opts.concurrency)
+	seeder.Progress = func(inserted, total int) {
+		fmt.Fprintf(os.Stderr, "inserted %d/%d documents\n", inserted, total)
+	}
+	var throttled atomic.Int64
+	seeder.Throttled = func(time.Duration) { throttled.Add(1) }
+	charge := charges.Total()
+	start := time.Now()
+	if err := seeder.Seed(ctx, container, items); err != nil {
+		if isStatus(err, http.StatusConflict) {
+			return fmt.Errorf("a document has the id of one already in the container; use --drop to recreate it: %w", err)
+		}
+		return err
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintf(out, "Inserted %d documents in %v (%.1f documents/s, %.2f RU) with up to %d at once; %d throttled inserts were retried\n",
+		len(items), elapsed.Round(time.Millisecond), float64(len(items))/elapsed.Seconds(), charges.Total()-charge, opts.concurrency, throttled.Load())
+	return nil
+}
+
+func createdOrExisting(created bool) string {
+	if created {
+		return "created"
+	}
+	return "already exists"
+}
+
+// parseDocuments parses the documents to load, which are either a JSON array of objects, or objects on their own lines (NDJSON).
+// Every document must have a string id.
+func parseDocuments(data []byte) ([]json.RawMessage, error) {
+	var documents []json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &documents); err != nil {
+			return nil, fmt.Errorf("the documents aren't a JSON array: %w", err)
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var document json.RawMessage
+			if err := decoder.Decode(&document); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("document %d isn't JSON: %w", len(documents), err)
+			}
+			documents = append(documents, document)
+		}
+	}
+	for i, document := range documents {
+		var identified struct {
+			ID *string `json:"id"`
+		}
+		if err := json.Unmarshal(document, &identified); err != nil {
+			return nil, fmt.Errorf("document %d isn't a JSON object", i)
+		}
+		if identified.ID == nil || *identified.ID == "" {
+			return nil, fmt.Errorf("document %d has no id", i)
+		}
+	}
+	return documents, nil
+}
+
+// containerProperties returns the properties of the container to create, with the partition key paths, and the indexing and vector embedding policies in the files, if any.
+func containerProperties(opts options) (azcosmos.ContainerProperties, error) {
+	properties := azcosmos.ContainerProperties{
+		ID:                     opts.container,
+		PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{Paths: strings.Split(opts.partitionKeyPaths, ","), Version: 2},
+	}
+	for _, path := range properties.PartitionKeyDefinition.Paths {
+		if !strings.HasPrefix(path, "/") || strings.Contains(path[1:], "/") || len(path) == 1 {
+			return azcosmos.ContainerProperties{}, fmt.Errorf("the partition key path %q must be a top-level property, like /pk", path)
+		}
+	}
+	if opts.indexingPolicy != "" {
+		properties.IndexingPolicy = &azcosmos.IndexingPolicy{}
+		if err := readJSONFile(opts.indexingPolicy, properties.IndexingPolicy); err != nil {
+			return azcosmos.ContainerProperties{}, err
+		}
+	}
+	if opts.vectorPolicy != "" {
+		properties.VectorEmbeddingPolicy = &azcosmos.VectorEmbeddingPolicy{}
+		if err := readJSONFile(opts.vectorPolicy, properties.VectorEmbeddingPolicy); err != nil {
+			return azcosmos.ContainerProperties{}, err
+		}
+	}
+	return properties, nil
+}
+
+func readJSONFile(file string, value any) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// parseThroughput parses --throughput, which is the container's RU/s, autoscale:<max RU/s>, or "" to leave it to the account (as a serverless account requires).
+func parseThroughput(throughput string) (*azcosmos.ThroughputProperties, error) {
+	if throughput == "" {
+		return nil, nil
+	}
+	value, autoscale := strings.CutPrefix(throughput, "autoscale:")
+	ru, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || ru <= 0 {
+		return nil, fmt.Errorf("--throughput must be RU/s, or autoscale:<max RU/s>, but was %q", throughput)
+	}
+	properties := azcosmos.NewManualThroughputProperties(int32(ru))
+	if autoscale {
+		properties = azcosmos.NewAutoscaleThroughputProperties(int32(ru))
+	}
+	return &properties, nil
+}
+
+// ensureDatabase creates the database, unless it already exists, and returns whether it was created.
+func ensureDatabase(ctx context.Context, client *azcosmos.Client, id string) (*azcosmos.DatabaseClient, bool, error) {
+	_, err := client.CreateDatabase(ctx, azcosmos.DatabaseProperties{ID: id}, nil)
+	created := err == nil
+	if err != nil && !isStatus(err, http.StatusConflict) {
+		return nil, false, fmt.Errorf("failed to create database %s: %w", id, err)
+	}
+	database, err := client.NewDatabase(id)
+	return database, created, err
+}
+
+// ensureContainer creates the container, unless it already exists with the same partition key, in which case it's left as it is.
+// With drop, the container is deleted and created again, whether or not it existed.
+// It returns how the container came to be, for the summary.
+func ensureContainer(ctx context.Context, database *azcosmos.DatabaseClient, properties azcosmos.ContainerProperties, throughput *azcosmos.ThroughputProperties, drop bool) (*azcosmos.ContainerClient, string, error) {
+	container, err := database.NewContainer(properties.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	status := "created"
+	if drop {
+		_, err := container.Delete(ctx, nil)
+		if err == nil {
+			status = "recreated"
+		} else if !isStatus(err, http.StatusNotFound) {
+			return nil, "", fmt.Errorf("failed to delete container %s: %w", properties.ID, err)
+		}
+	}
+
+	_, err = database.CreateContainer(ctx, properties, &azcosmos.CreateContainerOptions{ThroughputProperties: throughput})
+	if err == nil {
+		return container, status, nil
+	}
+	if !isStatus(err, http.StatusConflict) {
+		return nil, "", fmt.Errorf("failed to create container %s: %w", properties.ID, err)
+	}
+
+	// The container already exists, so its documents must have the partition key it was created with.
+	existing, err := container.Read(ctx, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read container %s: %w", properties.ID, err)
+	}
+	if paths := existing.ContainerProperties.PartitionKeyDefinition.Paths; !slices.Equal(paths, properties.PartitionKeyDefinition.Paths) {
+		return nil, "", fmt.Errorf("container %s already exists, partitioned by %s instead of %s; use --drop to recreate it",
+			properties.ID, strings.Join(paths, ", "), strings.Join(properties.PartitionKeyDefinition.Paths, ", "))
+	}
+	return container, "already exists, so its policies and throughput are unchanged", nil
+}
+
+func isStatus(err error, status int) bool {
+	var responseErr *azcore.ResponseError
+	return errors.As(err, &responseErr) && responseErr.StatusCode == status
+}
@@ -0,0 +1,273 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// fakeAccount is an account with the databases, containers, and documents the seed subcommand creates, kept in memory.
+type fakeAccount struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	databases  map[string]bool
+	containers map[string]json.RawMessage
+	documents  map[string]map[string]string
+	throughput map[string]string
+}
+
+func newFakeAccount(t *testing.T) *fakeAccount {
+	a := &fakeAccount{databases: map[string]bool{}, containers: map[string]json.RawMessage{}, documents: map[string]map[string]string{}, throughput: map[string]string{}}
+	a.Server = httptest.NewServer(http.HandlerFunc(a.serve))
+	t.Cleanup(a.Close)
+	return a
+}
+
+func (a *fakeAccount) serve(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	w.Header().Set("x-ms-request-charge", "1.5")
+	respond := func(status int, body []byte) {
+		w.WriteHeader(status)
+		w.Write(body)
+	}
+	var resource struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(body, &resource)
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/":
+		respond(http.StatusOK, []byte(`{}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/dbs":
+		if a.databases[resource.ID] {
+			respond(http.StatusConflict, []byte(`{"code":"Conflict"}`))
+			return
+		}
+		a.databases[resource.ID] = true
+		respond(http.StatusCreated, body)
+	case len(segments) == 3 && r.Method == http.MethodPost && segments[2] == "colls":
+		name := segments[1] + "/" + resource.ID
+		if _, ok := a.containers[name]; ok {
+			respond(http.StatusConflict, []byte(`{"code":"Conflict"}`))
+			return
+		}
+		a.containers[name] = body
+		a.documents[name] = map[string]string{}
+		a.throughput[name] = r.Header.Get("x-ms-cosmos-offer-autopilot-settings") + r.Header.Get("x-ms-offer-throughput")
+		respond(http.StatusCreated, body)
+	case len(segments) == 4 && segments[2] == "colls":
+		name := segments[1] + "/" + segments[3]
+		properties, ok := a.containers[name]
+		switch {
+		case !ok:
+			respond(http.StatusNotFound, []byte(`{"code":"NotFound"}`))
+		case r.Method == http.MethodGet:
+			respond(http.StatusOK, properties)
+		case r.Method == http.MethodDelete:
+			delete(a.containers, name)
+			delete(a.documents, name)
+			respond(http.StatusNoContent, nil)
+		}
+	case len(segments) == 5 && r.Method == http.MethodPost && segments[4] == "docs":
+		documents, ok := a.documents[segments[1]+"/"+segments[3]]
+		switch {
+		case !ok:
+			respond(http.StatusNotFound, []byte(`{"code":"NotFound"}`))
+		case documents[resource.ID] != "":
+			respond(http.StatusConflict, []byte(`{"code":"Conflict"}`))
+		default:
+			documents[resource.ID] = r.Header.Get("x-ms-documentdb-partitionkey")
+			respond(http.StatusCreated, body)
+		}
+	default:
+		respond(http.StatusNotFound, []byte(`{"code":"NotFound"}`))
+	}
+}
+
+// runSeed runs the seed subcommand against the account with the arguments, after the connection flags.
+func runSeed(t *testing.T, account *fakeAccount, args ...string) (string, error) {
+	t.Helper()
+	opts, err := parseArgs(append([]string{"seed", "--endpoint", account.URL, "--key", testKey}, args...), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	charges := &chargeMeter{}
+	client, err := newAccountClient(opts, charges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = seed(context.Background(), client, charges, opts, &out)
+	return out.String(), err
+}
+
+func writeTestFile(t *testing.T, name string, contents string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSeed(t *testing.T) {
+	account := newFakeAccount(t)
+	documents := writeTestFile(t, "docs.ndjson", "{\"id\":\"1\",\"pk\":\"a\"}\n\n{\"id\":\"2\",\"pk\":\"b\"}\n")
+
+	out, err := runSeed(t, account, "--database", "db", "--container", "c", "--partition-key-path", "/pk", "--throughput", "400", documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Database db: created\n", "Container c (partitioned by /pk): created\n", "Inserted 2 documents in ", "3.00 RU", "; 0 throttled inserts were retried\n"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected the summary to contain %q, got:\n%s", expected, out)
+		}
+	}
+	if expected := map[string]string{"1": `["a"]`, "2": `["b"]`}; !maps.Equal(account.documents["db/c"], expected) {
+		t.Errorf("expected the documents %v, got %v", expected, account.documents["db/c"])
+	}
+	if account.throughput["db/c"] != "400" {
+		t.Errorf("expected the container to have 400 RU/s, got %q", account.throughput["db/c"])
+	}
+
+	// Loading the same documents again conflicts with those already there, unless the container is recreated.
+	if _, err := runSeed(t, account, "--database", "db", "--container", "c", "--partition-key-path", "/pk", documents); err == nil || !strings.Contains(err.Error(), "use --drop to recreate it") {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	out, err = runSeed(t, account, "--database", "db", "--container", "c", "--partition-key-path", "/pk", "--drop", documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Database db: already exists\nContainer c (partitioned by /pk): recreated\nInserted 2 documents") {
+		t.Errorf("expected the container to be recreated, got:\n%s", out)
+	}
+	if len(account.documents["db/c"]) != 2 {
+		t.Errorf("expected the 2 documents, got %v", account.documents["db/c"])
+	}
+
+	// Dropping a container that doesn't exist just creates it.
+	if out, err := runSeed(t, account, "--database", "db", "--container", "other", "--drop", documents); err != nil || !strings.Contains(out, "Container other (partitioned by /id): created\n") {
+		t.Errorf("expected the container to be created, got %v:\n%s", err, out)
+	}
+}
+
+func TestSeedExistingContainer(t *testing.T) {
+	account := newFakeAccount(t)
+	first := writeTestFile(t, "first.json", `[{"id": "1", "pk": "a"}]`)
+	second := writeTestFile(t, "second.json", `[{"id": "2", "pk": "a", "tenant": "t"}]`)
+	if _, err := runSeed(t, account, "--database", "db", "--container", "c", "--partition-key-path", "/pk", first); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runSeed(t, account, "--database", "db", "--container", "c", "--partition-key-path", "/pk", second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Container c (partitioned by /pk): already exists, so its policies and throughput are unchanged\n") || len(account.documents["db/c"]) != 2 {
+		t.Errorf("expected the documents to be added to the existing container, got %v:\n%s", account.documents["db/c"], out)
+	}
+
+	_, err = runSeed(t, account, "--database", "db", "--container", "c", "--partition-key-path", "/tenant", second)
+	if err == nil || err.Error() != "container c already exists, partitioned by /pk instead of /tenant; use --drop to recreate it" {
+		t.Errorf("expected an error for the different partition key, got %v", err)
+	}
+}
+
+func TestParseDocuments(t *testing.T) {
+	for name, data := range map[string]string{
+		"array":  " [{\"id\": \"1\"},\n {\"id\": \"2\", \"n\": [1, 2]}]\n",
+		"ndjson": "{\"id\": \"1\"}\r\n\n{\"id\": \"2\", \"n\": [1, 2]}",
+	} {
+		documents, err := parseDocuments([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(documents) != 2 || string(documents[0]) != `{"id": "1"}` || string(documents[1]) != `{"id": "2", "n": [1, 2]}` {
+			t.Errorf("%s: unexpected documents %q", name, documents)
+		}
+	}
+
+	for data, message := range map[string]string{
+		`[{"id": "1"}, 2]`:          "document 1 isn't a JSON object",
+		`{"id": "1"} {"name": "x"}`: "document 1 has no id",
+		`{"id": ""}`:                "document 0 has no id",
+		"{\"id\": \"1\"}\n{":        "document 1 isn't JSON",
+		`[{"id": "1"}`:              "the documents aren't a JSON array",
+	} {
+		if _, err := parseDocuments([]byte(data)); err == nil || !strings.HasPrefix(err.Error(), message) {
+			t.Errorf("%q: expected an error starting with %q, got %v", data, message, err)
+		}
+	}
+}
+
+func TestContainerProperties(t *testing.T) {
+	indexing := writeTestFile(t, "indexing.json", `{"indexingMode": "consistent", "vectorIndexes": [{"path": "/embedding", "type": "flat"}]}`)
+	vector := writeTestFile(t, "vector.json", `{"vectorEmbeddings": [{"path": "/embedding", "dataType": "float32", "distanceFunction": "cosine", "dimensions": 3}]}`)
+	properties, err := containerProperties(options{container: "c", partitionKeyPaths: "/tenant,/user", indexingPolicy: indexing, vectorPolicy: vector})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if properties.ID != "c" || strings.Join(properties.PartitionKeyDefinition.Paths, ",") != "/tenant,/user" || properties.PartitionKeyDefinition.Version != 2 {
+		t.Errorf("unexpected properties %+v", properties)
+	}
+	if properties.IndexingPolicy == nil || len(properties.IndexingPolicy.VectorIndexes) != 1 || properties.IndexingPolicy.VectorIndexes[0].Path != "/embedding" {
+		t.Errorf("expected the indexing policy to be read, got %+v", properties.IndexingPolicy)
+	}
+	if properties.VectorEmbeddingPolicy == nil || len(properties.VectorEmbeddingPolicy.VectorEmbeddings) != 1 || properties.VectorEmbeddingPolicy.VectorEmbeddings[0].Dimensions != 3 {
+		t.Errorf("expected the vector embedding policy to be read, got %+v", properties.VectorEmbeddingPolicy)
+	}
+
+	for _, path := range []string{"pk", "/", "/address/city", "/pk,"} {
+		if _, err := containerProperties(options{partitionKeyPaths: path}); err == nil {
+			t.Errorf("expected an error for the partition key path %q", path)
+		}
+	}
+	misspelled := writeTestFile(t, "misspelled.json", `{"vectorEmbedings": []}`)
+	if _, err := containerProperties(options{partitionKeyPaths: "/id", vectorPolicy: misspelled}); err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Errorf("expected an error for the misspelled policy, got %v", err)
+	}
+}
+
+func TestParseThroughput(t *testing.T) {
+	if throughput, err := parseThroughput(""); throughput != nil || err != nil {
+		t.Errorf("expected no throughput, got %v (%v)", throughput, err)
+	}
+	manual := azcosmos.NewManualThroughputProperties(400)
+	autoscale := azcosmos.NewAutoscaleThroughputProperties(4000)
+	for value, expected := range map[string]azcosmos.ThroughputProperties{"400": manual, "autoscale:4000": autoscale} {
+		throughput, err := parseThroughput(value)
+		if err != nil {
+			t.Errorf("%s: %v", value, err)
+			continue
+		}
+		actual, _ := json.Marshal(throughput)
+		wanted, _ := json.Marshal(&expected)
+		if string(actual) != string(wanted) {
+			t.Errorf("%s: expected %s, got %s", value, wanted, actual)
+		}
+	}
+	for _, value := range []string{"0", "-1", "manual:400", "autoscale:", "lots"} {
+		if _, err := parseThroughput(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
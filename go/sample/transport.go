@@ -0,0 +1,38 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/internal/emulator"
+)
+
+// tlsConfig returns the TLS configuration to connect to the endpoint with, or nil to use the default transport, which verifies the account's certificate with the system's roots.
+//
+// With caCertFile, the certificates in that PEM file are trusted as well as the system's roots, which is how to trust the emulator's certificate.
+// Otherwise, verification is skipped if insecure is set or the endpoint is local, since the emulator's certificate is self-signed.
+func tlsConfig(endpoint string, insecure bool, caCertFile string) (*tls.Config, error) {
+	if caCertFile != "" {
+		pem, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s has no PEM certificates", caCertFile)
+		}
+		return &tls.Config{RootCAs: roots}, nil
+	}
+	if insecure || emulator.IsLocalEndpoint(endpoint) {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSConfig(t *testing.T) {
+	// Remote endpoints use the default transport, unless verification is explicitly skipped.
+	config, err := tlsConfig("https://myaccount.documents.azure.com:443/", false, "")
+	if err != nil || config != nil {
+		t.Errorf("expected the default transport, got %+v (%v)", config, err)
+	}
+	config, err = tlsConfig("https://myaccount.documents.azure.com:443/", true, "")
+	if err != nil || config == nil || !config.InsecureSkipVerify {
+		t.Errorf("expected verification to be skipped with --insecure, got %+v (%v)", config, err)
+	}
+
+	// The emulator's certificate is self-signed, so verification is skipped for local endpoints.
+	config, err = tlsConfig("https://localhost:8081", false, "")
+	if err != nil || config == nil || !config.InsecureSkipVerify {
+		t.Errorf("expected verification to be skipped for the emulator, got %+v (%v)", config, err)
+	}
+}
+
+func TestTLSConfigWithCACert(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "emulator.pem")
+	if err := os.WriteFile(certFile, selfSignedCertificate(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The certificate is trusted, and verified, even for the emulator.
+	config, err := tlsConfig("https://localhost:8081", false, certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.InsecureSkipVerify || config.RootCAs == nil {
+		t.Errorf("expected the certificate to be verified with the extra root, got %+v", config)
+	}
+
+	notPEM := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tlsConfig("https://localhost:8081", false, notPEM); err == nil || !strings.Contains(err.Error(), "has no PEM certificates") {
+		t.Errorf("expected an error for a file without certificates, got %v", err)
+	}
+	if _, err := tlsConfig("https://localhost:8081", false, filepath.Join(dir, "missing.pem")); !os.IsNotExist(err) {
+		t.Errorf("expected an error for a missing file, got %v", err)
+	}
+}
+
+// selfSignedCertificate returns a PEM-encoded self-signed certificate for localhost, like the emulator's.
+func selfSignedCertificate(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
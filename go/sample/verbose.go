@@ -0,0 +1,98 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+)
+
+// pageDiagnostics prints, for each page of a query, what the engine's turns did while it was read, for --verbose:
+// the requests each turn made and the continuations they resume from, how many pages were provided,
+// how many items came from the pipeline's buffer rather than from new responses, and the pipelines' stats.
+// It gets the turns from the engine's OnTurn callback. A nil *pageDiagnostics prints nothing.
+type pageDiagnostics struct {
+	out    io.Writer
+	engine *trackingEngine
+
+	mu    sync.Mutex
+	turns []azcosmoscx.TurnInfo
+	pages int
+}
+
+// newPageDiagnostics creates diagnostics that print to out. Their engine is set once it's created, since its OnTurn callback is their turn method.
+func newPageDiagnostics(out io.Writer) *pageDiagnostics {
+	return &pageDiagnostics{out: out}
+}
+
+// turn records a turn of a pipeline, to be printed with the page it's part of.
+func (d *pageDiagnostics) turn(turn azcosmoscx.TurnInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.turns = append(d.turns, turn)
+}
+
+// page prints the page, with the items it contained, and the turns since the previous page.
+func (d *pageDiagnostics) page(items int) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	turns := d.turns
+	d.turns = nil
+	d.pages++
+	d.mu.Unlock()
+
+	// A turn's items were already buffered if no pages were provided since the turn before it.
+	var buffered, fresh int
+	for _, turn := range turns {
+		if turn.PagesProvided == 0 {
+			buffered += turn.Items
+		} else {
+			fresh += turn.Items
+		}
+	}
+	fmt.Fprintf(d.out, "page %d: %d items from %d turns, %d from the buffer and %d after new responses\n", d.pages, items, len(turns), buffered, fresh)
+	for _, turn := range turns {
+		fmt.Fprintf(d.out, "  turn %d: %s\n", turn.Turn, describeTurn(turn))
+	}
+	if d.engine == nil {
+		return
+	}
+	if stats, pipelines := d.engine.Stats(); pipelines > 0 {
+		fmt.Fprintf(d.out, "  stats: %d turns, %d items emitted, %d ProvideData calls, %d pages (%d bytes) provided, %v in native code\n",
+			stats.Turns, stats.ItemsEmitted, stats.ProvideDataCalls, stats.PagesProvided, stats.BytesProvided, stats.NativeTime)
+	}
+}
+
+// describeTurn describes the pages provided before the turn, and the items and requests it returned.
+func describeTurn(turn azcosmoscx.TurnInfo) string {
+	var parts []string
+	if turn.PagesProvided > 0 {
+		parts = append(parts, fmt.Sprintf("after %d pages were provided", turn.PagesProvided))
+	}
+	if turn.Err != nil {
+		return strings.Join(append(parts, fmt.Sprintf("failed: %v", turn.Err)), ", ")
+	}
+	parts = append(parts, fmt.Sprintf("returned %d items", turn.Items))
+	if len(turn.Requests) > 0 {
+		requests := make([]string, 0, len(turn.Requests))
+		for i, pkrange := range turn.Requests {
+			if turn.Continuations[i] == "" {
+				requests = append(requests, pkrange+" from its first page")
+			} else {
+				requests = append(requests, fmt.Sprintf("%s from continuation %q", pkrange, turn.Continuations[i]))
+			}
+		}
+		parts = append(parts, "requested "+strings.Join(requests, ", "))
+	}
+	if turn.Completed {
+		parts = append(parts, "completed")
+	}
+	return strings.Join(parts, ", ")
+}
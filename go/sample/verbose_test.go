@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-cosmos-client-engine/go/azcosmoscx"
+	"github.com/Azure/azure-cosmos-client-engine/go/sample/internal/results"
+)
+
+func TestPageDiagnostics(t *testing.T) {
+	f, err := readFixture(filepath.Join("testdata", "offline", "order_by"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output strings.Builder
+	diagnostics := newPageDiagnostics(&output)
+	engine := &trackingEngine{QueryEngine: azcosmoscx.NewQueryEngineWithOptions(azcosmoscx.EngineOptions{OnTurn: diagnostics.turn})}
+	defer engine.Close()
+	diagnostics.engine = engine
+	pager, err := newOfflinePager(engine, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, _ := results.NewWriter(io.Discard, results.FormatNDJSON, results.Options{})
+	if err := executeQuery(pager, writer, nil, diagnostics, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first turn requests every partition's first page, and the later ones follow partition0's and partition1's continuations.
+	for _, expected := range []string{
+		"page 1: ",
+		"requested partition0 from its first page, partition1 from its first page, partition2 from its first page",
+		`from continuation "1"`,
+		"after new responses",
+		"completed",
+		"  stats: ",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected the diagnostics to contain %q, got:\n%s", expected, output.String())
+		}
+	}
+}
+
+func TestDescribeTurn(t *testing.T) {
+	for _, c := range []struct {
+		turn     azcosmoscx.TurnInfo
+		expected string
+	}{
+		{
+			azcosmoscx.TurnInfo{Items: 2, Requests: []string{"0", "1"}, Continuations: []string{"", "token"}, PagesProvided: 3},
+			`after 3 pages were provided, returned 2 items, requested 0 from its first page, 1 from continuation "token"`,
+		},
+		{azcosmoscx.TurnInfo{Items: 1, Completed: true}, "returned 1 items, completed"},
+		{azcosmoscx.TurnInfo{PagesProvided: 1, Err: errors.New("the engine failed")}, "after 1 pages were provided, failed: the engine failed"},
+	} {
+		if actual := describeTurn(c.turn); actual != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, actual)
+		}
+	}
+}
+
+func TestPageDiagnosticsCountsBufferedItems(t *testing.T) {
+	var output strings.Builder
+	diagnostics := newPageDiagnostics(&output)
+	diagnostics.turn(azcosmoscx.TurnInfo{Turn: 1, Items: 0, Requests: []string{"0"}, Continuations: []string{""}})
+	diagnostics.turn(azcosmoscx.TurnInfo{Turn: 2, Items: 3, PagesProvided: 1})
+	diagnostics.page(3)
+	diagnostics.turn(azcosmoscx.TurnInfo{Turn: 3, Items: 2, Completed: true})
+	diagnostics.page(2)
+
+	expected := "" +
+		"page 1: 3 items from 2 turns, 0 from the buffer and 3 after new responses\n" +
+		"  turn 1: returned 0 items, requested 0 from its first page\n" +
+		"  turn 2: after 1 pages were provided, returned 3 items\n" +
+		"page 2: 2 items from 1 turns, 2 from the buffer and 0 after new responses\n" +
+		"  turn 3: returned 2 items, completed\n"
+	if output.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output.String())
+	}
+
+	// Without --verbose, there are no diagnostics to print.
+	var none *pageDiagnostics
+	none.page(1)
+}
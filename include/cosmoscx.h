@@ -62,9 +62,34 @@ enum CosmosCxResultCode {
    * See [`ErrorKind::InvalidQuery`].
    */
   COSMOS_CX_RESULT_CODE_INVALID_QUERY = -11,
+  /**
+   * See [`ErrorKind::InvalidContinuation`].
+   */
+  COSMOS_CX_RESULT_CODE_INVALID_CONTINUATION = -12,
+  /**
+   * See [`ErrorKind::BufferLimitExceeded`].
+   */
+  COSMOS_CX_RESULT_CODE_BUFFER_LIMIT_EXCEEDED = -13,
 };
 typedef intptr_t CosmosCxResultCode;
 
+/**
+ * Identifies the kind of problem described by a [`Warning`].
+ *
+ * Values of `WarningCode` have the same representation as the C type `intptr_t`
+ */
+enum CosmosCxWarningCode {
+  /**
+   * See [`WarningCode::UndefinedOrderByItem`](azure_data_cosmos_engine::query::WarningCode::UndefinedOrderByItem).
+   */
+  COSMOS_CX_WARNING_CODE_UNDEFINED_ORDER_BY_ITEM = 1,
+  /**
+   * See [`WarningCode::SkippedItem`](azure_data_cosmos_engine::query::WarningCode::SkippedItem).
+   */
+  COSMOS_CX_WARNING_CODE_SKIPPED_ITEM = 2,
+};
+typedef intptr_t CosmosCxWarningCode;
+
 /**
  * Opaque type representing the query pipeline.
  * Callers should not attempt to access the fields of this struct directly.
@@ -173,6 +198,27 @@ typedef struct CosmosCxOwnedSlice_u8 {
  */
 typedef struct CosmosCxOwnedSlice_u8 CosmosCxOwnedString;
 
+/**
+ * A result type for FFI functions.
+ *
+ * An `FfiResult` is returned from a function that both returns a value AND can fail.
+ *
+ * The C representation of this struct is:
+ *
+ * ```
+ * struct {
+ *   intptr_t code; // The result code, which will be '0' if the operation succeeded
+ *   const void *value; // A pointer to the returned value, which will be `nullptr`/`0` if the operation failed.
+ * };
+ * ```
+ *
+ * The data pointed to by the `value` pointer is OWNED BY THE ENGINE and must be freed by calling the appropriate free function, depending on the data.
+ */
+typedef struct CosmosCxFfiResult_OwnedString {
+  CosmosCxResultCode code;
+  const CosmosCxOwnedString *value;
+} CosmosCxFfiResult_OwnedString;
+
 /**
  * Represents a contiguous sequence of objects OWNED BY THE ENGINE.
  *
@@ -225,6 +271,23 @@ typedef struct CosmosCxDataRequest {
    * If this value is false, the query should be executed without parameters.
    */
   bool include_parameters;
+  /**
+   * An [`OwnedString`] containing the minimum effective partition key (EPK) this request is scoped to.
+   * If [`DataRequest::epk_max`] is an empty slice (len == 0), the request covers the entire partition key range and this value should be ignored.
+   */
+  CosmosCxOwnedString epk_min;
+  /**
+   * An [`OwnedString`] containing the maximum effective partition key (EPK) this request is scoped to, or an empty slice (len == 0) if the request covers the entire partition key range.
+   */
+  CosmosCxOwnedString epk_max;
+  /**
+   * A boolean indicating if [`DataRequest::epk_min`] is inclusive. If false, it's exclusive.
+   */
+  bool epk_min_inclusive;
+  /**
+   * A boolean indicating if [`DataRequest::epk_max`] is inclusive. If false, it's exclusive.
+   */
+  bool epk_max_inclusive;
 } CosmosCxDataRequest;
 
 /**
@@ -251,6 +314,48 @@ typedef struct CosmosCxOwnedSlice_DataRequest {
   uintptr_t len;
 } CosmosCxOwnedSlice_DataRequest;
 
+/**
+ * Describes a problem with the data provided to the pipeline that the pipeline worked around, rather than failing the query.
+ */
+typedef struct CosmosCxWarning {
+  /**
+   * The kind of problem.
+   */
+  CosmosCxWarningCode code;
+  /**
+   * An [`OwnedString`] describing the problem.
+   */
+  CosmosCxOwnedString message;
+  /**
+   * An [`OwnedString`] containing the ID of the partition key range whose data had the problem.
+   */
+  CosmosCxOwnedString pkrange_id;
+} CosmosCxWarning;
+
+/**
+ * Represents a contiguous sequence of objects OWNED BY THE ENGINE.
+ *
+ * The language binding MUST free the memory associated with this sequence by calling the appropriate 'free' function.
+ * For example, all [`OwnedSlice`]s within a [`PipelineResponse`](azure_data_cosmos_engine::query::PipelineResponse) are freed by calling [`cosmoscx_v0_query_pipeline_free_result`](super::pipeline::cosmoscx_v0_query_pipeline_free_result).
+ *
+ * The C representation of this struct is:
+ *
+ * ```
+ * struct {
+ *   const void *data; // A pointer to the first item in the slice
+ *   intptr_t len; // The number of items in the slice.
+ * };
+ * ```
+ *
+ * The `data` pointer is guaranteed to point to a contiguous sequence of `T` values.
+ * Each `T` value will be properly aligned.
+ * Thus, the `data` pointer can be treated as a C-style array of length `len`.
+ */
+typedef struct CosmosCxOwnedSlice_Warning {
+  struct CosmosCxWarning *data;
+  uintptr_t len;
+} CosmosCxOwnedSlice_Warning;
+
 /**
  * Represents the result of a single execution of the query pipeline.
  */
@@ -267,6 +372,10 @@ typedef struct CosmosCxPipelineResult {
    * An [`OwnedSlice`] of [`DataRequest`]s describing additional requests that must be made and provided to [`cosmoscx_v0_query_pipeline_provide_data`] before retrieving the next batch.
    */
   struct CosmosCxOwnedSlice_DataRequest requests;
+  /**
+   * An [`OwnedSlice`] of [`Warning`]s describing problems with the data provided since the previous turn, which the pipeline worked around.
+   */
+  struct CosmosCxOwnedSlice_Warning warnings;
 } CosmosCxPipelineResult;
 
 /**
@@ -304,12 +413,20 @@ typedef struct CosmosCxQueryResponse {
   uint64_t request_id;
   /**
    * The raw data being provided to the pipeline in response to the request.
+   *
+   * If [`QueryResponse::content_encoding`] is set, this contains the encoded body, which need not be valid UTF-8.
    */
   CosmosCxStr data;
   /**
    * The continuation token to provide, or an empty slice (len == 0) if no continuation should be provided.
    */
   CosmosCxStr continuation;
+  /**
+   * The encoding of [`QueryResponse::data`], as reported by the `Content-Encoding` header of the response.
+   *
+   * An empty slice (len == 0) or `identity` indicates that the data is not encoded. The engine decodes `gzip` and `deflate` bodies itself.
+   */
+  CosmosCxStr content_encoding;
 } CosmosCxQueryResponse;
 
 /**
@@ -328,6 +445,43 @@ typedef struct CosmosCxSlice_QueryResponse {
   uintptr_t len;
 } CosmosCxSlice_QueryResponse;
 
+/**
+ * Describes the features required by a query plan, and which of them are NOT supported by the engine.
+ */
+typedef struct CosmosCxPlanCheckResult {
+  /**
+   * A comma-separated list of the camelCase names of the features required by the query plan.
+   */
+  CosmosCxOwnedString required_features;
+  /**
+   * A comma-separated list of the camelCase names of the required features that are NOT supported by the engine.
+   *
+   * If this is empty ([`OwnedString::len`] == 0), the engine supports the query plan.
+   */
+  CosmosCxOwnedString missing_features;
+} CosmosCxPlanCheckResult;
+
+/**
+ * A result type for FFI functions.
+ *
+ * An `FfiResult` is returned from a function that both returns a value AND can fail.
+ *
+ * The C representation of this struct is:
+ *
+ * ```
+ * struct {
+ *   intptr_t code; // The result code, which will be '0' if the operation succeeded
+ *   const void *value; // A pointer to the returned value, which will be `nullptr`/`0` if the operation failed.
+ * };
+ * ```
+ *
+ * The data pointed to by the `value` pointer is OWNED BY THE ENGINE and must be freed by calling the appropriate free function, depending on the data.
+ */
+typedef struct CosmosCxFfiResult_PlanCheckResult {
+  CosmosCxResultCode code;
+  const struct CosmosCxPlanCheckResult *value;
+} CosmosCxFfiResult_PlanCheckResult;
+
 /**
  * Returns the version of the Cosmos Client Engine in use.
  */
@@ -346,10 +500,40 @@ const char *cosmoscx_v0_query_supported_features(void);
  * This is an early version of the tracing API and is subject to change.
  * For now, it activates the default console tracing in [`tracing_subscriber::fmt`](fn@tracing_subscriber::fmt) and enables the [`EnvFilter`](`tracing_subscriber::EnvFilter`) using the `COSMOSCX_LOG` environment variable.
  *
- * Once enabled in this way, tracing cannot be disabled.
+ * Once enabled in this way, tracing cannot be disabled, but its filter can be replaced with [`cosmoscx_v0_tracing_set_filter`].
+ * Only the first call installs the subscriber, later calls (including concurrent ones) have no effect.
  */
 void cosmoscx_v0_tracing_enable(void);
 
+/**
+ * Replaces the filter that selects which traces are written, enabling tracing first if it isn't already (see [`cosmoscx_v0_tracing_enable`]).
+ *
+ * This can be called any number of times, from any thread, to adjust the verbosity of tracing while pipelines are running.
+ *
+ * # Parameters
+ * - `filter`: A [`Str`] containing the filter's directives, using the same syntax as the `COSMOSCX_LOG` environment variable, such as `debug` or `azure_data_cosmos_engine=trace`.
+ *
+ * # Returns
+ *
+ * [`ResultCode::DeserializationError`] if the directives can't be parsed, in which case the filter isn't changed.
+ */
+CosmosCxResultCode cosmoscx_v0_tracing_set_filter(CosmosCxStr filter);
+
+/**
+ * Parses and validates a JSON list of partition key ranges, without creating a pipeline.
+ *
+ * See [`PartitionKeyRange::validate_all`] for the rules the ranges must satisfy.
+ *
+ * # Parameters
+ * - `pkranges`: A [`Str`] containing the serialized partition key ranges list, as recieved from the gateway, in JSON.
+ *
+ * # Returns
+ *
+ * An empty [`OwnedString`] if the ranges are valid, otherwise a description of the problem, naming the offending range.
+ * The returned string MUST be freed using [`cosmoscx_v0_string_free`](crate::slice::cosmoscx_v0_string_free).
+ */
+CosmosCxOwnedString cosmoscx_v0_query_pkranges_validate(CosmosCxStr pkranges);
+
 /**
  * Creates a new query pipeline from a JSON query plan and list of partitions.
  *
@@ -361,6 +545,38 @@ struct CosmosCxFfiResult_Pipeline cosmoscx_v0_query_pipeline_create(CosmosCxStr
                                                                     CosmosCxStr query_plan_json,
                                                                     CosmosCxStr pkranges);
 
+/**
+ * Creates a new query pipeline that is scoped to a single partition key value.
+ *
+ * The engine computes the effective partition key (EPK) of the provided partition key, and all requests issued by the pipeline target the partition key range that owns it.
+ *
+ * # Parameters
+ * - `query_plan_json`: A [`Str`] containing the serialized query plan, as recieved from the gateway, in JSON.
+ * - `pkranges`: A [`Str`] containing the serialized partition key ranges list, as recieved from the gateway, in JSON.
+ * - `partition_key`: A [`Str`] containing the partition key, as a JSON array with one value per partition key path.
+ * - `partition_key_definition`: A [`Str`] containing the container's partition key definition (`kind`, `paths`, `version`), in JSON.
+ */
+struct CosmosCxFfiResult_Pipeline cosmoscx_v0_query_pipeline_create_for_partition_key(CosmosCxStr query,
+                                                                                      CosmosCxStr query_plan_json,
+                                                                                      CosmosCxStr pkranges,
+                                                                                      CosmosCxStr partition_key,
+                                                                                      CosmosCxStr partition_key_definition);
+
+/**
+ * Creates a new query pipeline that is scoped to a single effective partition key (EPK).
+ *
+ * All requests issued by the pipeline target the partition key range that owns the provided EPK.
+ *
+ * # Parameters
+ * - `query_plan_json`: A [`Str`] containing the serialized query plan, as recieved from the gateway, in JSON.
+ * - `pkranges`: A [`Str`] containing the serialized partition key ranges list, as recieved from the gateway, in JSON.
+ * - `effective_partition_key`: A [`Str`] containing the hex-encoded EPK.
+ */
+struct CosmosCxFfiResult_Pipeline cosmoscx_v0_query_pipeline_create_for_epk(CosmosCxStr query,
+                                                                           CosmosCxStr query_plan_json,
+                                                                           CosmosCxStr pkranges,
+                                                                           CosmosCxStr effective_partition_key);
+
 /**
  * Frees the memory associated with a pipeline.
  *
@@ -368,7 +584,7 @@ struct CosmosCxFfiResult_Pipeline cosmoscx_v0_query_pipeline_create(CosmosCxStr
  *
  * # Safety
  *
- * The caller must ensure that the pointer passed to this function is a valid pointer to a [`PipelineResult`] returned by [`cosmoscx_v0_query_pipeline_run`].
+ * The caller must ensure that the pointer passed to this function is a valid pointer to a [`Pipeline`] returned by one of the pipeline creation functions, such as [`cosmoscx_v0_query_pipeline_create`].
  */
 void cosmoscx_v0_query_pipeline_free(struct CosmosCxPipeline *pipeline);
 
@@ -380,6 +596,55 @@ void cosmoscx_v0_query_pipeline_free(struct CosmosCxPipeline *pipeline);
  */
 struct CosmosCxFfiResult_Str cosmoscx_v0_query_pipeline_query(struct CosmosCxPipeline *pipeline);
 
+/**
+ * Describes how the pipeline was constructed from the query plan, for debugging.
+ *
+ * See [`QueryPipeline::explain`](azure_data_cosmos_engine::query::QueryPipeline::explain) for more information.
+ * The returned [`OwnedString`] MUST be freed by calling [`cosmoscx_v0_query_pipeline_free_explanation`].
+ */
+struct CosmosCxFfiResult_OwnedString cosmoscx_v0_query_pipeline_explain(struct CosmosCxPipeline *pipeline);
+
+/**
+ * Frees an [`OwnedString`] returned by [`cosmoscx_v0_query_pipeline_explain`].
+ *
+ * # Safety
+ *
+ * The caller must ensure that the pointer passed to this function is a valid pointer to an [`OwnedString`] returned by [`cosmoscx_v0_query_pipeline_explain`].
+ */
+void cosmoscx_v0_query_pipeline_free_explanation(CosmosCxOwnedString *explanation);
+
+/**
+ * Stops the pipeline from fetching any more data, so that it only produces the items it has already buffered.
+ *
+ * After this is called, [`cosmoscx_v0_query_pipeline_run`] never returns requests, and the pipeline completes once the buffered items have been produced.
+ * See [`QueryPipeline::drain`](azure_data_cosmos_engine::query::QueryPipeline::drain) for more information.
+ */
+CosmosCxResultCode cosmoscx_v0_query_pipeline_drain(struct CosmosCxPipeline *pipeline);
+
+/**
+ * Sets the maximum number of partitions that the pipeline requests data for in a single turn, or `0` for no limit.
+ *
+ * See [`QueryPipeline::set_max_concurrent_partitions`](azure_data_cosmos_engine::query::QueryPipeline::set_max_concurrent_partitions) for more information.
+ */
+CosmosCxResultCode cosmoscx_v0_query_pipeline_set_max_concurrent_partitions(struct CosmosCxPipeline *pipeline,
+                                                                            uint32_t max);
+
+/**
+ * Sets the number of items the consumer wants from each turn, or `0` if it has no preference.
+ *
+ * See [`QueryPipeline::set_target_batch_size`](azure_data_cosmos_engine::query::QueryPipeline::set_target_batch_size) for more information.
+ */
+CosmosCxResultCode cosmoscx_v0_query_pipeline_set_target_batch_size(struct CosmosCxPipeline *pipeline,
+                                                                    uint32_t target);
+
+/**
+ * Sets the maximum number of items the pipeline may buffer while it waits for every partition to be drained, or `0` for no limit.
+ *
+ * See [`QueryPipeline::set_max_buffered_items`](azure_data_cosmos_engine::query::QueryPipeline::set_max_buffered_items) for more information.
+ */
+CosmosCxResultCode cosmoscx_v0_query_pipeline_set_max_buffered_items(struct CosmosCxPipeline *pipeline,
+                                                                     uint32_t max);
+
 /**
  * Executes a single turn of the query pipeline.
  *
@@ -404,6 +669,47 @@ void cosmoscx_v0_query_pipeline_free_result(struct CosmosCxPipelineResult *resul
 
 /**
  * Inserts additional raw data, in response to a [`DataRequest`] from the pipeline.
+ *
+ * Bodies encoded with `gzip` or `deflate` (see [`QueryResponse::content_encoding`]) are decoded before they're applied.
+ * An unsupported encoding, or a corrupt or truncated stream, is reported as [`ResultCode::InvalidGatewayResponse`].
+ *
+ * Responses are applied in order. If a response can't be applied (for example, because the body is malformed), an error is returned and that response,
+ * and any that follow it, are NOT applied. The pipeline remains usable, and the next call to [`cosmoscx_v0_query_pipeline_run`] will request the same data again.
  */
 CosmosCxResultCode cosmoscx_v0_query_pipeline_provide_data(struct CosmosCxPipeline *pipeline,
                                                            struct CosmosCxSlice_QueryResponse responses);
+
+/**
+ * Checks if the engine supports the provided JSON query plan, without creating a pipeline.
+ *
+ * # Parameters
+ * - `query_plan_json`: A [`Str`] containing the serialized query plan, as recieved from the gateway, in JSON.
+ */
+struct CosmosCxFfiResult_PlanCheckResult cosmoscx_v0_query_plan_check(CosmosCxStr query_plan_json);
+
+/**
+ * Frees all the memory associated with a [`PlanCheckResult`].
+ *
+ * # Safety
+ *
+ * The caller must ensure that the pointer passed to this function is a valid pointer to a [`PlanCheckResult`] returned by [`cosmoscx_v0_query_plan_check`].
+ */
+void cosmoscx_v0_query_plan_free_check_result(struct CosmosCxPlanCheckResult *result);
+
+/**
+ * Takes the message of the last error reported by an engine function called on the current thread.
+ *
+ * Result codes only identify the kind of error, this message describes it (for example, naming the partition key range and continuation tokens involved).
+ * The message is cleared once it's taken, and is replaced by each error that follows, so it must be taken immediately after the failing call, on the same thread.
+ *
+ * # Returns
+ *
+ * The message, or an empty [`OwnedString`] if no error has been reported since it was last taken.
+ * The returned string MUST be freed using [`cosmoscx_v0_string_free`](crate::slice::cosmoscx_v0_string_free).
+ */
+CosmosCxOwnedString cosmoscx_v0_last_error_message(void);
+
+/**
+ * Frees an [`OwnedString`] that was returned directly (rather than as part of another structure) by an engine function.
+ */
+void cosmoscx_v0_string_free(CosmosCxOwnedString s);
@@ -69,6 +69,30 @@ impl NativeQueryPipeline {
         pipeline.provide_data(pkrange_id, request_id, data.as_bytes(), continuation)?;
         Ok(())
     }
+
+    fn set_max_concurrent_partitions(&self, max: usize) -> PyResult<()> {
+        let mut pipeline = self.pipeline()?;
+        pipeline.set_max_concurrent_partitions(max);
+        Ok(())
+    }
+
+    fn set_target_batch_size(&self, target: usize) -> PyResult<()> {
+        let mut pipeline = self.pipeline()?;
+        pipeline.set_target_batch_size(target);
+        Ok(())
+    }
+
+    fn set_max_buffered_items(&self, max: usize) -> PyResult<()> {
+        let mut pipeline = self.pipeline()?;
+        pipeline.set_max_buffered_items(max);
+        Ok(())
+    }
+
+    fn drain(&self) -> PyResult<()> {
+        let mut pipeline = self.pipeline()?;
+        pipeline.drain();
+        Ok(())
+    }
 }
 
 #[pyclass(name = "PipelineResult")]
@@ -20,6 +20,7 @@ QUERY = "query"
 ID = "id"
 PARTITION_KEY = "partitionKey"
 PATHS = "paths"
+RESULTS_FROM = "resultsFrom"
 RESULTS_SUFFIX = ".results.json"
 
 class TestData(TypedDict):
@@ -107,7 +108,9 @@ def run_integration_test(query_set_path: str) -> None:
     # gets expected results from file and runs the queries to be tested
     def _runner(container):
         for query in query_set[QUERIES]:
-            res_file = query_path.parent / f"{query_set[NAME]}/{query[NAME]}{RESULTS_SUFFIX}"
+            # a query can be validated against another query's results
+            res_name = query.get(RESULTS_FROM, query[NAME])
+            res_file = query_path.parent / f"{query_set[NAME]}/{res_name}{RESULTS_SUFFIX}"
             with res_file.open("rb") as fh:
                 expected = json.load(fh)
             _run_single_query(expected, query, container)
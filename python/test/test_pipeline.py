@@ -17,7 +17,7 @@ class TestPipeline(unittest.TestCase):
         pkranges = [
             {
                 "id": "partition0",
-                "minInclusive": "00",
+                "minInclusive": "",
                 "maxExclusive": "FF"
             }
         ]
@@ -38,7 +38,7 @@ class TestPipeline(unittest.TestCase):
         pkranges = [
             {
                 "id": "partition0",
-                "minInclusive": "00",
+                "minInclusive": "",
                 "maxExclusive": "FF"
             }
         ]
@@ -58,7 +58,7 @@ class TestPipeline(unittest.TestCase):
         pkranges = [
             {
                 "id": "partition0",
-                "minInclusive": "00",
+                "minInclusive": "",
                 "maxExclusive": "99"
             },
             {
@@ -93,7 +93,7 @@ class TestPipeline(unittest.TestCase):
         pkranges = [
             {
                 "id": "partition0",
-                "minInclusive": "00",
+                "minInclusive": "",
                 "maxExclusive": "99"
             },
             {
@@ -144,7 +144,7 @@ class TestPipeline(unittest.TestCase):
         pkranges = [
             {
                 "id": "partition0",
-                "minInclusive": "00",
+                "minInclusive": "",
                 "maxExclusive": "99"
             },
             {